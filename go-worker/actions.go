@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	defaultLeftDelim  = "{{"
+	defaultRightDelim = "}}"
+)
+
+// validateDelims rejects custom delimiters in modes whose source analysis
+// still assumes {{ and }}.
+func validateDelims(opts renderOptions) error {
+	if opts.LeftDelim == "" && opts.RightDelim == "" {
+		return nil
+	}
+	switch opts.Mode {
+	case "", "render", "compare-refs", "partial", "symbols", "references", "rename", "deps", "fmt", "escape-report", "semantic-tokens":
+		return nil
+	default:
+		return fmt.Errorf("custom delimiters are not supported in %s mode", opts.Mode)
+	}
+}
+
+// actionSpan is the source range of a single `{{ ... }}` action.
+type actionSpan struct {
+	Start     int
+	End       int
+	Inner     string
+	TrimLeft  bool
+	TrimRight bool
+}
+
+// Keyword returns the first word of the action body, e.g. "if" or "end".
+func (a actionSpan) Keyword() string {
+	fields := strings.Fields(a.Body())
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
+// Body returns the action text without trim markers or surrounding spaces.
+func (a actionSpan) Body() string {
+	return strings.TrimSpace(a.Inner)
+}
+
+// IsComment reports whether the action is a `{{/* ... */}}` comment.
+func (a actionSpan) IsComment() bool {
+	return strings.HasPrefix(a.Body(), "/*")
+}
+
+// scanActions finds every action in content. It mirrors the text/template
+// lexer closely enough for tooling: quoted strings and comments may contain
+// the right delimiter without terminating the action.
+func scanActions(content, leftDelim, rightDelim string) []actionSpan {
+	if leftDelim == "" {
+		leftDelim = defaultLeftDelim
+	}
+	if rightDelim == "" {
+		rightDelim = defaultRightDelim
+	}
+
+	var spans []actionSpan
+	offset := 0
+	for {
+		start := strings.Index(content[offset:], leftDelim)
+		if start < 0 {
+			return spans
+		}
+		start += offset
+
+		innerStart := start + len(leftDelim)
+		span := actionSpan{Start: start}
+		if strings.HasPrefix(content[innerStart:], "- ") {
+			span.TrimLeft = true
+			innerStart += 2
+		}
+
+		end := findActionEnd(content, innerStart, rightDelim)
+		if end < 0 {
+			return spans
+		}
+
+		innerEnd := end
+		if innerEnd-2 >= innerStart && content[innerEnd-2:innerEnd] == " -" {
+			span.TrimRight = true
+			innerEnd -= 2
+		}
+
+		span.Inner = content[innerStart:innerEnd]
+		span.End = end + len(rightDelim)
+		spans = append(spans, span)
+		offset = span.End
+	}
+}
+
+func findActionEnd(content string, from int, rightDelim string) int {
+	if strings.HasPrefix(strings.TrimLeft(content[from:], " \t\r\n"), "/*") {
+		closing := strings.Index(content[from:], "*/")
+		if closing < 0 {
+			return -1
+		}
+		from += closing + 2
+	}
+
+	for i := from; i < len(content); i++ {
+		if strings.HasPrefix(content[i:], rightDelim) {
+			return i
+		}
+
+		switch content[i] {
+		case '"', '\'':
+			quote := content[i]
+			for i++; i < len(content) && content[i] != quote; i++ {
+				if content[i] == '\\' {
+					i++
+				}
+			}
+		case '`':
+			closing := strings.IndexByte(content[i+1:], '`')
+			if closing < 0 {
+				return -1
+			}
+			i += closing + 1
+		}
+	}
+
+	return -1
+}
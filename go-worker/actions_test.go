@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestScanActions(t *testing.T) {
+	content := "a {{- .x }} b {{ \"}}\" }} {{/* c }} */}} {{ if .y -}}"
+	actions := scanActions(content, "", "")
+	if len(actions) != 4 {
+		t.Fatalf("expected 4 actions, got %d: %+v", len(actions), actions)
+	}
+
+	if !actions[0].TrimLeft || actions[0].Body() != ".x" {
+		t.Fatalf("unexpected first action: %+v", actions[0])
+	}
+
+	if actions[1].Body() != `"}}"` {
+		t.Fatalf("expected quoted delimiter to stay inside action, got %+v", actions[1])
+	}
+
+	if !actions[2].IsComment() {
+		t.Fatalf("expected comment action, got %+v", actions[2])
+	}
+
+	if !actions[3].TrimRight || actions[3].Keyword() != "if" {
+		t.Fatalf("unexpected last action: %+v", actions[3])
+	}
+
+	if content[actions[3].Start:actions[3].End] != "{{ if .y -}}" {
+		t.Fatalf("unexpected span: %q", content[actions[3].Start:actions[3].End])
+	}
+}
+
+func TestScanActionsCustomDelims(t *testing.T) {
+	actions := scanActions("[[ .a ]] {{ .b }}", "[[", "]]")
+	if len(actions) != 1 || actions[0].Body() != ".a" {
+		t.Fatalf("unexpected actions: %+v", actions)
+	}
+}
+
+func TestRenderWithCustomDelims(t *testing.T) {
+	dir := t.TempDir()
+	textPath := filepath.Join(dir, "deploy.yaml.tmpl")
+	writeFile(t, textPath, "image: [[ .image ]]\nargs: {{ .Values.args }}\nbad: [[ .image.tag ]]")
+	htmlPath := filepath.Join(dir, "page.html")
+	writeFile(t, htmlPath, `<p><% .image %></p><script>{{ x }}</script>`)
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, contextPath, `{"image":"nginx"}`)
+
+	resp := run(htmlPath, contextPath, renderOptions{LeftDelim: "<%", RightDelim: "%>"})
+	if resp.Error != "" || resp.Rendered != "<p>nginx</p><script>{{ x }}</script>" {
+		t.Fatalf("unexpected html response: %+v", resp)
+	}
+
+	resp = run(textPath, contextPath, renderOptions{LeftDelim: "[[", RightDelim: "]]"})
+	if len(resp.Diagnostics) != 1 {
+		t.Fatalf("expected one diagnostic, got %+v", resp)
+	}
+	if diag := resp.Diagnostics[0]; diag.Line != 3 || diag.Column != 15 || diag.EndColumn != 22 {
+		t.Fatalf("unexpected diagnostic range: %+v", diag)
+	}
+
+	requests := `{"id":1,"template":` + quoteJSON(textPath) + `,"context":` + quoteJSON(contextPath) + `,"leftDelim":"[[","rightDelim":"]]"}` + "\n"
+	var output bytes.Buffer
+	if err := serve(strings.NewReader(requests), &output, renderOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(output.String(), `can't evaluate field tag`) {
+		t.Fatalf("expected server request to use its delimiters, got %s", output.String())
+	}
+
+	resp = run(textPath, contextPath, renderOptions{Mode: "check", LeftDelim: "[["})
+	if !strings.Contains(resp.Error, "not supported in check mode") {
+		t.Fatalf("expected unsupported mode error, got %+v", resp)
+	}
+}
@@ -0,0 +1,413 @@
+package main
+
+import (
+	"sort"
+	"text/template/parse"
+)
+
+// contextAnalysis describes the context a template expects, inferred from
+// the fields it dereferences.
+type contextAnalysis struct {
+	Schema *schemaNode `json:"schema"`
+	// Skeleton is a context document with a placeholder for every field.
+	Skeleton interface{}  `json:"skeleton"`
+	Fields   []fieldUsage `json:"fields,omitempty"`
+	Scopes   []scopeUsage `json:"scopes,omitempty"`
+}
+
+// schemaNode is a JSON Schema-like description of one context value. Type
+// is empty when the template uses a value without revealing its shape.
+type schemaNode struct {
+	Type       string                 `json:"type,omitempty"`
+	Properties map[string]*schemaNode `json:"properties,omitempty"`
+	Items      *schemaNode            `json:"items,omitempty"`
+
+	path     string
+	detached bool
+}
+
+// fieldUsage is one context path and everywhere the template reads it.
+// Elements of a ranged-over list are written path[].
+type fieldUsage struct {
+	Path        string           `json:"path"`
+	Occurrences []sourceLocation `json:"occurrences"`
+}
+
+// scopeUsage is a range or with block and the context path it moves dot to.
+type scopeUsage struct {
+	Kind   string `json:"kind"`
+	Path   string `json:"path"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+}
+
+// comparisonFuncs hint that their operands share the type of any literal
+// they are compared with.
+var comparisonFuncs = map[string]bool{"eq": true, "ne": true, "lt": true, "le": true, "gt": true, "ge": true}
+
+// executeAnalyze reports every context path the template reads, the range
+// and with scopes it opens, and a skeleton context to start from.
+func executeAnalyze(templatePath string, opts renderOptions) response {
+	if templatePath == "" {
+		return response{Error: "template path is required"}
+	}
+
+	content, err := readTemplate(templatePath, opts)
+	if err != nil {
+		return response{Error: err.Error()}
+	}
+
+	name := templateName(templatePath)
+	trees, err := parseTrees(name, content)
+	if err != nil {
+		return response{
+			Diagnostics: []diagnostic{templateDiagnostic(err, templatePath, content)},
+			Error:       err.Error(),
+		}
+	}
+
+	return response{Analysis: analyzeTrees(templatePath, name, content, trees)}
+}
+
+// analyzeTrees infers the context the template name in trees expects.
+func analyzeTrees(templatePath, name, content string, trees map[string]*parse.Tree) *contextAnalysis {
+	analyzer := &contextAnalyzer{
+		templatePath: templatePath,
+		content:      content,
+		trees:        trees,
+		root:         &schemaNode{},
+		usages:       map[string][]sourceLocation{},
+		visited:      map[string]bool{},
+	}
+	analyzer.template(name, analyzer.root)
+	return analyzer.result()
+}
+
+type analysisEnv struct {
+	dot  *schemaNode
+	vars map[string]*schemaNode
+}
+
+func (env analysisEnv) nested(dot *schemaNode) analysisEnv {
+	vars := make(map[string]*schemaNode, len(env.vars))
+	for name, node := range env.vars {
+		vars[name] = node
+	}
+	return analysisEnv{dot: dot, vars: vars}
+}
+
+type contextAnalyzer struct {
+	templatePath string
+	content      string
+	trees        map[string]*parse.Tree
+	root         *schemaNode
+	usages       map[string][]sourceLocation
+	scopes       []scopeUsage
+	// visited guards recursive template calls, keyed by template and the
+	// path of the dot it was called with.
+	visited map[string]bool
+}
+
+func (a *contextAnalyzer) template(name string, dot *schemaNode) {
+	tree, ok := a.trees[name]
+	key := name + "\x00" + dot.path
+	if !ok || dot.detached || a.visited[key] {
+		return
+	}
+	a.visited[key] = true
+	a.list(tree.Root, analysisEnv{dot: dot, vars: map[string]*schemaNode{"$": dot}})
+}
+
+func (a *contextAnalyzer) list(list *parse.ListNode, env analysisEnv) {
+	if list == nil {
+		return
+	}
+	for _, node := range list.Nodes {
+		switch typed := node.(type) {
+		case *parse.ActionNode:
+			value := a.pipe(typed.Pipe, env)
+			if len(typed.Pipe.Decl) == 0 && value != nil {
+				value.hint("string")
+			}
+		case *parse.IfNode:
+			// Variables a control structure's pipeline declares are scoped
+			// to its body.
+			body := env.nested(env.dot)
+			if value := a.pipe(typed.Pipe, body); value != nil {
+				value.hint("boolean")
+			}
+			a.list(typed.List, body)
+			a.list(typed.ElseList, env.nested(env.dot))
+		case *parse.WithNode:
+			body := env.nested(env.dot)
+			value := a.pipe(typed.Pipe, body)
+			if value == nil {
+				value = &schemaNode{detached: true}
+			}
+			a.scope("with", value, typed.Position())
+			body.dot = value
+			a.list(typed.List, body)
+			a.list(typed.ElseList, env.nested(env.dot))
+		case *parse.RangeNode:
+			a.rangeNode(typed, env)
+		case *parse.TemplateNode:
+			dot := &schemaNode{detached: true}
+			if typed.Pipe != nil {
+				if value := a.pipe(typed.Pipe, env); value != nil {
+					dot = value
+				}
+			}
+			a.template(typed.Name, dot)
+		}
+	}
+}
+
+func (a *contextAnalyzer) rangeNode(node *parse.RangeNode, env analysisEnv) {
+	body := env.nested(env.dot)
+	collection := a.pipe(node.Pipe, body)
+	item := &schemaNode{detached: true}
+	if collection != nil {
+		item = collection.items()
+		a.scope("range", collection, node.Position())
+	}
+	body.dot = item
+
+	// The pipeline's variables were bound to the collection by pipe; in a
+	// range they are the index (or key) and the element instead.
+	switch len(node.Pipe.Decl) {
+	case 1:
+		body.vars[node.Pipe.Decl[0].Ident[0]] = item
+	case 2:
+		delete(body.vars, node.Pipe.Decl[0].Ident[0])
+		body.vars[node.Pipe.Decl[1].Ident[0]] = item
+	}
+	a.list(node.List, body)
+	a.list(node.ElseList, env.nested(env.dot))
+}
+
+func (a *contextAnalyzer) scope(kind string, node *schemaNode, pos parse.Pos) {
+	if node.detached {
+		return
+	}
+	line, column := lineColumn(a.content, pos)
+	a.scopes = append(a.scopes, scopeUsage{Kind: kind, Path: node.displayPath(), Line: line, Column: column})
+}
+
+// pipe evaluates the pipeline symbolically and binds any variables it
+// declares. It returns the schema node the pipeline yields, if known.
+func (a *contextAnalyzer) pipe(pipe *parse.PipeNode, env analysisEnv) *schemaNode {
+	if pipe == nil {
+		return nil
+	}
+
+	var value *schemaNode
+	for i, cmd := range pipe.Cmds {
+		var piped *schemaNode
+		if i > 0 {
+			piped = value
+		}
+		value = a.command(cmd, piped, env)
+	}
+	for _, decl := range pipe.Decl {
+		if value != nil {
+			env.vars[decl.Ident[0]] = value
+		} else {
+			delete(env.vars, decl.Ident[0])
+		}
+	}
+	return value
+}
+
+func (a *contextAnalyzer) command(cmd *parse.CommandNode, piped *schemaNode, env analysisEnv) *schemaNode {
+	if len(cmd.Args) == 0 {
+		return nil
+	}
+
+	ident, ok := cmd.Args[0].(*parse.IdentifierNode)
+	if !ok {
+		value := a.arg(cmd.Args[0], env)
+		for _, arg := range cmd.Args[1:] {
+			a.arg(arg, env)
+		}
+		return value
+	}
+
+	args := make([]*schemaNode, 0, len(cmd.Args))
+	for _, arg := range cmd.Args[1:] {
+		args = append(args, a.arg(arg, env))
+	}
+	if piped != nil {
+		args = append(args, piped)
+	}
+
+	switch {
+	case comparisonFuncs[ident.Ident]:
+		if literal := literalType(cmd.Args[1:]); literal != "" {
+			for _, arg := range args {
+				if arg != nil {
+					arg.hint(literal)
+				}
+			}
+		}
+		return nil
+	case ident.Ident == "index" && len(cmd.Args) > 2 && args[0] != nil:
+		value := args[0]
+		for _, key := range cmd.Args[2:] {
+			switch typed := key.(type) {
+			case *parse.StringNode:
+				value = value.child(typed.Text)
+			case *parse.NumberNode:
+				value = value.items()
+			default:
+				return nil
+			}
+		}
+		a.use(value, ident.Position())
+		return value
+	default:
+		return nil
+	}
+}
+
+func (a *contextAnalyzer) arg(node parse.Node, env analysisEnv) *schemaNode {
+	switch typed := node.(type) {
+	case *parse.DotNode:
+		return env.dot
+	case *parse.FieldNode:
+		return a.walk(env.dot, typed.Ident, typed.Position())
+	case *parse.VariableNode:
+		base, ok := env.vars[typed.Ident[0]]
+		if !ok {
+			return nil
+		}
+		return a.walk(base, typed.Ident[1:], typed.Position())
+	case *parse.ChainNode:
+		var base *schemaNode
+		if pipe, ok := typed.Node.(*parse.PipeNode); ok {
+			base = a.pipe(pipe, env)
+		} else {
+			base = a.arg(typed.Node, env)
+		}
+		return a.walk(base, typed.Field, typed.Position())
+	case *parse.PipeNode:
+		return a.pipe(typed, env.nested(env.dot))
+	default:
+		return nil
+	}
+}
+
+func (a *contextAnalyzer) walk(node *schemaNode, fields []string, pos parse.Pos) *schemaNode {
+	if node == nil {
+		return nil
+	}
+	for _, field := range fields {
+		node = node.child(field)
+	}
+	if len(fields) > 0 {
+		a.use(node, pos)
+	}
+	return node
+}
+
+func (a *contextAnalyzer) use(node *schemaNode, pos parse.Pos) {
+	if node.detached {
+		return
+	}
+	line, column := lineColumn(a.content, pos)
+	a.usages[node.path] = append(a.usages[node.path], sourceLocation{File: a.templatePath, Line: line, Column: column})
+}
+
+func (a *contextAnalyzer) result() *contextAnalysis {
+	analysis := &contextAnalysis{Schema: a.root, Skeleton: a.root.skeleton(), Scopes: a.scopes}
+	for path, occurrences := range a.usages {
+		analysis.Fields = append(analysis.Fields, fieldUsage{Path: path, Occurrences: occurrences})
+	}
+	sort.Slice(analysis.Fields, func(i, j int) bool { return analysis.Fields[i].Path < analysis.Fields[j].Path })
+	return analysis
+}
+
+// literalType reports the JSON type of the first literal among args.
+func literalType(args []parse.Node) string {
+	for _, arg := range args {
+		switch arg.(type) {
+		case *parse.NumberNode:
+			return "number"
+		case *parse.StringNode:
+			return "string"
+		case *parse.BoolNode:
+			return "boolean"
+		}
+	}
+	return ""
+}
+
+// child returns the named property, turning the node into an object.
+func (n *schemaNode) child(name string) *schemaNode {
+	if n.Type != "object" {
+		n.Type = "object"
+		n.Items = nil
+	}
+	if n.Properties == nil {
+		n.Properties = map[string]*schemaNode{}
+	}
+	child, ok := n.Properties[name]
+	if !ok {
+		child = &schemaNode{path: n.path + "." + name, detached: n.detached}
+		n.Properties[name] = child
+	}
+	return child
+}
+
+// items returns the element schema, turning the node into an array.
+func (n *schemaNode) items() *schemaNode {
+	if n.Type != "array" {
+		n.Type = "array"
+		n.Properties = nil
+	}
+	if n.Items == nil {
+		n.Items = &schemaNode{path: n.path + "[]", detached: n.detached}
+	}
+	return n.Items
+}
+
+// scalarRank orders scalar hints by how much they say about a value: being
+// tested in an if says less than being printed, which says less than being
+// compared with a number.
+var scalarRank = map[string]int{"": 0, "boolean": 1, "string": 2, "number": 3}
+
+// hint records a scalar type for the node unless nesting or a stronger hint
+// already determined it.
+func (n *schemaNode) hint(kind string) {
+	if rank, ok := scalarRank[n.Type]; ok && scalarRank[kind] > rank {
+		n.Type = kind
+	}
+}
+
+func (n *schemaNode) displayPath() string {
+	if n.path == "" {
+		return "."
+	}
+	return n.path
+}
+
+func (n *schemaNode) skeleton() interface{} {
+	switch n.Type {
+	case "object":
+		object := make(map[string]interface{}, len(n.Properties))
+		for name, child := range n.Properties {
+			object[name] = child.skeleton()
+		}
+		return object
+	case "array":
+		if n.Items == nil {
+			return []interface{}{}
+		}
+		return []interface{}{n.Items.skeleton()}
+	case "number":
+		return 0
+	case "boolean":
+		return false
+	default:
+		return ""
+	}
+}
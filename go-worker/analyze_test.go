@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+)
+
+func TestExecuteAnalyzeInfersContextShape(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "orders.tmpl")
+	writeFile(t, templatePath, `Hello {{ .user.name }}
+{{ range $o := .orders }}{{ if gt $o.total 100 }}{{ template "row" $o }}{{ end }}{{ end }}
+{{ with $.settings }}{{ .theme }}{{ end }}{{ if .beta }}beta{{ end }}{{ index .labels "en" }}
+{{ define "row" }}{{ .id }}{{ range .items }}{{ .sku }}{{ end }}{{ end }}`)
+
+	resp := run(templatePath, "", renderOptions{Mode: "analyze"})
+	if resp.Error != "" || resp.Analysis == nil {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	skeleton, err := json.Marshal(resp.Analysis.Skeleton)
+	if err != nil {
+		t.Fatalf("failed to marshal skeleton: %v", err)
+	}
+	want := `{"beta":false,"labels":{"en":""},"orders":[{"id":"","items":[{"sku":""}],"total":0}],"settings":{"theme":""},"user":{"name":""}}`
+	if string(skeleton) != want {
+		t.Fatalf("unexpected skeleton:\n got %s\nwant %s", skeleton, want)
+	}
+
+	if orders := resp.Analysis.Schema.Properties["orders"]; orders.Type != "array" || orders.Items.Properties["total"].Type != "number" {
+		t.Fatalf("unexpected orders schema: %+v", orders)
+	}
+
+	var paths []string
+	for _, field := range resp.Analysis.Fields {
+		paths = append(paths, field.Path)
+	}
+	wantPaths := []string{".beta", ".labels", ".labels.en", ".orders", ".orders[].id", ".orders[].items", ".orders[].items[].sku", ".orders[].total", ".settings", ".settings.theme", ".user.name"}
+	if len(paths) != len(wantPaths) {
+		t.Fatalf("unexpected fields: %v", paths)
+	}
+	for i := range paths {
+		if paths[i] != wantPaths[i] {
+			t.Fatalf("unexpected fields: %v", paths)
+		}
+	}
+	if name := resp.Analysis.Fields[10].Occurrences[0]; name.Line != 1 || name.Column != 15 {
+		t.Fatalf("unexpected .user.name occurrence: %+v", name)
+	}
+
+	scopes := resp.Analysis.Scopes
+	if len(scopes) != 3 || scopes[0].Kind != "range" || scopes[0].Path != ".orders" || scopes[1].Path != ".orders[].items" || scopes[2].Kind != "with" {
+		t.Fatalf("unexpected scopes: %+v", scopes)
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"regexp"
+	"strings"
+)
+
+type piiKind int
+
+const (
+	piiNone piiKind = iota
+	piiEmail
+	piiName
+	piiPhone
+	piiToken
+)
+
+var (
+	emailPattern = regexp.MustCompile(`^[^\s@]+@[^\s@]+\.[^\s@]+$`)
+	// phonePattern wants an optional country code and area code followed
+	// by groups of digits, so only datePattern and IP addresses still need
+	// ruling out.
+	phonePattern = regexp.MustCompile(`^(\+\d{1,3}[\s.-]?)?(\(\d{1,4}\)[\s.-]?)?\d{2,4}([\s.-]?\d{2,4}){1,4}$`)
+	datePattern  = regexp.MustCompile(`^(\d{4}[-/.]\d{1,2}[-/.]\d{1,2}|\d{1,2}[-/.]\d{1,2}[-/.]\d{4})$`)
+	// tokenPattern leaves out "/", and fileExtPattern file names, so paths
+	// and files such as "quarterly_report_2024_final.pdf" stay readable.
+	tokenPattern   = regexp.MustCompile(`^[A-Za-z0-9_\-.=+]{20,}$`)
+	fileExtPattern = regexp.MustCompile(`\.[A-Za-z][A-Za-z0-9]{0,4}$`)
+)
+
+// nameKeys are the keys, lowercased without "_" or "-", whose values are
+// personal names. Other keys ending in "name", such as productName, are
+// not.
+var nameKeys = map[string]bool{
+	"name": true, "firstname": true, "lastname": true, "fullname": true, "middlename": true,
+	"givenname": true, "familyname": true, "surname": true,
+}
+
+var (
+	anonymizedFirstNames = []string{"Alex", "Blair", "Casey", "Devon", "Emery", "Finley", "Harper", "Jordan", "Kai", "Logan", "Morgan", "Quinn", "Riley", "Sage", "Taylor", "Rowan"}
+	anonymizedLastNames  = []string{"Ashford", "Brook", "Carver", "Dale", "Ellis", "Fields", "Grant", "Hayes", "Irving", "Jensen", "Keller", "Lane", "Mercer", "North", "Parker", "Reed"}
+)
+
+// anonymizeContext returns a copy of data where values that look like
+// personal information are replaced with deterministic pseudonyms. The same
+// input value always maps to the same pseudonym so joins and equality checks
+// inside templates keep working.
+func anonymizeContext(data interface{}) interface{} {
+	return anonymizeValue("", data)
+}
+
+func anonymizeValue(key string, value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(typed))
+		for childKey, child := range typed {
+			result[childKey] = anonymizeValue(childKey, child)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(typed))
+		for i, child := range typed {
+			result[i] = anonymizeValue(key, child)
+		}
+		return result
+	case string:
+		return pseudonymize(classifyPII(key, typed), typed)
+	default:
+		return value
+	}
+}
+
+func classifyPII(key, value string) piiKind {
+	trimmed := strings.TrimSpace(value)
+	if trimmed == "" {
+		return piiNone
+	}
+
+	if emailPattern.MatchString(trimmed) {
+		return piiEmail
+	}
+
+	normalizedKey := strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(key))
+	switch {
+	case strings.Contains(normalizedKey, "email"):
+		return piiEmail
+	case strings.Contains(normalizedKey, "phone"), strings.Contains(normalizedKey, "mobile"), normalizedKey == "tel":
+		return piiPhone
+	case strings.Contains(normalizedKey, "token"), strings.Contains(normalizedKey, "secret"),
+		strings.Contains(normalizedKey, "password"), strings.Contains(normalizedKey, "apikey"):
+		return piiToken
+	case nameKeys[normalizedKey]:
+		return piiName
+	}
+
+	if phonePattern.MatchString(trimmed) && countDigits(trimmed) >= 7 && !datePattern.MatchString(trimmed) && net.ParseIP(trimmed) == nil {
+		return piiPhone
+	}
+
+	if tokenPattern.MatchString(trimmed) && hasLettersAndDigits(trimmed) && !fileExtPattern.MatchString(trimmed) {
+		return piiToken
+	}
+
+	return piiNone
+}
+
+func pseudonymize(kind piiKind, value string) string {
+	if kind == piiNone {
+		return value
+	}
+
+	sum := sha256.Sum256([]byte(value))
+	switch kind {
+	case piiEmail:
+		return "user-" + hex.EncodeToString(sum[:4]) + "@example.com"
+	case piiName:
+		first := anonymizedFirstNames[binary.BigEndian.Uint16(sum[0:2])%uint16(len(anonymizedFirstNames))]
+		last := anonymizedLastNames[binary.BigEndian.Uint16(sum[2:4])%uint16(len(anonymizedLastNames))]
+		return first + " " + last
+	case piiPhone:
+		return pseudonymizeDigits(value, sum[:])
+	case piiToken:
+		digest := hex.EncodeToString(sum[:])
+		length := len(value)
+		if length < 8 {
+			length = 8
+		}
+		if length > len(digest) {
+			length = len(digest)
+		}
+		return "anon_" + digest[:length]
+	}
+
+	return value
+}
+
+// pseudonymizeDigits swaps every digit for a hash-derived digit while keeping
+// separators intact so formatting-sensitive templates still look realistic.
+func pseudonymizeDigits(value string, digest []byte) string {
+	var builder strings.Builder
+	builder.Grow(len(value))
+
+	index := 0
+	for _, r := range value {
+		if r >= '0' && r <= '9' {
+			builder.WriteByte('0' + digest[index%len(digest)]%10)
+			index++
+			continue
+		}
+		builder.WriteRune(r)
+	}
+
+	return builder.String()
+}
+
+func countDigits(value string) int {
+	count := 0
+	for _, r := range value {
+		if r >= '0' && r <= '9' {
+			count++
+		}
+	}
+	return count
+}
+
+func hasLettersAndDigits(value string) bool {
+	var letters, digits bool
+	for _, r := range value {
+		switch {
+		case r >= '0' && r <= '9':
+			digits = true
+		case (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z'):
+			letters = true
+		}
+	}
+	return letters && digits
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAnonymizeContextReplacesPII(t *testing.T) {
+	input := map[string]interface{}{
+		"email": "jane.doe@corp.example",
+		"user": map[string]interface{}{
+			"firstName": "Jane",
+			"phone":     "+1 (415) 555-0134",
+		},
+		"apiToken": "sk_live_9f8a7b6c5d4e3f2a1b0c",
+		"tags":     []interface{}{"alpha", "contact@corp.example"},
+		"count":    float64(3),
+		"filename": "report.csv",
+	}
+
+	result := anonymizeContext(input).(map[string]interface{})
+
+	email := result["email"].(string)
+	if !strings.HasPrefix(email, "user-") || !strings.HasSuffix(email, "@example.com") {
+		t.Fatalf("expected pseudonymized email, got %q", email)
+	}
+
+	user := result["user"].(map[string]interface{})
+	if user["firstName"] == "Jane" {
+		t.Fatal("expected name to be pseudonymized")
+	}
+
+	phone := user["phone"].(string)
+	if phone == "+1 (415) 555-0134" || len(phone) != len("+1 (415) 555-0134") || !strings.HasPrefix(phone, "+") {
+		t.Fatalf("expected phone digits to change while keeping format, got %q", phone)
+	}
+
+	if token := result["apiToken"].(string); !strings.HasPrefix(token, "anon_") {
+		t.Fatalf("expected token to be pseudonymized, got %q", token)
+	}
+
+	tags := result["tags"].([]interface{})
+	if tags[0] != "alpha" {
+		t.Fatalf("expected non-PII list value to be preserved, got %v", tags[0])
+	}
+	if tags[1] == "contact@corp.example" {
+		t.Fatal("expected email inside list to be pseudonymized")
+	}
+
+	if result["count"] != float64(3) || result["filename"] != "report.csv" {
+		t.Fatalf("expected non-PII values to be preserved: %v", result)
+	}
+
+	if input["email"] != "jane.doe@corp.example" {
+		t.Fatal("expected anonymization to leave the original context untouched")
+	}
+}
+
+func TestAnonymizeContextKeepsLookalikes(t *testing.T) {
+	input := map[string]interface{}{
+		"productName": "Widget",
+		"hostname":    "db-01",
+		"last_name":   "Doe",
+		"fullName":    "Jane Doe",
+		"date":        "2024-01-15",
+		"due":         "15/01/2024",
+		"ip":          "192.168.100.200",
+		"mobile":      "07700 900123",
+		"fax":         "415.555.0134",
+		"path":        "assets/images/hero_banner_large_v2",
+		"file":        "quarterly_report_2024_final.pdf",
+		"session":     "9f8a7b6c5d4e3f2a1b0c9d8e",
+	}
+
+	result := anonymizeContext(input).(map[string]interface{})
+	for _, key := range []string{"productName", "hostname", "date", "due", "ip", "path", "file"} {
+		if result[key] != input[key] {
+			t.Errorf("expected %s to be kept, got %q", key, result[key])
+		}
+	}
+	for _, key := range []string{"last_name", "fullName", "mobile", "fax", "session"} {
+		if result[key] == input[key] {
+			t.Errorf("expected %s to be pseudonymized", key)
+		}
+	}
+}
+
+func TestAnonymizeContextIsDeterministic(t *testing.T) {
+	first := anonymizeContext(map[string]interface{}{"email": "a@b.co", "name": "Jane"}).(map[string]interface{})
+	second := anonymizeContext(map[string]interface{}{"email": "a@b.co", "name": "Jane"}).(map[string]interface{})
+
+	if first["email"] != second["email"] || first["name"] != second["name"] {
+		t.Fatalf("expected deterministic pseudonyms, got %v and %v", first, second)
+	}
+}
+
+func TestExecuteWithAnonymizeOption(t *testing.T) {
+	dir := t.TempDir()
+
+	templatePath := filepath.Join(dir, "contact.tmpl")
+	if err := os.WriteFile(templatePath, []byte("{{.email}}"), 0o600); err != nil {
+		t.Fatalf("failed to write template file: %v", err)
+	}
+
+	contextPath := filepath.Join(dir, "context.json")
+	if err := os.WriteFile(contextPath, []byte(`{"email":"jane@corp.example"}`), 0o600); err != nil {
+		t.Fatalf("failed to write context file: %v", err)
+	}
+
+	resp := executeWithOptions(templatePath, contextPath, renderOptions{Anonymize: true})
+	if resp.Error != "" {
+		t.Fatalf("unexpected error: %s", resp.Error)
+	}
+
+	if strings.Contains(resp.Rendered, "jane@corp.example") {
+		t.Fatalf("expected rendered output to omit original email, got %q", resp.Rendered)
+	}
+}
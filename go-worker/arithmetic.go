@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// number is a template operand coerced for arithmetic. Whole values are
+// kept as int64 so JSON numbers, which decode as float64, print as 42
+// rather than 4.2e+01 once the arithmetic is done.
+type number struct {
+	isInt bool
+	i     int64
+	f     float64
+}
+
+func (n number) float() float64 {
+	if n.isInt {
+		return float64(n.i)
+	}
+	return n.f
+}
+
+func (n number) value() interface{} {
+	if n.isInt {
+		return n.i
+	}
+	return n.f
+}
+
+// floatNumber wraps f, narrowing it to an integer when it is whole and
+// fits in an int64.
+func floatNumber(f float64) number {
+	if f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64 {
+		return number{isInt: true, i: int64(f)}
+	}
+	return number{f: f}
+}
+
+// toNumber coerces a Go integer, float, or json.Number. Strings, booleans,
+// and nil are rejected rather than guessed at.
+func toNumber(name string, value interface{}) (number, error) {
+	if n, ok := value.(json.Number); ok {
+		if i, err := n.Int64(); err == nil {
+			return number{isInt: true, i: i}, nil
+		}
+		if f, err := n.Float64(); err == nil {
+			return floatNumber(f), nil
+		}
+		return number{}, fmt.Errorf("%s: %q is not a number", name, n.String())
+	}
+	if value == nil {
+		return number{}, fmt.Errorf("%s: expected a number, got nil", name)
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return number{isInt: true, i: v.Int()}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Uint() > math.MaxInt64 {
+			return number{f: float64(v.Uint())}, nil
+		}
+		return number{isInt: true, i: int64(v.Uint())}, nil
+	case reflect.Float32, reflect.Float64:
+		return floatNumber(v.Float()), nil
+	}
+	return number{}, fmt.Errorf("%s: expected a number, got %T (%v)", name, value, value)
+}
+
+func toNumbers(name string, values []interface{}) ([]number, error) {
+	numbers := make([]number, len(values))
+	for i, value := range values {
+		n, err := toNumber(name, value)
+		if err != nil {
+			return nil, err
+		}
+		numbers[i] = n
+	}
+	return numbers, nil
+}
+
+// foldNumbers combines operands left to right, in int64 while every
+// operand is whole and the result does not overflow, and in float64
+// otherwise.
+func foldNumbers(name string, first interface{}, rest []interface{}, ints func(a, b int64) (int64, bool), floats func(a, b float64) float64) (interface{}, error) {
+	numbers, err := toNumbers(name, append([]interface{}{first}, rest...))
+	if err != nil {
+		return nil, err
+	}
+	total := numbers[0]
+	for _, n := range numbers[1:] {
+		if total.isInt && n.isInt {
+			if result, ok := ints(total.i, n.i); ok {
+				total = number{isInt: true, i: result}
+				continue
+			}
+		}
+		total = floatNumber(floats(total.float(), n.float()))
+	}
+	return total.value(), nil
+}
+
+func templateAdd(first interface{}, rest ...interface{}) (interface{}, error) {
+	return foldNumbers("add", first, rest, func(a, b int64) (int64, bool) {
+		sum := a + b
+		return sum, (sum > a) == (b > 0)
+	}, func(a, b float64) float64 { return a + b })
+}
+
+func templateSub(a, b interface{}) (interface{}, error) {
+	return foldNumbers("sub", a, []interface{}{b}, func(a, b int64) (int64, bool) {
+		diff := a - b
+		return diff, (diff < a) == (b > 0)
+	}, func(a, b float64) float64 { return a - b })
+}
+
+func templateMul(first interface{}, rest ...interface{}) (interface{}, error) {
+	return foldNumbers("mul", first, rest, func(a, b int64) (int64, bool) {
+		if a == 0 || b == 0 {
+			return 0, true
+		}
+		product := a * b
+		return product, product/b == a && !(a == -1 && b == math.MinInt64) && !(b == -1 && a == math.MinInt64)
+	}, func(a, b float64) float64 { return a * b })
+}
+
+// templateDiv divides exactly: div 7 2 is 3.5, not 3 as in Go or Sprig.
+// Pipe the result through floor for integer division.
+func templateDiv(a, b interface{}) (interface{}, error) {
+	numbers, err := toNumbers("div", []interface{}{a, b})
+	if err != nil {
+		return nil, err
+	}
+	if numbers[1].float() == 0 {
+		return nil, fmt.Errorf("div: division by zero")
+	}
+	if numbers[0].isInt && numbers[1].isInt && numbers[0].i%numbers[1].i == 0 && !(numbers[0].i == math.MinInt64 && numbers[1].i == -1) {
+		return numbers[0].i / numbers[1].i, nil
+	}
+	return floatNumber(numbers[0].float() / numbers[1].float()).value(), nil
+}
+
+// templateMod returns the remainder of a / b with the sign of a, as Go's %
+// does.
+func templateMod(a, b interface{}) (interface{}, error) {
+	numbers, err := toNumbers("mod", []interface{}{a, b})
+	if err != nil {
+		return nil, err
+	}
+	if numbers[1].float() == 0 {
+		return nil, fmt.Errorf("mod: division by zero")
+	}
+	if numbers[0].isInt && numbers[1].isInt {
+		if numbers[1].i == -1 {
+			return int64(0), nil
+		}
+		return numbers[0].i % numbers[1].i, nil
+	}
+	return floatNumber(math.Mod(numbers[0].float(), numbers[1].float())).value(), nil
+}
+
+func templateMax(first interface{}, rest ...interface{}) (interface{}, error) {
+	return foldNumbers("max", first, rest, func(a, b int64) (int64, bool) {
+		if b > a {
+			return b, true
+		}
+		return a, true
+	}, math.Max)
+}
+
+func templateMin(first interface{}, rest ...interface{}) (interface{}, error) {
+	return foldNumbers("min", first, rest, func(a, b int64) (int64, bool) {
+		if b < a {
+			return b, true
+		}
+		return a, true
+	}, math.Min)
+}
+
+func templateFloor(value interface{}) (interface{}, error) {
+	n, err := toNumber("floor", value)
+	if err != nil {
+		return nil, err
+	}
+	return floatNumber(math.Floor(n.float())).value(), nil
+}
+
+func templateCeil(value interface{}) (interface{}, error) {
+	n, err := toNumber("ceil", value)
+	if err != nil {
+		return nil, err
+	}
+	return floatNumber(math.Ceil(n.float())).value(), nil
+}
+
+// templateRound rounds half away from zero, to a whole number or to the
+// given number of decimal places.
+func templateRound(value interface{}, places ...interface{}) (interface{}, error) {
+	n, err := toNumber("round", value)
+	if err != nil {
+		return nil, err
+	}
+	if len(places) > 1 {
+		return nil, fmt.Errorf("round: expected at most one precision, got %d", len(places))
+	}
+	if n.isInt {
+		return n.i, nil
+	}
+	if len(places) == 0 {
+		return floatNumber(math.Round(n.f)).value(), nil
+	}
+	precision, err := toNumber("round", places[0])
+	if err != nil {
+		return nil, err
+	}
+	if !precision.isInt || precision.i < 0 || precision.i > 15 {
+		return nil, fmt.Errorf("round: precision must be a whole number from 0 to 15, got %v", places[0])
+	}
+	scale := math.Pow(10, float64(precision.i))
+	return floatNumber(math.Round(n.f*scale) / scale).value(), nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestArithmeticHelpersCoerceContextNumbers(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "page.tmpl")
+	writeFile(t, templatePath, `{{ add .count 1 }} {{ sub .count 0.5 }} {{ mul .price 3 }} {{ div 7 2 }} {{ div .count 1000 }} `+
+		`{{ mod 7 -3 }} {{ mod 7.5 2 }} {{ max 3 .price 1 }} {{ min .count 2 }} {{ floor -1.5 }} {{ ceil 1.2 }} {{ round 2.5 }} {{ round 3.14159 2 }} {{ add 9223372036854775807 1 }}`)
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, contextPath, `{"count": 1000000, "price": 4.25}`)
+
+	resp := run(templatePath, contextPath, renderOptions{})
+	want := "1000001 999999.5 12.75 3.5 1000 1 1.5 4.25 2 -2 2 3 3.14 9.223372036854776e+18"
+	if resp.Error != "" || resp.Rendered != want {
+		t.Fatalf("unexpected render %q (error %q)", resp.Rendered, resp.Error)
+	}
+}
+
+func TestArithmeticHelpersRejectNonNumbers(t *testing.T) {
+	templatePath := filepath.Join(t.TempDir(), "bad.tmpl")
+	for source, want := range map[string]string{
+		`{{ add "3" 1 }}`:      "add: expected a number, got string (3)",
+		`{{ div 1 0 }}`:        "div: division by zero",
+		`{{ mod 1 0.0 }}`:      "mod: division by zero",
+		`{{ round 1.5 1.5 }}`:  "round: precision must be a whole number from 0 to 15",
+		`{{ mul .missing 2 }}`: "mul: expected a number, got nil",
+	} {
+		writeFile(t, templatePath, source)
+		if resp := run(templatePath, "", renderOptions{}); !strings.Contains(resp.Error, want) {
+			t.Errorf("%s: expected an error containing %q, got %+v", source, want, resp)
+		}
+	}
+
+	if sum, err := templateAdd(json.Number("2"), json.Number("0.5")); err != nil || sum != 2.5 {
+		t.Fatalf("expected json.Number operands to add, got %v (%v)", sum, err)
+	}
+}
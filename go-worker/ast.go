@@ -0,0 +1,221 @@
+package main
+
+import (
+	"sort"
+	"text/template/parse"
+)
+
+// astTemplate is one named template of the parse tree.
+type astTemplate struct {
+	Name  string    `json:"name"`
+	Nodes []astNode `json:"nodes"`
+}
+
+// astNode mirrors a text/template/parse node. Control structures (if,
+// range, with) also carry the position just past their {{ end }}, which the
+// parser does not record, so editors can fold them.
+type astNode struct {
+	Kind      string `json:"kind"`
+	Offset    int    `json:"offset"`
+	Line      int    `json:"line"`
+	Column    int    `json:"column"`
+	EndLine   int    `json:"endLine,omitempty"`
+	EndColumn int    `json:"endColumn,omitempty"`
+	// Value is the source of leaves: text, fields, variables, identifiers,
+	// and literals.
+	Value string `json:"value,omitempty"`
+	// Name is the template a template node invokes.
+	Name     string   `json:"name,omitempty"`
+	Fields   []string `json:"fields,omitempty"`
+	Decl     []string `json:"decl,omitempty"`
+	IsAssign bool     `json:"isAssign,omitempty"`
+	Pipe     *astNode `json:"pipe,omitempty"`
+	// Args holds a pipeline's commands, a command's arguments, or a
+	// chain's base node.
+	Args []astNode `json:"args,omitempty"`
+	Body []astNode `json:"body,omitempty"`
+	Else []astNode `json:"else,omitempty"`
+}
+
+// executeAST parses the template and returns its parse tree.
+func executeAST(templatePath string, opts renderOptions) response {
+	if templatePath == "" {
+		return response{Error: "template path is required"}
+	}
+
+	content, err := readTemplate(templatePath, opts)
+	if err != nil {
+		return response{Error: err.Error()}
+	}
+
+	name := templateName(templatePath)
+	trees, err := parseTrees(name, content)
+	if err != nil {
+		return response{
+			Diagnostics: []diagnostic{templateDiagnostic(err, templatePath, content)},
+			Error:       err.Error(),
+		}
+	}
+
+	actions := scanActions(content, "", "")
+	converter := astConverter{content: content, actions: actions, blockEnds: blockEnds(actions)}
+	var templates []astTemplate
+	for _, treeName := range sortedTreeNames(trees, name) {
+		templates = append(templates, astTemplate{Name: treeName, Nodes: converter.list(trees[treeName].Root)})
+	}
+	return response{AST: templates}
+}
+
+// blockEnds maps the start of every action that opens or continues a block
+// (if, range, with, define, block, else) to the end of the {{ end }} that
+// closes it.
+func blockEnds(actions []actionSpan) map[int]int {
+	ends := map[int]int{}
+	var open [][]int
+	for _, action := range actions {
+		switch action.Keyword() {
+		case "if", "range", "with", "define", "block":
+			open = append(open, []int{action.Start})
+		case "else":
+			if len(open) > 0 {
+				open[len(open)-1] = append(open[len(open)-1], action.Start)
+			}
+		case "end":
+			if len(open) == 0 {
+				continue
+			}
+			for _, start := range open[len(open)-1] {
+				ends[start] = action.End
+			}
+			open = open[:len(open)-1]
+		}
+	}
+	return ends
+}
+
+type astConverter struct {
+	content   string
+	actions   []actionSpan
+	blockEnds map[int]int
+}
+
+func (c astConverter) list(list *parse.ListNode) []astNode {
+	if list == nil {
+		return nil
+	}
+	nodes := make([]astNode, 0, len(list.Nodes))
+	for _, node := range list.Nodes {
+		nodes = append(nodes, c.node(node))
+	}
+	return nodes
+}
+
+func (c astConverter) nodes(nodes []parse.Node) []astNode {
+	converted := make([]astNode, 0, len(nodes))
+	for _, node := range nodes {
+		converted = append(converted, c.node(node))
+	}
+	return converted
+}
+
+func (c astConverter) node(node parse.Node) astNode {
+	converted := astNode{Offset: int(node.Position())}
+	converted.Line, converted.Column = lineColumn(c.content, node.Position())
+
+	switch typed := node.(type) {
+	case *parse.TextNode:
+		converted.Kind = "text"
+		converted.Value = string(typed.Text)
+	case *parse.CommentNode:
+		converted.Kind = "comment"
+		converted.Value = typed.Text
+	case *parse.ActionNode:
+		converted.Kind = "action"
+		converted.Pipe = c.pipe(typed.Pipe)
+	case *parse.IfNode:
+		c.branch(&converted, "if", &typed.BranchNode)
+	case *parse.RangeNode:
+		c.branch(&converted, "range", &typed.BranchNode)
+	case *parse.WithNode:
+		c.branch(&converted, "with", &typed.BranchNode)
+	case *parse.TemplateNode:
+		converted.Kind = "template"
+		converted.Name = typed.Name
+		converted.Pipe = c.pipe(typed.Pipe)
+	case *parse.BreakNode:
+		converted.Kind = "break"
+	case *parse.ContinueNode:
+		converted.Kind = "continue"
+	case *parse.PipeNode:
+		return *c.pipe(typed)
+	case *parse.CommandNode:
+		converted.Kind = "command"
+		converted.Args = c.nodes(typed.Args)
+	case *parse.ChainNode:
+		converted.Kind = "chain"
+		converted.Value = typed.String()
+		converted.Fields = typed.Field
+		converted.Args = []astNode{c.node(typed.Node)}
+	case *parse.FieldNode:
+		converted.Kind = "field"
+		converted.Value = typed.String()
+		converted.Fields = typed.Ident
+	case *parse.VariableNode:
+		converted.Kind = "variable"
+		converted.Value = typed.String()
+		converted.Fields = typed.Ident[1:]
+	case *parse.IdentifierNode:
+		converted.Kind = "identifier"
+		converted.Value = typed.Ident
+	case *parse.DotNode:
+		converted.Kind = "dot"
+		converted.Value = "."
+	case *parse.NilNode:
+		converted.Kind = "nil"
+		converted.Value = "nil"
+	case *parse.BoolNode:
+		converted.Kind = "bool"
+		converted.Value = typed.String()
+	case *parse.NumberNode:
+		converted.Kind = "number"
+		converted.Value = typed.Text
+	case *parse.StringNode:
+		converted.Kind = "string"
+		converted.Value = typed.Quoted
+	default:
+		converted.Kind = "unknown"
+		converted.Value = node.String()
+	}
+	return converted
+}
+
+func (c astConverter) pipe(pipe *parse.PipeNode) *astNode {
+	if pipe == nil {
+		return nil
+	}
+	converted := &astNode{Kind: "pipeline", Offset: int(pipe.Position()), IsAssign: pipe.IsAssign}
+	converted.Line, converted.Column = lineColumn(c.content, pipe.Position())
+	for _, decl := range pipe.Decl {
+		converted.Decl = append(converted.Decl, decl.Ident[0])
+	}
+	for _, cmd := range pipe.Cmds {
+		converted.Args = append(converted.Args, c.node(cmd))
+	}
+	return converted
+}
+
+func (c astConverter) branch(converted *astNode, kind string, branch *parse.BranchNode) {
+	converted.Kind = kind
+	converted.Pipe = c.pipe(branch.Pipe)
+	converted.Body = c.list(branch.List)
+	converted.Else = c.list(branch.ElseList)
+
+	// Branch positions point into the opening action; find that action to
+	// look up where its block ends.
+	i := sort.Search(len(c.actions), func(i int) bool { return c.actions[i].End > converted.Offset })
+	if i < len(c.actions) && c.actions[i].Start <= converted.Offset {
+		if end, ok := c.blockEnds[c.actions[i].Start]; ok {
+			converted.EndLine, converted.EndColumn = lineColumn(c.content, parse.Pos(end))
+		}
+	}
+}
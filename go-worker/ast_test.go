@@ -0,0 +1,43 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExecuteASTDumpsParseTree(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "page.tmpl")
+	writeFile(t, templatePath, "{{ $n := len .items }}\n{{ if gt $n 0 }}\n  {{ .user.Name | printf \"%s\" }}\n{{ else }}none{{ end }}\n{{ define \"x\" }}{{ template \"y\" . }}{{ end }}")
+
+	resp := run(templatePath, "", renderOptions{Mode: "ast"})
+	if resp.Error != "" || len(resp.AST) != 2 || resp.AST[0].Name != "page.tmpl" || resp.AST[1].Name != "x" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	nodes := resp.AST[0].Nodes
+	assign := nodes[0]
+	if assign.Kind != "action" || assign.Pipe == nil || !reflect.DeepEqual(assign.Pipe.Decl, []string{"$n"}) || assign.Pipe.IsAssign {
+		t.Fatalf("unexpected declaration: %+v", assign)
+	}
+	if cmd := assign.Pipe.Args[0]; cmd.Kind != "command" || cmd.Args[0].Value != "len" || cmd.Args[1].Kind != "field" || !reflect.DeepEqual(cmd.Args[1].Fields, []string{"items"}) {
+		t.Fatalf("unexpected command: %+v", cmd)
+	}
+
+	branch := nodes[2]
+	if branch.Kind != "if" || branch.Line != 2 || branch.EndLine != 4 || branch.EndColumn != 24 {
+		t.Fatalf("unexpected if node: %+v", branch)
+	}
+	if len(branch.Else) != 1 || branch.Else[0].Value != "none" {
+		t.Fatalf("unexpected else branch: %+v", branch.Else)
+	}
+	output := branch.Body[1]
+	if output.Line != 3 || output.Column != 6 || len(output.Pipe.Args) != 2 || output.Pipe.Args[1].Args[1].Value != `"%s"` {
+		t.Fatalf("unexpected output action: %+v", output)
+	}
+
+	if call := resp.AST[1].Nodes[0]; call.Kind != "template" || call.Name != "y" || call.Pipe.Args[0].Args[0].Kind != "dot" {
+		t.Fatalf("unexpected template call: %+v", call)
+	}
+}
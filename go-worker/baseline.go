@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const lintBaselineVersion = 1
+
+// lintBaseline records the check findings a repository has accepted, so
+// only findings introduced since then are reported.
+type lintBaseline struct {
+	Version  int               `json:"version"`
+	Findings []baselineFinding `json:"findings"`
+}
+
+// baselineFinding identifies a finding by its file, relative to the
+// baseline, and by the text of its line rather than the line number, so
+// edits elsewhere in the file do not resurface it. Line is informational.
+type baselineFinding struct {
+	File     string `json:"file"`
+	Rule     string `json:"rule,omitempty"`
+	Message  string `json:"message"`
+	Severity string `json:"severity"`
+	Line     int    `json:"line,omitempty"`
+	Source   string `json:"source"`
+}
+
+// baselineReport summarizes how the baseline applied to one template.
+// Fixed counts baselined findings that no longer occur.
+type baselineReport struct {
+	File       string `json:"file"`
+	Suppressed int    `json:"suppressed"`
+	New        int    `json:"new"`
+	Fixed      int    `json:"fixed"`
+	Updated    bool   `json:"updated,omitempty"`
+}
+
+func (f baselineFinding) key() string {
+	return strings.Join([]string{f.File, f.Rule, f.Severity, f.Message, f.Source}, "\x00")
+}
+
+// applyLintBaseline filters the template's diagnostics through the
+// baseline at path. With update, the baseline's entries for the template
+// are replaced by the current findings, and nothing is reported as new.
+func applyLintBaseline(path, templatePath, content string, diagnostics []diagnostic, update bool) ([]diagnostic, *baselineReport, error) {
+	baseline, err := loadLintBaseline(path, update)
+	if err != nil {
+		return diagnostics, nil, err
+	}
+	file, err := baselineRelativePath(path, templatePath)
+	if err != nil {
+		return diagnostics, nil, err
+	}
+
+	lines := strings.Split(content, "\n")
+	current := make([]baselineFinding, len(diagnostics))
+	for i, diag := range diagnostics {
+		current[i] = baselineFinding{File: file, Rule: diag.Rule, Message: diag.Message, Severity: diag.Severity, Line: diag.Line}
+		if diag.Line >= 1 && diag.Line <= len(lines) {
+			current[i].Source = strings.TrimSpace(lines[diag.Line-1])
+		}
+	}
+
+	report := &baselineReport{File: file}
+	if update {
+		var kept []baselineFinding
+		for _, finding := range baseline.Findings {
+			if finding.File != file {
+				kept = append(kept, finding)
+			}
+		}
+		baseline.Findings = append(kept, current...)
+		if err := writeLintBaseline(path, baseline); err != nil {
+			return diagnostics, nil, err
+		}
+		report.Suppressed, report.Updated = len(current), true
+		return nil, report, nil
+	}
+
+	accepted := map[string]int{}
+	for _, finding := range baseline.Findings {
+		if finding.File == file {
+			accepted[finding.key()]++
+			report.Fixed++
+		}
+	}
+	var fresh []diagnostic
+	for i, diag := range diagnostics {
+		if key := current[i].key(); accepted[key] > 0 {
+			accepted[key]--
+			report.Suppressed++
+			report.Fixed--
+			continue
+		}
+		fresh = append(fresh, diag)
+	}
+	report.New = len(fresh)
+	return fresh, report, nil
+}
+
+// loadLintBaseline reads the baseline. A missing file is an error unless
+// it is about to be created.
+func loadLintBaseline(path string, update bool) (lintBaseline, error) {
+	baseline := lintBaseline{Version: lintBaselineVersion}
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && update {
+		return baseline, nil
+	}
+	if err != nil {
+		return baseline, err
+	}
+	if err := json.Unmarshal(content, &baseline); err != nil {
+		return baseline, fmt.Errorf("lint baseline %s is not valid JSON: %v", path, err)
+	}
+	if baseline.Version != lintBaselineVersion {
+		return baseline, fmt.Errorf("lint baseline %s has unsupported version %d", path, baseline.Version)
+	}
+	return baseline, nil
+}
+
+// writeLintBaseline writes the findings sorted by file and line, so the
+// baseline diffs cleanly in review.
+func writeLintBaseline(path string, baseline lintBaseline) error {
+	baseline.Version = lintBaselineVersion
+	sort.SliceStable(baseline.Findings, func(i, j int) bool {
+		a, b := baseline.Findings[i], baseline.Findings[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Line < b.Line
+	})
+	if baseline.Findings == nil {
+		baseline.Findings = []baselineFinding{}
+	}
+	content, err := json.MarshalIndent(baseline, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(content, '\n'), 0o644)
+}
+
+// baselineRelativePath names templatePath relative to the baseline's
+// directory, with forward slashes, so baselines are portable.
+func baselineRelativePath(baselinePath, templatePath string) (string, error) {
+	baseDir, err := filepath.Abs(filepath.Dir(baselinePath))
+	if err != nil {
+		return "", err
+	}
+	target, err := filepath.Abs(templatePath)
+	if err != nil {
+		return "", err
+	}
+	relative, err := filepath.Rel(baseDir, target)
+	if err != nil {
+		return filepath.ToSlash(target), nil
+	}
+	return filepath.ToSlash(relative), nil
+}
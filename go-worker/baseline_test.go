@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLintBaselineSuppressesRecordedFindingsOnly(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "templates", "legacy.tmpl")
+	writeFile(t, templatePath, "{{ shout .a }}\n{{ whisper .b }}\n")
+	baselinePath := filepath.Join(dir, "lint-baseline.json")
+
+	created := run(templatePath, "", renderOptions{Mode: "check", LintBaseline: baselinePath, UpdateBaseline: true})
+	if created.Error != "" || len(created.Diagnostics) != 0 || created.Baseline == nil || !created.Baseline.Updated || created.Baseline.Suppressed != 2 {
+		t.Fatalf("unexpected update response: %+v", created)
+	}
+	var baseline lintBaseline
+	content, err := os.ReadFile(baselinePath)
+	if err != nil || json.Unmarshal(content, &baseline) != nil {
+		t.Fatalf("expected a JSON baseline, got %s (%v)", content, err)
+	}
+	if len(baseline.Findings) != 2 || baseline.Findings[0].File != "templates/legacy.tmpl" || baseline.Findings[0].Source != "{{ shout .a }}" {
+		t.Fatalf("unexpected baseline: %+v", baseline)
+	}
+
+	// Moving the accepted lines and adding a new problem reports only the
+	// new one.
+	writeFile(t, templatePath, "intro\n{{ whisper .b }}\n{{ shout .a }}\n{{ mumble .c }}\n")
+	resp := run(templatePath, "", renderOptions{Mode: "check", LintBaseline: baselinePath})
+	if resp.Error != "" || len(resp.Diagnostics) != 1 || !strings.Contains(resp.Diagnostics[0].Message, `"mumble"`) {
+		t.Fatalf("expected only the new finding, got %+v", resp.Diagnostics)
+	}
+	if *resp.Baseline != (baselineReport{File: "templates/legacy.tmpl", Suppressed: 2, New: 1}) {
+		t.Fatalf("unexpected report: %+v", resp.Baseline)
+	}
+
+	writeFile(t, templatePath, "{{ shout .a }}\n")
+	resp = run(templatePath, "", renderOptions{Mode: "check", LintBaseline: baselinePath})
+	if len(resp.Diagnostics) != 0 || resp.Baseline.Suppressed != 1 || resp.Baseline.Fixed != 1 {
+		t.Fatalf("expected a fixed finding to be counted, got %+v", resp.Baseline)
+	}
+}
+
+func TestLintBaselineUpdateKeepsOtherTemplates(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "a.tmpl")
+	writeFile(t, first, "{{ shout . }}")
+	second := filepath.Join(dir, "b.tmpl")
+	writeFile(t, second, "{{ whisper . }}")
+	baselinePath := filepath.Join(dir, "baseline.json")
+
+	run(first, "", renderOptions{Mode: "check", LintBaseline: baselinePath, UpdateBaseline: true})
+	run(second, "", renderOptions{Mode: "check", LintBaseline: baselinePath, UpdateBaseline: true})
+	writeFile(t, first, "fixed")
+	run(first, "", renderOptions{Mode: "check", LintBaseline: baselinePath, UpdateBaseline: true})
+
+	baseline, err := loadLintBaseline(baselinePath, false)
+	if err != nil || len(baseline.Findings) != 1 || baseline.Findings[0].File != "b.tmpl" {
+		t.Fatalf("expected only b.tmpl's finding to remain, got %+v (%v)", baseline, err)
+	}
+
+	missing := run(first, "", renderOptions{Mode: "check", LintBaseline: filepath.Join(dir, "none.json")})
+	if missing.Error == "" {
+		t.Fatal("expected a missing baseline to be an error outside --update-baseline")
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sort"
+	"time"
+)
+
+const (
+	// defaultBenchWarmup is how many renders --bench runs, untimed, before
+	// the timed ones.
+	defaultBenchWarmup = 3
+	// maxBenchRuns bounds --bench so a typo cannot pin the worker.
+	maxBenchRuns = 100000
+)
+
+// benchReport summarizes --bench: Runs timed renders after Warmup untimed
+// ones, with the distribution of their parse, execute, and total times and
+// the heap allocations of an average render.
+type benchReport struct {
+	Runs         int        `json:"runs"`
+	Warmup       int        `json:"warmup"`
+	ParseMs      benchStats `json:"parseMs"`
+	ExecuteMs    benchStats `json:"executeMs"`
+	TotalMs      benchStats `json:"totalMs"`
+	AllocsPerRun uint64     `json:"allocsPerRun"`
+	BytesPerRun  uint64     `json:"bytesPerRun"`
+}
+
+// benchStats describes a distribution of times in milliseconds.
+type benchStats struct {
+	Min    float64 `json:"min"`
+	Median float64 `json:"median"`
+	P95    float64 `json:"p95"`
+	Max    float64 `json:"max"`
+	Mean   float64 `json:"mean"`
+}
+
+// validateBench rejects --bench and --bench-warmup values outside their
+// range.
+func validateBench(opts renderOptions) error {
+	if opts.Bench < 0 || opts.Bench > maxBenchRuns {
+		return fmt.Errorf("--bench must be between 0 and %d", maxBenchRuns)
+	}
+	if opts.BenchWarmup < 0 {
+		return errors.New("--bench-warmup must not be negative")
+	}
+	return nil
+}
+
+// benchRender renders content opts.Bench more times against data, after
+// the warm-up, and reports how long they took. Each run parses from
+// scratch, bypassing the server's cache, and leaves out --trace,
+// --profile, --source-map, and --value-origins so only the render itself
+// is measured.
+func benchRender(path, content string, data interface{}, opts renderOptions) (*benchReport, error) {
+	opts.cache = nil
+	opts.Trace, opts.Profile, opts.SourceMap, opts.ValueOrigins = false, false, false, false
+	opts.traceSink = nil
+	for i := 0; i < opts.BenchWarmup; i++ {
+		if _, _, err := renderTemplateRun(path, content, data, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	parses := make([]float64, opts.Bench)
+	executes := make([]float64, opts.Bench)
+	totals := make([]float64, opts.Bench)
+	var before, after runtime.MemStats
+	var allocs, bytes uint64
+	for i := 0; i < opts.Bench; i++ {
+		runtime.ReadMemStats(&before)
+		start := time.Now()
+		_, run, err := renderTemplateRun(path, content, data, opts)
+		totals[i] = elapsedMs(start)
+		runtime.ReadMemStats(&after)
+		if err != nil {
+			return nil, err
+		}
+		parses[i], executes[i] = run.timings.ParseMs, run.timings.ExecuteMs
+		allocs += after.Mallocs - before.Mallocs
+		bytes += after.TotalAlloc - before.TotalAlloc
+	}
+	return &benchReport{
+		Runs:         opts.Bench,
+		Warmup:       opts.BenchWarmup,
+		ParseMs:      summarizeTimes(parses),
+		ExecuteMs:    summarizeTimes(executes),
+		TotalMs:      summarizeTimes(totals),
+		AllocsPerRun: allocs / uint64(opts.Bench),
+		BytesPerRun:  bytes / uint64(opts.Bench),
+	}, nil
+}
+
+// summarizeTimes sorts times and reads off their distribution; percentiles
+// use the nearest rank.
+func summarizeTimes(times []float64) benchStats {
+	sort.Float64s(times)
+	rank := func(percentile int) float64 {
+		index := (percentile*len(times)+99)/100 - 1
+		return times[max(index, 0)]
+	}
+	var sum float64
+	for _, value := range times {
+		sum += value
+	}
+	return benchStats{
+		Min:    times[0],
+		Median: rank(50),
+		P95:    rank(95),
+		Max:    times[len(times)-1],
+		Mean:   sum / float64(len(times)),
+	}
+}
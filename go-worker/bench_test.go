@@ -0,0 +1,50 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBenchReportsTimingDistributions(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "page.tmpl")
+	writeFile(t, templatePath, `{{ range .items }}{{ printf "%s-%v" .name .n }}{{ end }}`)
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, contextPath, `{"items": [{"name": "a", "n": 1}, {"name": "b", "n": 2}]}`)
+
+	resp := run(templatePath, contextPath, renderOptions{Bench: 20, BenchWarmup: 2, Trace: true})
+	bench := resp.Bench
+	if resp.Error != "" || resp.Rendered != "a-1b-2" || bench == nil {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	if bench.Runs != 20 || bench.Warmup != 2 || bench.AllocsPerRun == 0 || bench.BytesPerRun == 0 {
+		t.Fatalf("unexpected report: %+v", bench)
+	}
+	for _, stats := range []benchStats{bench.ParseMs, bench.ExecuteMs, bench.TotalMs} {
+		if stats.Min > stats.Median || stats.Median > stats.P95 || stats.P95 > stats.Max || stats.Mean < stats.Min || stats.Mean > stats.Max {
+			t.Fatalf("inconsistent distribution: %+v", stats)
+		}
+	}
+	if len(resp.Trace) == 0 {
+		t.Fatal("expected the first render to keep its trace")
+	}
+
+	if resp := run(templatePath, contextPath, renderOptions{Bench: -1}); !strings.Contains(resp.Error, "--bench") {
+		t.Fatalf("expected a negative count to be rejected, got %+v", resp)
+	}
+}
+
+func TestSummarizeTimesUsesNearestRank(t *testing.T) {
+	times := make([]float64, 0, 100)
+	for i := 100; i >= 1; i-- {
+		times = append(times, float64(i))
+	}
+	stats := summarizeTimes(times)
+	if stats.Min != 1 || stats.Median != 50 || stats.P95 != 95 || stats.Max != 100 || stats.Mean != 50.5 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if stats := summarizeTimes([]float64{3}); stats.P95 != 3 || stats.Median != 3 {
+		t.Fatalf("unexpected single-run stats: %+v", stats)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"sync"
+	"time"
+)
+
+// bufferClasses are the capacities the buffer pool hands out. A buffer
+// grown past the largest class by a render is kept as that class, up to
+// twice its size; larger ones are left to the garbage collector.
+var bufferClasses = [...]int{16 << 10, 256 << 10, 4 << 20, 32 << 20}
+
+const (
+	// maxFreeBuffers bounds how many idle buffers each class keeps, about
+	// the number of renders a server runs at once.
+	maxFreeBuffers = 4
+	// bufferIdleTime is how long a class keeps its idle buffers after the
+	// last render that asked for one, so a single multi-megabyte preview
+	// does not pin its buffers for the life of the server.
+	bufferIdleTime = time.Minute
+)
+
+// renderBuffers recycles the output buffers of server renders, the
+// buffers context files are read into, and the buffers responses are
+// encoded into. Unlike a sync.Pool, it keeps its buffers across garbage
+// collections, which previewing large outputs on every keystroke triggers
+// constantly, and releases them only once they go unused.
+var renderBuffers = newBufferPool()
+
+type bufferPool struct {
+	mu         sync.Mutex
+	free       [len(bufferClasses)][]*bytes.Buffer
+	lastUsed   [len(bufferClasses)]time.Time
+	lastShrink time.Time
+	now        func() time.Time
+}
+
+func newBufferPool() *bufferPool {
+	return &bufferPool{now: time.Now}
+}
+
+// get returns an empty buffer that can hold size bytes without growing.
+func (p *bufferPool) get(size int) *bytes.Buffer {
+	class := 0
+	for class < len(bufferClasses) && bufferClasses[class] < size {
+		class++
+	}
+	if class == len(bufferClasses) {
+		return bytes.NewBuffer(make([]byte, 0, size))
+	}
+
+	p.mu.Lock()
+	now := p.now()
+	p.shrink(now)
+	p.lastUsed[class] = now
+	if n := len(p.free[class]); n > 0 {
+		buf := p.free[class][n-1]
+		p.free[class] = p.free[class][:n-1]
+		p.mu.Unlock()
+		buf.Reset()
+		return buf
+	}
+	p.mu.Unlock()
+	return bytes.NewBuffer(make([]byte, 0, bufferClasses[class]))
+}
+
+// put returns buf to the class its capacity fills. The caller must not
+// use buf afterwards.
+func (p *bufferPool) put(buf *bytes.Buffer) {
+	capacity := buf.Cap()
+	if capacity < bufferClasses[0] || capacity > 2*bufferClasses[len(bufferClasses)-1] {
+		return
+	}
+	class := len(bufferClasses) - 1
+	for bufferClasses[class] > capacity {
+		class--
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.free[class]) < maxFreeBuffers {
+		p.free[class] = append(p.free[class], buf)
+	}
+}
+
+// shrink drops the idle buffers of every class no get has asked for in
+// bufferIdleTime. It runs at most twice per bufferIdleTime, from get, with
+// p.mu held.
+func (p *bufferPool) shrink(now time.Time) {
+	if now.Sub(p.lastShrink) < bufferIdleTime/2 {
+		return
+	}
+	p.lastShrink = now
+	for class := range p.free {
+		if now.Sub(p.lastUsed[class]) >= bufferIdleTime {
+			p.free[class] = nil
+		}
+	}
+}
+
+// loadPooledContext reads and parses a local context file through a
+// pooled buffer. Parsing copies every string out of the buffer, so it can
+// be reused as soon as parseContextFile returns.
+func loadPooledContext(contextPath string) (interface{}, error) {
+	file, err := os.Open(contextPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	size := bytes.MinRead
+	if info, err := file.Stat(); err == nil {
+		size += int(info.Size())
+	}
+	buf := renderBuffers.get(size)
+	defer renderBuffers.put(buf)
+	if _, err := buf.ReadFrom(file); err != nil {
+		return nil, err
+	}
+	return parseContextFile(contextPath, buf.Bytes())
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBufferPoolReusesBuffersBySizeClass(t *testing.T) {
+	pool := newBufferPool()
+	small := pool.get(100)
+	if small.Cap() != bufferClasses[0] {
+		t.Fatalf("expected a %d byte buffer, got %d", bufferClasses[0], small.Cap())
+	}
+	small.WriteString("left over")
+	pool.put(small)
+	if again := pool.get(bufferClasses[0]); again != small || again.Len() != 0 {
+		t.Fatalf("expected the small buffer back, emptied")
+	}
+
+	// A buffer a render grew is kept as the class it fills.
+	grown := pool.get(0)
+	grown.Grow(bufferClasses[1])
+	pool.put(grown)
+	if again := pool.get(bufferClasses[1]); again != grown {
+		t.Fatalf("expected the grown buffer to serve the next class")
+	}
+
+	if huge := pool.get(4 * bufferClasses[len(bufferClasses)-1]); huge.Cap() < 4*bufferClasses[len(bufferClasses)-1] {
+		t.Fatalf("expected an unpooled buffer of the requested size, got %d", huge.Cap())
+	} else {
+		pool.put(huge)
+	}
+	for class, free := range pool.free {
+		if class != 0 && len(free) > 0 {
+			t.Fatalf("expected oversized buffers to be dropped, class %d holds %d", class, len(free))
+		}
+	}
+
+	for i := 0; i < maxFreeBuffers+2; i++ {
+		pool.put(bytes.NewBuffer(make([]byte, 0, bufferClasses[0])))
+	}
+	if len(pool.free[0]) != maxFreeBuffers {
+		t.Fatalf("expected at most %d idle buffers, got %d", maxFreeBuffers, len(pool.free[0]))
+	}
+}
+
+func TestBufferPoolShrinksIdleClasses(t *testing.T) {
+	now := time.Now()
+	pool := newBufferPool()
+	pool.now = func() time.Time { return now }
+
+	big := pool.get(bufferClasses[2])
+	small := pool.get(1)
+	pool.put(big)
+	pool.put(small)
+
+	// Only the small class stays in use.
+	for i := 0; i < 3; i++ {
+		now = now.Add(bufferIdleTime / 2)
+		pool.put(pool.get(1))
+	}
+	if len(pool.free[2]) != 0 {
+		t.Fatalf("expected the idle large buffer to be released")
+	}
+	if len(pool.free[0]) != 1 {
+		t.Fatalf("expected the small buffer to stay pooled, got %d", len(pool.free[0]))
+	}
+}
+
+func TestPooledContextMatchesReadContext(t *testing.T) {
+	contextPath := filepath.Join(t.TempDir(), "context.json")
+	writeFile(t, contextPath, ` {"name": "Ada", "tags": ["a", "b"]} `)
+
+	want, err := loadContext(contextPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := loadPooledContext(contextPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Reusing the buffer must not change the parsed context.
+	renderBuffers.get(1).WriteString(`{"name": "Bob", "tags": ["x", "y"]}`)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	if _, err := loadPooledContext(contextPath + ".missing"); err == nil {
+		t.Fatalf("expected a missing context to fail")
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import "sort"
+
+// workerModes are the modes dispatch handles, in the order --mode lists
+// them.
+var workerModes = []string{
+	"render", "minify", "extract-strings", "position-to-offset", "offset-to-position",
+	"definition", "compare-refs", "check", "explain", "control-flow", "ast", "analyze",
+	"hover", "complete", "json-patch", "email", "render-dir", "gen-go", "gen-dts",
+	"context-diff", "partial", "symbols", "references", "rename", "deps", "fmt",
+	"escape-report", "semantic-tokens", "stats", "selftest",
+}
+
+// capabilities tells a client what this worker supports, so an extension
+// paired with an older binary can hide what the binary cannot do rather
+// than fail on it.
+type capabilities struct {
+	// ProtocolVersion is the newest response version; ProtocolVersions
+	// are all the versions --response-version accepts.
+	ProtocolVersion  int    `json:"protocolVersion"`
+	ProtocolVersions []int  `json:"protocolVersions"`
+	WorkerVersion    string `json:"workerVersion"`
+	// Modes are the values of --mode, and of mode in server requests.
+	Modes []string `json:"modes"`
+	// Requests are the kinds of server request lines: a render in any
+	// mode, and a cancel.
+	Requests []string `json:"requests"`
+	// Commands are the subcommands given as the first argument.
+	Commands []string `json:"commands"`
+	// Functions are the names templates can call with the worker's flags,
+	// including text/template's own, sorted.
+	Functions         []string `json:"functions"`
+	FuncLibraries     []string `json:"funcLibraries"`
+	ContextFormats    []string `json:"contextFormats"`
+	ContextSources    []string `json:"contextSources"`
+	PositionEncodings []string `json:"positionEncodings"`
+}
+
+// describeCapabilities reports the worker's capabilities under opts, which
+// decide the function names: --funcs, helper plugins, renames, and
+// production parity all change them.
+func describeCapabilities(opts renderOptions) *capabilities {
+	funcs := textFuncMap()
+	// A helper that cannot be loaded fails every render with its own
+	// error; the names that did load are still worth reporting.
+	_ = prepareFuncs(funcs, opts)
+	names := make([]string, 0, len(funcs)+len(builtinFuncNames))
+	for name := range funcs {
+		names = append(names, name)
+	}
+	for name := range builtinFuncNames {
+		if _, ok := funcs[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	return &capabilities{
+		ProtocolVersion:   latestResponseVersion,
+		ProtocolVersions:  []int{responseVersion1, responseVersion2},
+		WorkerVersion:     workerVersion,
+		Modes:             workerModes,
+		Requests:          []string{"render", "cancel"},
+		Commands:          []string{"update", "check-all", "test", "init", "fmt"},
+		Functions:         names,
+		FuncLibraries:     []string{funcLibraryBuiltin, funcLibrarySprig},
+		ContextFormats:    []string{"json", "csv", "ndjson", "jsonl"},
+		ContextSources:    []string{"file", "stdin", "http", "https", "s3", "gs"},
+		PositionEncodings: []string{positionEncodingUTF8, positionEncodingUTF16, positionEncodingUTF32},
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestDescribeCapabilitiesFollowsTheFuncLibrary(t *testing.T) {
+	builtin := describeCapabilities(renderOptions{})
+	if builtin.ProtocolVersion != latestResponseVersion || builtin.WorkerVersion != workerVersion {
+		t.Fatalf("unexpected versions: %+v", builtin)
+	}
+	if !sort.StringsAreSorted(builtin.Functions) {
+		t.Fatalf("expected sorted functions, got %v", builtin.Functions)
+	}
+	for _, name := range []string{"printf", "toJson", "uuidv4"} {
+		if !containsString(builtin.Functions, name) {
+			t.Fatalf("expected %s among %v", name, builtin.Functions)
+		}
+	}
+	if containsString(builtin.Functions, "splitList") {
+		t.Fatal("expected Sprig helpers only under --funcs=sprig")
+	}
+	if sprig := describeCapabilities(renderOptions{Funcs: funcLibrarySprig}); !containsString(sprig.Functions, "splitList") {
+		t.Fatal("expected Sprig helpers under --funcs=sprig")
+	}
+}
+
+func TestWorkerModesAreDispatched(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing.tmpl")
+	for _, mode := range workerModes {
+		if mode == "selftest" || mode == "render-dir" {
+			// These read no template; selftest runs its whole suite.
+			continue
+		}
+		if resp := dispatch(missing, "", renderOptions{Mode: mode}); strings.HasPrefix(resp.Error, "unknown mode") {
+			t.Fatalf("mode %s is advertised but not dispatched", mode)
+		}
+	}
+}
+
+func TestServeAdvertisesCapabilitiesOnce(t *testing.T) {
+	templatePath := filepath.Join(t.TempDir(), "greet.tmpl")
+	writeFile(t, templatePath, "Hello")
+
+	requests := `{"cancel":9}` + "\n" +
+		`{"id":1,"template":` + quoteJSON(templatePath) + `}` + "\n" +
+		`{"id":2,"template":` + quoteJSON(templatePath) + `}`
+	var output bytes.Buffer
+	if err := serve(strings.NewReader(requests), &output, renderOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	advertised := map[string]bool{}
+	for _, line := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+		var resp serverResponse
+		if err := json.Unmarshal([]byte(line), &resp); err != nil {
+			t.Fatalf("invalid response line %q: %v", line, err)
+		}
+		advertised[string(resp.ID)] = resp.Capabilities != nil
+	}
+	if len(advertised) != 2 || !advertised["1"] || advertised["2"] {
+		t.Fatalf("expected only the first request to carry capabilities, got %v", advertised)
+	}
+}
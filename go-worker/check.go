@@ -0,0 +1,249 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/template/parse"
+)
+
+// maxCheckProblems bounds how many parse errors check mode recovers from.
+const maxCheckProblems = 50
+
+// executeCheck parses the template without executing it and reports every
+// problem it can find: unclosed actions, syntax errors, calls to functions
+// that would not be defined at render time, and the findings of the
+// built-in lint rules and any lint plugins. Findings silenced by lint
+// comments are left out, and comments that silence nothing are reported;
+// see suppress.go. The project config's lintRules then set the severity
+// of each rule. With --lint-baseline, findings the baseline accepts are
+// left out too.
+func executeCheck(templatePath string, opts renderOptions) response {
+	if templatePath == "" {
+		return response{Error: "template path is required"}
+	}
+
+	content, err := readTemplate(templatePath, opts)
+	if err != nil {
+		return response{Error: err.Error()}
+	}
+
+	if strings.TrimSpace(opts.FuncsFrom) != "" {
+		profile, err := loadFuncProfile(opts.FuncsFrom, opts.FuncFakes)
+		if err != nil {
+			return response{
+				Diagnostics: []diagnostic{{Message: err.Error(), Severity: "error", File: opts.FuncsFrom}},
+				Error:       err.Error(),
+			}
+		}
+		opts.funcProfile = profile
+	}
+
+	diagnostics, err := checkTemplate(templatePath, content, opts)
+	if err != nil {
+		return response{Error: err.Error()}
+	}
+	diagnostics, unused := suppressDiagnostics(templatePath, content, "", "", diagnostics)
+	diagnostics = applyLintRules(append(diagnostics, unused...), opts)
+	if strings.TrimSpace(opts.LintBaseline) == "" {
+		return response{Diagnostics: diagnostics}
+	}
+	fresh, report, err := applyLintBaseline(opts.LintBaseline, templatePath, content, diagnostics, opts.UpdateBaseline)
+	if err != nil {
+		return response{
+			Diagnostics: append(diagnostics, diagnostic{Message: err.Error(), Severity: "error", File: opts.LintBaseline}),
+			Error:       err.Error(),
+		}
+	}
+	return response{Diagnostics: fresh, Baseline: report}
+}
+
+// checkTemplate collects diagnostics by repeatedly parsing the template and
+// neutralizing the action each error points at, so one mistake does not
+// hide the ones after it.
+func checkTemplate(templatePath, content string, opts renderOptions) ([]diagnostic, error) {
+	var diagnostics []diagnostic
+	working := content
+
+	for _, start := range unclosedActions(working) {
+		line, column := lineColumn(content, parse.Pos(start))
+		diagnostics = append(diagnostics, diagnostic{
+			Message:   "unclosed action",
+			Severity:  "error",
+			File:      templatePath,
+			Line:      line,
+			Column:    column,
+			EndColumn: column + len(defaultLeftDelim),
+		})
+		working = working[:start] + strings.Repeat(" ", len(defaultLeftDelim)) + working[start+len(defaultLeftDelim):]
+	}
+
+	name := templateName(templatePath)
+	for attempt := 0; attempt < maxCheckProblems; attempt++ {
+		trees, err := parseTrees(name, working)
+		if err == nil {
+			problems, err := unknownFunctionDiagnostics(templatePath, working, trees, opts)
+			if err != nil {
+				return nil, err
+			}
+			diagnostics = append(diagnostics, problems...)
+			diagnostics = append(diagnostics, shadowDiagnostics(templatePath, working, opts)...)
+			diagnostics = append(diagnostics, typeFlowDiagnostics(templatePath, working, nil, opts)...)
+			diagnostics = append(diagnostics, lintDiagnostics(templatePath, working, opts)...)
+			if working == content {
+				diagnostics = append(diagnostics, lintPluginDiagnostics(templatePath, content, opts)...)
+			}
+			break
+		}
+
+		diag := templateDiagnostic(err, templatePath, working)
+		recovered, action, ok := neutralizeFailingAction(name, working, diag.Line, err)
+		if ok && diag.Column == 0 {
+			// Parse errors only carry a line; point at the action that caused it.
+			diag.Line, diag.Column = lineColumn(working, parse.Pos(action.Start))
+			diag.EndColumn = diagnosticEndColumn(diag, working, "", "")
+		}
+		diagnostics = append(diagnostics, diag)
+		if !ok {
+			break
+		}
+		working = recovered
+	}
+
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		if diagnostics[i].Line != diagnostics[j].Line {
+			return diagnostics[i].Line < diagnostics[j].Line
+		}
+		return diagnostics[i].Column < diagnostics[j].Column
+	})
+	return diagnostics, nil
+}
+
+// unclosedActions returns the offsets of left delimiters whose action runs
+// into the next left delimiter or the end of the file before closing.
+func unclosedActions(content string) []int {
+	var starts []int
+	offset := 0
+	for {
+		start := strings.Index(content[offset:], defaultLeftDelim)
+		if start < 0 {
+			return starts
+		}
+		start += offset
+
+		end := findActionEnd(content, start+len(defaultLeftDelim), defaultRightDelim)
+		body := strings.TrimLeft(strings.TrimPrefix(content[start+len(defaultLeftDelim):], "-"), " \t\r\n")
+		if end >= 0 && strings.HasPrefix(body, "/*") {
+			offset = end + len(defaultRightDelim)
+			continue
+		}
+		next := strings.Index(content[start+len(defaultLeftDelim):], defaultLeftDelim)
+		if next >= 0 {
+			next += start + len(defaultLeftDelim)
+		}
+
+		switch {
+		case end < 0 || (next >= 0 && next < end && !strings.ContainsAny(content[start:next], "\"'`")):
+			starts = append(starts, start)
+			offset = start + len(defaultLeftDelim)
+		default:
+			offset = end + len(defaultRightDelim)
+		}
+	}
+}
+
+// neutralizeFailingAction rewrites one action on line so the parser can get
+// past it. Candidates are tried in order and the first rewrite that moves or
+// changes the error wins.
+func neutralizeFailingAction(name, content string, line int, failure error) (string, actionSpan, bool) {
+	if line < 1 {
+		return "", actionSpan{}, false
+	}
+
+	for _, action := range scanActions(content, "", "") {
+		startLine, _ := lineColumn(content, parse.Pos(action.Start))
+		endLine, _ := lineColumn(content, parse.Pos(action.End))
+		if line < startLine || line > endLine || action.IsComment() {
+			continue
+		}
+
+		candidate := content[:action.Start] + neutralAction(action, content[action.Start:action.End]) + content[action.End:]
+		if _, err := parseTrees(name, candidate); err == nil || err.Error() != failure.Error() {
+			return candidate, action, true
+		}
+	}
+	return "", actionSpan{}, false
+}
+
+// neutralAction replaces a broken action with one that parses while keeping
+// block structure intact, padded so the line count and, where possible, the
+// length stay the same.
+func neutralAction(action actionSpan, source string) string {
+	fields := strings.Fields(action.Body())
+	var prefix string
+	switch action.Keyword() {
+	case "if", "with", "range":
+		prefix = defaultLeftDelim + action.Keyword() + " 1"
+	case "else":
+		prefix = defaultLeftDelim + "else"
+		if len(fields) > 1 && (fields[1] == "if" || fields[1] == "with") {
+			prefix += " " + fields[1] + " 1"
+		}
+	case "define":
+		prefix = defaultLeftDelim + fmt.Sprintf("define %q", fmt.Sprintf("check-%d", action.Start))
+	case "block":
+		prefix = defaultLeftDelim + fmt.Sprintf("block %q 1", fmt.Sprintf("check-%d", action.Start))
+	default:
+		return blankOut(source)
+	}
+
+	tail := ""
+	if end := len(source) - len(defaultRightDelim); end > len(prefix) {
+		tail = source[len(prefix):end]
+	}
+	filler := blankOut(tail)
+	if missing := strings.Count(source, "\n") - strings.Count(filler, "\n"); missing > 0 {
+		filler += strings.Repeat("\n", missing)
+	}
+	return prefix + filler + defaultRightDelim
+}
+
+// blankOut replaces every byte but newlines with a space.
+func blankOut(source string) string {
+	blank := []byte(source)
+	for i, b := range blank {
+		if b != '\n' {
+			blank[i] = ' '
+		}
+	}
+	return string(blank)
+}
+
+// unknownFunctionDiagnostics reports calls to functions that neither Go nor
+// the worker's configured function map would define at render time.
+func unknownFunctionDiagnostics(templatePath, content string, trees map[string]*parse.Tree, opts renderOptions) ([]diagnostic, error) {
+	funcs := textFuncMap()
+	if err := prepareFuncs(funcs, opts); err != nil {
+		return nil, err
+	}
+
+	var diagnostics []diagnostic
+	for name, positions := range calledFunctions(trees) {
+		if _, ok := funcs[name]; ok || builtinFuncNames[name] {
+			continue
+		}
+		for _, pos := range positions {
+			line, column := lineColumn(content, pos)
+			diagnostics = append(diagnostics, diagnostic{
+				Message:   fmt.Sprintf("function %q not defined", name),
+				Severity:  "error",
+				Rule:      "unknown-function",
+				File:      templatePath,
+				Line:      line,
+				Column:    column,
+				EndColumn: column + len(name),
+			})
+		}
+	}
+	return diagnostics, nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunCheckReportsEveryProblem(t *testing.T) {
+	templatePath := filepath.Join(t.TempDir(), "page.tmpl")
+	writeFile(t, templatePath, strings.Join([]string{
+		`{{ if .ok || .other }}yes{{ end }}`,
+		`{{ .name | shout }}`,
+		`{{ range $i := }}item{{ end }}`,
+		`{{ upper .title }} {{ $missing }}`,
+		`{{ .unclosed `,
+	}, "\n"))
+
+	resp := run(templatePath, "", renderOptions{Mode: "check"})
+	if resp.Error != "" {
+		t.Fatalf("unexpected error: %s", resp.Error)
+	}
+
+	want := []struct {
+		line    int
+		message string
+	}{
+		{1, `unexpected "|" in if`},
+		{2, `function "shout" not defined`},
+		{3, "missing value for range"},
+		{4, `undefined variable "$missing"`},
+		{5, "unclosed action"},
+	}
+	if len(resp.Diagnostics) != len(want) {
+		t.Fatalf("expected %d diagnostics, got %+v", len(want), resp.Diagnostics)
+	}
+	for i, expected := range want {
+		diag := resp.Diagnostics[i]
+		if diag.Line != expected.line || !strings.Contains(diag.Message, expected.message) || diag.Severity != "error" {
+			t.Fatalf("diagnostic %d: expected line %d %q, got %+v", i, expected.line, expected.message, diag)
+		}
+	}
+
+	if first := resp.Diagnostics[0]; first.Column != 1 || first.EndColumn != 23 {
+		t.Fatalf("expected parse error to cover the if action, got %+v", first)
+	}
+	if shout := resp.Diagnostics[1]; shout.Column != 12 || shout.EndColumn != 17 {
+		t.Fatalf("expected unknown function range 12-17, got %+v", shout)
+	}
+}
+
+func TestRunCheckHonorsFunctionOptions(t *testing.T) {
+	templatePath := filepath.Join(t.TempDir(), "page.tmpl")
+	writeFile(t, templatePath, `{{ "a" | quote }} {{ "b" | upper }}`)
+
+	resp := run(templatePath, "", renderOptions{Mode: "check", Funcs: funcLibrarySprig, DisableFuncs: []string{"upper"}})
+	if len(resp.Diagnostics) != 1 || !strings.Contains(resp.Diagnostics[0].Message, `"upper"`) {
+		t.Fatalf("expected only the disabled helper to be reported, got %+v", resp.Diagnostics)
+	}
+}
+
+func TestRunCheckIsQuietForValidTemplates(t *testing.T) {
+	templatePath := filepath.Join(t.TempDir(), "page.tmpl")
+	writeFile(t, templatePath, `{{ define "x" }}{{ "}}" }}{{ end }}{{ template "x" }}{{/* {{ */}}`)
+
+	resp := run(templatePath, "", renderOptions{Mode: "check"})
+	if resp.Error != "" || len(resp.Diagnostics) != 0 {
+		t.Fatalf("expected no diagnostics, got %+v", resp)
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// goldenSuffix marks the expected output of a template: templates/a.tmpl
+// is compared against templates/a.tmpl.golden.
+const goldenSuffix = ".golden"
+
+// checkAllReport is the outcome of `go-worker check-all`. Paths are relative
+// to Root.
+type checkAllReport struct {
+	Root      string           `json:"root"`
+	Templates int              `json:"templates"`
+	Passed    int              `json:"passed"`
+	Failed    int              `json:"failed"`
+	Results   []checkAllResult `json:"results"`
+}
+
+// checkAllResult covers one template: its check diagnostics, the render
+// against its sample context, and the comparison with its golden file.
+type checkAllResult struct {
+	Template    string       `json:"template"`
+	Context     string       `json:"context,omitempty"`
+	Golden      string       `json:"golden,omitempty"`
+	Passed      bool         `json:"passed"`
+	Diagnostics []diagnostic `json:"diagnostics,omitempty"`
+	Error       string       `json:"error,omitempty"`
+	// GoldenDiff is a unified diff from the golden file to the render.
+	GoldenDiff string `json:"goldenDiff,omitempty"`
+}
+
+// runCheckAll implements `go-worker check-all`: it finds every template in
+// the workspace and, in parallel, checks it, renders it against the
+// context the workspace configuration associates with it, and compares the
+// render with its golden file. The process exits non-zero when anything
+// failed; see checkAllExitCode.
+func runCheckAll(args []string) response {
+	flags := flag.NewFlagSet("check-all", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	root := flags.String("root", ".", "Workspace root")
+	configPath := flags.String("config", "", "Project configuration file (defaults to <root>/.vscode/goTemplateStudio.json when present)")
+	jobs := flags.Int("jobs", runtime.NumCPU(), "How many templates to verify at once (defaults to --max-cpus)")
+	strict := flags.Bool("strict", false, "Fail templates with warnings too")
+	funcs := flags.String("funcs", "", "Optional function library to merge over the helpers (sprig)")
+	stubFunctions := flags.String("stub-functions", "", "Comma-separated names, or a JSON manifest, of application functions to stub")
+	helperPlugins := flags.String("helper-plugins", "", "JSON manifest of template functions implemented by subprocesses or WASM modules")
+	lintBaseline := flags.String("lint-baseline", "", "JSON file of accepted check findings to leave out")
+	templateProfile := flags.String("template-profile", "", "Template profile from the project config to check the templates under")
+	cpu := addCPUFlags(flags)
+	var lintPlugins, includes stringListFlag
+	flags.Var(&lintPlugins, "lint-plugin", "Program check mode runs to enforce house lint rules, as a path or a JSON argv array (repeatable)")
+	flags.Var(&includes, "include", "Glob of associated templates, relative to the root, parsed alongside each template (repeatable)")
+	if err := flags.Parse(args); err != nil {
+		return response{Error: "check-all: " + err.Error()}
+	}
+	if err := cpu.apply(); err != nil {
+		return response{Error: "check-all: " + err.Error()}
+	}
+	defaultJobs(flags, jobs)
+	if *jobs < 1 {
+		return response{Error: "check-all: --jobs must be at least 1"}
+	}
+
+	opts := renderOptions{
+		Config:          *configPath,
+		Funcs:           *funcs,
+		StubFunctions:   *stubFunctions,
+		HelperPlugins:   *helperPlugins,
+		LintBaseline:    *lintBaseline,
+		LintPlugins:     lintPlugins,
+		TemplateProfile: *templateProfile,
+	}
+	for _, pattern := range includes {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(*root, pattern)
+		}
+		opts.Includes = append(opts.Includes, pattern)
+	}
+
+	report, err := checkAll(*root, *jobs, *strict, opts)
+	if err != nil {
+		return response{Error: "check-all: " + err.Error()}
+	}
+	return response{CheckAll: report}
+}
+
+// checkAllExitCode is 0 when every template passed, 1 when any failed, and
+// 2 when check-all could not run.
+func checkAllExitCode(resp response) int {
+	switch {
+	case resp.CheckAll == nil:
+		return 2
+	case resp.CheckAll.Failed > 0:
+		return 1
+	}
+	return 0
+}
+
+func checkAll(root string, jobs int, strict bool, opts renderOptions) (*checkAllReport, error) {
+	if opts.Config == "" {
+		for _, candidate := range []string{filepath.Join(root, ".vscode", "goTemplateStudio.json"), filepath.Join(root, initConfigFile)} {
+			if _, err := os.Stat(candidate); err == nil {
+				opts.Config = candidate
+				break
+			}
+		}
+	}
+	config := &projectConfig{root: root}
+	if opts.Config != "" {
+		var err error
+		if config, err = loadProjectConfig(opts.Config); err != nil {
+			return nil, err
+		}
+	}
+
+	templates, err := indexTemplates(root, config.TemplateRoots)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &checkAllReport{Root: root, Templates: len(templates), Results: make([]checkAllResult, len(templates))}
+	var wg sync.WaitGroup
+	next := make(chan int)
+	for worker := 0; worker < min(jobs, len(templates)); worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				report.Results[i] = checkWorkspaceTemplate(root, templates[i], config.DefaultContext[templates[i]], strict, opts)
+			}
+		}()
+	}
+	for i := range templates {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	for _, result := range report.Results {
+		if result.Passed {
+			report.Passed++
+		} else {
+			report.Failed++
+		}
+	}
+	return report, nil
+}
+
+// indexTemplates lists the templates under the workspace's template roots,
+// relative to root with forward slashes, like the extension's settings.
+func indexTemplates(root string, templateRoots []string) ([]string, error) {
+	if len(templateRoots) == 0 {
+		templateRoots = []string{"templates"}
+	}
+	seen := map[string]bool{}
+	var templates []string
+	for _, templateRoot := range templateRoots {
+		dir := filepath.Join(root, filepath.FromSlash(templateRoot))
+		files, err := collectDirFiles(dir)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			if _, ok := trimTemplateSuffix(file); !ok {
+				continue
+			}
+			relative := filepath.ToSlash(filepath.Join(templateRoot, file))
+			if !seen[relative] {
+				seen[relative] = true
+				templates = append(templates, relative)
+			}
+		}
+	}
+	sort.Strings(templates)
+	return templates, nil
+}
+
+func checkWorkspaceTemplate(root, template, context string, strict bool, opts renderOptions) checkAllResult {
+	result := checkAllResult{Template: template, Context: context}
+	templatePath := filepath.Join(root, filepath.FromSlash(template))
+
+	checkOpts := opts
+	checkOpts.Mode = "check"
+	checked := run(templatePath, "", checkOpts)
+	result.Diagnostics = checked.Diagnostics
+	result.Error = checked.Error
+
+	goldenPath := templatePath + goldenSuffix
+	golden, goldenErr := os.ReadFile(goldenPath)
+	if goldenErr == nil {
+		result.Golden = template + goldenSuffix
+	}
+
+	if result.Error == "" && (context != "" || goldenErr == nil) {
+		contextPath := ""
+		if context != "" {
+			contextPath = filepath.Join(root, filepath.FromSlash(context))
+		}
+		renderOpts := opts
+		renderOpts.Mode = "render"
+		rendered := run(templatePath, contextPath, renderOpts)
+		result.Diagnostics = appendNewDiagnostics(result.Diagnostics, rendered.Diagnostics)
+		result.Error = rendered.Error
+		if rendered.Error == "" && goldenErr == nil {
+			result.GoldenDiff = unifiedDiff(result.Golden, template, string(golden), rendered.Rendered)
+		}
+	}
+
+	result.Passed = result.Error == "" && result.GoldenDiff == ""
+	for _, diag := range result.Diagnostics {
+		if diag.Severity == "error" || strict {
+			result.Passed = false
+		}
+	}
+	if !result.Passed && result.Error == "" && result.GoldenDiff != "" {
+		result.Error = fmt.Sprintf("output differs from %s", result.Golden)
+	}
+	return result
+}
+
+// appendNewDiagnostics adds the render's diagnostics that check mode did
+// not already report, such as missing keys.
+func appendNewDiagnostics(diagnostics, more []diagnostic) []diagnostic {
+	seen := map[string]bool{}
+	key := func(diag diagnostic) string {
+		return strings.Join([]string{diag.Rule, diag.Severity, diag.Message, diag.File, fmt.Sprint(diag.Line, ":", diag.Column)}, "\x00")
+	}
+	for _, diag := range diagnostics {
+		seen[key(diag)] = true
+	}
+	for _, diag := range more {
+		if !seen[key(diag)] {
+			diagnostics = append(diagnostics, diag)
+		}
+	}
+	return diagnostics
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckAllVerifiesEveryWorkspaceTemplate(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, ".vscode", "goTemplateStudio.json"), `{
+		"templateRoots": ["templates", "mail"],
+		"defaultContext": {"templates/greet.tmpl": "context/ada.json", "mail/welcome.gotmpl": "context/ada.json"}
+	}`)
+	writeFile(t, filepath.Join(root, "context", "ada.json"), `{"name": "Ada"}`)
+	writeFile(t, filepath.Join(root, "templates", "greet.tmpl"), "Hello {{ .name }}\n")
+	writeFile(t, filepath.Join(root, "templates", "greet.tmpl.golden"), "Hello Ada\n")
+	writeFile(t, filepath.Join(root, "templates", "partials", "footer.tpl"), "{{ shout . }}")
+	writeFile(t, filepath.Join(root, "templates", "README.md"), "not a template")
+	writeFile(t, filepath.Join(root, "mail", "welcome.gotmpl"), "Welcome {{ .name }}\n")
+	writeFile(t, filepath.Join(root, "mail", "welcome.gotmpl.golden"), "Welcome, Ada\n")
+
+	resp := runCheckAll([]string{"--root", root, "--jobs", "2"})
+	report := resp.CheckAll
+	if resp.Error != "" || report == nil {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	if report.Templates != 3 || report.Passed != 1 || report.Failed != 2 || checkAllExitCode(resp) != 1 {
+		t.Fatalf("unexpected totals: %+v", report)
+	}
+
+	welcome, greet, footer := report.Results[0], report.Results[1], report.Results[2]
+	if welcome.Template != "mail/welcome.gotmpl" || welcome.Passed || !strings.Contains(welcome.GoldenDiff, "+Welcome Ada") {
+		t.Fatalf("expected a golden mismatch for the welcome mail, got %+v", welcome)
+	}
+	if greet.Template != "templates/greet.tmpl" || !greet.Passed || greet.Context != "context/ada.json" || greet.Golden != "templates/greet.tmpl.golden" {
+		t.Fatalf("expected the greeting to pass, got %+v", greet)
+	}
+	if footer.Template != "templates/partials/footer.tpl" || footer.Passed || len(footer.Diagnostics) != 1 || footer.Diagnostics[0].Rule != "unknown-function" {
+		t.Fatalf("expected the footer to fail its check, got %+v", footer)
+	}
+
+	resp = runCheckAll([]string{"--root", root, "--stub-functions", "shout"})
+	if resp.CheckAll.Failed != 1 {
+		t.Fatalf("expected stubbing shout to fix the footer, got %+v", resp.CheckAll)
+	}
+}
+
+func TestCheckAllStrictFailsOnWarnings(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "templates", "shadow.tmpl"), "{{ $x := 1 }}{{ with . }}{{ $x := 2 }}{{ end }}")
+
+	if resp := runCheckAll([]string{"--root", root}); checkAllExitCode(resp) != 0 {
+		t.Fatalf("expected warnings to pass, got %+v", resp.CheckAll)
+	}
+	if resp := runCheckAll([]string{"--root", root, "--strict"}); checkAllExitCode(resp) != 1 {
+		t.Fatalf("expected --strict to fail on warnings, got %+v", resp.CheckAll)
+	}
+	if resp := runCheckAll([]string{"--jobs", "0"}); checkAllExitCode(resp) != 2 || resp.Error == "" {
+		t.Fatalf("expected a usage error, got %+v", resp)
+	}
+}
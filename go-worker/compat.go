@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template/parse"
+)
+
+// goVersion is a Go release identified by its minor version, e.g. 1.21.
+type goVersion struct {
+	Major int
+	Minor int
+}
+
+func (v goVersion) String() string {
+	return fmt.Sprintf("%d.%d", v.Major, v.Minor)
+}
+
+func (v goVersion) Less(other goVersion) bool {
+	if v.Major != other.Major {
+		return v.Major < other.Major
+	}
+	return v.Minor < other.Minor
+}
+
+var goVersionPattern = regexp.MustCompile(`^(?:go)?(\d+)\.(\d+)(?:\.\d+)?$`)
+
+// parseGoVersion accepts "1.21", "go1.21", and "1.21.3".
+func parseGoVersion(value string) (goVersion, error) {
+	matches := goVersionPattern.FindStringSubmatch(strings.TrimSpace(value))
+	if matches == nil {
+		return goVersion{}, fmt.Errorf("invalid Go version %q: expected a release such as 1.21", value)
+	}
+
+	major, _ := strconv.Atoi(matches[1])
+	minor, _ := strconv.Atoi(matches[2])
+	return goVersion{Major: major, Minor: minor}, nil
+}
+
+// compatRule flags a template construct introduced in a specific Go release.
+type compatRule struct {
+	Since       goVersion
+	Description string
+	Find        func(actions []actionSpan, trees map[string]*parse.Tree) []parse.Pos
+}
+
+var compatRules = []compatRule{
+	{
+		Since:       goVersion{1, 16},
+		Description: "newlines inside actions",
+		Find:        findMultilineActions,
+	},
+	{
+		Since:       goVersion{1, 18},
+		Description: "{{break}} and {{continue}}",
+		Find:        findLoopControl,
+	},
+	{
+		Since:       goVersion{1, 23},
+		Description: "{{else with}} chains",
+		Find:        findElseWith,
+	},
+	{
+		Since:       goVersion{1, 24},
+		Description: "ranges over integers",
+		Find:        findIntegerRanges,
+	},
+}
+
+// compatDiagnostics reports constructs the target Go release cannot parse,
+// reading the template with the delimiters of opts.
+func compatDiagnostics(templatePath, content string, target goVersion, opts renderOptions) []diagnostic {
+	trees, err := parseTreesWithDelims(templatePath, content, opts.LeftDelim, opts.RightDelim)
+	if err != nil {
+		return nil
+	}
+	actions := scanActions(content, opts.LeftDelim, opts.RightDelim)
+
+	var diagnostics []diagnostic
+	for _, rule := range compatRules {
+		if !target.Less(rule.Since) {
+			continue
+		}
+		for _, pos := range rule.Find(actions, trees) {
+			line, column := lineColumn(content, pos)
+			diagnostics = append(diagnostics, diagnostic{
+				Message:  fmt.Sprintf("%s require Go %s or newer (target is Go %s)", rule.Description, rule.Since, target),
+				Severity: "error",
+				File:     templatePath,
+				Line:     line,
+				Column:   column,
+			})
+		}
+	}
+
+	return diagnostics
+}
+
+func findMultilineActions(actions []actionSpan, _ map[string]*parse.Tree) []parse.Pos {
+	var positions []parse.Pos
+	for _, action := range actions {
+		if !action.IsComment() && strings.Contains(action.Inner, "\n") {
+			positions = append(positions, parse.Pos(action.Start))
+		}
+	}
+	return positions
+}
+
+var elseWithPattern = regexp.MustCompile(`^else\s+with\b`)
+
+func findElseWith(actions []actionSpan, _ map[string]*parse.Tree) []parse.Pos {
+	var positions []parse.Pos
+	for _, action := range actions {
+		if elseWithPattern.MatchString(action.Body()) {
+			positions = append(positions, parse.Pos(action.Start))
+		}
+	}
+	return positions
+}
+
+func findLoopControl(_ []actionSpan, trees map[string]*parse.Tree) []parse.Pos {
+	var positions []parse.Pos
+	for _, tree := range trees {
+		walkNodes(tree.Root, func(node parse.Node) bool {
+			switch node.(type) {
+			case *parse.BreakNode, *parse.ContinueNode:
+				positions = append(positions, node.Position())
+			}
+			return true
+		})
+	}
+	return sortPositions(positions)
+}
+
+// findIntegerRanges flags `range 5` style loops. Ranges over context values
+// cannot be checked statically; JSON numbers decode as floats, which no Go
+// release can range over.
+func findIntegerRanges(_ []actionSpan, trees map[string]*parse.Tree) []parse.Pos {
+	var positions []parse.Pos
+	for _, tree := range trees {
+		walkNodes(tree.Root, func(node parse.Node) bool {
+			rangeNode, ok := node.(*parse.RangeNode)
+			if !ok || rangeNode.Pipe == nil || len(rangeNode.Pipe.Cmds) != 1 {
+				return true
+			}
+			args := rangeNode.Pipe.Cmds[0].Args
+			if len(args) == 1 {
+				if number, ok := args[0].(*parse.NumberNode); ok && number.IsInt {
+					positions = append(positions, rangeNode.Position())
+				}
+			}
+			return true
+		})
+	}
+	return sortPositions(positions)
+}
+
+func sortPositions(positions []parse.Pos) []parse.Pos {
+	sort.Slice(positions, func(i, j int) bool { return positions[i] < positions[j] })
+	return positions
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseGoVersion(t *testing.T) {
+	for _, input := range []string{"1.21", "go1.21", "1.21.4"} {
+		version, err := parseGoVersion(input)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", input, err)
+		}
+		if version != (goVersion{1, 21}) {
+			t.Fatalf("unexpected version for %q: %v", input, version)
+		}
+	}
+
+	if _, err := parseGoVersion("latest"); err == nil {
+		t.Fatal("expected error for invalid version")
+	}
+}
+
+func TestCompatDiagnostics(t *testing.T) {
+	content := "{{ with .a }}a{{ else with .b }}b{{ end }}{{ .c\n}}"
+
+	diagnostics := compatDiagnostics("page.tmpl", content, goVersion{1, 15}, renderOptions{})
+	if len(diagnostics) != 2 {
+		t.Fatalf("expected two diagnostics, got %+v", diagnostics)
+	}
+
+	if diagnostics := compatDiagnostics("page.tmpl", content, goVersion{1, 21}, renderOptions{}); len(diagnostics) != 1 || !strings.Contains(diagnostics[0].Message, "Go 1.23") {
+		t.Fatalf("expected else-with diagnostic only, got %+v", diagnostics)
+	}
+
+	if diagnostics := compatDiagnostics("page.tmpl", content, goVersion{1, 23}, renderOptions{}); len(diagnostics) != 0 {
+		t.Fatalf("expected no diagnostics for current target, got %+v", diagnostics)
+	}
+}
+
+func TestExecuteWithGoCompatFailsOnUnsupportedConstructs(t *testing.T) {
+	templatePath := filepath.Join(t.TempDir(), "page.tmpl")
+	if err := os.WriteFile(templatePath, []byte("{{ with .a }}{{ else with .b }}{{ end }}"), 0o600); err != nil {
+		t.Fatalf("failed to write template file: %v", err)
+	}
+
+	resp := executeWithOptions(templatePath, "", renderOptions{GoCompat: "1.21"})
+	if !strings.Contains(resp.Error, "Go 1.21") {
+		t.Fatalf("expected compat error, got %+v", resp)
+	}
+	if len(resp.Diagnostics) != 1 || resp.Diagnostics[0].Line != 1 || resp.Diagnostics[0].Column != 14 {
+		t.Fatalf("unexpected diagnostics: %+v", resp.Diagnostics)
+	}
+
+	if resp := executeWithOptions(templatePath, "", renderOptions{GoCompat: "nope"}); resp.Error == "" {
+		t.Fatal("expected invalid version to be rejected")
+	}
+}
+
+func TestCompatDiagnosticsLoopControlAndIntegerRanges(t *testing.T) {
+	content := "{{ range .items }}{{ if . }}{{ break }}{{ end }}{{ continue }}{{ end }}{{ range $i := 3 }}{{ $i }}{{ end }}"
+
+	diagnostics := compatDiagnostics("page.tmpl", content, goVersion{1, 17}, renderOptions{})
+	if len(diagnostics) != 3 {
+		t.Fatalf("expected break, continue, and integer range diagnostics, got %+v", diagnostics)
+	}
+	if !strings.Contains(diagnostics[0].Message, "Go 1.18") || diagnostics[0].Column != 32 {
+		t.Fatalf("unexpected break diagnostic: %+v", diagnostics[0])
+	}
+	if !strings.Contains(diagnostics[2].Message, "Go 1.24") {
+		t.Fatalf("unexpected range diagnostic: %+v", diagnostics[2])
+	}
+
+	if diagnostics := compatDiagnostics("page.tmpl", content, goVersion{1, 21}, renderOptions{}); len(diagnostics) != 1 || !strings.Contains(diagnostics[0].Message, "integers") {
+		t.Fatalf("expected only integer range diagnostic for Go 1.21, got %+v", diagnostics)
+	}
+	// text/template only learned to range over integers in Go 1.24.
+	if diagnostics := compatDiagnostics("page.tmpl", content, goVersion{1, 23}, renderOptions{}); len(diagnostics) != 1 || !strings.Contains(diagnostics[0].Message, "integers") {
+		t.Fatalf("expected the integer range to be flagged for Go 1.23, got %+v", diagnostics)
+	}
+	if diagnostics := compatDiagnostics("page.tmpl", content, goVersion{1, 24}, renderOptions{}); len(diagnostics) != 0 {
+		t.Fatalf("expected no diagnostics for Go 1.24, got %+v", diagnostics)
+	}
+}
+
+func TestCompatDiagnosticsHonorDelimiters(t *testing.T) {
+	content := "[[ range .items ]][[ break ]][[ end ]][[ with .a ]][[ else with .b ]][[ end ]]"
+	opts := renderOptions{LeftDelim: "[[", RightDelim: "]]"}
+
+	diagnostics := compatDiagnostics("page.tmpl", content, goVersion{1, 17}, opts)
+	if len(diagnostics) != 2 || !strings.Contains(diagnostics[0].Message, "break") || diagnostics[0].Column != 22 ||
+		!strings.Contains(diagnostics[1].Message, "else with") || diagnostics[1].Column != 52 {
+		t.Fatalf("expected break and else-with diagnostics, got %+v", diagnostics)
+	}
+
+	templatePath := filepath.Join(t.TempDir(), "page.tmpl")
+	writeFile(t, templatePath, "[[ range .items ]][[ break ]][[ end ]]")
+	opts.GoCompat = "1.17"
+	if resp := run(templatePath, "", opts); !strings.Contains(resp.Error, "Go 1.17") || len(resp.Diagnostics) != 1 {
+		t.Fatalf("expected the render to fail on break, got %+v", resp)
+	}
+}
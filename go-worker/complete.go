@@ -0,0 +1,296 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/template/parse"
+)
+
+// cursorMarkerFunc stands in for the action being typed when complete mode
+// parses the template up to the cursor.
+const cursorMarkerFunc = "__goTemplateStudioCursor"
+
+// Completion kinds.
+const (
+	completionField    = "field"
+	completionVariable = "variable"
+	completionFunction = "function"
+	completionKeyword  = "keyword"
+)
+
+// templateKeywords are the action keywords offered at the start of an
+// action.
+var templateKeywords = []string{"block", "break", "continue", "define", "else", "end", "if", "range", "template", "with"}
+
+// completionList holds the candidates for the word being typed. Line,
+// Column, and EndColumn span the part of the word the candidates replace.
+type completionList struct {
+	Line      int              `json:"line"`
+	Column    int              `json:"column"`
+	EndColumn int              `json:"endColumn"`
+	Items     []completionItem `json:"items"`
+}
+
+// completionItem is one candidate. Detail is a field's kind or a function's
+// signature.
+type completionItem struct {
+	Label  string `json:"label"`
+	Kind   string `json:"kind"`
+	Detail string `json:"detail,omitempty"`
+	Doc    string `json:"doc,omitempty"`
+}
+
+// executeComplete suggests what may follow the cursor inside an action:
+// fields of the value a dotted path reaches from dot or a variable,
+// variables in scope after $, and otherwise functions and keywords. Dot is
+// followed through range and with using the context's shape. The cursor is
+// given as --line/--column or, when no line is set, --offset; opts.Source,
+// when set, is the unsaved editor text to complete in place of the file.
+func executeComplete(templatePath, contextPath string, opts renderOptions) response {
+	if templatePath == "" {
+		return response{Error: "template path is required"}
+	}
+
+	content := opts.Source
+	if content == "" {
+		var err error
+		if content, err = readTemplate(templatePath, opts); err != nil {
+			return response{Error: err.Error()}
+		}
+	}
+	opts.reads.record(templatePath, content)
+
+	offset := opts.Offset
+	if opts.Line > 0 {
+		var err error
+		if offset, err = cursorOffset(content, opts); err != nil {
+			return response{Error: err.Error()}
+		}
+	} else if offset < 0 || offset > len(content) {
+		return response{Error: fmt.Sprintf("offset %d is outside the document (length %d)", offset, len(content))}
+	}
+
+	actionStart, typed, ok := actionBeforeCursor(content[:offset], opts.LeftDelim, opts.RightDelim)
+	if !ok {
+		return response{}
+	}
+	word := trailingWord(typed)
+
+	var (
+		items   []completionItem
+		partial = word
+	)
+	if strings.HasPrefix(word, ".") || strings.HasPrefix(word, "$") {
+		data, err := loadContextWithOptions(contextPath, opts)
+		if err != nil {
+			return contextFailure(contextPath, err)
+		}
+		env, err := scopeAt(templatePath, content[:actionStart], data, opts)
+		if err != nil {
+			return response{
+				Diagnostics: []diagnostic{templateDiagnostic(err, templatePath, content)},
+				Error:       err.Error(),
+			}
+		}
+		items, partial = pathCompletions(word, env)
+	} else {
+		if strings.TrimSpace(opts.FuncsFrom) != "" && opts.funcProfile == nil {
+			if profile, err := loadFuncProfile(opts.FuncsFrom, opts.FuncFakes); err == nil {
+				opts.funcProfile = profile
+			}
+		}
+		funcs, err := templateFuncs(templatePath, opts)
+		if err != nil {
+			return response{Error: err.Error()}
+		}
+		items = funcCompletions(word, funcs, opts)
+		if strings.TrimSpace(strings.TrimSuffix(typed, word)) == "" {
+			for _, keyword := range templateKeywords {
+				if strings.HasPrefix(keyword, word) {
+					items = append(items, completionItem{Label: keyword, Kind: completionKeyword})
+				}
+			}
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].Label < items[j].Label })
+
+	start, _ := offsetToPosition(content, offset-len(partial))
+	text := lineText(content, start.Line)
+	return response{Completion: &completionList{
+		Line:      start.Line,
+		Column:    encodeColumn(text, start.Column, opts.PositionEncoding),
+		EndColumn: encodeColumn(text, start.Column+len(partial), opts.PositionEncoding),
+		Items:     items,
+	}}
+}
+
+// actionBeforeCursor finds the action the cursor is in, which may not be
+// closed yet, and returns where it starts and the text typed so far.
+// Cursors in text, comments, or string literals are not in an action.
+func actionBeforeCursor(before, leftDelim, rightDelim string) (int, string, bool) {
+	if leftDelim == "" {
+		leftDelim = defaultLeftDelim
+	}
+	if rightDelim == "" {
+		rightDelim = defaultRightDelim
+	}
+
+	// The open action is the first one after the last closed action.
+	from := 0
+	if spans := scanActions(before, leftDelim, rightDelim); len(spans) > 0 {
+		from = spans[len(spans)-1].End
+	}
+	start := strings.Index(before[from:], leftDelim)
+	if start < 0 {
+		return 0, "", false
+	}
+	start += from
+	innerStart := start + len(leftDelim)
+	if strings.HasPrefix(before[innerStart:], "- ") {
+		innerStart += 2
+	}
+
+	typed := before[innerStart:]
+	if strings.HasPrefix(strings.TrimSpace(typed), "/*") || strings.Count(typed, `"`)%2 == 1 || strings.Count(typed, "`")%2 == 1 {
+		return 0, "", false
+	}
+	return start, typed, true
+}
+
+// trailingWord returns the identifier, field path, or variable path that
+// ends typed, such as ".user.na" or "$item.".
+func trailingWord(typed string) string {
+	start := len(typed)
+	for start > 0 {
+		c := typed[start-1]
+		if c != '.' && c != '$' && c != '_' && !('a' <= c && c <= 'z') && !('A' <= c && c <= 'Z') && !('0' <= c && c <= '9') {
+			break
+		}
+		start--
+	}
+	return typed[start:]
+}
+
+// scopeAt returns the scope an action appended to prefix would run in. The
+// prefix is closed with a marker action and one end per open block, then
+// type-checked against the shape of data.
+func scopeAt(templatePath, prefix string, data interface{}, opts renderOptions) (typeEnv, error) {
+	depth := 0
+	for _, action := range scanActions(prefix, opts.LeftDelim, opts.RightDelim) {
+		switch action.Keyword() {
+		case "if", "range", "with", "define", "block":
+			depth++
+		case "end":
+			depth--
+		}
+	}
+
+	left, right := opts.LeftDelim, opts.RightDelim
+	if left == "" {
+		left = defaultLeftDelim
+	}
+	if right == "" {
+		right = defaultRightDelim
+	}
+	source := prefix + left + cursorMarkerFunc + right + strings.Repeat(left+"end"+right, max(depth, 0))
+
+	name := templateName(templatePath)
+	trees, err := parseTreesWithDelims(name, source, opts.LeftDelim, opts.RightDelim)
+	if err != nil {
+		return typeEnv{}, err
+	}
+
+	var found typeEnv
+	checker := &typeChecker{templatePath: templatePath, content: source}
+	checker.onAction = func(action *parse.ActionNode, env typeEnv) {
+		if isCursorMarker(action) {
+			found = env
+		}
+	}
+	root := typeOfValue(data)
+	for _, treeName := range sortedTreeNames(trees, name) {
+		dot := root
+		if treeName != name {
+			dot = nil
+		}
+		checker.list(trees[treeName].Root, typeEnv{dot: dot, vars: map[string]*valueType{"$": dot}})
+	}
+	return found, nil
+}
+
+func isCursorMarker(action *parse.ActionNode) bool {
+	if len(action.Pipe.Cmds) != 1 || len(action.Pipe.Cmds[0].Args) != 1 {
+		return false
+	}
+	ident, ok := action.Pipe.Cmds[0].Args[0].(*parse.IdentifierNode)
+	return ok && ident.Ident == cursorMarkerFunc
+}
+
+// pathCompletions completes a word starting with . or $ and returns the
+// items along with the partial segment they replace.
+func pathCompletions(word string, env typeEnv) ([]completionItem, string) {
+	segments := strings.Split(word, ".")
+	partial := segments[len(segments)-1]
+
+	var base *valueType
+	switch {
+	case segments[0] == "":
+		base = fieldType(env.dot, segments[1:len(segments)-1])
+	case len(segments) == 1:
+		var items []completionItem
+		for name, value := range env.vars {
+			if strings.HasPrefix(name, partial) {
+				items = append(items, completionItem{Label: name, Kind: completionVariable, Detail: kindDetail(value)})
+			}
+		}
+		return items, partial
+	default:
+		variable, ok := env.vars[segments[0]]
+		if !ok {
+			return nil, partial
+		}
+		base = fieldType(variable, segments[1:len(segments)-1])
+	}
+
+	if base == nil || base.Kind != kindMap {
+		return nil, partial
+	}
+	var items []completionItem
+	for name, value := range base.Fields {
+		if strings.HasPrefix(name, partial) {
+			items = append(items, completionItem{Label: name, Kind: completionField, Detail: kindDetail(value)})
+		}
+	}
+	return items, partial
+}
+
+// funcCompletions lists the functions starting with prefix, documented as
+// a hover would document them.
+func funcCompletions(prefix string, funcs map[string]interface{}, opts renderOptions) []completionItem {
+	names := map[string]bool{}
+	for name := range builtinFuncDocs {
+		names[name] = true
+	}
+	for name := range funcs {
+		names[name] = true
+	}
+
+	var items []completionItem
+	for name := range names {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if doc, ok := describeFunc(name, funcs, opts); ok {
+			items = append(items, completionItem{Label: name, Kind: completionFunction, Detail: doc.Signature, Doc: doc.Doc})
+		}
+	}
+	return items
+}
+
+func kindDetail(value *valueType) string {
+	if value == nil {
+		return ""
+	}
+	return value.Kind
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func completionLabels(resp response) []string {
+	var labels []string
+	if resp.Completion != nil {
+		for _, item := range resp.Completion.Items {
+			labels = append(labels, item.Label)
+		}
+	}
+	return labels
+}
+
+func TestCompleteFollowsDotThroughRangeAndWith(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "page.tmpl")
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, templatePath, "")
+	writeFile(t, contextPath, `{"user": {"name": "Ada", "email": "ada@example.com"}, "items": [{"sku": "A1", "qty": 2}]}`)
+
+	tests := []struct {
+		name   string
+		source string
+		want   []string
+	}{
+		{"root", "Hi {{ .", []string{"items", "user"}},
+		{"nested prefix", "{{ .user.na", []string{"name"}},
+		{"range", "{{ range .items }}\n  {{ .", []string{"qty", "sku"}},
+		{"with variable", "{{ with .user }}{{ $u := . }}{{ if true }}{{ $u.", []string{"email", "name"}},
+		{"after end", "{{ range .items }}{{ .sku }}{{ end }}{{ .u", []string{"user"}},
+		{"variables", "{{ range $i, $item := .items }}{{ $", []string{"$", "$i", "$item"}},
+		{"range variable fields", "{{ range $item := .items }}{{ $item.s", []string{"sku"}},
+		{"root variable", "{{ range .items }}{{ $.u", []string{"user"}},
+		{"unknown field", "{{ .missing.", nil},
+	}
+	for _, test := range tests {
+		resp := run(templatePath, contextPath, renderOptions{Mode: "complete", Source: test.source, Offset: len(test.source)})
+		if resp.Error != "" || resp.Completion == nil {
+			t.Fatalf("%s: unexpected response %+v", test.name, resp)
+		}
+		if got := completionLabels(resp); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+
+	resp := run(templatePath, contextPath, renderOptions{Mode: "complete", Source: "{{ .user.na }}", Line: 1, Column: 12})
+	if list := resp.Completion; list == nil || list.Line != 1 || list.Column != 10 || list.EndColumn != 12 || list.Items[0].Kind != completionField || list.Items[0].Detail != kindString {
+		t.Fatalf("unexpected completion span: %+v", resp)
+	}
+}
+
+func TestCompleteSuggestsFunctionsAndKeywords(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "page.tmpl")
+	writeFile(t, templatePath, "{{ .name | jo }}")
+
+	resp := run(templatePath, "", renderOptions{Mode: "complete", Offset: 13})
+	if got := completionLabels(resp); !reflect.DeepEqual(got, []string{"join"}) || resp.Completion.Items[0].Detail != "join separator list" {
+		t.Fatalf("unexpected function completions: %+v", resp)
+	}
+
+	resp = run(templatePath, "", renderOptions{Mode: "complete", Source: "{{ rang", Offset: 7})
+	if got := completionLabels(resp); !reflect.DeepEqual(got, []string{"range"}) || resp.Completion.Items[0].Kind != completionKeyword {
+		t.Fatalf("expected the range keyword, got %+v", resp)
+	}
+
+	resp = run(templatePath, "", renderOptions{Mode: "complete", Source: "{{ .name | rang", Offset: 15})
+	if got := completionLabels(resp); len(got) != 0 {
+		t.Fatalf("expected no keywords mid-pipeline, got %v", got)
+	}
+
+	for _, source := range []string{"plain text", "{{ .a }} text", `{{ printf "{{ .`, "{{/* ."} {
+		resp = run(templatePath, "", renderOptions{Mode: "complete", Source: source, Offset: len(source)})
+		if resp.Completion != nil || resp.Error != "" {
+			t.Errorf("%q: expected no completions outside an action, got %+v", source, resp)
+		}
+	}
+}
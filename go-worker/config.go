@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// projectConfig is the subset of .vscode/goTemplateStudio.json the worker
+// understands. Unknown keys belong to the extension and are ignored.
+type projectConfig struct {
+	TemplateAliases map[string]string `json:"templateAliases,omitempty"`
+	// LintRules sets the severity of findings by rule id: error, warning,
+	// or off; see lint.go.
+	LintRules map[string]string `json:"lintRules,omitempty"`
+	// TemplateRoots and DefaultContext are the extension's settings for
+	// where templates live and which context each previews with, as
+	// workspace-relative paths; check-all reads them.
+	TemplateRoots  []string          `json:"templateRoots,omitempty"`
+	DefaultContext map[string]string `json:"defaultContext,omitempty"`
+	// Includes are globs, or directories standing for every file in them,
+	// parsed alongside every template after the --include globs.
+	Includes []string `json:"includes,omitempty"`
+	// TemplateProfiles are named template variants, such as per-environment
+	// overrides, selected with --template-profile; see templateprofile.go.
+	TemplateProfiles map[string]templateProfile `json:"templateProfiles,omitempty"`
+
+	// root is the directory relative paths in the config resolve against.
+	root string
+}
+
+// loadProjectConfig reads a project configuration file, JSON or, for a
+// .yaml or .yml file, YAML. Relative paths in the file resolve against the
+// workspace root: the parent of a `.vscode` directory, or otherwise the
+// directory holding the file.
+func loadProjectConfig(path string) (*projectConfig, error) {
+	configBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if ext := strings.ToLower(filepath.Ext(path)); ext == ".yaml" || ext == ".yml" {
+		// YAML, as go-worker init writes, is read through JSON so the keys
+		// are the same.
+		var value interface{}
+		if err := yaml.Unmarshal(configBytes, &value); err != nil {
+			return nil, fmt.Errorf("failed to parse project config YAML: %w", err)
+		}
+		if configBytes, err = json.Marshal(stringKeyedMaps(value)); err != nil {
+			return nil, fmt.Errorf("project config cannot be represented as JSON: %w", err)
+		}
+	}
+
+	var config projectConfig
+	if err := json.Unmarshal(configBytes, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse project config JSON: %w", err)
+	}
+
+	config.root = filepath.Dir(path)
+	if filepath.Base(config.root) == ".vscode" {
+		config.root = filepath.Dir(config.root)
+	}
+
+	for alias, target := range config.TemplateAliases {
+		if !strings.HasPrefix(alias, "@") {
+			return nil, fmt.Errorf("template alias %q must start with @", alias)
+		}
+		config.TemplateAliases[alias] = config.resolvePath(target)
+	}
+	if err := validateLintRules(config.LintRules); err != nil {
+		return nil, err
+	}
+	for i, include := range config.Includes {
+		config.Includes[i] = config.resolveIncludeGlob(include)
+	}
+	for name, profile := range config.TemplateProfiles {
+		for i, include := range profile.Includes {
+			profile.Includes[i] = config.resolveIncludeGlob(include)
+		}
+		config.TemplateProfiles[name] = profile
+	}
+
+	return &config, nil
+}
+
+func (c *projectConfig) resolvePath(path string) string {
+	if isRemoteURL(path) {
+		return path
+	}
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(c.root, path)
+}
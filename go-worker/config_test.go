@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadProjectConfigResolvesAliasesFromWorkspaceRoot(t *testing.T) {
+	root := t.TempDir()
+	configDir := filepath.Join(root, ".vscode")
+	if err := os.MkdirAll(configDir, 0o755); err != nil {
+		t.Fatalf("failed to create config dir: %v", err)
+	}
+
+	configPath := filepath.Join(configDir, "goTemplateStudio.json")
+	content := `{"contextDirs":["context"],"templateAliases":{"@shared":"../shared-templates","@abs":"/opt/templates"}}`
+	if err := os.WriteFile(configPath, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	config, err := loadProjectConfig(configPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if expected := filepath.Join(filepath.Dir(root), "shared-templates"); config.TemplateAliases["@shared"] != expected {
+		t.Fatalf("expected %s, got %s", expected, config.TemplateAliases["@shared"])
+	}
+	if config.TemplateAliases["@abs"] != "/opt/templates" {
+		t.Fatalf("expected absolute alias to be preserved, got %s", config.TemplateAliases["@abs"])
+	}
+}
+
+func TestLoadProjectConfigRejectsInvalidInput(t *testing.T) {
+	dir := t.TempDir()
+
+	invalidJSON := filepath.Join(dir, "invalid.json")
+	if err := os.WriteFile(invalidJSON, []byte("{"), 0o600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	if _, err := loadProjectConfig(invalidJSON); err == nil {
+		t.Fatal("expected JSON error")
+	}
+
+	badAlias := filepath.Join(dir, "alias.json")
+	if err := os.WriteFile(badAlias, []byte(`{"templateAliases":{"shared":"x"}}`), 0o600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	if _, err := loadProjectConfig(badAlias); err == nil {
+		t.Fatal("expected alias prefix error")
+	}
+}
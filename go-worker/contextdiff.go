@@ -0,0 +1,368 @@
+package main
+
+import (
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template/parse"
+)
+
+// contextDiffReport explains how the output changes between two contexts:
+// which context values differ, and for each changed region of the output,
+// the differing values the template nodes that wrote it read.
+type contextDiffReport struct {
+	Changes []contextChange     `json:"changes"`
+	Regions []contextDiffRegion `json:"regions"`
+	// Diff is a unified diff from the output for --context to the output
+	// for --compare-context.
+	Diff string `json:"diff,omitempty"`
+}
+
+// contextChange is one value that differs between the contexts. Paths
+// are written like analyze mode's, with array indexes: .items[2].title.
+// Before is absent for added values and After for removed ones.
+type contextChange struct {
+	Path   string          `json:"path"`
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+}
+
+// contextDiffRegion is a run of changed output lines: OldLines lines from
+// OldStart in the first output replaced by NewLines lines from NewStart in
+// the second, both 1-based. Causes are the changed paths read by the Nodes
+// that wrote those lines, or by the if, with, and range blocks around
+// them; it is empty when the change comes from elsewhere, such as a
+// function returning the time.
+type contextDiffRegion struct {
+	OldStart int              `json:"oldStart"`
+	OldLines int              `json:"oldLines"`
+	NewStart int              `json:"newStart"`
+	NewLines int              `json:"newLines"`
+	Removed  []string         `json:"removed,omitempty"`
+	Added    []string         `json:"added,omitempty"`
+	Causes   []string         `json:"causes,omitempty"`
+	Nodes    []sourceLocation `json:"nodes,omitempty"`
+}
+
+// arrayIndex matches the indexes of a change path, which analysis writes
+// as [] for any element.
+var arrayIndex = regexp.MustCompile(`\[\d+\]`)
+
+// executeContextDiff renders the template against contextPath and against
+// opts.CompareContext and attributes each changed region of the output to
+// the context values responsible, using the source map of both renders and
+// the fields analysis finds each node reading.
+func executeContextDiff(templatePath, contextPath string, opts renderOptions) response {
+	if templatePath == "" {
+		return response{Error: "template path is required"}
+	}
+	if strings.TrimSpace(opts.CompareContext) == "" {
+		return response{Error: "context-diff requires --compare-context"}
+	}
+	content, err := readTemplate(templatePath, opts)
+	if err != nil {
+		return response{Error: err.Error()}
+	}
+	name := templateName(templatePath)
+	trees, _, _, failure := parseTemplateSet(templatePath, name, content, opts)
+	if failure != nil {
+		return *failure
+	}
+
+	before, err := loadContextWithOptions(contextPath, opts)
+	if err != nil {
+		return contextFailure(contextPath, err)
+	}
+	// Layers belong to --context; the compare context stands alone.
+	compareOpts := opts
+	compareOpts.ContextLayers = nil
+	after, err := loadContextWithOptions(opts.CompareContext, compareOpts)
+	if err != nil {
+		return contextFailure(opts.CompareContext, err)
+	}
+	// The renders anonymize their contexts, so the changes must too.
+	if opts.Anonymize {
+		before, after = anonymizeContext(before), anonymizeContext(after)
+	}
+
+	renderOpts := opts
+	renderOpts.SourceMap = true
+	oldRender := executeWithOptions(templatePath, contextPath, renderOpts)
+	if oldRender.Error != "" {
+		return oldRender
+	}
+	compareOpts.SourceMap = true
+	newRender := executeWithOptions(templatePath, opts.CompareContext, compareOpts)
+	if newRender.Error != "" {
+		return newRender
+	}
+
+	report := &contextDiffReport{
+		Changes: diffContextValues(".", before, after, nil),
+		Diff:    unifiedDiff(contextPath, opts.CompareContext, oldRender.Rendered, newRender.Rendered),
+	}
+	reads := newNodeReads(templatePath, content, trees, analyzeTrees(templatePath, name, content, trees), opts)
+	report.Regions = diffRegions(oldRender, newRender)
+	for i := range report.Regions {
+		report.Regions[i].Causes = reads.causes(report.Regions[i].Nodes, report.Changes)
+	}
+	return response{ContextDiff: report, Diagnostics: appendNewDiagnostics(oldRender.Diagnostics, newRender.Diagnostics)}
+}
+
+// diffContextValues lists the leaf values that differ between two
+// contexts. Objects are compared key by key and arrays item by item; an
+// array that grew or shrank reports each extra item whole.
+func diffContextValues(path string, before, after interface{}, changes []contextChange) []contextChange {
+	join := func(key string) string {
+		if path == "." {
+			return "." + key
+		}
+		return path + "." + key
+	}
+	switch old := before.(type) {
+	case map[string]interface{}:
+		if updated, ok := after.(map[string]interface{}); ok {
+			keys := map[string]bool{}
+			for key := range old {
+				keys[key] = true
+			}
+			for key := range updated {
+				keys[key] = true
+			}
+			sorted := make([]string, 0, len(keys))
+			for key := range keys {
+				sorted = append(sorted, key)
+			}
+			sort.Strings(sorted)
+			for _, key := range sorted {
+				changes = diffContextValues(join(key), old[key], updated[key], changes)
+			}
+			return changes
+		}
+	case []interface{}:
+		if updated, ok := after.([]interface{}); ok {
+			for i := 0; i < max(len(old), len(updated)); i++ {
+				var oldItem, newItem interface{}
+				if i < len(old) {
+					oldItem = old[i]
+				}
+				if i < len(updated) {
+					newItem = updated[i]
+				}
+				changes = diffContextValues(path+"["+strconv.Itoa(i)+"]", oldItem, newItem, changes)
+			}
+			return changes
+		}
+	}
+
+	oldJSON, _ := encodeJSON(path, before, "")
+	newJSON, _ := encodeJSON(path, after, "")
+	if oldJSON == newJSON {
+		return changes
+	}
+	change := contextChange{Path: path}
+	if before != nil {
+		change.Before = json.RawMessage(oldJSON)
+	}
+	if after != nil {
+		change.After = json.RawMessage(newJSON)
+	}
+	return append(changes, change)
+}
+
+// diffRegions groups the changed lines of two source-mapped renders and
+// notes the template nodes that wrote them in either render.
+func diffRegions(oldRender, newRender response) []contextDiffRegion {
+	var regions []contextDiffRegion
+	ops := diffLines(splitLines(oldRender.Rendered), splitLines(newRender.Rendered))
+	oldLine, newLine, oldOffset, newOffset := 0, 0, 0, 0
+	for i := 0; i < len(ops); {
+		if ops[i].Kind == diffEqual {
+			oldLine, newLine = oldLine+1, newLine+1
+			oldOffset, newOffset = oldOffset+len(ops[i].Line), newOffset+len(ops[i].Line)
+			i++
+			continue
+		}
+		region := contextDiffRegion{OldStart: oldLine + 1, NewStart: newLine + 1}
+		oldFrom, newFrom := oldOffset, newOffset
+		for ; i < len(ops) && ops[i].Kind != diffEqual; i++ {
+			if ops[i].Kind == diffDelete {
+				region.Removed = append(region.Removed, ops[i].Line)
+				oldLine, oldOffset = oldLine+1, oldOffset+len(ops[i].Line)
+			} else {
+				region.Added = append(region.Added, ops[i].Line)
+				newLine, newOffset = newLine+1, newOffset+len(ops[i].Line)
+			}
+		}
+		region.OldLines, region.NewLines = len(region.Removed), len(region.Added)
+		if region.OldLines == 0 {
+			region.OldStart--
+		}
+		if region.NewLines == 0 {
+			region.NewStart--
+		}
+
+		seen := map[sourceLocation]bool{}
+		collect := func(mappings []sourceMapping, from, to int) {
+			for _, mapping := range mappings {
+				location := sourceLocation{File: mapping.File, Line: mapping.Line, Column: mapping.Column}
+				if mapping.OutputStart < to && mapping.OutputEnd > from && !seen[location] {
+					seen[location] = true
+					region.Nodes = append(region.Nodes, location)
+				}
+			}
+		}
+		collect(oldRender.SourceMap, oldFrom, oldOffset)
+		collect(newRender.SourceMap, newFrom, newOffset)
+		sort.Slice(region.Nodes, func(a, b int) bool {
+			x, y := region.Nodes[a], region.Nodes[b]
+			if x.File != y.File {
+				return x.File < y.File
+			}
+			if x.Line != y.Line {
+				return x.Line < y.Line
+			}
+			return x.Column < y.Column
+		})
+		regions = append(regions, region)
+	}
+	return regions
+}
+
+// nodeReads knows, for the nodes of the main template that write output,
+// the context paths they read and the if, with, and range pipelines that
+// decide whether they run.
+type nodeReads struct {
+	templatePath string
+	content      string
+	// usages are analysis' field reads, by byte offset.
+	usages []offsetUsage
+	// nodes maps the start offset of each text and output action to its
+	// end and the spans of the control pipelines enclosing it.
+	nodes map[int]writerNode
+}
+
+type offsetUsage struct {
+	offset int
+	path   string
+}
+
+type writerNode struct {
+	end      int
+	controls []actionSpan
+}
+
+func newNodeReads(templatePath, content string, trees map[string]*parse.Tree, analysis *contextAnalysis, opts renderOptions) *nodeReads {
+	reads := &nodeReads{templatePath: templatePath, content: content, nodes: map[int]writerNode{}}
+	for _, field := range analysis.Fields {
+		for _, occurrence := range field.Occurrences {
+			if position, err := positionToOffset(content, occurrence.Line, occurrence.Column); err == nil {
+				reads.usages = append(reads.usages, offsetUsage{offset: position.Offset, path: field.Path})
+			}
+		}
+	}
+	actions := scanActions(content, opts.LeftDelim, opts.RightDelim)
+	name := templateName(templatePath)
+	for _, tree := range trees {
+		if tree.ParseName == name {
+			reads.list(tree.Root, actions, nil)
+		}
+	}
+	return reads
+}
+
+func (r *nodeReads) list(list *parse.ListNode, actions, controls []actionSpan) {
+	if list == nil {
+		return
+	}
+	for _, node := range list.Nodes {
+		var branch *parse.BranchNode
+		switch typed := node.(type) {
+		case *parse.TextNode:
+			r.nodes[int(typed.Pos)] = writerNode{end: int(typed.Pos) + len(typed.Text), controls: controls}
+		case *parse.ActionNode:
+			if span, ok := enclosingAction(actions, typed.Pos); ok {
+				r.nodes[span.Start] = writerNode{end: span.End, controls: controls}
+			}
+		case *parse.IfNode:
+			branch = &typed.BranchNode
+		case *parse.WithNode:
+			branch = &typed.BranchNode
+		case *parse.RangeNode:
+			branch = &typed.BranchNode
+		}
+		if branch == nil {
+			continue
+		}
+		nested := controls
+		if span, ok := enclosingAction(actions, branch.Pos); ok {
+			nested = append(append([]actionSpan{}, controls...), span)
+		}
+		r.list(branch.List, actions, nested)
+		r.list(branch.ElseList, actions, nested)
+	}
+}
+
+// causes returns the changes read by nodes or by the blocks around them.
+func (r *nodeReads) causes(nodes []sourceLocation, changes []contextChange) []string {
+	var paths []string
+	for _, location := range nodes {
+		if location.File != r.templatePath {
+			continue
+		}
+		position, err := positionToOffset(r.content, location.Line, location.Column)
+		if err != nil {
+			continue
+		}
+		node, ok := r.nodes[position.Offset]
+		if !ok {
+			continue
+		}
+		paths = append(paths, r.readsWithin(position.Offset, node.end)...)
+		for _, control := range node.controls {
+			paths = append(paths, r.readsWithin(control.Start, control.End)...)
+		}
+	}
+
+	var causes []string
+	for _, change := range changes {
+		general := arrayIndex.ReplaceAllString(change.Path, "[]")
+		for _, path := range paths {
+			if pathsOverlap(general, path) {
+				causes = append(causes, change.Path)
+				break
+			}
+		}
+	}
+	return causes
+}
+
+func (r *nodeReads) readsWithin(start, end int) []string {
+	var paths []string
+	for _, usage := range r.usages {
+		if start <= usage.offset && usage.offset < end {
+			paths = append(paths, usage.path)
+		}
+	}
+	return paths
+}
+
+// pathsOverlap reports whether one path is the other or lies inside it,
+// so reading .user is affected by a change to .user.name and the reverse.
+func pathsOverlap(a, b string) bool {
+	if a == "." || b == "." || a == b {
+		return true
+	}
+	inside := func(child, parent string) bool {
+		return strings.HasPrefix(child, parent) && (child[len(parent)] == '.' || child[len(parent)] == '[')
+	}
+	if len(a) > len(b) {
+		return inside(a, b)
+	}
+	if len(b) > len(a) {
+		return inside(b, a)
+	}
+	return false
+}
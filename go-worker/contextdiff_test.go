@@ -0,0 +1,85 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestContextDiffAttributesOutputChangesToContextPaths(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "page.tmpl")
+	writeFile(t, templatePath, "Hello {{ .user.name }}\n{{ if .vip }}VIP\n{{ end }}{{ range .items }}- {{ .title }}\n{{ end }}Total: {{ len .items }}")
+	oldPath := filepath.Join(dir, "old.json")
+	writeFile(t, oldPath, `{"user": {"name": "Ada"}, "vip": false, "items": [{"title": "a"}], "unused": 1}`)
+	newPath := filepath.Join(dir, "new.json")
+	writeFile(t, newPath, `{"user": {"name": "Grace"}, "vip": true, "items": [{"title": "a"}, {"title": "b"}], "unused": 2}`)
+
+	resp := run(templatePath, oldPath, renderOptions{Mode: "context-diff", CompareContext: newPath})
+	report := resp.ContextDiff
+	if resp.Error != "" || report == nil {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	var changes []string
+	for _, change := range report.Changes {
+		changes = append(changes, change.Path+" "+string(change.Before)+" "+string(change.After))
+	}
+	if want := []string{`.items[1]  {"title":"b"}`, ".unused 1 2", `.user.name "Ada" "Grace"`, ".vip false true"}; !reflect.DeepEqual(changes, want) {
+		t.Fatalf("unexpected changes: %q", changes)
+	}
+
+	if len(report.Regions) != 2 {
+		t.Fatalf("expected two changed regions, got %+v", report.Regions)
+	}
+	header, items := report.Regions[0], report.Regions[1]
+	if header.OldStart != 1 || header.OldLines != 1 || header.NewStart != 1 || header.NewLines != 2 ||
+		!reflect.DeepEqual(header.Causes, []string{".user.name", ".vip"}) {
+		t.Fatalf("unexpected header region: %+v", header)
+	}
+	if items.OldStart != 3 || items.NewStart != 4 || items.NewLines != 2 || !reflect.DeepEqual(items.Causes, []string{".items[1]"}) {
+		t.Fatalf("unexpected items region: %+v", items)
+	}
+	if len(items.Nodes) == 0 || items.Nodes[0].Line != 3 {
+		t.Fatalf("expected the region to point at the range body, got %+v", items.Nodes)
+	}
+	if !strings.Contains(report.Diff, "+VIP") {
+		t.Fatalf("expected a unified diff, got %q", report.Diff)
+	}
+}
+
+func TestContextDiffAnonymizesChangedValues(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "page.tmpl")
+	writeFile(t, templatePath, "{{ .email }}")
+	oldPath := filepath.Join(dir, "old.json")
+	writeFile(t, oldPath, `{"email": "ada@corp.example"}`)
+	newPath := filepath.Join(dir, "new.json")
+	writeFile(t, newPath, `{"email": "grace@corp.example"}`)
+
+	resp := run(templatePath, oldPath, renderOptions{Mode: "context-diff", CompareContext: newPath, Anonymize: true})
+	if resp.Error != "" || resp.ContextDiff == nil || len(resp.ContextDiff.Changes) != 1 {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	change := resp.ContextDiff.Changes[0]
+	if strings.Contains(string(change.Before)+string(change.After), "corp.example") {
+		t.Fatalf("expected the changed values to be anonymized, got %+v", change)
+	}
+	if !strings.Contains(resp.ContextDiff.Diff, strings.Trim(string(change.After), `"`)) {
+		t.Fatalf("expected the changes to match the anonymized output, got %+v", resp.ContextDiff)
+	}
+}
+
+func TestContextDiffRequiresASecondContext(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "page.tmpl")
+	writeFile(t, templatePath, "Hello")
+
+	if resp := run(templatePath, "", renderOptions{Mode: "context-diff"}); !strings.Contains(resp.Error, "--compare-context") {
+		t.Fatalf("expected a usage error, got %+v", resp)
+	}
+	if !pathsOverlap(".items[]", ".items") || !pathsOverlap(".user", ".user.name") || pathsOverlap(".user", ".username") {
+		t.Fatal("unexpected path overlap")
+	}
+}
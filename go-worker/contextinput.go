@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// stdinContextPath is the --context value that reads the context from
+// standard input.
+const stdinContextPath = "-"
+
+// readsStdinContext reports whether the context, one of its layers, or
+// any context profile comes from standard input.
+func readsStdinContext(contextPath string, layers []string, profiles []contextProfile) bool {
+	if contextPath == stdinContextPath {
+		return true
+	}
+	for _, layer := range layers {
+		if layer == stdinContextPath {
+			return true
+		}
+	}
+	for _, profile := range profiles {
+		if profile.Path == stdinContextPath {
+			return true
+		}
+	}
+	return false
+}
+
+// parseStdinContext accepts JSON or, failing that, YAML. YAML is
+// normalized through JSON so numbers are float64 as in a JSON context.
+func parseStdinContext(content []byte) (interface{}, error) {
+	if data, err := parseContext(content); err == nil {
+		return data, nil
+	}
+	var value interface{}
+	if err := yaml.Unmarshal(content, &value); err != nil {
+		return nil, errors.New("failed to parse context from stdin as JSON or YAML")
+	}
+	normalized, err := json.Marshal(stringKeyedMaps(value))
+	if err != nil {
+		return nil, fmt.Errorf("context from stdin cannot be represented as JSON: %v", err)
+	}
+	return parseContext(normalized)
+}
+
+// mergeContexts deep-merges overlay over base the way Helm layers values
+// files: objects merge key by key, a null in overlay deletes the key, and
+// anything else, arrays included, replaces what base holds.
+func mergeContexts(base, overlay interface{}) interface{} {
+	baseMap, baseIsMap := base.(map[string]interface{})
+	overlayMap, overlayIsMap := overlay.(map[string]interface{})
+	if !baseIsMap || !overlayIsMap {
+		return overlay
+	}
+	for key, value := range overlayMap {
+		if value == nil {
+			delete(baseMap, key)
+			continue
+		}
+		if existing, ok := baseMap[key]; ok {
+			baseMap[key] = mergeContexts(existing, value)
+		} else {
+			baseMap[key] = value
+		}
+	}
+	return baseMap
+}
+
+// applyContextOverrides sets every --set value, as a string, and then
+// every --set-json value on the loaded context. Each override is
+// path=value, where path is dotted keys and array indexes such as
+// items.0.title; a key containing a dot escapes it as \..
+func applyContextOverrides(data interface{}, opts renderOptions) (interface{}, error) {
+	for _, override := range opts.Set {
+		path, value, ok := strings.Cut(override, "=")
+		if !ok {
+			return nil, fmt.Errorf("--set %q: expected key=value", override)
+		}
+		var err error
+		if data, err = setContextValue(data, splitContextPath(path), value); err != nil {
+			return nil, fmt.Errorf("--set %s: %v", path, err)
+		}
+	}
+	for _, override := range opts.SetJSON {
+		path, raw, ok := strings.Cut(override, "=")
+		if !ok {
+			return nil, fmt.Errorf("--set-json %q: expected key=json", override)
+		}
+		var value interface{}
+		if err := json.Unmarshal([]byte(raw), &value); err != nil {
+			return nil, fmt.Errorf("--set-json %s: invalid JSON: %v", path, err)
+		}
+		var err error
+		if data, err = setContextValue(data, splitContextPath(path), value); err != nil {
+			return nil, fmt.Errorf("--set-json %s: %v", path, err)
+		}
+	}
+	return data, nil
+}
+
+// splitContextPath splits a dotted override path, honoring \. escapes.
+func splitContextPath(path string) []string {
+	var segments []string
+	var segment strings.Builder
+	for i := 0; i < len(path); i++ {
+		switch {
+		case path[i] == '\\' && i+1 < len(path) && path[i+1] == '.':
+			segment.WriteByte('.')
+			i++
+		case path[i] == '.':
+			segments = append(segments, segment.String())
+			segment.Reset()
+		default:
+			segment.WriteByte(path[i])
+		}
+	}
+	return append(segments, segment.String())
+}
+
+// setContextValue returns data with value stored at path. Missing maps
+// along the path are created; arrays are indexed by existing positions
+// only.
+func setContextValue(data interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	key := path[0]
+	if key == "" {
+		return nil, errors.New("empty key in path")
+	}
+	switch typed := data.(type) {
+	case nil:
+		child, err := setContextValue(nil, path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{key: child}, nil
+	case map[string]interface{}:
+		child, err := setContextValue(typed[key], path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		typed[key] = child
+		return typed, nil
+	case []interface{}:
+		index, err := strconv.Atoi(key)
+		if err != nil || index < 0 || index >= len(typed) {
+			return nil, fmt.Errorf("%q is not an index of an array of %d items", key, len(typed))
+		}
+		child, err := setContextValue(typed[index], path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		typed[index] = child
+		return typed, nil
+	default:
+		return nil, fmt.Errorf("cannot set %q inside a %s", key, jsonTypeName(data))
+	}
+}
+
+// jsonTypeName names the JSON type of a decoded value.
+func jsonTypeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	}
+	return fmt.Sprintf("%T", value)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestContextOverridesMergeOverTheContextFile(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "page.tmpl")
+	writeFile(t, templatePath, `{{ .user.name }} {{ .user.age }} {{ index .items 1 }} {{ .flags.beta }} {{ index . "a.b" }}`)
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, contextPath, `{"user": {"name": "Ada", "age": 36}, "items": ["x", "y"]}`)
+
+	resp := run(templatePath, contextPath, renderOptions{
+		Set:     []string{"user.name=Grace", "items.1=z", `a\.b=dotted`},
+		SetJSON: []string{"user.age=85", `flags={"beta": true}`},
+	})
+	if resp.Error != "" || resp.Rendered != "Grace 85 z true dotted" {
+		t.Fatalf("unexpected render: %+v", resp)
+	}
+
+	writeFile(t, templatePath, `{{ printf "%T" .count }}`)
+	resp = run(templatePath, "", renderOptions{Set: []string{"count=3"}})
+	if resp.Rendered != "string" {
+		t.Fatalf("expected --set to store strings, got %+v", resp)
+	}
+
+	for _, opts := range []renderOptions{
+		{Set: []string{"user"}},
+		{Set: []string{"user.name.first=A"}},
+		{Set: []string{"items.5=A"}},
+		{SetJSON: []string{"user={"}},
+	} {
+		if resp := run(templatePath, contextPath, opts); resp.Error == "" {
+			t.Errorf("expected %+v to fail", opts)
+		}
+	}
+}
+
+func TestStdinContextAcceptsJSONAndYAML(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "page.tmpl")
+	writeFile(t, templatePath, `{{ .name }} {{ add .count 1 }}`)
+
+	for _, input := range []string{`{"name": "Ada", "count": 1}`, "name: Ada\ncount: 1\n"} {
+		resp := run(templatePath, stdinContextPath, renderOptions{stdinContext: []byte(input), Set: []string{"name=Grace"}})
+		if resp.Error != "" || resp.Rendered != "Grace 2" {
+			t.Fatalf("unexpected render of %q: %+v", input, resp)
+		}
+	}
+
+	resp := run(templatePath, stdinContextPath, renderOptions{})
+	if !strings.Contains(resp.Error, "only the command line provides") {
+		t.Fatalf("expected server requests to reject stdin contexts, got %+v", resp)
+	}
+
+	var out bytes.Buffer
+	in := strings.NewReader(`{"id": 1, "template": "` + filepath.ToSlash(templatePath) + `", "setJSON": ["name=\"Lin\"", "count=4"]}` + "\n")
+	if err := serve(in, &out, renderOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), `"rendered":"Lin 5"`) {
+		t.Fatalf("expected server requests to accept overrides, got %s", out.String())
+	}
+}
+
+func TestContextLayersDeepMergeInOrder(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "app.tmpl")
+	writeFile(t, templatePath, `{{ .db.host }}:{{ .db.port }} {{ .tags }} {{ .debug }} {{ .name }}`)
+	basePath := filepath.Join(dir, "base.json")
+	writeFile(t, basePath, `{"db": {"host": "localhost", "port": 5432}, "tags": ["a", "b"], "debug": true, "name": "app"}`)
+	stagingPath := filepath.Join(dir, "staging.json")
+	writeFile(t, stagingPath, `{"db": {"host": "staging.db"}, "tags": ["c"], "debug": null}`)
+	scenarioPath := filepath.Join(dir, "scenario.json")
+	writeFile(t, scenarioPath, `{"name": "scenario"}`)
+
+	resp := run(templatePath, basePath, renderOptions{ContextLayers: []string{stagingPath, scenarioPath}, Set: []string{"name=override"}})
+	if resp.Error != "" || resp.Rendered != "staging.db:5432 [c] <no value> override" {
+		t.Fatalf("unexpected render: %+v", resp)
+	}
+
+	resp = run(templatePath, basePath, renderOptions{ContextLayers: []string{filepath.Join(dir, "missing.json")}})
+	if !strings.Contains(resp.Error, "context layer") {
+		t.Fatalf("expected a missing layer to fail, got %+v", resp)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// maxRemoteContextBytes bounds a context fetched over http(s). Contexts
+// pulled from an API run larger than templates.
+const maxRemoteContextBytes = 32 << 20
+
+// validateRemoteContext checks the --context-header and --context-cache-ttl
+// values before anything is fetched.
+func validateRemoteContext(opts renderOptions) error {
+	if _, err := contextHeaders(opts.ContextHeaders); err != nil {
+		return err
+	}
+	_, err := contextCacheTTL(opts.ContextCacheTTL)
+	return err
+}
+
+// fetchRemoteContext downloads the context at rawURL with the configured
+// headers. Like remote templates, the host must be in the --remote-allow
+// list, and the body is cached and revalidated with its ETag; within
+// ContextCacheTTL of the last fetch the cached copy is used without asking
+// the server, so a preview that renders on every keystroke does not send a
+// request for each.
+func fetchRemoteContext(rawURL string, opts renderOptions) ([]byte, error) {
+	headers, err := contextHeaders(opts.ContextHeaders)
+	if err != nil {
+		return nil, err
+	}
+	ttl, err := contextCacheTTL(opts.ContextCacheTTL)
+	if err != nil {
+		return nil, err
+	}
+	return fetchRemoteCached(rawURL, opts, remoteFetch{kind: "remote context", headers: headers, maxBytes: maxRemoteContextBytes, ttl: ttl})
+}
+
+// contextHeaders parses "Name: value" headers.
+func contextHeaders(values []string) (http.Header, error) {
+	headers := http.Header{}
+	for _, value := range values {
+		name, content, ok := strings.Cut(value, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("invalid --context-header %q: use \"Name: value\"", value)
+		}
+		headers.Add(textproto.CanonicalMIMEHeaderKey(name), strings.TrimSpace(content))
+	}
+	return headers, nil
+}
+
+// contextCacheTTL parses --context-cache-ttl; empty is zero, which
+// revalidates on every fetch.
+func contextCacheTTL(value string) (time.Duration, error) {
+	if strings.TrimSpace(value) == "" {
+		return 0, nil
+	}
+	ttl, err := time.ParseDuration(strings.TrimSpace(value))
+	if err != nil || ttl < 0 {
+		return 0, fmt.Errorf("invalid --context-cache-ttl %q: use a duration such as 30s or 5m", value)
+	}
+	return ttl, nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRunFetchesRemoteContextWithHeaders(t *testing.T) {
+	var requests, notModified int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			atomic.AddInt32(&notModified, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		if strings.HasSuffix(r.URL.Path, ".csv") {
+			_, _ = w.Write([]byte("name\nAda\nBob\n"))
+			return
+		}
+		_, _ = w.Write([]byte(`{"name": "Ada"}`))
+	}))
+	t.Cleanup(server.Close)
+
+	templatePath := filepath.Join(t.TempDir(), "hello.tmpl")
+	writeFile(t, templatePath, "Hello {{ .name }}")
+	opts := renderOptions{
+		RemoteAllow:    []string{server.URL + "/"},
+		RemoteCacheDir: t.TempDir(),
+		ContextHeaders: []string{"authorization: Bearer secret"},
+	}
+
+	for i := 0; i < 2; i++ {
+		resp := run(templatePath, server.URL+"/api/user?id=1", opts)
+		if resp.Error != "" || resp.Rendered != "Hello Ada" {
+			t.Fatalf("unexpected response: %+v", resp)
+		}
+	}
+	if atomic.LoadInt32(&requests) != 2 || atomic.LoadInt32(&notModified) != 1 {
+		t.Fatalf("expected the second render to revalidate, got %d requests and %d 304s", requests, notModified)
+	}
+
+	// Within the TTL of the last revalidation the cached copy is used
+	// without a request.
+	opts.ContextCacheTTL = "1h"
+	for i := 0; i < 3; i++ {
+		if resp := run(templatePath, server.URL+"/api/user?id=1", opts); resp.Rendered != "Hello Ada" {
+			t.Fatalf("unexpected cached response: %+v", resp)
+		}
+	}
+	if atomic.LoadInt32(&requests) != 2 {
+		t.Fatalf("expected no requests within the TTL, got %d in total", requests)
+	}
+
+	// A dataset is recognized by the URL's path.
+	writeFile(t, templatePath, "{{ range .rows }}{{ .name }} {{ end }}")
+	if resp := run(templatePath, server.URL+"/api/users.csv?page=1", opts); resp.Error != "" || resp.Rendered != "Ada Bob " {
+		t.Fatalf("unexpected dataset response: %+v", resp)
+	}
+
+	// Other credentials do not share the cached copy.
+	opts.ContextHeaders = []string{"Authorization: Bearer other"}
+	if resp := run(templatePath, server.URL+"/api/user?id=1", opts); resp.Error == "" || !strings.Contains(resp.Error, "401") {
+		t.Fatalf("expected the other credentials to be refused, got %+v", resp)
+	}
+}
+
+func TestRemoteContextRequiresAllowlist(t *testing.T) {
+	templatePath := filepath.Join(t.TempDir(), "hello.tmpl")
+	writeFile(t, templatePath, "Hello")
+	resp := run(templatePath, "https://api.example.com/user", renderOptions{})
+	if !strings.Contains(resp.Error, "remote context https://api.example.com/user is not in the allowlist") {
+		t.Fatalf("expected an allowlist error, got %+v", resp)
+	}
+}
+
+func TestValidateRemoteContext(t *testing.T) {
+	for _, opts := range []renderOptions{
+		{ContextHeaders: []string{"Authorization"}},
+		{ContextHeaders: []string{"X Token: 1"}},
+		{ContextCacheTTL: "soon"},
+		{ContextCacheTTL: "-1s"},
+	} {
+		if err := validateRemoteContext(opts); err == nil {
+			t.Fatalf("expected %+v to be rejected", opts)
+		}
+	}
+	if err := validateRemoteContext(renderOptions{ContextHeaders: []string{"X-Token: a:b"}, ContextCacheTTL: "30s"}); err != nil {
+		t.Fatal(err)
+	}
+	headers, _ := contextHeaders([]string{"x-token: a:b"})
+	if headers.Get("X-Token") != "a:b" {
+		t.Fatalf("unexpected headers: %v", headers)
+	}
+}
+
+func TestContextHeadersStayOutOfRequests(t *testing.T) {
+	encoded, err := json.Marshal(renderOptions{ContextHeaders: []string{"Authorization: Bearer secret"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(encoded), "secret") {
+		t.Fatalf("expected context headers to stay out of encoded options: %s", encoded)
+	}
+}
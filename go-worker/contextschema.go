@@ -0,0 +1,517 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// contextSchemaViolation is one place the context breaks its schema. Pointer
+// is an RFC 6901 JSON pointer into the context, empty for the whole
+// document.
+type contextSchemaViolation struct {
+	Pointer string
+	Message string
+}
+
+// contextSchemaDiagnostics validates data against the JSON Schema in
+// opts.ContextSchema. Violations are warnings, or errors with
+// ContextSchemaStrict, located in the context file when it is a plain JSON
+// file the value came from unchanged.
+func contextSchemaDiagnostics(contextPath string, data interface{}, opts renderOptions) ([]diagnostic, error) {
+	schemaBytes, err := os.ReadFile(opts.ContextSchema)
+	if err != nil {
+		return nil, err
+	}
+	var schema interface{}
+	if err := json.Unmarshal(schemaBytes, &schema); err != nil {
+		return nil, fmt.Errorf("context schema %s is not valid JSON: %v", opts.ContextSchema, err)
+	}
+
+	validator := &schemaValidator{root: schema, patterns: map[string]*regexp.Regexp{}, redact: opts.Anonymize}
+	validator.validate(schema, data, "")
+	if validator.err != nil {
+		return nil, fmt.Errorf("context schema %s: %v", opts.ContextSchema, validator.err)
+	}
+
+	var contextContent string
+	if contextPath != "" && contextPath != stdinContextPath && !isObjectStoreURL(contextPath) && !isRemoteURL(contextPath) && !isDatasetContext(contextPath) &&
+		len(opts.ContextLayers) == 0 && len(opts.Set) == 0 && len(opts.SetJSON) == 0 && !opts.RefContext {
+		if contextBytes, err := os.ReadFile(contextPath); err == nil {
+			contextContent = string(contextBytes)
+		}
+	}
+
+	severity := "warning"
+	if opts.ContextSchemaStrict {
+		severity = "error"
+	}
+	diagnostics := make([]diagnostic, 0, len(validator.violations))
+	for _, violation := range validator.violations {
+		pointer := violation.Pointer
+		if pointer == "" {
+			pointer = "/"
+		}
+		diag := diagnostic{
+			Message:  fmt.Sprintf("context %s: %s", pointer, violation.Message),
+			Severity: severity,
+			Rule:     "context-schema",
+			File:     contextPath,
+		}
+		if contextContent != "" {
+			if offset, ok := jsonPointerOffset(contextContent, violation.Pointer); ok {
+				if position, err := offsetToPosition(contextContent, offset); err == nil {
+					diag.Line, diag.Column = position.Line, position.Column
+				}
+			}
+		}
+		diagnostics = append(diagnostics, diag)
+	}
+	return diagnostics, nil
+}
+
+// schemaValidator checks values against the commonly used JSON Schema
+// keywords: type, enum, const, the numeric, string, array, and object
+// bounds, properties, required, additionalProperties, items, prefixItems,
+// allOf, anyOf, oneOf, not, and local $refs. Other keywords, format among
+// them, are annotations and ignored.
+type schemaValidator struct {
+	root       interface{}
+	violations []contextSchemaViolation
+	patterns   map[string]*regexp.Regexp
+	// depth guards against $refs that loop without consuming the value.
+	depth int
+	// redact leaves the context's own values out of messages, for
+	// --anonymize.
+	redact bool
+	err    error
+}
+
+func (v *schemaValidator) fail(pointer, format string, args ...interface{}) {
+	v.violations = append(v.violations, contextSchemaViolation{Pointer: pointer, Message: fmt.Sprintf(format, args...)})
+}
+
+// show formats a value from the context for a message.
+func (v *schemaValidator) show(value interface{}) string {
+	if v.redact {
+		return "value"
+	}
+	return compactJSON(value)
+}
+
+// showNumber formats a number from the context for a message.
+func (v *schemaValidator) showNumber(number float64) string {
+	if v.redact {
+		return "value"
+	}
+	return formatNumber(number)
+}
+
+// matches reports whether value satisfies schema without recording
+// anything, for anyOf, oneOf, and not.
+func (v *schemaValidator) matches(schema, value interface{}, pointer string) bool {
+	scratch := &schemaValidator{root: v.root, patterns: v.patterns, depth: v.depth, redact: v.redact}
+	scratch.validate(schema, value, pointer)
+	if scratch.err != nil && v.err == nil {
+		v.err = scratch.err
+	}
+	return len(scratch.violations) == 0
+}
+
+func (v *schemaValidator) validate(schema, value interface{}, pointer string) {
+	if v.err != nil {
+		return
+	}
+	switch typed := schema.(type) {
+	case bool:
+		if !typed {
+			v.fail(pointer, "no value is allowed here")
+		}
+		return
+	case map[string]interface{}:
+		v.validateObjectSchema(typed, value, pointer)
+	default:
+		v.err = fmt.Errorf("schema at %q is neither an object nor a boolean", pointer)
+	}
+}
+
+func (v *schemaValidator) validateObjectSchema(schema map[string]interface{}, value interface{}, pointer string) {
+	if ref, ok := schema["$ref"].(string); ok {
+		target, err := resolveSchemaRef(v.root, ref)
+		if err != nil {
+			v.err = err
+			return
+		}
+		if v.depth++; v.depth > 64 {
+			v.err = fmt.Errorf("$ref %s recurses too deeply", ref)
+			return
+		}
+		v.validate(target, value, pointer)
+		v.depth--
+	}
+
+	if kinds, ok := schemaTypes(schema["type"]); ok {
+		actual := jsonTypeName(value)
+		allowed := false
+		for _, kind := range kinds {
+			if kind == actual || (kind == "integer" && isInteger(value)) {
+				allowed = true
+			}
+		}
+		if !allowed {
+			v.fail(pointer, "expected %s, got %s", strings.Join(kinds, " or "), actual)
+			// The other keywords would only repeat the mismatch.
+			return
+		}
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, candidate := range enum {
+			if sameJSONValue(candidate, value) {
+				found = true
+			}
+		}
+		if !found {
+			v.fail(pointer, "%s is not one of %s", v.show(value), compactJSON(enum))
+		}
+	}
+	if constant, ok := schema["const"]; ok && !sameJSONValue(constant, value) {
+		v.fail(pointer, "%s is not %s", v.show(value), compactJSON(constant))
+	}
+
+	switch typed := value.(type) {
+	case float64:
+		v.validateNumber(schema, typed, pointer)
+	case string:
+		v.validateString(schema, typed, pointer)
+	case []interface{}:
+		v.validateArray(schema, typed, pointer)
+	case map[string]interface{}:
+		v.validateObject(schema, typed, pointer)
+	}
+
+	if all, ok := schema["allOf"].([]interface{}); ok {
+		for _, sub := range all {
+			v.validate(sub, value, pointer)
+		}
+	}
+	if anyOf, ok := schema["anyOf"].([]interface{}); ok {
+		matched := false
+		for _, sub := range anyOf {
+			if v.matches(sub, value, pointer) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			v.fail(pointer, "matches none of the anyOf schemas")
+		}
+	}
+	if oneOf, ok := schema["oneOf"].([]interface{}); ok {
+		count := 0
+		for _, sub := range oneOf {
+			if v.matches(sub, value, pointer) {
+				count++
+			}
+		}
+		if count != 1 {
+			v.fail(pointer, "matches %d of the oneOf schemas instead of exactly one", count)
+		}
+	}
+	if not, ok := schema["not"]; ok && v.matches(not, value, pointer) {
+		v.fail(pointer, "matches the schema under not")
+	}
+}
+
+func (v *schemaValidator) validateNumber(schema map[string]interface{}, number float64, pointer string) {
+	if minimum, ok := schema["minimum"].(float64); ok && number < minimum {
+		v.fail(pointer, "%s is less than the minimum %s", v.showNumber(number), formatNumber(minimum))
+	}
+	if maximum, ok := schema["maximum"].(float64); ok && number > maximum {
+		v.fail(pointer, "%s is greater than the maximum %s", v.showNumber(number), formatNumber(maximum))
+	}
+	if minimum, ok := schema["exclusiveMinimum"].(float64); ok && number <= minimum {
+		v.fail(pointer, "%s is not greater than %s", v.showNumber(number), formatNumber(minimum))
+	}
+	if maximum, ok := schema["exclusiveMaximum"].(float64); ok && number >= maximum {
+		v.fail(pointer, "%s is not less than %s", v.showNumber(number), formatNumber(maximum))
+	}
+	if divisor, ok := schema["multipleOf"].(float64); ok && divisor > 0 {
+		if quotient := number / divisor; math.Abs(quotient-math.Round(quotient)) > 1e-9 {
+			v.fail(pointer, "%s is not a multiple of %s", v.showNumber(number), formatNumber(divisor))
+		}
+	}
+}
+
+func (v *schemaValidator) validateString(schema map[string]interface{}, text string, pointer string) {
+	length := utf8.RuneCountInString(text)
+	if minimum, ok := schema["minLength"].(float64); ok && float64(length) < minimum {
+		v.fail(pointer, "string is shorter than %s characters", formatNumber(minimum))
+	}
+	if maximum, ok := schema["maxLength"].(float64); ok && float64(length) > maximum {
+		v.fail(pointer, "string is longer than %s characters", formatNumber(maximum))
+	}
+	if pattern, ok := schema["pattern"].(string); ok {
+		compiled, found := v.patterns[pattern]
+		if !found {
+			var err error
+			if compiled, err = regexp.Compile(pattern); err != nil {
+				v.err = fmt.Errorf("pattern %q: %v", pattern, err)
+				return
+			}
+			v.patterns[pattern] = compiled
+		}
+		if !compiled.MatchString(text) {
+			v.fail(pointer, "%s does not match the pattern %s", v.show(text), pattern)
+		}
+	}
+}
+
+func (v *schemaValidator) validateArray(schema map[string]interface{}, items []interface{}, pointer string) {
+	if minimum, ok := schema["minItems"].(float64); ok && float64(len(items)) < minimum {
+		v.fail(pointer, "array has fewer than %s items", formatNumber(minimum))
+	}
+	if maximum, ok := schema["maxItems"].(float64); ok && float64(len(items)) > maximum {
+		v.fail(pointer, "array has more than %s items", formatNumber(maximum))
+	}
+	if unique, ok := schema["uniqueItems"].(bool); ok && unique {
+		for i := range items {
+			for j := 0; j < i; j++ {
+				if sameJSONValue(items[i], items[j]) {
+					v.fail(pointer+"/"+strconv.Itoa(i), "duplicates item %d", j)
+				}
+			}
+		}
+	}
+
+	// prefixItems (or, before draft 2020-12, an array under items) checks
+	// items by position; items then applies to the rest.
+	prefix, _ := schema["prefixItems"].([]interface{})
+	rest, hasRest := schema["items"]
+	if tuple, ok := rest.([]interface{}); ok {
+		prefix, hasRest = tuple, false
+	}
+	for i, item := range items {
+		itemPointer := pointer + "/" + strconv.Itoa(i)
+		if i < len(prefix) {
+			v.validate(prefix[i], item, itemPointer)
+		} else if hasRest {
+			v.validate(rest, item, itemPointer)
+		}
+	}
+}
+
+func (v *schemaValidator) validateObject(schema map[string]interface{}, object map[string]interface{}, pointer string) {
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, name := range required {
+			if key, ok := name.(string); ok {
+				if _, present := object[key]; !present {
+					v.fail(pointer, "missing required property %q", key)
+				}
+			}
+		}
+	}
+	if minimum, ok := schema["minProperties"].(float64); ok && float64(len(object)) < minimum {
+		v.fail(pointer, "object has fewer than %s properties", formatNumber(minimum))
+	}
+	if maximum, ok := schema["maxProperties"].(float64); ok && float64(len(object)) > maximum {
+		v.fail(pointer, "object has more than %s properties", formatNumber(maximum))
+	}
+
+	properties, _ := schema["properties"].(map[string]interface{})
+	additional, hasAdditional := schema["additionalProperties"]
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		propertyPointer := pointer + "/" + escapeJSONPointer(key)
+		if property, ok := properties[key]; ok {
+			v.validate(property, object[key], propertyPointer)
+			continue
+		}
+		if !hasAdditional {
+			continue
+		}
+		if allowed, ok := additional.(bool); ok && !allowed {
+			v.fail(propertyPointer, "property %q is not allowed", key)
+			continue
+		}
+		v.validate(additional, object[key], propertyPointer)
+	}
+}
+
+// schemaTypes reads "type", a name or a list of names.
+func schemaTypes(value interface{}) ([]string, bool) {
+	switch typed := value.(type) {
+	case string:
+		return []string{typed}, true
+	case []interface{}:
+		var kinds []string
+		for _, kind := range typed {
+			if name, ok := kind.(string); ok {
+				kinds = append(kinds, name)
+			}
+		}
+		return kinds, len(kinds) > 0
+	}
+	return nil, false
+}
+
+// resolveSchemaRef follows a local reference such as #/$defs/address.
+func resolveSchemaRef(root interface{}, ref string) (interface{}, error) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, fmt.Errorf("only local $refs are supported, not %s", ref)
+	}
+	current := root
+	pointer := strings.TrimPrefix(ref, "#")
+	if pointer == "" {
+		return current, nil
+	}
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		token = unescapeJSONPointer(token)
+		switch typed := current.(type) {
+		case map[string]interface{}:
+			next, ok := typed[token]
+			if !ok {
+				return nil, fmt.Errorf("$ref %s does not resolve", ref)
+			}
+			current = next
+		case []interface{}:
+			index, err := strconv.Atoi(token)
+			if err != nil || index < 0 || index >= len(typed) {
+				return nil, fmt.Errorf("$ref %s does not resolve", ref)
+			}
+			current = typed[index]
+		default:
+			return nil, fmt.Errorf("$ref %s does not resolve", ref)
+		}
+	}
+	return current, nil
+}
+
+// unescapeJSONPointer undoes escapeJSONPointer for one reference token.
+func unescapeJSONPointer(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+}
+
+func isInteger(value interface{}) bool {
+	number, ok := value.(float64)
+	return ok && number == math.Trunc(number)
+}
+
+func sameJSONValue(a, b interface{}) bool {
+	return compactJSON(a) == compactJSON(b)
+}
+
+// compactJSON encodes value for messages; maps encode with sorted keys, so
+// equal values encode equally.
+func compactJSON(value interface{}) string {
+	encoded, err := encodeJSON("value", value, "")
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return encoded
+}
+
+func formatNumber(number float64) string {
+	return strconv.FormatFloat(number, 'f', -1, 64)
+}
+
+// jsonPointerOffset finds the byte offset of the value pointer refers to in
+// a JSON document. A pointer into a value that is missing, such as a
+// required property, resolves to the deepest value that exists.
+func jsonPointerOffset(content, pointer string) (int, bool) {
+	var tokens []string
+	if pointer != "" {
+		for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+			tokens = append(tokens, unescapeJSONPointer(token))
+		}
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(content))
+	start := func() int {
+		// InputOffset is just past the previous token; skip the separator
+		// and white space before the value.
+		offset := int(decoder.InputOffset())
+		for offset < len(content) && strings.ContainsRune(" \t\r\n,:", rune(content[offset])) {
+			offset++
+		}
+		return offset
+	}
+	offset := start()
+	for _, token := range tokens {
+		delim, err := decoder.Token()
+		if err != nil {
+			return offset, true
+		}
+		switch delim {
+		case json.Delim('{'):
+			found := false
+			for decoder.More() {
+				key, err := decoder.Token()
+				if err != nil {
+					return offset, true
+				}
+				if key == token {
+					found = true
+					break
+				}
+				if err := skipJSONValue(decoder); err != nil {
+					return offset, true
+				}
+			}
+			if !found {
+				return offset, true
+			}
+		case json.Delim('['):
+			index, err := strconv.Atoi(token)
+			if err != nil {
+				return offset, true
+			}
+			for i := 0; i < index && decoder.More(); i++ {
+				if err := skipJSONValue(decoder); err != nil {
+					return offset, true
+				}
+			}
+			if !decoder.More() {
+				return offset, true
+			}
+		default:
+			return offset, true
+		}
+		offset = start()
+	}
+	return offset, true
+}
+
+// skipJSONValue consumes one value, however deeply nested.
+func skipJSONValue(decoder *json.Decoder) error {
+	depth := 0
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return err
+		}
+		switch token {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testContextSchema = `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "type": "object",
+  "required": ["user", "plan"],
+  "additionalProperties": false,
+  "properties": {
+    "user": {"$ref": "#/$defs/user"},
+    "plan": {"enum": ["free", "pro"]},
+    "seats": {"type": "integer", "minimum": 1},
+    "tags": {"type": "array", "items": {"type": "string", "pattern": "^[a-z]+$"}, "uniqueItems": true}
+  },
+  "$defs": {
+    "user": {"type": "object", "required": ["email"], "properties": {"email": {"type": "string", "minLength": 3}}}
+  }
+}`
+
+func TestContextSchemaReportsViolationsWithPointers(t *testing.T) {
+	dir := t.TempDir()
+	schemaPath := filepath.Join(dir, "schema.json")
+	writeFile(t, schemaPath, testContextSchema)
+	templatePath := filepath.Join(dir, "page.tmpl")
+	writeFile(t, templatePath, `{{ .plan }}`)
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, contextPath, "{\n  \"user\": {\"name\": \"Ada\"},\n  \"plan\": \"team\",\n  \"seats\": 2.5,\n  \"tags\": [\"ok\", \"Bad\", \"ok\"],\n  \"extra\": true\n}\n")
+
+	resp := run(templatePath, contextPath, renderOptions{ContextSchema: schemaPath})
+	if resp.Error != "" || resp.Rendered != "team" {
+		t.Fatalf("expected violations not to stop the render, got %+v", resp)
+	}
+	want := map[string]int{
+		`context /extra: property "extra" is not allowed`:            6,
+		`context /plan: "team" is not one of ["free","pro"]`:         3,
+		"context /seats: expected integer, got number":               4,
+		`context /tags/1: "Bad" does not match the pattern ^[a-z]+$`: 5,
+		"context /tags/2: duplicates item 0":                         5,
+		`context /user: missing required property "email"`:           2,
+	}
+	if len(resp.Diagnostics) != len(want) {
+		t.Fatalf("unexpected diagnostics: %+v", resp.Diagnostics)
+	}
+	for _, diag := range resp.Diagnostics {
+		line, ok := want[diag.Message]
+		if !ok || diag.Line != line || diag.Severity != "warning" || diag.Rule != "context-schema" || diag.File != contextPath {
+			t.Errorf("unexpected diagnostic: %+v", diag)
+		}
+	}
+
+	resp = run(templatePath, contextPath, renderOptions{ContextSchema: schemaPath, ContextSchemaStrict: true})
+	if !strings.Contains(resp.Error, "6 violation(s)") || resp.Rendered != "" || resp.Diagnostics[0].Severity != "error" {
+		t.Fatalf("expected strict mode to stop the render, got %+v", resp)
+	}
+}
+
+func TestContextSchemaViolationsLeaveOutValuesUnderAnonymize(t *testing.T) {
+	dir := t.TempDir()
+	schemaPath := filepath.Join(dir, "schema.json")
+	writeFile(t, schemaPath, `{"properties": {
+  "email": {"type": "string", "pattern": "@example\\.com$"},
+  "phone": {"enum": ["none"]},
+  "age": {"type": "number", "maximum": 120}
+}}`)
+	templatePath := filepath.Join(dir, "page.tmpl")
+	writeFile(t, templatePath, `{{ .email }}`)
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, contextPath, `{"email": "jane.doe@corp.example", "phone": "+1 (415) 555-0134", "age": 4150}`)
+
+	resp := run(templatePath, contextPath, renderOptions{ContextSchema: schemaPath, Anonymize: true})
+	if len(resp.Diagnostics) != 3 {
+		t.Fatalf("expected three violations, got %+v", resp.Diagnostics)
+	}
+	for _, diag := range resp.Diagnostics {
+		for _, raw := range []string{"jane.doe", "555-0134", "4150"} {
+			if strings.Contains(diag.Message, raw) {
+				t.Fatalf("expected %q to be left out of %q", raw, diag.Message)
+			}
+		}
+	}
+	if resp.Diagnostics[0].Message != "context /age: value is greater than the maximum 120" {
+		t.Fatalf("unexpected message: %q", resp.Diagnostics[0].Message)
+	}
+}
+
+func TestContextSchemaCombinators(t *testing.T) {
+	schema := map[string]interface{}{
+		"anyOf": []interface{}{map[string]interface{}{"type": "string"}, map[string]interface{}{"type": "number", "maximum": 10.0}},
+		"not":   map[string]interface{}{"const": "forbidden"},
+	}
+	for value, violations := range map[interface{}]int{"ok": 0, 5.0: 0, 50.0: 1, true: 1, "forbidden": 1} {
+		validator := &schemaValidator{root: schema}
+		validator.validate(schema, value, "")
+		if validator.err != nil || len(validator.violations) != violations {
+			t.Errorf("%v: expected %d violations, got %+v (%v)", value, violations, validator.violations, validator.err)
+		}
+	}
+
+	if offset, _ := jsonPointerOffset(`{"a": [1, {"b~c": 2}]}`, "/a/1/b~0c"); offset != 18 {
+		t.Fatalf("unexpected pointer offset %d", offset)
+	}
+}
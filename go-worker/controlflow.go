@@ -0,0 +1,255 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template/parse"
+)
+
+// flowGraph is the control-flow graph of one named template. Node 0 is the
+// entry and node 1 the exit; straight-line output is merged into blocks.
+type flowGraph struct {
+	Name  string     `json:"name"`
+	Nodes []flowNode `json:"nodes"`
+	Edges []flowEdge `json:"edges"`
+}
+
+type flowNode struct {
+	ID     int    `json:"id"`
+	Kind   string `json:"kind"`
+	Label  string `json:"label"`
+	Line   int    `json:"line,omitempty"`
+	Column int    `json:"column,omitempty"`
+	// Target names the template a call node invokes.
+	Target string `json:"target,omitempty"`
+}
+
+type flowEdge struct {
+	From  int    `json:"from"`
+	To    int    `json:"to"`
+	Label string `json:"label,omitempty"`
+}
+
+// executeControlFlow exports a control-flow graph per template as JSON and,
+// with --graph-format=dot, as Graphviz source.
+func executeControlFlow(templatePath string, opts renderOptions) response {
+	if templatePath == "" {
+		return response{Error: "template path is required"}
+	}
+
+	content, err := readTemplate(templatePath, opts)
+	if err != nil {
+		return response{Error: err.Error()}
+	}
+
+	name := templateName(templatePath)
+	trees, err := parseTrees(name, content)
+	if err != nil {
+		return response{
+			Diagnostics: []diagnostic{templateDiagnostic(err, templatePath, content)},
+			Error:       err.Error(),
+		}
+	}
+
+	var graphs []flowGraph
+	for _, treeName := range sortedTreeNames(trees, name) {
+		graphs = append(graphs, buildFlowGraph(treeName, trees[treeName], content))
+	}
+
+	resp := response{ControlFlow: graphs}
+	switch opts.GraphFormat {
+	case "", "json":
+	case "dot":
+		resp.ControlFlowDOT = formatFlowDOT(name, graphs)
+	default:
+		return response{Error: fmt.Sprintf("unknown graph format %q", opts.GraphFormat)}
+	}
+	return resp
+}
+
+// flowExit is an edge waiting for the node control reaches next.
+type flowExit struct {
+	from  int
+	label string
+}
+
+type flowLoop struct {
+	head   int
+	breaks []flowExit
+}
+
+type flowBuilder struct {
+	content string
+	graph   flowGraph
+	loops   []*flowLoop
+	// block is the straight-line block statements are appended to while
+	// control still flows only out of its end.
+	block int
+}
+
+func buildFlowGraph(name string, tree *parse.Tree, content string) flowGraph {
+	b := &flowBuilder{content: content, graph: flowGraph{Name: name}, block: -1}
+	entry := b.addNode("entry", "entry", -1)
+	exit := b.addNode("exit", "exit", -1)
+	b.connect(b.list(tree.Root, []flowExit{{from: entry}}), exit)
+	return b.graph
+}
+
+func (b *flowBuilder) addNode(kind, label string, pos parse.Pos) int {
+	node := flowNode{ID: len(b.graph.Nodes), Kind: kind, Label: label}
+	if pos >= 0 {
+		node.Line, node.Column = lineColumn(b.content, pos)
+	}
+	b.graph.Nodes = append(b.graph.Nodes, node)
+	return node.ID
+}
+
+func (b *flowBuilder) connect(exits []flowExit, to int) {
+	for _, exit := range exits {
+		b.graph.Edges = append(b.graph.Edges, flowEdge{From: exit.from, To: to, Label: exit.label})
+	}
+}
+
+// enter adds a node that control reaches from exits and ends the current
+// straight-line block.
+func (b *flowBuilder) enter(exits []flowExit, kind, label string, pos parse.Pos) int {
+	id := b.addNode(kind, label, pos)
+	b.connect(exits, id)
+	b.block = -1
+	return id
+}
+
+func (b *flowBuilder) list(list *parse.ListNode, exits []flowExit) []flowExit {
+	if list == nil {
+		return exits
+	}
+	for _, node := range list.Nodes {
+		exits = b.node(node, exits)
+	}
+	return exits
+}
+
+func (b *flowBuilder) node(node parse.Node, exits []flowExit) []flowExit {
+	switch typed := node.(type) {
+	case *parse.TextNode:
+		text := strings.TrimSpace(string(typed.Text))
+		if text == "" {
+			return exits
+		}
+		return b.statement("text "+quoteExcerpt(text), typed.Position(), exits)
+	case *parse.ActionNode:
+		if len(typed.Pipe.Decl) > 0 {
+			return b.statement(declNames(typed.Pipe)+" = "+describePipe(typed.Pipe), typed.Position(), exits)
+		}
+		return b.statement("output "+describePipe(typed.Pipe), typed.Position(), exits)
+	case *parse.IfNode:
+		branch := b.enter(exits, "branch", "if "+describePipe(typed.Pipe), typed.Position())
+		out := b.list(typed.List, []flowExit{{branch, "true"}})
+		return append(out, b.list(typed.ElseList, []flowExit{{branch, "false"}})...)
+	case *parse.WithNode:
+		branch := b.enter(exits, "branch", "with "+describePipe(typed.Pipe), typed.Position())
+		out := b.list(typed.List, []flowExit{{branch, "set"}})
+		return append(out, b.list(typed.ElseList, []flowExit{{branch, "unset"}})...)
+	case *parse.RangeNode:
+		head := b.enter(exits, "loop", describeRange(typed.Pipe), typed.Position())
+		loop := &flowLoop{head: head}
+		b.loops = append(b.loops, loop)
+		body := b.list(typed.List, []flowExit{{head, "each"}})
+		b.loops = b.loops[:len(b.loops)-1]
+		b.connect(body, head)
+		b.block = -1
+
+		out := append([]flowExit{{head, "done"}}, loop.breaks...)
+		if typed.ElseList != nil {
+			out = append(out, b.list(typed.ElseList, []flowExit{{head, "empty"}})...)
+		}
+		return out
+	case *parse.TemplateNode:
+		call := b.enter(exits, "call", fmt.Sprintf("template %q", typed.Name), typed.Position())
+		b.graph.Nodes[call].Target = typed.Name
+		return []flowExit{{from: call}}
+	case *parse.BreakNode:
+		if loop := b.innermostLoop(); loop != nil {
+			for _, exit := range exits {
+				loop.breaks = append(loop.breaks, flowExit{exit.from, joinLabels(exit.label, "break")})
+			}
+		}
+		b.block = -1
+		return nil
+	case *parse.ContinueNode:
+		if loop := b.innermostLoop(); loop != nil {
+			for _, exit := range exits {
+				b.graph.Edges = append(b.graph.Edges, flowEdge{From: exit.from, To: loop.head, Label: joinLabels(exit.label, "continue")})
+			}
+		}
+		b.block = -1
+		return nil
+	default:
+		return exits
+	}
+}
+
+// statement appends straight-line output to the open block, starting a new
+// block when control can reach it from more than one place.
+func (b *flowBuilder) statement(label string, pos parse.Pos, exits []flowExit) []flowExit {
+	if b.block >= 0 && len(exits) == 1 && exits[0].from == b.block && exits[0].label == "" {
+		b.graph.Nodes[b.block].Label += "\n" + label
+		return exits
+	}
+	block := b.enter(exits, "block", label, pos)
+	b.block = block
+	return []flowExit{{from: block}}
+}
+
+func (b *flowBuilder) innermostLoop() *flowLoop {
+	if len(b.loops) == 0 {
+		return nil
+	}
+	return b.loops[len(b.loops)-1]
+}
+
+func joinLabels(first, second string) string {
+	if first == "" {
+		return second
+	}
+	return first + ", " + second
+}
+
+// formatFlowDOT renders the graphs as one Graphviz digraph with a cluster
+// per template.
+func formatFlowDOT(name string, graphs []flowGraph) string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "digraph %s {\n", strconv.Quote(name))
+	builder.WriteString("  node [fontname=\"monospace\"];\n")
+	for i, graph := range graphs {
+		fmt.Fprintf(&builder, "  subgraph cluster_%d {\n", i)
+		fmt.Fprintf(&builder, "    label=%s;\n", strconv.Quote(graph.Name))
+		for _, node := range graph.Nodes {
+			fmt.Fprintf(&builder, "    t%d_n%d [label=%s, shape=%s];\n", i, node.ID, strconv.Quote(node.Label), flowNodeShape(node.Kind))
+		}
+		for _, edge := range graph.Edges {
+			fmt.Fprintf(&builder, "    t%d_n%d -> t%d_n%d", i, edge.From, i, edge.To)
+			if edge.Label != "" {
+				fmt.Fprintf(&builder, " [label=%s]", strconv.Quote(edge.Label))
+			}
+			builder.WriteString(";\n")
+		}
+		builder.WriteString("  }\n")
+	}
+	builder.WriteString("}\n")
+	return builder.String()
+}
+
+func flowNodeShape(kind string) string {
+	switch kind {
+	case "entry", "exit":
+		return "oval"
+	case "branch", "loop":
+		return "diamond"
+	case "call":
+		return "component"
+	default:
+		return "box"
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExecuteControlFlowBuildsGraph(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "orders.tmpl")
+	writeFile(t, templatePath, `Hi {{ .name }}!
+{{ range .orders }}{{ if .skip }}{{ continue }}{{ end }}{{ template "row" . }}{{ else }}none{{ end }}
+{{ define "row" }}{{ with .note }}{{ . }}{{ end }}{{ end }}`)
+
+	resp := run(templatePath, "", renderOptions{Mode: "control-flow", GraphFormat: "dot"})
+	if resp.Error != "" || len(resp.ControlFlow) != 2 {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	root := resp.ControlFlow[0]
+	kinds := make([]string, len(root.Nodes))
+	for i, node := range root.Nodes {
+		kinds[i] = node.Kind
+	}
+	if want := []string{"entry", "exit", "block", "loop", "branch", "call", "block"}; !reflect.DeepEqual(kinds, want) {
+		t.Fatalf("unexpected nodes: %v", kinds)
+	}
+	if root.Nodes[2].Label != "text \"Hi\"\noutput .name\ntext \"!\"" {
+		t.Fatalf("expected straight-line output in one block, got %q", root.Nodes[2].Label)
+	}
+	if call := root.Nodes[5]; call.Target != "row" || call.Line != 2 {
+		t.Fatalf("unexpected call node: %+v", call)
+	}
+
+	want := []flowEdge{
+		{From: 0, To: 2},
+		{From: 2, To: 3},
+		{From: 3, To: 4, Label: "each"},
+		{From: 4, To: 3, Label: "true, continue"},
+		{From: 4, To: 5, Label: "false"},
+		{From: 5, To: 3},
+		{From: 3, To: 6, Label: "empty"},
+		{From: 3, To: 1, Label: "done"},
+		{From: 6, To: 1},
+	}
+	if !reflect.DeepEqual(root.Edges, want) {
+		t.Fatalf("unexpected edges:\n%+v", root.Edges)
+	}
+
+	if !strings.Contains(resp.ControlFlowDOT, "subgraph cluster_1 {\n    label=\"row\";") || !strings.Contains(resp.ControlFlowDOT, `t1_n2 -> t1_n1 [label="unset"];`) {
+		t.Fatalf("unexpected DOT output:\n%s", resp.ControlFlowDOT)
+	}
+
+	resp = run(templatePath, "", renderOptions{Mode: "control-flow", GraphFormat: "svg"})
+	if resp.Error != `unknown graph format "svg"` {
+		t.Fatalf("expected format error, got %+v", resp)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"runtime"
+)
+
+// backgroundNice is the niceness --low-priority runs at on Unix: below
+// the editor and language servers, above batch jobs at 19.
+const backgroundNice = 10
+
+// cpuFlags are the flags that keep a heavy batch render from starving the
+// editor and language servers on the same machine. Every command that can
+// render many templates registers them.
+type cpuFlags struct {
+	maxCPUs     *int
+	lowPriority *bool
+}
+
+func addCPUFlags(flags *flag.FlagSet) cpuFlags {
+	return cpuFlags{
+		maxCPUs:     flags.Int("max-cpus", 0, "Most CPUs to execute templates on at once (0 uses all of them)"),
+		lowPriority: flags.Bool("low-priority", false, "Lower the process priority so the editor stays responsive"),
+	}
+}
+
+// apply sets GOMAXPROCS and the process priority. Lowering the priority is
+// a hint: where the OS has no priorities, or refuses, the worker runs at
+// normal priority.
+func (c cpuFlags) apply() error {
+	if *c.maxCPUs < 0 {
+		return errors.New("--max-cpus must not be negative")
+	}
+	if *c.maxCPUs > 0 {
+		runtime.GOMAXPROCS(min(*c.maxCPUs, runtime.NumCPU()))
+	}
+	if *c.lowPriority {
+		_ = lowerPriority()
+	}
+	return nil
+}
+
+// renderParallelism is how many renders --parallelism allows at once: the
+// number given, or without one, one per CPU the worker may use.
+func renderParallelism(parallelism int) int {
+	if parallelism > 0 {
+		return parallelism
+	}
+	return runtime.GOMAXPROCS(0)
+}
+
+// defaultJobs is the --jobs of check-all and test when it is not given:
+// one per CPU the worker may use.
+func defaultJobs(flags *flag.FlagSet, jobs *int) {
+	given := false
+	flags.Visit(func(f *flag.Flag) {
+		given = given || f.Name == "jobs"
+	})
+	if !given {
+		*jobs = runtime.GOMAXPROCS(0)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"runtime"
+	"testing"
+)
+
+func TestCPUFlagsLimitGOMAXPROCSAndJobs(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(0))
+
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	jobs := flags.Int("jobs", runtime.NumCPU(), "")
+	cpu := addCPUFlags(flags)
+	if err := flags.Parse([]string{"--max-cpus", "1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cpu.apply(); err != nil {
+		t.Fatal(err)
+	}
+	defaultJobs(flags, jobs)
+	if runtime.GOMAXPROCS(0) != 1 || *jobs != 1 {
+		t.Fatalf("expected one CPU and one job, got %d and %d", runtime.GOMAXPROCS(0), *jobs)
+	}
+
+	// An explicit --jobs still wins.
+	flags = flag.NewFlagSet("test", flag.ContinueOnError)
+	jobs = flags.Int("jobs", runtime.NumCPU(), "")
+	cpu = addCPUFlags(flags)
+	if err := flags.Parse([]string{"--max-cpus", "1", "--jobs", "3"}); err != nil {
+		t.Fatal(err)
+	}
+	defaultJobs(flags, jobs)
+	if *jobs != 3 {
+		t.Fatalf("expected the given jobs, got %d", *jobs)
+	}
+
+	*cpu.maxCPUs = -1
+	if err := cpu.apply(); err == nil {
+		t.Fatalf("expected a negative --max-cpus to fail")
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// datasetRowsKey is where a dataset context puts its records.
+const datasetRowsKey = "rows"
+
+// isDatasetContext reports whether a context file holds tabular data
+// rather than one JSON document: CSV, or newline-delimited JSON.
+func isDatasetContext(contextPath string) bool {
+	switch strings.ToLower(filepath.Ext(templateName(contextPath))) {
+	case ".csv", ".ndjson", ".jsonl":
+		return true
+	}
+	return false
+}
+
+// parseContextFile parses a context file by its extension, or a URL's by
+// its path's: a dataset, or JSON.
+func parseContextFile(contextPath string, content []byte) (interface{}, error) {
+	if !isDatasetContext(contextPath) {
+		return parseContext(content)
+	}
+	if strings.EqualFold(filepath.Ext(templateName(contextPath)), ".csv") {
+		return parseCSVContext(content)
+	}
+	return parseNDJSONContext(content)
+}
+
+// parseCSVContext exposes a CSV file as .rows, one map per record keyed by
+// the header row, and the header itself as .columns. Values stay strings,
+// so identifiers such as zip codes keep their leading zeros. The byte order
+// mark spreadsheet exports start with is dropped.
+func parseCSVContext(content []byte) (interface{}, error) {
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(content, []byte("\ufeff"))))
+	reader.ReuseRecord = true
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return map[string]interface{}{datasetRowsKey: []interface{}{}, "columns": []interface{}{}}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse context CSV: %v", err)
+	}
+	columns := csvColumns(header)
+
+	rows := []interface{}{}
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse context CSV: %v", err)
+		}
+		row := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			row[column] = record[i]
+		}
+		rows = append(rows, row)
+	}
+
+	names := make([]interface{}, len(columns))
+	for i, column := range columns {
+		names[i] = column
+	}
+	return map[string]interface{}{datasetRowsKey: rows, "columns": names}, nil
+}
+
+// csvColumns turns a header row into keys. A blank header becomes
+// columnN, and a repeated one gets a _2, _3, ... suffix, so no value is
+// lost to another with the same key.
+func csvColumns(header []string) []string {
+	columns := make([]string, len(header))
+	seen := map[string]bool{}
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			name = "column" + strconv.Itoa(i+1)
+		}
+		column := name
+		for n := 2; seen[column]; n++ {
+			column = name + "_" + strconv.Itoa(n)
+		}
+		seen[column] = true
+		columns[i] = column
+	}
+	return columns
+}
+
+// parseNDJSONContext exposes newline-delimited JSON as .rows, one value per
+// non-blank line.
+func parseNDJSONContext(content []byte) (interface{}, error) {
+	rows := []interface{}{}
+	for i, line := range bytes.Split(content, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		var row interface{}
+		if err := json.Unmarshal(line, &row); err != nil {
+			return nil, fmt.Errorf("failed to parse context NDJSON line %d: %v", i+1, err)
+		}
+		rows = append(rows, row)
+	}
+	return map[string]interface{}{datasetRowsKey: rows}, nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCSVContextRendersRowsByHeader(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "report.tmpl")
+	writeFile(t, templatePath, `{{ range .rows }}{{ .name }}: {{ .zip }} {{ .column3 }} {{ .name_2 }}
+{{ end }}{{ len .columns }} columns`)
+	contextPath := filepath.Join(dir, "people.csv")
+	writeFile(t, contextPath, "\ufeffname,zip,,name\nAda,01234,x,\"Lovelace, A.\"\nAlan,02139,y,Turing\n")
+
+	resp := run(templatePath, contextPath, renderOptions{})
+	want := "Ada: 01234 x Lovelace, A.\nAlan: 02139 y Turing\n4 columns"
+	if resp.Error != "" || resp.Rendered != want {
+		t.Fatalf("expected %q, got %+v", want, resp)
+	}
+
+	// The server reads contexts through its pooled buffers.
+	if resp := run(templatePath, contextPath, renderOptions{cache: newTemplateCache()}); resp.Rendered != want {
+		t.Fatalf("expected the server to parse the CSV the same way, got %+v", resp)
+	}
+}
+
+func TestNDJSONContextRendersOneRowPerLine(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "report.tmpl")
+	writeFile(t, templatePath, `{{ range .rows }}{{ .event }}={{ .count }};{{ end }}`)
+	contextPath := filepath.Join(dir, "events.ndjson")
+	writeFile(t, contextPath, "{\"event\": \"open\", \"count\": 3}\n\n{\"event\": \"close\", \"count\": 1}\n")
+
+	if resp := run(templatePath, contextPath, renderOptions{}); resp.Error != "" || resp.Rendered != "open=3;close=1;" {
+		t.Fatalf("expected both rows, got %+v", resp)
+	}
+}
+
+func TestDatasetContextErrors(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "report.tmpl")
+	writeFile(t, templatePath, `{{ len .rows }}`)
+
+	ragged := filepath.Join(dir, "ragged.csv")
+	writeFile(t, ragged, "a,b\n1,2\n3\n")
+	if resp := run(templatePath, ragged, renderOptions{}); !strings.Contains(resp.Error, "line 3") {
+		t.Fatalf("expected the short record to be reported, got %+v", resp)
+	}
+
+	broken := filepath.Join(dir, "broken.jsonl")
+	writeFile(t, broken, "{\"a\": 1}\n{\"a\": \n")
+	if resp := run(templatePath, broken, renderOptions{}); !strings.Contains(resp.Error, "NDJSON line 2") {
+		t.Fatalf("expected the broken line to be reported, got %+v", resp)
+	}
+
+	empty := filepath.Join(dir, "empty.csv")
+	writeFile(t, empty, "")
+	if resp := run(templatePath, empty, renderOptions{}); resp.Error != "" || resp.Rendered != "0" {
+		t.Fatalf("expected an empty CSV to have no rows, got %+v", resp)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"text/template/parse"
+)
+
+// executeDefinition resolves the `{{template "name"}}` reference under the
+// cursor to the file and position where that template is defined.
+func executeDefinition(templatePath string, opts renderOptions) response {
+	if templatePath == "" {
+		return response{Error: "template path is required"}
+	}
+
+	content, err := readTemplate(templatePath, opts)
+	if err != nil {
+		return response{Error: err.Error()}
+	}
+
+	offset, err := cursorOffset(content, opts)
+	if err != nil {
+		return response{Error: err.Error()}
+	}
+
+	trees, err := parseTrees(templatePath, content)
+	if err != nil {
+		return response{
+			Diagnostics: []diagnostic{templateDiagnostic(err, templatePath, content)},
+			Error:       err.Error(),
+		}
+	}
+
+	name, ok := templateReferenceAt(content, trees, offset)
+	if !ok {
+		return response{}
+	}
+
+	var aliases map[string]string
+	if opts.project != nil {
+		aliases = opts.project.TemplateAliases
+	}
+	if location, ok := resolveAlias(name, aliases, path.Ext(templateName(templatePath))); ok {
+		if !isRemoteURL(location) {
+			if _, err := os.Stat(location); err != nil {
+				return response{Error: err.Error()}
+			}
+		}
+		return response{Definition: &sourceLocation{File: location, Line: 1, Column: 1}}
+	}
+
+	if location, ok := findDefinition(templatePath, content, name); ok {
+		return response{Definition: &location}
+	}
+
+	includes, _ := resolveAliasIncludes(templatePath, content, opts)
+	globbed, _ := resolveIncludePatterns(templatePath, opts)
+	includes = append(includes, globbed...)
+	for _, include := range includes {
+		if location, ok := findDefinition(include.Path, include.Content, name); ok {
+			return response{Definition: &location}
+		}
+	}
+
+	return response{}
+}
+
+// cursorOffset turns the requested line/column (in the negotiated encoding)
+// into a byte offset within content.
+func cursorOffset(content string, opts renderOptions) (int, error) {
+	column := decodeColumn(lineText(content, opts.Line), opts.Column, opts.PositionEncoding)
+	position, err := positionToOffset(content, opts.Line, column)
+	if err != nil {
+		return 0, err
+	}
+	return position.Offset, nil
+}
+
+// templateReferenceAt returns the template name invoked by the action
+// containing offset.
+func templateReferenceAt(content string, trees map[string]*parse.Tree, offset int) (string, bool) {
+	for _, action := range scanActions(content, "", "") {
+		if offset < action.Start || offset >= action.End {
+			continue
+		}
+		for _, ref := range templateReferences(trees) {
+			if int(ref.Pos) >= action.Start && int(ref.Pos) < action.End {
+				return ref.Name, true
+			}
+		}
+		if keyword := action.Keyword(); keyword == "block" {
+			return quotedActionArgument(action)
+		}
+		return "", false
+	}
+	return "", false
+}
+
+// findDefinition locates the `{{define "name"}}` or `{{block "name"}}`
+// action declaring name.
+func findDefinition(path, content, name string) (sourceLocation, bool) {
+	for _, action := range scanActions(content, "", "") {
+		switch action.Keyword() {
+		case "define", "block":
+		default:
+			continue
+		}
+		if declared, ok := quotedActionArgument(action); ok && declared == name {
+			line, column := lineColumn(content, parse.Pos(action.Start))
+			return sourceLocation{File: path, Line: line, Column: column}, true
+		}
+	}
+	return sourceLocation{}, false
+}
+
+func quotedActionArgument(action actionSpan) (string, bool) {
+	rest := strings.TrimSpace(strings.TrimPrefix(action.Body(), action.Keyword()))
+	if rest == "" {
+		return "", false
+	}
+	quoted, err := strconv.QuotedPrefix(rest)
+	if err != nil {
+		return "", false
+	}
+	name, err := strconv.Unquote(quoted)
+	return name, err == nil
+}
+
+// quotedArgumentSpan returns the byte range in content of the quoted name
+// after the action's keyword, quotes included.
+func quotedArgumentSpan(content string, action actionSpan) (int, int, bool) {
+	keyword := action.Keyword()
+	at := strings.Index(content[action.Start:action.End], keyword)
+	if keyword == "" || at < 0 {
+		return 0, 0, false
+	}
+	rest := content[action.Start+at+len(keyword) : action.End]
+	start := action.End - len(strings.TrimLeft(rest, " \t\r\n"))
+	quoted, err := strconv.QuotedPrefix(content[start:action.End])
+	if err != nil {
+		return 0, 0, false
+	}
+	return start, start + len(quoted), true
+}
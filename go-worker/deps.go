@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"text/template/parse"
+)
+
+// dependencyGraph is the result of deps mode: the templates defined by the
+// template and its includes, the {{template}} and {{block}} calls between
+// them, and the calls to names nothing defines.
+type dependencyGraph struct {
+	Nodes      []dependencyNode `json:"nodes"`
+	Edges      []dependencyEdge `json:"edges"`
+	Unresolved []dependencyEdge `json:"unresolved"`
+}
+
+// dependencyNode is one template name and the definition that wins it.
+// Kind is file for the template a file's top level defines, or define or
+// block.
+type dependencyNode struct {
+	Name   string `json:"name"`
+	Kind   string `json:"kind"`
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+}
+
+// dependencyEdge is a call from the template From to the template To, at
+// File:Line:Column. Kind is template or block.
+type dependencyEdge struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Kind   string `json:"kind"`
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+}
+
+// executeDeps resolves the template and block calls of the template, its
+// aliased includes, and its --include files into a dependency graph, and
+// warns about every call to a template none of them defines.
+func executeDeps(templatePath string, opts renderOptions) response {
+	if templatePath == "" {
+		return response{Error: "template path is required"}
+	}
+	content, err := readTemplate(templatePath, opts)
+	if err != nil {
+		return response{Error: err.Error()}
+	}
+	main := templateSource{Name: templateName(templatePath), Path: templatePath, Content: content}
+	if _, err := parseTreesWithDelims(main.Name, content, opts.LeftDelim, opts.RightDelim); err != nil {
+		return response{
+			Diagnostics: []diagnostic{templateDiagnosticWithDelims(err, templatePath, content, opts.LeftDelim, opts.RightDelim)},
+			Error:       err.Error(),
+		}
+	}
+	aliased, diagnostics := resolveAliasIncludes(templatePath, content, opts)
+	globbed, warnings := resolveIncludePatterns(templatePath, opts)
+	diagnostics = append(diagnostics, warnings...)
+	sources := append([]templateSource{main}, orderIncludes(append(aliased, globbed...), opts.IncludePriority)...)
+
+	graph, warnings := buildDependencyGraph(sources, opts)
+	return response{Deps: graph, Diagnostics: append(diagnostics, warnings...)}
+}
+
+// buildDependencyGraph parses sources in order. A name defined more than
+// once is won by its last non-empty definition, as text/template resolves
+// it, and only the winner's calls are edges. Sources that do not parse are
+// reported and left out.
+func buildDependencyGraph(sources []templateSource, opts renderOptions) (*dependencyGraph, []diagnostic) {
+	type definition struct {
+		node   dependencyNode
+		source templateSource
+		tree   *parse.Tree
+		empty  bool
+	}
+	var diagnostics []diagnostic
+	var names []string
+	winners := map[string]definition{}
+	for _, source := range sources {
+		trees, err := parseTreesWithDelims(source.Name, source.Content, opts.LeftDelim, opts.RightDelim)
+		if err != nil {
+			diagnostics = append(diagnostics, templateDiagnosticWithDelims(err, source.Path, source.Content, opts.LeftDelim, opts.RightDelim))
+			continue
+		}
+		actions := scanActions(source.Content, opts.LeftDelim, opts.RightDelim)
+		for _, treeName := range sortedTreeNames(trees, source.Name) {
+			node := dependencyNode{Name: treeName, Kind: "file", File: source.Path, Line: 1, Column: 1}
+			if treeName != source.Name {
+				node.Kind = "define"
+				for _, action := range actions {
+					keyword := action.Keyword()
+					if keyword != "define" && keyword != "block" {
+						continue
+					}
+					if declared, ok := quotedActionArgument(action); ok && declared == treeName {
+						node.Kind = keyword
+						node.Line, node.Column = lineColumn(source.Content, parse.Pos(action.Start))
+						break
+					}
+				}
+			}
+			current := definition{node: node, source: source, tree: trees[treeName], empty: parse.IsEmptyTree(trees[treeName].Root)}
+			previous, ok := winners[treeName]
+			if !ok {
+				names = append(names, treeName)
+			}
+			if !ok || !current.empty || previous.empty {
+				winners[treeName] = current
+			}
+		}
+	}
+
+	graph := &dependencyGraph{Nodes: []dependencyNode{}, Edges: []dependencyEdge{}, Unresolved: []dependencyEdge{}}
+	for _, name := range names {
+		graph.Nodes = append(graph.Nodes, winners[name].node)
+	}
+	for _, name := range names {
+		winner := winners[name]
+		actions := scanActions(winner.source.Content, opts.LeftDelim, opts.RightDelim)
+		walkNodes(winner.tree.Root, func(node parse.Node) bool {
+			call, ok := node.(*parse.TemplateNode)
+			if !ok {
+				return true
+			}
+			edge := dependencyEdge{From: name, To: call.Name, Kind: "template", File: winner.source.Path}
+			edge.Line, edge.Column = lineColumn(winner.source.Content, call.Position())
+			if action, ok := enclosingAction(actions, call.Position()); ok && action.Keyword() == "block" {
+				edge.Kind = "block"
+			}
+			graph.Edges = append(graph.Edges, edge)
+			if _, defined := winners[call.Name]; !defined {
+				graph.Unresolved = append(graph.Unresolved, edge)
+				diagnostics = append(diagnostics, diagnostic{
+					Message:  fmt.Sprintf("template %q is not defined in the template or its includes", call.Name),
+					Severity: "warning",
+					File:     edge.File,
+					Line:     edge.Line,
+					Column:   edge.Column,
+				})
+			}
+			return true
+		})
+	}
+	return graph, diagnostics
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDepsResolvesCallsAcrossIncludesAndReportsUnresolved(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "page.tmpl")
+	writeFile(t, templatePath, "{{ template \"layout\" . }}\n{{ block \"sidebar\" . }}{{ template \"missing\" }}{{ end }}\n{{ define \"card\" }}old{{ template \"gone\" }}{{ end }}")
+	writeFile(t, filepath.Join(dir, "partials", "layout.tmpl"), "{{ define \"layout\" }}{{ template \"card\" . }}{{ end }}{{ define \"card\" }}new{{ end }}")
+
+	resp := run(templatePath, "", renderOptions{Mode: "deps", Includes: []string{filepath.Join(dir, "partials", "*.tmpl")}})
+	if resp.Error != "" || resp.Deps == nil {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	var nodes []string
+	for _, node := range resp.Deps.Nodes {
+		nodes = append(nodes, fmt.Sprintf("%s:%s:%s:%d", node.Name, node.Kind, filepath.Base(node.File), node.Line))
+	}
+	if got := strings.Join(nodes, " "); got != "page.tmpl:file:page.tmpl:1 card:define:layout.tmpl:1 sidebar:block:page.tmpl:2 layout.tmpl:file:layout.tmpl:1 layout:define:layout.tmpl:1" {
+		t.Fatalf("unexpected nodes: %s", got)
+	}
+	var edges []string
+	for _, edge := range resp.Deps.Edges {
+		edges = append(edges, fmt.Sprintf("%s->%s:%s", edge.From, edge.To, edge.Kind))
+	}
+	if got := strings.Join(edges, " "); got != "page.tmpl->layout:template page.tmpl->sidebar:block sidebar->missing:template layout->card:template" {
+		t.Fatalf("unexpected edges: %s", got)
+	}
+
+	if len(resp.Deps.Unresolved) != 1 || resp.Deps.Unresolved[0].To != "missing" || resp.Deps.Unresolved[0].Line != 2 || resp.Deps.Unresolved[0].Column != 36 {
+		t.Fatalf("unexpected unresolved calls: %+v", resp.Deps.Unresolved)
+	}
+	if len(resp.Diagnostics) != 1 || resp.Diagnostics[0].Severity != "warning" || !strings.Contains(resp.Diagnostics[0].Message, `template "missing" is not defined`) {
+		t.Fatalf("expected a warning for the unresolved call, got %+v", resp.Diagnostics)
+	}
+}
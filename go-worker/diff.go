@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const diffContextLines = 3
+
+type diffKind byte
+
+const (
+	diffEqual  diffKind = ' '
+	diffDelete diffKind = '-'
+	diffInsert diffKind = '+'
+)
+
+type diffOp struct {
+	Kind diffKind
+	Line string
+}
+
+// diffLines computes a shortest edit script between a and b using Myers'
+// O(ND) algorithm.
+func diffLines(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	maxEdits := n + m
+	offset := maxEdits + 1
+	v := make([]int, 2*maxEdits+3)
+
+	var trace [][]int
+	for d := 0; d <= maxEdits; d++ {
+		snapshot := make([]int, len(v))
+		copy(snapshot, v)
+		trace = append(trace, snapshot)
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrackDiff(trace, a, b, offset)
+			}
+		}
+	}
+
+	return nil
+}
+
+func backtrackDiff(trace [][]int, a, b []string, offset int) []diffOp {
+	x, y := len(a), len(b)
+	var ops []diffOp
+
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			ops = append(ops, diffOp{Kind: diffEqual, Line: a[x-1]})
+			x--
+			y--
+		}
+
+		if d > 0 {
+			if x == prevX {
+				ops = append(ops, diffOp{Kind: diffInsert, Line: b[y-1]})
+				y--
+			} else {
+				ops = append(ops, diffOp{Kind: diffDelete, Line: a[x-1]})
+				x--
+			}
+		}
+	}
+
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// unifiedDiff renders the difference between from and to in unified diff
+// format. It returns an empty string when the texts are identical.
+func unifiedDiff(fromName, toName, from, to string) string {
+	if from == to {
+		return ""
+	}
+
+	ops := diffLines(splitLines(from), splitLines(to))
+
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "--- %s\n+++ %s\n", fromName, toName)
+
+	// Line numbers (0-based) in a and b at the start of every op.
+	aLines := make([]int, len(ops)+1)
+	bLines := make([]int, len(ops)+1)
+	for i, op := range ops {
+		aLines[i+1], bLines[i+1] = aLines[i], bLines[i]
+		if op.Kind != diffInsert {
+			aLines[i+1]++
+		}
+		if op.Kind != diffDelete {
+			bLines[i+1]++
+		}
+	}
+
+	for start := 0; start < len(ops); {
+		if ops[start].Kind == diffEqual {
+			start++
+			continue
+		}
+
+		hunkStart := start - diffContextLines
+		if hunkStart < 0 {
+			hunkStart = 0
+		}
+		hunkEnd := start
+		for hunkEnd < len(ops) {
+			if ops[hunkEnd].Kind != diffEqual {
+				hunkEnd++
+				continue
+			}
+			run := hunkEnd
+			for run < len(ops) && ops[run].Kind == diffEqual {
+				run++
+			}
+			if run == len(ops) || run-hunkEnd > 2*diffContextLines {
+				hunkEnd += diffContextLines
+				if hunkEnd > len(ops) {
+					hunkEnd = len(ops)
+				}
+				break
+			}
+			hunkEnd = run
+		}
+
+		fmt.Fprintf(&builder, "@@ -%s +%s @@\n",
+			hunkRange(aLines[hunkStart], aLines[hunkEnd]-aLines[hunkStart]),
+			hunkRange(bLines[hunkStart], bLines[hunkEnd]-bLines[hunkStart]))
+		for _, op := range ops[hunkStart:hunkEnd] {
+			builder.WriteByte(byte(op.Kind))
+			builder.WriteString(op.Line)
+			if !strings.HasSuffix(op.Line, "\n") {
+				builder.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+
+		start = hunkEnd
+	}
+
+	return builder.String()
+}
+
+func hunkRange(start, length int) string {
+	if length == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if length == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, length)
+}
+
+// splitLines splits text into lines that keep their "\n" terminators.
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+func TestUnifiedDiffReportsChangedLinesWithContext(t *testing.T) {
+	from := "one\ntwo\nthree\nfour\nfive\nsix\nseven\neight\n"
+	to := "one\ntwo\nthree\nFOUR\nfive\nsix\nseven\neight\nnine\n"
+
+	got := unifiedDiff("a", "b", from, to)
+	want := "--- a\n+++ b\n" +
+		"@@ -1,8 +1,9 @@\n" +
+		" one\n two\n three\n-four\n+FOUR\n five\n six\n seven\n eight\n+nine\n"
+	if got != want {
+		t.Fatalf("unexpected diff:\n%s", got)
+	}
+}
+
+func TestUnifiedDiffSplitsDistantChangesIntoHunks(t *testing.T) {
+	from := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\n"
+	to := "A\nb\nc\nd\ne\nf\ng\nh\ni\nJ"
+
+	got := unifiedDiff("old", "new", from, to)
+	want := "--- old\n+++ new\n" +
+		"@@ -1,4 +1,4 @@\n-a\n+A\n b\n c\n d\n" +
+		"@@ -7,4 +7,4 @@\n g\n h\n i\n-j\n+J\n\\ No newline at end of file\n"
+	if got != want {
+		t.Fatalf("unexpected diff:\n%s", got)
+	}
+}
+
+func TestUnifiedDiffIsEmptyForIdenticalText(t *testing.T) {
+	if got := unifiedDiff("a", "b", "same\n", "same\n"); got != "" {
+		t.Fatalf("expected no diff, got %q", got)
+	}
+}
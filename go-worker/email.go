@@ -0,0 +1,393 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/http"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// base64LineLength is the longest encoded line RFC 2045 allows.
+const base64LineLength = 76
+
+// cidReferencePattern finds cid: URLs in rendered HTML, such as
+// src="cid:logo".
+var cidReferencePattern = regexp.MustCompile(`(?i)["'(]cid:([^"')\s]+)`)
+
+// emailManifest lists the addresses, extra headers, and files of an email.
+// Attachment paths are relative to the manifest.
+type emailManifest struct {
+	From        string            `json:"from,omitempty"`
+	To          []string          `json:"to,omitempty"`
+	Cc          []string          `json:"cc,omitempty"`
+	ReplyTo     string            `json:"replyTo,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	Attachments []emailAttachment `json:"attachments,omitempty"`
+}
+
+// emailAttachment is a file sent with the email. Files with a CID are
+// inline images the HTML shows through src="cid:<cid>"; the rest are
+// ordinary attachments. Name and ContentType default to the file's base
+// name and a type guessed from its extension or content.
+type emailAttachment struct {
+	Path        string `json:"path"`
+	Name        string `json:"name,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+	CID         string `json:"cid,omitempty"`
+
+	content []byte
+}
+
+// mimeEntity is a MIME body part: a leaf with encoded content, or a
+// multipart of the given subtype.
+type mimeEntity struct {
+	header   textproto.MIMEHeader
+	body     []byte
+	subtype  string
+	children []mimeEntity
+}
+
+// executeEmail renders the HTML body, and the optional subject and text
+// alternative, and assembles them with the manifest's attachments into an
+// RFC 5322 message returned in rendered and, with --eml-file, written out.
+// With --send-test the message is addressed to the --to recipients instead
+// of the manifest's and delivered through --smtp.
+func executeEmail(templatePath, contextPath string, opts renderOptions) response {
+	html := executeWithOptions(templatePath, contextPath, opts)
+	if html.Error != "" {
+		return html
+	}
+	diagnostics := html.Diagnostics
+
+	var subject, text string
+	if strings.TrimSpace(opts.SubjectTemplate) != "" {
+		resp := executeWithOptions(opts.SubjectTemplate, contextPath, opts)
+		diagnostics = append(diagnostics, resp.Diagnostics...)
+		if resp.Error != "" {
+			return response{Diagnostics: diagnostics, Error: resp.Error}
+		}
+		subject = strings.TrimSpace(resp.Rendered)
+		if strings.ContainsAny(subject, "\r\n") {
+			message := "subject template renders more than one line"
+			return response{Diagnostics: append(diagnostics, diagnostic{Message: message, Severity: "error", File: opts.SubjectTemplate}), Error: message}
+		}
+	}
+	if strings.TrimSpace(opts.TextTemplate) != "" {
+		resp := executeWithOptions(opts.TextTemplate, contextPath, opts)
+		diagnostics = append(diagnostics, resp.Diagnostics...)
+		if resp.Error != "" {
+			return response{Diagnostics: diagnostics, Error: resp.Error}
+		}
+		text = resp.Rendered
+	}
+
+	var recipients []string
+	if opts.SendTest {
+		var err error
+		if recipients, err = testRecipients(opts.SendTo); err != nil {
+			return response{Diagnostics: diagnostics, Error: err.Error()}
+		}
+	}
+
+	var manifest emailManifest
+	if strings.TrimSpace(opts.EmailManifest) != "" {
+		loaded, err := loadEmailManifest(opts.EmailManifest)
+		if err != nil {
+			return response{Diagnostics: append(diagnostics, diagnostic{Message: err.Error(), Severity: "error", File: opts.EmailManifest}), Error: err.Error()}
+		}
+		manifest = loaded
+		diagnostics = append(diagnostics, cidDiagnostics(html.Rendered, manifest, templatePath, opts.EmailManifest)...)
+	}
+
+	if opts.SendTest {
+		manifest.To, manifest.Cc = opts.SendTo, nil
+	}
+
+	message, err := assembleEmail(subject, html.Rendered, text, manifest)
+	if err != nil {
+		return response{Diagnostics: append(diagnostics, diagnostic{Message: err.Error(), Severity: "error", File: opts.EmailManifest}), Error: err.Error()}
+	}
+
+	resp := response{Rendered: string(message), Diagnostics: diagnostics, Timings: html.Timings, CacheHit: html.CacheHit}
+	if strings.TrimSpace(opts.EMLFile) != "" {
+		if err := os.WriteFile(opts.EMLFile, message, 0o644); err != nil {
+			resp.Error = err.Error()
+			return resp
+		}
+		resp.EMLFile = opts.EMLFile
+	}
+	if opts.SendTest {
+		if err := sendTestEmail(opts.SMTP, envelopeSender(manifest.From), recipients, message); err != nil {
+			resp.Error = err.Error()
+			return resp
+		}
+		resp.SentTo = recipients
+	}
+	return resp
+}
+
+// loadEmailManifest reads the manifest and the files it lists.
+func loadEmailManifest(path string) (emailManifest, error) {
+	var manifest emailManifest
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return manifest, err
+	}
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return manifest, fmt.Errorf("email manifest %s is not valid JSON: %v", path, err)
+	}
+
+	seen := map[string]bool{}
+	for i := range manifest.Attachments {
+		attachment := &manifest.Attachments[i]
+		if strings.TrimSpace(attachment.Path) == "" {
+			return manifest, fmt.Errorf("attachment %d in %s has no path", i+1, path)
+		}
+		if attachment.CID != "" {
+			if seen[attachment.CID] {
+				return manifest, fmt.Errorf("cid %q is used by more than one attachment", attachment.CID)
+			}
+			seen[attachment.CID] = true
+		}
+
+		file := attachment.Path
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(filepath.Dir(path), file)
+		}
+		if attachment.content, err = os.ReadFile(file); err != nil {
+			return manifest, err
+		}
+		if attachment.Name == "" {
+			attachment.Name = filepath.Base(file)
+		}
+		if attachment.ContentType == "" {
+			attachment.ContentType = mime.TypeByExtension(filepath.Ext(file))
+		}
+		if attachment.ContentType == "" {
+			attachment.ContentType = http.DetectContentType(attachment.content)
+		}
+	}
+	return manifest, nil
+}
+
+// cidDiagnostics warns about cid: references in the HTML with no inline
+// image behind them, and inline images the HTML never shows.
+func cidDiagnostics(html string, manifest emailManifest, templatePath, manifestPath string) []diagnostic {
+	referenced := map[string]bool{}
+	for _, match := range cidReferencePattern.FindAllStringSubmatch(html, -1) {
+		referenced[match[1]] = true
+	}
+
+	inline := map[string]bool{}
+	var diagnostics []diagnostic
+	for _, attachment := range manifest.Attachments {
+		if attachment.CID == "" {
+			continue
+		}
+		inline[attachment.CID] = true
+		if !referenced[attachment.CID] {
+			diagnostics = append(diagnostics, diagnostic{
+				Message:  fmt.Sprintf("inline image %s is never shown: the HTML has no cid:%s reference", attachment.Path, attachment.CID),
+				Severity: "warning",
+				File:     manifestPath,
+			})
+		}
+	}
+
+	var missing []string
+	for cid := range referenced {
+		if !inline[cid] {
+			missing = append(missing, cid)
+		}
+	}
+	sort.Strings(missing)
+	for _, cid := range missing {
+		diagnostics = append(diagnostics, diagnostic{
+			Message:  fmt.Sprintf("rendered HTML references cid:%s, but the manifest has no attachment with that cid", cid),
+			Severity: "warning",
+			File:     templatePath,
+		})
+	}
+	return diagnostics
+}
+
+// assembleEmail builds the message. The HTML is wrapped in
+// multipart/related with its inline images, offered alongside the text in
+// multipart/alternative, and placed first in multipart/mixed when there are
+// attachments; each layer is left out when it would hold a single part.
+func assembleEmail(subject, html, text string, manifest emailManifest) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeEmailHeaders(&buf, subject, manifest); err != nil {
+		return nil, err
+	}
+
+	body := textEntity("text/html", html)
+	var inline, attached []mimeEntity
+	for _, attachment := range manifest.Attachments {
+		if attachment.CID != "" {
+			inline = append(inline, fileEntity(attachment, "inline"))
+		} else {
+			attached = append(attached, fileEntity(attachment, "attachment"))
+		}
+	}
+	if len(inline) > 0 {
+		body = mimeEntity{subtype: "related", children: append([]mimeEntity{body}, inline...)}
+	}
+	if text != "" {
+		body = mimeEntity{subtype: "alternative", children: []mimeEntity{textEntity("text/plain", text), body}}
+	}
+	if len(attached) > 0 {
+		body = mimeEntity{subtype: "mixed", children: append([]mimeEntity{body}, attached...)}
+	}
+
+	header, content, err := body.encode()
+	if err != nil {
+		return nil, err
+	}
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	writeMIMEHeader(&buf, header)
+	buf.WriteString("\r\n")
+	buf.Write(content)
+	return buf.Bytes(), nil
+}
+
+func writeEmailHeaders(buf *bytes.Buffer, subject string, manifest emailManifest) error {
+	addresses := []struct {
+		name  string
+		value []string
+	}{
+		{"From", nonEmpty(manifest.From)},
+		{"Reply-To", nonEmpty(manifest.ReplyTo)},
+		{"To", manifest.To},
+		{"Cc", manifest.Cc},
+	}
+	for _, header := range addresses {
+		if len(header.value) == 0 {
+			continue
+		}
+		list, err := mail.ParseAddressList(strings.Join(header.value, ", "))
+		if err != nil {
+			return fmt.Errorf("invalid %s address: %v", header.name, err)
+		}
+		formatted := make([]string, len(list))
+		for i, address := range list {
+			formatted[i] = address.String()
+		}
+		fmt.Fprintf(buf, "%s: %s\r\n", header.name, strings.Join(formatted, ", "))
+	}
+
+	if subject != "" {
+		fmt.Fprintf(buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	}
+	fmt.Fprintf(buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+
+	names := make([]string, 0, len(manifest.Headers))
+	for name := range manifest.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := manifest.Headers[name]
+		if strings.ContainsAny(name, ": \r\n") || strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("header %q must be a single line with no colon or space in its name", name)
+		}
+		fmt.Fprintf(buf, "%s: %s\r\n", textproto.CanonicalMIMEHeaderKey(name), mime.QEncoding.Encode("utf-8", value))
+	}
+	return nil
+}
+
+func nonEmpty(value string) []string {
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+	return []string{value}
+}
+
+// encode returns the entity's headers and encoded body.
+func (e mimeEntity) encode() (textproto.MIMEHeader, []byte, error) {
+	if e.subtype == "" {
+		return e.header, e.body, nil
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for _, child := range e.children {
+		header, content, err := child.encode()
+		if err != nil {
+			return nil, nil, err
+		}
+		part, err := writer.CreatePart(header)
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, err := part.Write(content); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, nil, err
+	}
+
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", mime.FormatMediaType("multipart/"+e.subtype, map[string]string{"boundary": writer.Boundary()}))
+	return header, body.Bytes(), nil
+}
+
+// textEntity encodes text as quoted-printable UTF-8 with CRLF line breaks.
+func textEntity(mediaType, text string) mimeEntity {
+	var body bytes.Buffer
+	writer := quotedprintable.NewWriter(&body)
+	_, _ = writer.Write([]byte(text))
+	_ = writer.Close()
+
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", mime.FormatMediaType(mediaType, map[string]string{"charset": "utf-8"}))
+	header.Set("Content-Transfer-Encoding", "quoted-printable")
+	return mimeEntity{header: header, body: body.Bytes()}
+}
+
+// fileEntity encodes an attachment as base64 with the given disposition.
+func fileEntity(attachment emailAttachment, disposition string) mimeEntity {
+	encoded := base64.StdEncoding.EncodeToString(attachment.content)
+	var body bytes.Buffer
+	for len(encoded) > base64LineLength {
+		body.WriteString(encoded[:base64LineLength] + "\r\n")
+		encoded = encoded[base64LineLength:]
+	}
+	body.WriteString(encoded + "\r\n")
+
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", attachment.ContentType)
+	header.Set("Content-Transfer-Encoding", "base64")
+	header.Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": attachment.Name}))
+	if attachment.CID != "" {
+		header.Set("Content-ID", "<"+attachment.CID+">")
+	}
+	return mimeEntity{header: header, body: body.Bytes()}
+}
+
+// writeMIMEHeader writes header fields in sorted order.
+func writeMIMEHeader(buf *bytes.Buffer, header textproto.MIMEHeader) {
+	keys := make([]string, 0, len(header))
+	for key := range header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, value := range header[key] {
+			fmt.Fprintf(buf, "%s: %s\r\n", key, value)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEmailAssemblesMultipartMessage(t *testing.T) {
+	dir := t.TempDir()
+	htmlPath := filepath.Join(dir, "welcome.html")
+	writeFile(t, htmlPath, `<p>Hi {{ .name }}</p><img src="cid:logo">`)
+	textPath := filepath.Join(dir, "welcome.txt.tmpl")
+	writeFile(t, textPath, "Hi {{ .name }}\n")
+	subjectPath := filepath.Join(dir, "subject.tmpl")
+	writeFile(t, subjectPath, "Welcome, {{ .name }} ✓\n")
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, contextPath, `{"name": "Zoë <admin>"}`)
+	writeFile(t, filepath.Join(dir, "assets", "logo.png"), "\x89PNG\r\n\x1a\nfake")
+	writeFile(t, filepath.Join(dir, "assets", "terms.pdf"), "%PDF-1.4 fake")
+	manifestPath := filepath.Join(dir, "email.json")
+	writeFile(t, manifestPath, `{
+		"from": "Studio <studio@example.com>",
+		"to": ["zoe@example.com"],
+		"headers": {"x-campaign": "welcome"},
+		"attachments": [
+			{"path": "assets/logo.png", "cid": "logo"},
+			{"path": "assets/terms.pdf", "name": "Terms.pdf"}
+		]
+	}`)
+	emlPath := filepath.Join(dir, "welcome.eml")
+
+	resp := run(htmlPath, contextPath, renderOptions{
+		Mode:            "email",
+		TextTemplate:    textPath,
+		SubjectTemplate: subjectPath,
+		EmailManifest:   manifestPath,
+		EMLFile:         emlPath,
+	})
+	if resp.Error != "" || len(resp.Diagnostics) != 0 || resp.EMLFile != emlPath {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	written, err := os.ReadFile(emlPath)
+	if err != nil || string(written) != resp.Rendered {
+		t.Fatalf("expected the message to be written to %s: %v", emlPath, err)
+	}
+
+	message, err := mail.ReadMessage(strings.NewReader(resp.Rendered))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, _ := new(mime.WordDecoder).DecodeHeader(message.Header.Get("Subject"))
+	if subject != "Welcome, Zoë <admin> ✓" || message.Header.Get("From") != `"Studio" <studio@example.com>` || message.Header.Get("X-Campaign") != "welcome" {
+		t.Fatalf("unexpected headers: %v", message.Header)
+	}
+
+	mixed := multipartParts(t, message.Header.Get("Content-Type"), message.Body, "multipart/mixed")
+	if len(mixed) != 2 || !strings.Contains(mixed[1].disposition, `filename=Terms.pdf`) || mixed[1].mediaType != "application/pdf" {
+		t.Fatalf("unexpected mixed parts: %+v", mixed)
+	}
+	alternative := multipartParts(t, mixed[0].contentType, strings.NewReader(mixed[0].body), "multipart/alternative")
+	if len(alternative) != 2 || alternative[0].mediaType != "text/plain" || alternative[0].body != "Hi Zoë <admin>\r\n" {
+		t.Fatalf("unexpected alternative parts: %+v", alternative)
+	}
+	related := multipartParts(t, alternative[1].contentType, strings.NewReader(alternative[1].body), "multipart/related")
+	if len(related) != 2 || related[0].body != `<p>Hi Zoë &lt;admin&gt;</p><img src="cid:logo">` || related[1].contentID != "<logo>" || related[1].mediaType != "image/png" {
+		t.Fatalf("unexpected related parts: %+v", related)
+	}
+}
+
+func TestEmailWarnsAboutUnmatchedCIDs(t *testing.T) {
+	dir := t.TempDir()
+	htmlPath := filepath.Join(dir, "welcome.html")
+	writeFile(t, htmlPath, `<img src="cid:banner">`)
+	writeFile(t, filepath.Join(dir, "logo.png"), "png")
+	manifestPath := filepath.Join(dir, "email.json")
+	writeFile(t, manifestPath, `{"attachments": [{"path": "logo.png", "cid": "logo"}]}`)
+
+	resp := run(htmlPath, "", renderOptions{Mode: "email", EmailManifest: manifestPath})
+	if resp.Error != "" || len(resp.Diagnostics) != 2 ||
+		resp.Diagnostics[0].Message != "inline image logo.png is never shown: the HTML has no cid:logo reference" ||
+		resp.Diagnostics[1].Message != "rendered HTML references cid:banner, but the manifest has no attachment with that cid" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	writeFile(t, manifestPath, `{"to": ["not an address"]}`)
+	resp = run(htmlPath, "", renderOptions{Mode: "email", EmailManifest: manifestPath})
+	if !strings.HasPrefix(resp.Error, "invalid To address") {
+		t.Fatalf("expected an address error, got %+v", resp)
+	}
+}
+
+type emailPart struct {
+	contentType string
+	mediaType   string
+	disposition string
+	contentID   string
+	body        string
+}
+
+func multipartParts(t *testing.T, contentType string, body io.Reader, want string) []emailPart {
+	t.Helper()
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != want {
+		t.Fatalf("expected %s, got %q (%v)", want, contentType, err)
+	}
+
+	var parts []emailPart
+	reader := multipart.NewReader(body, params["boundary"])
+	for {
+		part, err := reader.NextRawPart()
+		if err == io.EOF {
+			return parts
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		var content io.Reader = part
+		if part.Header.Get("Content-Transfer-Encoding") == "quoted-printable" {
+			content = quotedprintable.NewReader(part)
+		}
+		raw, err := io.ReadAll(content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		partType := part.Header.Get("Content-Type")
+		media, _, _ := mime.ParseMediaType(partType)
+		parts = append(parts, emailPart{
+			contentType: partType,
+			mediaType:   media,
+			disposition: part.Header.Get("Content-Disposition"),
+			contentID:   part.Header.Get("Content-Id"),
+			body:        string(raw),
+		})
+	}
+}
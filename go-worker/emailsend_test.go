@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"net/mail"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// capturedMail is what fakeSMTPServer received.
+type capturedMail struct {
+	from       string
+	recipients []string
+	data       string
+}
+
+// fakeSMTPServer accepts one SMTP session on a local port, like a capture
+// server such as MailHog, and reports what it received.
+func fakeSMTPServer(t *testing.T) (string, <-chan capturedMail) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	received := make(chan capturedMail, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+		var captured capturedMail
+		reply("220 localhost ready")
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			command := strings.TrimRight(line, "\r\n")
+			switch verb := strings.ToUpper(strings.SplitN(command, " ", 2)[0]); verb {
+			case "EHLO":
+				reply("250 localhost")
+			case "MAIL":
+				captured.from = strings.Trim(strings.TrimPrefix(command, "MAIL FROM:"), "<>")
+				reply("250 ok")
+			case "RCPT":
+				captured.recipients = append(captured.recipients, strings.Trim(strings.TrimPrefix(command, "RCPT TO:"), "<>"))
+				reply("250 ok")
+			case "DATA":
+				reply("354 go ahead")
+				var data strings.Builder
+				for {
+					line, err := reader.ReadString('\n')
+					if err != nil || line == ".\r\n" {
+						break
+					}
+					data.WriteString(line)
+				}
+				captured.data = data.String()
+				reply("250 queued")
+			case "QUIT":
+				reply("221 bye")
+				received <- captured
+				return
+			default:
+				reply("502 unsupported")
+			}
+		}
+	}()
+	return "smtp://" + listener.Addr().String(), received
+}
+
+func TestEmailSendTestDeliversToTestRecipientsOnly(t *testing.T) {
+	dir := t.TempDir()
+	htmlPath := filepath.Join(dir, "welcome.html")
+	writeFile(t, htmlPath, `<p>Hi {{ .name }}</p>`)
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, contextPath, `{"name": "Ada"}`)
+	manifestPath := filepath.Join(dir, "email.json")
+	writeFile(t, manifestPath, `{"from": "Studio <studio@example.com>", "to": ["customer@example.com"], "cc": ["boss@example.com"]}`)
+
+	smtpURL, received := fakeSMTPServer(t)
+	resp := run(htmlPath, contextPath, renderOptions{
+		Mode:          "email",
+		EmailManifest: manifestPath,
+		SendTest:      true,
+		SMTP:          smtpURL,
+		SendTo:        []string{"Me <me@example.com>"},
+	})
+	if resp.Error != "" || !reflect.DeepEqual(resp.SentTo, []string{"me@example.com"}) {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	captured := <-received
+	if captured.from != "studio@example.com" || !reflect.DeepEqual(captured.recipients, []string{"me@example.com"}) {
+		t.Fatalf("unexpected envelope: %+v", captured)
+	}
+	message, err := mail.ReadMessage(strings.NewReader(captured.data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if message.Header.Get("To") != `"Me" <me@example.com>` || message.Header.Get("Cc") != "" {
+		t.Fatalf("expected the test recipient to replace To and Cc, got %v", message.Header)
+	}
+}
+
+func TestEmailSendTestReportsMissingRecipientsAndBadServers(t *testing.T) {
+	dir := t.TempDir()
+	htmlPath := filepath.Join(dir, "welcome.html")
+	writeFile(t, htmlPath, `<p>Hi</p>`)
+
+	resp := run(htmlPath, "", renderOptions{Mode: "email", SendTest: true})
+	if resp.Error != "--send-test needs at least one --to address" {
+		t.Fatalf("expected a recipient error, got %+v", resp)
+	}
+
+	resp = run(htmlPath, "", renderOptions{Mode: "email", SendTest: true, SMTP: "http://localhost", SendTo: []string{"me@example.com"}})
+	if !strings.HasPrefix(resp.Error, "--smtp must be a URL such as smtp://localhost:1025") || resp.Rendered == "" {
+		t.Fatalf("expected a URL error alongside the message, got %+v", resp)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// templateB64Enc encodes value as standard, padded base64.
+func templateB64Enc(value interface{}) string {
+	return base64.StdEncoding.EncodeToString([]byte(toString(value)))
+}
+
+// templateB64Dec decodes standard base64, with or without padding. Unlike
+// Sprig's, which writes the error into the output, invalid input fails the
+// render.
+func templateB64Dec(value interface{}) (string, error) {
+	encoded := strings.TrimSpace(toString(value))
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		var rawErr error
+		if decoded, rawErr = base64.RawStdEncoding.DecodeString(encoded); rawErr != nil {
+			return "", fmt.Errorf("b64dec: %v", err)
+		}
+	}
+	return string(decoded), nil
+}
+
+// The hash helpers return the hex digest of the value's text, as
+// sha256sum and its kin do on the command line. md5 and sha1 are there for
+// the checksums existing configs expect, not for security.
+func templateSHA256Sum(value interface{}) string {
+	sum := sha256.Sum256([]byte(toString(value)))
+	return hex.EncodeToString(sum[:])
+}
+
+func templateSHA1Sum(value interface{}) string {
+	sum := sha1.Sum([]byte(toString(value)))
+	return hex.EncodeToString(sum[:])
+}
+
+func templateMD5Sum(value interface{}) string {
+	sum := md5.Sum([]byte(toString(value)))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEncodingAndHashHelpers(t *testing.T) {
+	dir := t.TempDir()
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, contextPath, `{"secret": "hunter2", "query": "a b&c"}`)
+	source := `{{ .secret | b64enc }} {{ "aHVudGVyMg" | b64dec }} {{ .secret | b64enc | b64dec }} {{ .query | urlquery }} ` +
+		`{{ sha256sum "abc" }} {{ sha1sum "abc" }} {{ md5sum "abc" }}`
+	want := "aHVudGVyMg== hunter2 hunter2 a+b%26c " +
+		"ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad a9993e364706816aba3e25717850c26c9cd0d89d 900150983cd24fb0d6963f7d28e17f72"
+
+	// Both engines have the helpers; html/template escapes the results.
+	for name, want := range map[string]string{"secret.tmpl": want, "secret.html": strings.Replace(want, "a+b", "a&#43;b", 1)} {
+		templatePath := filepath.Join(dir, name)
+		writeFile(t, templatePath, source)
+		resp := run(templatePath, contextPath, renderOptions{})
+		if resp.Error != "" || resp.Rendered != want {
+			t.Fatalf("%s: unexpected render %q (error %q)", name, resp.Rendered, resp.Error)
+		}
+	}
+
+	templatePath := filepath.Join(dir, "bad.tmpl")
+	writeFile(t, templatePath, `{{ "not base64!" | b64dec }}`)
+	if resp := run(templatePath, "", renderOptions{}); !strings.Contains(resp.Error, "b64dec: illegal base64 data") {
+		t.Fatalf("expected invalid base64 to fail the render, got %+v", resp)
+	}
+}
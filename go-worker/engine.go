@@ -0,0 +1,40 @@
+package main
+
+import "fmt"
+
+// Engines --engine selects. Under auto, the default, the extension picks:
+// html/template for .html and .htm files, text/template for the rest.
+const (
+	engineAuto = "auto"
+	engineText = "text"
+	engineHTML = "html"
+)
+
+func validateEngine(engine string) error {
+	switch engine {
+	case "", engineAuto, engineText, engineHTML:
+		return nil
+	default:
+		return fmt.Errorf("unknown engine %q (expected text, html, or auto)", engine)
+	}
+}
+
+// templateEngine returns the engine path runs under: the one --engine
+// forces, or under auto, the one its extension implies. A .gotmpl file
+// that emits HTML, or an .html.tmpl email body, needs --engine=html to be
+// escaped.
+func templateEngine(path string, opts renderOptions) string {
+	switch opts.Engine {
+	case engineText, engineHTML:
+		return opts.Engine
+	}
+	if isHTMLTemplate(path) {
+		return engineHTML
+	}
+	return engineText
+}
+
+// usesHTMLEngine reports whether path runs under html/template.
+func usesHTMLEngine(path string, opts renderOptions) bool {
+	return templateEngine(path, opts) == engineHTML
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestRunWithEngineOverridesTheExtension(t *testing.T) {
+	dir := t.TempDir()
+	gotmplPath := filepath.Join(dir, "page.gotmpl")
+	htmlPath := filepath.Join(dir, "body.html")
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, gotmplPath, `<p>{{ .name }}</p>`)
+	writeFile(t, htmlPath, `<p>{{ .name }}</p>`)
+	writeFile(t, contextPath, `{"name":"<b>Ada</b>"}`)
+
+	cases := []struct {
+		path, engine, wantEngine, want string
+	}{
+		{gotmplPath, "", engineText, `<p><b>Ada</b></p>`},
+		{gotmplPath, engineHTML, engineHTML, `<p>&lt;b&gt;Ada&lt;/b&gt;</p>`},
+		{htmlPath, engineAuto, engineHTML, `<p>&lt;b&gt;Ada&lt;/b&gt;</p>`},
+		{htmlPath, engineText, engineText, `<p><b>Ada</b></p>`},
+	}
+	// A shared cache must not hand one engine's parse to the other.
+	cache := newTemplateCache()
+	for _, c := range cases {
+		resp := run(c.path, contextPath, renderOptions{Engine: c.engine, cache: cache})
+		if resp.Error != "" || resp.Rendered != c.want || resp.Engine != c.wantEngine {
+			t.Fatalf("%s with engine %q: unexpected response %+v", filepath.Base(c.path), c.engine, resp)
+		}
+	}
+
+	if resp := run(gotmplPath, contextPath, renderOptions{Engine: "jinja"}); resp.Error != `unknown engine "jinja" (expected text, html, or auto)` {
+		t.Fatalf("expected unknown engine error, got %+v", resp)
+	}
+}
+
+func TestEscapeReportHonorsEngine(t *testing.T) {
+	templatePath := filepath.Join(t.TempDir(), "page.gotmpl")
+	writeFile(t, templatePath, `<a href="{{ .url }}">x</a>`)
+
+	if resp := run(templatePath, "", renderOptions{Mode: "escape-report"}); resp.Error == "" {
+		t.Fatalf("expected a text template to be refused, got %+v", resp)
+	}
+	resp := run(templatePath, "", renderOptions{Mode: "escape-report", Engine: engineHTML})
+	if resp.Error != "" || len(resp.EscapeReport) != 1 {
+		t.Fatalf("unexpected escape report: %+v", resp)
+	}
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"errors"
+	htmltmpl "html/template"
+	"sort"
+	"strings"
+	"text/template/parse"
+)
+
+// htmlEscaperPrefix starts the names of the escapers html/template adds to
+// output actions.
+const htmlEscaperPrefix = "_html_template_"
+
+// htmlEscapers describes each escaper html/template adds, by name without
+// htmlEscaperPrefix: the context it stands for and what it does to the
+// value.
+var htmlEscapers = map[string]struct {
+	context string
+	effect  string
+}{
+	"urlfilter":        {"url", "the value must start with a safe scheme (http, https, mailto) or be relative; anything else becomes #ZgotmplZ"},
+	"urlnormalizer":    {"url", "characters a URL cannot hold, such as spaces and quotes, are percent-encoded; existing %xx escapes are kept"},
+	"urlescaper":       {"url", "in the query or fragment, the value is percent-encoded as one component, so / ? & = and spaces are encoded too"},
+	"srcsetescaper":    {"srcset", "each URL of the srcset is checked like a URL and percent-encoded"},
+	"jsvalescaper":     {"js", "the value is written as a JavaScript value: strings are quoted and escaped, other values become JSON"},
+	"jsstrescaper":     {"js-string", "the value is escaped for a JavaScript string literal"},
+	"jstmpllitescaper": {"js-template-literal", "the value is escaped for a JavaScript template literal"},
+	"jsregexpescaper":  {"js-regexp", "the value is escaped for a JavaScript regular expression literal"},
+	"cssvaluefilter":   {"css", "the value must look like a plain CSS value; anything else becomes ZgotmplZ"},
+	"cssescaper":       {"css-string", "the value is escaped for a CSS string"},
+	"htmlescaper":      {"html", "< > & ' and \" become HTML entities"},
+	"rcdataescaper":    {"rcdata", "inside a title or textarea element, the value is HTML-escaped and never read as tags"},
+	"htmlnamefilter":   {"attribute-name", "the value must be a harmless attribute name; anything else becomes ZgotmplZ"},
+	"commentescaper":   {"comment", "inside an HTML comment, which html/template removes, nothing is written"},
+	"attrescaper":      {"attribute", "the value is HTML-escaped for a quoted attribute value"},
+	"nospaceescaper":   {"unquoted-attribute", "the value is HTML-escaped for an unquoted attribute value, so spaces, quotes, and = become entities too"},
+}
+
+// escapeContext is the escaping html/template chose for one output action.
+// An action in a template called from several contexts is listed once per
+// context.
+type escapeContext struct {
+	// Template is the template the action is in: the file's own, or a
+	// define or block.
+	Template  string `json:"template"`
+	Line      int    `json:"line"`
+	Column    int    `json:"column"`
+	EndLine   int    `json:"endLine"`
+	EndColumn int    `json:"endColumn"`
+	Action    string `json:"action"`
+	// Context is where the output lands, such as html, attribute, url, js,
+	// or css; Escapers are the escapers applied, in order, and Effect says
+	// what each does to the value.
+	Context  string   `json:"context"`
+	Escapers []string `json:"escapers"`
+	Effect   string   `json:"effect"`
+}
+
+// errEscapeReportStop ends the execution that makes html/template escape
+// the templates, before it does anything else.
+var errEscapeReportStop = errors.New("escape report: execution stopped")
+
+// stopWriter is the output of that execution.
+type stopWriter struct{}
+
+func (stopWriter) Write([]byte) (int, error) { return 0, errEscapeReportStop }
+
+// executeEscapeReport lists the escaping context of every output action of
+// an HTML template. html/template only escapes a template when it first
+// executes it, so each template is executed with no data, functions that
+// fail at once, and output that fails at the first write: enough to escape
+// it, and nothing more. Defines nothing calls are escaped as if executed
+// directly.
+func executeEscapeReport(templatePath string, opts renderOptions) response {
+	if templatePath == "" {
+		return response{Error: "template path is required"}
+	}
+	if !usesHTMLEngine(templatePath, opts) {
+		return response{Error: "escape-report mode needs an .html or .htm template, or --engine=html; text/template does not escape output"}
+	}
+	content, err := readTemplate(templatePath, opts)
+	if err != nil {
+		return response{Error: err.Error()}
+	}
+
+	var warnings []diagnostic
+	if opts.project != nil {
+		includes, problems := resolveAliasIncludes(templatePath, content, opts)
+		opts.includes = includes
+		warnings = append(warnings, problems...)
+	}
+	if len(opts.Includes) > 0 {
+		includes, problems := resolveIncludePatterns(templatePath, opts)
+		opts.includes = append(opts.includes, includes...)
+		warnings = append(warnings, problems...)
+	}
+
+	funcs, err := templateFuncs(templatePath, opts)
+	if err != nil {
+		return response{Error: err.Error()}
+	}
+	stubs := htmltmpl.FuncMap{}
+	for name := range funcs {
+		stubs[name] = func(...interface{}) (interface{}, error) { return nil, errEscapeReportStop }
+	}
+
+	name := templateName(templatePath)
+	tmpl, err := htmltmpl.New(name).Delims(opts.LeftDelim, opts.RightDelim).Funcs(stubs).Parse(content)
+	if err == nil {
+		for _, include := range opts.includes {
+			if _, err = tmpl.New(include.Name).Parse(include.Content); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		return response{
+			Diagnostics: append(warnings, templateDiagnosticWithDelims(err, templatePath, content, opts.LeftDelim, opts.RightDelim)),
+			Error:       err.Error(),
+		}
+	}
+
+	// The file's own template, then the defines nothing calls, each with
+	// the templates it calls inlined.
+	inlined := inlineTemplateCalls(tmpl)
+	entries := []string{name}
+	for _, defined := range tmpl.Templates() {
+		if defined.Name() != name && defined.Tree != nil && defined.Tree.ParseName == name && !inlined.called[defined.Name()] {
+			entries = append(entries, defined.Name())
+		}
+	}
+	sort.Strings(entries[1:])
+	var escapeErr *htmltmpl.Error
+	for _, entry := range entries {
+		err := tmpl.ExecuteTemplate(stopWriter{}, entry, nil)
+		if errors.As(err, &escapeErr) {
+			diag := templateDiagnosticWithDelims(err, templatePath, content, opts.LeftDelim, opts.RightDelim)
+			return response{Diagnostics: append(warnings, diag), Error: err.Error()}
+		}
+	}
+
+	return response{EscapeReport: escapeContexts(tmpl, entries, inlined, content, opts), Diagnostics: warnings}
+}
+
+// maxInlinedCalls bounds how many template calls inlineTemplateCalls
+// expands, since templates that each call the next several times grow
+// exponentially.
+const maxInlinedCalls = 1000
+
+// inlinedTemplates records where the actions inlineTemplateCalls copied
+// came from.
+type inlinedTemplates struct {
+	// origin is the template each copied action is in.
+	origin map[*parse.ActionNode]*parse.Tree
+	// called holds the templates some template calls.
+	called map[string]bool
+	bodies map[string]*parse.ListNode
+	budget int
+}
+
+// inlineTemplateCalls replaces every template call in tmpl's templates
+// with a copy of the called template's body. html/template escapes a
+// template called from a context other than text in a copy it keeps to
+// itself; inlined, the body is escaped in place, once per call. A
+// recursive call is left a call, and its actions are not reported beyond
+// the first.
+func inlineTemplateCalls(tmpl *htmltmpl.Template) inlinedTemplates {
+	inlined := inlinedTemplates{
+		origin: map[*parse.ActionNode]*parse.Tree{},
+		called: map[string]bool{},
+		bodies: map[string]*parse.ListNode{},
+		budget: maxInlinedCalls,
+	}
+	templates := tmpl.Templates()
+	for _, defined := range templates {
+		if defined.Tree != nil && defined.Tree.Root != nil {
+			inlined.bodies[defined.Name()] = defined.Tree.Root.CopyList()
+		}
+	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].Name() < templates[j].Name() })
+	for _, defined := range templates {
+		if defined.Tree != nil && defined.Tree.Root != nil {
+			inlined.inline(tmpl, defined.Tree.Root, []string{defined.Name()})
+		}
+	}
+	return inlined
+}
+
+func (inlined *inlinedTemplates) inline(tmpl *htmltmpl.Template, list *parse.ListNode, calling []string) {
+	if list == nil {
+		return
+	}
+	for i, node := range list.Nodes {
+		switch typed := node.(type) {
+		case *parse.IfNode:
+			inlined.inline(tmpl, typed.List, calling)
+			inlined.inline(tmpl, typed.ElseList, calling)
+		case *parse.RangeNode:
+			inlined.inline(tmpl, typed.List, calling)
+			inlined.inline(tmpl, typed.ElseList, calling)
+		case *parse.WithNode:
+			inlined.inline(tmpl, typed.List, calling)
+			inlined.inline(tmpl, typed.ElseList, calling)
+		case *parse.TemplateNode:
+			inlined.called[typed.Name] = true
+			body, ok := inlined.bodies[typed.Name]
+			if !ok || containsString(calling, typed.Name) || inlined.budget == 0 {
+				continue
+			}
+			inlined.budget--
+			body = body.CopyList()
+			origin := tmpl.Lookup(typed.Name).Tree
+			walkNodes(body, func(node parse.Node) bool {
+				if action, ok := node.(*parse.ActionNode); ok {
+					inlined.origin[action] = origin
+				}
+				return true
+			})
+			inlined.inline(tmpl, body, append(calling[:len(calling):len(calling)], typed.Name))
+			list.Nodes[i] = body
+		}
+	}
+}
+
+// escapeContexts reads the escapers html/template added to the output
+// actions of the entry templates and the bodies inlined into them, keeping
+// the actions of the file's own templates.
+func escapeContexts(tmpl *htmltmpl.Template, entries []string, inlined inlinedTemplates, content string, opts renderOptions) []escapeContext {
+	actions := scanActions(content, opts.LeftDelim, opts.RightDelim)
+	type reported struct {
+		template, escapers string
+		start              int
+	}
+	seen := map[reported]bool{}
+	report := []escapeContext{}
+	name := entries[0]
+	for _, entry := range entries {
+		walkNodes(tmpl.Lookup(entry).Tree.Root, func(node parse.Node) bool {
+			action, ok := node.(*parse.ActionNode)
+			if !ok || len(action.Pipe.Decl) > 0 {
+				return true
+			}
+			origin, ok := inlined.origin[action]
+			if !ok {
+				origin = tmpl.Lookup(entry).Tree
+			}
+			if origin.ParseName != name {
+				return true
+			}
+			owner := origin.Name
+			var escapers []string
+			var effects []string
+			for _, command := range action.Pipe.Cmds {
+				ident, ok := command.Args[0].(*parse.IdentifierNode)
+				if !ok || !strings.HasPrefix(ident.Ident, htmlEscaperPrefix) {
+					continue
+				}
+				escaper := strings.TrimPrefix(ident.Ident, htmlEscaperPrefix)
+				escapers = append(escapers, escaper)
+				if described, ok := htmlEscapers[escaper]; ok {
+					effects = append(effects, described.effect)
+				}
+			}
+			span, ok := enclosingAction(actions, action.Position())
+			if len(escapers) == 0 || !ok {
+				return true
+			}
+			context := escapers[0]
+			if described, ok := htmlEscapers[escapers[0]]; ok {
+				context = described.context
+			}
+			key := reported{owner, strings.Join(escapers, ","), span.Start}
+			if seen[key] {
+				return true
+			}
+			seen[key] = true
+
+			entry := escapeContext{Template: owner, Action: content[span.Start:span.End], Context: context, Escapers: escapers, Effect: strings.Join(effects, "; then ")}
+			entry.Line, entry.Column = lineColumn(content, parse.Pos(span.Start))
+			entry.EndLine, entry.EndColumn = lineColumn(content, parse.Pos(span.End))
+			report = append(report, entry)
+			return true
+		})
+	}
+	sort.SliceStable(report, func(i, j int) bool {
+		if report[i].Line != report[j].Line {
+			return report[i].Line < report[j].Line
+		}
+		if report[i].Column != report[j].Column {
+			return report[i].Column < report[j].Column
+		}
+		return report[i].Context < report[j].Context
+	})
+	return report
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEscapeReportListsTheContextOfEachAction(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "page.html")
+	writeFile(t, templatePath, `<a href="{{ .URL }}?q={{ .Query }}" title={{ .Title }}>{{ .Name | upper }}</a>
+<script>var user = {{ .User }}; var s = "{{ .Greeting }}";</script>
+<style>p { color: {{ .Color }}; }</style>
+{{ define "row" }}<td>{{ . }}</td>{{ end }}`)
+
+	resp := run(templatePath, "", renderOptions{Mode: "escape-report"})
+	if resp.Error != "" {
+		t.Fatalf("unexpected error: %s", resp.Error)
+	}
+	var got []string
+	for _, entry := range resp.EscapeReport {
+		got = append(got, fmt.Sprintf("%s %d:%d-%d:%d %s %s", entry.Template, entry.Line, entry.Column, entry.EndLine, entry.EndColumn, entry.Action, entry.Context))
+	}
+	want := []string{
+		"page.html 1:10-1:20 {{ .URL }} url",
+		"page.html 1:23-1:35 {{ .Query }} url",
+		"page.html 1:43-1:55 {{ .Title }} unquoted-attribute",
+		"page.html 1:56-1:75 {{ .Name | upper }} html",
+		"page.html 2:20-2:31 {{ .User }} js",
+		"page.html 2:42-2:57 {{ .Greeting }} js-string",
+		"page.html 3:19-3:31 {{ .Color }} css",
+		"row 4:23-4:30 {{ . }} html",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected report\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if query := resp.EscapeReport[1]; strings.Join(query.Escapers, ",") != "urlescaper,attrescaper" || !strings.Contains(query.Effect, "percent-encoded") {
+		t.Fatalf("expected the query to be percent-encoded as a component, got %+v", query)
+	}
+}
+
+func TestEscapeReportListsADefinePerCallingContext(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "page.html")
+	writeFile(t, templatePath, `{{ define "name" }}{{ .Name }}{{ end }}<p>{{ template "name" . }}</p><script>var n = "{{ template "name" . }}";</script>`)
+
+	resp := run(templatePath, "", renderOptions{Mode: "escape-report"})
+	contexts := map[string]bool{}
+	for _, entry := range resp.EscapeReport {
+		if entry.Template == "name" {
+			contexts[entry.Context] = true
+		}
+	}
+	if !contexts["html"] || !contexts["js-string"] {
+		t.Fatalf("expected the define in both of its calling contexts, got %+v", resp.EscapeReport)
+	}
+}
+
+func TestEscapeReportRejectsTextTemplatesAndAmbiguousContexts(t *testing.T) {
+	dir := t.TempDir()
+	textPath := filepath.Join(dir, "notes.tmpl")
+	writeFile(t, textPath, `{{ .Name }}`)
+	if resp := run(textPath, "", renderOptions{Mode: "escape-report"}); resp.Error == "" {
+		t.Fatalf("expected text templates to be rejected")
+	}
+
+	ambiguous := filepath.Join(dir, "ambiguous.html")
+	writeFile(t, ambiguous, `<a {{ if .X }}href="{{ end }}{{ .Y }}">`)
+	resp := run(ambiguous, "", renderOptions{Mode: "escape-report"})
+	if resp.Error == "" || len(resp.Diagnostics) == 0 {
+		t.Fatalf("expected an escaping error with a diagnostic, got %+v", resp)
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	texttmpl "text/template"
+	"text/template/parse"
+	"unicode/utf8"
+)
+
+const (
+	// loopValueFunc ends the pipeline of every range of a replayed render
+	// and records the value ranged over; loopIterateFunc starts every
+	// range body and records the element, and loopExitFunc follows every
+	// range.
+	loopValueFunc   = "__goTemplateStudioLoopValue"
+	loopIterateFunc = "__goTemplateStudioLoopIterate"
+	loopExitFunc    = "__goTemplateStudioLoopExit"
+	// maxLoopItemBytes bounds the preview of the element a loop was on.
+	maxLoopItemBytes = 200
+)
+
+// execFailure describes a render that failed while executing.
+type execFailure struct {
+	// PartialOutput is what the template wrote before it failed.
+	PartialOutput string `json:"partialOutput"`
+	// Path is the value the innermost loop was on, written from the
+	// context down when the loops allow it, such as .customers[2].orders[37].
+	Path string `json:"path,omitempty"`
+	// Loops are the range loops that were running, outermost first.
+	Loops []loopIteration `json:"loops,omitempty"`
+}
+
+// loopIteration is the iteration a range loop was in when the render
+// failed. Index counts from 0; Key is the map key for a range over a map.
+type loopIteration struct {
+	sourceLocation
+	Range string `json:"range"`
+	Index int    `json:"index"`
+	Key   string `json:"key,omitempty"`
+	// Item is the element as JSON, shortened.
+	Item string `json:"item,omitempty"`
+}
+
+// describeExecFailure returns the failure of a render that failed while
+// executing, and nil for any other error. The loops come from running the
+// render again with every range recorded, which costs nothing when
+// renders succeed. A replay that fails differently, such as a template
+// that reads the time, reports no loops.
+func describeExecFailure(path, content string, data interface{}, rendered string, err error, opts renderOptions) *execFailure {
+	var execErr texttmpl.ExecError
+	if !errors.As(err, &execErr) {
+		return nil
+	}
+	failure := &execFailure{PartialOutput: rendered}
+
+	opts.cache = nil
+	opts.Trace, opts.Profile, opts.SourceMap, opts.ValueOrigins = false, false, false, false
+	opts.traceSink = nil
+	opts.loops = newLoopRecorder()
+	// A seeded render draws the same values again.
+	opts.random = newTemplateRandom(opts)
+	if _, _, replayErr := renderTemplateRun(path, content, data, opts); replayErr == nil || replayErr.Error() != err.Error() {
+		return failure
+	}
+	failure.Loops, failure.Path = opts.loops.iterations(templateSources(path, content, opts), opts.LeftDelim, opts.RightDelim)
+	return failure
+}
+
+// loopRelated lists the loops of a failure as related locations of its
+// diagnostic, innermost first.
+func loopRelated(failure *execFailure) []relatedLocation {
+	if failure == nil {
+		return nil
+	}
+	related := make([]relatedLocation, 0, len(failure.Loops))
+	for i := len(failure.Loops) - 1; i >= 0; i-- {
+		loop := failure.Loops[i]
+		at := fmt.Sprintf("index %d", loop.Index)
+		if loop.Key != "" {
+			at = "key " + loop.Key
+		}
+		related = append(related, relatedLocation{Message: fmt.Sprintf("in range %s at %s", loop.Range, at), sourceLocation: loop.sourceLocation})
+	}
+	return related
+}
+
+// loopRange is one range node of a replayed template.
+type loopRange struct {
+	template string
+	start    int
+	pipe     string
+	// field is the range's field chain, such as .orders, when the range is
+	// directly in another range's body and so reads the outer element.
+	field   string
+	chained bool
+}
+
+type loopFrame struct {
+	id    int
+	value interface{}
+	index int
+	item  interface{}
+}
+
+// loopRecorder records the loops of one replayed render.
+type loopRecorder struct {
+	mu     sync.Mutex
+	ranges []loopRange
+	stack  []loopFrame
+}
+
+func newLoopRecorder() *loopRecorder {
+	return &loopRecorder{}
+}
+
+// instrument makes every range of tree report its value, its iterations,
+// and its end. The range's pipeline passes its value through loopValueFunc
+// unchanged.
+func (r *loopRecorder) instrument(tree *parse.Tree) {
+	if tree == nil {
+		return
+	}
+	r.instrumentList(tree, tree.Root, false)
+}
+
+// instrumentList instruments the ranges of list; inRange reports whether
+// dot is the element of an enclosing range.
+func (r *loopRecorder) instrumentList(tree *parse.Tree, list *parse.ListNode, inRange bool) {
+	if list == nil {
+		return
+	}
+	nodes := make([]parse.Node, 0, len(list.Nodes))
+	for _, node := range list.Nodes {
+		switch typed := node.(type) {
+		case *parse.IfNode:
+			r.instrumentList(tree, typed.List, inRange)
+			r.instrumentList(tree, typed.ElseList, inRange)
+		case *parse.WithNode:
+			r.instrumentList(tree, typed.List, false)
+			r.instrumentList(tree, typed.ElseList, inRange)
+		case *parse.RangeNode:
+			r.instrumentList(tree, typed.List, true)
+			r.instrumentList(tree, typed.ElseList, inRange)
+			r.mu.Lock()
+			id := strconv.Itoa(len(r.ranges))
+			r.ranges = append(r.ranges, r.describe(tree, typed, inRange))
+			r.mu.Unlock()
+
+			pos := typed.Position()
+			ident := parse.NewIdentifier(loopValueFunc).SetTree(tree).SetPos(pos)
+			arg := &parse.StringNode{NodeType: parse.NodeString, Pos: pos, Quoted: strconv.Quote(id), Text: id}
+			typed.Pipe.Cmds = append(typed.Pipe.Cmds, &parse.CommandNode{NodeType: parse.NodeCommand, Pos: pos, Args: []parse.Node{ident, arg}})
+			if typed.List != nil {
+				dot := &parse.DotNode{NodeType: parse.NodeDot, Pos: pos}
+				typed.List.Nodes = append([]parse.Node{hiddenCall(tree, pos, loopIterateFunc, id, dot)}, typed.List.Nodes...)
+			}
+			nodes = append(nodes, node, hiddenCall(tree, pos, loopExitFunc, id))
+			continue
+		}
+		nodes = append(nodes, node)
+	}
+	list.Nodes = nodes
+}
+
+func (r *loopRecorder) describe(tree *parse.Tree, loop *parse.RangeNode, inRange bool) loopRange {
+	commands := make([]string, len(loop.Pipe.Cmds))
+	for i, command := range loop.Pipe.Cmds {
+		commands[i] = command.String()
+	}
+	described := loopRange{template: tree.ParseName, start: int(loop.Position()), pipe: strings.Join(commands, " | ")}
+	if len(loop.Pipe.Cmds) == 1 && len(loop.Pipe.Cmds[0].Args) == 1 {
+		switch arg := loop.Pipe.Cmds[0].Args[0].(type) {
+		case *parse.FieldNode:
+			described.field, described.chained = arg.String(), inRange
+		case *parse.DotNode:
+			described.chained = inRange
+		}
+	}
+	return described
+}
+
+// funcs returns the helpers the instrumented ranges call.
+func (r *loopRecorder) funcs() map[string]interface{} {
+	return map[string]interface{}{
+		loopValueFunc:   r.value,
+		loopIterateFunc: r.iterate,
+		loopExitFunc:    r.exit,
+	}
+}
+
+func (r *loopRecorder) value(id string, value interface{}) interface{} {
+	n, _ := strconv.Atoi(id)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stack = append(r.stack, loopFrame{id: n, value: value, index: -1})
+	return value
+}
+
+func (r *loopRecorder) iterate(id string, item interface{}) string {
+	n, _ := strconv.Atoi(id)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := len(r.stack) - 1; i >= 0; i-- {
+		if r.stack[i].id == n {
+			r.stack[i].index++
+			r.stack[i].item = item
+			break
+		}
+	}
+	return ""
+}
+
+// exit drops the range's frame and any a break or continue left above it.
+func (r *loopRecorder) exit(id string) string {
+	n, _ := strconv.Atoi(id)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := len(r.stack) - 1; i >= 0; i-- {
+		if r.stack[i].id == n {
+			r.stack = r.stack[:i]
+			break
+		}
+	}
+	return ""
+}
+
+// iterations returns the loops still running, outermost first, and the
+// path of the innermost one's element. A loop that failed before its first
+// iteration, or in its else branch, is left out.
+func (r *loopRecorder) iterations(sources map[string]templateSource, leftDelim, rightDelim string) ([]loopIteration, string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var loops []loopIteration
+	path := ""
+	for _, frame := range r.stack {
+		if frame.index < 0 || frame.id >= len(r.ranges) {
+			continue
+		}
+		described := r.ranges[frame.id]
+		loop := loopIteration{Range: described.pipe, Index: frame.index, Item: loopItemPreview(frame.item)}
+		if source, ok := sources[described.template]; ok {
+			start := parse.Pos(described.start)
+			if span, ok := enclosingAction(scanActions(source.Content, leftDelim, rightDelim), start); ok {
+				start = parse.Pos(span.Start)
+			}
+			loop.File = source.Path
+			loop.Line, loop.Column = lineColumn(source.Content, start)
+		}
+		step := fmt.Sprintf("[%d]", frame.index)
+		if key, ok := mapKeyAt(frame.value, frame.index); ok {
+			loop.Key = formatLoopKey(key)
+			step = "[" + loop.Key + "]"
+		}
+		switch {
+		case described.chained && path != "":
+			path += described.field + step
+		case described.field != "" || strings.HasPrefix(described.pipe, "$") && !strings.ContainsAny(described.pipe, " |("):
+			path = described.pipe + step
+		default:
+			path = "(" + described.pipe + ")" + step
+		}
+		loops = append(loops, loop)
+	}
+	return loops, path
+}
+
+// mapKeyAt returns the key a range over value visits at index. Like
+// text/template, it visits the keys of a map in sorted order.
+func mapKeyAt(value interface{}, index int) (reflect.Value, bool) {
+	v := indirectValue(reflect.ValueOf(value))
+	if v.Kind() != reflect.Map || index >= v.Len() {
+		return reflect.Value{}, false
+	}
+	keys := v.MapKeys()
+	sort.Slice(keys, func(i, j int) bool { return lessMapKey(keys[i], keys[j]) })
+	return keys[index], true
+}
+
+func formatLoopKey(key reflect.Value) string {
+	if key.Kind() == reflect.String {
+		return strconv.Quote(key.String())
+	}
+	return fmt.Sprint(key.Interface())
+}
+
+// loopItemPreview writes item as JSON, or as Go would print it when it is
+// not JSON, shortened to maxLoopItemBytes.
+func loopItemPreview(item interface{}) string {
+	preview := fmt.Sprint(item)
+	if encoded, err := json.Marshal(item); err == nil {
+		preview = string(encoded)
+	}
+	if len(preview) > maxLoopItemBytes {
+		cut := maxLoopItemBytes
+		for cut > 0 && !utf8.RuneStart(preview[cut]) {
+			cut--
+		}
+		preview = preview[:cut] + "…"
+	}
+	return preview
+}
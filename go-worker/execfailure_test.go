@@ -0,0 +1,105 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRunReportsLoopIterationOfExecFailure(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "orders.tmpl")
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, templatePath, "{{ range .customers }}{{ .name }}:{{ range .orders }} {{ index .tags 0 }}{{ end }};{{ end }}")
+	writeFile(t, contextPath, `{"customers": [
+		{"name": "Ada", "orders": [{"tags": ["x"]}]},
+		{"name": "Bob", "orders": [{"tags": ["y"]}, {"tags": []}]}
+	]}`)
+
+	resp := run(templatePath, contextPath, renderOptions{})
+	if resp.Error == "" || resp.ExecFailure == nil {
+		t.Fatalf("expected an exec failure, got %+v", resp)
+	}
+	failure := resp.ExecFailure
+	if failure.PartialOutput != "Ada: x;Bob: y " {
+		t.Fatalf("unexpected partial output %q", failure.PartialOutput)
+	}
+	if failure.Path != ".customers[1].orders[1]" {
+		t.Fatalf("unexpected path %q", failure.Path)
+	}
+	want := []loopIteration{
+		{sourceLocation: sourceLocation{File: templatePath, Line: 1, Column: 1}, Range: ".customers", Index: 1, Item: `{"name":"Bob","orders":[{"tags":["y"]},{"tags":[]}]}`},
+		{sourceLocation: sourceLocation{File: templatePath, Line: 1, Column: 35}, Range: ".orders", Index: 1, Item: `{"tags":[]}`},
+	}
+	if !reflect.DeepEqual(failure.Loops, want) {
+		t.Fatalf("unexpected loops:\n got %+v\nwant %+v", failure.Loops, want)
+	}
+
+	related := resp.Diagnostics[len(resp.Diagnostics)-1].Related
+	if len(related) != 2 || related[0].Message != "in range .orders at index 1" || related[1].Message != "in range .customers at index 1" {
+		t.Fatalf("unexpected related locations: %+v", related)
+	}
+}
+
+func TestRunReportsLoopKeyOfExecFailure(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "prices.tmpl")
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, templatePath, "{{ range $currency, $amounts := .prices }}{{ $currency }}={{ index $amounts 0 }} {{ end }}")
+	writeFile(t, contextPath, `{"prices": {"usd": [], "eur": [1]}}`)
+
+	resp := run(templatePath, contextPath, renderOptions{})
+	failure := resp.ExecFailure
+	if failure == nil || failure.PartialOutput != "eur=1 usd=" || failure.Path != `.prices["usd"]` {
+		t.Fatalf("unexpected failure: %+v", failure)
+	}
+	if len(failure.Loops) != 1 || failure.Loops[0].Key != `"usd"` || failure.Loops[0].Item != "[]" {
+		t.Fatalf("unexpected loops: %+v", failure.Loops)
+	}
+}
+
+func TestRunReportsExecFailureOutsideLoops(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "hello.tmpl")
+	writeFile(t, templatePath, `Hello {{ range .names }}{{ . }}{{ end }} {{ index .names 5 }}`)
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, contextPath, `{"names": ["a", "b"]}`)
+
+	// Loops that finished are not reported.
+	resp := run(templatePath, contextPath, renderOptions{})
+	if resp.ExecFailure == nil || resp.ExecFailure.PartialOutput != "Hello ab " || len(resp.ExecFailure.Loops) != 0 || resp.ExecFailure.Path != "" {
+		t.Fatalf("unexpected failure: %+v", resp.ExecFailure)
+	}
+
+	// Parse errors are not execution failures.
+	writeFile(t, templatePath, `Hello {{ range .names }}`)
+	if resp := run(templatePath, contextPath, renderOptions{}); resp.Error == "" || resp.ExecFailure != nil {
+		t.Fatalf("expected a parse error without an exec failure, got %+v", resp)
+	}
+}
+
+func TestLoopPathsFollowDot(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "rows.tmpl")
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, contextPath, `{"rows": [[1, 2], [3]], "groups": [{"info": {"items": [{}]}}]}`)
+
+	for template, want := range map[string]string{
+		// Ranging over dot continues the outer element's path.
+		"{{ range .rows }}{{ range . }}{{ if eq . 3.0 }}{{ index . 1 }}{{ end }}{{ end }}{{ end }}": ".rows[1][0]",
+		// with moves dot, so the inner range starts a path of its own.
+		"{{ range .groups }}{{ with .info }}{{ range .items }}{{ index .missing 0 }}{{ end }}{{ end }}{{ end }}": ".items[0]",
+		"{{ range $.rows }}{{ index . 5 }}{{ end }}":                                                             "$.rows[0]",
+		"{{ range slice .rows 1 }}{{ index . 5 }}{{ end }}":                                                      "(slice .rows 1)[0]",
+	} {
+		writeFile(t, templatePath, template)
+		resp := run(templatePath, contextPath, renderOptions{})
+		if resp.ExecFailure == nil || resp.ExecFailure.Path != want {
+			t.Errorf("%s: expected path %q, got %+v (%s)", template, want, resp.ExecFailure, resp.Error)
+		}
+	}
+	if !strings.Contains(loopItemPreview(strings.Repeat("é", maxLoopItemBytes)), "…") {
+		t.Fatalf("expected long items to be shortened")
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/template/parse"
+)
+
+const explainTextLimit = 40
+
+// templateOutline explains one named template in the parsed file.
+type templateOutline struct {
+	Name  string        `json:"name"`
+	Steps []explainStep `json:"steps,omitempty"`
+}
+
+// explainStep is one sentence of the outline. Steps nested under a branch
+// or loop are its Children.
+type explainStep struct {
+	Kind     string        `json:"kind"`
+	Text     string        `json:"text"`
+	Line     int           `json:"line"`
+	Column   int           `json:"column"`
+	Children []explainStep `json:"children,omitempty"`
+}
+
+// comparisonPhrases reads the comparison builtins as infix prose.
+var comparisonPhrases = map[string]string{
+	"eq": "equals",
+	"ne": "does not equal",
+	"lt": "is less than",
+	"le": "is at most",
+	"gt": "is greater than",
+	"ge": "is at least",
+}
+
+// executeExplain describes what each template in the file does in plain
+// language so reviewers can follow it without knowing Go template syntax.
+func executeExplain(templatePath string, opts renderOptions) response {
+	if templatePath == "" {
+		return response{Error: "template path is required"}
+	}
+
+	content, err := readTemplate(templatePath, opts)
+	if err != nil {
+		return response{Error: err.Error()}
+	}
+
+	name := templateName(templatePath)
+	trees, err := parseTrees(name, content)
+	if err != nil {
+		return response{
+			Diagnostics: []diagnostic{templateDiagnostic(err, templatePath, content)},
+			Error:       err.Error(),
+		}
+	}
+
+	explainer := explainer{content: content}
+	var outlines []templateOutline
+	for _, treeName := range sortedTreeNames(trees, name) {
+		outlines = append(outlines, templateOutline{
+			Name:  treeName,
+			Steps: explainer.list(trees[treeName].Root),
+		})
+	}
+	return response{Explanation: outlines}
+}
+
+type explainer struct {
+	content string
+}
+
+func (e explainer) step(kind, text string, pos parse.Pos, children []explainStep) explainStep {
+	line, column := lineColumn(e.content, pos)
+	return explainStep{Kind: kind, Text: text, Line: line, Column: column, Children: children}
+}
+
+func (e explainer) list(list *parse.ListNode) []explainStep {
+	if list == nil {
+		return nil
+	}
+
+	var steps []explainStep
+	for _, node := range list.Nodes {
+		steps = append(steps, e.node(node)...)
+	}
+	return steps
+}
+
+func (e explainer) node(node parse.Node) []explainStep {
+	switch typed := node.(type) {
+	case *parse.TextNode:
+		text := strings.TrimSpace(string(typed.Text))
+		if text == "" {
+			return nil
+		}
+		return []explainStep{e.step("text", "Write the text "+quoteExcerpt(text), typed.Position(), nil)}
+	case *parse.CommentNode:
+		comment := strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(typed.Text, "/*"), "*/"))
+		return []explainStep{e.step("comment", "Note: "+comment, typed.Position(), nil)}
+	case *parse.ActionNode:
+		if len(typed.Pipe.Decl) > 0 {
+			verb := "Set"
+			if !typed.Pipe.IsAssign {
+				verb = "Define"
+			}
+			return []explainStep{e.step("assign", fmt.Sprintf("%s %s to %s", verb, declNames(typed.Pipe), describePipe(typed.Pipe)), typed.Position(), nil)}
+		}
+		return []explainStep{e.step("output", "Output "+describePipe(typed.Pipe), typed.Position(), nil)}
+	case *parse.IfNode:
+		return e.ifChain(typed, "If")
+	case *parse.RangeNode:
+		steps := []explainStep{e.step("range", describeRange(typed.Pipe)+":", typed.Position(), e.list(typed.List))}
+		if typed.ElseList != nil {
+			steps = append(steps, e.step("else", fmt.Sprintf("If %s is empty:", describePipe(typed.Pipe)), typed.ElseList.Position(), e.list(typed.ElseList)))
+		}
+		return steps
+	case *parse.WithNode:
+		text := fmt.Sprintf("If %s is set, using it as dot:", describePipe(typed.Pipe))
+		if len(typed.Pipe.Decl) > 0 {
+			text = fmt.Sprintf("If %s is set, as %s and dot:", describePipe(typed.Pipe), declNames(typed.Pipe))
+		}
+		steps := []explainStep{e.step("with", text, typed.Position(), e.list(typed.List))}
+		if typed.ElseList != nil {
+			steps = append(steps, e.step("else", "Otherwise:", typed.ElseList.Position(), e.list(typed.ElseList)))
+		}
+		return steps
+	case *parse.TemplateNode:
+		text := fmt.Sprintf("Render the %q template", typed.Name)
+		if typed.Pipe != nil {
+			text += " with " + describePipe(typed.Pipe)
+		}
+		return []explainStep{e.step("template", text, typed.Position(), nil)}
+	case *parse.BreakNode:
+		return []explainStep{e.step("break", "Stop the loop", typed.Position(), nil)}
+	case *parse.ContinueNode:
+		return []explainStep{e.step("continue", "Skip to the next item", typed.Position(), nil)}
+	default:
+		return nil
+	}
+}
+
+// ifChain flattens {{ else if }} chains, which parse as an else branch
+// holding a single if, into sibling steps.
+func (e explainer) ifChain(node *parse.IfNode, verb string) []explainStep {
+	steps := []explainStep{e.step("if", fmt.Sprintf("%s %s:", verb, describePipe(node.Pipe)), node.Position(), e.list(node.List))}
+	if node.ElseList == nil {
+		return steps
+	}
+	if len(node.ElseList.Nodes) == 1 {
+		if nested, ok := node.ElseList.Nodes[0].(*parse.IfNode); ok {
+			return append(steps, e.ifChain(nested, "Otherwise, if")...)
+		}
+	}
+	return append(steps, e.step("else", "Otherwise:", node.ElseList.Position(), e.list(node.ElseList)))
+}
+
+func describeRange(pipe *parse.PipeNode) string {
+	source := describePipe(pipe)
+	switch len(pipe.Decl) {
+	case 1:
+		return fmt.Sprintf("For each %s in %s", pipe.Decl[0].Ident[0], source)
+	case 2:
+		return fmt.Sprintf("For each %s (at %s) in %s", pipe.Decl[1].Ident[0], pipe.Decl[0].Ident[0], source)
+	default:
+		return "For each item in " + source
+	}
+}
+
+func declNames(pipe *parse.PipeNode) string {
+	names := make([]string, len(pipe.Decl))
+	for i, decl := range pipe.Decl {
+		names[i] = decl.Ident[0]
+	}
+	return strings.Join(names, " and ")
+}
+
+// describePipe reads a pipeline left to right, feeding each stage's result
+// into the next as its final argument.
+func describePipe(pipe *parse.PipeNode) string {
+	if pipe == nil {
+		return "nothing"
+	}
+
+	value := ""
+	for i, cmd := range pipe.Cmds {
+		var piped []string
+		if i > 0 {
+			piped = []string{value}
+		}
+		value = describeCommand(cmd, piped)
+	}
+	return value
+}
+
+func describeCommand(cmd *parse.CommandNode, piped []string) string {
+	if len(cmd.Args) == 0 {
+		return "nothing"
+	}
+
+	ident, ok := cmd.Args[0].(*parse.IdentifierNode)
+	if !ok {
+		return describeArg(cmd.Args[0])
+	}
+
+	args := make([]string, 0, len(cmd.Args)-1+len(piped))
+	for _, arg := range cmd.Args[1:] {
+		args = append(args, describeArg(arg))
+	}
+	args = append(args, piped...)
+
+	if phrase, ok := comparisonPhrases[ident.Ident]; ok && len(args) == 2 {
+		return fmt.Sprintf("%s %s %s", args[0], phrase, args[1])
+	}
+	switch {
+	case (ident.Ident == "and" || ident.Ident == "or") && len(args) > 1:
+		return strings.Join(args, " "+ident.Ident+" ")
+	case ident.Ident == "not" && len(args) == 1:
+		return "not " + args[0]
+	case ident.Ident == "len" && len(args) == 1:
+		return "the length of " + args[0]
+	case ident.Ident == "index" && len(args) > 1:
+		return args[0] + "[" + strings.Join(args[1:], "][") + "]"
+	case len(args) == 0:
+		return ident.Ident + "()"
+	default:
+		return ident.Ident + "(" + strings.Join(args, ", ") + ")"
+	}
+}
+
+func describeArg(node parse.Node) string {
+	switch typed := node.(type) {
+	case *parse.DotNode:
+		return "the current item"
+	case *parse.PipeNode:
+		return "(" + describePipe(typed) + ")"
+	default:
+		return node.String()
+	}
+}
+
+func quoteExcerpt(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if runes := []rune(text); len(runes) > explainTextLimit {
+		text = string(runes[:explainTextLimit]) + "…"
+	}
+	return fmt.Sprintf("%q", text)
+}
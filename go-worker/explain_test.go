@@ -0,0 +1,63 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExecuteExplainOutlinesTemplate(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "orders.tmpl")
+	writeFile(t, templatePath, `{{/* order summary */}}
+{{ range $order := .orders }}
+  {{ if gt $order.total 100 }}{{ template "discount" $order }}{{ else if not $order.paid }}Unpaid{{ else }}{{ $order.total | printf "%.2f" }}{{ end }}
+{{ else }}No orders.{{ end }}
+{{ define "discount" }}{{ $rate := index .rates 0 }}{{ len .items }}{{ end }}`)
+
+	resp := run(templatePath, "", renderOptions{Mode: "explain"})
+	if resp.Error != "" || len(resp.Explanation) != 2 {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	texts := func(steps []explainStep) []string {
+		var out []string
+		for _, step := range steps {
+			out = append(out, step.Kind+": "+step.Text)
+		}
+		return out
+	}
+
+	root := resp.Explanation[0]
+	if root.Name != "orders.tmpl" {
+		t.Fatalf("expected root template first, got %q", root.Name)
+	}
+	want := []string{"comment: Note: order summary", "range: For each $order in .orders:", "else: If .orders is empty:"}
+	if got := texts(root.Steps); !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected root outline:\n%q", got)
+	}
+	if root.Steps[1].Line != 2 || root.Steps[2].Children[0].Text != `Write the text "No orders."` {
+		t.Fatalf("unexpected range steps: %+v", root.Steps[1:])
+	}
+
+	want = []string{
+		"if: If $order.total is greater than 100:",
+		"if: Otherwise, if not $order.paid:",
+		"else: Otherwise:",
+	}
+	branches := root.Steps[1].Children
+	if got := texts(branches); !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected branches:\n%q", got)
+	}
+	if got := texts(branches[0].Children); !reflect.DeepEqual(got, []string{`template: Render the "discount" template with $order`}) {
+		t.Fatalf("unexpected first branch: %q", got)
+	}
+	if got := texts(branches[2].Children); !reflect.DeepEqual(got, []string{`output: Output printf("%.2f", $order.total)`}) {
+		t.Fatalf("unexpected else branch: %q", got)
+	}
+
+	want = []string{"assign: Define $rate to .rates[0]", "output: Output the length of .items"}
+	if got := texts(resp.Explanation[1].Steps); resp.Explanation[1].Name != "discount" || !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected define outline: %q", got)
+	}
+}
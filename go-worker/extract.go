@@ -0,0 +1,246 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template/parse"
+	"unicode"
+)
+
+const extractContextRadius = 24
+
+var htmlTagPattern = regexp.MustCompile(`<[^>]*>`)
+
+// catalogEntry is one translatable message and everywhere it appears.
+type catalogEntry struct {
+	Message     string           `json:"message"`
+	Context     string           `json:"context,omitempty"`
+	Occurrences []sourceLocation `json:"occurrences"`
+}
+
+type sourceLocation struct {
+	File   string `json:"file,omitempty"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+}
+
+// textSegment is a literal message located at a byte range of the template.
+type textSegment struct {
+	Start   int
+	End     int
+	Message string
+}
+
+// executeExtractStrings collects literal text into a catalog and, when
+// requested, rewrites the template so each message flows through `t`.
+func executeExtractStrings(templatePath string, opts renderOptions) response {
+	if templatePath == "" {
+		return response{Error: "template path is required"}
+	}
+
+	content, err := readTemplate(templatePath, opts)
+	if err != nil {
+		return response{Error: err.Error()}
+	}
+
+	trees, err := parseTrees(templatePath, content)
+	if err != nil {
+		return response{
+			Diagnostics: []diagnostic{templateDiagnostic(err, templatePath, content)},
+			Error:       err.Error(),
+		}
+	}
+
+	segments := extractSegments(trees, content, usesHTMLEngine(templatePath, opts))
+	catalog := buildCatalog(templatePath, content, segments)
+
+	resp := response{Catalog: catalog}
+	switch opts.CatalogFormat {
+	case "", "json":
+	case "po":
+		resp.CatalogPO = formatPO(catalog)
+	default:
+		return response{Error: fmt.Sprintf("unknown catalog format %q", opts.CatalogFormat)}
+	}
+
+	if opts.RewriteStrings {
+		resp.Rendered = rewriteSegments(content, segments)
+	}
+
+	return resp
+}
+
+func extractSegments(trees map[string]*parse.Tree, content string, html bool) []textSegment {
+	var segments []textSegment
+	for _, tree := range trees {
+		walkNodes(tree.Root, func(node parse.Node) bool {
+			text, ok := node.(*parse.TextNode)
+			if !ok {
+				return true
+			}
+			start := int(text.Position())
+			if start+len(text.Text) > len(content) || content[start:start+len(text.Text)] != string(text.Text) {
+				return true
+			}
+			segments = append(segments, segmentsInText(string(text.Text), start, html)...)
+			return true
+		})
+	}
+
+	sort.Slice(segments, func(i, j int) bool { return segments[i].Start < segments[j].Start })
+	if html {
+		segments = outsideRawText(segments, rawTextRanges(content))
+	}
+	return segments
+}
+
+// rawTextRanges returns the byte ranges of the <script> and <style>
+// elements of content, whose text is code rather than a message.
+func rawTextRanges(content string) [][2]int {
+	lower := strings.ToLower(content)
+	var ranges [][2]int
+	for _, name := range []string{"script", "style"} {
+		for cursor := 0; ; {
+			start := strings.Index(lower[cursor:], "<"+name)
+			if start < 0 {
+				break
+			}
+			start += cursor
+			cursor = start + 1 + len(name)
+			if cursor < len(lower) && !strings.ContainsRune(" \t\r\n/>", rune(lower[cursor])) {
+				continue
+			}
+			end := strings.Index(lower[cursor:], "</"+name)
+			if end < 0 {
+				ranges = append(ranges, [2]int{start, len(content)})
+				break
+			}
+			cursor += end + len("</"+name)
+			ranges = append(ranges, [2]int{start, cursor})
+		}
+	}
+	return ranges
+}
+
+func outsideRawText(segments []textSegment, ranges [][2]int) []textSegment {
+	kept := segments[:0]
+	for _, segment := range segments {
+		inside := false
+		for _, span := range ranges {
+			if segment.Start >= span[0] && segment.Start < span[1] {
+				inside = true
+				break
+			}
+		}
+		if !inside {
+			kept = append(kept, segment)
+		}
+	}
+	return kept
+}
+
+// segmentsInText splits literal text into messages. HTML markup is treated
+// as a separator so only human-readable text between tags is extracted.
+func segmentsInText(text string, offset int, html bool) []textSegment {
+	ranges := [][2]int{{0, len(text)}}
+	if html {
+		ranges = ranges[:0]
+		cursor := 0
+		for _, tag := range htmlTagPattern.FindAllStringIndex(text, -1) {
+			ranges = append(ranges, [2]int{cursor, tag[0]})
+			cursor = tag[1]
+		}
+		ranges = append(ranges, [2]int{cursor, len(text)})
+	}
+
+	var segments []textSegment
+	for _, span := range ranges {
+		raw := text[span[0]:span[1]]
+		trimmed := strings.TrimSpace(raw)
+		if !containsLetter(trimmed) {
+			continue
+		}
+		start := span[0] + strings.Index(raw, trimmed)
+		segments = append(segments, textSegment{
+			Start:   offset + start,
+			End:     offset + start + len(trimmed),
+			Message: strings.Join(strings.Fields(trimmed), " "),
+		})
+	}
+	return segments
+}
+
+func containsLetter(value string) bool {
+	for _, r := range value {
+		if unicode.IsLetter(r) {
+			return true
+		}
+	}
+	return false
+}
+
+func buildCatalog(templatePath, content string, segments []textSegment) []catalogEntry {
+	var catalog []catalogEntry
+	index := make(map[string]int)
+	for _, segment := range segments {
+		line, column := lineColumn(content, parse.Pos(segment.Start))
+		location := sourceLocation{File: templatePath, Line: line, Column: column}
+
+		if existing, ok := index[segment.Message]; ok {
+			catalog[existing].Occurrences = append(catalog[existing].Occurrences, location)
+			continue
+		}
+
+		index[segment.Message] = len(catalog)
+		catalog = append(catalog, catalogEntry{
+			Message:     segment.Message,
+			Context:     surroundingContext(content, segment.Start, segment.End),
+			Occurrences: []sourceLocation{location},
+		})
+	}
+	return catalog
+}
+
+func surroundingContext(content string, start, end int) string {
+	from := start - extractContextRadius
+	if from < 0 {
+		from = 0
+	}
+	to := end + extractContextRadius
+	if to > len(content) {
+		to = len(content)
+	}
+	return strings.Join(strings.Fields(content[from:to]), " ")
+}
+
+func formatPO(catalog []catalogEntry) string {
+	var builder strings.Builder
+	builder.WriteString("msgid \"\"\nmsgstr \"\"\n\"Content-Type: text/plain; charset=UTF-8\\n\"\n")
+	for _, entry := range catalog {
+		builder.WriteString("\n")
+		if entry.Context != "" {
+			builder.WriteString("#. " + entry.Context + "\n")
+		}
+		for _, occurrence := range entry.Occurrences {
+			fmt.Fprintf(&builder, "#: %s:%d\n", occurrence.File, occurrence.Line)
+		}
+		builder.WriteString("msgid " + strconv.Quote(entry.Message) + "\n")
+		builder.WriteString("msgstr \"\"\n")
+	}
+	return builder.String()
+}
+
+func rewriteSegments(content string, segments []textSegment) string {
+	var builder strings.Builder
+	offset := 0
+	for _, segment := range segments {
+		builder.WriteString(content[offset:segment.Start])
+		builder.WriteString(defaultLeftDelim + "t " + strconv.Quote(segment.Message) + defaultRightDelim)
+		offset = segment.End
+	}
+	builder.WriteString(content[offset:])
+	return builder.String()
+}
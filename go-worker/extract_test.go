@@ -0,0 +1,111 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExecuteExtractStringsFromText(t *testing.T) {
+	templatePath := filepath.Join(t.TempDir(), "welcome.tmpl")
+	content := "Hello {{ .name }}!\n{{ if .admin }}  Welcome back  {{ end }}\nHello "
+	if err := os.WriteFile(templatePath, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write template file: %v", err)
+	}
+
+	resp := run(templatePath, "", renderOptions{Mode: "extract-strings", CatalogFormat: "po", RewriteStrings: true})
+	if resp.Error != "" {
+		t.Fatalf("unexpected error: %s", resp.Error)
+	}
+
+	if len(resp.Catalog) != 2 {
+		t.Fatalf("expected two catalog entries, got %+v", resp.Catalog)
+	}
+
+	hello := resp.Catalog[0]
+	if hello.Message != "Hello" || len(hello.Occurrences) != 2 || hello.Occurrences[0].Line != 1 || hello.Occurrences[1].Line != 3 {
+		t.Fatalf("unexpected first entry: %+v", hello)
+	}
+
+	welcome := resp.Catalog[1]
+	if welcome.Message != "Welcome back" || welcome.Occurrences[0].Column != 18 || !strings.Contains(welcome.Context, "if .admin") {
+		t.Fatalf("unexpected second entry: %+v", welcome)
+	}
+
+	if !strings.Contains(resp.CatalogPO, "msgid \"Welcome back\"\nmsgstr \"\"") {
+		t.Fatalf("expected PO catalog output, got %q", resp.CatalogPO)
+	}
+
+	expected := "{{t \"Hello\"}} {{ .name }}!\n{{ if .admin }}  {{t \"Welcome back\"}}  {{ end }}\n{{t \"Hello\"}} "
+	if resp.Rendered != expected {
+		t.Fatalf("unexpected rewrite:\n%q\nexpected\n%q", resp.Rendered, expected)
+	}
+
+	rendered, err := renderTemplate(templatePath, resp.Rendered, map[string]any{"name": "Go", "admin": true})
+	if err != nil {
+		t.Fatalf("expected rewritten template to render, got %v", err)
+	}
+	if rendered != "Hello Go!\n  Welcome back  \nHello " {
+		t.Fatalf("unexpected rewritten render: %q", rendered)
+	}
+}
+
+func TestExecuteExtractStringsSkipsHTMLMarkup(t *testing.T) {
+	templatePath := filepath.Join(t.TempDir(), "page.html")
+	if err := os.WriteFile(templatePath, []byte(`<p class="lead">Read   the docs</p><br/>{{ .x }}<span> 42 </span>`), 0o600); err != nil {
+		t.Fatalf("failed to write template file: %v", err)
+	}
+
+	resp := run(templatePath, "", renderOptions{Mode: "extract-strings"})
+	if len(resp.Catalog) != 1 || resp.Catalog[0].Message != "Read the docs" {
+		t.Fatalf("unexpected catalog: %+v", resp.Catalog)
+	}
+	if resp.CatalogPO != "" || resp.Rendered != "" {
+		t.Fatalf("expected JSON-only output by default, got %+v", resp)
+	}
+}
+
+func TestRewriteStringsKeepsHTMLOutput(t *testing.T) {
+	templatePath := filepath.Join(t.TempDir(), "terms.html")
+	content := `<style>p { color: red }</style><h1>Terms &amp; Conditions</h1>
+<p>Don't miss {{ .name }}'s offer</p>
+<script>var label = "Skip me"; {{ .name }}; alert("Still code")</script>`
+	writeFile(t, templatePath, content)
+
+	resp := run(templatePath, "", renderOptions{Mode: "extract-strings", RewriteStrings: true})
+	var messages []string
+	for _, entry := range resp.Catalog {
+		messages = append(messages, entry.Message)
+	}
+	if resp.Error != "" || strings.Join(messages, "|") != "Terms &amp; Conditions|Don't miss|'s offer" {
+		t.Fatalf("unexpected catalog: %+v", resp)
+	}
+
+	data := map[string]any{"name": "<Ada>"}
+	before, err := renderTemplate(templatePath, content, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := renderTemplate(templatePath, resp.Rendered, data)
+	if err != nil || after != before {
+		t.Fatalf("expected the rewrite to render the same HTML:\n%s\ngot (%v)\n%s", before, err, after)
+	}
+	if !strings.Contains(after, "Terms &amp; Conditions") || !strings.Contains(after, "Don't miss &lt;Ada&gt;") {
+		t.Fatalf("unexpected render: %s", after)
+	}
+
+	rendered, err := renderTemplate(templatePath, `{{ t "Hi %s, you have %d" .name 3 }}`, data)
+	if err != nil || rendered != "Hi &lt;Ada&gt;, you have 3" {
+		t.Fatalf("expected t to escape its arguments, got %q (%v)", rendered, err)
+	}
+}
+
+func TestTemplateTranslate(t *testing.T) {
+	if templateTranslate("Hi") != "Hi" {
+		t.Fatal("expected message to pass through")
+	}
+	if templateTranslate("Hi %s", "Go") != "Hi Go" {
+		t.Fatal("expected arguments to be formatted")
+	}
+}
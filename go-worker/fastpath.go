@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fastPathMaxBytes is the largest text template the server renders on the
+// fast path. Snippet previews are far smaller.
+const fastPathMaxBytes = 8 << 10
+
+var (
+	// fastPathFuncs is the builtin text FuncMap, built once. Templates
+	// parsed with it bind nothing per render, so they execute without the
+	// clone the general path makes to bind its recorders.
+	fastPathFuncs = sync.OnceValue(func() map[string]interface{} {
+		return textFuncMap()
+	})
+	responseBuffers = sync.Pool{New: func() interface{} { return newResponseBuffer() }}
+	responseV1s     = sync.Pool{New: func() interface{} { return new(responseV1) }}
+)
+
+// fastPathEligible reports whether a render can take the fast path: a
+// server render of a small text template with no loops and no other
+// templates to call, with the builtin functions and nothing that records,
+// limits, or instruments the execution. Without range or template calls
+// execution is linear in the template's size, so it runs without the
+// goroutine and loop guards that let a render be cancelled; a cancelled
+// request still answers cancelled. The keywords are looked for in the
+// whole source, so a template that merely mentions them in its text takes
+// the general path.
+func fastPathEligible(path, content string, opts renderOptions) bool {
+	switch {
+	case opts.cache == nil || len(content) > fastPathMaxBytes || usesHTMLEngine(path, opts):
+		return false
+	case len(opts.includes) > 0 || strings.Contains(content, "range") || strings.Contains(content, "define") || strings.Contains(content, "block"):
+		return false
+	case strings.Contains(content, "env") || strings.Contains(content, "file"):
+		// The sandboxed helpers report what they deny.
+		return false
+	case opts.random.seeded() && (strings.Contains(content, "uuid") || strings.Contains(content, "rand")):
+		// The fast path's helpers draw unseeded values.
+		return false
+	case strings.TrimSpace(opts.Timeout) != "" || opts.MaxOutputBytes > 0 || opts.MaxIterations > 0:
+		return false
+	case opts.SourceMap || opts.ValueOrigins || opts.Trace || opts.Profile || opts.capture != nil || opts.partial != nil || opts.TargetDefine != "":
+		return false
+	}
+	return builtinFuncsOnly(opts)
+}
+
+// builtinFuncsOnly reports whether templateFuncs would return the builtin
+// FuncMap unchanged.
+func builtinFuncsOnly(opts renderOptions) bool {
+	return (opts.Funcs == "" || opts.Funcs == funcLibraryBuiltin) &&
+		!opts.ProductionParity && opts.funcProfile == nil &&
+		strings.TrimSpace(opts.StubFunctions) == "" && len(helperPluginManifests(opts)) == 0 &&
+		len(opts.DisableFuncs) == 0 && len(opts.RenamedFuncs) == 0
+}
+
+// fastRenderRun is renderTemplateRun on the fast path. The template comes
+// from the server's cache like any other, and executes into a pooled
+// buffer.
+func fastRenderRun(path, content string, data interface{}, opts renderOptions) (string, renderRun, error) {
+	var run renderRun
+	funcs := fastPathFuncs()
+
+	start := time.Now()
+	parse := func() (parsedTemplate, error) { return parseTemplate(path, content, funcs, false, opts) }
+	tmpl, cacheHit, err := opts.cache.load(path, templateCacheKey(content, funcs, false, opts), parse)
+	run.cacheHit = cacheHit
+	run.timings.ParseMs = elapsedMs(start)
+	if err != nil {
+		return "", run, err
+	}
+
+	start = time.Now()
+	buf := renderBuffers.get(opts.cache.outputHint(path))
+	defer renderBuffers.put(buf)
+	err = tmpl.(textTemplate).Execute(buf, data)
+	run.timings.ExecuteMs = elapsedMs(start)
+	if err != nil {
+		return buf.String(), run, err
+	}
+	opts.cache.rememberOutput(path, buf.Len())
+	return buf.String(), run, nil
+}
+
+// responseBuffer encodes one server response at a time into a pooled
+// buffer, reusing its encoder across responses.
+type responseBuffer struct {
+	buf *bytes.Buffer
+	enc *json.Encoder
+}
+
+func newResponseBuffer() *responseBuffer {
+	b := &responseBuffer{}
+	b.enc = json.NewEncoder(b)
+	return b
+}
+
+// Write is where the encoder writes.
+func (b *responseBuffer) Write(p []byte) (int, error) {
+	return b.buf.Write(p)
+}
+
+// encode writes resp as one line, byte for byte what encoding it with
+// MarshalJSON writes: the id goes first, then the versioned payload. The
+// payload's opening brace is overwritten rather than the payload copied.
+// The line is valid until release.
+func (b *responseBuffer) encode(resp *serverResponse) ([]byte, error) {
+	b.buf = renderBuffers.get(len(resp.Rendered) + 4<<10)
+	prefix := 0
+	if len(resp.ID) > 0 {
+		b.buf.WriteString(`{"id":`)
+		if err := json.Compact(b.buf, resp.ID); err != nil {
+			return nil, err
+		}
+		prefix = b.buf.Len()
+	}
+
+	var err error
+	if resp.version == responseVersion2 {
+		err = b.enc.Encode(responseV2Of(resp.response))
+	} else {
+		v1 := responseV1s.Get().(*responseV1)
+		*v1 = responseV1{ProtocolVersion: responseVersion1, response: resp.response}
+		err = b.enc.Encode(v1)
+		*v1 = responseV1{}
+		responseV1s.Put(v1)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if prefix > 0 {
+		b.buf.Bytes()[prefix] = ','
+	}
+	return b.buf.Bytes(), nil
+}
+
+// release returns the buffer and the encoder to their pools.
+func (b *responseBuffer) release() {
+	if b.buf != nil {
+		renderBuffers.put(b.buf)
+		b.buf = nil
+	}
+	responseBuffers.Put(b)
+}
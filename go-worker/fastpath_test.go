@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestFastPathEligibility(t *testing.T) {
+	server := renderOptions{cache: newTemplateCache()}
+	cases := []struct {
+		name    string
+		path    string
+		content string
+		opts    renderOptions
+		want    bool
+	}{
+		{"snippet", "greet.tmpl", "Hello {{ .name | upper }}", server, true},
+		{"not serving", "greet.tmpl", "Hello", renderOptions{}, false},
+		{"html", "greet.html", "Hello", server, false},
+		{"loop", "list.tmpl", "{{ range .items }}{{ . }}{{ end }}", server, false},
+		{"define", "page.tmpl", `{{ define "x" }}{{ end }}`, server, false},
+		{"timeout", "greet.tmpl", "Hello", renderOptions{cache: server.cache, Timeout: "1s"}, false},
+		{"trace", "greet.tmpl", "Hello", renderOptions{cache: server.cache, Trace: true}, false},
+		{"sprig", "greet.tmpl", "Hello", renderOptions{cache: server.cache, Funcs: funcLibrarySprig}, false},
+		{"renamed helper", "greet.tmpl", "Hello", renderOptions{cache: server.cache, RenamedFuncs: map[string]string{"map": "m"}}, false},
+	}
+	for _, tc := range cases {
+		if got := fastPathEligible(tc.path, tc.content, tc.opts); got != tc.want {
+			t.Errorf("%s: expected eligible=%v, got %v", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestFastPathRendersLikeTheGeneralPath(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "greet.tmpl")
+	writeFile(t, templatePath, `{{ $x := 1 }}{{ with .user }}{{ $x := 2 }}Hi {{ .name | upper }}{{ end }} {{ .missing }}`)
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, contextPath, `{"user": {"name": "ada"}}`)
+
+	general := run(templatePath, contextPath, renderOptions{})
+	opts := renderOptions{cache: newTemplateCache()}
+	first := run(templatePath, contextPath, opts)
+	second := run(templatePath, contextPath, opts)
+	if first.Error != "" || first.Rendered != general.Rendered || len(first.Diagnostics) != len(general.Diagnostics) || len(first.Diagnostics) == 0 {
+		t.Fatalf("expected the fast path to match the general path\nfast:    %+v\ngeneral: %+v", first, general)
+	}
+	if first.CacheHit || !second.CacheHit || second.Rendered != general.Rendered {
+		t.Fatalf("expected the second render to reuse the parse, got %+v then %+v", first, second)
+	}
+
+	var wg sync.WaitGroup
+	results := make([]string, 16)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			data := map[string]interface{}{"user": map[string]interface{}{"name": fmt.Sprint("user", i)}}
+			results[i], _, _ = fastRenderRun(templatePath, "Hi {{ .user.name }}", data, opts)
+		}(i)
+	}
+	wg.Wait()
+	for i, rendered := range results {
+		if want := fmt.Sprint("Hi user", i); rendered != want {
+			t.Fatalf("expected concurrent renders to keep their own output, got %q for %q", rendered, want)
+		}
+	}
+}
+
+func TestResponseBufferEncodesLikeMarshalJSON(t *testing.T) {
+	responses := []serverResponse{
+		{ID: json.RawMessage(`{"n": 1}`), response: response{Rendered: "<b>hi</b>", Diagnostics: []diagnostic{{Message: "m", Severity: "warning", Line: 1}}}},
+		{ID: json.RawMessage(`"two"`), response: response{Error: "boom"}, version: responseVersion2},
+		{response: response{Rendered: "no id"}},
+	}
+	buf := newResponseBuffer()
+	for _, resp := range responses {
+		want, err := json.Marshal(resp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := buf.encode(&resp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != string(want)+"\n" {
+			t.Fatalf("expected the pooled encoding to match MarshalJSON\ngot:  %s\nwant: %s", got, want)
+		}
+	}
+}
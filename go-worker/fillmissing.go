@@ -0,0 +1,272 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template/parse"
+	"unicode"
+)
+
+// fillMissingFaker is the --fill-missing value that gives every field the
+// template reads but the context lacks a plausible placeholder.
+const fillMissingFaker = "faker"
+
+// fakeListLength is how many elements a placeholder list has: enough to
+// show a range repeating, few enough to read.
+const fakeListLength = 3
+
+func validateFillMissing(opts renderOptions) error {
+	switch opts.FillMissing {
+	case "":
+		return nil
+	case fillMissingFaker:
+		if opts.ProductionParity {
+			return errors.New("--fill-missing cannot be used with --production-parity, which renders the context as production would")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown --fill-missing %q: use %s", opts.FillMissing, fillMissingFaker)
+	}
+}
+
+// fillMissingContext returns a copy of data in which every context path the
+// template reads, according to the analysis of analyze mode, has a value,
+// and the paths it filled. Values the context has are kept, down to the
+// elements of its lists; only absent keys are filled. Placeholders follow
+// the field's name, so an email field gets an address and a price a price,
+// and are the same on every render, so the preview does not flicker.
+func fillMissingContext(templatePath, content string, data interface{}, opts renderOptions) (interface{}, []string) {
+	if opts.FillMissing == "" {
+		return data, nil
+	}
+	name := templateName(templatePath)
+	// A template that does not parse is left to the render to report.
+	trees, err := parseTreesWithDelims(name, content, opts.LeftDelim, opts.RightDelim)
+	if err != nil {
+		return data, nil
+	}
+	for _, include := range opts.includes {
+		tree := parse.New(include.Name)
+		tree.Mode = parse.ParseComments | parse.SkipFuncCheck
+		_, _ = tree.Parse(include.Content, opts.LeftDelim, opts.RightDelim, trees)
+	}
+	schema := analyzeTrees(templatePath, name, content, trees).Schema
+
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	faker := &contextFaker{}
+	filled := faker.fill(copyContext(data), schema, "", 0)
+	return filled, faker.paths
+}
+
+type contextFaker struct {
+	paths []string
+}
+
+// fill adds the fields schema has and value lacks. item is the 1-based
+// position of value in a list, or 0.
+func (f *contextFaker) fill(value interface{}, schema *schemaNode, path string, item int) interface{} {
+	switch schema.Type {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return value
+		}
+		for _, name := range sortedSchemaProperties(schema) {
+			property := schema.Properties[name]
+			if existing, ok := object[name]; ok {
+				object[name] = f.fill(existing, property, path+"."+name, item)
+				continue
+			}
+			object[name] = fakeValue(property, name, item)
+			if !containsString(f.paths, path+"."+name) {
+				f.paths = append(f.paths, path+"."+name)
+			}
+		}
+	case "array":
+		if list, ok := value.([]interface{}); ok && schema.Items != nil {
+			for i := range list {
+				list[i] = f.fill(list[i], schema.Items, path+"[]", i+1)
+			}
+		}
+	}
+	return value
+}
+
+func sortedSchemaProperties(schema *schemaNode) []string {
+	names := make([]string, 0, len(schema.Properties))
+	for name := range schema.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// fakeValue makes up a value of the shape schema describes for the field
+// name. item is the 1-based position in a list, or 0.
+func fakeValue(schema *schemaNode, name string, item int) interface{} {
+	switch schema.Type {
+	case "object":
+		object := make(map[string]interface{}, len(schema.Properties))
+		for property, child := range schema.Properties {
+			object[property] = fakeValue(child, property, item)
+		}
+		return object
+	case "array":
+		elements := &schemaNode{}
+		if schema.Items != nil {
+			elements = schema.Items
+		}
+		list := make([]interface{}, fakeListLength)
+		for i := range list {
+			list[i] = fakeValue(elements, singular(name), i+1)
+		}
+		return list
+	case "number":
+		if number, ok := fakeNumber(name, item); ok {
+			return number
+		}
+		return 3 + max(item-1, 0)
+	case "boolean":
+		return true
+	case "string":
+		return fakeString(name, item)
+	}
+	// The template only printed or tested the value, so the name decides.
+	if number, ok := fakeNumber(name, item); ok {
+		return number
+	}
+	return fakeString(name, item)
+}
+
+var (
+	fakeFirstNames = [...]string{"Ada", "Alan", "Grace"}
+	fakeLastNames  = [...]string{"Lovelace", "Turing", "Hopper"}
+	fakeCities     = [...]string{"London", "Manchester", "Arlington"}
+	fakePrices     = [...]float64{19.99, 42.5, 7.25}
+)
+
+// fakeString makes up a string for the field name. The first pattern the
+// lower-cased name contains wins, so more specific patterns come first.
+func fakeString(name string, item int) string {
+	i := max(item-1, 0) % fakeListLength
+	lower := strings.ToLower(name)
+	has := func(patterns ...string) bool { return containsAnyOf(lower, patterns) }
+	switch {
+	case lower == "id" || strings.HasSuffix(name, "ID") || strings.HasSuffix(name, "Id") || strings.HasSuffix(lower, "_id") || has("uuid"):
+		return fmt.Sprintf("id-%d", 1001+i)
+	case has("email"):
+		return strings.ToLower(fakeFirstNames[i]) + "@example.com"
+	case has("username", "login", "handle"):
+		return strings.ToLower(fakeFirstNames[i])
+	case has("firstname", "first_name", "givenname", "given_name"):
+		return fakeFirstNames[i]
+	case has("lastname", "last_name", "surname", "familyname", "family_name"):
+		return fakeLastNames[i]
+	case has("image", "avatar", "photo", "logo", "icon"):
+		return fmt.Sprintf("https://example.com/images/placeholder-%d.png", i+1)
+	case has("url", "link", "href", "website"):
+		return fmt.Sprintf("https://example.com/%s/%d", lower, i+1)
+	case has("phone", "mobile", "tel"):
+		return fmt.Sprintf("+1 555 010%d", i)
+	case has("date", "time", "created", "updated") || strings.HasSuffix(name, "At") || strings.HasSuffix(lower, "_at"):
+		return fmt.Sprintf("2024-01-%02d", 15+i)
+	case has("address", "street"):
+		return fmt.Sprintf("%d Example Street", 12+i)
+	case has("city", "town"):
+		return fakeCities[i]
+	case has("country"):
+		return "United Kingdom"
+	case has("currency"):
+		return "USD"
+	case has("color", "colour"):
+		return "#3366cc"
+	case has("status", "state"):
+		return "active"
+	case has("description", "summary", "body", "content", "text", "bio", "message", "comment"):
+		return "Lorem ipsum dolor sit amet, consectetur adipiscing elit."
+	case lower == "name" || has("fullname", "full_name", "author", "user", "owner", "customer", "contact"):
+		return fakeFirstNames[i] + " " + fakeLastNames[i]
+	}
+	placeholder := humanizeFieldName(name)
+	if item > 0 {
+		placeholder += fmt.Sprintf(" %d", item)
+	}
+	return placeholder
+}
+
+// fakeNumber makes up a number for the field name, when the name says
+// what kind of number it is.
+func fakeNumber(name string, item int) (interface{}, bool) {
+	i := max(item-1, 0) % fakeListLength
+	lower := strings.ToLower(name)
+	has := func(patterns ...string) bool { return containsAnyOf(lower, patterns) }
+	switch {
+	case has("price", "amount", "total", "cost", "balance", "salary", "fee", "subtotal", "tax"):
+		return fakePrices[i], true
+	case has("count", "quantity", "qty", "number", "num"):
+		return 3 + i, true
+	case has("year"):
+		return 2024, true
+	case lower == "age" || strings.HasSuffix(lower, "_age") || strings.HasSuffix(name, "Age"):
+		return 36 + i, true
+	case has("percent", "rate", "ratio"):
+		return 0.25, true
+	}
+	return nil, false
+}
+
+// humanizeFieldName turns productName or product_name into Product name.
+func humanizeFieldName(name string) string {
+	var words []string
+	var word []rune
+	flush := func() {
+		if len(word) > 0 {
+			words = append(words, strings.ToLower(string(word)))
+			word = word[:0]
+		}
+	}
+	for _, r := range name {
+		switch {
+		case r == '_' || r == '-' || r == ' ':
+			flush()
+		case unicode.IsUpper(r) && len(word) > 0 && !unicode.IsUpper(word[len(word)-1]):
+			flush()
+			word = append(word, r)
+		default:
+			word = append(word, r)
+		}
+	}
+	flush()
+	if len(words) == 0 {
+		return "Sample"
+	}
+	phrase := []rune(strings.Join(words, " "))
+	phrase[0] = unicode.ToUpper(phrase[0])
+	return string(phrase)
+}
+
+// singular guesses the element name of a list field: items is item,
+// categories is category.
+func singular(name string) string {
+	switch {
+	case strings.HasSuffix(name, "ies") && len(name) > 3:
+		return name[:len(name)-3] + "y"
+	case strings.HasSuffix(name, "s") && !strings.HasSuffix(name, "ss"):
+		return name[:len(name)-1]
+	}
+	return name
+}
+
+// containsAnyOf reports whether s contains any of patterns.
+func containsAnyOf(s string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if strings.Contains(s, pattern) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFillMissingGivesAbsentFieldsPlaceholders(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "order.tmpl")
+	writeFile(t, templatePath, `Dear {{ .customer.firstName }} <{{ .customer.email }}>
+{{ range .orders }}{{ .productName }}: {{ printf "%.2f" .price }}{{ if .shipped }} shipped{{ end }}
+{{ end }}{{ if gt .count 1 }}{{ .count }} orders{{ end }}`)
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, contextPath, `{"customer": {"firstName": "Bob"}}`)
+
+	resp := run(templatePath, contextPath, renderOptions{FillMissing: fillMissingFaker, MissingKey: missingKeyError})
+	want := `Dear Bob <ada@example.com>
+Product name 1: 19.99 shipped
+Product name 2: 42.50 shipped
+Product name 3: 7.25 shipped
+3 orders`
+	if resp.Error != "" || resp.Rendered != want {
+		t.Fatalf("expected %q, got %+v", want, resp)
+	}
+	if wantFilled := []string{".count", ".customer.email", ".orders"}; !reflect.DeepEqual(resp.Filled, wantFilled) {
+		t.Fatalf("expected %v filled, got %v", wantFilled, resp.Filled)
+	}
+
+	// The same request fills the same values.
+	if again := run(templatePath, contextPath, renderOptions{FillMissing: fillMissingFaker}); again.Rendered != want {
+		t.Fatalf("expected placeholders to be stable, got %q", again.Rendered)
+	}
+	if resp := run(templatePath, contextPath, renderOptions{FillMissing: "lorem"}); resp.Error == "" {
+		t.Fatalf("expected an unknown --fill-missing to fail")
+	}
+}
+
+func TestFillMissingIsRefusedUnderProductionParity(t *testing.T) {
+	templatePath := filepath.Join(t.TempDir(), "order.tmpl")
+	writeFile(t, templatePath, `{{ .customer.email }}`)
+
+	resp := run(templatePath, "", renderOptions{FillMissing: fillMissingFaker, ProductionParity: true})
+	if resp.Error != "--fill-missing cannot be used with --production-parity, which renders the context as production would" || resp.Filled != nil {
+		t.Fatalf("expected --fill-missing to be refused, got %+v", resp)
+	}
+}
+
+func TestFillMissingKeepsExistingListElements(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "list.tmpl")
+	writeFile(t, templatePath, `{{ range .users }}{{ .name }} {{ .email }};{{ end }}`)
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, contextPath, `{"users": [{"name": "Bob"}, {"name": "Eve", "email": "eve@corp.test"}, {}]}`)
+
+	resp := run(templatePath, contextPath, renderOptions{FillMissing: fillMissingFaker})
+	if want := "Bob ada@example.com;Eve eve@corp.test;Grace Hopper grace@example.com;"; resp.Rendered != want {
+		t.Fatalf("expected %q, got %+v", want, resp)
+	}
+	if want := []string{".users[].email", ".users[].name"}; !reflect.DeepEqual(resp.Filled, want) {
+		t.Fatalf("expected %v filled, got %v", want, resp.Filled)
+	}
+}
+
+func TestFakeValuesFollowFieldNames(t *testing.T) {
+	cases := map[string]interface{}{
+		"avatarUrl":  "https://example.com/images/placeholder-1.png",
+		"homepage":   "Homepage",
+		"created_at": "2024-01-15",
+		"userId":     "id-1001",
+		"total":      19.99,
+		"itemCount":  3,
+		"lastName":   "Lovelace",
+		"name":       "Ada Lovelace",
+	}
+	for name, want := range cases {
+		if got := fakeValue(&schemaNode{}, name, 0); got != want {
+			t.Errorf("%s: expected %v, got %v", name, want, got)
+		}
+	}
+	if got := humanizeFieldName("shipping_addressLine"); got != "Shipping address line" {
+		t.Errorf("expected a humanized name, got %q", got)
+	}
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template/parse"
+)
+
+// fmtTrimModes are the values of --fmt-trim; the first is the default.
+// keep leaves trim markers as written, standalone adds a left marker to
+// control actions and comments alone on their line, and none removes
+// every marker.
+var fmtTrimModes = []string{"keep", "standalone", "none"}
+
+// formatReport is the result of fmt mode: the formatted template, or with
+// --fmt-edits the edits that turn the template into it.
+type formatReport struct {
+	Changed   bool       `json:"changed"`
+	Formatted string     `json:"formatted,omitempty"`
+	Edits     []textEdit `json:"edits,omitempty"`
+}
+
+// fmtRunReport is the outcome of the fmt subcommand: the templates that
+// were not formatted, and whether they were rewritten.
+type fmtRunReport struct {
+	Files   []string `json:"files"`
+	Written bool     `json:"written"`
+}
+
+// formatChange replaces the action at Start:End of the original template.
+type formatChange struct {
+	Start int
+	End   int
+	Text  string
+}
+
+func validateFmtTrim(opts renderOptions) error {
+	if opts.FmtTrim == "" {
+		return nil
+	}
+	for _, mode := range fmtTrimModes {
+		if opts.FmtTrim == mode {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown fmt trim mode %q: use %s", opts.FmtTrim, strings.Join(fmtTrimModes, ", "))
+}
+
+// executeFmt formats the template, or opts.Source when the editor sends
+// its unsaved text.
+func executeFmt(templatePath string, opts renderOptions) response {
+	if templatePath == "" {
+		return response{Error: "template path is required"}
+	}
+	content := opts.Source
+	if content == "" {
+		var err error
+		if content, err = readTemplate(templatePath, opts); err != nil {
+			return response{Error: err.Error()}
+		}
+	}
+	opts.reads.record(templatePath, content)
+
+	formatted, changes, err := formatSource(templatePath, content, opts)
+	if err != nil {
+		var parseErr *parseFailure
+		if errors.As(err, &parseErr) {
+			return response{
+				Diagnostics: []diagnostic{templateDiagnosticWithDelims(parseErr.err, templatePath, content, opts.LeftDelim, opts.RightDelim)},
+				Error:       parseErr.err.Error(),
+			}
+		}
+		return response{Error: err.Error()}
+	}
+
+	report := &formatReport{Changed: formatted != content}
+	if !opts.FmtEdits {
+		report.Formatted = formatted
+		return response{Format: report}
+	}
+	report.Edits = []textEdit{}
+	for _, change := range changes {
+		edit := textEdit{File: templatePath, NewText: change.Text}
+		edit.Line, edit.Column = lineColumn(content, parse.Pos(change.Start))
+		edit.EndLine, edit.EndColumn = lineColumn(content, parse.Pos(change.End))
+		report.Edits = append(report.Edits, edit)
+	}
+	return response{Format: report}
+}
+
+// parseFailure is a template that cannot be formatted because it does not
+// parse.
+type parseFailure struct {
+	err error
+}
+
+func (f *parseFailure) Error() string {
+	return f.err.Error()
+}
+
+// formatSource formats content and makes sure the result parses to the
+// same templates. Only trim markers may change what a template renders,
+// so unless --fmt-trim changes them the trees must match exactly.
+func formatSource(templatePath, content string, opts renderOptions) (string, []formatChange, error) {
+	name := templateName(templatePath)
+	before, err := parseTreesWithDelims(name, content, opts.LeftDelim, opts.RightDelim)
+	if err != nil {
+		return "", nil, &parseFailure{err: err}
+	}
+	formatted, changes := formatTemplate(content, opts.LeftDelim, opts.RightDelim, opts.FmtTrim)
+	after, err := parseTreesWithDelims(name, formatted, opts.LeftDelim, opts.RightDelim)
+	if err != nil {
+		return "", nil, fmt.Errorf("formatting %s produced a template that does not parse: %v", templatePath, err)
+	}
+	if opts.FmtTrim == "" || opts.FmtTrim == "keep" {
+		for treeName, tree := range before {
+			if other, ok := after[treeName]; !ok || other.Root.String() != tree.Root.String() {
+				return "", nil, fmt.Errorf("formatting %s changed template %q; leaving it as written", templatePath, treeName)
+			}
+		}
+	}
+	return formatted, changes, nil
+}
+
+// formatTemplate reprints every action of content with one space inside
+// its delimiters and normalized spacing in its pipeline. Text between
+// actions is never touched.
+func formatTemplate(content, leftDelim, rightDelim, trim string) (string, []formatChange) {
+	if leftDelim == "" {
+		leftDelim = defaultLeftDelim
+	}
+	if rightDelim == "" {
+		rightDelim = defaultRightDelim
+	}
+
+	var builder strings.Builder
+	builder.Grow(len(content))
+	var changes []formatChange
+	offset := 0
+	for _, action := range scanActions(content, leftDelim, rightDelim) {
+		text := formatAction(content, action, leftDelim, rightDelim, trim)
+		builder.WriteString(content[offset:action.Start])
+		builder.WriteString(text)
+		offset = action.End
+		if text != content[action.Start:action.End] {
+			changes = append(changes, formatChange{Start: action.Start, End: action.End, Text: text})
+		}
+	}
+	builder.WriteString(content[offset:])
+	return builder.String(), changes
+}
+
+func formatAction(content string, action actionSpan, leftDelim, rightDelim, trim string) string {
+	trimLeft, trimRight := action.TrimLeft, action.TrimRight
+	switch trim {
+	case "standalone":
+		if standaloneAction(content, action) {
+			trimLeft = true
+		}
+	case "none":
+		trimLeft, trimRight = false, false
+	}
+
+	left, right := leftDelim+" ", " "+rightDelim
+	body := action.Body()
+	if action.IsComment() {
+		// A comment must touch its delimiters or trim markers.
+		left, right = leftDelim, rightDelim
+	} else {
+		body = formatActionBody(body)
+	}
+	if trimLeft {
+		left = leftDelim + "- "
+	}
+	if trimRight {
+		right = " -" + rightDelim
+	}
+	return left + body + right
+}
+
+// standaloneAction reports whether action is a control action or comment
+// with nothing but whitespace around it on its line, the lines a left
+// trim marker keeps out of the output.
+func standaloneAction(content string, action actionSpan) bool {
+	if !action.IsComment() {
+		switch action.Keyword() {
+		case "if", "else", "end", "range", "with", "define", "block", "break", "continue":
+		default:
+			return false
+		}
+	}
+	lineStart := strings.LastIndexByte(content[:action.Start], '\n') + 1
+	if strings.Trim(content[lineStart:action.Start], " \t") != "" {
+		return false
+	}
+	rest := content[action.End:]
+	if lineEnd := strings.IndexByte(rest, '\n'); lineEnd >= 0 {
+		rest = rest[:lineEnd]
+	}
+	return strings.Trim(rest, " \t\r") == ""
+}
+
+// formatActionBody puts single spaces between the words of a pipeline and
+// around |, :=, and =, none inside parentheses or before commas, and keeps
+// line breaks and quoted text as written.
+func formatActionBody(body string) string {
+	var builder strings.Builder
+	spaced := false // whitespace came before the next token
+	wanted := false // the previous token wants a space after it
+	glued := true   // the next token follows an opening parenthesis or a line break
+	write := func(token string, before bool) {
+		if !glued && (before || spaced || wanted) {
+			builder.WriteByte(' ')
+		}
+		builder.WriteString(token)
+		spaced, wanted, glued = false, false, false
+	}
+
+	for i := 0; i < len(body); {
+		c := body[i]
+		switch {
+		case strings.IndexByte(templateTrimCutset, c) >= 0:
+			j := i
+			for j < len(body) && strings.IndexByte(templateTrimCutset, body[j]) >= 0 {
+				j++
+			}
+			if newline := strings.IndexByte(body[i:j], '\n'); newline >= 0 {
+				builder.WriteString(body[i+newline : j])
+				glued = true
+			}
+			spaced = true
+			i = j
+		case c == '"' || c == '\'' || c == '`':
+			end := quotedEnd(body, i)
+			write(body[i:end], false)
+			i = end
+		case c == '|' || c == '=' || c == ':' && strings.HasPrefix(body[i:], ":="):
+			operator := body[i : i+1]
+			if c == ':' {
+				operator = ":="
+			}
+			write(operator, true)
+			wanted = true
+			i += len(operator)
+		case c == ',':
+			builder.WriteByte(',')
+			spaced, wanted, glued = false, true, false
+			i++
+		case c == '(':
+			write("(", false)
+			glued = true
+			i++
+		case c == ')':
+			builder.WriteByte(')')
+			spaced, wanted, glued = false, false, false
+			i++
+		default:
+			j := i
+			for j < len(body) && !strings.ContainsRune(" \t\r\n\"'`|=:,()", rune(body[j])) {
+				j++
+			}
+			if j == i {
+				j++
+			}
+			write(body[i:j], false)
+			i = j
+		}
+	}
+	return builder.String()
+}
+
+// quotedEnd returns the offset just past the string, raw string, or
+// character literal starting at body[start].
+func quotedEnd(body string, start int) int {
+	quote := body[start]
+	for i := start + 1; i < len(body); i++ {
+		switch body[i] {
+		case '\\':
+			if quote != '`' {
+				i++
+			}
+		case quote:
+			return i + 1
+		}
+	}
+	return len(body)
+}
+
+// runFmt is the fmt subcommand: it reports the templates among the given
+// files and directories that are not formatted, and rewrites them with
+// --write.
+func runFmt(args []string) response {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	trim := flags.String("trim", fmtTrimModes[0], "Trim marker handling: keep, standalone, or none")
+	write := flags.Bool("write", false, "Rewrite the templates that are not formatted")
+	if err := flags.Parse(args); err != nil {
+		return response{Error: "fmt: " + err.Error()}
+	}
+	opts := renderOptions{FmtTrim: *trim}
+	if err := validateFmtTrim(opts); err != nil {
+		return response{Error: "fmt: " + err.Error()}
+	}
+	if flags.NArg() == 0 {
+		return response{Error: "fmt: no templates given"}
+	}
+
+	var paths []string
+	for _, arg := range flags.Args() {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return response{Error: "fmt: " + err.Error()}
+		}
+		if !info.IsDir() {
+			paths = append(paths, arg)
+			continue
+		}
+		files, err := collectDirFiles(arg)
+		if err != nil {
+			return response{Error: "fmt: " + err.Error()}
+		}
+		for _, file := range files {
+			if _, ok := trimTemplateSuffix(file); ok {
+				paths = append(paths, filepath.Join(arg, filepath.FromSlash(file)))
+			}
+		}
+	}
+
+	report := &fmtRunReport{Files: []string{}, Written: *write}
+	var diagnostics []diagnostic
+	for _, path := range paths {
+		contentBytes, err := os.ReadFile(path)
+		if err != nil {
+			diagnostics = append(diagnostics, diagnostic{Message: err.Error(), Severity: "error", File: path})
+			continue
+		}
+		content := string(contentBytes)
+		formatted, _, err := formatSource(path, content, opts)
+		if err != nil {
+			var parseErr *parseFailure
+			if errors.As(err, &parseErr) {
+				diagnostics = append(diagnostics, templateDiagnostic(parseErr.err, path, content))
+			} else {
+				diagnostics = append(diagnostics, diagnostic{Message: err.Error(), Severity: "error", File: path})
+			}
+			continue
+		}
+		if formatted == content {
+			continue
+		}
+		report.Files = append(report.Files, path)
+		if *write {
+			if err := writeFileAtomic(path, []byte(formatted)); err != nil {
+				diagnostics = append(diagnostics, diagnostic{Message: err.Error(), Severity: "error", File: path})
+			}
+		}
+	}
+	return response{FmtRun: report, Diagnostics: diagnostics}
+}
+
+// writeFileAtomic replaces path through a temporary file in the same
+// directory, keeping its permissions.
+func writeFileAtomic(path string, data []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	temp := path + ".fmt.tmp"
+	if err := os.WriteFile(temp, data, info.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Rename(temp, path)
+}
+
+// fmtExitCode is 0 when every template was formatted or rewritten, 1 when
+// some were not formatted, and 2 when fmt could not read or parse them.
+func fmtExitCode(resp response) int {
+	if resp.FmtRun == nil || len(resp.Diagnostics) > 0 {
+		return 2
+	}
+	if len(resp.FmtRun.Files) > 0 && !resp.FmtRun.Written {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFmtNormalizesActionSpacing(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "page.tmpl")
+	writeFile(t, templatePath, "{{/* header */}}\n{{$items:=.items}}{{range  $i,$item := $items}}{{ printf \"%d:  %s\"   $i ( $item|upper ) }}{{end}}\n{{-  .title|printf \"%s\"  -}}\n")
+
+	resp := run(templatePath, "", renderOptions{Mode: "fmt"})
+	if resp.Error != "" || resp.Format == nil || !resp.Format.Changed {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	want := "{{/* header */}}\n{{ $items := .items }}{{ range $i, $item := $items }}{{ printf \"%d:  %s\" $i ($item | upper) }}{{ end }}\n{{- .title | printf \"%s\" -}}\n"
+	if resp.Format.Formatted != want {
+		t.Fatalf("unexpected formatting:\n%s", resp.Format.Formatted)
+	}
+
+	writeFile(t, templatePath, want)
+	if resp := run(templatePath, "", renderOptions{Mode: "fmt"}); resp.Format == nil || resp.Format.Changed || resp.Format.Formatted != want {
+		t.Fatalf("expected formatted text to stay as it is, got %+v", resp)
+	}
+}
+
+func TestFmtEditsAndTrimMarkers(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "page.tmpl")
+	writeFile(t, templatePath, "<ul>\n  {{if .items}}\n  <li>{{.name}}</li>\n  {{- end}}\n</ul>\n")
+
+	resp := run(templatePath, "", renderOptions{Mode: "fmt", FmtTrim: "standalone", FmtEdits: true})
+	if resp.Error != "" || resp.Format == nil || resp.Format.Formatted != "" || len(resp.Format.Edits) != 3 {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	first := resp.Format.Edits[0]
+	if first.NewText != "{{- if .items }}" || first.Line != 2 || first.Column != 3 || first.EndLine != 2 || first.EndColumn != 16 {
+		t.Fatalf("unexpected edit: %+v", first)
+	}
+	if resp.Format.Edits[1].NewText != "{{ .name }}" || resp.Format.Edits[2].NewText != "{{- end }}" {
+		t.Fatalf("unexpected edits: %+v", resp.Format.Edits)
+	}
+
+	resp = run(templatePath, "", renderOptions{Mode: "fmt", FmtTrim: "none"})
+	if resp.Format == nil || resp.Format.Formatted != "<ul>\n  {{ if .items }}\n  <li>{{ .name }}</li>\n  {{ end }}\n</ul>\n" {
+		t.Fatalf("expected every trim marker removed, got %+v", resp)
+	}
+	if resp := run(templatePath, "", renderOptions{Mode: "fmt", FmtTrim: "all"}); resp.Error == "" {
+		t.Fatal("expected an unknown trim mode to be rejected")
+	}
+}
+
+func TestFmtSubcommandListsAndRewritesTemplates(t *testing.T) {
+	dir := t.TempDir()
+	formatted := filepath.Join(dir, "templates", "ok.tmpl")
+	writeFile(t, formatted, "{{ .name }}")
+	messy := filepath.Join(dir, "templates", "messy.tmpl")
+	writeFile(t, messy, "{{.name}}")
+	writeFile(t, filepath.Join(dir, "templates", "notes.txt"), "{{.ignored}}")
+
+	resp := runFmt([]string{filepath.Join(dir, "templates")})
+	if resp.FmtRun == nil || len(resp.FmtRun.Files) != 1 || resp.FmtRun.Files[0] != messy || fmtExitCode(resp) != 1 {
+		t.Fatalf("expected messy.tmpl to be listed, got %+v", resp)
+	}
+
+	resp = runFmt([]string{"--write", messy})
+	if fmtExitCode(resp) != 0 {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	if content, err := os.ReadFile(messy); err != nil || string(content) != "{{ .name }}" {
+		t.Fatalf("expected messy.tmpl to be rewritten, got %q (%v)", content, err)
+	}
+
+	writeFile(t, messy, "{{ .name ")
+	if resp := runFmt([]string{messy}); fmtExitCode(resp) != 2 || len(resp.Diagnostics) != 1 {
+		t.Fatalf("expected a parse error, got %+v", resp)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+// funcDoc is the hover documentation for one template function.
+type funcDoc struct {
+	Signature string
+	Doc       string
+}
+
+const sprigDocsURL = "https://masterminds.github.io/sprig/"
+
+// builtinFuncDocs documents the functions text/template predefines.
+var builtinFuncDocs = map[string]funcDoc{
+	"and":      {"and x y ...", "Returns the first empty argument or the last argument. Evaluation stops at the first empty argument."},
+	"or":       {"or x y ...", "Returns the first non-empty argument or the last argument. Evaluation stops at the first non-empty argument."},
+	"not":      {"not x", "Returns the boolean negation of its single argument."},
+	"len":      {"len x", "Returns the length of a string, slice, array, map, or channel."},
+	"index":    {"index collection key ...", "Indexes a map, slice, or array by each key in turn: index .m \"a\" 1 is .m[\"a\"][1]. A missing map key yields the zero value."},
+	"slice":    {"slice x start [end [max]]", "Slices a string, slice, or array: slice .s 1 3 is .s[1:3]."},
+	"print":    {"print args ...", "Formats its arguments like fmt.Sprint."},
+	"printf":   {"printf format args ...", "Formats its arguments like fmt.Sprintf."},
+	"println":  {"println args ...", "Formats its arguments like fmt.Sprintln."},
+	"html":     {"html args ...", "Returns the HTML-escaped text of its arguments. Not available in html/template, which escapes automatically."},
+	"js":       {"js args ...", "Returns the JavaScript-escaped text of its arguments."},
+	"urlquery": {"urlquery args ...", "Returns its arguments escaped for use in a URL query."},
+	"call":     {"call fn args ...", "Calls a function value, such as a func field of the context, with the remaining arguments."},
+	"eq":       {"eq x y ...", "Reports whether x equals y, or any of the later arguments."},
+	"ne":       {"ne x y", "Reports whether x does not equal y."},
+	"lt":       {"lt x y", "Reports whether x is less than y."},
+	"le":       {"le x y", "Reports whether x is less than or equal to y."},
+	"gt":       {"gt x y", "Reports whether x is greater than y."},
+	"ge":       {"ge x y", "Reports whether x is greater than or equal to y."},
+}
+
+// helperFuncDocs documents the worker's own helpers.
+var helperFuncDocs = map[string]funcDoc{
+	"list":         {"list values ...", "Returns its arguments as a list."},
+	"map":          {"map key value ...", "Builds a map from string keys and values given in pairs."},
+	"dict":         {"dict key value ...", "Same as map: builds a map from string keys and values given in pairs."},
+	"upper":        {"upper value", "Converts the value's text to upper case."},
+	"lower":        {"lower value", "Converts the value's text to lower case."},
+	"title":        {"title value", "Capitalizes the first letter of every word and lowercases the rest."},
+	"capitalize":   {"capitalize value", "Capitalizes the first letter and lowercases the rest."},
+	"trim":         {"trim value", "Removes leading and trailing white space."},
+	"strip":        {"strip value", "Same as trim: removes leading and trailing white space."},
+	"trimPrefix":   {"trimPrefix prefix value", "Removes prefix from the start of the value if present."},
+	"trimSuffix":   {"trimSuffix suffix value", "Removes suffix from the end of the value if present."},
+	"indent":       {"indent spaces value", "Puts spaces spaces before every line of the value, for YAML blocks."},
+	"nindent":      {"nindent spaces value", "Like indent, but starts with a newline, so the block can follow a key: {{- .labels | toYaml | nindent 4 }}."},
+	"quote":        {"quote values ...", "Wraps each value in double quotes, escaped as a Go string, and joins them with spaces; nil values are left out."},
+	"squote":       {"squote values ...", "Wraps each value in single quotes, without escaping, and joins them with spaces."},
+	"shellQuote":   {"shellQuote values ...", "Quotes each value as one POSIX shell word and joins them with spaces."},
+	"replace":      {"replace old new value", "Replaces every occurrence of old in the value with new; pipe the value in last."},
+	"default":      {"default fallback value", "Returns value, or fallback when value is empty: nil, false, 0, \"\", or an empty list or map."},
+	"join":         {"join separator list", "Joins the elements of a list with separator."},
+	"escape":       {"escape value", "HTML-escapes the value's text."},
+	"safe":         {"safe value", "Marks the value as trusted HTML so html/template does not escape it."},
+	"t":            {"t message args ...", "Translation stand-in: returns message, formatted with args like printf when any are given."},
+	"typeOf":       {"typeOf value", "Returns the value's Go type, such as []interface {} or float64."},
+	"kindOf":       {"kindOf value", "Returns the value's kind, such as slice, map, string, float64, or invalid for nil."},
+	"typeIs":       {"typeIs type value", "Reports whether the value's Go type is type."},
+	"mustBeList":   {"mustBeList value", "Returns the value if it is a list and fails the render otherwise."},
+	"mustBeMap":    {"mustBeMap value", "Returns the value if it is a map and fails the render otherwise."},
+	"mustBeString": {"mustBeString value", "Returns the value if it is a string and fails the render otherwise."},
+	"mustBeNumber": {"mustBeNumber value", "Returns the value if it is a number and fails the render otherwise."},
+	"mustBeBool":   {"mustBeBool value", "Returns the value if it is a boolean and fails the render otherwise."},
+	"nav":          {"nav path value", "Follows a dotted path such as \".a.b.0\" from value, returning nil instead of failing when a step is missing."},
+	"withLoop":     {"withLoop collection", "Wraps each element of a list or map with Index, Key, Value, First, Last, Odd, and Even for use in range."},
+	"toJson":       {"toJson value", "Encodes the value as compact JSON, failing the render if it cannot be encoded."},
+	"toPrettyJson": {"toPrettyJson value", "Encodes the value as JSON indented by two spaces."},
+	"fromJson":     {"fromJson string", "Decodes a JSON document into maps, lists, and numbers, failing the render if it is invalid."},
+	"toYaml":       {"toYaml value", "Encodes the value as YAML indented by two spaces, without a trailing newline."},
+	"fromYaml":     {"fromYaml string", "Decodes a YAML document into maps, lists, and scalars, failing the render if it is invalid."},
+	"add":          {"add x y ...", "Returns the sum of its arguments. Whole results stay whole, so add .count 1 prints 1000001, not 1.000001e+06."},
+	"sub":          {"sub x y", "Returns x minus y."},
+	"mul":          {"mul x y ...", "Returns the product of its arguments."},
+	"div":          {"div x y", "Returns x divided by y exactly, so div 7 2 is 3.5; use floor (div x y) for integer division. Dividing by zero fails the render."},
+	"mod":          {"mod x y", "Returns the remainder of x divided by y, with the sign of x. Dividing by zero fails the render."},
+	"max":          {"max x y ...", "Returns the largest of its arguments."},
+	"min":          {"min x y ...", "Returns the smallest of its arguments."},
+	"floor":        {"floor x", "Returns the greatest whole number less than or equal to x."},
+	"ceil":         {"ceil x", "Returns the least whole number greater than or equal to x."},
+	"round":        {"round x [places]", "Rounds half away from zero, to a whole number or to places decimal places."},
+	"uuidv4":       {"uuidv4", "Returns a random version 4 UUID; the same one on every render with --seed."},
+	"randAlphaNum": {"randAlphaNum count", "Returns count random letters and digits; the same ones on every render with --seed."},
+	"randInt":      {"randInt min max", "Returns a random whole number from min up to, but not including, max; the same one on every render with --seed."},
+	"b64enc":       {"b64enc value", "Encodes the value as padded base64."},
+	"b64dec":       {"b64dec string", "Decodes base64, with or without padding, failing the render if it is invalid."},
+	"sha256sum":    {"sha256sum value", "Returns the hex SHA-256 digest of the value."},
+	"sha1sum":      {"sha1sum value", "Returns the hex SHA-1 digest of the value."},
+	"md5sum":       {"md5sum value", "Returns the hex MD5 digest of the value."},
+	"env":          {"env name", "Returns the environment variable name when --allow-env allows it, and the empty string otherwise."},
+	"file":         {"file path", "Returns the content of the file at path, relative to the template, when it is under an --allow-file-root, and the empty string otherwise."},
+}
+
+// sprigFuncDocs documents the Sprig functions templates reach for most; the
+// rest fall back to their Go signature and a link to the Sprig docs.
+var sprigFuncDocs = map[string]funcDoc{
+	"default":       {"default fallback value", "Returns value, or fallback when value is empty."},
+	"empty":         {"empty value", "Reports whether the value is empty: nil, false, 0, \"\", or an empty list or map."},
+	"coalesce":      {"coalesce values ...", "Returns the first non-empty argument."},
+	"ternary":       {"ternary ifTrue ifFalse condition", "Returns ifTrue when condition is true and ifFalse otherwise."},
+	"quote":         {"quote values ...", "Wraps each argument in double quotes, escaping as Go would, and joins them with spaces."},
+	"squote":        {"squote values ...", "Wraps each argument in single quotes and joins them with spaces."},
+	"upper":         {"upper string", "Converts the string to upper case."},
+	"lower":         {"lower string", "Converts the string to lower case."},
+	"title":         {"title string", "Converts the string to title case."},
+	"trim":          {"trim string", "Removes leading and trailing white space."},
+	"trimPrefix":    {"trimPrefix prefix string", "Removes prefix from the start of the string if present."},
+	"trimSuffix":    {"trimSuffix suffix string", "Removes suffix from the end of the string if present."},
+	"replace":       {"replace old new string", "Replaces every occurrence of old in the string with new."},
+	"contains":      {"contains substring string", "Reports whether the string contains substring."},
+	"hasPrefix":     {"hasPrefix prefix string", "Reports whether the string starts with prefix."},
+	"hasSuffix":     {"hasSuffix suffix string", "Reports whether the string ends with suffix."},
+	"repeat":        {"repeat count string", "Repeats the string count times."},
+	"indent":        {"indent spaces string", "Indents every line of the string by spaces spaces."},
+	"nindent":       {"nindent spaces string", "Like indent, but starts with a newline."},
+	"join":          {"join separator list", "Joins the elements of a list with separator."},
+	"split":         {"split separator string", "Splits the string into a map keyed _0, _1, and so on."},
+	"splitList":     {"splitList separator string", "Splits the string into a list."},
+	"list":          {"list values ...", "Returns its arguments as a list."},
+	"dict":          {"dict key value ...", "Builds a map from keys and values given in pairs."},
+	"get":           {"get map key", "Returns the value at key, or \"\" when it is missing."},
+	"set":           {"set map key value", "Sets key in the map and returns the map."},
+	"hasKey":        {"hasKey map key", "Reports whether the map contains key."},
+	"keys":          {"keys maps ...", "Returns the keys of one or more maps, in no particular order."},
+	"pluck":         {"pluck key maps ...", "Returns the values of key in each map that has it."},
+	"merge":         {"merge dest sources ...", "Merges sources into dest, keeping dest's values on conflict."},
+	"first":         {"first list", "Returns the first element of the list."},
+	"last":          {"last list", "Returns the last element of the list."},
+	"append":        {"append list value", "Returns a new list with value appended."},
+	"uniq":          {"uniq list", "Returns the list with duplicates removed."},
+	"has":           {"has value list", "Reports whether the list contains value."},
+	"until":         {"until count", "Returns the integers from 0 up to count."},
+	"seq":           {"seq [start [step]] end", "Returns the numbers from start to end as a space-separated string, like the Unix seq."},
+	"add":           {"add numbers ...", "Sums integers."},
+	"sub":           {"sub a b", "Returns a minus b as an integer."},
+	"mul":           {"mul numbers ...", "Multiplies integers."},
+	"div":           {"div a b", "Returns a divided by b as an integer."},
+	"mod":           {"mod a b", "Returns a modulo b."},
+	"toString":      {"toString value", "Converts the value to a string."},
+	"toJson":        {"toJson value", "Encodes the value as JSON, returning \"\" on error."},
+	"toPrettyJson":  {"toPrettyJson value", "Encodes the value as indented JSON."},
+	"b64enc":        {"b64enc string", "Encodes the string as base64."},
+	"b64dec":        {"b64dec string", "Decodes a base64 string."},
+	"sha256sum":     {"sha256sum string", "Returns the hex SHA-256 digest of the string."},
+	"now":           {"now", "Returns the current time."},
+	"date":          {"date layout time", "Formats a time with a Go layout string such as \"2006-01-02\"."},
+	"semverCompare": {"semverCompare constraint version", "Reports whether version satisfies a semantic version constraint such as \">=1.2.0\"."},
+	"required":      {"required message value", "Fails the render with message when value is empty."},
+	"fail":          {"fail message", "Fails the render with message."},
+	"typeOf":        {"typeOf value", "Returns the value's Go type."},
+	"kindOf":        {"kindOf value", "Returns the value's kind."},
+	"typeIs":        {"typeIs type value", "Reports whether the value's Go type is type."},
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/Masterminds/sprig/v3"
+)
+
+const (
+	funcLibraryBuiltin = "builtin"
+	funcLibrarySprig   = "sprig"
+)
+
+// funcLibraryReport tells the client how an optional function library was
+// merged with the worker's own helpers.
+type funcLibraryReport struct {
+	Name string `json:"name"`
+	// Overridden lists worker helpers replaced by the library's version.
+	Overridden []string `json:"overridden,omitempty"`
+	// Kept lists worker helpers the library does not define.
+	Kept []string `json:"kept,omitempty"`
+}
+
+func validateFuncLibrary(library string) error {
+	switch library {
+	case "", funcLibraryBuiltin, funcLibrarySprig:
+		return nil
+	default:
+		return fmt.Errorf("unknown function library %q (expected builtin or sprig)", library)
+	}
+}
+
+// applyFuncLibrary merges the requested library into funcs. Library
+// functions win collisions so templates written for Helm render unmodified.
+// The hermetic Sprig map is used, which leaves out env and expandenv just as
+// Helm does.
+func applyFuncLibrary[M ~map[string]interface{}](funcs M, library string) {
+	if library != funcLibrarySprig {
+		return
+	}
+	for name, fn := range sprig.HermeticTxtFuncMap() {
+		funcs[name] = fn
+	}
+}
+
+// describeFuncLibrary reports which worker helpers the library replaces.
+func describeFuncLibrary(library string) *funcLibraryReport {
+	if library != funcLibrarySprig {
+		return nil
+	}
+
+	libraryFuncs := sprig.HermeticTxtFuncMap()
+	report := &funcLibraryReport{Name: library}
+	for name := range textFuncMap() {
+		if _, ok := libraryFuncs[name]; ok {
+			report.Overridden = append(report.Overridden, name)
+		} else {
+			report.Kept = append(report.Kept, name)
+		}
+	}
+	sort.Strings(report.Overridden)
+	sort.Strings(report.Kept)
+	return report
+}
+
+// isSprigFunc reports whether the Sprig library defines name.
+func isSprigFunc(name string) bool {
+	_, ok := sprig.HermeticTxtFuncMap()[name]
+	return ok
+}
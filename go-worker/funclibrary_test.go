@@ -0,0 +1,58 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRunWithSprigRendersHelmStyleTemplates(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "values.tmpl")
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, templatePath, `{{ .name | quote }} {{ "a,b" | splitList "," | join "-" }} {{ .missing | default "d" }} {{ "x" | repeat 3 | upper }} {{ t "kept" }}`)
+	writeFile(t, contextPath, `{"name":"web"}`)
+
+	resp := run(templatePath, contextPath, renderOptions{Funcs: funcLibrarySprig})
+	if resp.Error != "" || resp.Rendered != `"web" a-b d XXX kept` {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	report := resp.FuncLibrary
+	if report == nil || report.Name != funcLibrarySprig {
+		t.Fatalf("expected sprig report, got %+v", report)
+	}
+	wantOverridden := []string{"add", "b64dec", "b64enc", "ceil", "default", "dict", "div", "floor", "fromJson", "indent", "join", "kindOf", "list", "lower", "max", "min", "mod", "mul", "nindent", "quote", "randInt", "replace", "round", "sha1sum", "sha256sum", "squote", "sub", "title", "toJson", "toPrettyJson", "trim", "trimPrefix", "trimSuffix", "typeIs", "typeOf", "upper"}
+	wantKept := []string{"capitalize", "env", "escape", "file", "fromYaml", "map", "md5sum", "mustBeBool", "mustBeList", "mustBeMap", "mustBeNumber", "mustBeString", "nav", "randAlphaNum", "safe", "shellQuote", "strip", "t", "toYaml", "uuidv4", "withLoop"}
+	if !reflect.DeepEqual(report.Overridden, wantOverridden) || !reflect.DeepEqual(report.Kept, wantKept) {
+		t.Fatalf("unexpected collision report: %+v", report)
+	}
+}
+
+func TestRunWithoutSprigLeavesHelpersAlone(t *testing.T) {
+	templatePath := filepath.Join(t.TempDir(), "values.tmpl")
+	writeFile(t, templatePath, `{{ "x" | repeat 3 }}`)
+
+	resp := run(templatePath, "", renderOptions{})
+	if resp.Error == "" || resp.FuncLibrary != nil {
+		t.Fatalf("expected repeat to be undefined without sprig, got %+v", resp)
+	}
+
+	resp = run(templatePath, "", renderOptions{Funcs: "gomplate"})
+	if resp.Error != `unknown function library "gomplate" (expected builtin or sprig)` {
+		t.Fatalf("expected unknown library error, got %+v", resp)
+	}
+}
+
+func TestSprigIsHermetic(t *testing.T) {
+	t.Setenv("GO_TEMPLATE_STUDIO_HERMETIC", "leaked")
+	funcs := textFuncMap()
+	applyFuncLibrary(funcs, funcLibrarySprig)
+	if _, ok := funcs["expandenv"]; ok {
+		t.Fatal("expected expandenv to be unavailable")
+	}
+	// env is the worker's sandboxed helper, not Sprig's.
+	if env, ok := funcs["env"].(func(string) string); !ok || env("GO_TEMPLATE_STUDIO_HERMETIC") != "" {
+		t.Fatal("expected env to stay sandboxed")
+	}
+}
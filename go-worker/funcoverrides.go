@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// builtinFuncNames lists the functions text/template and html/template
+// predefine. They cannot be removed from a template, only shadowed.
+var builtinFuncNames = map[string]bool{
+	"and":      true,
+	"call":     true,
+	"html":     true,
+	"index":    true,
+	"slice":    true,
+	"js":       true,
+	"len":      true,
+	"not":      true,
+	"or":       true,
+	"print":    true,
+	"printf":   true,
+	"println":  true,
+	"urlquery": true,
+	"eq":       true,
+	"ge":       true,
+	"gt":       true,
+	"le":       true,
+	"lt":       true,
+	"ne":       true,
+}
+
+// applyFuncOverrides removes disabled helpers and renames helpers in place.
+// Disabled helpers disappear from the map so templates calling them fail to
+// parse; disabled builtins are shadowed with a function that fails at
+// execution time because the parser always knows about them. Names that
+// are neither, like renames of unknown helpers, are errors, so a typo does
+// not leave the helper enabled.
+func applyFuncOverrides[M ~map[string]interface{}](funcs M, opts renderOptions) error {
+	for _, name := range opts.DisableFuncs {
+		if _, ok := funcs[name]; ok {
+			delete(funcs, name)
+			continue
+		}
+		if !builtinFuncNames[name] {
+			return fmt.Errorf("cannot disable unknown helper %q", name)
+		}
+		funcs[name] = disabledFunc(name)
+	}
+
+	oldNames := make([]string, 0, len(opts.RenamedFuncs))
+	for oldName := range opts.RenamedFuncs {
+		oldNames = append(oldNames, oldName)
+	}
+	sort.Strings(oldNames)
+
+	renamed := make(map[string]interface{}, len(oldNames))
+	for _, oldName := range oldNames {
+		newName := opts.RenamedFuncs[oldName]
+		fn, ok := funcs[oldName]
+		if !ok {
+			return fmt.Errorf("cannot rename unknown helper %q", oldName)
+		}
+		if builtinFuncNames[oldName] {
+			return fmt.Errorf("cannot rename builtin function %q", oldName)
+		}
+		renamed[newName] = fn
+		delete(funcs, oldName)
+	}
+
+	for newName, fn := range renamed {
+		if builtinFuncNames[newName] {
+			return fmt.Errorf("cannot rename helper to builtin function %q", newName)
+		}
+		if _, exists := funcs[newName]; exists {
+			return fmt.Errorf("cannot rename helper to %q: name already registered", newName)
+		}
+		funcs[newName] = fn
+	}
+
+	return nil
+}
+
+func disabledFunc(name string) func(...interface{}) (interface{}, error) {
+	return func(...interface{}) (interface{}, error) {
+		return nil, fmt.Errorf("function %q is disabled", name)
+	}
+}
+
+// parseFuncRenames parses "old=new,other=renamed" into a rename map.
+func parseFuncRenames(value string) (map[string]string, error) {
+	entries := splitList(value)
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	renames := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		oldName, newName, ok := strings.Cut(entry, "=")
+		oldName = strings.TrimSpace(oldName)
+		newName = strings.TrimSpace(newName)
+		if !ok || oldName == "" || newName == "" {
+			return nil, fmt.Errorf("invalid rename %q: expected old=new", entry)
+		}
+		renames[oldName] = newName
+	}
+
+	return renames, nil
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries.
+func splitList(value string) []string {
+	var result []string
+	for _, part := range strings.Split(value, ",") {
+		if trimmed := strings.TrimSpace(part); trimmed != "" {
+			result = append(result, trimmed)
+		}
+	}
+	return result
+}
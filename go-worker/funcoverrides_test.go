@@ -0,0 +1,82 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestApplyFuncOverridesDisablesHelpers(t *testing.T) {
+	funcs := textFuncMap()
+	if err := applyFuncOverrides(funcs, renderOptions{DisableFuncs: []string{"safe"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, ok := funcs["safe"]; ok {
+		t.Fatal("expected safe helper to be removed")
+	}
+	if err := applyFuncOverrides(textFuncMap(), renderOptions{DisableFuncs: []string{"safe", "exec"}}); err == nil || err.Error() != `cannot disable unknown helper "exec"` {
+		t.Fatalf("expected unknown disabled names to be rejected, got %v", err)
+	}
+
+	_, err := renderTemplateWithOptions("page.tmpl", `{{ "x" | safe }}`, nil, renderOptions{DisableFuncs: []string{"safe"}})
+	if err == nil || !strings.Contains(err.Error(), `function "safe" not defined`) {
+		t.Fatalf("expected parse error for disabled helper, got %v", err)
+	}
+}
+
+func TestApplyFuncOverridesDisablesBuiltins(t *testing.T) {
+	_, err := renderTemplateWithOptions("page.tmpl", `{{ printf "%d" 1 }}`, nil, renderOptions{DisableFuncs: []string{"printf"}})
+	if err == nil || !strings.Contains(err.Error(), `function "printf" is disabled`) {
+		t.Fatalf("expected disabled builtin error, got %v", err)
+	}
+}
+
+func TestApplyFuncOverridesRenamesHelpers(t *testing.T) {
+	opts := renderOptions{RenamedFuncs: map[string]string{"map": "newmap"}}
+	rendered, err := renderTemplateWithOptions("page.html", `{{ index (newmap "a" "b") "a" }}`, nil, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rendered != "b" {
+		t.Fatalf("expected renamed helper output, got %q", rendered)
+	}
+
+	if _, err := renderTemplateWithOptions("page.tmpl", `{{ map "a" "b" }}`, nil, opts); err == nil {
+		t.Fatal("expected original helper name to be unavailable after rename")
+	}
+}
+
+func TestApplyFuncOverridesRejectsInvalidRenames(t *testing.T) {
+	cases := map[string]map[string]string{
+		"unknown":   {"missing": "other"},
+		"collision": {"map": "dict"},
+		"builtin":   {"printf": "format"},
+		"shadowing": {"map": "printf"},
+	}
+
+	for name, renames := range cases {
+		t.Run(name, func(t *testing.T) {
+			if err := applyFuncOverrides(textFuncMap(), renderOptions{RenamedFuncs: renames}); err == nil {
+				t.Fatalf("expected error for %v", renames)
+			}
+		})
+	}
+}
+
+func TestParseFuncRenames(t *testing.T) {
+	renames, err := parseFuncRenames("map=newmap, dict = newdict")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if renames["map"] != "newmap" || renames["dict"] != "newdict" {
+		t.Fatalf("unexpected renames: %v", renames)
+	}
+
+	if _, err := parseFuncRenames("map"); err == nil {
+		t.Fatal("expected error for malformed rename")
+	}
+
+	if renames, err := parseFuncRenames(""); err != nil || renames != nil {
+		t.Fatalf("expected empty renames, got %v, %v", renames, err)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// funcProfile describes the FuncMap a project registers in production so the
+// preview can mirror it instead of relying on the worker's own helper set.
+type funcProfile struct {
+	Source string
+	Names  map[string]bool
+	Fakes  map[string]interface{}
+}
+
+// loadFuncProfile extracts the keys of every template.FuncMap composite
+// literal declared in a Go source file.
+func loadFuncProfile(sourcePath, fakesPath string) (*funcProfile, error) {
+	fileSet := token.NewFileSet()
+	file, err := parser.ParseFile(fileSet, sourcePath, nil, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, err
+	}
+
+	profile := &funcProfile{Source: sourcePath, Names: make(map[string]bool)}
+	ast.Inspect(file, func(node ast.Node) bool {
+		literal, ok := node.(*ast.CompositeLit)
+		if !ok || !isFuncMapType(literal.Type) {
+			return true
+		}
+
+		for _, element := range literal.Elts {
+			pair, ok := element.(*ast.KeyValueExpr)
+			if !ok {
+				continue
+			}
+			key, ok := pair.Key.(*ast.BasicLit)
+			if !ok || key.Kind != token.STRING {
+				continue
+			}
+			if name, err := strconv.Unquote(key.Value); err == nil {
+				profile.Names[name] = true
+			}
+		}
+		return true
+	})
+
+	if len(profile.Names) == 0 {
+		return nil, fmt.Errorf("no template.FuncMap literal found in %s", sourcePath)
+	}
+
+	if strings.TrimSpace(fakesPath) != "" {
+		fakesBytes, err := os.ReadFile(fakesPath)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(fakesBytes, &profile.Fakes); err != nil {
+			return nil, fmt.Errorf("failed to parse function fakes JSON: %w", err)
+		}
+	}
+
+	return profile, nil
+}
+
+func isFuncMapType(expr ast.Expr) bool {
+	selector, ok := expr.(*ast.SelectorExpr)
+	return ok && selector.Sel.Name == "FuncMap"
+}
+
+// applyFuncProfile registers stubs for production functions the worker does
+// not implement. Configured fakes always win so their canned values show up
+// in the preview.
+func applyFuncProfile[M ~map[string]interface{}](funcs M, profile *funcProfile) {
+	if profile == nil {
+		return
+	}
+
+	for name := range profile.Names {
+		if fake, ok := profile.Fakes[name]; ok {
+			funcs[name] = fakeFunc(fake)
+			continue
+		}
+		if _, exists := funcs[name]; !exists && !builtinFuncNames[name] {
+			funcs[name] = echoFunc
+		}
+	}
+}
+
+func fakeFunc(value interface{}) func(...interface{}) interface{} {
+	return func(...interface{}) interface{} {
+		return value
+	}
+}
+
+// echoFunc stands in for unknown production functions by passing its
+// arguments through, which keeps pipelines flowing with plausible values.
+func echoFunc(args ...interface{}) interface{} {
+	switch len(args) {
+	case 0:
+		return ""
+	case 1:
+		return args[0]
+	}
+
+	parts := make([]string, len(args))
+	for i, arg := range args {
+		parts[i] = toString(arg)
+	}
+	return strings.Join(parts, " ")
+}
+
+// funcProfileDiagnostics warns about functions the template calls that the
+// production FuncMap does not register.
+func funcProfileDiagnostics(templatePath, content string, profile *funcProfile, opts renderOptions) []diagnostic {
+	if profile == nil {
+		return nil
+	}
+
+	trees, err := parseTreesWithDelims(templatePath, content, opts.LeftDelim, opts.RightDelim)
+	if err != nil {
+		return nil
+	}
+
+	calls := calledFunctions(trees)
+	names := make([]string, 0, len(calls))
+	for name := range calls {
+		if !profile.Names[name] && !builtinFuncNames[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var diagnostics []diagnostic
+	for _, name := range names {
+		for _, pos := range calls[name] {
+			line, column := lineColumn(content, pos)
+			diagnostics = append(diagnostics, diagnostic{
+				Message:  fmt.Sprintf("function %q is not registered in the production FuncMap (%s)", name, profile.Source),
+				Severity: "warning",
+				Rule:     "unregistered-function",
+				File:     templatePath,
+				Line:     line,
+				Column:   column,
+			})
+		}
+	}
+	return diagnostics
+}
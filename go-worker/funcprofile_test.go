@@ -0,0 +1,122 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const productionFuncsSource = `package web
+
+import "html/template"
+
+var funcs = template.FuncMap{
+	"formatPrice": formatPrice,
+	"upper":       strings.ToUpper,
+	"currentUser": currentUser,
+}
+`
+
+func writeFuncProfileFixtures(t *testing.T) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+
+	sourcePath := filepath.Join(dir, "funcs.go")
+	if err := os.WriteFile(sourcePath, []byte(productionFuncsSource), 0o600); err != nil {
+		t.Fatalf("failed to write Go source: %v", err)
+	}
+
+	fakesPath := filepath.Join(dir, "fakes.json")
+	if err := os.WriteFile(fakesPath, []byte(`{"currentUser":"Gopher"}`), 0o600); err != nil {
+		t.Fatalf("failed to write fakes file: %v", err)
+	}
+
+	return sourcePath, fakesPath
+}
+
+func TestLoadFuncProfileExtractsFuncMapKeys(t *testing.T) {
+	sourcePath, fakesPath := writeFuncProfileFixtures(t)
+
+	profile, err := loadFuncProfile(sourcePath, fakesPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, name := range []string{"formatPrice", "upper", "currentUser"} {
+		if !profile.Names[name] {
+			t.Fatalf("expected %s in profile, got %v", name, profile.Names)
+		}
+	}
+
+	if profile.Fakes["currentUser"] != "Gopher" {
+		t.Fatalf("expected fake value to load, got %v", profile.Fakes)
+	}
+}
+
+func TestLoadFuncProfileRequiresFuncMap(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "empty.go")
+	if err := os.WriteFile(path, []byte("package web\n"), 0o600); err != nil {
+		t.Fatalf("failed to write Go source: %v", err)
+	}
+
+	if _, err := loadFuncProfile(path, ""); err == nil {
+		t.Fatal("expected error when no FuncMap literal is present")
+	}
+}
+
+func TestExecuteWithFuncsFromMirrorsProductionAndWarns(t *testing.T) {
+	sourcePath, fakesPath := writeFuncProfileFixtures(t)
+	dir := t.TempDir()
+
+	templatePath := filepath.Join(dir, "page.tmpl")
+	if err := os.WriteFile(templatePath, []byte("{{ formatPrice .price }} {{ currentUser }} {{ upper \"x\" }}"), 0o600); err != nil {
+		t.Fatalf("failed to write template file: %v", err)
+	}
+
+	contextPath := filepath.Join(dir, "context.json")
+	if err := os.WriteFile(contextPath, []byte(`{"price":12}`), 0o600); err != nil {
+		t.Fatalf("failed to write context file: %v", err)
+	}
+
+	opts := renderOptions{FuncsFrom: sourcePath, FuncFakes: fakesPath}
+	resp := executeWithOptions(templatePath, contextPath, opts)
+	if resp.Error != "" || len(resp.Diagnostics) != 0 {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	if resp.Rendered != "12 Gopher X" {
+		t.Fatalf("unexpected rendered output: %q", resp.Rendered)
+	}
+
+	// lower is a worker helper the production FuncMap does not register, so
+	// the template fails as it would in production.
+	content := "{{ upper \"x\" }} {{ lower \"Y\" }}"
+	if err := os.WriteFile(templatePath, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write template file: %v", err)
+	}
+	resp = executeWithOptions(templatePath, contextPath, opts)
+	if !strings.Contains(resp.Error, `function "lower" not defined`) {
+		t.Fatalf("expected lower to be unregistered, got %+v", resp)
+	}
+
+	// The warning locates the call; the parse error follows it.
+	if len(resp.Diagnostics) != 2 || resp.Diagnostics[1].Severity != "error" {
+		t.Fatalf("expected a warning and the parse error, got %+v", resp.Diagnostics)
+	}
+	warning := resp.Diagnostics[0]
+	if warning.Severity != "warning" || !strings.Contains(warning.Message, `"lower"`) || warning.Line != 1 || warning.Column == 0 {
+		t.Fatalf("unexpected warning: %+v", warning)
+	}
+}
+
+func TestEchoFunc(t *testing.T) {
+	if echoFunc() != "" {
+		t.Fatal("expected empty string for no arguments")
+	}
+	if echoFunc(3) != 3 {
+		t.Fatal("expected single argument to pass through")
+	}
+	if echoFunc("a", 1) != "a 1" {
+		t.Fatalf("expected joined arguments, got %v", echoFunc("a", 1))
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	dtsFormatTS         = "ts"
+	dtsFormatJSONSchema = "json-schema"
+
+	jsonSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+)
+
+// tsIdentifier matches property names TypeScript accepts unquoted.
+var tsIdentifier = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+
+// executeGenDTS describes the context a template reads as a TypeScript
+// declaration or a JSON Schema, returned as the rendered output and, with
+// --output-dir, written next to the other generated files. The shape is the
+// one gen-go declares Params from.
+func executeGenDTS(templatePath, contextPath string, opts renderOptions) response {
+	if templatePath == "" {
+		return response{Error: "template path is required"}
+	}
+	format := opts.DTSFormat
+	if format == "" {
+		format = dtsFormatTS
+	}
+	if format != dtsFormatTS && format != dtsFormatJSONSchema {
+		return response{Error: fmt.Sprintf("unknown --dts-format %q: want ts or json-schema", opts.DTSFormat)}
+	}
+	content, err := readTemplate(templatePath, opts)
+	if err != nil {
+		return response{Error: err.Error()}
+	}
+
+	name := templateName(templatePath)
+	trees, _, warnings, failure := parseTemplateSet(templatePath, name, content, opts)
+	if failure != nil {
+		return *failure
+	}
+	var data interface{}
+	if contextPath != "" {
+		if data, err = loadContextWithOptions(contextPath, opts); err != nil {
+			return contextFailure(contextPath, err)
+		}
+	}
+	schema, err := generatedSchema(templatePath, name, content, trees, data, opts)
+	if err != nil {
+		return response{Error: err.Error()}
+	}
+
+	base, ok := trimTemplateSuffix(name)
+	if !ok {
+		base = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	typeName := opts.TypeName
+	if typeName == "" {
+		typeName = goExportedName(base) + "Context"
+	}
+	if !tsIdentifier.MatchString(typeName) {
+		return response{Error: fmt.Sprintf("%q is not a valid type name", typeName)}
+	}
+
+	var output, fileName string
+	if format == dtsFormatJSONSchema {
+		document := jsonSchemaOf(schema)
+		document["$schema"] = jsonSchemaDialect
+		document["title"] = typeName
+		encoded, err := encodeJSON("json-schema", document, "  ")
+		if err != nil {
+			return response{Error: err.Error()}
+		}
+		output, fileName = encoded+"\n", base+".schema.json"
+	} else {
+		output, fileName = tsDeclaration(name, typeName, schema), base+".d.ts"
+	}
+
+	resp := response{Rendered: output, Diagnostics: warnings}
+	if outputDir := strings.TrimSpace(opts.OutputDir); outputDir != "" {
+		resp.Files = []renderedFile{{Source: name, Output: fileName, Action: "generate", Bytes: len(output)}}
+		if !opts.DryRun {
+			if err := os.MkdirAll(outputDir, 0o755); err != nil {
+				return response{Error: err.Error()}
+			}
+			if err := os.WriteFile(filepath.Join(outputDir, fileName), []byte(output), 0o644); err != nil {
+				return response{Error: err.Error()}
+			}
+		}
+	}
+	return resp
+}
+
+// tsDeclaration declares typeName as an interface, with nested objects
+// written inline. Every property the template reads is required.
+func tsDeclaration(templateName, typeName string, schema *schemaNode) string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "// Code generated by go-worker --mode=gen-dts from %s; DO NOT EDIT.\n\n", templateName)
+	if schema != nil && schema.Type == "object" && len(schema.Properties) > 0 {
+		fmt.Fprintf(&out, "export interface %s %s\n", typeName, tsType(schema, ""))
+	} else {
+		fmt.Fprintf(&out, "export type %s = %s;\n", typeName, tsType(schema, ""))
+	}
+	return out.String()
+}
+
+func tsType(node *schemaNode, indent string) string {
+	if node == nil {
+		return "unknown"
+	}
+	switch node.Type {
+	case "object":
+		if len(node.Properties) == 0 {
+			return "Record<string, unknown>"
+		}
+		keys := make([]string, 0, len(node.Properties))
+		for key := range node.Properties {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		var body strings.Builder
+		body.WriteString("{\n")
+		for _, key := range keys {
+			property := key
+			if !tsIdentifier.MatchString(key) {
+				// A JSON string is a valid TypeScript string literal.
+				property, _ = encodeJSON("property", key, "")
+			}
+			fmt.Fprintf(&body, "%s  %s: %s;\n", indent, property, tsType(node.Properties[key], indent+"  "))
+		}
+		body.WriteString(indent + "}")
+		return body.String()
+	case "array":
+		item := tsType(node.Items, indent)
+		if strings.HasPrefix(item, "{") || strings.Contains(item, "<") {
+			return "Array<" + item + ">"
+		}
+		return item + "[]"
+	case "string", "number", "boolean":
+		return node.Type
+	}
+	return "unknown"
+}
+
+// jsonSchemaOf converts a schema node to a JSON Schema document. Untyped
+// nodes accept anything.
+func jsonSchemaOf(node *schemaNode) map[string]interface{} {
+	document := map[string]interface{}{}
+	if node == nil || node.Type == "" {
+		return document
+	}
+	document["type"] = node.Type
+	switch node.Type {
+	case "object":
+		properties := make(map[string]interface{}, len(node.Properties))
+		required := make([]string, 0, len(node.Properties))
+		for key, child := range node.Properties {
+			properties[key] = jsonSchemaOf(child)
+			required = append(required, key)
+		}
+		sort.Strings(required)
+		if len(properties) > 0 {
+			document["properties"] = properties
+			document["required"] = required
+		}
+	case "array":
+		document["items"] = jsonSchemaOf(node.Items)
+	}
+	return document
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGenDTSDeclaresTheContextTemplateReads(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "mail.tmpl")
+	writeFile(t, templatePath, `{{ .user.first_name }} {{ index . "reply-to" }} {{ .count }}{{ range .items }}{{ .title }}{{ if .done }}!{{ end }}{{ end }}{{ range .tags }}{{ . }}{{ end }}`)
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, contextPath, `{"count": 3, "items": [{"title": "a", "done": true}], "tags": ["x"]}`)
+
+	resp := run(templatePath, contextPath, renderOptions{Mode: "gen-dts"})
+	want := `// Code generated by go-worker --mode=gen-dts from mail.tmpl; DO NOT EDIT.
+
+export interface MailContext {
+  count: number;
+  items: Array<{
+    done: boolean;
+    title: string;
+  }>;
+  "reply-to": string;
+  tags: string[];
+  user: {
+    first_name: string;
+  };
+}
+`
+	if resp.Error != "" || resp.Rendered != want {
+		t.Fatalf("unexpected declaration:\n%s\n%+v", resp.Rendered, resp)
+	}
+
+	outputDir := filepath.Join(dir, "types")
+	resp = run(templatePath, "", renderOptions{Mode: "gen-dts", DTSFormat: "json-schema", TypeName: "Mail", OutputDir: outputDir})
+	written, err := os.ReadFile(filepath.Join(outputDir, "mail.schema.json"))
+	if resp.Error != "" || err != nil || string(written) != resp.Rendered {
+		t.Fatalf("unexpected response: %+v (%v)", resp, err)
+	}
+	var document map[string]interface{}
+	if err := json.Unmarshal(written, &document); err != nil {
+		t.Fatal(err)
+	}
+	if document["title"] != "Mail" || document["$schema"] != jsonSchemaDialect {
+		t.Fatalf("unexpected schema header: %s", written)
+	}
+	required := document["required"].([]interface{})
+	if !reflect.DeepEqual(required, []interface{}{"count", "items", "reply-to", "tags", "user"}) {
+		t.Fatalf("unexpected required properties: %v", required)
+	}
+}
+
+func TestGenDTSQuotesKeysAndRejectsBadNames(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "page.html")
+	writeFile(t, templatePath, `{{ index . "reply-to" }}`)
+
+	resp := run(templatePath, "", renderOptions{Mode: "gen-dts"})
+	want := "// Code generated by go-worker --mode=gen-dts from page.html; DO NOT EDIT.\n\nexport interface PageContext {\n  \"reply-to\": string;\n}\n"
+	if resp.Error != "" || resp.Rendered != want {
+		t.Fatalf("unexpected declaration:\n%s", resp.Rendered)
+	}
+
+	if resp := run(templatePath, "", renderOptions{Mode: "gen-dts", TypeName: "my type"}); resp.Error == "" {
+		t.Fatal("expected an invalid type name to be rejected")
+	}
+	if resp := run(templatePath, "", renderOptions{Mode: "gen-dts", DTSFormat: "flow"}); resp.Error == "" {
+		t.Fatal("expected an unknown format to be rejected")
+	}
+}
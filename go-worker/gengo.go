@@ -0,0 +1,465 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template/parse"
+	"unicode"
+)
+
+// executeGenGo writes a Go package to opts.OutputDir that embeds the
+// template and its includes, declares a Params type for the context, and
+// renders it the way the preview does. Params comes from --types when set
+// and is otherwise inferred by analysis, refined by the sample context's
+// values when one is given. With a context, the package also gets a test
+// comparing its output with the preview's.
+func executeGenGo(templatePath, contextPath string, opts renderOptions) response {
+	if templatePath == "" {
+		return response{Error: "template path is required"}
+	}
+	outputDir := strings.TrimSpace(opts.OutputDir)
+	if outputDir == "" && !opts.DryRun {
+		return response{Error: "gen-go requires --output-dir unless --dry-run is set"}
+	}
+	content, err := readTemplate(templatePath, opts)
+	if err != nil {
+		return response{Error: err.Error()}
+	}
+
+	name := templateName(templatePath)
+	trees, includes, warnings, failure := parseTemplateSet(templatePath, name, content, opts)
+	if failure != nil {
+		return *failure
+	}
+
+	var data interface{}
+	if contextPath != "" {
+		if data, err = loadContextWithOptions(contextPath, opts); err != nil {
+			return contextFailure(contextPath, err)
+		}
+		if opts.Anonymize {
+			// The preview renders the golden from the anonymized context,
+			// and testdata/context.json must not carry the real values.
+			data = anonymizeContext(data)
+		}
+	}
+	schema, err := generatedSchema(templatePath, name, content, trees, data, opts)
+	if err != nil {
+		return response{Error: err.Error()}
+	}
+
+	pkg := opts.GoPackage
+	if pkg == "" {
+		pkg = goPackageName(filepath.Base(filepath.Clean(outputDir)))
+	}
+	if !isGoIdentifier(pkg) {
+		return response{Error: fmt.Sprintf("%q is not a valid Go package name", pkg)}
+	}
+
+	var funcNames []string
+	for funcName := range calledFunctions(trees) {
+		if !builtinFuncNames[funcName] {
+			funcNames = append(funcNames, funcName)
+		}
+	}
+	sort.Strings(funcNames)
+
+	files := map[string][]byte{filepath.ToSlash(filepath.Join("templates", name)): []byte(content)}
+	for _, include := range includes {
+		files[filepath.ToSlash(filepath.Join("templates", include.Name))] = []byte(include.Content)
+	}
+	source, err := genGoSource(pkg, name, schema, funcNames, templatePath, opts)
+	if err != nil {
+		return response{Error: err.Error()}
+	}
+	files["render.go"] = source
+
+	// The test renders with the package-level Render, which only exists
+	// when the template needs no functions from the service.
+	if contextPath != "" && len(funcNames) == 0 {
+		preview := executeWithOptions(templatePath, contextPath, opts)
+		if preview.Error != "" {
+			return response{Diagnostics: preview.Diagnostics, Error: preview.Error}
+		}
+		contextBytes, err := json.MarshalIndent(data, "", "  ")
+		if err != nil {
+			return response{Error: err.Error()}
+		}
+		files["testdata/context.json"] = append(contextBytes, '\n')
+		files["testdata/"+name+goldenSuffix] = []byte(preview.Rendered)
+		test, err := format.Source([]byte(fmt.Sprintf(genGoTestSource, pkg, name+goldenSuffix, name)))
+		if err != nil {
+			return response{Error: err.Error()}
+		}
+		files["render_test.go"] = test
+	}
+
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	resp := response{Diagnostics: warnings}
+	for _, path := range paths {
+		resp.Files = append(resp.Files, renderedFile{Source: name, Output: path, Action: "generate", Bytes: len(files[path])})
+		if opts.DryRun {
+			continue
+		}
+		target := filepath.Join(outputDir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return response{Error: err.Error()}
+		}
+		if err := os.WriteFile(target, files[path], 0o644); err != nil {
+			return response{Error: err.Error()}
+		}
+	}
+	return resp
+}
+
+// parseTemplateSet parses the template and its includes into one set of
+// trees. A parse failure comes back as the response to return.
+func parseTemplateSet(templatePath, name, content string, opts renderOptions) (map[string]*parse.Tree, []templateSource, []diagnostic, *response) {
+	includes, warnings := resolveIncludePatterns(templatePath, opts)
+	includes = orderIncludes(includes, opts.IncludePriority)
+	trees, err := parseTreesWithDelims(name, content, opts.LeftDelim, opts.RightDelim)
+	if err != nil {
+		return nil, nil, nil, &response{Diagnostics: append(warnings, templateDiagnosticWithDelims(err, templatePath, content, opts.LeftDelim, opts.RightDelim)), Error: err.Error()}
+	}
+	for _, include := range includes {
+		included, err := parseTreesWithDelims(include.Name, include.Content, opts.LeftDelim, opts.RightDelim)
+		if err != nil {
+			return nil, nil, nil, &response{Diagnostics: append(warnings, templateDiagnosticWithDelims(err, include.Path, include.Content, opts.LeftDelim, opts.RightDelim)), Error: err.Error()}
+		}
+		for treeName, tree := range included {
+			trees[treeName] = tree
+		}
+	}
+	return trees, includes, warnings, nil
+}
+
+// generatedSchema reads the context shape from --types, which holds a
+// schema like the one analyze mode reports, or infers it from the
+// templates, refined by the sample context when there is one.
+func generatedSchema(templatePath, name, content string, trees map[string]*parse.Tree, data interface{}, opts renderOptions) (*schemaNode, error) {
+	if strings.TrimSpace(opts.Types) != "" {
+		typesBytes, err := os.ReadFile(opts.Types)
+		if err != nil {
+			return nil, err
+		}
+		var schema schemaNode
+		if err := json.Unmarshal(typesBytes, &schema); err != nil {
+			return nil, fmt.Errorf("types %s are not a valid schema: %v", opts.Types, err)
+		}
+		return &schema, nil
+	}
+	schema := analyzeTrees(templatePath, name, content, trees).Schema
+	if data != nil {
+		refineSchema(schema, data)
+	}
+	return schema, nil
+}
+
+// refineSchema replaces the types analysis guessed, such as string for any
+// printed value, with the types the sample context actually holds.
+func refineSchema(node *schemaNode, value interface{}) {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		if node.Type == "object" {
+			for key, child := range node.Properties {
+				if childValue, ok := typed[key]; ok {
+					refineSchema(child, childValue)
+				}
+			}
+		}
+	case []interface{}:
+		if node.Type == "array" && node.Items != nil {
+			for _, item := range typed {
+				refineSchema(node.Items, item)
+			}
+		}
+	case string:
+		refineScalar(node, "string")
+	case float64, json.Number:
+		refineScalar(node, "number")
+	case bool:
+		refineScalar(node, "boolean")
+	}
+}
+
+func refineScalar(node *schemaNode, kind string) {
+	if node.Type == "object" || node.Type == "array" {
+		return
+	}
+	node.Type = kind
+}
+
+// goTypes declares the named struct types of Params.
+type goTypes struct {
+	decls []string
+	names map[string]bool
+}
+
+func (g *goTypes) typeOf(node *schemaNode, name string) string {
+	if node == nil {
+		return "interface{}"
+	}
+	switch node.Type {
+	case "object":
+		if len(node.Properties) == 0 {
+			return "map[string]interface{}"
+		}
+		return g.structType(node, name)
+	case "array":
+		return "[]" + g.typeOf(node.Items, name+"Item")
+	case "string":
+		return "string"
+	case "number":
+		return "float64"
+	case "boolean":
+		return "bool"
+	}
+	return "interface{}"
+}
+
+func (g *goTypes) structType(node *schemaNode, name string) string {
+	name = g.unique(name)
+	// Reserve the slot so a struct is declared before the ones it nests.
+	slot := len(g.decls)
+	g.decls = append(g.decls, "")
+	keys := make([]string, 0, len(node.Properties))
+	for key := range node.Properties {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var body strings.Builder
+	fields := map[string]bool{}
+	for _, key := range keys {
+		field := goExportedName(key)
+		for i := 2; fields[field]; i++ {
+			field = goExportedName(key) + strconv.Itoa(i)
+		}
+		fields[field] = true
+		fmt.Fprintf(&body, "\t%s %s `json:%q`\n", field, g.typeOf(node.Properties[key], name+field), key)
+	}
+	g.decls[slot] = fmt.Sprintf("type %s struct {\n%s}\n", name, body.String())
+	return name
+}
+
+func (g *goTypes) unique(name string) string {
+	candidate := name
+	for i := 2; g.names[candidate]; i++ {
+		candidate = name + strconv.Itoa(i)
+	}
+	g.names[candidate] = true
+	return candidate
+}
+
+func genGoSource(pkg, name string, schema *schemaNode, funcNames []string, templatePath string, opts renderOptions) ([]byte, error) {
+	types := &goTypes{names: map[string]bool{"Params": true}}
+	var params string
+	if schema != nil && schema.Type == "object" && len(schema.Properties) > 0 {
+		types.names["Params"] = false
+		types.structType(schema, "Params")
+		params = strings.Join(types.decls, "\n")
+	} else {
+		params = fmt.Sprintf("type Params = %s\n", types.typeOf(schema, "ParamsValue"))
+		if len(types.decls) > 0 {
+			params += "\n" + strings.Join(types.decls, "\n")
+		}
+	}
+
+	templatePackage := "text/template"
+	if usesHTMLEngine(templatePath, opts) {
+		templatePackage = "html/template"
+	}
+	parse := fmt.Sprintf("template.New(%q)", name)
+	if opts.LeftDelim != "" || opts.RightDelim != "" {
+		parse += fmt.Sprintf(".Delims(%q, %q)", opts.LeftDelim, opts.RightDelim)
+	}
+	for _, option := range missingKeyOptions(opts.MissingKey) {
+		parse += fmt.Sprintf(".Option(%q)", option)
+	}
+
+	quoted := make([]string, len(funcNames))
+	for i, funcName := range funcNames {
+		quoted[i] = strconv.Quote(funcName)
+	}
+
+	var source strings.Builder
+	fmt.Fprintf(&source, genGoHeader, name, pkg, name, pkg, templatePackage, strings.Join(quoted, ", "), name, params, parse, name, name)
+	if len(funcNames) == 0 {
+		source.WriteString(genGoDefaultRenderer)
+	}
+	source.WriteString(genGoContext)
+	return format.Source([]byte(source.String()))
+}
+
+const genGoHeader = `// Code generated by go-worker --mode=gen-go from %s; DO NOT EDIT.
+
+// Package %s renders %s exactly as the Go Template Studio preview does.
+package %s
+
+import (
+	"embed"
+	"encoding/json"
+	"io"
+	%q
+)
+
+//go:embed templates
+var files embed.FS
+
+// FuncNames lists the functions the templates call beyond Go's builtins.
+// The funcs passed to New must define each of them.
+var FuncNames = []string{%s}
+
+// Params is the context %s expects.
+%s
+// Renderer executes the parsed templates.
+type Renderer struct {
+	tmpl *template.Template
+}
+
+// New parses the embedded templates with funcs.
+func New(funcs template.FuncMap) (*Renderer, error) {
+	tmpl, err := %s.Funcs(funcs).ParseFS(files, "templates/*")
+	if err != nil {
+		return nil, err
+	}
+	return &Renderer{tmpl: tmpl}, nil
+}
+
+// Render executes %s with params. Params goes through JSON first, so
+// the template sees the same maps, lists, and float64 numbers as in the
+// preview.
+func (r *Renderer) Render(w io.Writer, params Params) error {
+	data, err := contextOf(params)
+	if err != nil {
+		return err
+	}
+	return r.tmpl.ExecuteTemplate(w, %q, data)
+}
+`
+
+const genGoDefaultRenderer = `
+var defaultRenderer = mustNew()
+
+func mustNew() *Renderer {
+	renderer, err := New(nil)
+	if err != nil {
+		panic(err)
+	}
+	return renderer
+}
+
+// Render executes the template with params using the default Renderer.
+func Render(w io.Writer, params Params) error {
+	return defaultRenderer.Render(w, params)
+}
+`
+
+const genGoContext = `
+func contextOf(params Params) (interface{}, error) {
+	encoded, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	var data interface{}
+	err = json.Unmarshal(encoded, &data)
+	return data, err
+}
+`
+
+const genGoTestSource = `// Code generated by go-worker --mode=gen-go; DO NOT EDIT.
+
+package %s
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+// TestRenderMatchesPreview renders the sample context and compares the
+// output with what the preview rendered when the package was generated.
+func TestRenderMatchesPreview(t *testing.T) {
+	content, err := os.ReadFile("testdata/context.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var params Params
+	if err := json.Unmarshal(content, &params); err != nil {
+		t.Fatalf("sample context does not fit Params: %%v", err)
+	}
+	want, err := os.ReadFile("testdata/%s")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got bytes.Buffer
+	if err := Render(&got, params); err != nil {
+		t.Fatalf("render %s: %%v", err)
+	}
+	if got.String() != string(want) {
+		t.Fatalf("output differs from the preview:\ngot:\n%%s\nwant:\n%%s", got.String(), want)
+	}
+}
+`
+
+// goExportedName turns a context key such as first_name into FirstName.
+func goExportedName(key string) string {
+	var name strings.Builder
+	upper := true
+	for _, r := range key {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		name.WriteRune(r)
+	}
+	result := name.String()
+	if result == "" || !unicode.IsLetter([]rune(result)[0]) {
+		result = "X" + result
+	}
+	return result
+}
+
+// goPackageName derives a package name from a directory name.
+func goPackageName(dir string) string {
+	var name strings.Builder
+	for _, r := range strings.ToLower(dir) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			name.WriteRune(r)
+		}
+	}
+	result := name.String()
+	if result == "" || !unicode.IsLetter([]rune(result)[0]) {
+		result = "templates"
+	}
+	return result
+}
+
+func isGoIdentifier(name string) bool {
+	if token.IsKeyword(name) {
+		return false
+	}
+	for i, r := range name {
+		if !unicode.IsLetter(r) && r != '_' && (i == 0 || !unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return name != ""
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenGoWritesPackageThatMatchesPreview(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "mail.tmpl")
+	writeFile(t, templatePath, "Hello {{ .user.first_name }} ({{ .count }})\n{{ range .items }}- {{ .title }}{{ if .done }} done{{ end }}\n{{ end }}")
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, contextPath, `{"user": {"first_name": "Ada"}, "count": 3, "items": [{"title": "a", "done": true}, {"title": "b", "done": false}]}`)
+	outputDir := filepath.Join(dir, "gen", "mailer")
+
+	resp := run(templatePath, contextPath, renderOptions{Mode: "gen-go", OutputDir: outputDir})
+	if resp.Error != "" || len(resp.Files) != 5 {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	source, err := os.ReadFile(filepath.Join(outputDir, "render.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"package mailer",
+		"Count float64           `json:\"count\"`",
+		"Items []ParamsItemsItem `json:\"items\"`",
+		"FirstName string `json:\"first_name\"`",
+		"Done  bool   `json:\"done\"`",
+		"func Render(w io.Writer, params Params) error",
+	} {
+		if !strings.Contains(string(source), want) {
+			t.Errorf("expected render.go to contain %q:\n%s", want, source)
+		}
+	}
+
+	goBinary, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go toolchain not available to build the generated package")
+	}
+	writeFile(t, filepath.Join(dir, "gen", "go.mod"), "module example.com/gen\n\ngo 1.21\n")
+	cmd := exec.Command(goBinary, "test", "./...")
+	cmd.Dir = filepath.Join(dir, "gen")
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod", "GOPROXY=off", "GOWORK=off")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("generated package failed its test: %v\n%s", err, output)
+	}
+}
+
+func TestGenGoWritesTheAnonymizedContext(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "mail.tmpl")
+	writeFile(t, templatePath, "To: {{ .email }}")
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, contextPath, `{"email": "jane@corp.example"}`)
+	outputDir := filepath.Join(dir, "mailer")
+
+	resp := run(templatePath, contextPath, renderOptions{Mode: "gen-go", OutputDir: outputDir, Anonymize: true})
+	if resp.Error != "" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	context, err := os.ReadFile(filepath.Join(outputDir, "testdata", "context.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden, err := os.ReadFile(filepath.Join(outputDir, "testdata", "mail.tmpl"+goldenSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(context), "jane@corp.example") || strings.Contains(string(golden), "jane@corp.example") {
+		t.Fatalf("expected the real email to stay out of testdata, got %s and %s", context, golden)
+	}
+	email := strings.TrimPrefix(string(golden), "To: ")
+	if !strings.Contains(string(context), `"email": "`+email+`"`) {
+		t.Fatalf("expected the golden to be rendered from the written context, got %s and %s", context, golden)
+	}
+}
+
+func TestGenGoUsesTypesAndListsServiceFuncs(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "page.html")
+	writeFile(t, templatePath, `<h1>{{ .title | upper }}</h1>`)
+	typesPath := filepath.Join(dir, "types.json")
+	writeFile(t, typesPath, `{"type": "object", "properties": {"title": {"type": "string"}, "tags": {"type": "array", "items": {"type": "string"}}}}`)
+
+	resp := run(templatePath, "", renderOptions{Mode: "gen-go", Types: typesPath, GoPackage: "pages", DryRun: true})
+	if resp.Error != "" {
+		t.Fatalf("unexpected error: %+v", resp)
+	}
+	var outputs []string
+	for _, file := range resp.Files {
+		outputs = append(outputs, file.Output)
+	}
+	if strings.Join(outputs, ",") != "render.go,templates/page.html" {
+		t.Fatalf("expected no test without a context, got %v", outputs)
+	}
+
+	resp = run(templatePath, "", renderOptions{Mode: "gen-go", Types: typesPath, OutputDir: filepath.Join(dir, "out")})
+	source, err := os.ReadFile(filepath.Join(dir, "out", "render.go"))
+	if resp.Error != "" || err != nil {
+		t.Fatalf("unexpected response: %+v (%v)", resp, err)
+	}
+	for _, want := range []string{`"html/template"`, "package out", `var FuncNames = []string{"upper"}`, "Tags  []string `json:\"tags\"`"} {
+		if !strings.Contains(string(source), want) {
+			t.Errorf("expected render.go to contain %q:\n%s", want, source)
+		}
+	}
+	if strings.Contains(string(source), "func Render(") {
+		t.Fatal("expected no default Render when the template needs service functions")
+	}
+
+	if resp := run(templatePath, "", renderOptions{Mode: "gen-go", OutputDir: filepath.Join(dir, "type")}); !strings.Contains(resp.Error, "not a valid Go package name") {
+		t.Fatalf("expected a keyword package name to be rejected, got %+v", resp)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const workingTreeLabel = "working tree"
+
+// readAtRef returns the contents of path as committed at ref in the git
+// repository containing it.
+func readAtRef(path, ref string) ([]byte, error) {
+	if strings.HasPrefix(ref, "-") {
+		return nil, fmt.Errorf("invalid git ref %q", ref)
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(abs)
+	if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = resolved
+	}
+
+	top, err := gitOutput(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+	rel, err := filepath.Rel(strings.TrimSpace(string(top)), filepath.Join(dir, filepath.Base(abs)))
+	if err != nil {
+		return nil, err
+	}
+
+	return gitOutput(dir, "show", ref+":"+filepath.ToSlash(rel))
+}
+
+func gitOutput(dir string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		var execErr *exec.Error
+		if errors.As(err, &execErr) {
+			return nil, errors.New("git is required for --at-ref but was not found on PATH")
+		}
+		message := strings.TrimSpace(stderr.String())
+		if message == "" {
+			message = err.Error()
+		}
+		return nil, fmt.Errorf("git %s: %s", args[0], message)
+	}
+	return out, nil
+}
+
+// executeCompareRefs renders the template at AtRef and at CompareRef (an
+// empty ref means the working tree) and reports a unified diff of the two
+// outputs.
+func executeCompareRefs(templatePath, contextPath string, opts renderOptions) response {
+	if opts.AtRef == "" && opts.CompareRef == "" {
+		return response{Error: "compare-refs mode requires --at-ref, --compare-ref, or both"}
+	}
+
+	baseOpts, headOpts := opts, opts
+	headOpts.AtRef = opts.CompareRef
+
+	base := executeWithOptions(templatePath, contextPath, baseOpts)
+	if base.Error != "" {
+		base.Error = fmt.Sprintf("rendering at %s: %s", refLabel(baseOpts.AtRef), base.Error)
+		return base
+	}
+	head := executeWithOptions(templatePath, contextPath, headOpts)
+	if head.Error != "" {
+		head.Error = fmt.Sprintf("rendering at %s: %s", refLabel(headOpts.AtRef), head.Error)
+		return head
+	}
+
+	name := templateName(templatePath)
+	return response{
+		Rendered:    head.Rendered,
+		Diagnostics: append(base.Diagnostics, head.Diagnostics...),
+		Diff: unifiedDiff(
+			name+"@"+refLabel(baseOpts.AtRef),
+			name+"@"+refLabel(headOpts.AtRef),
+			base.Rendered,
+			head.Rendered,
+		),
+	}
+}
+
+func refLabel(ref string) string {
+	if ref == "" {
+		return workingTreeLabel
+	}
+	return ref
+}
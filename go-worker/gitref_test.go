@@ -0,0 +1,97 @@
+package main
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newGitRepo creates a repository whose first commit holds files and
+// returns its directory.
+func newGitRepo(t *testing.T, files map[string]string) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+
+	dir := t.TempDir()
+	for name, content := range files {
+		writeFile(t, filepath.Join(dir, name), content)
+	}
+	runGit(t, dir, "init", "--quiet")
+	runGit(t, dir, "add", ".")
+	runGit(t, dir, "-c", "user.name=Test", "-c", "user.email=test@example.com", "commit", "--quiet", "-m", "initial")
+	return dir
+}
+
+func runGit(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, out)
+	}
+}
+
+func TestRunReadsTemplateAndContextAtRef(t *testing.T) {
+	dir := newGitRepo(t, map[string]string{
+		"templates/greeting.tmpl": "Hello {{ .name }}",
+		"context.json":            `{"name":"Ada"}`,
+	})
+	templatePath := filepath.Join(dir, "templates", "greeting.tmpl")
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, templatePath, "Goodbye {{ .name }}")
+	writeFile(t, contextPath, `{"name":"Grace"}`)
+
+	resp := run(templatePath, contextPath, renderOptions{AtRef: "HEAD"})
+	if resp.Error != "" || resp.Rendered != "Hello Grace" {
+		t.Fatalf("expected committed template with working context, got %+v", resp)
+	}
+
+	resp = run(templatePath, contextPath, renderOptions{AtRef: "HEAD", RefContext: true})
+	if resp.Rendered != "Hello Ada" {
+		t.Fatalf("expected committed context, got %+v", resp)
+	}
+}
+
+func TestRunCompareRefsDiffsRenderedOutput(t *testing.T) {
+	dir := newGitRepo(t, map[string]string{"page.tmpl": "title\n{{ .name }}\nfooter\n"})
+	templatePath := filepath.Join(dir, "page.tmpl")
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, templatePath, "title\n{{ .name | upper }}\nfooter\n")
+	writeFile(t, contextPath, `{"name":"ada"}`)
+
+	resp := run(templatePath, contextPath, renderOptions{Mode: "compare-refs", AtRef: "HEAD"})
+	if resp.Error != "" {
+		t.Fatalf("unexpected error: %s", resp.Error)
+	}
+	want := "--- page.tmpl@HEAD\n+++ page.tmpl@working tree\n@@ -1,3 +1,3 @@\n title\n-ada\n+ADA\n footer\n"
+	if resp.Diff != want || resp.Rendered != "title\nADA\nfooter\n" {
+		t.Fatalf("unexpected compare response: %+v", resp)
+	}
+}
+
+func TestRunAtRefReportsUnknownRevisions(t *testing.T) {
+	dir := newGitRepo(t, map[string]string{"page.tmpl": "static"})
+
+	resp := run(filepath.Join(dir, "page.tmpl"), "", renderOptions{AtRef: "does-not-exist"})
+	if !strings.HasPrefix(resp.Error, "git show:") {
+		t.Fatalf("expected git error, got %+v", resp)
+	}
+
+	resp = run(filepath.Join(dir, "page.tmpl"), "", renderOptions{AtRef: "--output=/tmp/x"})
+	if resp.Error != `invalid git ref "--output=/tmp/x"` {
+		t.Fatalf("expected option-like refs to be rejected, got %+v", resp)
+	}
+}
+
+func TestRunAtRefNeedsGitOnPath(t *testing.T) {
+	templatePath := filepath.Join(t.TempDir(), "page.tmpl")
+	writeFile(t, templatePath, "static")
+	t.Setenv("PATH", t.TempDir())
+
+	resp := run(templatePath, "", renderOptions{AtRef: "HEAD"})
+	if resp.Error != "git is required for --at-ref but was not found on PATH" {
+		t.Fatalf("expected a missing git error, got %+v", resp)
+	}
+}
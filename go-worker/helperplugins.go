@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// helperPluginProtocolVersion is sent with every call so plugins can
+	// reject a protocol they do not understand.
+	helperPluginProtocolVersion = 1
+	helperPluginTimeout         = 5 * time.Second
+)
+
+// defaultWasmRuntime runs a WASI module as a command. The worker embeds no
+// WebAssembly engine of its own.
+var defaultWasmRuntime = []string{"wasmtime", "run"}
+
+// helperPlugin implements one template function outside the worker, as a
+// subprocess (Command) or a WASI module (Wasm) run by Runtime. Command and
+// Runtime are argument vectors, program first, run without a shell. A nil
+// Arity accepts any number of arguments.
+type helperPlugin struct {
+	Command []string `json:"command,omitempty"`
+	Wasm    string   `json:"wasm,omitempty"`
+	Runtime []string `json:"runtime,omitempty"`
+	Arity   *int     `json:"arity,omitempty"`
+
+	// args is the resolved command line, without the call's JSON.
+	args []string
+}
+
+// helperPluginRequest is the JSON document a helper plugin reads on stdin
+// for each call.
+type helperPluginRequest struct {
+	Version  int           `json:"version"`
+	Function string        `json:"function"`
+	Args     []interface{} `json:"args"`
+}
+
+// helperPluginResponse is what a plugin writes to stdout: a result, or an
+// error that fails the render like an error from a Go function would.
+type helperPluginResponse struct {
+	Result interface{} `json:"result"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// helperPluginManifests returns the manifests to load. Plugins run
+// programs, so they only come from --helper-plugins: neither the project
+// config of a workspace that was merely opened nor a server request can
+// name them.
+func helperPluginManifests(opts renderOptions) []string {
+	if strings.TrimSpace(opts.HelperPlugins) == "" {
+		return nil
+	}
+	return []string{opts.HelperPlugins}
+}
+
+// loadHelperPlugins reads a manifest mapping function names to plugins:
+//
+//	{"money": {"command": ["./plugins/money", "--currency", "EUR"], "arity": 1},
+//	 "slugify": {"wasm": "plugins/slugify.wasm"}}
+//
+// Relative program and module paths resolve against the manifest's
+// directory; bare program names are looked up on PATH.
+func loadHelperPlugins(path string) (map[string]helperPlugin, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var plugins map[string]helperPlugin
+	if err := json.Unmarshal(content, &plugins); err != nil {
+		return nil, fmt.Errorf("helper plugins %s are not valid JSON: %v", path, err)
+	}
+
+	dir := filepath.Dir(path)
+	names := make([]string, 0, len(plugins))
+	for name := range plugins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		plugin := plugins[name]
+		if !isGoIdentifier(name) {
+			return nil, fmt.Errorf("helper plugin %q is not a valid function name", name)
+		}
+		if arity := plugin.Arity; arity != nil && *arity < 0 {
+			return nil, fmt.Errorf("helper plugin %q has negative arity %d", name, *arity)
+		}
+		switch {
+		case len(plugin.Command) > 0 && plugin.Wasm != "":
+			return nil, fmt.Errorf("helper plugin %q sets both command and wasm", name)
+		case len(plugin.Command) > 0:
+			if strings.TrimSpace(plugin.Command[0]) == "" {
+				return nil, fmt.Errorf("helper plugin %q has an empty program name", name)
+			}
+			plugin.args = append([]string(nil), plugin.Command...)
+			if strings.ContainsAny(plugin.args[0], `/\`) && !filepath.IsAbs(plugin.args[0]) {
+				plugin.args[0] = filepath.Join(dir, plugin.args[0])
+			}
+		case plugin.Wasm != "":
+			runtime := plugin.Runtime
+			if len(runtime) == 0 {
+				runtime = defaultWasmRuntime
+			} else if strings.TrimSpace(runtime[0]) == "" {
+				return nil, fmt.Errorf("helper plugin %q has an empty runtime", name)
+			}
+			module := plugin.Wasm
+			if !filepath.IsAbs(module) {
+				module = filepath.Join(dir, module)
+			}
+			plugin.args = append(append([]string(nil), runtime...), module)
+		default:
+			return nil, fmt.Errorf("helper plugin %q needs a command or a wasm module", name)
+		}
+		plugins[name] = plugin
+	}
+	return plugins, nil
+}
+
+// applyHelperPlugins registers the functions of every helper plugin
+// manifest. Like stubs, plugins replace helpers of the same name, and
+// builtins such as len cannot be replaced.
+func applyHelperPlugins[M ~map[string]interface{}](funcs M, opts renderOptions) error {
+	for _, manifest := range helperPluginManifests(opts) {
+		plugins, err := loadHelperPlugins(manifest)
+		if err != nil {
+			return err
+		}
+		for name, plugin := range plugins {
+			if builtinFuncNames[name] {
+				return fmt.Errorf("cannot replace builtin function %q with a helper plugin", name)
+			}
+			funcs[name] = plugin.call(name)
+		}
+	}
+	return nil
+}
+
+// call returns the template function for the plugin. Each call starts the
+// plugin once, so plugins keep no state between calls.
+func (p helperPlugin) call(name string) func(...interface{}) (interface{}, error) {
+	return func(args ...interface{}) (interface{}, error) {
+		if p.Arity != nil && len(args) != *p.Arity {
+			return nil, fmt.Errorf("wrong number of args for plugin %s: want %d got %d", name, *p.Arity, len(args))
+		}
+		if args == nil {
+			args = []interface{}{}
+		}
+		request, err := json.Marshal(helperPluginRequest{Version: helperPluginProtocolVersion, Function: name, Args: args})
+		if err != nil {
+			return nil, fmt.Errorf("plugin %s: cannot pass arguments as JSON: %v", name, err)
+		}
+		stdout, err := runPluginProcess(p.args, request, helperPluginTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("plugin %s failed: %v", name, err)
+		}
+		var answer helperPluginResponse
+		if err := json.Unmarshal(stdout, &answer); err != nil {
+			return nil, fmt.Errorf("plugin %s: invalid response: %v", name, err)
+		}
+		if answer.Error != "" {
+			return nil, fmt.Errorf("%s: %s", name, answer.Error)
+		}
+		return answer.Result, nil
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestHelperPluginProcess is not a real test: the other tests run the test
+// binary itself as a helper plugin, standing in for a service's money
+// formatter and, behind a fake WASM runtime, a slug function.
+func TestHelperPluginProcess(t *testing.T) {
+	behavior := os.Getenv("GO_TEMPLATE_STUDIO_HELPER_PLUGIN")
+	if behavior == "" {
+		return
+	}
+	var request helperPluginRequest
+	if err := json.NewDecoder(os.Stdin).Decode(&request); err != nil || request.Version != helperPluginProtocolVersion {
+		fmt.Fprintf(os.Stderr, "bad request: %v", err)
+		os.Exit(2)
+	}
+	var answer helperPluginResponse
+	switch {
+	case request.Function == "money":
+		cents, _ := request.Args[0].(float64)
+		if cents < 0 {
+			answer.Error = "negative amount"
+		} else {
+			answer.Result = fmt.Sprintf("EUR %.2f", cents/100)
+		}
+	case request.Function == "slug" && strings.HasSuffix(os.Args[len(os.Args)-1], "slug.wasm"):
+		answer.Result = strings.ToLower(strings.ReplaceAll(fmt.Sprint(request.Args...), " ", "-"))
+	default:
+		fmt.Fprintf(os.Stderr, "unknown function %s", request.Function)
+		os.Exit(1)
+	}
+	json.NewEncoder(os.Stdout).Encode(answer)
+	os.Exit(0)
+}
+
+func helperPluginManifest(t *testing.T, dir string) string {
+	t.Setenv("GO_TEMPLATE_STUDIO_HELPER_PLUGIN", "1")
+	self := []string{os.Args[0], "-test.run=^TestHelperPluginProcess$"}
+	manifest, err := json.Marshal(map[string]interface{}{
+		"money": map[string]interface{}{"command": self, "arity": 1},
+		"slug":  map[string]interface{}{"wasm": "plugins/slug.wasm", "runtime": self},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "helpers.json")
+	writeFile(t, path, string(manifest))
+	return path
+}
+
+func TestHelperPluginsRenderThroughSubprocessesAndWasm(t *testing.T) {
+	dir := t.TempDir()
+	manifestPath := helperPluginManifest(t, dir)
+	templatePath := filepath.Join(dir, "invoice.tmpl")
+	writeFile(t, templatePath, `{{ money .total }} {{ slug .title }}`)
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, contextPath, `{"total": 1250, "title": "Spring Sale"}`)
+
+	resp := run(templatePath, contextPath, renderOptions{HelperPlugins: manifestPath})
+	if resp.Error != "" || resp.Rendered != "EUR 12.50 spring-sale" {
+		t.Fatalf("unexpected render: %+v", resp)
+	}
+
+	// A workspace cannot run programs just by being opened.
+	writeFile(t, filepath.Join(dir, ".vscode", "goTemplateStudio.json"), `{"helperPlugins": "helpers.json"}`)
+	resp = run(templatePath, contextPath, renderOptions{Config: filepath.Join(dir, ".vscode", "goTemplateStudio.json")})
+	if !strings.Contains(resp.Error, `function "money" not defined`) {
+		t.Fatalf("expected the project config not to register plugins, got %+v", resp)
+	}
+
+	writeFile(t, contextPath, `{"total": -5, "title": "x"}`)
+	resp = run(templatePath, contextPath, renderOptions{HelperPlugins: manifestPath})
+	if !strings.Contains(resp.Error, "money: negative amount") {
+		t.Fatalf("expected the plugin's error to fail the render, got %+v", resp)
+	}
+}
+
+func TestHelperPluginManifestErrors(t *testing.T) {
+	dir := t.TempDir()
+	manifestPath := helperPluginManifest(t, dir)
+	templatePath := filepath.Join(dir, "page.tmpl")
+	writeFile(t, templatePath, `{{ money 1 2 }}`)
+
+	resp := run(templatePath, "", renderOptions{HelperPlugins: manifestPath})
+	if !strings.Contains(resp.Error, "wrong number of args for plugin money: want 1 got 2") {
+		t.Fatalf("expected an arity error, got %+v", resp)
+	}
+
+	for manifest, want := range map[string]string{
+		`{"len": {"command": ["true"]}}`:                    `cannot replace builtin function "len"`,
+		`{"money": {}}`:                                     `helper plugin "money" needs a command or a wasm module`,
+		`{"money": {"command": ["a"], "wasm": "b.wasm"}}`:   `sets both command and wasm`,
+		`{"money": {"command": [""]}}`:                      `helper plugin "money" has an empty program name`,
+		`{"money": {"command": "./money --currency EUR"}}`:  `not valid JSON`,
+		`{"money": {"command": ["missing-helper-plugin"]}}`: `plugin money failed`,
+	} {
+		writeFile(t, manifestPath, manifest)
+		if resp := run(templatePath, "", renderOptions{HelperPlugins: manifestPath}); !strings.Contains(resp.Error, want) {
+			t.Errorf("manifest %s: expected %q, got %+v", manifest, want, resp)
+		}
+	}
+}
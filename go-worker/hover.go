@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"text/template/parse"
+)
+
+// Hover sources say which function set answered a hover.
+const (
+	hoverSourceBuiltin    = "builtin"
+	hoverSourceHelper     = "helper"
+	hoverSourceSprig      = "sprig"
+	hoverSourceProduction = "production"
+)
+
+// hoverInfo documents the function under the cursor. Line, Column, and
+// EndColumn span its name in the template.
+type hoverInfo struct {
+	Name      string `json:"name"`
+	Signature string `json:"signature"`
+	Doc       string `json:"doc,omitempty"`
+	Source    string `json:"source"`
+	Line      int    `json:"line"`
+	Column    int    `json:"column"`
+	EndColumn int    `json:"endColumn"`
+}
+
+// executeHover documents the builtin or helper function named at the cursor,
+// given as --line/--column or, when no line is set, --offset. An empty
+// response means the cursor is not on a function name.
+func executeHover(templatePath string, opts renderOptions) response {
+	if templatePath == "" {
+		return response{Error: "template path is required"}
+	}
+
+	content, err := readTemplate(templatePath, opts)
+	if err != nil {
+		return response{Error: err.Error()}
+	}
+
+	offset := opts.Offset
+	if opts.Line > 0 {
+		if offset, err = cursorOffset(content, opts); err != nil {
+			return response{Error: err.Error()}
+		}
+	} else if offset < 0 || offset > len(content) {
+		return response{Error: fmt.Sprintf("offset %d is outside the document (length %d)", offset, len(content))}
+	}
+
+	trees, err := parseTrees(templateName(templatePath), content)
+	if err != nil {
+		return response{
+			Diagnostics: []diagnostic{templateDiagnostic(err, templatePath, content)},
+			Error:       err.Error(),
+		}
+	}
+
+	ident := identifierAt(trees, offset)
+	if ident == nil {
+		return response{}
+	}
+
+	if strings.TrimSpace(opts.FuncsFrom) != "" && opts.funcProfile == nil {
+		if profile, err := loadFuncProfile(opts.FuncsFrom, opts.FuncFakes); err == nil {
+			opts.funcProfile = profile
+		}
+	}
+	funcs, err := templateFuncs(templatePath, opts)
+	if err != nil {
+		return response{}
+	}
+	hover, ok := describeFunc(ident.Ident, funcs, opts)
+	if !ok {
+		return response{}
+	}
+	hover.Line, hover.Column = lineColumn(content, ident.Position())
+	hover.EndColumn = hover.Column + len(ident.Ident)
+	return response{Hover: hover}
+}
+
+// identifierAt returns the function name spanning offset, if any.
+func identifierAt(trees map[string]*parse.Tree, offset int) *parse.IdentifierNode {
+	var found *parse.IdentifierNode
+	for _, tree := range trees {
+		walkNodes(tree.Root, func(node parse.Node) bool {
+			ident, ok := node.(*parse.IdentifierNode)
+			if ok && int(ident.Pos) <= offset && offset < int(ident.Pos)+len(ident.Ident) {
+				found = ident
+			}
+			return found == nil
+		})
+		if found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// templateFuncs returns the FuncMap a render of templatePath would register.
+func templateFuncs(templatePath string, opts renderOptions) (map[string]interface{}, error) {
+	var funcs map[string]interface{}
+	if usesHTMLEngine(templatePath, opts) {
+		funcs = htmlFuncMap()
+	} else {
+		funcs = textFuncMap()
+	}
+	if err := prepareFuncs(funcs, opts); err != nil {
+		return nil, err
+	}
+	return funcs, nil
+}
+
+// describeFunc documents name as the render would resolve it with funcs:
+// functions the FuncMap registers shadow the builtins of the same name.
+func describeFunc(name string, funcs map[string]interface{}, opts renderOptions) (*hoverInfo, bool) {
+	fn, registered := funcs[name]
+	if !registered {
+		doc, ok := builtinFuncDocs[name]
+		if !ok {
+			return nil, false
+		}
+		return &hoverInfo{Name: name, Signature: doc.Signature, Doc: doc.Doc, Source: hoverSourceBuiltin}, true
+	}
+
+	hover := &hoverInfo{Name: name, Signature: goSignature(name, fn)}
+	var docs map[string]funcDoc
+	switch {
+	case opts.funcProfile != nil && opts.funcProfile.Names[name]:
+		hover.Source = hoverSourceProduction
+		hover.Doc = "Registered by the production FuncMap in " + opts.funcProfile.Source + "."
+	case opts.Funcs == funcLibrarySprig && isSprigFunc(name):
+		hover.Source = hoverSourceSprig
+		hover.Doc = "See the Sprig documentation: " + sprigDocsURL
+		docs = sprigFuncDocs
+	default:
+		hover.Source = hoverSourceHelper
+		docs = helperFuncDocs
+	}
+	if doc, ok := docs[name]; ok {
+		hover.Signature, hover.Doc = doc.Signature, doc.Doc
+	}
+	return hover, true
+}
+
+// goSignature spells a function's parameter and result types, for
+// functions without curated docs.
+func goSignature(name string, fn interface{}) string {
+	fnType := reflect.TypeOf(fn)
+	if fnType == nil || fnType.Kind() != reflect.Func {
+		return name
+	}
+
+	params := make([]string, fnType.NumIn())
+	for i := range params {
+		if fnType.IsVariadic() && i == fnType.NumIn()-1 {
+			params[i] = "..." + fnType.In(i).Elem().String()
+		} else {
+			params[i] = fnType.In(i).String()
+		}
+	}
+	results := make([]string, fnType.NumOut())
+	for i := range results {
+		results[i] = fnType.Out(i).String()
+	}
+
+	signature := name + "(" + strings.Join(params, ", ") + ")"
+	switch len(results) {
+	case 0:
+		return signature
+	case 1:
+		return signature + " " + results[0]
+	default:
+		return signature + " (" + strings.Join(results, ", ") + ")"
+	}
+}
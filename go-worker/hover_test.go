@@ -0,0 +1,61 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHoverDocumentsFunctionUnderCursor(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "hover.tmpl")
+	content := "{{ len .items }}\n{{ .tags | join \", \" }} {{ camelcase .name }}"
+	writeFile(t, templatePath, content)
+
+	resp := run(templatePath, "", renderOptions{Mode: "hover", Line: 1, Column: 5})
+	if hover := resp.Hover; hover == nil || hover.Name != "len" || hover.Source != hoverSourceBuiltin || hover.Signature != "len x" || hover.Column != 4 || hover.EndColumn != 7 {
+		t.Fatalf("unexpected builtin hover: %+v", resp)
+	}
+
+	joinOffset := strings.Index(content, "join") + 2
+	resp = run(templatePath, "", renderOptions{Mode: "hover", Offset: joinOffset})
+	if hover := resp.Hover; hover == nil || hover.Source != hoverSourceHelper || hover.Signature != "join separator list" || hover.Line != 2 || hover.Column != 12 {
+		t.Fatalf("unexpected helper hover: %+v", resp)
+	}
+
+	resp = run(templatePath, "", renderOptions{Mode: "hover", Offset: joinOffset, Funcs: funcLibrarySprig})
+	if hover := resp.Hover; hover == nil || hover.Source != hoverSourceSprig || hover.Doc != sprigFuncDocs["join"].Doc {
+		t.Fatalf("unexpected sprig hover: %+v", resp)
+	}
+
+	resp = run(templatePath, "", renderOptions{Mode: "hover", Offset: strings.Index(content, "camelcase"), Funcs: funcLibrarySprig})
+	if hover := resp.Hover; hover == nil || hover.Signature != "camelcase(string) string" || !strings.Contains(hover.Doc, sprigDocsURL) {
+		t.Fatalf("expected a signature from reflection, got %+v", resp)
+	}
+
+	resp = run(templatePath, "", renderOptions{Mode: "hover", Offset: strings.Index(content, ".items")})
+	if resp.Hover != nil || resp.Error != "" {
+		t.Fatalf("expected no hover off a function name, got %+v", resp)
+	}
+}
+
+func TestHoverReportsProductionFuncs(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "hover.tmpl")
+	funcsPath := filepath.Join(dir, "funcs.go")
+	writeFile(t, templatePath, `{{ currentUser }}`)
+	writeFile(t, funcsPath, "package web\n\nimport \"html/template\"\n\nvar funcs = template.FuncMap{\"currentUser\": currentUser}\n")
+
+	resp := run(templatePath, "", renderOptions{Mode: "hover", Offset: 4, FuncsFrom: funcsPath})
+	if hover := resp.Hover; hover == nil || hover.Source != hoverSourceProduction || !strings.Contains(hover.Doc, funcsPath) {
+		t.Fatalf("unexpected production hover: %+v", resp)
+	}
+}
+
+func TestEveryHelperIsDocumented(t *testing.T) {
+	for name := range textFuncMap() {
+		if _, ok := helperFuncDocs[name]; !ok {
+			t.Errorf("helper %q has no hover documentation", name)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/template/parse"
+)
+
+// HTML risk rules: constructs html/template only partially protects. They
+// are warnings on every render of an HTML template and in check mode, so
+// the preview shows the safe pattern instead of hiding the risky one.
+const (
+	safeUserDataRule       = "safe-user-data"
+	javascriptURLRule      = "javascript-url"
+	eventHandlerOutputRule = "event-handler-output"
+	dynamicAttributeRule   = "dynamic-attribute"
+	cssOutputRule          = "css-output"
+)
+
+// htmlState is where in the markup an action is, as far as htmlContexts
+// tracks it.
+type htmlState int
+
+const (
+	htmlText          htmlState = iota
+	htmlTag                     // inside a start tag, between attributes
+	htmlAttrName                // inside an attribute name
+	htmlAfterAttrName           // after an attribute name, before any =
+	htmlBeforeValue             // after the = of an attribute
+	htmlValue                   // inside a quoted or unquoted attribute value
+	htmlRawText                 // inside a script or style element
+	htmlComment                 // inside <!-- -->
+)
+
+// htmlRiskDiagnostics reports the HTML risk rules for a render. Text
+// templates have none.
+func htmlRiskDiagnostics(templatePath, content string, opts renderOptions) []diagnostic {
+	if !usesHTMLEngine(templatePath, opts) {
+		return nil
+	}
+	name := templateName(templatePath)
+	trees, err := parseTreesWithDelims(name, content, opts.LeftDelim, opts.RightDelim)
+	if err != nil {
+		return nil
+	}
+	linter := templateLinter{
+		templatePath: templatePath,
+		content:      content,
+		actions:      scanActions(content, opts.LeftDelim, opts.RightDelim),
+		html:         true,
+	}
+	linter.htmlRisks(trees, name)
+	sortDiagnostics(linter.diagnostics)
+	return linter.diagnostics
+}
+
+func (l *templateLinter) htmlRisks(trees map[string]*parse.Tree, name string) {
+	for _, treeName := range sortedTreeNames(trees, name) {
+		l.unsafeSafe(trees[treeName])
+	}
+	l.htmlContexts(trees)
+}
+
+// unsafeSafe reports calls to safe on anything but a string literal: safe
+// turns off escaping, so context data passed to it can inject markup.
+func (l *templateLinter) unsafeSafe(tree *parse.Tree) {
+	walkNodes(tree.Root, func(node parse.Node) bool {
+		pipe, ok := node.(*parse.PipeNode)
+		if !ok {
+			return true
+		}
+		for i, command := range pipe.Cmds {
+			safe, ok := command.Args[0].(*parse.IdentifierNode)
+			if !ok || safe.Ident != "safe" {
+				continue
+			}
+			var input parse.Node
+			switch {
+			case len(command.Args) > 1:
+				input = command.Args[1]
+			case i > 0:
+				input = pipe.Cmds[i-1]
+			default:
+				continue
+			}
+			if readsData(input) {
+				l.report(safeUserDataRule, safe.Pos, len(safe.Ident),
+					"safe turns off HTML escaping for a value that comes from the context; only pass it markup you control")
+			}
+		}
+		return true
+	})
+}
+
+// htmlContexts follows the markup around the actions of the template and
+// reports the output actions that land where html/template escaping is
+// only a partial defense: javascript: URLs, event handler attributes,
+// attribute names, and CSS. Every define starts over in text, as the
+// tracking reads the file from top to bottom.
+func (l *templateLinter) htmlContexts(trees map[string]*parse.Tree) {
+	outputs := map[int]bool{}
+	for _, tree := range trees {
+		walkNodes(tree.Root, func(node parse.Node) bool {
+			if action, ok := node.(*parse.ActionNode); ok && len(action.Pipe.Decl) == 0 {
+				if span, ok := enclosingAction(l.actions, action.Position()); ok {
+					outputs[span.Start] = true
+				}
+			}
+			return true
+		})
+	}
+
+	content := l.content
+	state := htmlText
+	var tag, attr string
+	var quote byte
+	nameStart, valueStart := 0, 0
+	next := 0
+	for i := 0; i < len(content); {
+		if next < len(l.actions) && i == l.actions[next].Start {
+			action := l.actions[next]
+			next++
+			if state == htmlBeforeValue {
+				state, quote, valueStart = htmlValue, 0, i
+			}
+			if outputs[action.Start] {
+				l.htmlOutput(action, state, tag, attr, content[valueStart:action.Start])
+			}
+			i = action.End
+			continue
+		}
+
+		c := content[i]
+		switch state {
+		case htmlText:
+			switch {
+			case strings.HasPrefix(content[i:], "<!--"):
+				state = htmlComment
+				i += len("<!--")
+				continue
+			case c == '<' && i+1 < len(content) && isASCIILetter(content[i+1]):
+				j := i + 1
+				for j < len(content) && (isASCIILetter(content[j]) || content[j] >= '0' && content[j] <= '9' || content[j] == '-') {
+					j++
+				}
+				tag, state = strings.ToLower(content[i+1:j]), htmlTag
+				i = j
+				continue
+			}
+		case htmlComment:
+			if strings.HasPrefix(content[i:], "-->") {
+				state = htmlText
+				i += len("-->")
+				continue
+			}
+		case htmlTag:
+			switch {
+			case c == '>':
+				state = htmlText
+				if tag == "script" || tag == "style" {
+					state = htmlRawText
+				}
+			case !isHTMLSpace(c) && c != '/':
+				state, nameStart = htmlAttrName, i
+				continue
+			}
+		case htmlAttrName:
+			if isHTMLSpace(c) || c == '=' || c == '>' || c == '/' {
+				attr, state = strings.ToLower(content[nameStart:i]), htmlAfterAttrName
+				continue
+			}
+		case htmlAfterAttrName:
+			switch {
+			case c == '=':
+				state = htmlBeforeValue
+			case !isHTMLSpace(c):
+				state = htmlTag
+				continue
+			}
+		case htmlBeforeValue:
+			switch {
+			case c == '"' || c == '\'':
+				state, quote, valueStart = htmlValue, c, i+1
+			case c == '>':
+				state = htmlTag
+				continue
+			case !isHTMLSpace(c):
+				state, quote, valueStart = htmlValue, 0, i
+				continue
+			}
+		case htmlValue:
+			switch {
+			case quote != 0 && c == quote:
+				state = htmlTag
+			case quote == 0 && (isHTMLSpace(c) || c == '>'):
+				state = htmlTag
+				continue
+			}
+		case htmlRawText:
+			if end := "</" + tag; len(content)-i >= len(end) && strings.EqualFold(content[i:i+len(end)], end) {
+				state = htmlText
+			}
+		}
+		i++
+	}
+}
+
+// htmlOutput reports an output action by where it is in the markup. value
+// is the attribute value before it, when it is in one.
+func (l *templateLinter) htmlOutput(action actionSpan, state htmlState, tag, attr, value string) {
+	width := action.End - action.Start
+	if newline := strings.IndexByte(l.content[action.Start:action.End], '\n'); newline >= 0 {
+		width = newline
+	}
+	pos := parse.Pos(action.Start)
+	switch {
+	case state == htmlTag || state == htmlAttrName || state == htmlAfterAttrName:
+		l.report(dynamicAttributeRule, pos, width,
+			"html/template replaces an attribute name from the context with ZgotmplZ unless it is plainly harmless, so it can never be an event handler, style, or URL; write attribute names literally and choose between them with {{ if }}")
+	case state == htmlValue && strings.HasPrefix(strings.ToLower(strings.TrimSpace(value)), "javascript:"):
+		l.report(javascriptURLRule, pos, width,
+			"output in a javascript: URL runs as code, and html/template only escapes it as a JavaScript value; attach an event listener from a script and pass the data in a data- attribute")
+	case state == htmlValue && strings.HasPrefix(attr, "on"):
+		l.report(eventHandlerOutputRule, pos, width, fmt.Sprintf(
+			"output in the %s attribute runs as JavaScript, and html/template only escapes it as a JavaScript value; pass the data in a data- attribute and read it from a script", attr))
+	case state == htmlValue && attr == "style", state == htmlRawText && tag == "style":
+		l.report(cssOutputRule, pos, width,
+			"html/template replaces CSS from the context with ZgotmplZ unless it looks like a plain value; set a class from the data instead of writing it into styles")
+	}
+}
+
+// readsData reports whether node reads dot or a variable.
+func readsData(node parse.Node) bool {
+	found := false
+	walkNodes(node, func(node parse.Node) bool {
+		switch node.(type) {
+		case *parse.DotNode, *parse.FieldNode, *parse.VariableNode, *parse.ChainNode:
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+func isASCIILetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isHTMLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHTMLRisksAreWarnedOnRender(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "page.html")
+	writeFile(t, templatePath, `<a href="javascript:go({{ .id }})" title="{{ .title }}">{{ .title }}</a>
+<button onclick="save({{ .id }})" data-id="{{ .id }}">Save</button>
+<div {{ .attrs }} style="color: {{ .color }}">{{ .bio | safe }}</div>
+<style>p { color: {{ .color }}; }</style><script>var id = {{ .id }};</script>
+<!-- {{ .title }} --><a href="{{ .url }}">link</a>`)
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, contextPath, `{"id": 1, "title": "Hi", "attrs": "hidden", "color": "red", "bio": "<b>me</b>", "url": "/home"}`)
+
+	resp := run(templatePath, contextPath, renderOptions{})
+	if resp.Error != "" {
+		t.Fatalf("expected the template to render, got %+v", resp)
+	}
+	var got []string
+	for _, diag := range resp.Diagnostics {
+		if diag.Severity != "warning" {
+			t.Fatalf("expected only warnings, got %+v", diag)
+		}
+		got = append(got, fmt.Sprintf("%s@%d:%d-%d", diag.Rule, diag.Line, diag.Column, diag.EndColumn))
+	}
+	want := "javascript-url@1:24-33 event-handler-output@2:23-32 dynamic-attribute@3:6-18 css-output@3:33-45 safe-user-data@3:57-61 css-output@4:19-31"
+	if strings.Join(got, " ") != want {
+		t.Fatalf("unexpected findings: %v\n%+v", got, resp.Diagnostics)
+	}
+
+	resp = run(templatePath, "", renderOptions{Mode: "check"})
+	got = got[:0]
+	for _, diag := range resp.Diagnostics {
+		got = append(got, diag.Rule)
+	}
+	if strings.Join(got, " ") != "javascript-url event-handler-output dynamic-attribute css-output safe-user-data css-output" {
+		t.Fatalf("expected check mode to report the same findings, got %+v", resp.Diagnostics)
+	}
+
+	textPath := filepath.Join(dir, "page.tmpl")
+	writeFile(t, textPath, `<a href="javascript:go({{ .id }})">`)
+	if resp := run(textPath, contextPath, renderOptions{}); len(resp.Diagnostics) != 0 {
+		t.Fatalf("expected text templates to have no HTML risks, got %+v", resp.Diagnostics)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template/parse"
+)
+
+// templateOverride reports a template name defined by more than one source
+// and which definition won. Overridden lists the losing definitions in
+// parse order.
+type templateOverride struct {
+	Name       string               `json:"name"`
+	Winner     templateDefinition   `json:"winner"`
+	Overridden []templateDefinition `json:"overridden"`
+}
+
+// templateDefinition locates one definition of a template and the priority
+// of the source holding it.
+type templateDefinition struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Priority int    `json:"priority"`
+}
+
+// parseIncludePriority reads --include-priority, a comma-separated list of
+// key=priority pairs such as theme=10,base=0.
+func parseIncludePriority(value string) (map[string]int, error) {
+	entries := splitList(value)
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	priorities := make(map[string]int, len(entries))
+	for _, entry := range entries {
+		key, number, ok := strings.Cut(entry, "=")
+		key = strings.TrimSpace(key)
+		priority, err := strconv.Atoi(strings.TrimSpace(number))
+		if !ok || key == "" || err != nil {
+			return nil, fmt.Errorf("invalid include priority %q: expected name=integer", entry)
+		}
+		priorities[key] = priority
+	}
+	return priorities, nil
+}
+
+// includePriority is the priority of an include: the highest of the keys
+// that name one of the directories in its path or its file name, or that
+// match the end of its path as a glob, such as themes/*.tmpl. Other
+// includes have priority 0.
+func includePriority(include templateSource, priorities map[string]int) int {
+	location := filepath.ToSlash(include.Path)
+	segments := strings.Split(location, "/")
+	best, matched := 0, false
+	for key, priority := range priorities {
+		pattern := filepath.ToSlash(key)
+		hit := false
+		for i, segment := range segments {
+			if segment == key {
+				hit = true
+				break
+			}
+			if matched, _ := path.Match(pattern, strings.Join(segments[i:], "/")); matched {
+				hit = true
+				break
+			}
+		}
+		if hit && (!matched || priority > best) {
+			best, matched = priority, true
+		}
+	}
+	return best
+}
+
+// orderIncludes sorts includes so higher priorities are parsed later and
+// their definitions replace those of lower ones. Includes of equal
+// priority keep the order they were resolved in: alias includes first,
+// then each --include pattern's matches in lexical order.
+func orderIncludes(includes []templateSource, priorities map[string]int) []templateSource {
+	if len(priorities) == 0 {
+		return includes
+	}
+	ordered := append([]templateSource{}, includes...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return includePriority(ordered[i], priorities) < includePriority(ordered[j], priorities)
+	})
+	return ordered
+}
+
+// includeOverrides lists the template names defined by more than one of
+// the template and its ordered includes, and which definition wins: the
+// last non-empty one parsed, as text/template resolves them. With
+// priorities, a name whose winner ties with another definition on
+// priority is also reported as a warning, since only their order decides.
+func includeOverrides(templatePath, content string, includes []templateSource, opts renderOptions) ([]templateOverride, []diagnostic) {
+	if len(includes) == 0 {
+		return nil, nil
+	}
+	definitions := map[string][]templateDefinition{}
+	var names []string
+	sources := append([]templateSource{{Name: templateName(templatePath), Path: templatePath, Content: content}}, includes...)
+	for index, source := range sources {
+		trees, err := parseTreesWithDelims(source.Name, source.Content, opts.LeftDelim, opts.RightDelim)
+		if err != nil {
+			continue
+		}
+		priority := 0
+		if index > 0 {
+			priority = includePriority(source, opts.IncludePriority)
+		}
+		for _, treeName := range sortedTreeNames(trees, source.Name) {
+			if parse.IsEmptyTree(trees[treeName].Root) {
+				continue
+			}
+			definition := templateDefinition{File: source.Path, Line: 1, Column: 1, Priority: priority}
+			if treeName != source.Name {
+				if location, ok := findDefinition(source.Path, source.Content, treeName); ok {
+					definition.Line, definition.Column = location.Line, location.Column
+				}
+			}
+			if _, ok := definitions[treeName]; !ok {
+				names = append(names, treeName)
+			}
+			definitions[treeName] = append(definitions[treeName], definition)
+		}
+	}
+
+	sort.Strings(names)
+	var overrides []templateOverride
+	var warnings []diagnostic
+	for _, name := range names {
+		candidates := definitions[name]
+		if len(candidates) < 2 {
+			continue
+		}
+		winner := candidates[len(candidates)-1]
+		override := templateOverride{Name: name, Winner: winner, Overridden: candidates[:len(candidates)-1]}
+		for _, loser := range override.Overridden {
+			if len(opts.IncludePriority) > 0 && loser.Priority == winner.Priority && loser.File != templatePath {
+				warnings = append(warnings, diagnostic{
+					Message: fmt.Sprintf("template %q is defined with priority %d in both %s and %s; %s wins only because it is parsed later",
+						name, winner.Priority, loser.File, winner.File, winner.File),
+					Severity: "warning",
+					File:     winner.File,
+					Line:     winner.Line,
+					Column:   winner.Column,
+				})
+			}
+		}
+		overrides = append(overrides, override)
+	}
+	return overrides, warnings
+}
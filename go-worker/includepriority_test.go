@@ -0,0 +1,54 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIncludePriorityDecidesWhichDefinitionWins(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "page.tmpl")
+	writeFile(t, templatePath, `{{ template "header" }}|{{ template "footer" }}`)
+	writeFile(t, filepath.Join(dir, "base", "layout.tmpl"), `{{ define "header" }}base header{{ end }}{{ define "footer" }}base footer{{ end }}`)
+	writeFile(t, filepath.Join(dir, "theme", "layout2.tmpl"), `{{ define "header" }}theme header{{ end }}`)
+	includes := []string{filepath.Join(dir, "theme", "*.tmpl"), filepath.Join(dir, "base", "*.tmpl")}
+
+	resp := run(templatePath, "", renderOptions{Includes: includes})
+	if resp.Rendered != "base header|base footer" {
+		t.Fatalf("expected the later include to win by default, got %+v", resp)
+	}
+
+	resp = run(templatePath, "", renderOptions{Includes: includes, IncludePriority: map[string]int{"theme": 10, "base": 0}})
+	if resp.Error != "" || resp.Rendered != "theme header|base footer" {
+		t.Fatalf("expected the theme to win, got %+v", resp)
+	}
+	if len(resp.Overrides) != 1 {
+		t.Fatalf("expected one override, got %+v", resp.Overrides)
+	}
+	override := resp.Overrides[0]
+	if override.Name != "header" || override.Winner.Priority != 10 || !strings.HasSuffix(override.Winner.File, "layout2.tmpl") ||
+		len(override.Overridden) != 1 || override.Overridden[0].Priority != 0 || override.Overridden[0].Column != 1 {
+		t.Fatalf("unexpected override: %+v", override)
+	}
+	if len(resp.Diagnostics) != 0 {
+		t.Fatalf("expected no tie warnings, got %+v", resp.Diagnostics)
+	}
+
+	resp = run(templatePath, "", renderOptions{Includes: includes, IncludePriority: map[string]int{"*/layout2.tmpl": 1, "layout.tmpl": 1}})
+	if len(resp.Diagnostics) != 1 || !strings.Contains(resp.Diagnostics[0].Message, "wins only because it is parsed later") {
+		t.Fatalf("expected a tie warning, got %+v", resp.Diagnostics)
+	}
+}
+
+func TestParseIncludePriority(t *testing.T) {
+	priorities, err := parseIncludePriority("theme=10, base=-1")
+	if err != nil || priorities["theme"] != 10 || priorities["base"] != -1 {
+		t.Fatalf("unexpected priorities %v (%v)", priorities, err)
+	}
+	for _, value := range []string{"theme", "theme=high", "=1"} {
+		if _, err := parseIncludePriority(value); err == nil {
+			t.Errorf("expected %q to be rejected", value)
+		}
+	}
+}
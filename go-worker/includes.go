@@ -0,0 +1,219 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template/parse"
+)
+
+// templateSource is an additional named template parsed alongside the
+// template being rendered.
+type templateSource struct {
+	Name    string
+	Path    string
+	Content string
+}
+
+var includeExtensions = []string{".tmpl", ".gotmpl", ".tpl", ".html", ".htm", ".txt"}
+
+// resolveAlias maps an aliased template name such as "@shared/footer" onto
+// a file path using the longest matching alias.
+func resolveAlias(name string, aliases map[string]string, preferredExt string) (string, bool) {
+	if !strings.HasPrefix(name, "@") {
+		return "", false
+	}
+
+	var match string
+	for alias := range aliases {
+		if (name == alias || strings.HasPrefix(name, alias+"/")) && len(alias) > len(match) {
+			match = alias
+		}
+	}
+	if match == "" {
+		return "", false
+	}
+
+	rest := strings.TrimPrefix(name[len(match):], "/")
+	if target := aliases[match]; isRemoteURL(target) {
+		location := strings.TrimSuffix(target, "/") + "/" + rest
+		if path.Ext(rest) == "" && preferredExt != "" {
+			location += preferredExt
+		}
+		return location, true
+	}
+
+	base := filepath.Join(aliases[match], filepath.FromSlash(rest))
+	candidates := []string{base}
+	if filepath.Ext(base) == "" {
+		if preferredExt != "" {
+			candidates = append(candidates, base+preferredExt)
+		}
+		for _, ext := range includeExtensions {
+			candidates = append(candidates, base+ext)
+		}
+	}
+
+	for _, candidate := range candidates {
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate, true
+		}
+	}
+	return base, true
+}
+
+// resolveAliasIncludes loads every aliased template referenced by content,
+// following references inside the loaded files as well.
+func resolveAliasIncludes(templatePath, content string, opts renderOptions) ([]templateSource, []diagnostic) {
+	if opts.project == nil || len(opts.project.TemplateAliases) == 0 {
+		return nil, nil
+	}
+
+	var (
+		sources     []templateSource
+		diagnostics []diagnostic
+		seen        = map[string]bool{}
+	)
+	aliases := opts.project.TemplateAliases
+	ext := path.Ext(templateName(templatePath))
+
+	pending := []templateSource{{Name: templateName(templatePath), Path: templatePath, Content: content}}
+	for len(pending) > 0 {
+		current := pending[0]
+		pending = pending[1:]
+
+		trees, err := parseTreesWithDelims(current.Name, current.Content, opts.LeftDelim, opts.RightDelim)
+		if err != nil {
+			continue
+		}
+
+		for _, ref := range templateReferences(trees) {
+			if seen[ref.Name] {
+				continue
+			}
+			location, ok := resolveAlias(ref.Name, aliases, ext)
+			if !ok {
+				continue
+			}
+			seen[ref.Name] = true
+
+			includeContent, err := readTemplate(location, opts)
+			if err != nil {
+				line, column := lineColumn(current.Content, ref.Pos)
+				diagnostics = append(diagnostics, diagnostic{
+					Message:  fmt.Sprintf("template alias %q resolves to %s: %v", ref.Name, location, err),
+					Severity: "warning",
+					Rule:     unreadableIncludeRule,
+					File:     current.Path,
+					Line:     line,
+					Column:   column,
+				})
+				continue
+			}
+
+			source := templateSource{Name: ref.Name, Path: location, Content: includeContent}
+			sources = append(sources, source)
+			pending = append(pending, source)
+		}
+	}
+
+	return sources, diagnostics
+}
+
+// resolveIncludePatterns loads the files matched by the --include globs the
+// way template.ParseFiles does: each file is parsed under its base name so
+// its define blocks are available to the template being rendered.
+func resolveIncludePatterns(templatePath string, opts renderOptions) ([]templateSource, []diagnostic) {
+	var (
+		sources     []templateSource
+		diagnostics []diagnostic
+		seen        = map[string]bool{}
+	)
+	root := templateName(templatePath)
+	if abs, err := filepath.Abs(templatePath); err == nil && !isRemoteURL(templatePath) {
+		seen[abs] = true
+	}
+
+	for _, pattern := range opts.Includes {
+		matches, err := filepath.Glob(pattern)
+		if err == nil && len(matches) == 0 {
+			err = errors.New("pattern matches no files")
+		}
+		if err != nil {
+			diagnostics = append(diagnostics, diagnostic{
+				Message:  fmt.Sprintf("include %q: %v", pattern, err),
+				Severity: "warning",
+			})
+			continue
+		}
+
+		for _, match := range matches {
+			abs, err := filepath.Abs(match)
+			if err != nil || seen[abs] {
+				continue
+			}
+			seen[abs] = true
+
+			info, err := os.Stat(match)
+			if err != nil {
+				// Glob lists broken symlinks, which Stat cannot follow.
+				diagnostics = append(diagnostics, diagnostic{
+					Message:  fmt.Sprintf("include %s: %v", match, err),
+					Severity: "warning",
+					Rule:     unreadableIncludeRule,
+					File:     match,
+				})
+				continue
+			}
+			if info.IsDir() {
+				continue
+			}
+			name := filepath.Base(match)
+			if name == root {
+				diagnostics = append(diagnostics, diagnostic{
+					Message:  fmt.Sprintf("include %s skipped: its name collides with the template being rendered", match),
+					Severity: "warning",
+				})
+				continue
+			}
+
+			content, err := readTemplate(match, opts)
+			if err != nil {
+				diagnostics = append(diagnostics, diagnostic{
+					Message:  fmt.Sprintf("include %s: %v", match, err),
+					Severity: "warning",
+					Rule:     unreadableIncludeRule,
+					File:     match,
+				})
+				continue
+			}
+			sources = append(sources, templateSource{Name: name, Path: match, Content: content})
+		}
+	}
+
+	return sources, diagnostics
+}
+
+type templateReference struct {
+	Name string
+	Pos  parse.Pos
+}
+
+// templateReferences lists `{{template "name"}}` calls in source order.
+func templateReferences(trees map[string]*parse.Tree) []templateReference {
+	var refs []templateReference
+	for _, tree := range trees {
+		walkNodes(tree.Root, func(node parse.Node) bool {
+			if call, ok := node.(*parse.TemplateNode); ok {
+				refs = append(refs, templateReference{Name: call.Name, Pos: call.Position()})
+			}
+			return true
+		})
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].Pos < refs[j].Pos })
+	return refs
+}
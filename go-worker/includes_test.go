@@ -0,0 +1,125 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeAliasWorkspace lays out a project whose config maps @shared onto a
+// sibling directory holding a footer partial.
+func writeAliasWorkspace(t *testing.T) (string, string) {
+	t.Helper()
+	root := t.TempDir()
+
+	files := map[string]string{
+		"shared/footer.tmpl":        `{{ define "copyright" }}(c) {{ .year }}{{ end }}Footer {{ template "copyright" . }}{{ template "@shared/legal/terms" }}`,
+		"shared/legal/terms.tmpl":   `Terms`,
+		"app/page.tmpl":             "Body\n{{ template \"@shared/footer\" . }}",
+		"app/goTemplateStudio.json": `{"templateAliases":{"@shared":"../shared"}}`,
+	}
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	return filepath.Join(root, "app", "page.tmpl"), filepath.Join(root, "app", "goTemplateStudio.json")
+}
+
+func TestRunResolvesTemplateAliases(t *testing.T) {
+	templatePath, configPath := writeAliasWorkspace(t)
+	contextPath := filepath.Join(filepath.Dir(templatePath), "context.json")
+	if err := os.WriteFile(contextPath, []byte(`{"year":2024}`), 0o600); err != nil {
+		t.Fatalf("failed to write context: %v", err)
+	}
+
+	resp := run(templatePath, contextPath, renderOptions{Config: configPath})
+	if resp.Error != "" {
+		t.Fatalf("unexpected error: %s (%+v)", resp.Error, resp.Diagnostics)
+	}
+	if resp.Rendered != "Body\nFooter (c) 2024Terms" {
+		t.Fatalf("unexpected output: %q", resp.Rendered)
+	}
+}
+
+func TestResolveAliasIncludesReportsMissingFiles(t *testing.T) {
+	opts := renderOptions{project: &projectConfig{TemplateAliases: map[string]string{"@shared": t.TempDir()}}}
+	_, diagnostics := resolveAliasIncludes("page.tmpl", `{{ template "@shared/missing" }}`, opts)
+	if len(diagnostics) != 1 || diagnostics[0].Severity != "warning" || !strings.Contains(diagnostics[0].Message, "@shared/missing") {
+		t.Fatalf("unexpected diagnostics: %+v", diagnostics)
+	}
+}
+
+func TestResolveAliasPrefersLongestMatch(t *testing.T) {
+	aliases := map[string]string{"@a": "/one", "@a/b": "/two"}
+	path, ok := resolveAlias("@a/b/c.tmpl", aliases, "")
+	if !ok || path != filepath.Join("/two", "c.tmpl") {
+		t.Fatalf("unexpected resolution: %s %v", path, ok)
+	}
+
+	if _, ok := resolveAlias("plain", aliases, ""); ok {
+		t.Fatal("expected non-alias names to be ignored")
+	}
+}
+
+func TestDefinitionModeFollowsAliasesAndDefines(t *testing.T) {
+	templatePath, configPath := writeAliasWorkspace(t)
+
+	resp := run(templatePath, "", renderOptions{Mode: "definition", Config: configPath, Line: 2, Column: 15})
+	if resp.Definition == nil || !strings.HasSuffix(resp.Definition.File, filepath.Join("shared", "footer.tmpl")) {
+		t.Fatalf("expected alias definition, got %+v", resp)
+	}
+
+	localPath := filepath.Join(t.TempDir(), "local.tmpl")
+	if err := os.WriteFile(localPath, []byte("{{ template \"row\" }}\n{{ define \"row\" }}x{{ end }}"), 0o600); err != nil {
+		t.Fatalf("failed to write template: %v", err)
+	}
+	resp = run(localPath, "", renderOptions{Mode: "definition", Line: 1, Column: 5})
+	if resp.Definition == nil || resp.Definition.Line != 2 || resp.Definition.Column != 1 {
+		t.Fatalf("expected local define location, got %+v", resp)
+	}
+
+	resp = run(localPath, "", renderOptions{Mode: "definition", Line: 2, Column: 20})
+	if resp.Definition != nil {
+		t.Fatalf("expected no definition outside template calls, got %+v", resp.Definition)
+	}
+}
+
+func TestRunParsesIncludeGlobs(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "partials", "header.tmpl"), `{{ define "header" }}<h1>{{ . }}</h1>{{ end }}`)
+	writeFile(t, filepath.Join(dir, "partials", "footer.tmpl"), `{{ define "footer" }}<p>bye</p>{{ end }}`)
+	writeFile(t, filepath.Join(dir, "page.html"), `{{ template "header" "Hi & welcome" }}{{ template "footer" }}`)
+
+	opts := renderOptions{Includes: []string{filepath.Join(dir, "partials", "*.tmpl"), filepath.Join(dir, "*.html")}}
+	resp := run(filepath.Join(dir, "page.html"), "", opts)
+	if resp.Error != "" || resp.Rendered != "<h1>Hi &amp; welcome</h1><p>bye</p>" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	resp = run(filepath.Join(dir, "page.html"), "", renderOptions{Mode: "definition", Line: 1, Column: 16, Includes: opts.Includes})
+	if resp.Definition == nil || !strings.HasSuffix(resp.Definition.File, "header.tmpl") {
+		t.Fatalf("expected definition in included file, got %+v", resp)
+	}
+}
+
+func TestRunWarnsAboutEmptyIncludeGlobs(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "page.tmpl"), "plain")
+
+	resp := run(filepath.Join(dir, "page.tmpl"), "", renderOptions{Includes: []string{filepath.Join(dir, "missing", "*.tmpl")}})
+	if resp.Error != "" || resp.Rendered != "plain" || len(resp.Diagnostics) != 1 || resp.Diagnostics[0].Severity != "warning" {
+		t.Fatalf("expected warning for empty glob, got %+v", resp)
+	}
+
+	resp = run(filepath.Join(dir, "page.tmpl"), "", renderOptions{Includes: []string{filepath.Join(dir, "missing", "*.tmpl")}, ProductionParity: true})
+	if len(resp.Diagnostics) != 1 || resp.Diagnostics[0].Severity != "error" {
+		t.Fatalf("expected production parity to escalate the warning, got %+v", resp)
+	}
+}
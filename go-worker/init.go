@@ -0,0 +1,363 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template/parse"
+)
+
+// initConfigFile is the project configuration go-worker init writes at the
+// workspace root. loadProjectConfig reads it like the extension's JSON
+// file.
+const initConfigFile = ".gotemplate.yaml"
+
+// Template dialects init recognizes.
+const (
+	dialectPlain = "plain"
+	dialectHelm  = "helm"
+	dialectHugo  = "hugo"
+)
+
+var (
+	// initSkippedDirs are never scanned: dependencies and build output hold
+	// no templates of the project's own.
+	initSkippedDirs = map[string]bool{"node_modules": true, "vendor": true, "dist": true, "out": true, "third_party": true}
+	// includeDirNames are directory names that conventionally hold
+	// partials.
+	includeDirNames = map[string]bool{"partials": true, "_partials": true, "includes": true, "_includes": true, "components": true, "shared": true}
+	// fixtureDirNames are directory names that conventionally hold context
+	// data.
+	fixtureDirNames = map[string]bool{"context": true, "contexts": true, "fixtures": true, "testdata": true, "examples": true, "data": true}
+	// hugoConfigFiles mark the root of a Hugo site.
+	hugoConfigFiles = []string{"hugo.toml", "hugo.yaml", "hugo.json", "config.toml"}
+)
+
+// initReport is the outcome of the init subcommand: what the scan found and
+// the configuration proposed from it. Paths are relative to Root with
+// forward slashes.
+type initReport struct {
+	Root string `json:"root"`
+	// Dialect is helm, hugo, or plain, and Evidence the files that gave it
+	// away.
+	Dialect        string            `json:"dialect"`
+	Evidence       []string          `json:"evidence"`
+	Templates      int               `json:"templates"`
+	TemplateRoots  []string          `json:"templateRoots"`
+	Includes       []string          `json:"includes"`
+	Fixtures       []string          `json:"fixtures"`
+	DefaultContext map[string]string `json:"defaultContext"`
+	// Config is the configuration file, written unless Written is false
+	// because of --dry-run.
+	Config  string   `json:"config"`
+	Written bool     `json:"written"`
+	Notes   []string `json:"notes,omitempty"`
+}
+
+// runInit is the init subcommand: it audits the workspace under --root and
+// writes a commented .gotemplate.yaml proposing its configuration.
+func runInit(args []string) response {
+	flags := flag.NewFlagSet("init", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	root := flags.String("root", ".", "Workspace root")
+	dryRun := flags.Bool("dry-run", false, "Report the proposed configuration without writing it")
+	force := flags.Bool("force", false, "Replace an existing "+initConfigFile)
+	if err := flags.Parse(args); err != nil {
+		return response{Error: "init: " + err.Error()}
+	}
+
+	report, err := auditWorkspace(*root)
+	if err != nil {
+		return response{Error: "init: " + err.Error()}
+	}
+	configPath := filepath.Join(*root, initConfigFile)
+	report.Config = initConfigFile
+	if *dryRun {
+		return response{Init: report, Rendered: initConfigYAML(report)}
+	}
+	if _, err := os.Stat(configPath); err == nil && !*force {
+		return response{Init: report, Error: fmt.Sprintf("init: %s already exists; pass --force to replace it or --dry-run to only report", configPath)}
+	}
+	if err := os.WriteFile(configPath, []byte(initConfigYAML(report)), 0o644); err != nil {
+		return response{Init: report, Error: "init: " + err.Error()}
+	}
+	report.Written = true
+	return response{Init: report}
+}
+
+// auditWorkspace scans root for templates, partials, and context fixtures.
+func auditWorkspace(root string) (*initReport, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", root)
+	}
+
+	var files []string
+	err = filepath.WalkDir(root, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := entry.Name()
+		if file != root && (strings.HasPrefix(name, ".") || entry.IsDir() && initSkippedDirs[name]) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.Type().IsRegular() {
+			rel, err := filepath.Rel(root, file)
+			if err != nil {
+				return err
+			}
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	report := &initReport{Root: root, Dialect: dialectPlain, Evidence: []string{}, DefaultContext: map[string]string{}}
+	charts := map[string]bool{}
+	sites := map[string]bool{}
+	for _, file := range files {
+		dir, base := path.Dir(file), path.Base(file)
+		switch {
+		case base == "Chart.yaml":
+			charts[dir] = true
+			report.Evidence = append(report.Evidence, file)
+		case containsString(hugoConfigFiles, base) && containsFile(files, path.Join(dir, "layouts")+"/"):
+			sites[dir] = true
+			report.Evidence = append(report.Evidence, file)
+		}
+	}
+	switch {
+	case len(charts) > 0:
+		report.Dialect = dialectHelm
+	case len(sites) > 0:
+		report.Dialect = dialectHugo
+	}
+
+	var templates []string
+	var fixtures []string
+	for _, file := range files {
+		switch {
+		case isInitTemplate(file, charts, sites):
+			templates = append(templates, file)
+		case isInitFixture(file, charts):
+			fixtures = append(fixtures, file)
+		}
+	}
+	report.Templates = len(templates)
+	report.Fixtures = append([]string{}, fixtures...)
+
+	roots := map[string]bool{}
+	includes := map[string]bool{}
+	for _, template := range templates {
+		first := strings.SplitN(template, "/", 2)[0]
+		if !strings.Contains(template, "/") {
+			first = "."
+		}
+		roots[first] = true
+		if pattern, ok := includePattern(root, template); ok {
+			includes[pattern] = true
+		}
+	}
+	report.TemplateRoots = sortedKeys(roots)
+	report.Includes = sortedKeys(includes)
+
+	for _, template := range templates {
+		if fixture, ok := matchFixture(template, fixtures, charts); ok {
+			report.DefaultContext[template] = fixture
+		}
+	}
+
+	if len(templates) == 0 {
+		report.Notes = append(report.Notes, "no templates were found; set templateRoots to where they live")
+	}
+	switch report.Dialect {
+	case dialectHelm:
+		report.Notes = append(report.Notes, "Helm charts use the Sprig functions: render them with --funcs sprig")
+	case dialectHugo:
+		report.Notes = append(report.Notes, "Hugo layouts call Hugo's own functions: stub the ones you use with --stub-functions")
+	}
+	if len(templates) > 0 && len(fixtures) == 0 {
+		report.Notes = append(report.Notes, "no context fixtures were found; context/<template>.json files are matched to templates by name")
+	}
+	return report, nil
+}
+
+// isInitTemplate reports whether file is a template: a .tmpl, .gotmpl, or
+// .tpl file anywhere, a file in a Helm chart's templates directory, or a
+// Hugo layout.
+func isInitTemplate(file string, charts, sites map[string]bool) bool {
+	if _, ok := trimTemplateSuffix(file); ok {
+		return true
+	}
+	for chart := range charts {
+		if strings.HasPrefix(file, path.Join(chart, "templates")+"/") && path.Base(file) != "NOTES.txt" {
+			return true
+		}
+	}
+	for site := range sites {
+		if strings.HasPrefix(file, path.Join(site, "layouts")+"/") && path.Ext(file) == ".html" {
+			return true
+		}
+	}
+	return false
+}
+
+// isInitFixture reports whether file is context data: JSON or YAML in a
+// fixture directory, or a Helm chart's values files.
+func isInitFixture(file string, charts map[string]bool) bool {
+	switch path.Ext(file) {
+	case ".json", ".yaml", ".yml":
+	default:
+		return false
+	}
+	if charts[path.Dir(file)] && strings.HasPrefix(path.Base(file), "values") {
+		return true
+	}
+	for _, dir := range strings.Split(path.Dir(file), "/") {
+		if fixtureDirNames[dir] {
+			return true
+		}
+	}
+	return false
+}
+
+// includePattern proposes an include glob for a template that is a
+// partial: one in a partials directory, named with a leading underscore as
+// Helm's _helpers.tpl is, or holding nothing but define blocks.
+func includePattern(root, template string) (string, bool) {
+	dir, base := path.Split(template)
+	if includeDirNames[path.Base(dir)] {
+		return dir, true
+	}
+	if strings.HasPrefix(base, "_") {
+		return dir + "_*" + path.Ext(base), true
+	}
+	content, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(template)))
+	if err != nil || len(content) > defaultMaxTemplateBytes {
+		return "", false
+	}
+	trees, err := parseTrees(base, string(content))
+	if err != nil || len(trees) < 2 {
+		return "", false
+	}
+	if main, ok := trees[base]; ok && !parse.IsEmptyTree(main.Root) {
+		return "", false
+	}
+	return template, true
+}
+
+// matchFixture finds the context a template previews with: the fixture
+// named like the template, or for a chart template, its chart's
+// values.yaml.
+func matchFixture(template string, fixtures []string, charts map[string]bool) (string, bool) {
+	name := path.Base(template)
+	if trimmed, ok := trimTemplateSuffix(name); ok {
+		name = trimmed
+	}
+	name = strings.TrimSuffix(name, path.Ext(name))
+	for _, fixture := range fixtures {
+		base := path.Base(fixture)
+		if strings.TrimSuffix(base, path.Ext(base)) == name {
+			return fixture, true
+		}
+	}
+	for chart := range charts {
+		if strings.HasPrefix(template, path.Join(chart, "templates")+"/") {
+			values := path.Join(chart, "values.yaml")
+			if containsString(fixtures, values) {
+				return values, true
+			}
+		}
+	}
+	return "", false
+}
+
+// initConfigYAML writes the report as a commented project configuration.
+func initConfigYAML(report *initReport) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Go Template Studio project configuration, proposed by `go-worker init`.\n")
+	fmt.Fprintf(&b, "# Review it, then pass it to the worker with --config %s.\n", initConfigFile)
+	fmt.Fprintf(&b, "#\n# Detected dialect: %s", report.Dialect)
+	if len(report.Evidence) > 0 {
+		fmt.Fprintf(&b, " (%s)", strings.Join(report.Evidence, ", "))
+	}
+	b.WriteString("\n")
+	for _, note := range report.Notes {
+		fmt.Fprintf(&b, "# Note: %s.\n", note)
+	}
+
+	b.WriteString("\n# Directories check-all finds templates under, relative to this file.\n")
+	writeYAMLList(&b, "templateRoots", report.TemplateRoots)
+	b.WriteString("\n# Partials parsed alongside every template, so {{ template \"name\" }} calls\n# resolve. A directory ending in / stands for every file in it.\n")
+	writeYAMLList(&b, "includes", report.Includes)
+
+	b.WriteString("\n# The context each template previews with.\n")
+	if len(report.DefaultContext) == 0 {
+		b.WriteString("defaultContext: {}\n")
+	} else {
+		b.WriteString("defaultContext:\n")
+		for _, template := range sortedKeys(report.DefaultContext) {
+			fmt.Fprintf(&b, "  %s: %s\n", strconv.Quote(template), strconv.Quote(report.DefaultContext[template]))
+		}
+	}
+
+	var unused []string
+	used := map[string]bool{}
+	for _, fixture := range report.DefaultContext {
+		used[fixture] = true
+	}
+	for _, fixture := range report.Fixtures {
+		if !used[fixture] {
+			unused = append(unused, fixture)
+		}
+	}
+	if len(unused) > 0 {
+		b.WriteString("# Other context fixtures found, not matched to a template:\n")
+		for _, fixture := range unused {
+			fmt.Fprintf(&b, "#   %s\n", fixture)
+		}
+	}
+	return b.String()
+}
+
+func writeYAMLList(b *strings.Builder, key string, values []string) {
+	if len(values) == 0 {
+		fmt.Fprintf(b, "%s: []\n", key)
+		return
+	}
+	fmt.Fprintf(b, "%s:\n", key)
+	for _, value := range values {
+		fmt.Fprintf(b, "  - %s\n", strconv.Quote(value))
+	}
+}
+
+func sortedKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// containsFile reports whether any of the sorted files starts with prefix.
+func containsFile(files []string, prefix string) bool {
+	i := sort.SearchStrings(files, prefix)
+	return i < len(files) && strings.HasPrefix(files[i], prefix)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInitProposesHelmChartConfig(t *testing.T) {
+	root := t.TempDir()
+	chart := filepath.Join(root, "charts", "web")
+	writeFile(t, filepath.Join(chart, "Chart.yaml"), "name: web\n")
+	writeFile(t, filepath.Join(chart, "values.yaml"), "replicas: 2\n")
+	writeFile(t, filepath.Join(chart, "templates", "_helpers.tpl"), `{{ define "web.name" }}web{{ end }}`)
+	writeFile(t, filepath.Join(chart, "templates", "deployment.yaml"), `name: {{ include "web.name" . }}`)
+	writeFile(t, filepath.Join(chart, "templates", "NOTES.txt"), "Installed.")
+	writeFile(t, filepath.Join(root, "node_modules", "pkg", "index.tmpl"), "ignored")
+
+	resp := runInit([]string{"--root", root, "--dry-run"})
+	report := resp.Init
+	if resp.Error != "" || report == nil {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	if report.Dialect != dialectHelm || !reflect.DeepEqual(report.Evidence, []string{"charts/web/Chart.yaml"}) || report.Templates != 2 {
+		t.Fatalf("expected one Helm chart with two templates, got %+v", report)
+	}
+	if !reflect.DeepEqual(report.Includes, []string{"charts/web/templates/_*.tpl"}) {
+		t.Fatalf("expected the helpers to be included, got %v", report.Includes)
+	}
+	if report.DefaultContext["charts/web/templates/deployment.yaml"] != "charts/web/values.yaml" {
+		t.Fatalf("expected chart templates to preview with values.yaml, got %v", report.DefaultContext)
+	}
+	if report.Written || !strings.Contains(resp.Rendered, "# Detected dialect: helm (charts/web/Chart.yaml)") || !strings.Contains(resp.Rendered, "--funcs sprig") {
+		t.Fatalf("expected a dry run to only propose a commented config, got %q", resp.Rendered)
+	}
+	if _, err := os.Stat(filepath.Join(root, initConfigFile)); !os.IsNotExist(err) {
+		t.Fatalf("expected a dry run not to write %s, got %v", initConfigFile, err)
+	}
+}
+
+func TestInitWritesLoadableConfig(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "templates", "greet.tmpl"), `{{ template "footer" . }}Hello {{ .name }}`)
+	writeFile(t, filepath.Join(root, "templates", "partials", "footer.tmpl"), `{{ define "footer" }}--{{ end }}`)
+	writeFile(t, filepath.Join(root, "templates", "layout.tmpl"), `{{ define "page" }}<main>{{ end }}{{ define "head" }}<head>{{ end }}`)
+	writeFile(t, filepath.Join(root, "context", "greet.json"), `{"name": "Ada"}`)
+	writeFile(t, filepath.Join(root, "context", "other.yaml"), "name: Grace\n")
+
+	resp := runInit([]string{"--root", root})
+	report := resp.Init
+	if resp.Error != "" || report == nil || !report.Written {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	if report.Dialect != dialectPlain || !reflect.DeepEqual(report.TemplateRoots, []string{"templates"}) {
+		t.Fatalf("unexpected dialect or roots: %+v", report)
+	}
+	if !reflect.DeepEqual(report.Includes, []string{"templates/layout.tmpl", "templates/partials/"}) {
+		t.Fatalf("expected the partials directory and the define-only layout, got %v", report.Includes)
+	}
+
+	config, err := loadProjectConfig(filepath.Join(root, initConfigFile))
+	if err != nil {
+		t.Fatalf("expected the written config to load: %v", err)
+	}
+	if config.DefaultContext["templates/greet.tmpl"] != "context/greet.json" || !reflect.DeepEqual(config.TemplateRoots, []string{"templates"}) {
+		t.Fatalf("unexpected config: %+v", config)
+	}
+	if want := filepath.Join(root, "templates", "partials", "*"); !containsString(config.Includes, want) {
+		t.Fatalf("expected includes to resolve against the root, got %v", config.Includes)
+	}
+	written, _ := os.ReadFile(filepath.Join(root, initConfigFile))
+	if !strings.Contains(string(written), "#   context/other.yaml") {
+		t.Fatalf("expected unmatched fixtures to be listed, got %s", written)
+	}
+
+	out := run(filepath.Join(root, "templates", "greet.tmpl"), filepath.Join(root, "context", "greet.json"), renderOptions{Config: filepath.Join(root, initConfigFile)})
+	if out.Error != "" || out.Rendered != "--Hello Ada" {
+		t.Fatalf("expected the config's includes to resolve the footer, got %+v", out)
+	}
+
+	if resp := runInit([]string{"--root", root}); resp.Error == "" || !strings.Contains(resp.Error, "--force") {
+		t.Fatalf("expected init to refuse to replace the config, got %+v", resp)
+	}
+	if resp := runInit([]string{"--root", root, "--force"}); resp.Error != "" || !resp.Init.Written {
+		t.Fatalf("expected --force to replace the config, got %+v", resp)
+	}
+}
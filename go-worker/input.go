@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"unicode/utf8"
+)
+
+const (
+	// defaultMaxTemplateBytes is the largest template the worker reads
+	// when --max-template-bytes is not set. Real templates are a few
+	// kilobytes; anything this large is almost always the wrong file.
+	defaultMaxTemplateBytes = 4 << 20
+	// binarySniffBytes is how much of a template is inspected for binary
+	// content, as git does.
+	binarySniffBytes = 8000
+	// unsupportedInputRule marks the diagnostic of a template the worker
+	// refused to read.
+	unsupportedInputRule = "unsupported-input"
+	// unsupportedInputMarker is in the message of every
+	// unsupportedInputError, so a refused template fetched by a mode still
+	// gets the unsupported-input error code.
+	unsupportedInputMarker = " is not a template: "
+)
+
+// unsupportedInputError is a template refused before parsing because it is
+// too large or looks binary.
+type unsupportedInputError struct {
+	location string
+	reason   string
+}
+
+func (e *unsupportedInputError) Error() string {
+	return e.location + unsupportedInputMarker + e.reason
+}
+
+func validateMaxTemplateBytes(opts renderOptions) error {
+	if opts.MaxTemplateBytes < 0 {
+		return fmt.Errorf("max template bytes must not be negative, got %d", opts.MaxTemplateBytes)
+	}
+	return nil
+}
+
+func maxTemplateBytes(opts renderOptions) int {
+	if opts.MaxTemplateBytes > 0 {
+		return opts.MaxTemplateBytes
+	}
+	return defaultMaxTemplateBytes
+}
+
+// guardTemplateInput refuses a local template that is too large or binary
+// before any mode reads it whole, with a response clients can recognize by
+// its unsupported-input code and rule. Missing files and unsaved editor
+// text are left to the mode.
+func guardTemplateInput(templatePath string, opts renderOptions) (response, bool) {
+	if templatePath == "" || opts.Source != "" || opts.AtRef != "" || isRemoteURL(templatePath) || isObjectStoreURL(templatePath) {
+		return response{}, true
+	}
+	info, err := os.Stat(templatePath)
+	if err != nil || !info.Mode().IsRegular() {
+		return response{}, true
+	}
+	problem := checkTemplateSize(templatePath, info.Size(), opts)
+	if problem == nil {
+		file, err := os.Open(templatePath)
+		if err != nil {
+			return response{}, true
+		}
+		sample := make([]byte, binarySniffBytes)
+		n, _ := io.ReadFull(file, sample)
+		file.Close()
+		problem = checkTemplateContent(templatePath, sample[:n], int64(n) < info.Size())
+	}
+	if problem == nil {
+		return response{}, true
+	}
+	return response{
+		Diagnostics: []diagnostic{{Message: problem.Error(), Severity: "error", Rule: unsupportedInputRule, File: templatePath}},
+		Error:       problem.Error(),
+		errorCode:   errorCodeUnsupportedInput,
+	}, false
+}
+
+func checkTemplateSize(location string, size int64, opts renderOptions) error {
+	if limit := maxTemplateBytes(opts); size > int64(limit) {
+		return &unsupportedInputError{location: location, reason: fmt.Sprintf("it is %s, over the %s limit of --max-template-bytes", formatBytes(size), formatBytes(int64(limit)))}
+	}
+	return nil
+}
+
+// checkTemplateContent reports content that looks binary: a NUL byte or
+// invalid UTF-8 in its first binarySniffBytes. truncated says content is
+// a prefix, whose last rune may be cut short.
+func checkTemplateContent(location string, content []byte, truncated bool) error {
+	sample := content
+	if len(sample) > binarySniffBytes {
+		sample, truncated = sample[:binarySniffBytes], true
+	}
+	if truncated {
+		// Drop a rune the cut split in two.
+		for i := 0; i < utf8.UTFMax && len(sample) > 0 && !utf8.Valid(sample); i++ {
+			sample = sample[:len(sample)-1]
+		}
+	}
+	switch {
+	case bytes.IndexByte(sample, 0) >= 0:
+		return &unsupportedInputError{location: location, reason: "it contains NUL bytes, so it looks like a binary file (or a UTF-16 text file; templates must be UTF-8)"}
+	case !utf8.Valid(sample):
+		return &unsupportedInputError{location: location, reason: "it is not valid UTF-8, so it looks like a binary file"}
+	}
+	return nil
+}
+
+// formatBytes renders a byte count for messages, e.g. 4 MiB or 512 B.
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
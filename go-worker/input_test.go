@@ -0,0 +1,63 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBinaryAndOversizedTemplatesAreUnsupportedInput(t *testing.T) {
+	dir := t.TempDir()
+	imagePath := filepath.Join(dir, "logo.png")
+	writeFile(t, imagePath, "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+	resp := run(imagePath, "", renderOptions{})
+	if !strings.Contains(resp.Error, "logo.png is not a template") || len(resp.Diagnostics) != 1 || resp.Diagnostics[0].Rule != unsupportedInputRule {
+		t.Fatalf("expected the binary file to be refused, got %+v", resp)
+	}
+	if v2 := responseV2Of(resp); v2.Error == nil || v2.Error.Code != errorCodeUnsupportedInput {
+		t.Fatalf("expected the unsupported-input code, got %+v", v2.Error)
+	}
+	if resp := run(imagePath, "", renderOptions{Mode: "check"}); resp.Diagnostics[0].Rule != unsupportedInputRule {
+		t.Fatalf("expected every mode to refuse the binary file, got %+v", resp)
+	}
+
+	templatePath := filepath.Join(dir, "page.tmpl")
+	writeFile(t, templatePath, strings.Repeat("héllo ", 100))
+	resp = run(templatePath, "", renderOptions{MaxTemplateBytes: 100})
+	if !strings.Contains(resp.Error, "it is 700 B, over the 100 B limit") || errorCode(resp) != errorCodeUnsupportedInput {
+		t.Fatalf("expected the large template to be refused, got %+v", resp)
+	}
+	if resp := run(templatePath, "", renderOptions{}); resp.Error != "" {
+		t.Fatalf("expected the default limit to allow the template, got %+v", resp)
+	}
+	if resp := run(templatePath, "", renderOptions{MaxTemplateBytes: -1}); resp.Error == "" {
+		t.Fatal("expected a negative limit to be rejected")
+	}
+}
+
+func TestBinaryIncludeIsSkippedWithAWarning(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "page.tmpl")
+	writeFile(t, templatePath, `{{ template "header" }}body`)
+	writeFile(t, filepath.Join(dir, "partials", "header.tmpl"), `{{ define "header" }}head {{ end }}`)
+	writeFile(t, filepath.Join(dir, "partials", "icon.ico"), "\x00\x00\x01\x00")
+
+	resp := run(templatePath, "", renderOptions{Includes: []string{filepath.Join(dir, "partials", "*")}})
+	if resp.Error != "" || resp.Rendered != "head body" {
+		t.Fatalf("expected the render to skip the binary include, got %+v", resp)
+	}
+	if len(resp.Diagnostics) != 1 || resp.Diagnostics[0].Rule != unreadableIncludeRule || !strings.Contains(resp.Diagnostics[0].Message, "icon.ico is not a template") {
+		t.Fatalf("expected a warning for the binary include, got %+v", resp.Diagnostics)
+	}
+}
+
+func TestTemplateContentAllowsARuneCutBySniffing(t *testing.T) {
+	content := []byte(strings.Repeat("é", binarySniffBytes))
+	if err := checkTemplateContent("page.tmpl", content[:binarySniffBytes+1], true); err != nil {
+		t.Fatalf("expected UTF-8 cut mid-rune to pass, got %v", err)
+	}
+	if err := checkTemplateContent("page.tmpl", []byte("ok \xff\xfe"), false); err == nil {
+		t.Fatal("expected invalid UTF-8 to be refused")
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// jsonPatchOp is one RFC 6902 operation. Value is raw JSON so that a null
+// value is still written out.
+type jsonPatchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// executeJSONPatch renders a template that produces JSON and returns the
+// RFC 6902 patch turning the --base document into the rendered one.
+func executeJSONPatch(templatePath, contextPath string, opts renderOptions) response {
+	if strings.TrimSpace(opts.Base) == "" {
+		return response{Error: "json-patch mode requires --base"}
+	}
+	baseBytes, err := os.ReadFile(opts.Base)
+	if err != nil {
+		return response{Error: err.Error()}
+	}
+	var base interface{}
+	if err := json.Unmarshal(baseBytes, &base); err != nil {
+		message := fmt.Sprintf("base %s is not valid JSON: %v", opts.Base, err)
+		return response{Diagnostics: []diagnostic{{Message: message, Severity: "error", File: opts.Base}}, Error: message}
+	}
+
+	resp := executeWithOptions(templatePath, contextPath, opts)
+	if resp.Error != "" {
+		return resp
+	}
+
+	var rendered interface{}
+	if err := json.Unmarshal([]byte(resp.Rendered), &rendered); err != nil {
+		message := fmt.Sprintf("rendered output is not valid JSON: %v", err)
+		resp.Diagnostics = append(resp.Diagnostics, diagnostic{Message: message, Severity: "error", File: templatePath})
+		resp.Error = message
+		return resp
+	}
+
+	resp.Patch = diffJSON("", base, rendered, nil)
+	return resp
+}
+
+// diffJSON appends the operations that turn from into to at path. Objects
+// are compared key by key and arrays index by index; anything else that
+// differs is replaced whole.
+func diffJSON(path string, from, to interface{}, ops []jsonPatchOp) []jsonPatchOp {
+	switch fromTyped := from.(type) {
+	case map[string]interface{}:
+		toTyped, ok := to.(map[string]interface{})
+		if !ok {
+			break
+		}
+		for _, key := range sortedJSONKeys(fromTyped) {
+			if _, kept := toTyped[key]; !kept {
+				ops = append(ops, jsonPatchOp{Op: "remove", Path: path + "/" + escapeJSONPointer(key)})
+			}
+		}
+		for _, key := range sortedJSONKeys(toTyped) {
+			child := path + "/" + escapeJSONPointer(key)
+			if old, existed := fromTyped[key]; existed {
+				ops = diffJSON(child, old, toTyped[key], ops)
+			} else {
+				ops = append(ops, patchValue("add", child, toTyped[key]))
+			}
+		}
+		return ops
+	case []interface{}:
+		toTyped, ok := to.([]interface{})
+		if !ok {
+			break
+		}
+		common := len(fromTyped)
+		if len(toTyped) < common {
+			common = len(toTyped)
+		}
+		for i := 0; i < common; i++ {
+			ops = diffJSON(path+"/"+strconv.Itoa(i), fromTyped[i], toTyped[i], ops)
+		}
+		// Remove from the end so earlier indexes stay valid.
+		for i := len(fromTyped) - 1; i >= common; i-- {
+			ops = append(ops, jsonPatchOp{Op: "remove", Path: path + "/" + strconv.Itoa(i)})
+		}
+		for i := common; i < len(toTyped); i++ {
+			ops = append(ops, patchValue("add", path+"/"+strconv.Itoa(i), toTyped[i]))
+		}
+		return ops
+	}
+
+	if !reflect.DeepEqual(from, to) {
+		ops = append(ops, patchValue("replace", path, to))
+	}
+	return ops
+}
+
+func patchValue(op, path string, value interface{}) jsonPatchOp {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		encoded = []byte("null")
+	}
+	return jsonPatchOp{Op: op, Path: path, Value: encoded}
+}
+
+func sortedJSONKeys(object map[string]interface{}) []string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// escapeJSONPointer escapes a key for use as an RFC 6901 reference token.
+func escapeJSONPointer(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+)
+
+func TestJSONPatchDescribesRenderedChanges(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "overlay.json.tmpl")
+	contextPath := filepath.Join(dir, "context.json")
+	basePath := filepath.Join(dir, "base.json")
+	writeFile(t, basePath, `{"replicas":1,"image":"web:1","ports":[80,443,8080],"labels":{"tier":"web","a/b":"x"},"debug":true}`)
+	writeFile(t, contextPath, `{"replicas":3}`)
+	writeFile(t, templatePath, `{"replicas":{{ .replicas }},"image":"web:1","ports":[80,8443],"labels":{"tier":"web","owner":null},"debug":true}`)
+
+	resp := run(templatePath, contextPath, renderOptions{Mode: "json-patch", Base: basePath})
+	if resp.Error != "" {
+		t.Fatalf("unexpected error: %+v", resp)
+	}
+	got, err := json.Marshal(resp.Patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"op":"remove","path":"/labels/a~1b"},{"op":"add","path":"/labels/owner","value":null},{"op":"replace","path":"/ports/1","value":8443},{"op":"remove","path":"/ports/2"},{"op":"replace","path":"/replicas","value":3}]`
+	if string(got) != want {
+		t.Fatalf("unexpected patch:\n got %s\nwant %s", got, want)
+	}
+
+	same := filepath.Join(dir, "same.json.tmpl")
+	writeFile(t, same, `{"replicas":1,"image":"web:1","ports":[80,443,8080],"labels":{"tier":"web","a/b":"x"},"debug":true}`)
+	if resp := run(same, "", renderOptions{Mode: "json-patch", Base: basePath}); resp.Error != "" || resp.Patch != nil {
+		t.Fatalf("expected an empty patch, got %+v", resp)
+	}
+}
+
+func TestJSONPatchRejectsNonJSONOutput(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "broken.tmpl")
+	basePath := filepath.Join(dir, "base.json")
+	writeFile(t, basePath, `{}`)
+	writeFile(t, templatePath, `{"a": {{ "x" }}}`)
+
+	resp := run(templatePath, "", renderOptions{Mode: "json-patch", Base: basePath})
+	if resp.Error == "" || resp.Rendered != `{"a": x}` || len(resp.Diagnostics) != 1 {
+		t.Fatalf("expected invalid JSON error, got %+v", resp)
+	}
+	if resp := run(templatePath, "", renderOptions{Mode: "json-patch"}); resp.Error != "json-patch mode requires --base" {
+		t.Fatalf("expected missing base error, got %+v", resp)
+	}
+}
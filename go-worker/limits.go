@@ -0,0 +1,214 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/template/parse"
+	"time"
+)
+
+// loopGuardFunc is the hidden helper instrumented range bodies call once per
+// iteration. Its name cannot collide with a template's own identifiers
+// because the parser would reject it in source.
+const loopGuardFunc = "__goTemplateStudioLoopGuard"
+
+// errRenderCancelled aborts a render whose server request was cancelled.
+var errRenderCancelled = errors.New("render cancelled")
+
+// limitError reports that a render was aborted by one of its limits rather
+// than failing on its own.
+type limitError struct {
+	message string
+}
+
+func (e *limitError) Error() string {
+	return e.message
+}
+
+// validateLimits rejects limits that cannot be applied.
+func validateLimits(opts renderOptions) error {
+	if strings.TrimSpace(opts.Timeout) != "" {
+		timeout, err := time.ParseDuration(opts.Timeout)
+		if err != nil {
+			return fmt.Errorf("invalid timeout %q (expected a duration such as 2s or 500ms)", opts.Timeout)
+		}
+		if timeout < 0 {
+			return fmt.Errorf("timeout must not be negative, got %s", opts.Timeout)
+		}
+	}
+	if opts.MaxOutputBytes < 0 {
+		return fmt.Errorf("max output bytes must not be negative, got %d", opts.MaxOutputBytes)
+	}
+	if opts.MaxIterations < 0 {
+		return fmt.Errorf("max iterations must not be negative, got %d", opts.MaxIterations)
+	}
+	return nil
+}
+
+// renderBudget enforces the limits of one execution. Go templates cannot be
+// interrupted, so the budget is checked whenever the template writes output
+// or starts a range iteration, and execution aborts with a limitError at the
+// first check past a limit.
+type renderBudget struct {
+	timeout       time.Duration
+	deadline      time.Time
+	maxOutput     int
+	maxIterations int
+	// cancelled closes when the server request is cancelled.
+	cancelled <-chan struct{}
+
+	out        io.Writer
+	written    int
+	iterations int
+	// abandoned is set when run returned before the execution did, which
+	// may still write to out until its next check.
+	abandoned bool
+}
+
+// newRenderBudget returns nil when opts sets no limits and the render cannot
+// be cancelled, so unlimited renders run exactly as before.
+func newRenderBudget(opts renderOptions) *renderBudget {
+	timeout, _ := time.ParseDuration(strings.TrimSpace(opts.Timeout))
+	if timeout <= 0 && opts.MaxOutputBytes <= 0 && opts.MaxIterations <= 0 && opts.ctx == nil {
+		return nil
+	}
+	budget := &renderBudget{timeout: timeout, maxOutput: opts.MaxOutputBytes, maxIterations: opts.MaxIterations}
+	if opts.ctx != nil {
+		budget.cancelled = opts.ctx.Done()
+	}
+	return budget
+}
+
+func (b *renderBudget) timeoutError() error {
+	return &limitError{message: fmt.Sprintf("render exceeded %s limit", b.timeout)}
+}
+
+// checkStop reports a cancelled request or a passed deadline.
+func (b *renderBudget) checkStop() error {
+	select {
+	case <-b.cancelled:
+		return errRenderCancelled
+	default:
+	}
+	if b.timeout > 0 && time.Now().After(b.deadline) {
+		return b.timeoutError()
+	}
+	return nil
+}
+
+// Write passes output through until the output limit or deadline is
+// reached, or the request is cancelled.
+func (b *renderBudget) Write(p []byte) (int, error) {
+	if err := b.checkStop(); err != nil {
+		return 0, err
+	}
+	if b.maxOutput > 0 && b.written+len(p) > b.maxOutput {
+		return 0, &limitError{message: fmt.Sprintf("render exceeded %d byte output limit", b.maxOutput)}
+	}
+	b.written += len(p)
+	return b.out.Write(p)
+}
+
+// iterate is registered as loopGuardFunc.
+func (b *renderBudget) iterate() (string, error) {
+	b.iterations++
+	if b.maxIterations > 0 && b.iterations > b.maxIterations {
+		return "", &limitError{message: fmt.Sprintf("render exceeded %d iteration limit", b.maxIterations)}
+	}
+	return "", b.checkStop()
+}
+
+// run executes into out under the budget. When a timeout is set or the
+// render can be cancelled, execution happens on its own goroutine so a
+// single slow function call cannot hold the worker past the deadline or
+// the cancellation; the abandoned execution stops at its next check.
+func (b *renderBudget) run(out io.Writer, execute func(io.Writer) error) error {
+	b.out = out
+	if b.timeout <= 0 && b.cancelled == nil {
+		return b.unwrap(execute(b))
+	}
+
+	var expired <-chan time.Time
+	if b.timeout > 0 {
+		b.deadline = time.Now().Add(b.timeout)
+		timer := time.NewTimer(b.timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	done := make(chan error, 1)
+	go func() { done <- execute(b) }()
+
+	select {
+	case err := <-done:
+		return b.unwrap(err)
+	case <-expired:
+		b.abandoned = true
+		return b.timeoutError()
+	case <-b.cancelled:
+		b.abandoned = true
+		return errRenderCancelled
+	}
+}
+
+// unwrap surfaces a limitError however text/template wrapped it. Errors
+// raised by the loop guard keep the template position of the range.
+func (b *renderBudget) unwrap(err error) error {
+	var limit *limitError
+	if err == nil || !errors.As(err, &limit) {
+		return err
+	}
+	if location := templateErrorPattern.FindString(err.Error()); location != "" {
+		return &limitError{message: location + " " + limit.message}
+	}
+	return limit
+}
+
+// instrumentLoops prepends a call to loopGuardFunc to the body of every
+// range in tree. The call is a variable declaration, so it writes nothing
+// and html/template leaves it unescaped.
+func instrumentLoops(tree *parse.Tree) {
+	if tree == nil {
+		return
+	}
+	instrumentList(tree, tree.Root)
+}
+
+func instrumentList(tree *parse.Tree, list *parse.ListNode) {
+	if list == nil {
+		return
+	}
+	for _, node := range list.Nodes {
+		switch typed := node.(type) {
+		case *parse.IfNode:
+			instrumentList(tree, typed.List)
+			instrumentList(tree, typed.ElseList)
+		case *parse.WithNode:
+			instrumentList(tree, typed.List)
+			instrumentList(tree, typed.ElseList)
+		case *parse.RangeNode:
+			instrumentList(tree, typed.List)
+			instrumentList(tree, typed.ElseList)
+			if typed.List != nil {
+				typed.List.Nodes = append([]parse.Node{loopGuard(tree, typed.Position(), typed.Line)}, typed.List.Nodes...)
+			}
+		}
+	}
+}
+
+func loopGuard(tree *parse.Tree, pos parse.Pos, line int) *parse.ActionNode {
+	ident := parse.NewIdentifier(loopGuardFunc).SetTree(tree).SetPos(pos)
+	return &parse.ActionNode{
+		NodeType: parse.NodeAction,
+		Pos:      pos,
+		Line:     line,
+		Pipe: &parse.PipeNode{
+			NodeType: parse.NodePipe,
+			Pos:      pos,
+			Line:     line,
+			Decl:     []*parse.VariableNode{{NodeType: parse.NodeVariable, Pos: pos, Ident: []string{"$" + loopGuardFunc}}},
+			Cmds:     []*parse.CommandNode{{NodeType: parse.NodeCommand, Pos: pos, Args: []parse.Node{ident}}},
+		},
+	}
+}
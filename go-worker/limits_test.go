@@ -0,0 +1,66 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderLimitsAbortRunawayTemplates(t *testing.T) {
+	dir := t.TempDir()
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, contextPath, `{"items":[`+strings.Repeat("1,", 999)+`1]}`)
+
+	loops := filepath.Join(dir, "loops.tmpl")
+	writeFile(t, loops, "before\n{{range .items}}{{range $.items}}{{range $.items}}{{end}}{{end}}{{end}}")
+
+	start := time.Now()
+	resp := run(loops, contextPath, renderOptions{Timeout: "50ms"})
+	if !strings.HasSuffix(resp.Error, "render exceeded 50ms limit") || resp.errorCode != errorCodeLimit {
+		t.Fatalf("expected timeout, got %+v", resp)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("timeout took %s", elapsed)
+	}
+
+	resp = run(loops, contextPath, renderOptions{MaxIterations: 2})
+	if resp.Error != "template: loops.tmpl:2:41: render exceeded 2 iteration limit" {
+		t.Fatalf("expected iteration limit, got %+v", resp)
+	}
+	if diag := resp.Diagnostics[0]; diag.Line != 2 || diag.Column != 42 {
+		t.Fatalf("expected diagnostic at the innermost range, got %+v", diag)
+	}
+
+	output := filepath.Join(dir, "output.html")
+	writeFile(t, output, `{{range .items}}<b>{{.}}</b>{{end}}`)
+	resp = run(output, contextPath, renderOptions{MaxOutputBytes: 64})
+	if resp.Error != "render exceeded 64 byte output limit" {
+		t.Fatalf("expected output limit, got %+v", resp)
+	}
+}
+
+func TestRenderLimitsLeaveOutputUnchanged(t *testing.T) {
+	dir := t.TempDir()
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, contextPath, `{"items":["a","b"]}`)
+
+	for _, name := range []string{"list.tmpl", "list.html"} {
+		templatePath := filepath.Join(dir, name)
+		writeFile(t, templatePath, `<script>var xs = [{{range $i, $x := .items}}{{if $i}},{{end}}{{$x}}{{end}}];</script>`)
+
+		plain := run(templatePath, contextPath, renderOptions{})
+		limited := run(templatePath, contextPath, renderOptions{Timeout: "5s", MaxOutputBytes: 1000, MaxIterations: 10})
+		if plain.Error != "" || limited.Error != "" || limited.Rendered != plain.Rendered {
+			t.Fatalf("%s: limits changed the output: %+v vs %+v", name, plain, limited)
+		}
+	}
+}
+
+func TestValidateLimits(t *testing.T) {
+	for _, opts := range []renderOptions{{Timeout: "soon"}, {Timeout: "-1s"}, {MaxOutputBytes: -1}, {MaxIterations: -1}} {
+		if err := validateLimits(opts); err == nil {
+			t.Fatalf("expected %+v to be rejected", opts)
+		}
+	}
+}
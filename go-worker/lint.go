@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/template/parse"
+)
+
+// Built-in lint rules check mode runs on every template that parses. Like
+// every finding with a rule id, their severity can be changed or turned
+// off with the project config's lintRules.
+const (
+	unusedVariableRule  = "unused-variable"
+	shadowedDotRule     = "shadowed-dot"
+	unreachableElseRule = "unreachable-else"
+)
+
+// lintRuleSeverities are the values lintRules accepts.
+var lintRuleSeverities = []string{"error", "warning", "off"}
+
+// lintDiagnostics runs the built-in lint rules over every template content
+// defines, and the HTML risk rules of htmlrisk.go over HTML templates.
+func lintDiagnostics(templatePath, content string, opts renderOptions) []diagnostic {
+	name := templateName(templatePath)
+	trees, err := parseTreesWithDelims(name, content, opts.LeftDelim, opts.RightDelim)
+	if err != nil {
+		return nil
+	}
+	linter := templateLinter{
+		templatePath: templatePath,
+		content:      content,
+		actions:      scanActions(content, opts.LeftDelim, opts.RightDelim),
+		html:         usesHTMLEngine(templatePath, opts),
+	}
+	for _, treeName := range sortedTreeNames(trees, name) {
+		tree := trees[treeName]
+		linter.unusedVariables(tree)
+		linter.list(tree.Root, nil)
+	}
+	if linter.html {
+		linter.htmlRisks(trees, name)
+	}
+	sortDiagnostics(linter.diagnostics)
+	return linter.diagnostics
+}
+
+// sortDiagnostics orders diagnostics of one file by position.
+func sortDiagnostics(diagnostics []diagnostic) {
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		if diagnostics[i].Line != diagnostics[j].Line {
+			return diagnostics[i].Line < diagnostics[j].Line
+		}
+		return diagnostics[i].Column < diagnostics[j].Column
+	})
+}
+
+type templateLinter struct {
+	templatePath string
+	content      string
+	actions      []actionSpan
+	html         bool
+	diagnostics  []diagnostic
+}
+
+func (l *templateLinter) report(rule string, pos parse.Pos, width int, message string) {
+	line, column := lineColumn(l.content, pos)
+	diag := diagnostic{Message: message, Severity: "warning", Rule: rule, File: l.templatePath, Line: line, Column: column}
+	if width > 0 {
+		diag.EndColumn = column + width
+	}
+	l.diagnostics = append(l.diagnostics, diag)
+}
+
+// unusedVariables reports declarations nothing reads or assigns. The
+// element of a two-variable range is needed to declare the index, and
+// names starting with $_ mark a variable as unused on purpose.
+func (l *templateLinter) unusedVariables(tree *parse.Tree) {
+	required := map[parse.Pos]bool{}
+	walkNodes(tree.Root, func(node parse.Node) bool {
+		if rangeNode, ok := node.(*parse.RangeNode); ok && len(rangeNode.Pipe.Decl) == 2 {
+			required[rangeNode.Pipe.Decl[1].Pos] = true
+		}
+		return true
+	})
+	for _, group := range variableGroups(tree) {
+		declaration := group[0]
+		if len(group) > 1 || !declaration.Declaration || required[declaration.Pos] || strings.HasPrefix(declaration.Name, "$_") {
+			continue
+		}
+		l.report(unusedVariableRule, declaration.Pos, len(declaration.Name),
+			fmt.Sprintf("%s is declared but never used", declaration.Name))
+	}
+}
+
+// list walks the nodes of a template body. outer is the innermost range
+// around it, if any.
+func (l *templateLinter) list(list *parse.ListNode, outer *parse.RangeNode) {
+	if list == nil {
+		return
+	}
+	for _, node := range list.Nodes {
+		switch typed := node.(type) {
+		case *parse.IfNode:
+			l.branch(&typed.BranchNode, outer)
+		case *parse.WithNode:
+			l.branch(&typed.BranchNode, outer)
+		case *parse.RangeNode:
+			if outer != nil && len(outer.Pipe.Decl) == 0 && usesDot(typed.List) {
+				pos := typed.Position()
+				if action, ok := enclosingAction(l.actions, pos); ok {
+					pos = parse.Pos(action.Start)
+				}
+				l.report(shadowedDotRule, pos, 0,
+					"dot is this range's element here, and the outer range's element cannot be reached; declare it with {{ range $item := ... }} on the outer range")
+			}
+			l.list(typed.List, typed)
+			l.list(typed.ElseList, outer)
+		}
+	}
+}
+
+func (l *templateLinter) branch(branch *parse.BranchNode, outer *parse.RangeNode) {
+	if branch.ElseList != nil && constantTruth(branch.Pipe) {
+		if pos, ok := l.elseBefore(branch.ElseList.Position()); ok {
+			l.report(unreachableElseRule, pos, 0, "the condition is always true, so the else branch never runs")
+		}
+	}
+	l.list(branch.List, outer)
+	l.list(branch.ElseList, outer)
+}
+
+// elseBefore finds the {{ else }} that opens an else branch starting at
+// pos: the last else action that starts before it.
+func (l *templateLinter) elseBefore(pos parse.Pos) (parse.Pos, bool) {
+	found, ok := parse.Pos(0), false
+	for _, action := range l.actions {
+		if action.Start >= int(pos) {
+			break
+		}
+		if action.Keyword() == "else" {
+			found, ok = parse.Pos(action.Start), true
+		}
+	}
+	return found, ok
+}
+
+// constantTruth reports whether pipe is a single literal that is always
+// true.
+func constantTruth(pipe *parse.PipeNode) bool {
+	if pipe == nil || len(pipe.Decl) > 0 || len(pipe.Cmds) != 1 || len(pipe.Cmds[0].Args) != 1 {
+		return false
+	}
+	switch literal := pipe.Cmds[0].Args[0].(type) {
+	case *parse.BoolNode:
+		return literal.True
+	case *parse.StringNode:
+		return literal.Text != ""
+	case *parse.NumberNode:
+		return literal.Text != "0" && literal.Text != "0.0"
+	}
+	return false
+}
+
+// usesDot reports whether list reads dot or a field of it.
+func usesDot(list *parse.ListNode) bool {
+	found := false
+	walkNodes(list, func(node parse.Node) bool {
+		switch node.(type) {
+		case *parse.DotNode, *parse.FieldNode:
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// applyLintRules sets the severity of every diagnostic whose rule the
+// project config's lintRules names, and drops those turned off.
+func applyLintRules(diagnostics []diagnostic, opts renderOptions) []diagnostic {
+	if opts.project == nil || len(opts.project.LintRules) == 0 {
+		return diagnostics
+	}
+	kept := diagnostics[:0]
+	for _, diag := range diagnostics {
+		severity, ok := opts.project.LintRules[diag.Rule]
+		switch {
+		case diag.Rule == "" || !ok:
+		case severity == "off":
+			continue
+		default:
+			diag.Severity = severity
+		}
+		kept = append(kept, diag)
+	}
+	return kept
+}
+
+func validateLintRules(rules map[string]string) error {
+	for rule, severity := range rules {
+		if !containsString(lintRuleSeverities, severity) {
+			return fmt.Errorf("lint rule %q has unknown severity %q: use %s", rule, severity, strings.Join(lintRuleSeverities, ", "))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLintRulesReportTheirFindings(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "page.html")
+	writeFile(t, templatePath, `{{ $unused := .a }}{{ $_skip := .b }}{{ range $i, $v := .items }}{{ $i }}{{ end }}
+{{ range .groups }}{{ range .items }}{{ .name }}{{ end }}{{ end }}
+{{ range $group := .groups }}{{ range .items }}{{ $group.title }}{{ .name }}{{ end }}{{ end }}
+{{ if true }}yes{{ else }}no{{ end }}
+{{ .bio | safe }}{{ safe "<br>" }}{{ safe (printf "%s" $.bio) }}`)
+
+	resp := run(templatePath, "", renderOptions{Mode: "check"})
+	var got []string
+	for _, diag := range resp.Diagnostics {
+		got = append(got, fmt.Sprintf("%s@%d:%d", diag.Rule, diag.Line, diag.Column))
+	}
+	want := "unused-variable@1:4 shadowed-dot@2:20 unreachable-else@4:17 safe-user-data@5:11 safe-user-data@5:38"
+	if strings.Join(got, " ") != want {
+		t.Fatalf("unexpected findings: %v\n%+v", got, resp.Diagnostics)
+	}
+
+	textPath := filepath.Join(dir, "page.tmpl")
+	writeFile(t, textPath, `{{ .bio | safe }}`)
+	if resp := run(textPath, "", renderOptions{Mode: "check"}); len(resp.Diagnostics) != 0 {
+		t.Fatalf("expected safe to be fine in text templates, got %+v", resp.Diagnostics)
+	}
+}
+
+func TestLintRulesSeveritiesComeFromTheProjectConfig(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "page.tmpl")
+	writeFile(t, templatePath, "{{ $unused := .a }}{{ if 1 }}a{{ else }}b{{ end }}")
+	configPath := filepath.Join(dir, ".vscode", "goTemplateStudio.json")
+	writeFile(t, configPath, `{"lintRules": {"unused-variable": "error", "unreachable-else": "off"}}`)
+
+	resp := run(templatePath, "", renderOptions{Mode: "check", Config: configPath})
+	if len(resp.Diagnostics) != 1 || resp.Diagnostics[0].Rule != unusedVariableRule || resp.Diagnostics[0].Severity != "error" {
+		t.Fatalf("expected only an unused-variable error, got %+v", resp.Diagnostics)
+	}
+
+	writeFile(t, configPath, `{"lintRules": {"unused-variable": "fatal"}}`)
+	if resp := run(templatePath, "", renderOptions{Mode: "check", Config: configPath}); !strings.Contains(resp.Error, `unknown severity "fatal"`) {
+		t.Fatalf("expected an unknown severity to be rejected, got %+v", resp)
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	// lintPluginProtocolVersion is sent with every request so plugins can
+	// reject a protocol they do not understand.
+	lintPluginProtocolVersion = 1
+	lintPluginTimeout         = 10 * time.Second
+)
+
+// lintPluginRequest is the JSON document a lint plugin reads on stdin: the
+// template's source and parse tree, and the context schema inferred from
+// the fields it reads.
+type lintPluginRequest struct {
+	Version  int           `json:"version"`
+	Template string        `json:"template"`
+	Source   string        `json:"source"`
+	AST      []astTemplate `json:"ast"`
+	Schema   *schemaNode   `json:"schema"`
+	Fields   []fieldUsage  `json:"fields,omitempty"`
+}
+
+// lintPluginResponse is what a plugin writes to stdout.
+type lintPluginResponse struct {
+	Diagnostics []lintPluginDiagnostic `json:"diagnostics"`
+}
+
+// lintPluginDiagnostic is one finding. Severity defaults to warning, and
+// positions are 1-based lines and byte columns of the template.
+type lintPluginDiagnostic struct {
+	Rule      string `json:"rule"`
+	Message   string `json:"message"`
+	Severity  string `json:"severity,omitempty"`
+	Line      int    `json:"line,omitempty"`
+	Column    int    `json:"column,omitempty"`
+	EndColumn int    `json:"endColumn,omitempty"`
+}
+
+// lintPluginCommands returns the plugins check mode runs. Plugins run
+// programs, so like helper plugins they only come from --lint-plugin, never
+// from the project config or a server request.
+func lintPluginCommands(opts renderOptions) []string {
+	return opts.LintPlugins
+}
+
+// lintPluginDiagnostics runs every configured plugin over a template that
+// parsed. A plugin that fails, times out, or answers with something other
+// than a lint response is reported as an error diagnostic of its own, so a
+// broken house rule is never mistaken for a clean template.
+func lintPluginDiagnostics(templatePath, content string, opts renderOptions) []diagnostic {
+	commands := lintPluginCommands(opts)
+	if len(commands) == 0 {
+		return nil
+	}
+
+	ast := executeAST(templatePath, opts)
+	analysis := executeAnalyze(templatePath, opts)
+	failure := ast.Error
+	if failure == "" {
+		failure = analysis.Error
+	}
+	if failure != "" {
+		// Without a request no plugin can run, which must not read as a
+		// clean template.
+		diagnostics := make([]diagnostic, 0, len(commands))
+		for _, command := range commands {
+			diagnostics = append(diagnostics, diagnostic{
+				Message:  fmt.Sprintf("lint plugin %s could not run: %s", command, failure),
+				Severity: "error",
+				File:     templatePath,
+			})
+		}
+		return diagnostics
+	}
+	request, err := json.Marshal(lintPluginRequest{
+		Version:  lintPluginProtocolVersion,
+		Template: templatePath,
+		Source:   content,
+		AST:      ast.AST,
+		Schema:   analysis.Analysis.Schema,
+		Fields:   analysis.Analysis.Fields,
+	})
+	if err != nil {
+		return []diagnostic{{Message: err.Error(), Severity: "error", File: templatePath}}
+	}
+
+	var diagnostics []diagnostic
+	for _, command := range commands {
+		found, err := runLintPlugin(command, request)
+		if err != nil {
+			diagnostics = append(diagnostics, diagnostic{
+				Message:  fmt.Sprintf("lint plugin %s failed: %v", command, err),
+				Severity: "error",
+				File:     templatePath,
+			})
+			continue
+		}
+		for _, finding := range found {
+			severity := finding.Severity
+			if severity == "" {
+				severity = "warning"
+			}
+			diagnostics = append(diagnostics, diagnostic{
+				Message:   finding.Message,
+				Severity:  severity,
+				Rule:      finding.Rule,
+				File:      templatePath,
+				Line:      finding.Line,
+				Column:    finding.Column,
+				EndColumn: finding.EndColumn,
+			})
+		}
+	}
+	return diagnostics
+}
+
+// lintPluginArgs reads a --lint-plugin value as the argv of the plugin: a
+// JSON array such as ["./tools/k8s-lint", "--strict"], the form helper
+// plugin manifests use, or else the path of a program run without
+// arguments. Neither is split on white space, so paths may contain spaces.
+func lintPluginArgs(command string) ([]string, error) {
+	if !strings.HasPrefix(strings.TrimSpace(command), "[") {
+		if strings.TrimSpace(command) == "" {
+			return nil, fmt.Errorf("empty command")
+		}
+		return []string{command}, nil
+	}
+	var args []string
+	if err := json.Unmarshal([]byte(command), &args); err != nil {
+		return nil, fmt.Errorf("command is not a JSON array of strings: %v", err)
+	}
+	if len(args) == 0 || strings.TrimSpace(args[0]) == "" {
+		return nil, fmt.Errorf("empty command")
+	}
+	return args, nil
+}
+
+// runLintPlugin starts command, writes request to its stdin, and decodes
+// the diagnostics it prints.
+func runLintPlugin(command string, request []byte) ([]lintPluginDiagnostic, error) {
+	args, err := lintPluginArgs(command)
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, err := runPluginProcess(args, request, lintPluginTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	var answer lintPluginResponse
+	if err := json.Unmarshal(stdout, &answer); err != nil {
+		return nil, fmt.Errorf("invalid response: %v", err)
+	}
+	for _, finding := range answer.Diagnostics {
+		if strings.TrimSpace(finding.Rule) == "" || strings.TrimSpace(finding.Message) == "" {
+			return nil, fmt.Errorf("every diagnostic needs a rule and a message")
+		}
+		switch finding.Severity {
+		case "", "error", "warning":
+		default:
+			return nil, fmt.Errorf("rule %s: unknown severity %q", finding.Rule, finding.Severity)
+		}
+	}
+	return answer.Diagnostics, nil
+}
+
+// runPluginProcess runs a plugin program with input on stdin and returns
+// what it printed. A failure carries the program's stderr.
+func runPluginProcess(args []string, input []byte, timeout time.Duration) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdin = bytes.NewReader(input)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("timed out after %s", timeout)
+		}
+		if detail := strings.TrimSpace(stderr.String()); detail != "" {
+			return nil, fmt.Errorf("%v: %s", err, detail)
+		}
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
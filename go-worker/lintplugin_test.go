@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestLintPluginHelperProcess is not a real test: the other tests run the
+// test binary itself as a lint plugin enforcing a house rule that
+// Kubernetes templates set resource limits.
+func TestLintPluginHelperProcess(t *testing.T) {
+	switch os.Getenv("GO_TEMPLATE_STUDIO_LINT_PLUGIN") {
+	case "limits":
+		var request lintPluginRequest
+		if err := json.NewDecoder(os.Stdin).Decode(&request); err != nil || request.Version != lintPluginProtocolVersion {
+			fmt.Fprintf(os.Stderr, "bad request: %v", err)
+			os.Exit(2)
+		}
+		var findings []lintPluginDiagnostic
+		limits := request.Schema.Properties["resources"]
+		if limits == nil || limits.Properties["limits"] == nil {
+			findings = append(findings, lintPluginDiagnostic{
+				Rule:     "k8s-resource-limits",
+				Message:  "every Kubernetes template must set resources.limits",
+				Severity: "error",
+				Line:     1,
+				Column:   1,
+			})
+		}
+		if len(request.AST) != 1 || !strings.Contains(request.Source, "kind:") {
+			findings = append(findings, lintPluginDiagnostic{Rule: "k8s-kind", Message: "missing kind"})
+		}
+		json.NewEncoder(os.Stdout).Encode(lintPluginResponse{Diagnostics: findings})
+		os.Exit(0)
+	case "crash":
+		fmt.Fprint(os.Stderr, "rule set not found")
+		os.Exit(3)
+	}
+}
+
+func lintPluginCommand(t *testing.T, behavior string) string {
+	t.Setenv("GO_TEMPLATE_STUDIO_LINT_PLUGIN", behavior)
+	command, _ := json.Marshal([]string{os.Args[0], "-test.run=^TestLintPluginHelperProcess$"})
+	return string(command)
+}
+
+func TestCheckRunsLintPlugins(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "deployment.yaml.tmpl")
+	writeFile(t, templatePath, "kind: Deployment\nimage: {{ .image }}\n")
+	plugin := lintPluginCommand(t, "limits")
+
+	resp := run(templatePath, "", renderOptions{Mode: "check", LintPlugins: []string{plugin}})
+	if resp.Error != "" || len(resp.Diagnostics) != 1 {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	got := resp.Diagnostics[0]
+	if got.Rule != "k8s-resource-limits" || got.Severity != "error" || got.Line != 1 || got.File != templatePath {
+		t.Fatalf("unexpected plugin diagnostic: %+v", got)
+	}
+
+	writeFile(t, templatePath, "kind: Deployment\ncpu: {{ .resources.limits.cpu }}\n")
+	if resp := run(templatePath, "", renderOptions{Mode: "check", LintPlugins: []string{plugin}}); len(resp.Diagnostics) != 0 {
+		t.Fatalf("expected the house rule to pass, got %+v", resp.Diagnostics)
+	}
+}
+
+func TestCheckReportsFailingLintPlugins(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "page.tmpl")
+	writeFile(t, templatePath, "{{ .title }}")
+	plugin := lintPluginCommand(t, "crash")
+
+	missing, _ := json.Marshal([]string{filepath.Join(dir, "tools", "missing-linter"), "--strict"})
+	resp := run(templatePath, "", renderOptions{Mode: "check", LintPlugins: []string{plugin, string(missing)}})
+	if len(resp.Diagnostics) != 2 {
+		t.Fatalf("expected one diagnostic per broken plugin, got %+v", resp.Diagnostics)
+	}
+	if !strings.Contains(resp.Diagnostics[0].Message, "failed: exit status 3: rule set not found") {
+		t.Fatalf("expected the plugin's stderr in the diagnostic, got %q", resp.Diagnostics[0].Message)
+	}
+	if want := "lint plugin " + string(missing) + " failed"; !strings.HasPrefix(resp.Diagnostics[1].Message, want) {
+		t.Fatalf("expected the missing plugin to be reported, got %q", resp.Diagnostics[1].Message)
+	}
+}
+
+func TestLintPluginCommandsAreArgv(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "lint tools")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	program := filepath.Join(dir, "house rules")
+	if err := os.Symlink(os.Args[0], program); err != nil {
+		t.Skipf("cannot link the plugin: %v", err)
+	}
+	t.Setenv("GO_TEMPLATE_STUDIO_LINT_PLUGIN", "limits")
+	command, _ := json.Marshal([]string{program, "-test.run=^TestLintPluginHelperProcess$"})
+
+	templatePath := filepath.Join(t.TempDir(), "deployment.yaml.tmpl")
+	writeFile(t, templatePath, "kind: Deployment\nimage: {{ .image }}\n")
+	resp := run(templatePath, "", renderOptions{Mode: "check", LintPlugins: []string{string(command)}})
+	if len(resp.Diagnostics) != 1 || resp.Diagnostics[0].Rule != "k8s-resource-limits" {
+		t.Fatalf("expected the plugin under a path with spaces to run, got %+v", resp.Diagnostics)
+	}
+
+	for command, want := range map[string][]string{
+		"/opt/lint tools/house-rules": {"/opt/lint tools/house-rules"},
+		`["house-rules", "--strict"]`: {"house-rules", "--strict"},
+	} {
+		if args, err := lintPluginArgs(command); err != nil || !reflect.DeepEqual(args, want) {
+			t.Errorf("lintPluginArgs(%s) = %q, %v, want %q", command, args, err, want)
+		}
+	}
+	for _, command := range []string{"", "[]", `[""]`, "[1]"} {
+		if _, err := lintPluginArgs(command); err == nil {
+			t.Errorf("expected %q to be rejected", command)
+		}
+	}
+}
+
+func TestCheckReportsLintPluginsThatCouldNotRun(t *testing.T) {
+	plugin := lintPluginCommand(t, "limits")
+
+	// The request is built from the template on disk, so without it no
+	// plugin can run.
+	templatePath := filepath.Join(t.TempDir(), "deleted.tmpl")
+	diagnostics := lintPluginDiagnostics(templatePath, "{{ .title }}", renderOptions{LintPlugins: []string{plugin}})
+	if len(diagnostics) != 1 || diagnostics[0].Severity != "error" ||
+		!strings.HasPrefix(diagnostics[0].Message, "lint plugin "+plugin+" could not run: ") {
+		t.Fatalf("expected the skipped plugin to be reported, got %+v", diagnostics)
+	}
+}
+
+func TestLintPluginsAreNotTakenFromTheWorkspace(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "page.tmpl")
+	writeFile(t, templatePath, "{{ .title }}")
+	marker := filepath.Join(dir, "ran")
+	configPath := filepath.Join(dir, ".vscode", "goTemplateStudio.json")
+	writeFile(t, configPath, `{"lintPlugins": [`+quoteJSON("touch "+marker)+`]}`)
+
+	if resp := run(templatePath, "", renderOptions{Mode: "check", Config: configPath}); len(resp.Diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics: %+v", resp.Diagnostics)
+	}
+	var req serverRequest
+	if err := json.Unmarshal([]byte(`{"template": "page.tmpl", "lintPlugins": [`+quoteJSON("touch "+marker)+`]}`), &req); err != nil || len(req.LintPlugins) != 0 {
+		t.Fatalf("expected a server request not to set lint plugins, got %v, %v", req.LintPlugins, err)
+	}
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Fatal("expected no workspace command to run")
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// loopItem is one element of a collection wrapped by withLoop, along with
+// where it falls in the iteration.
+type loopItem struct {
+	// Index counts from zero. Key is the map key, or Index for lists.
+	Index int
+	Key   interface{}
+	Value interface{}
+	First bool
+	Last  bool
+	// Odd and Even describe Index, so the first item is Even.
+	Odd  bool
+	Even bool
+}
+
+// templateWithLoop wraps each element of a list or map so a range body can
+// ask whether it is on the first or last item, which is what separators
+// between items need. Maps are visited in sorted key order, as range does.
+func templateWithLoop(collection interface{}) ([]loopItem, error) {
+	value := indirectValue(reflect.ValueOf(collection))
+	if !value.IsValid() {
+		return nil, nil
+	}
+
+	var keys, values []reflect.Value
+	switch value.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			keys = append(keys, reflect.ValueOf(i))
+			values = append(values, value.Index(i))
+		}
+	case reflect.Map:
+		keys = value.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return lessMapKey(keys[i], keys[j]) })
+		for _, key := range keys {
+			values = append(values, value.MapIndex(key))
+		}
+	default:
+		return nil, fmt.Errorf("withLoop: expected a list or map, got %T", collection)
+	}
+
+	items := make([]loopItem, len(values))
+	for i := range values {
+		items[i] = loopItem{
+			Index: i,
+			Key:   keys[i].Interface(),
+			Value: values[i].Interface(),
+			First: i == 0,
+			Last:  i == len(values)-1,
+			Odd:   i%2 == 1,
+			Even:  i%2 == 0,
+		}
+	}
+	return items, nil
+}
+
+// lessMapKey orders keys the way text/template's range does for the key
+// types JSON and Go code commonly use.
+func lessMapKey(a, b reflect.Value) bool {
+	switch a.Kind() {
+	case reflect.String:
+		return a.String() < b.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return a.Int() < b.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return a.Uint() < b.Uint()
+	case reflect.Float32, reflect.Float64:
+		return a.Float() < b.Float()
+	default:
+		return fmt.Sprint(a.Interface()) < fmt.Sprint(b.Interface())
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestWithLoopExposesIterationMetadata(t *testing.T) {
+	dir := t.TempDir()
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, contextPath, `{"tags":["go","web","cli"],"ports":{"https":443,"http":80},"none":null}`)
+
+	tests := map[string]string{
+		`{{ range withLoop .tags }}{{ .Value }}{{ if not .Last }}, {{ end }}{{ end }}`:                               "go, web, cli",
+		`{{ range withLoop .tags }}{{ if .First }}[{{ end }}{{ .Index }}{{ if .Odd }}o{{ else }}e{{ end }}{{ end }}`: "[0e1o2e",
+		`{{ range withLoop .ports }}{{ .Key }}={{ .Value }}{{ if not .Last }};{{ end }}{{ end }}`:                    "http=80;https=443",
+		`{{ range withLoop .none }}x{{ else }}empty{{ end }}`:                                                        "empty",
+	}
+	for source, want := range tests {
+		templatePath := filepath.Join(dir, "loop.tmpl")
+		writeFile(t, templatePath, source)
+		resp := run(templatePath, contextPath, renderOptions{})
+		if resp.Error != "" || resp.Rendered != want {
+			t.Fatalf("%s: expected %q, got %+v", source, want, resp)
+		}
+	}
+
+	if _, err := templateWithLoop("abc"); err == nil {
+		t.Fatal("expected a string to be rejected")
+	}
+}
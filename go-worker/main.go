@@ -1,18 +1,22 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	htmltmpl "html/template"
+	"io"
 	"os"
-	"path/filepath"
+	"os/signal"
 	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
 	texttmpl "text/template"
+	"text/template/parse"
 	"time"
 	"unicode"
 	"unicode/utf8"
@@ -21,126 +25,1207 @@ import (
 type diagnostic struct {
 	Message  string `json:"message"`
 	Severity string `json:"severity"`
-	File     string `json:"file,omitempty"`
-	Line     int    `json:"line,omitempty"`
-	Column   int    `json:"column,omitempty"`
+	// Rule identifies the lint rule that reported the diagnostic, if any.
+	Rule   string `json:"rule,omitempty"`
+	File   string `json:"file,omitempty"`
+	Line   int    `json:"line,omitempty"`
+	Column int    `json:"column,omitempty"`
+	// EndColumn is the exclusive end of the offending node on Line.
+	EndColumn int `json:"endColumn,omitempty"`
+	// Related lists other locations involved, such as a shadowed declaration.
+	Related []relatedLocation `json:"related,omitempty"`
+}
+
+// renderOptions captures optional worker behaviors toggled through flags.
+// Fields tagged json:"-" choose programs to run, files to write, hosts and
+// credentials to fetch with, where mail goes, or how much the server takes
+// on, so they are only read from the command line, never from a request.
+type renderOptions struct {
+	// Mode selects what the worker does with the template; empty means render.
+	Mode             string `json:"mode,omitempty"`
+	MinifyWhitespace string `json:"minifyWhitespace,omitempty"`
+	CatalogFormat    string `json:"catalogFormat,omitempty"`
+	GraphFormat      string `json:"graphFormat,omitempty"`
+	RewriteStrings   bool   `json:"rewriteStrings,omitempty"`
+	Line             int    `json:"line,omitempty"`
+	Column           int    `json:"column,omitempty"`
+	Offset           int    `json:"offset,omitempty"`
+	// ResponseVersion selects the response schema; see protocol.go.
+	ResponseVersion int `json:"responseVersion,omitempty"`
+	// PositionEncoding selects the code unit columns are reported in.
+	PositionEncoding string `json:"positionEncoding,omitempty"`
+	// Config points at the project configuration (.vscode/goTemplateStudio.json).
+	Config string `json:"config,omitempty"`
+	// RemoteAllow lists hosts or URL prefixes templates may be fetched
+	// from, and RemoteCacheDir is where their bodies are kept.
+	RemoteAllow    []string `json:"-"`
+	RemoteCacheDir string   `json:"-"`
+	// ContextHeaders are "Name: value" headers sent when fetching a remote
+	// context.
+	ContextHeaders []string `json:"-"`
+	// ContextCacheTTL is how long a fetched remote context is used before
+	// it is revalidated with the server.
+	ContextCacheTTL string `json:"contextCacheTTL,omitempty"`
+	// ContextProfiles renders the template once per named context;
+	// ContextManifest adds the profiles listed in a JSON file.
+	ContextProfiles []contextProfile `json:"contextProfiles,omitempty"`
+	ContextManifest string           `json:"contextManifest,omitempty"`
+	// Includes are globs of sibling templates parsed alongside the template.
+	Includes []string `json:"includes,omitempty"`
+	// TemplateProfile selects one of the project config's templateProfiles,
+	// whose includes join Includes and whose name templates read as
+	// .Profile.
+	TemplateProfile string `json:"templateProfile,omitempty"`
+	// IncludePriority orders includes that define the same names: keys
+	// match directories, file names, or globs of include paths, and higher
+	// priorities win; see includepriority.go.
+	IncludePriority map[string]int `json:"includePriority,omitempty"`
+	// AtRef reads templates (and, with RefContext, the context) from a git
+	// revision instead of the working tree.
+	AtRef      string `json:"atRef,omitempty"`
+	CompareRef string `json:"compareRef,omitempty"`
+	RefContext bool   `json:"refContext,omitempty"`
+	// ContextLayers are context files deep-merged, in order, over the
+	// context; see mergeContexts.
+	ContextLayers []string `json:"contextLayers,omitempty"`
+	// ContextSchema is a JSON Schema the context is validated against
+	// before rendering; violations are warnings unless ContextSchemaStrict
+	// makes them errors that stop the render. See contextschema.go.
+	ContextSchema       string `json:"contextSchema,omitempty"`
+	ContextSchemaStrict bool   `json:"contextSchemaStrict,omitempty"`
+	// CompareContext is the second context context-diff renders with.
+	CompareContext string `json:"compareContext,omitempty"`
+
+	// Funcs selects an optional function library merged over the helpers.
+	Funcs        string            `json:"funcs,omitempty"`
+	Anonymize    bool              `json:"anonymize,omitempty"`
+	DisableFuncs []string          `json:"disableFuncs,omitempty"`
+	RenamedFuncs map[string]string `json:"renamedFuncs,omitempty"`
+	FuncsFrom    string            `json:"funcsFrom,omitempty"`
+	FuncFakes    string            `json:"funcFakes,omitempty"`
+	// Types is a schema, shaped like analyze mode's, that gen-go declares
+	// Params from instead of inferring it; GoPackage names the package.
+	Types     string `json:"types,omitempty"`
+	GoPackage string `json:"goPackage,omitempty"`
+	// DTSFormat is ts or json-schema for gen-dts, and TypeName names the
+	// type it declares.
+	DTSFormat string `json:"dtsFormat,omitempty"`
+	TypeName  string `json:"typeName,omitempty"`
+	// StubFunctions names application functions the worker does not know,
+	// as a comma-separated list or a JSON manifest; see stubs.go.
+	StubFunctions string `json:"stubFunctions,omitempty"`
+	// HelperPlugins is a JSON manifest of template functions implemented by
+	// subprocesses or WASM modules; see helperplugins.go.
+	HelperPlugins string `json:"-"`
+	// Telemetry set to "local" counts renders, helper calls, and error
+	// classes in StatsFile; nothing ever leaves the machine.
+	Telemetry string `json:"telemetry,omitempty"`
+	StatsFile string `json:"-"`
+	// ProductionParity disables every editor-only leniency so a successful
+	// preview implies template.Must would succeed in the service. Features
+	// that relax rendering must check this flag before applying themselves.
+	ProductionParity bool `json:"productionParity,omitempty"`
+	// GoCompat is the oldest Go release the template must parse under.
+	GoCompat string `json:"goCompat,omitempty"`
+	// LeftDelim and RightDelim replace {{ and }} for templates embedded in
+	// files that already use them; empty means the default.
+	LeftDelim  string `json:"leftDelim,omitempty"`
+	RightDelim string `json:"rightDelim,omitempty"`
+	// MissingKey is passed to template.Option as missingkey=...; any value
+	// but error also reports each missing map key as a warning.
+	MissingKey string `json:"missingKey,omitempty"`
+	// FillMissing, when faker, gives the context fields the template reads
+	// but the context lacks placeholder values.
+	FillMissing string `json:"fillMissing,omitempty"`
+	// Timeout (a Go duration such as 2s), MaxOutputBytes, and MaxIterations
+	// abort a render that runs away; zero values leave it unbounded.
+	Timeout        string `json:"timeout,omitempty"`
+	MaxOutputBytes int    `json:"maxOutputBytes,omitempty"`
+	MaxIterations  int    `json:"maxIterations,omitempty"`
+	// MaxTemplateBytes is the largest template the worker reads; zero
+	// means defaultMaxTemplateBytes.
+	MaxTemplateBytes int `json:"maxTemplateBytes,omitempty"`
+	// RenderDir is the input directory of render-dir mode; its output goes
+	// to OutputDir unless DryRun only lists it.
+	RenderDir string `json:"renderDir,omitempty"`
+	OutputDir string `json:"-"`
+	DryRun    bool   `json:"dryRun,omitempty"`
+	// Base is the JSON document json-patch mode diffs the output against.
+	Base string `json:"base,omitempty"`
+	// Post lists post-processing steps run over the rendered output; the xlsx step
+	// writes its workbook to XLSXFile.
+	Post     []string `json:"post,omitempty"`
+	XLSXFile string   `json:"-"`
+	// TextTemplate and SubjectTemplate render the text alternative and the
+	// subject of email mode; EmailManifest lists its addresses and
+	// attachments, and EMLFile is where the assembled message is written.
+	TextTemplate    string `json:"textTemplate,omitempty"`
+	SubjectTemplate string `json:"subjectTemplate,omitempty"`
+	EmailManifest   string `json:"emailManifest,omitempty"`
+	EMLFile         string `json:"-"`
+	// SendTest delivers the assembled email to SendTo through the SMTP
+	// server at SMTP, typically a local capture server such as MailHog.
+	SendTest bool     `json:"-"`
+	SMTP     string   `json:"-"`
+	SendTo   []string `json:"-"`
+	// NotifyURL receives a summary of every render as a JSON POST.
+	NotifyURL string `json:"-"`
+	// StateDir is where --serve keeps the requests it replays at startup
+	// to warm its cache; see serverstate.go.
+	StateDir string `json:"-"`
+	// Parallelism bounds how many requests --serve renders at once, and
+	// how many templates render-dir does; 0 allows one per CPU the worker
+	// may use.
+	Parallelism int `json:"-"`
+	// AllowEnv are the patterns of environment variables the env helper
+	// may read, and AllowFileRoots the directories the file helper may
+	// read under; see sandbox.go.
+	AllowEnv       []string `json:"-"`
+	AllowFileRoots []string `json:"-"`
+	// Seed makes uuidv4, randAlphaNum, and randInt draw the same values
+	// on every render; see random.go.
+	Seed string `json:"seed,omitempty"`
+	// Out is a file a render writes its output to instead of returning
+	// it, and DiffAgainst one it compares its output with, returning a
+	// unified diff; see outputsink.go.
+	Out         string `json:"-"`
+	DiffAgainst string `json:"diff,omitempty"`
+	// Engine forces text/template or html/template regardless of the
+	// template's extension; see engine.go.
+	Engine string `json:"engine,omitempty"`
+	// TargetDefine renders the named define or block with the context as
+	// its dot, instead of the template itself; see targetdefine.go.
+	TargetDefine string `json:"targetDefine,omitempty"`
+	// LintPlugins are commands check mode runs to enforce house rules; see
+	// lintplugin.go.
+	LintPlugins []string `json:"-"`
+	// LintBaseline is a file of accepted check findings that are no longer
+	// reported; UpdateBaseline rewrites it with the current findings.
+	LintBaseline   string `json:"-"`
+	UpdateBaseline bool   `json:"-"`
+	// SourceMap asks for a map from ranges of the rendered output to the
+	// template nodes that wrote them.
+	SourceMap bool `json:"sourceMap,omitempty"`
+	// ValueOrigins asks for the context path of each value printed to the
+	// rendered output; see valueorigin.go.
+	ValueOrigins bool `json:"valueOrigins,omitempty"`
+	// Trace records every action executed, the value of dot, and variable
+	// assignments; see trace.go.
+	Trace bool `json:"trace,omitempty"`
+	// Bench renders the template this many more times, after BenchWarmup
+	// untimed renders, and reports the distribution of their timings; see
+	// bench.go.
+	Bench       int `json:"bench,omitempty"`
+	BenchWarmup int `json:"benchWarmup,omitempty"`
+	// Profile times every action and control structure and reports the
+	// ProfileTop most expensive, or the top by ProfileSort; see profile.go.
+	Profile     bool   `json:"profile,omitempty"`
+	ProfileTop  int    `json:"profileTop,omitempty"`
+	ProfileSort string `json:"profileSort,omitempty"`
+	// Set and SetJSON override context values after the context loads, as
+	// path=value with a string value or path=json; see contextinput.go.
+	Set     []string `json:"set,omitempty"`
+	SetJSON []string `json:"setJSON,omitempty"`
+	// Block names the define or block partial mode runs; without it, the
+	// cursor at Line and Column selects what runs.
+	Block string `json:"block,omitempty"`
+	// NewName is what rename mode renames the template name or variable
+	// at Line and Column to.
+	NewName string `json:"newName,omitempty"`
+	// FmtTrim selects how fmt mode handles trim markers; FmtEdits returns
+	// text edits in place of the formatted template.
+	FmtTrim  string `json:"fmtTrim,omitempty"`
+	FmtEdits bool   `json:"fmtEdits,omitempty"`
+	// Source is the editor's unsaved text of the template, which complete
+	// and fmt modes read in place of the file.
+	Source string `json:"source,omitempty"`
+
+	funcProfile *funcProfile
+	project     *projectConfig
+	// sandbox serves the env and file helpers of a render and records
+	// what it denied.
+	sandbox *templateSandbox
+	// random serves the random helpers of a render.
+	random   *templateRandom
+	includes []templateSource
+	// stdinContext is standard input, read once when --context is -.
+	stdinContext []byte
+	// traceSink receives trace events as they happen instead of them being
+	// collected into the response; the server streams them this way.
+	traceSink func(traceEvent)
+	// cache holds parsed templates across server requests.
+	cache *templateCache
+	// capture records the dot a partial selection first runs with, and
+	// partial runs only that selection with it; see partial.go.
+	capture *partialCapture
+	partial *partialCapture
+	// loops records the range loops of a failed render replayed to locate
+	// the failure; see execfailure.go.
+	loops *loopRecorder
+	// staleRemotes records the cached copies a render fell back to when a
+	// remote template or context could not be fetched; see remote.go.
+	staleRemotes *staleRemotes
+	// reads records the text of every template a request read; see
+	// positions.go.
+	reads *templateReads
+	// ctx is cancelled when a server request is; renders then stop at
+	// their next write or range iteration. See limits.go.
+	ctx context.Context
 }
 
 type response struct {
-	Rendered    string       `json:"rendered,omitempty"`
-	Diagnostics []diagnostic `json:"diagnostics,omitempty"`
-	DurationMs  int64        `json:"durationMs"`
-	Error       string       `json:"error,omitempty"`
+	Rendered     string             `json:"rendered,omitempty"`
+	Diagnostics  []diagnostic       `json:"diagnostics,omitempty"`
+	Verification *verification      `json:"verification,omitempty"`
+	Catalog      []catalogEntry     `json:"catalog,omitempty"`
+	CatalogPO    string             `json:"catalogPo,omitempty"`
+	Position     *textPosition      `json:"position,omitempty"`
+	Definition   *sourceLocation    `json:"definition,omitempty"`
+	Diff         string             `json:"diff,omitempty"`
+	FuncLibrary  *funcLibraryReport `json:"funcLibrary,omitempty"`
+	Update       *updateResult      `json:"update,omitempty"`
+	Stats        *usageStats        `json:"stats,omitempty"`
+	Explanation  []templateOutline  `json:"explanation,omitempty"`
+	ControlFlow  []flowGraph        `json:"controlFlow,omitempty"`
+	AST          []astTemplate      `json:"ast,omitempty"`
+	Analysis     *contextAnalysis   `json:"analysis,omitempty"`
+	Files        []renderedFile     `json:"files,omitempty"`
+	Hover        *hoverInfo         `json:"hover,omitempty"`
+	Completion   *completionList    `json:"completion,omitempty"`
+	Patch        []jsonPatchOp      `json:"patch,omitempty"`
+	// XLSXFile is the workbook --post=xlsx wrote.
+	XLSXFile string `json:"xlsxFile,omitempty"`
+	// EMLFile is the message email mode wrote.
+	EMLFile string `json:"emlFile,omitempty"`
+	// SentTo lists the recipients a --send-test delivered to.
+	SentTo []string `json:"sentTo,omitempty"`
+	// SourceMap links ranges of Rendered to template positions.
+	SourceMap []sourceMapping `json:"sourceMap,omitempty"`
+	// ValueOrigins links ranges of Rendered to the context values they
+	// print.
+	ValueOrigins []valueOrigin `json:"valueOrigins,omitempty"`
+	// Trace lists the steps of a --trace render.
+	Trace []traceEvent `json:"trace,omitempty"`
+	// Profile lists the nodes a --profile render spent the most time in.
+	Profile []nodeProfile `json:"profile,omitempty"`
+	// Bench summarizes the timed renders of --bench.
+	Bench *benchReport `json:"bench,omitempty"`
+	// Overrides reports the template names more than one source defines
+	// and which definition won.
+	Overrides []templateOverride `json:"overrides,omitempty"`
+	// MissingTemplates lists the templates rendered as empty because the
+	// includes that may define them could not be read.
+	MissingTemplates []string `json:"missingTemplates,omitempty"`
+	// Symbols is the outline of the template's defines, blocks, and
+	// top-level variables.
+	Symbols []templateSymbol `json:"symbols,omitempty"`
+	// References and Rename are the results of references and rename
+	// modes.
+	References *referenceReport `json:"references,omitempty"`
+	Rename     *renameReport    `json:"rename,omitempty"`
+	// Format is the result of fmt mode.
+	Format *formatReport `json:"format,omitempty"`
+	// Deps is the template dependency graph of deps mode.
+	Deps *dependencyGraph `json:"deps,omitempty"`
+	// Partial describes the selection partial mode ran and its dot.
+	Partial *partialReport `json:"partial,omitempty"`
+	// ContextDiff explains the changes between two contexts' renders.
+	ContextDiff *contextDiffReport `json:"contextDiff,omitempty"`
+	// CheckAll is the outcome of the check-all subcommand.
+	CheckAll *checkAllReport `json:"checkAll,omitempty"`
+	// TestRun is the outcome of the test subcommand.
+	TestRun *testReport `json:"testRun,omitempty"`
+	// Init is the workspace audit of the init subcommand.
+	Init *initReport `json:"init,omitempty"`
+	// EscapeReport lists the escaping context of each output action in
+	// escape-report mode.
+	EscapeReport []escapeContext `json:"escapeReport,omitempty"`
+	// Filled lists the context paths --fill-missing gave placeholder
+	// values.
+	Filled []string `json:"filled,omitempty"`
+	// ExecFailure is the output and the loop iterations of a render that
+	// failed while executing.
+	ExecFailure *execFailure `json:"execFailure,omitempty"`
+	// Selftest is the outcome of the embedded suite in selftest mode.
+	Selftest *selftestReport `json:"selftest,omitempty"`
+	// SemanticTokens classifies the template's actions for highlighting
+	// in semantic-tokens mode.
+	SemanticTokens *semanticTokens `json:"semanticTokens,omitempty"`
+	// OutFile is the file --out wrote the output to. Changed reports
+	// whether the output differs from the --diff file or, without --diff,
+	// from what --out held before.
+	OutFile string `json:"outFile,omitempty"`
+	Changed *bool  `json:"changed,omitempty"`
+	// Capabilities answers --capabilities, and rides along with the
+	// first response of a server.
+	Capabilities *capabilities `json:"capabilities,omitempty"`
+	// Engine is the engine a render ran under: text or html.
+	Engine string `json:"engine,omitempty"`
+	// FmtRun is the outcome of the fmt subcommand.
+	FmtRun *fmtRunReport `json:"fmtRun,omitempty"`
+	// Baseline reports how --lint-baseline filtered check findings.
+	Baseline *baselineReport `json:"baseline,omitempty"`
+	// Results holds one render per context profile.
+	Results []profileResult `json:"results,omitempty"`
+	// ControlFlowDOT is ControlFlow as Graphviz source.
+	ControlFlowDOT string `json:"controlFlowDot,omitempty"`
+	// Cancelled marks the response of a server request a cancel request
+	// aborted.
+	Cancelled bool `json:"cancelled,omitempty"`
+	// Timings splits a render's time into parsing and executing; CacheHit
+	// reports that the server reused an already parsed template.
+	Timings    *renderTimings `json:"timings,omitempty"`
+	CacheHit   bool           `json:"cacheHit,omitempty"`
+	DurationMs int64          `json:"durationMs"`
+	Error      string         `json:"error,omitempty"`
+
+	// errorCode overrides the v2 error code derived from Error.
+	errorCode string
+	// reads is the text of the templates the request read, which its
+	// columns are converted against.
+	reads *templateReads
+}
+
+// verification reports whether a transformed template still renders the same
+// output as the original against the supplied context.
+type verification struct {
+	Equivalent bool   `json:"equivalent"`
+	Message    string `json:"message,omitempty"`
 }
 
 func main() {
-	templatePath := flag.String("template", "", "Path to the Go template file")
-	contextPath := flag.String("context", "", "Path to the context data file")
+	if len(os.Args) > 1 && os.Args[1] == "update" {
+		writeResponse(runUpdate(os.Args[2:]), responseVersion1)
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "check-all" {
+		// Unlike the other modes, check-all reports failure in its exit
+		// status so pre-commit hooks and CI can gate on it.
+		resp := runCheckAll(os.Args[2:])
+		_ = json.NewEncoder(os.Stdout).Encode(versionedResponse(resp, responseVersion1))
+		os.Exit(checkAllExitCode(resp))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "test" {
+		// Golden tests gate CI the same way.
+		resp := runTests(os.Args[2:])
+		_ = json.NewEncoder(os.Stdout).Encode(versionedResponse(resp, responseVersion1))
+		os.Exit(testExitCode(resp))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "init" {
+		writeResponse(runInit(os.Args[2:]), responseVersion1)
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "fmt" {
+		// Like gofmt -l, fmt fails while templates are left unformatted.
+		resp := runFmt(os.Args[2:])
+		_ = json.NewEncoder(os.Stdout).Encode(versionedResponse(resp, responseVersion1))
+		os.Exit(fmtExitCode(resp))
+	}
+
+	serveMode := flag.Bool("serve", false, "Stay resident and answer newline-delimited JSON requests on stdin")
+	capabilitiesFlag := flag.Bool("capabilities", false, "Report the protocol versions, modes, functions, and context formats this worker supports, and exit")
+	watchMode := flag.Bool("watch", false, "Render again whenever the template, its includes, or the context change, writing one JSON event per render")
+	cpu := addCPUFlags(flag.CommandLine)
+	parallelism := flag.Int("parallelism", 0, "Most server requests, or render-dir templates, rendered at once (0 allows one per CPU)")
+	stateDir := flag.String("state-dir", "", "With --serve, save render requests in this directory and replay them at startup to warm the parse cache")
+	mode := flag.String("mode", "render", "Worker mode: render, minify, extract-strings, position-to-offset, offset-to-position, definition, compare-refs, check, explain, control-flow, ast, analyze, hover, complete, json-patch, email, render-dir, gen-go, gen-dts, context-diff, partial, symbols, references, rename, deps, fmt, escape-report, semantic-tokens, stats, or selftest")
+	check := flag.Bool("check", false, "Shorthand for --mode=check: parse without executing and report every problem found")
+	ast := flag.Bool("ast", false, "Shorthand for --mode=ast: emit the parse tree as JSON")
+	analyze := flag.Bool("analyze", false, "Shorthand for --mode=analyze: report the context fields the template reads")
+	renderDir := flag.String("render-dir", "", "Render every template under this directory (implies --mode=render-dir)")
+	outputDir := flag.String("output-dir", "", "Directory render-dir writes its output to, preserving relative paths")
+	dryRun := flag.Bool("dry-run", false, "In render-dir mode, list the files that would be written without writing them")
+	out := flag.String("out", "", "File the rendered output is written to, atomically, instead of being returned")
+	diffAgainst := flag.String("diff", "", "File the rendered output is compared with; a unified diff and changed are returned instead of the output")
+	base := flag.String("base", "", "JSON document json-patch mode diffs the rendered output against")
+	post := flag.String("post", "", "Comma-separated steps run over the rendered output: csv-validate, xlsx, ics-validate, vcard-validate")
+	xlsxFile := flag.String("xlsx-file", "", "Workbook --post=xlsx writes the rendered CSV to")
+	textTemplate := flag.String("text-template", "", "Template for the text/plain alternative in email mode")
+	subjectTemplate := flag.String("subject-template", "", "Template for the subject line in email mode")
+	emailManifest := flag.String("email-manifest", "", "JSON file listing the addresses, headers, and attachments of email mode")
+	emlFile := flag.String("eml-file", "", "File email mode writes the assembled message to")
+	sendTest := flag.Bool("send-test", false, "In email mode, deliver the message to the --to addresses through --smtp")
+	smtpURL := flag.String("smtp", defaultSMTPURL, "SMTP server --send-test delivers to, e.g. smtp://localhost:1025")
+	sendTo := flag.String("to", "", "Comma-separated recipients of --send-test; they replace the manifest's To and Cc")
+	notifyURL := flag.String("notify-url", "", "URL that receives a JSON summary of each render as a POST")
+	var lintPlugins stringListFlag
+	flag.Var(&lintPlugins, "lint-plugin", "Program check mode runs to enforce house lint rules, as a path or a JSON argv array; repeat for several plugins")
+	lintBaseline := flag.String("lint-baseline", "", "File of accepted check findings to suppress; only new findings are reported")
+	sourceMap := flag.Bool("source-map", false, "Return a sourceMap linking ranges of the rendered output to template positions")
+	valueOrigins := flag.Bool("value-origins", false, "Return valueOrigins linking values in the rendered output to the context paths they came from")
+	trace := flag.Bool("trace", false, "Return a trace of every action executed, the value of dot, and variable assignments")
+	profile := flag.Bool("profile", false, "Return the template nodes that took the most execution time")
+	profileTop := flag.Int("profile-top", defaultProfileTop, "How many nodes --profile lists")
+	profileSort := flag.String("profile-sort", profileSorts[0], "Order of the nodes --profile lists: total, self, calls, or iterations")
+	bench := flag.Int("bench", 0, "Render the template this many more times and report min/median/p95 parse and execute times and allocations")
+	benchWarmup := flag.Int("bench-warmup", defaultBenchWarmup, "Untimed renders --bench runs before timing")
+	updateBaseline := flag.Bool("update-baseline", false, "Record the template's current check findings in --lint-baseline")
+	minifyWhitespace := flag.String("minify-whitespace", "auto", "Whitespace handling for minify mode: auto, collapse, or preserve")
+	catalogFormat := flag.String("catalog-format", "json", "Catalog format for extract-strings mode: json or po")
+	graphFormat := flag.String("graph-format", "json", "Graph format for control-flow mode: json, or dot to add Graphviz source")
+	rewriteStrings := flag.Bool("rewrite-strings", false, "Return the template rewritten to use the t helper in extract-strings mode")
+	line := flag.Int("line", 0, "1-based line for position-to-offset, definition, hover, complete, and partial modes")
+	column := flag.Int("column", 0, "1-based byte column for position-to-offset, definition, hover, complete, and partial modes")
+	block := flag.String("block", "", "Define or block partial mode runs alone, with the dot it had in a full render")
+	targetDefine := flag.String("target-define", "", "Render only the named define or block, with the context as its dot")
+	newName := flag.String("new-name", "", "New name for the template name or variable rename mode renames")
+	fmtTrim := flag.String("fmt-trim", fmtTrimModes[0], "Trim marker handling for fmt mode: keep, standalone, or none")
+	fmtEdits := flag.Bool("fmt-edits", false, "Return text edits in fmt mode in place of the formatted template")
+	offset := flag.Int("offset", 0, "0-based byte offset for offset-to-position mode, and hover and complete modes when --line is unset")
+	responseVersion := flag.Int("response-version", responseVersion1, "Response schema version: 1 or 2")
+	positionEncoding := flag.String("position-encoding", positionEncodingUTF8, "Column units for reported positions: utf-8, utf-16, or utf-32")
+	configPath := flag.String("config", "", "Project configuration file (e.g. .vscode/goTemplateStudio.json)")
+	remoteAllow := flag.String("remote-allow", "", "Comma-separated hosts or URL prefixes, s3:// and gs:// included, remote templates and contexts may be fetched from")
+	remoteCacheDir := flag.String("remote-cache-dir", "", "Directory for cached remote templates (defaults to the user cache dir)")
+	var contextHeaders stringListFlag
+	flag.Var(&contextHeaders, "context-header", "Header sent when fetching an http(s) context, as \"Name: value\" (repeatable)")
+	contextCacheTTL := flag.String("context-cache-ttl", "", "How long a fetched http(s) context is reused before revalidating it, such as 30s (default: always revalidate)")
+	var includes stringListFlag
+	flag.Var(&includes, "include", "Glob of associated templates to parse alongside --template (repeatable)")
+	var allowEnv, allowFileRoots stringListFlag
+	flag.Var(&allowEnv, "allow-env", "Environment variables the env helper may read, as comma-separated patterns such as APP_* (repeatable)")
+	flag.Var(&allowFileRoots, "allow-file-root", "Directory the file helper may read files under (repeatable)")
+	templateProfile := flag.String("template-profile", "", "Template profile from the project config whose includes are added and which templates read as .Profile")
+	includePriorities := flag.String("include-priority", "", "Comma-separated name=priority pairs deciding which include wins when several define a template, e.g. theme=10,base=0")
+	atRef := flag.String("at-ref", "", "Git revision to read templates from instead of the working tree")
+	compareRef := flag.String("compare-ref", "", "Git revision compared against --at-ref in compare-refs mode (defaults to the working tree)")
+	refContext := flag.Bool("ref-context", false, "Also read the context file from --at-ref")
+	templatePath := flag.String("template", "", "Path, http(s) URL, or s3:// or gs:// object of the Go template file")
+	var contexts stringListFlag
+	flag.Var(&contexts, "context", "Path or s3:// or gs:// object of the context data file; repeat (optionally as name=path) to render each profile")
+	var sets, setJSONs stringListFlag
+	flag.Var(&sets, "set", "Override a context value as path=value, with the value as a string (repeatable)")
+	flag.Var(&setJSONs, "set-json", "Override a context value as path=json (repeatable)")
+	contextSchema := flag.String("context-schema", "", "JSON Schema the context is validated against before rendering")
+	contextSchemaStrict := flag.Bool("context-schema-strict", false, "Report --context-schema violations as errors and skip the render")
+	compareContext := flag.String("compare-context", "", "Second context file context-diff compares the render against")
+	contextManifest := flag.String("context-manifest", "", "JSON file mapping profile names to context files, each rendered in turn")
+	funcs := flag.String("funcs", funcLibraryBuiltin, "Function library: builtin, or sprig to add the Sprig functions Helm templates expect")
+	engine := flag.String("engine", engineAuto, "Template engine: text, html, or auto to pick html/template for .html and .htm files")
+	seed := flag.String("seed", "", "Integer seed making uuidv4, randAlphaNum, and randInt return the same values on every render")
+	anonymize := flag.Bool("anonymize", false, "Pseudonymize likely-PII context values before rendering")
+	disableFuncs := flag.String("disable-func", "", "Comma-separated helper or builtin names to disable")
+	renameFuncs := flag.String("rename-func", "", "Comma-separated old=new helper renames")
+	funcsFrom := flag.String("funcs-from", "", "Go source file declaring the production template.FuncMap")
+	funcFakes := flag.String("func-fakes", "", "JSON file mapping production function names to fake return values")
+	types := flag.String("types", "", "Schema file, shaped like analyze mode's, that gen-go declares Params from")
+	goPackage := flag.String("go-package", "", "Package name for gen-go (defaults to the output directory's name)")
+	dtsFormat := flag.String("dts-format", dtsFormatTS, "What gen-dts emits: ts for a TypeScript declaration, or json-schema")
+	typeName := flag.String("type-name", "", "Name of the type gen-dts declares (defaults to the template's name plus Context)")
+	stubFunctions := flag.String("stub-functions", "", "Comma-separated names, or a JSON manifest, of application functions to stub so templates using them parse and render")
+	helperPlugins := flag.String("helper-plugins", "", "JSON manifest of template functions implemented by subprocesses or WASM modules")
+	telemetry := flag.String("telemetry", telemetryOff, "Usage counters: off, or local to record them in --stats-file")
+	statsFile := flag.String("stats-file", "", "Local usage stats file (defaults to go-template-studio/stats.json in the user config dir)")
+	goCompat := flag.String("go-compat", "", "Oldest Go release (e.g. 1.21) the template must support")
+	leftDelim := flag.String("left-delim", "", "Left action delimiter (defaults to {{)")
+	rightDelim := flag.String("right-delim", "", "Right action delimiter (defaults to }})")
+	fillMissing := flag.String("fill-missing", "", "Placeholder values for context fields the template reads but the context lacks: faker")
+	missingKey := flag.String("missing-key", "", "Missing map key handling: default, invalid, zero, or error (empty leaves Go's default and skips reporting)")
+	timeout := flag.String("timeout", "", "Abort a render that runs longer than this duration (e.g. 2s)")
+	maxOutputBytes := flag.Int("max-output-bytes", 0, "Abort a render whose output exceeds this many bytes (0 for no limit)")
+	maxIterations := flag.Int("max-iterations", 0, "Abort a render after this many range iterations in total (0 for no limit)")
+	maxTemplateBytes := flag.Int("max-template-bytes", defaultMaxTemplateBytes, "Refuse templates larger than this many bytes as unsupported input")
+	productionParity := flag.Bool("production-parity", false, "Disable editor-only leniencies so previews match template.Must")
 	flag.Parse()
 
+	if err := validateResponseVersion(*responseVersion); err != nil {
+		writeResponse(response{Error: err.Error()}, responseVersion1)
+		return
+	}
+
+	if err := cpu.apply(); err != nil {
+		writeResponse(response{Error: err.Error()}, *responseVersion)
+		return
+	}
+	if *parallelism < 0 {
+		writeResponse(response{Error: "--parallelism must not be negative"}, *responseVersion)
+		return
+	}
+
+	renamed, err := parseFuncRenames(*renameFuncs)
+	if err != nil {
+		writeResponse(response{Error: err.Error()}, *responseVersion)
+		return
+	}
+	includePriority, err := parseIncludePriority(*includePriorities)
+	if err != nil {
+		writeResponse(response{Error: err.Error()}, *responseVersion)
+		return
+	}
+
+	if *check {
+		*mode = "check"
+	}
+	if *ast {
+		*mode = "ast"
+	}
+	if *analyze {
+		*mode = "analyze"
+	}
+	if *renderDir != "" {
+		*mode = "render-dir"
+	}
+
+	contextPath, layers, profiles := parseContextArgs(contexts)
+
+	opts := renderOptions{
+		Mode:                *mode,
+		MinifyWhitespace:    *minifyWhitespace,
+		CatalogFormat:       *catalogFormat,
+		GraphFormat:         *graphFormat,
+		RewriteStrings:      *rewriteStrings,
+		Line:                *line,
+		Block:               *block,
+		NewName:             *newName,
+		FmtTrim:             *fmtTrim,
+		FmtEdits:            *fmtEdits,
+		Column:              *column,
+		Offset:              *offset,
+		ResponseVersion:     *responseVersion,
+		PositionEncoding:    *positionEncoding,
+		Config:              *configPath,
+		RemoteAllow:         splitList(*remoteAllow),
+		RemoteCacheDir:      *remoteCacheDir,
+		ContextHeaders:      contextHeaders,
+		ContextCacheTTL:     *contextCacheTTL,
+		Includes:            includes,
+		IncludePriority:     includePriority,
+		TemplateProfile:     *templateProfile,
+		ContextLayers:       layers,
+		ContextProfiles:     profiles,
+		ContextManifest:     *contextManifest,
+		Set:                 sets,
+		SetJSON:             setJSONs,
+		AtRef:               *atRef,
+		CompareRef:          *compareRef,
+		RefContext:          *refContext,
+		CompareContext:      *compareContext,
+		ContextSchema:       *contextSchema,
+		ContextSchemaStrict: *contextSchemaStrict,
+
+		Funcs:         *funcs,
+		Anonymize:     *anonymize,
+		DisableFuncs:  splitList(*disableFuncs),
+		RenamedFuncs:  renamed,
+		FuncsFrom:     *funcsFrom,
+		FuncFakes:     *funcFakes,
+		StubFunctions: *stubFunctions,
+		HelperPlugins: *helperPlugins,
+		Types:         *types,
+		GoPackage:     *goPackage,
+		DTSFormat:     *dtsFormat,
+		TypeName:      *typeName,
+
+		Telemetry:        *telemetry,
+		StatsFile:        *statsFile,
+		ProductionParity: *productionParity,
+		GoCompat:         *goCompat,
+		LeftDelim:        *leftDelim,
+		RightDelim:       *rightDelim,
+		MissingKey:       *missingKey,
+		FillMissing:      *fillMissing,
+		Timeout:          *timeout,
+		MaxOutputBytes:   *maxOutputBytes,
+		MaxIterations:    *maxIterations,
+		MaxTemplateBytes: *maxTemplateBytes,
+		RenderDir:        *renderDir,
+		OutputDir:        *outputDir,
+		DryRun:           *dryRun,
+		Base:             *base,
+		Post:             splitList(*post),
+		XLSXFile:         *xlsxFile,
+		TextTemplate:     *textTemplate,
+		SubjectTemplate:  *subjectTemplate,
+		EmailManifest:    *emailManifest,
+		EMLFile:          *emlFile,
+		SendTest:         *sendTest,
+		SMTP:             *smtpURL,
+		SendTo:           splitList(*sendTo),
+		NotifyURL:        *notifyURL,
+		AllowEnv:         allowEnv,
+		AllowFileRoots:   allowFileRoots,
+		Seed:             *seed,
+		Out:              *out,
+		Engine:           *engine,
+		TargetDefine:     *targetDefine,
+		DiffAgainst:      *diffAgainst,
+		StateDir:         *stateDir,
+		Parallelism:      *parallelism,
+		LintPlugins:      lintPlugins,
+		LintBaseline:     *lintBaseline,
+		UpdateBaseline:   *updateBaseline,
+		SourceMap:        *sourceMap,
+		ValueOrigins:     *valueOrigins,
+		Trace:            *trace,
+		Profile:          *profile,
+		ProfileTop:       *profileTop,
+		ProfileSort:      *profileSort,
+		Bench:            *bench,
+		BenchWarmup:      *benchWarmup,
+	}
+
+	if *capabilitiesFlag {
+		writeResponse(response{Capabilities: describeCapabilities(opts)}, opts.ResponseVersion)
+		return
+	}
+
+	if readsStdinContext(contextPath, layers, profiles) {
+		if *serveMode {
+			writeResponse(response{Error: "--context - cannot be combined with --serve, which reads requests from stdin"}, opts.ResponseVersion)
+			return
+		}
+		if *watchMode {
+			writeResponse(response{Error: "--context - cannot be combined with --watch, since stdin cannot be read again on change"}, opts.ResponseVersion)
+			return
+		}
+		stdin, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			writeResponse(response{Error: "failed to read context from stdin: " + err.Error()}, opts.ResponseVersion)
+			return
+		}
+		opts.stdinContext = stdin
+	}
+
+	if *serveMode && *watchMode {
+		writeResponse(response{Error: "--watch cannot be combined with --serve"}, opts.ResponseVersion)
+		return
+	}
+	if *serveMode {
+		if err := serve(os.Stdin, os.Stdout, opts); err != nil {
+			_, _ = os.Stderr.WriteString(err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
+	var hook *notifier
+	if opts.NotifyURL != "" {
+		var err error
+		if hook, err = newNotifier(opts.NotifyURL, os.Stderr); err != nil {
+			_, _ = os.Stderr.WriteString(err.Error())
+			os.Exit(1)
+		}
+	}
+
+	if *watchMode {
+		// Stop on Ctrl-C rather than dying, so the last notifications
+		// are delivered.
+		stop := make(chan struct{})
+		interrupts := make(chan os.Signal, 1)
+		signal.Notify(interrupts, os.Interrupt)
+		go func() {
+			<-interrupts
+			close(stop)
+		}()
+		err := watch(*templatePath, contextPath, opts, os.Stdout, hook, stop, watchPollInterval)
+		if hook != nil {
+			hook.close()
+		}
+		if err != nil {
+			_, _ = os.Stderr.WriteString(err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
 	start := time.Now()
-	resp := execute(*templatePath, *contextPath)
+	resp := run(*templatePath, contextPath, opts)
 	resp.DurationMs = time.Since(start).Milliseconds()
 
+	// Unlike writeResponse, encodeResponse does not exit on a failed
+	// render, whose summary the webhook needs most.
+	encodeResponse(resp, opts.ResponseVersion)
+	if hook != nil {
+		hook.notify(newRenderSummary(nil, *templatePath, contextPath, opts, resp))
+		hook.close()
+	}
+}
+
+// stringListFlag collects every occurrence of a repeatable flag.
+type stringListFlag []string
+
+func (f *stringListFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringListFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+func writeResponse(resp response, version int) {
+	encodeResponse(resp, version)
+	if resp.Error != "" {
+		os.Exit(0)
+	}
+}
+
+// encodeResponse writes resp to stdout, exiting only when it cannot.
+func encodeResponse(resp response, version int) {
 	encoder := json.NewEncoder(os.Stdout)
-	if err := encoder.Encode(resp); err != nil {
+	if err := encoder.Encode(versionedResponse(resp, version)); err != nil {
 		_, _ = os.Stderr.WriteString(err.Error())
 		os.Exit(1)
 	}
+}
+
+// run dispatches to the handler for the requested mode and converts every
+// reported position into the negotiated encoding.
+func run(templatePath, contextPath string, opts renderOptions) response {
+	if err := validatePositionEncoding(opts.PositionEncoding); err != nil {
+		return response{Error: err.Error()}
+	}
+	if err := validateFuncLibrary(opts.Funcs); err != nil {
+		return response{Error: err.Error()}
+	}
+	if err := validateTelemetry(opts.Telemetry); err != nil {
+		return response{Error: err.Error()}
+	}
+	if err := validateMissingKey(opts.MissingKey); err != nil {
+		return response{Error: err.Error()}
+	}
+	if err := validateDelims(opts); err != nil {
+		return response{Error: err.Error()}
+	}
+	if err := validateLimits(opts); err != nil {
+		return response{Error: err.Error()}
+	}
+	if err := validatePost(opts); err != nil {
+		return response{Error: err.Error()}
+	}
+	if err := validateBench(opts); err != nil {
+		return response{Error: err.Error()}
+	}
+	if err := validateProfileSort(opts.ProfileSort); err != nil {
+		return response{Error: err.Error()}
+	}
+	if err := validateFmtTrim(opts); err != nil {
+		return response{Error: err.Error()}
+	}
+	if err := validateMaxTemplateBytes(opts); err != nil {
+		return response{Error: err.Error()}
+	}
+	if err := validateRemoteContext(opts); err != nil {
+		return response{Error: err.Error()}
+	}
+	if err := validateSeed(opts); err != nil {
+		return response{Error: err.Error()}
+	}
+	if err := validateFillMissing(opts); err != nil {
+		return response{Error: err.Error()}
+	}
+	if err := validateOutputSinks(opts); err != nil {
+		return response{Error: err.Error()}
+	}
+	if err := validateEngine(opts.Engine); err != nil {
+		return response{Error: err.Error()}
+	}
+	if err := validateTargetDefine(opts); err != nil {
+		return response{Error: err.Error()}
+	}
 
-	if resp.Error != "" {
-		os.Exit(0)
+	if strings.TrimSpace(opts.Config) != "" {
+		project, err := loadProjectConfig(opts.Config)
+		if err != nil {
+			return response{
+				Diagnostics: []diagnostic{{Message: err.Error(), Severity: "error", File: opts.Config}},
+				Error:       err.Error(),
+			}
+		}
+		opts.project = project
+		opts.Includes = append(append([]string{}, opts.Includes...), project.Includes...)
+	}
+	if err := applyTemplateProfile(&opts); err != nil {
+		return response{Error: err.Error()}
+	}
+
+	if resp, ok := guardTemplateInput(templatePath, opts); !ok {
+		return resp
+	}
+	opts.reads = &templateReads{}
+	resp := dispatch(templatePath, contextPath, opts)
+	if (opts.Mode == "" || opts.Mode == "render") && templatePath != "" {
+		resp.Engine = templateEngine(templatePath, opts)
+	}
+	resp.reads = opts.reads
+	applyPositionEncoding(&resp, templatePath, opts.PositionEncoding)
+	return resp
+}
+
+func dispatch(templatePath, contextPath string, opts renderOptions) response {
+	switch opts.Mode {
+	case "", "render":
+		if len(opts.ContextProfiles) > 0 || strings.TrimSpace(opts.ContextManifest) != "" {
+			return executeProfiles(templatePath, opts)
+		}
+		return applyOutputSinks(applyPostSteps(executeWithOptions(templatePath, contextPath, opts), opts), templatePath, opts)
+	case "minify":
+		return executeMinify(templatePath, contextPath, opts)
+	case "extract-strings":
+		return executeExtractStrings(templatePath, opts)
+	case "position-to-offset":
+		return executePositionConversion(templatePath, false, opts)
+	case "offset-to-position":
+		return executePositionConversion(templatePath, true, opts)
+	case "definition":
+		return executeDefinition(templatePath, opts)
+	case "hover":
+		return executeHover(templatePath, opts)
+	case "complete":
+		return executeComplete(templatePath, contextPath, opts)
+	case "stats":
+		return executeStats(opts)
+	case "selftest":
+		return executeSelftest()
+	case "semantic-tokens":
+		return executeSemanticTokens(templatePath, opts)
+	case "check":
+		return executeCheck(templatePath, opts)
+	case "gen-go":
+		return executeGenGo(templatePath, contextPath, opts)
+	case "gen-dts":
+		return executeGenDTS(templatePath, contextPath, opts)
+	case "context-diff":
+		return executeContextDiff(templatePath, contextPath, opts)
+	case "partial":
+		return executePartial(templatePath, contextPath, opts)
+	case "symbols":
+		return executeSymbols(templatePath, opts)
+	case "references":
+		return executeReferences(templatePath, opts)
+	case "rename":
+		return executeRename(templatePath, opts)
+	case "deps":
+		return executeDeps(templatePath, opts)
+	case "fmt":
+		return executeFmt(templatePath, opts)
+	case "escape-report":
+		return executeEscapeReport(templatePath, opts)
+	case "explain":
+		return executeExplain(templatePath, opts)
+	case "control-flow":
+		return executeControlFlow(templatePath, opts)
+	case "ast":
+		return executeAST(templatePath, opts)
+	case "analyze":
+		return executeAnalyze(templatePath, opts)
+	case "compare-refs":
+		return executeCompareRefs(templatePath, contextPath, opts)
+	case "json-patch":
+		return executeJSONPatch(templatePath, contextPath, opts)
+	case "email":
+		return executeEmail(templatePath, contextPath, opts)
+	case "render-dir":
+		return executeRenderDir(contextPath, opts)
+	default:
+		return response{Error: fmt.Sprintf("unknown mode %q", opts.Mode)}
 	}
 }
 
 func execute(templatePath, contextPath string) response {
+	return executeWithOptions(templatePath, contextPath, renderOptions{})
+}
+
+func executeWithOptions(templatePath, contextPath string, opts renderOptions) (resp response) {
 	if templatePath == "" {
 		return response{Error: "template path is required"}
 	}
 
-	templateBytes, err := os.ReadFile(templatePath)
+	opts.staleRemotes = &staleRemotes{}
+	content, err := readTemplate(templatePath, opts)
 	if err != nil {
 		return response{Error: err.Error()}
 	}
+	defer func() { recordUsage(templatePath, content, resp, opts) }()
+	// Renders run only some of the lint rules, so unused suppressions are
+	// left for check mode to report.
+	defer func() {
+		resp.Diagnostics, _ = suppressDiagnostics(templatePath, content, opts.LeftDelim, opts.RightDelim, resp.Diagnostics)
+	}()
 
-	data, err := loadContext(contextPath)
+	data, err := loadContextWithOptions(contextPath, opts)
 	if err != nil {
-		diag := diagnostic{
-			Message:  err.Error(),
-			Severity: "error",
+		return contextFailure(contextPath, err)
+	}
+
+	var warnings []diagnostic
+	if strings.TrimSpace(opts.ContextSchema) != "" {
+		violations, err := contextSchemaDiagnostics(contextPath, data, opts)
+		if err != nil {
+			return response{Diagnostics: []diagnostic{{Message: err.Error(), Severity: "error", File: opts.ContextSchema}}, Error: err.Error()}
+		}
+		if opts.ContextSchemaStrict && len(violations) > 0 {
+			return response{
+				Diagnostics: violations,
+				Error:       fmt.Sprintf("context does not match %s: %d violation(s)", opts.ContextSchema, len(violations)),
+				errorCode:   errorCodeContext,
+			}
+		}
+		warnings = append(warnings, violations...)
+	}
+
+	if opts.Anonymize {
+		data = anonymizeContext(data)
+	}
+	data = withTemplateProfile(data, opts)
+
+	if strings.TrimSpace(opts.FuncsFrom) != "" {
+		profile, err := loadFuncProfile(opts.FuncsFrom, opts.FuncFakes)
+		if err != nil {
+			return response{
+				Diagnostics: []diagnostic{{Message: err.Error(), Severity: "error", File: opts.FuncsFrom}},
+				Error:       err.Error(),
+			}
 		}
-		if strings.TrimSpace(contextPath) != "" {
-			diag.File = contextPath
+		opts.funcProfile = profile
+		warnings = append(warnings, funcProfileDiagnostics(templatePath, content, profile, opts)...)
+	}
+
+	if opts.project != nil {
+		includes, problems := resolveAliasIncludes(templatePath, content, opts)
+		opts.includes = includes
+		warnings = append(warnings, problems...)
+	}
+
+	if len(opts.Includes) > 0 {
+		includes, problems := resolveIncludePatterns(templatePath, opts)
+		opts.includes = append(opts.includes, includes...)
+		warnings = append(warnings, problems...)
+	}
+	opts.includes = orderIncludes(opts.includes, opts.IncludePriority)
+	overrides, problems := includeOverrides(templatePath, content, opts.includes, opts)
+	warnings = append(warnings, problems...)
+	stubs, missingTemplates, problems := stubMissingTemplates(templatePath, content, warnings, opts)
+	if stubs != nil {
+		opts.includes = append(opts.includes, *stubs)
+	}
+	warnings = append(warnings, problems...)
+	data, filled := fillMissingContext(templatePath, content, data, opts)
+	opts.sandbox = newTemplateSandbox(templatePath, opts)
+	opts.random = newTemplateRandom(opts)
+
+	if opts.ProductionParity {
+		warnings = escalateDiagnostics(warnings)
+	}
+	// Shadowing and risky HTML are legal Go, so they stay warnings even
+	// under parity.
+	warnings = append(warnings, shadowDiagnostics(templatePath, content, opts)...)
+	warnings = append(warnings, htmlRiskDiagnostics(templatePath, content, opts)...)
+	warnings = applyLintRules(warnings, opts)
+
+	if strings.TrimSpace(opts.GoCompat) != "" {
+		target, err := parseGoVersion(opts.GoCompat)
+		if err != nil {
+			return response{Diagnostics: []diagnostic{{Message: err.Error(), Severity: "error"}}, Error: err.Error()}
 		}
-		return response{
-			Diagnostics: []diagnostic{diag},
-			Error:       err.Error(),
+		if problems := compatDiagnostics(templatePath, content, target, opts); len(problems) > 0 {
+			message := fmt.Sprintf("template uses features unavailable in Go %s", target)
+			return response{Diagnostics: append(warnings, problems...), Error: message}
 		}
 	}
 
-	rendered, err := renderTemplate(templatePath, string(templateBytes), data)
+	rendered, run, err := renderTemplateRun(templatePath, content, data, opts)
+	warnings = append(warnings, opts.sandbox.diagnostics(templatePath, content, opts)...)
+	warnings = append(warnings, opts.staleRemotes.diagnostics()...)
 	if err != nil {
-		return response{
-			Diagnostics: []diagnostic{templateDiagnostic(err, templatePath)},
-			Error:       err.Error(),
+		failure := describeExecFailure(templatePath, content, data, rendered, err, opts)
+		diag := templateDiagnosticWithDelims(err, templatePath, content, opts.LeftDelim, opts.RightDelim)
+		diag.Related = loopRelated(failure)
+		resp := response{
+			Diagnostics:      append(warnings, diag),
+			FuncLibrary:      describeFuncLibrary(opts.Funcs),
+			Timings:          &run.timings,
+			CacheHit:         run.cacheHit,
+			Trace:            run.trace,
+			Profile:          run.profile,
+			Overrides:        overrides,
+			MissingTemplates: missingTemplates,
+			Filled:           filled,
+			ExecFailure:      failure,
+			Error:            err.Error(),
 		}
+		var limit *limitError
+		if errors.As(err, &limit) {
+			resp.errorCode = errorCodeLimit
+		}
+		return resp
 	}
 
-	return response{Rendered: rendered}
+	warnings = append(warnings, typeFlowDiagnostics(templatePath, content, data, opts)...)
+	warnings = append(warnings, missingKeyDiagnostics(templatePath, content, data, opts)...)
+
+	resp = response{Rendered: rendered, Diagnostics: warnings, FuncLibrary: describeFuncLibrary(opts.Funcs), Timings: &run.timings, CacheHit: run.cacheHit, SourceMap: run.sourceMap, ValueOrigins: run.valueOrigins, Trace: run.trace, Profile: run.profile, Overrides: overrides, MissingTemplates: missingTemplates, Filled: filled}
+	if opts.Bench > 0 {
+		if resp.Bench, err = benchRender(templatePath, content, data, opts); err != nil {
+			resp.Error = "bench: " + err.Error()
+		}
+	}
+	return resp
 }
 
-func templateDiagnostic(err error, templatePath string) diagnostic {
+func contextFailure(contextPath string, err error) response {
+	diag := diagnostic{
+		Message:  err.Error(),
+		Severity: "error",
+	}
+	if strings.TrimSpace(contextPath) != "" {
+		diag.File = contextPath
+	}
+	return response{
+		Diagnostics: []diagnostic{diag},
+		Error:       err.Error(),
+		errorCode:   errorCodeContext,
+	}
+}
+
+func templateDiagnostic(err error, templatePath, content string) diagnostic {
+	return templateDiagnosticWithDelims(err, templatePath, content, "", "")
+}
+
+func templateDiagnosticWithDelims(err error, templatePath, content, leftDelim, rightDelim string) diagnostic {
 	diag := diagnostic{
 		Message:  err.Error(),
 		Severity: "error",
 		File:     templatePath,
 	}
 
-	extractTemplatePosition(&diag)
+	name := extractTemplatePosition(&diag)
+	if name == templateName(templatePath) {
+		diag.EndColumn = diagnosticEndColumn(diag, content, leftDelim, rightDelim)
+	}
 
 	return diag
 }
 
-var templateErrorPattern = regexp.MustCompile(`template: [^:]+:(\d+)(?::(\d+))?:`)
+var (
+	templateErrorPattern = regexp.MustCompile(`template:\s?([^:]+):(\d+)(?::(\d+))?:`)
+	execContextPattern   = regexp.MustCompile(`executing "[^"]*" at <(.*?)>:`)
+)
 
-func extractTemplatePosition(diag *diagnostic) {
+// extractTemplatePosition fills in the line and 1-based column reported by
+// text/template or html/template and returns the template name the error
+// refers to. Go reports columns as 0-based byte offsets into the line.
+func extractTemplatePosition(diag *diagnostic) string {
 	matches := templateErrorPattern.FindStringSubmatch(diag.Message)
 	if len(matches) == 0 {
-		return
+		return ""
 	}
 
-	if line, err := strconv.Atoi(matches[1]); err == nil {
+	if line, err := strconv.Atoi(matches[2]); err == nil {
 		diag.Line = line
 	}
 
-	if len(matches) > 2 {
-		if column, err := strconv.Atoi(matches[2]); err == nil {
-			diag.Column = column
+	if column, err := strconv.Atoi(matches[3]); err == nil {
+		diag.Column = column + 1
+	}
+
+	return matches[1]
+}
+
+// diagnosticEndColumn finds where the offending node ends: after the node an
+// exec error quotes when the source still spells it the same way, otherwise
+// at the end of the enclosing action.
+func diagnosticEndColumn(diag diagnostic, content, leftDelim, rightDelim string) int {
+	if diag.Line < 1 || diag.Column < 1 {
+		return 0
+	}
+
+	text := lineText(content, diag.Line)
+	start := diag.Column - 1
+	if start > len(text) {
+		return 0
+	}
+
+	if matches := execContextPattern.FindStringSubmatch(diag.Message); matches != nil {
+		node := matches[1]
+		if !strings.HasSuffix(node, "...") && strings.HasPrefix(text[start:], node) {
+			return diag.Column + len(node)
+		}
+	}
+
+	position, err := positionToOffset(content, diag.Line, diag.Column)
+	if err != nil {
+		return 0
+	}
+	for _, action := range scanActions(content, leftDelim, rightDelim) {
+		if action.Start <= position.Offset && position.Offset < action.End {
+			line, column := lineColumn(content, parse.Pos(action.End))
+			if line != diag.Line {
+				return len(text) + 1
+			}
+			return column
 		}
 	}
+	return 0
 }
 
 func loadContext(contextPath string) (interface{}, error) {
-	if strings.TrimSpace(contextPath) == "" {
-		return map[string]any{}, nil
-	}
+	return loadContextWithOptions(contextPath, renderOptions{})
+}
 
-	contextBytes, err := os.ReadFile(contextPath)
+func loadContextWithOptions(contextPath string, opts renderOptions) (interface{}, error) {
+	data, err := loadContextLayer(contextPath, opts)
 	if err != nil {
 		return nil, err
 	}
+	for _, layer := range opts.ContextLayers {
+		overlay, err := loadContextLayer(layer, opts)
+		if err != nil {
+			return nil, fmt.Errorf("context layer %s: %w", layer, err)
+		}
+		data = mergeContexts(data, overlay)
+	}
+
+	return applyContextOverrides(data, opts)
+}
+
+// loadContextLayer reads one context file, or stdin for -. No path is the
+// empty map.
+func loadContextLayer(contextPath string, opts renderOptions) (interface{}, error) {
+	switch {
+	case contextPath == stdinContextPath:
+		if opts.stdinContext == nil {
+			return nil, errors.New("context - reads standard input, which only the command line provides")
+		}
+		return parseStdinContext(opts.stdinContext)
+	case strings.TrimSpace(contextPath) != "":
+		if opts.cache != nil && !isObjectStoreURL(contextPath) && !isRemoteURL(contextPath) && !(opts.RefContext && opts.AtRef != "") {
+			// The server reads contexts again on every keystroke.
+			return loadPooledContext(contextPath)
+		}
+		contextBytes, err := readContextFile(contextPath, opts)
+		if err != nil {
+			return nil, err
+		}
+		return parseContextFile(contextPath, contextBytes)
+	}
+	return map[string]any{}, nil
+}
 
-	return parseContext(contextBytes)
+// readContextFile reads the context from the working tree, from object
+// storage, over http(s), or from AtRef when RefContext asks for the context to travel with
+// the template.
+func readContextFile(contextPath string, opts renderOptions) ([]byte, error) {
+	if isObjectStoreURL(contextPath) {
+		return fetchObject(contextPath, opts)
+	}
+	if isRemoteURL(contextPath) {
+		return fetchRemoteContext(contextPath, opts)
+	}
+	if opts.RefContext && opts.AtRef != "" {
+		return readAtRef(contextPath, opts.AtRef)
+	}
+	return os.ReadFile(contextPath)
 }
 
 func parseContext(content []byte) (interface{}, error) {
-	trimmed := strings.TrimSpace(string(content))
-	if trimmed == "" {
+	trimmed := bytes.TrimSpace(content)
+	if len(trimmed) == 0 {
 		return map[string]any{}, nil
 	}
 
 	var data interface{}
-	if err := json.Unmarshal([]byte(trimmed), &data); err != nil {
+	if err := json.Unmarshal(trimmed, &data); err != nil {
 		return nil, errors.New("failed to parse context JSON")
 	}
 
@@ -148,38 +1233,342 @@ func parseContext(content []byte) (interface{}, error) {
 }
 
 func renderTemplate(path, content string, data interface{}) (string, error) {
-	name := filepath.Base(path)
-	var execute func(interface{}) (string, error)
-
-	if isHTMLTemplate(path) {
-		execute = func(value interface{}) (string, error) {
-			tmpl, err := htmltmpl.New(name).Funcs(htmlFuncMap()).Parse(content)
-			if err != nil {
-				return "", err
-			}
+	return renderTemplateWithOptions(path, content, data, renderOptions{})
+}
 
-			var builder strings.Builder
-			if err := tmpl.Execute(&builder, value); err != nil {
-				return "", err
-			}
-			return builder.String(), nil
+func renderTemplateWithOptions(path, content string, data interface{}, opts renderOptions) (string, error) {
+	rendered, _, err := renderTemplateRun(path, content, data, opts)
+	if err != nil {
+		return "", err
+	}
+	return rendered, nil
+}
+
+// renderRun describes how a render went: whether the parsed template came
+// from the server's cache, how long parsing and executing took, and, with
+// --source-map, which template node wrote each part of the output, with
+// --trace, the steps the execution took, and with --profile, where the time
+// went.
+type renderRun struct {
+	cacheHit     bool
+	timings      renderTimings
+	sourceMap    []sourceMapping
+	valueOrigins []valueOrigin
+	trace        []traceEvent
+	profile      []nodeProfile
+}
+
+// renderTemplateRun renders content, reusing the parsed template from
+// opts.cache when the server has one and the source has not changed. Small
+// plain text renders take the fast path of fastpath.go.
+func renderTemplateRun(path, content string, data interface{}, opts renderOptions) (string, renderRun, error) {
+	if fastPathEligible(path, content, opts) {
+		return fastRenderRun(path, content, data, opts)
+	}
+	var run renderRun
+	funcs, err := templateFuncs(path, opts)
+	if err != nil {
+		return "", run, err
+	}
+	budget := newRenderBudget(opts)
+	if budget != nil {
+		funcs[loopGuardFunc] = budget.iterate
+	}
+	var recorder *sourceRecorder
+	if opts.SourceMap {
+		recorder = &sourceRecorder{}
+		funcs[sourceMarkFunc] = recorder.mark
+	}
+	var origins *originRecorder
+	if opts.ValueOrigins {
+		origins = &originRecorder{}
+		funcs[originMarkFunc] = origins.mark
+		funcs[originEnterFunc] = origins.enter
+		funcs[originExitFunc] = origins.exit
+	}
+	var tracer *traceRecorder
+	if opts.Trace {
+		tracer = newTraceRecorder(templateSources(path, content, opts), opts.PositionEncoding, opts.traceSink)
+		funcs[traceFunc] = tracer.trace
+	}
+	if opts.capture != nil {
+		funcs[partialCaptureFunc] = opts.capture.record
+	}
+	if opts.loops != nil {
+		for name, fn := range opts.loops.funcs() {
+			funcs[name] = fn
 		}
+	}
+	var profiler *profileRecorder
+	if opts.Profile {
+		profiler = newProfileRecorder()
+		funcs[profileEnterFunc] = profiler.enter
+		funcs[profileExitFunc] = profiler.exit
+		funcs[profileIterateFunc] = profiler.iterate
+	}
+
+	start := time.Now()
+	parse := func() (parsedTemplate, error) { return parseTemplate(path, content, funcs, budget != nil, opts) }
+	var tmpl parsedTemplate
+	if opts.cache != nil {
+		tmpl, run.cacheHit, err = opts.cache.load(path, templateCacheKey(content, funcs, budget != nil, opts), parse)
 	} else {
-		execute = func(value interface{}) (string, error) {
-			tmpl, err := texttmpl.New(name).Funcs(textFuncMap()).Parse(content)
-			if err != nil {
-				return "", err
+		tmpl, err = parse()
+	}
+	run.timings.ParseMs = elapsedMs(start)
+	if err != nil {
+		return "", run, err
+	}
+
+	start = time.Now()
+	// The server renders into a pooled buffer sized by the last render.
+	// One-shot runs render once, into a builder that needs no copy.
+	var builder strings.Builder
+	var out io.Writer = &builder
+	var buf *bytes.Buffer
+	if opts.cache != nil {
+		buf = renderBuffers.get(opts.cache.outputHint(path))
+		out = buf
+		defer func() {
+			// An abandoned execution may still write to the buffer.
+			if budget == nil || !budget.abandoned {
+				renderBuffers.put(buf)
 			}
+		}()
+	}
+	execute := func(out io.Writer) error {
+		if recorder != nil {
+			recorder.out = out
+			out = recorder
+		}
+		if origins != nil {
+			origins.out = out
+			out = origins
+		}
+		if tracer != nil {
+			tracer.out = out
+			out = tracer
+		}
+		if opts.partial != nil {
+			return opts.partial.execute(tmpl, out, funcs)
+		}
+		return tmpl.execute(out, opts.TargetDefine, data, funcs)
+	}
+	if budget == nil {
+		err = execute(out)
+	} else {
+		err = budget.run(out, execute)
+	}
+	run.timings.ExecuteMs = elapsedMs(start)
+	if tracer != nil {
+		// A failed render keeps its trace: the last steps show what failed.
+		run.trace = tracer.finish()
+	}
+	if profiler != nil {
+		run.profile = profiler.finish(templateSources(path, content, opts), opts.ProfileTop, opts.ProfileSort)
+	}
+	if err != nil {
+		// A failed render returns what it wrote, unless an execution it
+		// abandoned may still be writing.
+		if budget != nil && budget.abandoned {
+			return "", run, err
+		}
+		if buf != nil {
+			return buf.String(), run, err
+		}
+		return builder.String(), run, err
+	}
+	if recorder != nil {
+		run.sourceMap = recorder.mappings(templateSources(path, content, opts))
+	}
+	if origins != nil {
+		run.valueOrigins = origins.origins(templateSources(path, content, opts))
+	}
+	if buf != nil {
+		opts.cache.rememberOutput(path, buf.Len())
+		return buf.String(), run, nil
+	}
+	return builder.String(), run, nil
+}
+
+// parsedTemplate is a parsed text or html template. Executions work on a
+// copy with funcs bound, so one parse can serve concurrent renders.
+type parsedTemplate interface {
+	// execute runs the named define or block, or the template itself when
+	// name is empty.
+	execute(out io.Writer, name string, data interface{}, funcs map[string]interface{}) error
+	// executePartial runs the tree build derives from the named template's
+	// instead of the whole template; see partial.go.
+	executePartial(out io.Writer, name string, build func(*parse.Tree) (*parse.Tree, error), data interface{}, funcs map[string]interface{}) error
+}
+
+type textTemplate struct{ *texttmpl.Template }
+
+func (t textTemplate) execute(out io.Writer, name string, data interface{}, funcs map[string]interface{}) error {
+	if name != "" && t.Lookup(name) == nil {
+		return undefinedTargetError(name, t.Name(), templateNames(t.Templates()))
+	}
+	clone, err := t.Clone()
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		return clone.Funcs(funcs).Execute(out, data)
+	}
+	return clone.Funcs(funcs).ExecuteTemplate(out, name, data)
+}
 
-			var builder strings.Builder
-			if err := tmpl.Execute(&builder, value); err != nil {
-				return "", err
+func (t textTemplate) executePartial(out io.Writer, name string, build func(*parse.Tree) (*parse.Tree, error), data interface{}, funcs map[string]interface{}) error {
+	base := t.Lookup(name)
+	if base == nil {
+		return fmt.Errorf("no template named %q", name)
+	}
+	tree, err := build(base.Tree)
+	if err != nil {
+		return err
+	}
+	clone, err := t.Clone()
+	if err != nil {
+		return err
+	}
+	if _, err := clone.AddParseTree(tree.Name, tree); err != nil {
+		return err
+	}
+	return clone.Funcs(funcs).ExecuteTemplate(out, tree.Name, data)
+}
+
+type htmlTemplate struct{ *htmltmpl.Template }
+
+// execute clones before escaping, which rewrites the clone's copy of the
+// parse trees and would otherwise stop the template being cloned again.
+func (t htmlTemplate) execute(out io.Writer, name string, data interface{}, funcs map[string]interface{}) error {
+	if name != "" && t.Lookup(name) == nil {
+		return undefinedTargetError(name, t.Name(), templateNames(t.Templates()))
+	}
+	clone, err := t.Clone()
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		return clone.Funcs(funcs).Execute(out, data)
+	}
+	return clone.Funcs(funcs).ExecuteTemplate(out, name, data)
+}
+
+func (t htmlTemplate) executePartial(out io.Writer, name string, build func(*parse.Tree) (*parse.Tree, error), data interface{}, funcs map[string]interface{}) error {
+	base := t.Lookup(name)
+	if base == nil {
+		return fmt.Errorf("no template named %q", name)
+	}
+	tree, err := build(base.Tree)
+	if err != nil {
+		return err
+	}
+	clone, err := t.Clone()
+	if err != nil {
+		return err
+	}
+	if _, err := clone.AddParseTree(tree.Name, tree); err != nil {
+		return err
+	}
+	return clone.Funcs(funcs).ExecuteTemplate(out, tree.Name, data)
+}
+
+// parseTemplate parses content and the resolved includes. With instrument,
+// range loops call the loop guard the render budget binds; with
+// --source-map, output nodes call the source recorder; with --trace and
+// --profile, every step calls the trace and profile recorders.
+func parseTemplate(path, content string, funcs map[string]interface{}, instrument bool, opts renderOptions) (parsedTemplate, error) {
+	name := templateName(path)
+	if usesHTMLEngine(path, opts) {
+		tmpl, err := htmltmpl.New(name).Delims(opts.LeftDelim, opts.RightDelim).Funcs(funcs).Option(missingKeyOptions(opts.MissingKey)...).Parse(content)
+		if err != nil {
+			return nil, err
+		}
+		for _, include := range opts.includes {
+			if _, err := tmpl.New(include.Name).Parse(include.Content); err != nil {
+				return nil, err
 			}
-			return builder.String(), nil
 		}
+		for _, associated := range tmpl.Templates() {
+			instrumentTree(associated.Tree, path, content, instrument, opts)
+		}
+		return htmlTemplate{tmpl}, nil
 	}
 
-	return execute(data)
+	tmpl, err := texttmpl.New(name).Delims(opts.LeftDelim, opts.RightDelim).Funcs(funcs).Option(missingKeyOptions(opts.MissingKey)...).Parse(content)
+	if err != nil {
+		return nil, err
+	}
+	for _, include := range opts.includes {
+		if _, err := tmpl.New(include.Name).Parse(include.Content); err != nil {
+			return nil, err
+		}
+	}
+	for _, associated := range tmpl.Templates() {
+		instrumentTree(associated.Tree, path, content, instrument, opts)
+	}
+	return textTemplate{tmpl}, nil
+}
+
+// instrumentTree adds trace calls when --trace is on, profile calls when
+// --profile is on, the loop guard to range bodies when instrumenting, and
+// source marks when --source-map is on, and origin marks with
+// --value-origins. Tracing goes first so it does not report the other
+// hidden calls.
+func instrumentTree(tree *parse.Tree, path, content string, instrument bool, opts renderOptions) {
+	sources := map[string]string{templateName(path): content}
+	for _, include := range opts.includes {
+		sources[include.Name] = include.Content
+	}
+	if opts.Trace {
+		instrumentTrace(tree, sources, opts.LeftDelim, opts.RightDelim)
+	}
+	if opts.Profile {
+		instrumentProfile(tree, sources, opts.LeftDelim, opts.RightDelim)
+	}
+	if instrument {
+		instrumentLoops(tree)
+	}
+	if opts.SourceMap {
+		instrumentSourceMarks(tree, sources, opts.LeftDelim, opts.RightDelim)
+	}
+	if opts.ValueOrigins {
+		instrumentValueOrigins(tree, sources, opts.LeftDelim, opts.RightDelim)
+	}
+	if opts.capture != nil {
+		opts.capture.instrument(tree)
+	}
+	if opts.loops != nil {
+		opts.loops.instrument(tree)
+	}
+}
+
+// prepareFuncs layers the optional library, production profile, stubs, and
+// helper overrides onto the worker's base helpers.
+func prepareFuncs[M ~map[string]interface{}](funcs M, opts renderOptions) error {
+	if opts.sandbox != nil {
+		funcs["env"] = opts.sandbox.env
+		funcs["file"] = opts.sandbox.file
+	}
+	applyFuncLibrary(funcs, opts.Funcs)
+	if opts.random.seeded() {
+		// Sprig's helpers of the same names cannot be seeded.
+		funcs["uuidv4"] = opts.random.uuidv4
+		funcs["randAlphaNum"] = opts.random.randAlphaNum
+		funcs["randInt"] = opts.random.randInt
+	}
+	if opts.ProductionParity || opts.funcProfile != nil {
+		restrictToProductionFuncs(funcs, opts.funcProfile)
+	}
+	applyFuncProfile(funcs, opts.funcProfile)
+	if err := applyStubFunctions(funcs, opts); err != nil {
+		return err
+	}
+	if err := applyHelperPlugins(funcs, opts); err != nil {
+		return err
+	}
+	return applyFuncOverrides(funcs, opts)
 }
 
 func isHTMLTemplate(path string) bool {
@@ -342,40 +1731,155 @@ func templateSafeHTML(value interface{}) htmltmpl.HTML {
 	return htmltmpl.HTML(toString(value))
 }
 
+// templateTranslate is the preview stand-in for an i18n lookup: it returns
+// the message itself, formatting any extra arguments into it.
+func templateTranslate(message string, args ...interface{}) string {
+	if len(args) == 0 {
+		return message
+	}
+	return fmt.Sprintf(message, args...)
+}
+
+// templateTranslateHTML is t for html/template. Messages are literal text
+// of the template, which is already HTML, so they are returned as HTML and
+// "&amp;" or "'" render exactly as they did before extraction; only the
+// arguments are escaped.
+func templateTranslateHTML(message string, args ...interface{}) htmltmpl.HTML {
+	if len(args) == 0 {
+		return htmltmpl.HTML(message)
+	}
+	escaped := make([]interface{}, len(args))
+	for i, arg := range args {
+		switch arg.(type) {
+		case int, int64, float64, bool:
+			escaped[i] = arg
+		default:
+			escaped[i] = htmltmpl.HTMLEscapeString(fmt.Sprint(arg))
+		}
+	}
+	return htmltmpl.HTML(fmt.Sprintf(message, escaped...))
+}
+
 func textFuncMap() texttmpl.FuncMap {
 	return texttmpl.FuncMap{
-		"list":       templateList,
-		"map":        templateMap,
-		"dict":       templateDict,
-		"upper":      templateUpper,
-		"lower":      templateLower,
-		"title":      templateTitle,
-		"capitalize": templateCapitalize,
-		"trim":       templateTrim,
-		"strip":      templateTrim,
-		"replace":    templateReplace,
-		"default":    templateDefault,
-		"join":       templateJoin,
-		"escape":     templateEscape,
-		"safe":       templateSafeText,
+		"list":         templateList,
+		"map":          templateMap,
+		"dict":         templateDict,
+		"upper":        templateUpper,
+		"lower":        templateLower,
+		"title":        templateTitle,
+		"capitalize":   templateCapitalize,
+		"trim":         templateTrim,
+		"strip":        templateTrim,
+		"trimPrefix":   templateTrimPrefix,
+		"trimSuffix":   templateTrimSuffix,
+		"indent":       templateIndent,
+		"nindent":      templateNindent,
+		"quote":        templateQuote,
+		"squote":       templateSquote,
+		"shellQuote":   templateShellQuote,
+		"replace":      templateReplace,
+		"default":      templateDefault,
+		"join":         templateJoin,
+		"escape":       templateEscape,
+		"safe":         templateSafeText,
+		"t":            templateTranslate,
+		"typeOf":       templateTypeOf,
+		"kindOf":       templateKindOf,
+		"typeIs":       templateTypeIs,
+		"mustBeList":   templateMustBeList,
+		"mustBeMap":    templateMustBeMap,
+		"mustBeString": templateMustBeString,
+		"mustBeNumber": templateMustBeNumber,
+		"mustBeBool":   templateMustBeBool,
+		"nav":          templateNav,
+		"withLoop":     templateWithLoop,
+		"toJson":       templateToJSON,
+		"toPrettyJson": templateToPrettyJSON,
+		"fromJson":     templateFromJSON,
+		"toYaml":       templateToYAML,
+		"fromYaml":     templateFromYAML,
+		"add":          templateAdd,
+		"sub":          templateSub,
+		"mul":          templateMul,
+		"div":          templateDiv,
+		"mod":          templateMod,
+		"max":          templateMax,
+		"min":          templateMin,
+		"floor":        templateFloor,
+		"ceil":         templateCeil,
+		"round":        templateRound,
+		"env":          deniedSandbox.env,
+		"file":         deniedSandbox.file,
+		"uuidv4":       unseededRandom.uuidv4,
+		"randAlphaNum": unseededRandom.randAlphaNum,
+		"randInt":      unseededRandom.randInt,
+		"b64enc":       templateB64Enc,
+		"b64dec":       templateB64Dec,
+		"sha256sum":    templateSHA256Sum,
+		"sha1sum":      templateSHA1Sum,
+		"md5sum":       templateMD5Sum,
 	}
 }
 
 func htmlFuncMap() htmltmpl.FuncMap {
 	return htmltmpl.FuncMap{
-		"list":       templateList,
-		"map":        templateMap,
-		"dict":       templateDict,
-		"upper":      templateUpper,
-		"lower":      templateLower,
-		"title":      templateTitle,
-		"capitalize": templateCapitalize,
-		"trim":       templateTrim,
-		"strip":      templateTrim,
-		"replace":    templateReplace,
-		"default":    templateDefault,
-		"join":       templateJoin,
-		"escape":     templateEscape,
-		"safe":       templateSafeHTML,
+		"list":         templateList,
+		"map":          templateMap,
+		"dict":         templateDict,
+		"upper":        templateUpper,
+		"lower":        templateLower,
+		"title":        templateTitle,
+		"capitalize":   templateCapitalize,
+		"trim":         templateTrim,
+		"strip":        templateTrim,
+		"trimPrefix":   templateTrimPrefix,
+		"trimSuffix":   templateTrimSuffix,
+		"indent":       templateIndent,
+		"nindent":      templateNindent,
+		"quote":        templateQuote,
+		"squote":       templateSquote,
+		"shellQuote":   templateShellQuote,
+		"replace":      templateReplace,
+		"default":      templateDefault,
+		"join":         templateJoin,
+		"escape":       templateEscape,
+		"safe":         templateSafeHTML,
+		"t":            templateTranslateHTML,
+		"typeOf":       templateTypeOf,
+		"kindOf":       templateKindOf,
+		"typeIs":       templateTypeIs,
+		"mustBeList":   templateMustBeList,
+		"mustBeMap":    templateMustBeMap,
+		"mustBeString": templateMustBeString,
+		"mustBeNumber": templateMustBeNumber,
+		"mustBeBool":   templateMustBeBool,
+		"nav":          templateNav,
+		"withLoop":     templateWithLoop,
+		"toJson":       templateToJSON,
+		"toPrettyJson": templateToPrettyJSON,
+		"fromJson":     templateFromJSON,
+		"toYaml":       templateToYAML,
+		"fromYaml":     templateFromYAML,
+		"add":          templateAdd,
+		"sub":          templateSub,
+		"mul":          templateMul,
+		"div":          templateDiv,
+		"mod":          templateMod,
+		"max":          templateMax,
+		"min":          templateMin,
+		"floor":        templateFloor,
+		"ceil":         templateCeil,
+		"round":        templateRound,
+		"env":          deniedSandbox.env,
+		"file":         deniedSandbox.file,
+		"uuidv4":       unseededRandom.uuidv4,
+		"randAlphaNum": unseededRandom.randAlphaNum,
+		"randInt":      unseededRandom.randInt,
+		"b64enc":       templateB64Enc,
+		"b64dec":       templateB64Dec,
+		"sha256sum":    templateSHA256Sum,
+		"sha1sum":      templateSHA1Sum,
+		"md5sum":       templateMD5Sum,
 	}
 }
@@ -368,3 +368,44 @@ func TestFuncMapsExposeHelpers(t *testing.T) {
 		}
 	}
 }
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("failed to create directory for %s: %v", path, err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+}
+
+func TestExecuteReportsExecErrorRange(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := dir + "/page.tmpl"
+	contextPath := dir + "/context.json"
+	writeFile(t, contextPath, `{"items":[1]}`)
+
+	cases := []struct {
+		name      string
+		content   string
+		column    int
+		endColumn int
+	}{
+		{"quoted node", "Hello\n  {{ index .items 5 }}", 6, 20},
+		{"respaced node", "Hello\n  {{ index  .items 5 }} tail", 6, 24},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			writeFile(t, templatePath, tc.content)
+			resp := execute(templatePath, contextPath)
+			if resp.Error == "" || len(resp.Diagnostics) != 1 {
+				t.Fatalf("expected exec error, got %+v", resp)
+			}
+			diag := resp.Diagnostics[0]
+			if diag.Line != 2 || diag.Column != tc.column || diag.EndColumn != tc.endColumn {
+				t.Fatalf("expected 2:%d-%d, got %d:%d-%d", tc.column, tc.endColumn, diag.Line, diag.Column, diag.EndColumn)
+			}
+		})
+	}
+}
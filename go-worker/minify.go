@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const templateTrimCutset = " \t\r\n"
+
+var (
+	whitespaceRunPattern = regexp.MustCompile(`[ \t\r\n]+`)
+	rawElementPattern    = regexp.MustCompile(`(?i)<(/?)(pre|textarea|script|style)\b`)
+)
+
+// executeMinify rewrites the template into a compact equivalent and proves
+// the rewrite by rendering both versions against the supplied context.
+func executeMinify(templatePath, contextPath string, opts renderOptions) response {
+	if templatePath == "" {
+		return response{Error: "template path is required"}
+	}
+
+	content, err := readTemplate(templatePath, opts)
+	if err != nil {
+		return response{Error: err.Error()}
+	}
+
+	if _, err := parseTrees(templatePath, content); err != nil {
+		return response{
+			Diagnostics: []diagnostic{templateDiagnostic(err, templatePath, content)},
+			Error:       err.Error(),
+		}
+	}
+
+	collapse, err := minifyCollapsesWhitespace(opts.MinifyWhitespace, usesHTMLEngine(templatePath, opts))
+	if err != nil {
+		return response{Error: err.Error()}
+	}
+
+	data, err := loadContextWithOptions(contextPath, opts)
+	if err != nil {
+		return contextFailure(contextPath, err)
+	}
+
+	minified := minifyTemplate(content, collapse)
+	return response{
+		Rendered:     minified,
+		Verification: verifyMinified(templatePath, content, minified, data, collapse, opts),
+	}
+}
+
+func minifyCollapsesWhitespace(setting string, html bool) (bool, error) {
+	switch setting {
+	case "", "auto":
+		return html, nil
+	case "collapse":
+		return true, nil
+	case "preserve":
+		return false, nil
+	default:
+		return false, fmt.Errorf("unknown minify whitespace setting %q", setting)
+	}
+}
+
+// minifyTemplate drops comments, applies trim markers directly to the
+// surrounding text, tightens action spacing, and optionally collapses
+// whitespace runs in literal text outside whitespace-sensitive elements.
+func minifyTemplate(content string, collapse bool) string {
+	actions := scanActions(content, "", "")
+
+	texts := make([]string, 0, len(actions)+1)
+	offset := 0
+	for _, action := range actions {
+		texts = append(texts, content[offset:action.Start])
+		offset = action.End
+	}
+	texts = append(texts, content[offset:])
+
+	for i, action := range actions {
+		if action.TrimLeft {
+			texts[i] = strings.TrimRight(texts[i], templateTrimCutset)
+		}
+		if action.TrimRight {
+			texts[i+1] = strings.TrimLeft(texts[i+1], templateTrimCutset)
+		}
+	}
+
+	var builder strings.Builder
+	builder.Grow(len(content))
+
+	inRawElement := false
+	pending := texts[0]
+	for i, action := range actions {
+		if action.IsComment() {
+			pending += texts[i+1]
+			continue
+		}
+
+		pending, inRawElement = minifyText(pending, collapse, inRawElement)
+		builder.WriteString(pending)
+		builder.WriteString(defaultLeftDelim)
+		builder.WriteString(action.Body())
+		builder.WriteString(defaultRightDelim)
+		pending = texts[i+1]
+	}
+	pending, _ = minifyText(pending, collapse, inRawElement)
+	builder.WriteString(pending)
+
+	return builder.String()
+}
+
+func minifyText(text string, collapse, inRawElement bool) (string, bool) {
+	if !collapse {
+		return text, inRawElement
+	}
+
+	var builder strings.Builder
+	offset := 0
+	for _, match := range rawElementPattern.FindAllStringSubmatchIndex(text, -1) {
+		segment := text[offset:match[0]]
+		if !inRawElement {
+			segment = whitespaceRunPattern.ReplaceAllString(segment, " ")
+		}
+		builder.WriteString(segment)
+		builder.WriteString(text[match[0]:match[1]])
+		inRawElement = match[3] == match[2]
+		offset = match[1]
+	}
+
+	segment := text[offset:]
+	if !inRawElement {
+		segment = whitespaceRunPattern.ReplaceAllString(segment, " ")
+	}
+	builder.WriteString(segment)
+
+	return builder.String(), inRawElement
+}
+
+func verifyMinified(templatePath, original, minified string, data interface{}, collapse bool, opts renderOptions) *verification {
+	expected, expectedErr := renderTemplateWithOptions(templatePath, original, data, opts)
+	actual, actualErr := renderTemplateWithOptions(templatePath, minified, data, opts)
+
+	if expectedErr != nil {
+		// Two failures say nothing about whether the outputs would match.
+		return &verification{Message: fmt.Sprintf("original template failed to render, so equivalence could not be checked: %v", expectedErr)}
+	}
+	if actualErr != nil {
+		return &verification{Message: fmt.Sprintf("minified template failed to render: %v", actualErr)}
+	}
+
+	// Collapsing is the one change minification makes on purpose; without
+	// it every byte, whitespace included, must match.
+	if collapse {
+		expected = whitespaceRunPattern.ReplaceAllString(expected, " ")
+		actual = whitespaceRunPattern.ReplaceAllString(actual, " ")
+	}
+	if expected != actual {
+		return &verification{Message: "minified template renders different output"}
+	}
+
+	return &verification{Equivalent: true}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMinifyTemplatePreservesTextWhitespace(t *testing.T) {
+	content := "Hello {{- /* greet */ -}}  {{ .name }}!\n{{- if .x }}\n  yes\n{{- end }}"
+	minified := minifyTemplate(content, false)
+
+	expected := "Hello{{.name}}!{{if .x}}\n  yes{{end}}"
+	if minified != expected {
+		t.Fatalf("unexpected minified template:\n%q\nexpected\n%q", minified, expected)
+	}
+}
+
+func TestMinifyTemplateCollapsesHTMLWhitespace(t *testing.T) {
+	content := "<ul>\n    {{ range .items }}\n    <li>{{ . }}</li>\n    {{ end }}\n</ul>\n<pre>\n  keep   this\n</pre>"
+	minified := minifyTemplate(content, true)
+
+	if !strings.HasPrefix(minified, "<ul> {{range .items}} <li>{{.}}</li> {{end}} </ul> <pre>") {
+		t.Fatalf("expected collapsed whitespace, got %q", minified)
+	}
+	if !strings.Contains(minified, "<pre>\n  keep   this\n</pre>") {
+		t.Fatalf("expected pre contents to be preserved, got %q", minified)
+	}
+}
+
+func TestExecuteMinifyVerifiesEquivalence(t *testing.T) {
+	dir := t.TempDir()
+
+	templatePath := filepath.Join(dir, "page.html")
+	if err := os.WriteFile(templatePath, []byte("<p>\n  {{/* note */}}\n  {{ .name | upper }}\n</p>"), 0o600); err != nil {
+		t.Fatalf("failed to write template file: %v", err)
+	}
+
+	contextPath := filepath.Join(dir, "context.json")
+	if err := os.WriteFile(contextPath, []byte(`{"name":"gopher"}`), 0o600); err != nil {
+		t.Fatalf("failed to write context file: %v", err)
+	}
+
+	resp := run(templatePath, contextPath, renderOptions{Mode: "minify"})
+	if resp.Error != "" {
+		t.Fatalf("unexpected error: %s", resp.Error)
+	}
+
+	if resp.Rendered != "<p> {{.name | upper}} </p>" {
+		t.Fatalf("unexpected minified output: %q", resp.Rendered)
+	}
+
+	if resp.Verification == nil || !resp.Verification.Equivalent {
+		t.Fatalf("expected equivalent verification, got %+v", resp.Verification)
+	}
+}
+
+func TestVerifyMinifiedNeedsBothRendersToSucceedAndMatch(t *testing.T) {
+	data := map[string]interface{}{"items": "not a map"}
+
+	failing := "{{ .items.name }}"
+	if result := verifyMinified("page.tmpl", failing, failing, data, false, renderOptions{}); result.Equivalent ||
+		!strings.Contains(result.Message, "original template failed to render") {
+		t.Fatalf("expected two failed renders not to verify, got %+v", result)
+	}
+
+	if result := verifyMinified("page.tmpl", "a  b", "a b", data, false, renderOptions{}); result.Equivalent {
+		t.Fatalf("expected a whitespace change to fail without collapsing, got %+v", result)
+	}
+	if result := verifyMinified("page.tmpl", "a  b", "a b", data, true, renderOptions{}); !result.Equivalent {
+		t.Fatalf("expected collapsed whitespace to verify, got %+v", result)
+	}
+}
+
+func TestExecuteMinifyRejectsInvalidTemplates(t *testing.T) {
+	templatePath := filepath.Join(t.TempDir(), "broken.tmpl")
+	if err := os.WriteFile(templatePath, []byte("{{ if }"), 0o600); err != nil {
+		t.Fatalf("failed to write template file: %v", err)
+	}
+
+	resp := run(templatePath, "", renderOptions{Mode: "minify"})
+	if resp.Error == "" || len(resp.Diagnostics) != 1 {
+		t.Fatalf("expected parse failure, got %+v", resp)
+	}
+}
+
+func TestRunRejectsUnknownMode(t *testing.T) {
+	if resp := run("page.tmpl", "", renderOptions{Mode: "bogus"}); !strings.Contains(resp.Error, "unknown mode") {
+		t.Fatalf("expected unknown mode error, got %q", resp.Error)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+const (
+	missingKeyDefault = "default"
+	missingKeyInvalid = "invalid"
+	missingKeyZero    = "zero"
+	missingKeyError   = "error"
+
+	// maxMissingKeyReports bounds how many re-executions missing-key
+	// detection performs for one render.
+	maxMissingKeyReports = 50
+)
+
+var missingKeyPattern = regexp.MustCompile(`map has no entry for key ("(?:[^"\\]|\\.)*")`)
+
+func validateMissingKey(mode string) error {
+	switch mode {
+	case "", missingKeyDefault, missingKeyInvalid, missingKeyZero, missingKeyError:
+		return nil
+	default:
+		return fmt.Errorf("unknown missing-key mode %q (expected default, invalid, zero, or error)", mode)
+	}
+}
+
+// missingKeyOptions returns the template.Option arguments for mode; an empty
+// mode leaves Go's default untouched.
+func missingKeyOptions(mode string) []string {
+	if mode == "" {
+		return nil
+	}
+	return []string{"missingkey=" + mode}
+}
+
+// missingKeyDiagnostics reports every map key the template looked up but the
+// context lacked. Go only surfaces these under missingkey=error, and only the
+// first one, so the template is re-executed against a copy of the context
+// with each reported key filled in until it runs clean.
+func missingKeyDiagnostics(templatePath, content string, data interface{}, opts renderOptions) []diagnostic {
+	if opts.MissingKey == "" || opts.MissingKey == missingKeyError {
+		return nil
+	}
+
+	probe := opts
+	probe.MissingKey = missingKeyError
+	working := copyContext(data)
+
+	var diagnostics []diagnostic
+	for len(diagnostics) < maxMissingKeyReports {
+		_, err := renderTemplateWithOptions(templatePath, content, working, probe)
+		if err == nil {
+			break
+		}
+		match := missingKeyPattern.FindStringSubmatch(err.Error())
+		if match == nil {
+			break
+		}
+		key, unquoteErr := strconv.Unquote(match[1])
+		if unquoteErr != nil {
+			break
+		}
+
+		diag := templateDiagnosticWithDelims(err, templatePath, content, opts.LeftDelim, opts.RightDelim)
+		diag.Message = fmt.Sprintf("map has no entry for key %q", key)
+		diag.Severity = "warning"
+		diag.Rule = "missing-key"
+		diagnostics = append(diagnostics, diag)
+
+		// A nil entry renders exactly like a missing one under every mode but
+		// error, so filling it in lets execution continue to the next miss.
+		if !fillMissingKey(working, key) {
+			break
+		}
+	}
+	return diagnostics
+}
+
+// copyContext deep-copies the maps and slices of decoded context data.
+func copyContext(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(typed))
+		for key, item := range typed {
+			copied[key] = copyContext(item)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(typed))
+		for i, item := range typed {
+			copied[i] = copyContext(item)
+		}
+		return copied
+	default:
+		return value
+	}
+}
+
+// fillMissingKey adds key with a nil value to every map in value that lacks
+// it and reports whether any map changed.
+func fillMissingKey(value interface{}, key string) bool {
+	changed := false
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		for _, item := range typed {
+			changed = fillMissingKey(item, key) || changed
+		}
+		if _, ok := typed[key]; !ok {
+			typed[key] = nil
+			changed = true
+		}
+	case []interface{}:
+		for _, item := range typed {
+			changed = fillMissingKey(item, key) || changed
+		}
+	}
+	return changed
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMissingKeyModes(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "page.tmpl")
+	writeFile(t, templatePath, "{{ .name }}\n{{ range .items }}[{{ .label }}]{{ end }}")
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, contextPath, `{"items":[{"label":"a"},{}]}`)
+
+	resp := run(templatePath, contextPath, renderOptions{MissingKey: missingKeyZero})
+	if resp.Error != "" || resp.Rendered != "<no value>\n[a][<no value>]" {
+		t.Fatalf("unexpected zero-mode response: %+v", resp)
+	}
+	if len(resp.Diagnostics) != 2 {
+		t.Fatalf("expected two missing-key warnings, got %+v", resp.Diagnostics)
+	}
+	first, second := resp.Diagnostics[0], resp.Diagnostics[1]
+	if first.Severity != "warning" || first.Message != `map has no entry for key "name"` || first.Line != 1 || first.Column != 4 || first.EndColumn != 9 {
+		t.Fatalf("unexpected first warning: %+v", first)
+	}
+	if second.Message != `map has no entry for key "label"` || second.Line != 2 || second.Column != 23 {
+		t.Fatalf("unexpected second warning: %+v", second)
+	}
+
+	resp = run(templatePath, contextPath, renderOptions{MissingKey: missingKeyError})
+	if !strings.Contains(resp.Error, `map has no entry for key "name"`) || len(resp.Diagnostics) != 1 || resp.Diagnostics[0].Severity != "error" {
+		t.Fatalf("expected error-mode failure, got %+v", resp)
+	}
+
+	resp = run(templatePath, contextPath, renderOptions{})
+	if resp.Error != "" || len(resp.Diagnostics) != 0 {
+		t.Fatalf("expected no reporting without --missing-key, got %+v", resp)
+	}
+
+	resp = run(templatePath, contextPath, renderOptions{MissingKey: "loud"})
+	if !strings.Contains(resp.Error, "unknown missing-key mode") {
+		t.Fatalf("expected validation error, got %+v", resp)
+	}
+}
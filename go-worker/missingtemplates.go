@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// unreadableIncludeRule marks the warnings about includes that could
+	// not be read, which stubMissingTemplates looks for.
+	unreadableIncludeRule = "unreadable-include"
+	// missingTemplateRule marks the calls to templates stubbed because an
+	// include could not be read.
+	missingTemplateRule = "missing-template"
+	// missingTemplatesSource names the include holding the stubs.
+	missingTemplatesSource = "__goTemplateStudioMissing"
+)
+
+// stubMissingTemplates keeps a render going when some includes could not
+// be read. Every template the readable sources call but none of them
+// defines is given an empty definition, so its calls render nothing
+// instead of failing the render, and each call is reported where it is
+// made. With every include read, it does nothing: a call to an undefined
+// template is then a real error. Under production parity it does nothing
+// either, since production would fail the same call.
+func stubMissingTemplates(templatePath, content string, warnings []diagnostic, opts renderOptions) (*templateSource, []string, []diagnostic) {
+	if opts.ProductionParity {
+		return nil, nil, nil
+	}
+	unreadable := 0
+	for _, warning := range warnings {
+		if warning.Rule == unreadableIncludeRule {
+			unreadable++
+		}
+	}
+	if unreadable == 0 {
+		return nil, nil, nil
+	}
+
+	sources := append([]templateSource{{Name: templateName(templatePath), Path: templatePath, Content: content}}, opts.includes...)
+	defined := map[string]bool{}
+	type call struct {
+		source templateSource
+		ref    templateReference
+	}
+	var calls []call
+	for _, source := range sources {
+		trees, err := parseTreesWithDelims(source.Name, source.Content, opts.LeftDelim, opts.RightDelim)
+		if err != nil {
+			continue
+		}
+		for name := range trees {
+			defined[name] = true
+		}
+		for _, ref := range templateReferences(trees) {
+			calls = append(calls, call{source: source, ref: ref})
+		}
+	}
+
+	var missing []string
+	var diagnostics []diagnostic
+	stubbed := map[string]bool{}
+	for _, call := range calls {
+		name := call.ref.Name
+		if defined[name] {
+			continue
+		}
+		if !stubbed[name] {
+			stubbed[name] = true
+			missing = append(missing, name)
+		}
+		line, column := lineColumn(call.source.Content, call.ref.Pos)
+		diagnostics = append(diagnostics, diagnostic{
+			Message: fmt.Sprintf("template %q is not defined by the readable templates and renders as empty; %d include(s) could not be read",
+				name, unreadable),
+			Severity: "warning",
+			Rule:     missingTemplateRule,
+			File:     call.source.Path,
+			Line:     line,
+			Column:   column,
+		})
+	}
+	if len(missing) == 0 {
+		return nil, nil, nil
+	}
+	sort.Strings(missing)
+
+	leftDelim, rightDelim := opts.LeftDelim, opts.RightDelim
+	if leftDelim == "" {
+		leftDelim = defaultLeftDelim
+	}
+	if rightDelim == "" {
+		rightDelim = defaultRightDelim
+	}
+	var stubs strings.Builder
+	for _, name := range missing {
+		fmt.Fprintf(&stubs, "%sdefine %s%s%send%s", leftDelim, strconv.Quote(name), rightDelim, leftDelim, rightDelim)
+	}
+	return &templateSource{Name: missingTemplatesSource, Content: stubs.String()}, missing, diagnostics
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUnreadableIncludeStubsTheTemplatesItMayDefine(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "page.tmpl")
+	writeFile(t, templatePath, "{{ template \"header\" . }}Hello {{ .name }}\n{{ template \"footer\" }}")
+	writeFile(t, filepath.Join(dir, "partials", "header.tmpl"), "{{ define \"header\" }}<h1>{{ .name }}</h1>{{ end }}")
+	if err := os.Symlink(filepath.Join(dir, "gone.tmpl"), filepath.Join(dir, "partials", "footer.tmpl")); err != nil {
+		t.Skip(err)
+	}
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, contextPath, `{"name": "Ada"}`)
+
+	resp := run(templatePath, contextPath, renderOptions{Includes: []string{filepath.Join(dir, "partials", "*.tmpl")}})
+	if resp.Error != "" || resp.Rendered != "<h1>Ada</h1>Hello Ada\n" {
+		t.Fatalf("expected the readable templates to render, got %+v", resp)
+	}
+	if len(resp.MissingTemplates) != 1 || resp.MissingTemplates[0] != "footer" {
+		t.Fatalf("expected footer to be stubbed, got %v", resp.MissingTemplates)
+	}
+	var rules []string
+	for _, diag := range resp.Diagnostics {
+		rules = append(rules, diag.Rule)
+		if diag.Rule == missingTemplateRule && (diag.File != templatePath || diag.Line != 2 || diag.Column != 13) {
+			t.Fatalf("expected the warning at the footer call, got %+v", diag)
+		}
+	}
+	if got := strings.Join(rules, " "); got != "unreadable-include missing-template" {
+		t.Fatalf("unexpected diagnostics: %+v", resp.Diagnostics)
+	}
+}
+
+func TestProductionParityDoesNotStubMissingTemplates(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "page.tmpl")
+	writeFile(t, templatePath, "Hello{{ template \"footer\" }}")
+	if err := os.MkdirAll(filepath.Join(dir, "partials"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(dir, "gone.tmpl"), filepath.Join(dir, "partials", "footer.tmpl")); err != nil {
+		t.Skip(err)
+	}
+
+	resp := run(templatePath, "", renderOptions{Includes: []string{filepath.Join(dir, "partials", "*.tmpl")}, ProductionParity: true})
+	if !strings.Contains(resp.Error, `template "footer" not defined`) || len(resp.MissingTemplates) != 0 {
+		t.Fatalf("expected the render to fail as production would, got %+v", resp)
+	}
+	for _, diag := range resp.Diagnostics {
+		if diag.Rule == missingTemplateRule {
+			t.Fatalf("expected no stubbed templates, got %+v", diag)
+		}
+	}
+}
+
+func TestUndefinedTemplateStillFailsWhenEveryIncludeIsRead(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "page.tmpl")
+	writeFile(t, templatePath, "{{ template \"footer\" }}")
+
+	resp := run(templatePath, "", renderOptions{})
+	if resp.Error == "" || len(resp.MissingTemplates) != 0 {
+		t.Fatalf("expected the undefined template to fail the render, got %+v", resp)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// templateNav follows a dotted path such as ".user.address.city" from value
+// and returns nil as soon as a step is nil or missing, instead of failing
+// the render the way a chained field access would. Numeric steps index
+// lists, so ".items.0.name" reads the first item's name.
+func templateNav(path string, value interface{}) (interface{}, error) {
+	trimmed := strings.TrimPrefix(strings.TrimSpace(path), ".")
+	if trimmed == "" {
+		return value, nil
+	}
+
+	steps := strings.Split(trimmed, ".")
+	for _, step := range steps {
+		if step == "" {
+			return nil, fmt.Errorf("nav: invalid path %q", path)
+		}
+	}
+
+	current := reflect.ValueOf(value)
+	for _, step := range steps {
+		current = navStep(indirectValue(current), step)
+		if !current.IsValid() {
+			return nil, nil
+		}
+	}
+
+	current = indirectValue(current)
+	if !current.IsValid() {
+		return nil, nil
+	}
+	return current.Interface(), nil
+}
+
+// navStep returns the value step names inside current, or the zero Value
+// when there is none.
+func navStep(current reflect.Value, step string) reflect.Value {
+	switch current.Kind() {
+	case reflect.Map:
+		if current.Type().Key().Kind() != reflect.String {
+			return reflect.Value{}
+		}
+		return current.MapIndex(reflect.ValueOf(step).Convert(current.Type().Key()))
+	case reflect.Slice, reflect.Array:
+		index, err := strconv.Atoi(step)
+		if err != nil || index < 0 || index >= current.Len() {
+			return reflect.Value{}
+		}
+		return current.Index(index)
+	case reflect.Struct:
+		field, ok := current.Type().FieldByName(step)
+		if !ok || !field.IsExported() {
+			return reflect.Value{}
+		}
+		return current.FieldByIndex(field.Index)
+	default:
+		return reflect.Value{}
+	}
+}
+
+// indirectValue unwraps interfaces and pointers, returning the zero Value
+// for nil.
+func indirectValue(value reflect.Value) reflect.Value {
+	for value.IsValid() && (value.Kind() == reflect.Interface || value.Kind() == reflect.Pointer) {
+		if value.IsNil() {
+			return reflect.Value{}
+		}
+		value = value.Elem()
+	}
+	return value
+}
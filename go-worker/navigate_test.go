@@ -0,0 +1,41 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNavReturnsNilForMissingSteps(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "nav.tmpl")
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, templatePath, `{{ nav ".user.address.city" . }}|{{ . | nav "user.orders.1.id" }}|{{ nav ".user.manager.name" . | default "none" }}|{{ nav ".user.orders.7.id" . | default "none" }}|{{ with nav ".user.phone.home" . }}{{ . }}{{ else }}no phone{{ end }}`)
+	writeFile(t, contextPath, `{"user":{"address":{"city":"Oslo"},"orders":[{"id":1},{"id":2}],"manager":null}}`)
+
+	resp := run(templatePath, contextPath, renderOptions{})
+	if resp.Error != "" || resp.Rendered != "Oslo|2|none|none|no phone" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+}
+
+func TestNavFollowsStructFields(t *testing.T) {
+	type address struct{ City string }
+	type user struct {
+		Address *address
+		secret  string
+	}
+
+	value, err := templateNav(".Address.City", user{Address: &address{City: "Lima"}})
+	if err != nil || value != "Lima" {
+		t.Fatalf("expected Lima, got %v, %v", value, err)
+	}
+	for _, path := range []string{".Address.City", ".secret"} {
+		if value, err := templateNav(path, &user{}); err != nil || value != nil {
+			t.Fatalf("%s: expected nil, got %v, %v", path, value, err)
+		}
+	}
+	if _, err := templateNav(".a..b", map[string]interface{}{}); err == nil || !strings.Contains(err.Error(), `nav: invalid path ".a..b"`) {
+		t.Fatalf("expected invalid path error, got %v", err)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	// notifyQueueSize bounds the summaries waiting to be posted; once it is
+	// full, further summaries are dropped rather than slowing renders down.
+	notifyQueueSize = 64
+	notifyTimeout   = 5 * time.Second
+)
+
+// renderSummary is the JSON body --notify-url receives after each render.
+type renderSummary struct {
+	Event       string          `json:"event"`
+	ID          json.RawMessage `json:"id,omitempty"`
+	Template    string          `json:"template"`
+	Context     string          `json:"context,omitempty"`
+	Mode        string          `json:"mode"`
+	Status      string          `json:"status"`
+	DurationMs  int64           `json:"durationMs"`
+	Diagnostics int             `json:"diagnostics"`
+	Errors      int             `json:"errors"`
+	Warnings    int             `json:"warnings"`
+	OutputHash  string          `json:"outputHash,omitempty"`
+	OutputBytes int             `json:"outputBytes"`
+	Error       string          `json:"error,omitempty"`
+	Time        string          `json:"time"`
+}
+
+// newRenderSummary summarizes resp. The output hash lets a dashboard tell
+// whether an edit changed the output without receiving the output itself.
+func newRenderSummary(id json.RawMessage, templatePath, contextPath string, opts renderOptions, resp response) renderSummary {
+	summary := renderSummary{
+		Event:       "render",
+		ID:          id,
+		Template:    templatePath,
+		Context:     contextPath,
+		Mode:        opts.Mode,
+		Status:      "ok",
+		DurationMs:  resp.DurationMs,
+		Diagnostics: len(resp.Diagnostics),
+		OutputBytes: len(resp.Rendered),
+		Error:       resp.Error,
+		Time:        time.Now().UTC().Format(time.RFC3339),
+	}
+	if summary.Mode == "" {
+		summary.Mode = "render"
+	}
+	if resp.Error != "" {
+		summary.Status = "error"
+	} else {
+		sum := sha256.Sum256([]byte(resp.Rendered))
+		summary.OutputHash = "sha256:" + hex.EncodeToString(sum[:])
+	}
+	for _, diag := range resp.Diagnostics {
+		switch diag.Severity {
+		case "error":
+			summary.Errors++
+		case "warning":
+			summary.Warnings++
+		}
+	}
+	return summary
+}
+
+// notifier posts render summaries to a webhook from a single background
+// goroutine, in the order renders finished. Failures are logged to errs and
+// never affect the render.
+type notifier struct {
+	url    string
+	client *http.Client
+	queue  chan renderSummary
+	errs   io.Writer
+	done   sync.WaitGroup
+}
+
+func newNotifier(rawURL string, errs io.Writer) (*notifier, error) {
+	target, err := url.Parse(rawURL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, fmt.Errorf("--notify-url must be an http or https URL, got %q", rawURL)
+	}
+	n := &notifier{
+		url:    rawURL,
+		client: &http.Client{Timeout: notifyTimeout},
+		queue:  make(chan renderSummary, notifyQueueSize),
+		errs:   errs,
+	}
+	n.done.Add(1)
+	go n.run()
+	return n, nil
+}
+
+// notify queues summary, dropping it when the webhook has fallen behind.
+func (n *notifier) notify(summary renderSummary) {
+	select {
+	case n.queue <- summary:
+	default:
+		fmt.Fprintf(n.errs, "notify: dropped the summary of %s; %s is not keeping up\n", summary.Template, n.url)
+	}
+}
+
+// close posts the summaries still queued and stops the notifier.
+func (n *notifier) close() {
+	close(n.queue)
+	n.done.Wait()
+}
+
+func (n *notifier) run() {
+	defer n.done.Done()
+	for summary := range n.queue {
+		if err := n.post(summary); err != nil {
+			fmt.Fprintf(n.errs, "notify: %v\n", err)
+		}
+	}
+}
+
+func (n *notifier) post(summary renderSummary) error {
+	body, err := json.Marshal(summary)
+	if err != nil {
+		return err
+	}
+	resp, err := n.client.Post(n.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s answered %s", n.url, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestServePostsRenderSummariesToNotifyURL(t *testing.T) {
+	var (
+		mu        sync.Mutex
+		summaries []renderSummary
+	)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var summary renderSummary
+		body, _ := io.ReadAll(r.Body)
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" || json.Unmarshal(body, &summary) != nil {
+			t.Errorf("unexpected notification %s %s", r.Method, body)
+		}
+		mu.Lock()
+		summaries = append(summaries, summary)
+		mu.Unlock()
+	}))
+	defer webhook.Close()
+
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.tmpl")
+	writeFile(t, good, "Hello {{ .name }}")
+	bad := filepath.Join(dir, "bad.tmpl")
+	writeFile(t, bad, "{{ .name.first }}")
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, contextPath, `{"name": "Ada"}`)
+
+	requests := `{"id":1,"template":` + quoteJSON(good) + `,"context":` + quoteJSON(contextPath) + `}` + "\n" +
+		`{"id":2,"template":` + quoteJSON(bad) + `,"context":` + quoteJSON(contextPath) + `}` + "\n"
+	var output bytes.Buffer
+	if err := serve(strings.NewReader(requests), &output, renderOptions{NotifyURL: webhook.URL}); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(summaries) != 2 {
+		t.Fatalf("expected a summary per render, got %+v", summaries)
+	}
+	byID := map[string]renderSummary{}
+	for _, summary := range summaries {
+		byID[string(summary.ID)] = summary
+	}
+	ok, failed := byID["1"], byID["2"]
+	if ok.Event != "render" || ok.Status != "ok" || ok.Mode != "render" || ok.Template != good || ok.OutputBytes != len("Hello Ada") ||
+		ok.OutputHash != "sha256:d3ce3532b03b6df16922e95ee5be0aace0dcefeb8ad0d5efd537e7b799e7e182" {
+		t.Fatalf("unexpected summary of a successful render: %+v", ok)
+	}
+	if failed.Status != "error" || failed.Error == "" || failed.OutputHash != "" || failed.Errors != failed.Diagnostics {
+		t.Fatalf("unexpected summary of a failed render: %+v", failed)
+	}
+}
+
+func TestNotifierRejectsNonHTTPURLs(t *testing.T) {
+	if err := serve(strings.NewReader(""), io.Discard, renderOptions{NotifyURL: "ftp://example.com/hook"}); err == nil ||
+		!strings.Contains(err.Error(), "--notify-url must be an http or https URL") {
+		t.Fatalf("expected a URL error, got %v", err)
+	}
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const emptyPayloadSHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// awsCredentials are the static keys S3 requests are signed with.
+type awsCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+func isObjectStoreURL(location string) bool {
+	lower := strings.ToLower(location)
+	return strings.HasPrefix(lower, "s3://") || strings.HasPrefix(lower, "gs://")
+}
+
+// fetchObject reads an s3:// or gs:// object. Like remote templates, the
+// object must be in the --remote-allow allowlist. Only GET requests are
+// issued and bodies are capped at the same limit as remote templates.
+func fetchObject(location string, opts renderOptions) ([]byte, error) {
+	if !remoteAllowed(location, opts.RemoteAllow) {
+		return nil, fmt.Errorf("object %s is not in the allowlist (see --remote-allow)", location)
+	}
+	parsed, err := url.Parse(location)
+	if err != nil {
+		return nil, err
+	}
+	bucket, key := parsed.Host, strings.TrimPrefix(parsed.Path, "/")
+	if bucket == "" || key == "" {
+		return nil, fmt.Errorf("object URL %s must name a bucket and an object", location)
+	}
+
+	var request *http.Request
+	switch strings.ToLower(parsed.Scheme) {
+	case "s3":
+		request, err = newS3Request(bucket, key, time.Now().UTC())
+	default:
+		request, err = newGCSRequest(bucket, key)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := remoteClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: %s", location, resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxRemoteBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxRemoteBytes {
+		return nil, fmt.Errorf("object %s exceeds the 5 MiB limit", location)
+	}
+	return body, nil
+}
+
+// newS3Request builds a SigV4-signed GET. AWS_ENDPOINT_URL_S3 (or
+// AWS_ENDPOINT_URL) points at S3-compatible stores using path-style URLs.
+func newS3Request(bucket, key string, now time.Time) (*http.Request, error) {
+	region := firstEnv("AWS_REGION", "AWS_DEFAULT_REGION")
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	escapedKey := escapeS3Path(key)
+	target := fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", bucket, region, escapedKey)
+	if endpoint := firstEnv("AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL"); endpoint != "" {
+		target = strings.TrimSuffix(endpoint, "/") + "/" + escapeS3Path(bucket) + "/" + escapedKey
+	}
+
+	request, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	creds, err := loadAWSCredentials()
+	if err != nil {
+		return nil, err
+	}
+	if creds != nil {
+		signS3Request(request, *creds, region, now)
+	}
+	return request, nil
+}
+
+// escapeS3Path applies SigV4 URI encoding to each segment of value: every
+// byte but the unreserved A-Z, a-z, 0-9, -, ., _, and ~ is written as %XX.
+// url.PathEscape leaves characters such as +, =, :, and @ alone, which S3
+// then encodes differently from the signature.
+func escapeS3Path(value string) string {
+	const hexDigits = "0123456789ABCDEF"
+	var escaped strings.Builder
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; {
+		case c == '/', c == '-', c == '.', c == '_', c == '~',
+			'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9':
+			escaped.WriteByte(c)
+		default:
+			escaped.WriteByte('%')
+			escaped.WriteByte(hexDigits[c>>4])
+			escaped.WriteByte(hexDigits[c&0xf])
+		}
+	}
+	return escaped.String()
+}
+
+// signS3Request adds AWS Signature Version 4 headers for an empty-body GET.
+func signS3Request(request *http.Request, creds awsCredentials, region string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	request.Header.Set("X-Amz-Date", amzDate)
+	request.Header.Set("X-Amz-Content-Sha256", emptyPayloadSHA256)
+	if creds.SessionToken != "" {
+		request.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	headers := map[string]string{"host": request.URL.Host}
+	for name := range request.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(request.Header.Get(name))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		request.URL.EscapedPath(),
+		request.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		emptyPayloadSHA256,
+	}, "\n")
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	signature := hex.EncodeToString(hmacSHA256(sigV4SigningKey(creds.SecretAccessKey, date, region, "s3"), stringToSign))
+	request.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKeyID, scope, signedHeaders, signature,
+	))
+}
+
+func sigV4SigningKey(secret, date, region, service string) []byte {
+	key := hmacSHA256([]byte("AWS4"+secret), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	return hmacSHA256(key, "aws4_request")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// loadAWSCredentials follows the environment and shared-credentials-file
+// steps of the AWS default chain, and only those: without the SDK there is
+// no instance metadata, SSO, web identity, or credential_process step. It
+// returns nil when neither is configured, in which case the request is sent
+// anonymously.
+func loadAWSCredentials() (*awsCredentials, error) {
+	if id, secret := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"); id != "" && secret != "" {
+		return &awsCredentials{AccessKeyID: id, SecretAccessKey: secret, SessionToken: os.Getenv("AWS_SESSION_TOKEN")}, nil
+	}
+
+	path := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, nil
+		}
+		path = filepath.Join(home, ".aws", "credentials")
+	}
+	profile := os.Getenv("AWS_PROFILE")
+	if profile == "" {
+		profile = "default"
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var (
+		creds   awsCredentials
+		section string
+	)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		if section != profile {
+			continue
+		}
+		name, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		switch strings.TrimSpace(name) {
+		case "aws_access_key_id":
+			creds.AccessKeyID = strings.TrimSpace(value)
+		case "aws_secret_access_key":
+			creds.SecretAccessKey = strings.TrimSpace(value)
+		case "aws_session_token":
+			creds.SessionToken = strings.TrimSpace(value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return nil, nil
+	}
+	return &creds, nil
+}
+
+// newGCSRequest builds a JSON API media download. STORAGE_EMULATOR_HOST
+// redirects requests to a local emulator, as the Cloud SDKs do.
+func newGCSRequest(bucket, object string) (*http.Request, error) {
+	endpoint := "https://storage.googleapis.com"
+	if host := os.Getenv("STORAGE_EMULATOR_HOST"); host != "" {
+		endpoint = host
+		if !isRemoteURL(endpoint) {
+			endpoint = "http://" + endpoint
+		}
+	}
+
+	target := fmt.Sprintf("%s/storage/v1/b/%s/o/%s?alt=media",
+		strings.TrimSuffix(endpoint, "/"), url.PathEscape(bucket), url.PathEscape(object))
+	request, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if token := gcsAccessToken(); token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	return request, nil
+}
+
+// gcsTokenLifetime is how long a token printed by gcloud is reused. gcloud
+// prints tokens that last an hour, without their expiry, so they are dropped
+// well before it.
+const gcsTokenLifetime = 45 * time.Minute
+
+// gcsTokenCache keeps the last token gcloud printed, so --serve and watch
+// mode do not start gcloud on every render.
+var gcsTokenCache struct {
+	sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// printGCloudAccessToken runs gcloud for the application default
+// credentials token; tests replace it.
+var printGCloudAccessToken = func() (string, error) {
+	if _, err := exec.LookPath("gcloud"); err != nil {
+		return "", err
+	}
+	out, err := exec.Command("gcloud", "auth", "application-default", "print-access-token").Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+// gcsAccessToken returns GOOGLE_OAUTH_ACCESS_TOKEN or, failing that, the
+// application default credentials token gcloud reports, reused until it is
+// about to expire. An empty token means the object is read anonymously.
+func gcsAccessToken() string {
+	if token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		return token
+	}
+	if os.Getenv("STORAGE_EMULATOR_HOST") != "" {
+		return ""
+	}
+
+	gcsTokenCache.Lock()
+	defer gcsTokenCache.Unlock()
+	if gcsTokenCache.token != "" && time.Now().Before(gcsTokenCache.expires) {
+		return gcsTokenCache.token
+	}
+	token, err := printGCloudAccessToken()
+	if err != nil || token == "" {
+		return ""
+	}
+	gcsTokenCache.token, gcsTokenCache.expires = token, time.Now().Add(gcsTokenLifetime)
+	return token
+}
+
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSigV4SigningKeyMatchesAWSExample(t *testing.T) {
+	key := sigV4SigningKey("wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "20120215", "us-east-1", "iam")
+	if got := hex.EncodeToString(key); got != "f4780e2d9f65fa895f9c67b32ce1baf0b0d8a43505a000a1a9e090d414db404d" {
+		t.Fatalf("unexpected signing key %s", got)
+	}
+}
+
+func TestRunReadsTemplatesAndContextsFromS3(t *testing.T) {
+	var authorizations []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+		switch r.URL.Path {
+		case "/fixtures/emails/welcome.tmpl":
+			_, _ = w.Write([]byte("Hi {{ .name }}"))
+		case "/fixtures/contexts/user.json":
+			_, _ = w.Write([]byte(`{"name":"Ada"}`))
+		default:
+			http.Error(w, "no such key", http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	t.Setenv("AWS_ENDPOINT_URL_S3", server.URL)
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_REGION", "eu-west-1")
+
+	opts := renderOptions{RemoteAllow: []string{"s3://fixtures"}}
+	resp := run("s3://fixtures/emails/welcome.tmpl", "s3://fixtures/contexts/user.json", opts)
+	if resp.Error != "" || resp.Rendered != "Hi Ada" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	for _, authorization := range authorizations {
+		if !strings.HasPrefix(authorization, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") || !strings.Contains(authorization, "/eu-west-1/s3/aws4_request") {
+			t.Fatalf("expected SigV4 authorization, got %q", authorization)
+		}
+	}
+
+	resp = run("s3://fixtures/missing.tmpl", "", opts)
+	if !strings.Contains(resp.Error, "404") {
+		t.Fatalf("expected not found error, got %+v", resp)
+	}
+}
+
+func TestLoadAWSCredentialsReadsSharedFileProfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials")
+	writeFile(t, path, "[default]\naws_access_key_id = DEFAULT\naws_secret_access_key = one\n\n[preview]\naws_access_key_id = PREVIEW\naws_secret_access_key = two\naws_session_token = token\n")
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", path)
+	t.Setenv("AWS_PROFILE", "preview")
+
+	creds, err := loadAWSCredentials()
+	if err != nil || creds == nil || creds.AccessKeyID != "PREVIEW" || creds.SecretAccessKey != "two" || creds.SessionToken != "token" {
+		t.Fatalf("unexpected credentials %+v (%v)", creds, err)
+	}
+}
+
+func TestRunReadsTemplatesFromGCS(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.EscapedPath() != "/storage/v1/b/fixtures/o/emails%2Fwelcome.html" || r.URL.Query().Get("alt") != "media" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte("<p>{{ . }}</p>"))
+	}))
+	t.Cleanup(server.Close)
+
+	t.Setenv("STORAGE_EMULATOR_HOST", server.URL)
+	t.Setenv("GOOGLE_OAUTH_ACCESS_TOKEN", "test-token")
+
+	resp := run("gs://fixtures/emails/welcome.html", "", renderOptions{RemoteAllow: []string{"gs://fixtures/emails/"}})
+	if resp.Error != "" || resp.Rendered != "<p>map[]</p>" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+}
+
+func TestGCSAccessTokenReusesTheGCloudToken(t *testing.T) {
+	t.Setenv("GOOGLE_OAUTH_ACCESS_TOKEN", "")
+	t.Setenv("STORAGE_EMULATOR_HOST", "")
+	calls := 0
+	original := printGCloudAccessToken
+	printGCloudAccessToken = func() (string, error) {
+		calls++
+		return "token-" + strconv.Itoa(calls), nil
+	}
+	t.Cleanup(func() {
+		printGCloudAccessToken = original
+		gcsTokenCache.token, gcsTokenCache.expires = "", time.Time{}
+	})
+
+	if first, second := gcsAccessToken(), gcsAccessToken(); first != "token-1" || second != "token-1" || calls != 1 {
+		t.Fatalf("expected gcloud to run once, got %q, %q after %d calls", first, second, calls)
+	}
+
+	gcsTokenCache.expires = time.Now().Add(-time.Second)
+	if token := gcsAccessToken(); token != "token-2" || calls != 2 {
+		t.Fatalf("expected an expired token to be printed again, got %q after %d calls", token, calls)
+	}
+}
+
+func TestS3RequestsUseSigV4URIEncoding(t *testing.T) {
+	var received string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.RequestURI
+		_, _ = w.Write([]byte("ok"))
+	}))
+	t.Cleanup(server.Close)
+	t.Setenv("AWS_ENDPOINT_URL_S3", server.URL)
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+
+	if got := escapeS3Path("reports/a+b=c:d@e f~ü.txt"); got != "reports/a%2Bb%3Dc%3Ad%40e%20f~%C3%BC.txt" {
+		t.Fatalf("unexpected encoding %s", got)
+	}
+
+	// The path sent is the one signed.
+	request, err := newS3Request("fixtures", "reports/a+b=c:d@e.txt", time.Now().UTC())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path := request.URL.EscapedPath(); path != "/fixtures/reports/a%2Bb%3Dc%3Ad%40e.txt" {
+		t.Fatalf("unexpected request path %s", path)
+	}
+	if _, err := fetchObject("s3://fixtures/reports/a+b=c:d@e.txt", renderOptions{RemoteAllow: []string{"s3://fixtures"}}); err != nil {
+		t.Fatal(err)
+	}
+	if received != "/fixtures/reports/a%2Bb%3Dc%3Ad%40e.txt" {
+		t.Fatalf("expected the signed path to be sent, got %s", received)
+	}
+}
+
+func TestFetchObjectRequiresAllowlist(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		_, _ = w.Write([]byte("secret"))
+	}))
+	t.Cleanup(server.Close)
+	t.Setenv("AWS_ENDPOINT_URL_S3", server.URL)
+	t.Setenv("STORAGE_EMULATOR_HOST", server.URL)
+
+	for location, allowlist := range map[string][]string{
+		"s3://private/a.tmpl":          nil,
+		"s3://private/b.tmpl":          {"private"},
+		"s3://private/team-b/a.tmpl":   {"s3://private/team"},
+		"gs://fixtures/a.tmpl":         {"s3://fixtures"},
+		"s3://fixtures.evil/a.tmpl":    {"s3://fixtures"},
+		"gs://fixtures/emails2/a.tmpl": {"gs://fixtures/emails"},
+	} {
+		_, err := fetchObject(location, renderOptions{RemoteAllow: allowlist})
+		if err == nil || !strings.Contains(err.Error(), "not in the allowlist") {
+			t.Errorf("expected %s to be refused with %v, got %v", location, allowlist, err)
+		}
+	}
+	if requests != 0 {
+		t.Fatalf("expected no request for a disallowed object, got %d", requests)
+	}
+	if !remoteAllowed("s3://private/team/a.tmpl", []string{"s3://private/team"}) {
+		t.Fatal("expected a bucket prefix entry to match")
+	}
+}
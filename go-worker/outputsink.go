@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// validateOutputSinks rejects --out and --diff outside a single render,
+// where there is no one output to write or compare.
+func validateOutputSinks(opts renderOptions) error {
+	if opts.Out == "" && opts.DiffAgainst == "" {
+		return nil
+	}
+	if opts.Mode != "" && opts.Mode != "render" {
+		return errors.New("--out and --diff only apply to render mode")
+	}
+	if len(opts.ContextProfiles) > 0 || strings.TrimSpace(opts.ContextManifest) != "" {
+		return errors.New("--out and --diff cannot be combined with context profiles")
+	}
+	return nil
+}
+
+// applyOutputSinks sends a successful render to --out and --diff in place
+// of the response: --diff compares it with a file and returns a unified
+// diff, and --out writes it to a file, leaving the file untouched when it
+// already holds the output, so build tools do not see a change. Changed
+// reports whether the output differs from the --diff file, or without
+// --diff, from what --out held before. A missing file counts as empty and
+// changed.
+func applyOutputSinks(resp response, templatePath string, opts renderOptions) response {
+	if resp.Error != "" || (opts.Out == "" && opts.DiffAgainst == "") {
+		return resp
+	}
+	rendered := resp.Rendered
+	resp.Rendered = ""
+
+	if opts.DiffAgainst != "" {
+		existing, found, err := readOutputFile(opts.DiffAgainst)
+		if err != nil {
+			return outputSinkFailure(resp, "diff: "+err.Error(), opts.DiffAgainst)
+		}
+		changed := !found || existing != rendered
+		resp.Changed = &changed
+		resp.Diff = unifiedDiff(opts.DiffAgainst, templatePath, existing, rendered)
+	}
+
+	if opts.Out != "" {
+		existing, found, err := readOutputFile(opts.Out)
+		if err != nil {
+			return outputSinkFailure(resp, "out: "+err.Error(), opts.Out)
+		}
+		changed := !found || existing != rendered
+		if resp.Changed == nil {
+			resp.Changed = &changed
+		}
+		if changed {
+			if err := replaceOutputFile(opts.Out, rendered); err != nil {
+				return outputSinkFailure(resp, "out: "+err.Error(), opts.Out)
+			}
+		}
+		resp.OutFile = opts.Out
+	}
+	return resp
+}
+
+func outputSinkFailure(resp response, message, path string) response {
+	resp.Diagnostics = append(resp.Diagnostics, diagnostic{Message: message, Severity: "error", File: path})
+	resp.Error = message
+	return resp
+}
+
+// readOutputFile returns the contents of path, and false when it does not
+// exist.
+func readOutputFile(path string) (string, bool, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return string(content), true, nil
+}
+
+// replaceOutputFile replaces path through a temporary file in the same
+// directory, so readers see the old output or the new one and never part
+// of it. An existing file keeps its permissions; a new one gets 0644, and
+// its parent directories are created.
+func replaceOutputFile(path, content string) error {
+	mode := os.FileMode(0o644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	temp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tempPath := temp.Name()
+	_, err = temp.WriteString(content)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tempPath, mode)
+	}
+	if err == nil {
+		err = os.Rename(tempPath, path)
+	}
+	if err != nil {
+		_ = os.Remove(tempPath)
+	}
+	return err
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunWithOutWritesOnlyChangedOutput(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "config.tmpl")
+	contextPath := filepath.Join(dir, "context.json")
+	outPath := filepath.Join(dir, "gen", "config.yaml")
+	writeFile(t, templatePath, "port: {{ .port }}\n")
+	writeFile(t, contextPath, `{"port":8080}`)
+
+	resp := run(templatePath, contextPath, renderOptions{Out: outPath})
+	if resp.Error != "" || resp.Rendered != "" || resp.OutFile != outPath || resp.Changed == nil || !*resp.Changed {
+		t.Fatalf("unexpected first response: %+v", resp)
+	}
+	if content, err := os.ReadFile(outPath); err != nil || string(content) != "port: 8080\n" {
+		t.Fatalf("unexpected output file: %q, %v", content, err)
+	}
+
+	// An unchanged output leaves the file alone.
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(outPath, past, past); err != nil {
+		t.Fatal(err)
+	}
+	resp = run(templatePath, contextPath, renderOptions{Out: outPath})
+	if resp.Error != "" || resp.Changed == nil || *resp.Changed {
+		t.Fatalf("unexpected second response: %+v", resp)
+	}
+	if info, err := os.Stat(outPath); err != nil || !info.ModTime().Equal(past) {
+		t.Fatalf("expected the output file to be left alone, got %v, %v", info.ModTime(), err)
+	}
+
+	if entries, _ := os.ReadDir(filepath.Dir(outPath)); len(entries) != 1 {
+		t.Fatalf("expected no temporary files to be left, got %v", entries)
+	}
+}
+
+func TestRunWithDiffReturnsUnifiedDiff(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "config.tmpl")
+	existingPath := filepath.Join(dir, "config.yaml")
+	writeFile(t, templatePath, "name: web\nport: {{ .port }}\n")
+	writeFile(t, existingPath, "name: web\nport: 80\n")
+	contextPath := filepath.Join(dir, "context.json")
+
+	writeFile(t, contextPath, `{"port":80}`)
+	resp := run(templatePath, contextPath, renderOptions{DiffAgainst: existingPath})
+	if resp.Error != "" || resp.Rendered != "" || resp.Diff != "" || resp.Changed == nil || *resp.Changed {
+		t.Fatalf("unexpected unchanged response: %+v", resp)
+	}
+
+	writeFile(t, contextPath, `{"port":8080}`)
+	resp = run(templatePath, contextPath, renderOptions{DiffAgainst: existingPath})
+	if resp.Error != "" || resp.Changed == nil || !*resp.Changed {
+		t.Fatalf("unexpected changed response: %+v", resp)
+	}
+	if !strings.Contains(resp.Diff, "-port: 80\n+port: 8080\n") {
+		t.Fatalf("unexpected diff:\n%s", resp.Diff)
+	}
+
+	resp = run(templatePath, contextPath, renderOptions{DiffAgainst: filepath.Join(dir, "missing.yaml")})
+	if resp.Error != "" || resp.Changed == nil || !*resp.Changed || !strings.Contains(resp.Diff, "+name: web\n") {
+		t.Fatalf("expected a missing file to diff as empty, got %+v", resp)
+	}
+
+	resp = run(templatePath, contextPath, renderOptions{Mode: "check", DiffAgainst: existingPath})
+	if resp.Error != "--out and --diff only apply to render mode" {
+		t.Fatalf("expected mode error, got %+v", resp)
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+// restrictToProductionFuncs drops the worker's convenience helpers that the
+// production FuncMap does not register. It runs whenever --funcs-from gives a
+// profile, and under --production-parity without one only the Go builtins
+// remain, which matches a bare template.New(...).Parse call.
+func restrictToProductionFuncs[M ~map[string]interface{}](funcs M, profile *funcProfile) {
+	for name := range funcs {
+		if profile == nil || !profile.Names[name] {
+			delete(funcs, name)
+		}
+	}
+}
+
+// escalateDiagnostics promotes warnings to errors for modes where anything
+// the preview tolerates would fail in production.
+func escalateDiagnostics(diagnostics []diagnostic) []diagnostic {
+	for i := range diagnostics {
+		if diagnostics[i].Severity == "warning" {
+			diagnostics[i].Severity = "error"
+		}
+	}
+	return diagnostics
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProductionParityDropsEditorHelpers(t *testing.T) {
+	_, err := renderTemplateWithOptions("page.tmpl", `{{ "go" | upper }}`, nil, renderOptions{ProductionParity: true})
+	if err == nil || !strings.Contains(err.Error(), `function "upper" not defined`) {
+		t.Fatalf("expected helper to be unavailable in production parity mode, got %v", err)
+	}
+
+	rendered, err := renderTemplateWithOptions("page.tmpl", `{{ printf "%s!" .name }}`, map[string]any{"name": "Go"}, renderOptions{ProductionParity: true})
+	if err != nil {
+		t.Fatalf("expected builtins to keep working, got %v", err)
+	}
+	if rendered != "Go!" {
+		t.Fatalf("unexpected rendered output: %q", rendered)
+	}
+}
+
+func TestProductionParityKeepsProfileFunctions(t *testing.T) {
+	sourcePath, _ := writeFuncProfileFixtures(t)
+	dir := t.TempDir()
+
+	templatePath := filepath.Join(dir, "page.tmpl")
+	if err := os.WriteFile(templatePath, []byte(`{{ upper "a" }}{{ lower "B" }}`), 0o600); err != nil {
+		t.Fatalf("failed to write template file: %v", err)
+	}
+
+	resp := executeWithOptions(templatePath, "", renderOptions{FuncsFrom: sourcePath, ProductionParity: true})
+	if resp.Error == "" || !strings.Contains(resp.Error, `function "lower" not defined`) {
+		t.Fatalf("expected lower to be rejected, got %+v", resp)
+	}
+
+	for _, diag := range resp.Diagnostics {
+		if diag.Severity != "error" {
+			t.Fatalf("expected all diagnostics to be errors in parity mode, got %+v", diag)
+		}
+	}
+}
+
+func TestEscalateDiagnostics(t *testing.T) {
+	diagnostics := escalateDiagnostics([]diagnostic{{Severity: "warning"}, {Severity: "error"}})
+	for _, diag := range diagnostics {
+		if diag.Severity != "error" {
+			t.Fatalf("expected escalated severity, got %q", diag.Severity)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"text/template/parse"
+)
+
+// parseTrees parses content into its named trees without requiring the
+// functions it calls to be registered, so static analysis can run against
+// templates written for FuncMaps the worker does not know about.
+func parseTrees(name, content string) (map[string]*parse.Tree, error) {
+	return parseTreesWithDelims(name, content, "", "")
+}
+
+func parseTreesWithDelims(name, content, leftDelim, rightDelim string) (map[string]*parse.Tree, error) {
+	tree := parse.New(name)
+	tree.Mode = parse.ParseComments | parse.SkipFuncCheck
+	treeSet := make(map[string]*parse.Tree)
+	if _, err := tree.Parse(content, leftDelim, rightDelim, treeSet); err != nil {
+		return nil, err
+	}
+	return treeSet, nil
+}
+
+// sortedTreeNames returns tree names in a stable order with the root first.
+func sortedTreeNames(trees map[string]*parse.Tree, root string) []string {
+	names := make([]string, 0, len(trees))
+	for name := range trees {
+		if name != root {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if _, ok := trees[root]; ok {
+		names = append([]string{root}, names...)
+	}
+	return names
+}
+
+// walkNodes visits node and its descendants depth-first. Returning false from
+// visit skips the children of the current node.
+func walkNodes(node parse.Node, visit func(parse.Node) bool) {
+	if node == nil {
+		return
+	}
+
+	switch typed := node.(type) {
+	case *parse.ListNode:
+		if typed == nil {
+			return
+		}
+	case *parse.PipeNode:
+		if typed == nil {
+			return
+		}
+	}
+
+	if !visit(node) {
+		return
+	}
+
+	switch typed := node.(type) {
+	case *parse.ListNode:
+		for _, child := range typed.Nodes {
+			walkNodes(child, visit)
+		}
+	case *parse.ActionNode:
+		walkNodes(typed.Pipe, visit)
+	case *parse.PipeNode:
+		for _, decl := range typed.Decl {
+			walkNodes(decl, visit)
+		}
+		for _, cmd := range typed.Cmds {
+			walkNodes(cmd, visit)
+		}
+	case *parse.CommandNode:
+		for _, arg := range typed.Args {
+			walkNodes(arg, visit)
+		}
+	case *parse.ChainNode:
+		walkNodes(typed.Node, visit)
+	case *parse.IfNode:
+		walkBranch(&typed.BranchNode, visit)
+	case *parse.RangeNode:
+		walkBranch(&typed.BranchNode, visit)
+	case *parse.WithNode:
+		walkBranch(&typed.BranchNode, visit)
+	case *parse.TemplateNode:
+		walkNodes(typed.Pipe, visit)
+	}
+}
+
+func walkBranch(branch *parse.BranchNode, visit func(parse.Node) bool) {
+	walkNodes(branch.Pipe, visit)
+	walkNodes(branch.List, visit)
+	walkNodes(branch.ElseList, visit)
+}
+
+// calledFunctions returns every function identifier referenced by trees.
+func calledFunctions(trees map[string]*parse.Tree) map[string][]parse.Pos {
+	calls := make(map[string][]parse.Pos)
+	for _, tree := range trees {
+		walkNodes(tree.Root, func(node parse.Node) bool {
+			if ident, ok := node.(*parse.IdentifierNode); ok {
+				calls[ident.Ident] = append(calls[ident.Ident], ident.Position())
+			}
+			return true
+		})
+	}
+	return calls
+}
+
+// lineColumn converts a byte offset into 1-based line and column numbers.
+func lineColumn(content string, pos parse.Pos) (int, int) {
+	offset := int(pos)
+	if offset > len(content) {
+		offset = len(content)
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	prefix := content[:offset]
+	line := strings.Count(prefix, "\n") + 1
+	column := offset - strings.LastIndex(prefix, "\n")
+	return line, column
+}
@@ -0,0 +1,47 @@
+package main
+
+import "testing"
+
+func TestParseTreesSkipsFunctionCheck(t *testing.T) {
+	trees, err := parseTrees("page.tmpl", `{{ define "item" }}{{ unknownFn . }}{{ end }}{{ template "item" . }}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	names := sortedTreeNames(trees, "page.tmpl")
+	if len(names) != 2 || names[0] != "page.tmpl" || names[1] != "item" {
+		t.Fatalf("unexpected tree names: %v", names)
+	}
+
+	calls := calledFunctions(trees)
+	if len(calls["unknownFn"]) != 1 {
+		t.Fatalf("expected unknownFn to be recorded, got %v", calls)
+	}
+}
+
+func TestWalkNodesVisitsBranches(t *testing.T) {
+	trees, err := parseTrees("page.tmpl", `{{ if .a }}{{ upper .b }}{{ else }}{{ range .c }}{{ lower . }}{{ end }}{{ end }}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	calls := calledFunctions(trees)
+	for _, name := range []string{"upper", "lower"} {
+		if _, ok := calls[name]; !ok {
+			t.Fatalf("expected %s to be visited, got %v", name, calls)
+		}
+	}
+}
+
+func TestLineColumn(t *testing.T) {
+	content := "first\nsecond {{ x }}"
+	line, column := lineColumn(content, 13)
+	if line != 2 || column != 8 {
+		t.Fatalf("expected 2:8, got %d:%d", line, column)
+	}
+
+	line, column = lineColumn(content, 0)
+	if line != 1 || column != 1 {
+		t.Fatalf("expected 1:1, got %d:%d", line, column)
+	}
+}
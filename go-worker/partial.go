@@ -0,0 +1,504 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template/parse"
+	"time"
+)
+
+const (
+	// partialCaptureFunc is the hidden helper a capture render calls where
+	// the selection starts, with dot and the variables in scope.
+	partialCaptureFunc = "__goTemplateStudioCapture"
+	// partialVarFunc returns a captured variable to the partial template.
+	partialVarFunc = "__goTemplateStudioPartialVar"
+	// partialTemplateName is the template the selection runs as.
+	partialTemplateName = "__goTemplateStudioPartial"
+)
+
+// partialReport describes what partial mode ran: the define or block
+// holding the selection, where the selection starts, and the dot and
+// variables it ran with. Reused reports that they came from an earlier
+// request's capture instead of a full render run for this one.
+type partialReport struct {
+	Template string                     `json:"template"`
+	Location sourceLocation             `json:"location"`
+	Source   string                     `json:"source"`
+	Dot      json.RawMessage            `json:"dot,omitempty"`
+	DotType  string                     `json:"dotType,omitempty"`
+	Vars     map[string]json.RawMessage `json:"vars,omitempty"`
+	Reused   bool                       `json:"reused"`
+}
+
+// partialSelection is the part of the template partial mode runs: a whole
+// define or block (whole), or the if, with, or range at pos in it. start
+// and end are the source extent from its opening action through its end.
+type partialSelection struct {
+	tree       string
+	whole      bool
+	pos        parse.Pos
+	source     templateSource
+	start, end int
+	opening    string
+}
+
+// partialCapture holds the dot and variables the selection first ran with
+// in a full render.
+type partialCapture struct {
+	selection partialSelection
+	key       string
+	captured  bool
+	dot       interface{}
+	names     []string
+	vars      map[string]interface{}
+}
+
+// executePartial runs only the selected define or block, named by
+// opts.Block, or the innermost if, with, range, or define around the
+// cursor. The dot and variables are those of the selection's first run in
+// a full render; the server keeps them, so later
+// requests for the same selection skip the full render until the context
+// or the template outside the selection changes.
+func executePartial(templatePath, contextPath string, opts renderOptions) response {
+	if templatePath == "" {
+		return response{Error: "template path is required"}
+	}
+	content, err := readTemplate(templatePath, opts)
+	if err != nil {
+		return response{Error: err.Error()}
+	}
+	name := templateName(templatePath)
+	trees, includes, _, failure := parseTemplateSet(templatePath, name, content, opts)
+	if failure != nil {
+		return *failure
+	}
+	sources := map[string]templateSource{name: {Name: name, Path: templatePath, Content: content}}
+	for _, include := range includes {
+		sources[include.Name] = include
+	}
+
+	selection, err := selectPartial(trees, sources, name, content, opts)
+	if err != nil {
+		return response{Error: err.Error()}
+	}
+	key := partialCaptureKey(templatePath, contextPath, selection, sources, opts)
+
+	capture := opts.cache.capture(templatePath, key)
+	reused := capture != nil
+	if capture == nil {
+		capture = &partialCapture{selection: selection, key: key}
+		captureOpts := opts
+		captureOpts.Mode = ""
+		captureOpts.capture = capture
+		// The capture call is instrumented into the parse, which must not
+		// be cached for ordinary renders.
+		captureOpts.cache = nil
+		captureOpts.SourceMap, captureOpts.ValueOrigins, captureOpts.Trace, captureOpts.Profile = false, false, false, false
+		full := executeWithOptions(templatePath, contextPath, captureOpts)
+		if full.Error != "" {
+			return full
+		}
+		if !capture.captured {
+			return response{
+				Diagnostics: full.Diagnostics,
+				Error:       fmt.Sprintf("%s did not run with this context, so there is no dot to run it with", selection.describe()),
+			}
+		}
+		opts.cache.storeCapture(templatePath, capture)
+	}
+
+	opts.partial = capture
+	if opts.project != nil {
+		aliases, _ := resolveAliasIncludes(templatePath, content, opts)
+		opts.includes = aliases
+	}
+	opts.includes = append(opts.includes, includes...)
+	rendered, run, err := renderTemplateRun(templatePath, content, capture.dot, opts)
+
+	line, column := lineColumn(selection.source.Content, parse.Pos(selection.start))
+	report := &partialReport{
+		Template: selection.tree,
+		Location: sourceLocation{File: selection.source.Path, Line: line, Column: column},
+		Source:   selection.opening,
+		Dot:      traceValue(capture.dot),
+		DotType:  fmt.Sprintf("%T", capture.dot),
+		Reused:   reused,
+	}
+	if len(capture.names) > 0 {
+		report.Vars = map[string]json.RawMessage{}
+		for _, variable := range capture.names {
+			report.Vars[variable] = traceValue(capture.vars[variable])
+		}
+	}
+	resp := response{Partial: report, Timings: &run.timings, CacheHit: run.cacheHit, SourceMap: run.sourceMap, ValueOrigins: run.valueOrigins, Trace: run.trace, Profile: run.profile}
+	if err != nil {
+		resp.Diagnostics = []diagnostic{templateDiagnosticWithDelims(err, templatePath, content, opts.LeftDelim, opts.RightDelim)}
+		resp.Error = err.Error()
+		var limit *limitError
+		if errors.As(err, &limit) {
+			resp.errorCode = errorCodeLimit
+		}
+		return resp
+	}
+	resp.Rendered = rendered
+	return resp
+}
+
+// selectPartial resolves opts.Block, or otherwise the cursor, to a
+// selection.
+func selectPartial(trees map[string]*parse.Tree, sources map[string]templateSource, name, content string, opts renderOptions) (partialSelection, error) {
+	if block := strings.TrimSpace(opts.Block); block != "" {
+		tree, ok := trees[block]
+		if !ok {
+			return partialSelection{}, fmt.Errorf("no define or block named %q", block)
+		}
+		source := sources[tree.ParseName]
+		selection := partialSelection{tree: block, whole: true, source: source, end: len(source.Content)}
+		if block != name {
+			actions := scanActions(source.Content, opts.LeftDelim, opts.RightDelim)
+			for i, action := range actions {
+				if keyword := action.Keyword(); keyword != "define" && keyword != "block" {
+					continue
+				}
+				if declared, ok := quotedActionArgument(action); ok && declared == block {
+					selection.start, selection.end = action.Start, matchingEnd(actions, i)
+					selection.opening = source.Content[action.Start:action.End]
+					break
+				}
+			}
+		}
+		return selection, nil
+	}
+
+	if opts.Line < 1 {
+		return partialSelection{}, errors.New("partial mode requires --block or --line and --column")
+	}
+	offset, err := cursorOffset(content, opts)
+	if err != nil {
+		return partialSelection{}, err
+	}
+	actions := scanActions(content, opts.LeftDelim, opts.RightDelim)
+	var best *partialSelection
+	consider := func(candidate partialSelection) {
+		if candidate.start <= offset && offset < candidate.end && (best == nil || candidate.end-candidate.start < best.end-best.start) {
+			best = &candidate
+		}
+	}
+	for treeName, tree := range trees {
+		if tree.ParseName != name {
+			continue
+		}
+		if treeName != name {
+			for i, action := range actions {
+				if keyword := action.Keyword(); keyword != "define" && keyword != "block" {
+					continue
+				}
+				if declared, ok := quotedActionArgument(action); ok && declared == treeName {
+					consider(partialSelection{
+						tree: treeName, whole: true, source: sources[name],
+						start: action.Start, end: matchingEnd(actions, i), opening: content[action.Start:action.End],
+					})
+				}
+			}
+		}
+		walkControlNodes(tree.Root, func(node parse.Node) {
+			for i, action := range actions {
+				if action.Start <= int(node.Position()) && int(node.Position()) < action.End {
+					consider(partialSelection{
+						tree: treeName, pos: node.Position(), source: sources[name],
+						start: action.Start, end: matchingEnd(actions, i), opening: content[action.Start:action.End],
+					})
+					return
+				}
+			}
+		})
+	}
+	if best == nil {
+		return partialSelection{}, fmt.Errorf("no define, block, if, with, or range at line %d, column %d", opts.Line, opts.Column)
+	}
+	return *best, nil
+}
+
+func (s partialSelection) describe() string {
+	if s.whole {
+		return fmt.Sprintf("template %q", s.tree)
+	}
+	return fmt.Sprintf("%s in template %q", s.opening, s.tree)
+}
+
+// walkControlNodes calls visit for every if, with, and range under list.
+func walkControlNodes(list *parse.ListNode, visit func(parse.Node)) {
+	if list == nil {
+		return
+	}
+	for _, node := range list.Nodes {
+		var branch *parse.BranchNode
+		switch typed := node.(type) {
+		case *parse.IfNode:
+			branch = &typed.BranchNode
+		case *parse.WithNode:
+			branch = &typed.BranchNode
+		case *parse.RangeNode:
+			branch = &typed.BranchNode
+		default:
+			continue
+		}
+		visit(node)
+		walkControlNodes(branch.List, visit)
+		walkControlNodes(branch.ElseList, visit)
+	}
+}
+
+// matchingEnd returns the end offset of the {{end}} closing actions[open].
+func matchingEnd(actions []actionSpan, open int) int {
+	depth := 0
+	for _, action := range actions[open:] {
+		switch action.Keyword() {
+		case "if", "with", "range", "block", "define":
+			depth++
+		case "end":
+			depth--
+			if depth == 0 {
+				return action.End
+			}
+		}
+	}
+	return actions[len(actions)-1].End
+}
+
+// partialCaptureKey hashes what the captured dot depends on: the template
+// and context paths, when the context files last changed, the overrides,
+// and every template source with the selection itself cut out, so editing
+// inside the selection keeps the capture and editing around it does not.
+func partialCaptureKey(templatePath, contextPath string, selection partialSelection, sources map[string]templateSource, opts renderOptions) string {
+	hash := sha256.New()
+	write := func(value string) {
+		hash.Write([]byte(strconv.Itoa(len(value))))
+		hash.Write([]byte{':'})
+		hash.Write([]byte(value))
+	}
+	write(templatePath)
+	for _, path := range append([]string{contextPath}, opts.ContextLayers...) {
+		write(path)
+		if info, err := os.Stat(path); err == nil {
+			write(info.ModTime().Format(time.RFC3339Nano))
+		}
+	}
+	write(strings.Join(opts.Set, "\n"))
+	write(strings.Join(opts.SetJSON, "\n"))
+	write(selection.tree)
+	write(strconv.Itoa(int(selection.pos)))
+	write(selection.opening)
+	names := make([]string, 0, len(sources))
+	for sourceName := range sources {
+		names = append(names, sourceName)
+	}
+	sort.Strings(names)
+	for _, sourceName := range names {
+		source := sources[sourceName]
+		write(sourceName)
+		if sourceName == selection.source.Name {
+			write(source.Content[:selection.start] + source.Content[selection.end:])
+			continue
+		}
+		write(source.Content)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// instrument inserts the capture call where the selection starts in tree:
+// first in the body of a whole template, or just before the selected node,
+// passing the variables in scope there.
+func (c *partialCapture) instrument(tree *parse.Tree) {
+	if tree == nil || tree.Name != c.selection.tree {
+		return
+	}
+	if c.selection.whole {
+		tree.Root.Nodes = append([]parse.Node{c.call(tree, tree.Root.Position(), nil)}, tree.Root.Nodes...)
+		return
+	}
+	c.instrumentList(tree, tree.Root, []string{"$"})
+}
+
+func (c *partialCapture) instrumentList(tree *parse.Tree, list *parse.ListNode, scope []string) bool {
+	if list == nil {
+		return false
+	}
+	for i, node := range list.Nodes {
+		var branch *parse.BranchNode
+		switch typed := node.(type) {
+		case *parse.ActionNode:
+			if !isHiddenAction(typed) && !typed.Pipe.IsAssign {
+				for _, variable := range typed.Pipe.Decl {
+					scope = append(scope, variable.Ident[0])
+				}
+			}
+			continue
+		case *parse.IfNode:
+			branch = &typed.BranchNode
+		case *parse.WithNode:
+			branch = &typed.BranchNode
+		case *parse.RangeNode:
+			branch = &typed.BranchNode
+		default:
+			continue
+		}
+		if node.Position() == c.selection.pos {
+			nodes := append([]parse.Node{}, list.Nodes[:i]...)
+			nodes = append(nodes, c.call(tree, node.Position(), scope))
+			list.Nodes = append(nodes, list.Nodes[i:]...)
+			return true
+		}
+		nested := append([]string{}, scope...)
+		if !branch.Pipe.IsAssign {
+			for _, variable := range branch.Pipe.Decl {
+				nested = append(nested, variable.Ident[0])
+			}
+		}
+		if c.instrumentList(tree, branch.List, nested) || c.instrumentList(tree, branch.ElseList, nested) {
+			return true
+		}
+	}
+	return false
+}
+
+// call builds {{ $partialCaptureFunc := partialCaptureFunc "names" . $vars... }}.
+func (c *partialCapture) call(tree *parse.Tree, pos parse.Pos, scope []string) *parse.ActionNode {
+	names := strings.Join(scope, ",")
+	args := []parse.Node{
+		parse.NewIdentifier(partialCaptureFunc).SetTree(tree).SetPos(pos),
+		&parse.StringNode{NodeType: parse.NodeString, Pos: pos, Quoted: strconv.Quote(names), Text: names},
+		&parse.DotNode{NodeType: parse.NodeDot, Pos: pos},
+	}
+	for _, variable := range scope {
+		args = append(args, &parse.VariableNode{NodeType: parse.NodeVariable, Pos: pos, Ident: []string{variable}})
+	}
+	return &parse.ActionNode{
+		NodeType: parse.NodeAction,
+		Pos:      pos,
+		Pipe: &parse.PipeNode{
+			NodeType: parse.NodePipe,
+			Pos:      pos,
+			Decl:     []*parse.VariableNode{{NodeType: parse.NodeVariable, Pos: pos, Ident: []string{"$" + partialCaptureFunc}}},
+			Cmds:     []*parse.CommandNode{{NodeType: parse.NodeCommand, Pos: pos, Args: args}},
+		},
+	}
+}
+
+// record is registered as partialCaptureFunc; only the first run counts.
+func (c *partialCapture) record(names string, dot interface{}, values ...interface{}) string {
+	if c.captured {
+		return ""
+	}
+	c.captured, c.dot, c.vars = true, dot, map[string]interface{}{}
+	if names != "" {
+		c.names = strings.Split(names, ",")
+	}
+	for i, variable := range c.names {
+		if i < len(values) {
+			c.vars[variable] = values[i]
+		}
+	}
+	return ""
+}
+
+// variable is registered as partialVarFunc.
+func (c *partialCapture) variable(name string) interface{} {
+	return c.vars[name]
+}
+
+// tree builds the partial template from base, the parsed template holding
+// the selection: declarations restoring the captured variables, then the
+// selected node, or the whole body.
+func (c *partialCapture) tree(base *parse.Tree) (*parse.Tree, error) {
+	tree := base.Copy()
+	tree.Name = partialTemplateName
+	if c.selection.whole {
+		return tree, nil
+	}
+	var selected parse.Node
+	walkControlNodes(tree.Root, func(node parse.Node) {
+		if selected == nil && node.Position() == c.selection.pos {
+			selected = node
+		}
+	})
+	if selected == nil {
+		return nil, fmt.Errorf("%s is no longer in the template", c.selection.describe())
+	}
+	pos := selected.Position()
+	root := &parse.ListNode{NodeType: parse.NodeList, Pos: pos}
+	for _, variable := range c.names {
+		ident := parse.NewIdentifier(partialVarFunc).SetTree(tree).SetPos(pos)
+		arg := &parse.StringNode{NodeType: parse.NodeString, Pos: pos, Quoted: strconv.Quote(variable), Text: variable}
+		root.Nodes = append(root.Nodes, &parse.ActionNode{
+			NodeType: parse.NodeAction,
+			Pos:      pos,
+			Pipe: &parse.PipeNode{
+				NodeType: parse.NodePipe,
+				Pos:      pos,
+				Decl:     []*parse.VariableNode{{NodeType: parse.NodeVariable, Pos: pos, Ident: []string{variable}}},
+				Cmds:     []*parse.CommandNode{{NodeType: parse.NodeCommand, Pos: pos, Args: []parse.Node{ident, arg}}},
+			},
+		})
+	}
+	tree.Root = root
+	root.Nodes = append(root.Nodes, selected)
+	return tree, nil
+}
+
+// execute runs the selection of tmpl with the captured dot. Errors name
+// the template the selection is in rather than the partial template.
+func (c *partialCapture) execute(tmpl parsedTemplate, out io.Writer, funcs map[string]interface{}) error {
+	bound := make(map[string]interface{}, len(funcs)+1)
+	for name, fn := range funcs {
+		bound[name] = fn
+	}
+	bound[partialVarFunc] = c.variable
+	err := tmpl.executePartial(out, c.selection.tree, c.tree, c.dot, bound)
+	if err == nil {
+		return nil
+	}
+	var limit *limitError
+	if errors.As(err, &limit) {
+		return err
+	}
+	return errors.New(strings.ReplaceAll(err.Error(), strconv.Quote(partialTemplateName), strconv.Quote(c.selection.tree)))
+}
+
+// capture returns the capture the server keeps for path when it was made
+// under key.
+func (c *templateCache) capture(path, key string) *partialCapture {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if capture, ok := c.captures[path]; ok && capture.key == key {
+		return capture
+	}
+	return nil
+}
+
+func (c *templateCache) storeCapture(path string, capture *partialCapture) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.captures[path]; !ok && len(c.captures) >= maxCachedTemplates {
+		for evicted := range c.captures {
+			delete(c.captures, evicted)
+			break
+		}
+	}
+	c.captures[path] = capture
+}
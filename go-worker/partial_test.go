@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPartialRunsABlockWithItsCapturedDot(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "page.tmpl")
+	writeFile(t, templatePath, "Header\n{{ template \"card\" .user }}\n{{ define \"card\" }}<{{ .name }}>{{ end }}")
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, contextPath, `{"user": {"name": "Ada"}}`)
+
+	resp := run(templatePath, contextPath, renderOptions{Mode: "partial", Block: "card"})
+	if resp.Error != "" || resp.Rendered != "<Ada>" || resp.Partial == nil {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	if resp.Partial.Template != "card" || resp.Partial.Location.Line != 3 || string(resp.Partial.Dot) != `{"name":"Ada"}` || resp.Partial.Reused {
+		t.Fatalf("unexpected partial report: %+v", resp.Partial)
+	}
+
+	if resp := run(templatePath, contextPath, renderOptions{Mode: "partial", Block: "missing"}); !strings.Contains(resp.Error, `no define or block named "missing"`) {
+		t.Fatalf("expected an unknown block to fail, got %+v", resp)
+	}
+	writeFile(t, templatePath, "{{ if .never }}{{ template \"card\" . }}{{ end }}{{ define \"card\" }}x{{ end }}")
+	if resp := run(templatePath, contextPath, renderOptions{Mode: "partial", Block: "card"}); !strings.Contains(resp.Error, "did not run with this context") {
+		t.Fatalf("expected an unreached block to fail, got %+v", resp)
+	}
+}
+
+func TestPartialRunsTheNodeUnderTheCursorWithItsVariables(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "page.tmpl")
+	writeFile(t, templatePath, "{{ $title := .title }}{{ range $i, $item := .items }}\n{{ with .tags }}{{ $title }} #{{ $i }} {{ $item.name }}: {{ join \",\" . }} ({{ $.owner }}){{ end }}\n{{ end }}")
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, contextPath, `{"title": "Shop", "owner": "Ada", "items": [{"name": "a", "tags": ["x", "y"]}, {"name": "b", "tags": ["z"]}]}`)
+
+	resp := run(templatePath, contextPath, renderOptions{Mode: "partial", Line: 2, Column: 20})
+	if resp.Error != "" || resp.Rendered != "Shop #0 a: x,y (Ada)" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	if resp.Partial.Source != "{{ with .tags }}" || resp.Partial.Location.Line != 2 || string(resp.Partial.Vars["$item"]) != `{"name":"a","tags":["x","y"]}` {
+		t.Fatalf("unexpected partial report: %+v", resp.Partial)
+	}
+
+	resp = run(templatePath, contextPath, renderOptions{Mode: "partial", Line: 1, Column: 5})
+	if !strings.Contains(resp.Error, "no define, block, if, with, or range") {
+		t.Fatalf("expected the top level to be rejected, got %+v", resp)
+	}
+}
+
+func TestPartialServerReusesTheCaptureUntilTheSurroundingTemplateChanges(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "page.html")
+	writeFile(t, templatePath, `<main>{{ block "body" .page }}<p>{{ .text }}</p>{{ end }}</main>`)
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, contextPath, `{"page": {"text": "<hi>"}}`)
+
+	var out bytes.Buffer
+	in := strings.NewReader(`{"id": 1, "mode": "partial", "block": "body", "template": ` + quoteJSON(templatePath) + `, "context": ` + quoteJSON(contextPath) + "}\n")
+	if err := serve(in, &out, renderOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), `"rendered":"\u003cp\u003e\u0026lt;hi\u0026gt;\u003c/p\u003e"`) || !strings.Contains(out.String(), `"template":"body"`) {
+		t.Fatalf("expected the server to run the block escaped, got %s", out.String())
+	}
+
+	cache := newTemplateCache()
+	opts := renderOptions{Mode: "partial", Block: "body", cache: cache}
+	if resp := run(templatePath, contextPath, opts); resp.Partial.Reused {
+		t.Fatal("expected the first request to capture")
+	}
+	writeFile(t, templatePath, `<main>{{ block "body" .page }}<b>{{ .text }}</b>{{ end }}</main>`)
+	if resp := run(templatePath, contextPath, opts); !resp.Partial.Reused || resp.Rendered != "<b>&lt;hi&gt;</b>" {
+		t.Fatalf("expected an edit inside the block to reuse the capture, got %+v", resp)
+	}
+	writeFile(t, templatePath, `<div>{{ block "body" .page }}<b>{{ .text }}</b>{{ end }}</div>`)
+	if resp := run(templatePath, contextPath, opts); resp.Partial.Reused {
+		t.Fatal("expected an edit around the block to capture again")
+	}
+}
@@ -0,0 +1,453 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"unicode/utf8"
+)
+
+// textPosition is a 1-based line/column pair plus the equivalent 0-based
+// byte offset. Columns count bytes from the start of the line internally;
+// applyPositionEncoding converts them for clients that negotiated UTF-16 or
+// UTF-32 columns.
+type textPosition struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+	Offset int `json:"offset"`
+}
+
+// lineStarts returns the byte offset at which every line begins. Both "\n"
+// and "\r\n" terminate a line.
+func lineStarts(content string) []int {
+	starts := []int{0}
+	for i := 0; i < len(content); i++ {
+		if content[i] == '\n' {
+			starts = append(starts, i+1)
+		}
+	}
+	return starts
+}
+
+// lineEnd returns the offset just before the line terminator of line index.
+func lineEnd(content string, starts []int, index int) int {
+	end := len(content)
+	if index+1 < len(starts) {
+		end = starts[index+1] - 1
+	}
+	if end > starts[index] && content[end-1] == '\r' {
+		end--
+	}
+	return end
+}
+
+// offsetToPosition converts a byte offset into a line/column position.
+// Offsets inside a multi-byte rune snap back to the rune's first byte and
+// offsets inside a "\r\n" pair snap to the end of the line.
+func offsetToPosition(content string, offset int) (textPosition, error) {
+	if offset < 0 || offset > len(content) {
+		return textPosition{}, fmt.Errorf("offset %d is outside the document (length %d)", offset, len(content))
+	}
+
+	for offset > 0 && offset < len(content) && !utf8.RuneStart(content[offset]) {
+		offset--
+	}
+
+	starts := lineStarts(content)
+	index := 0
+	for index+1 < len(starts) && starts[index+1] <= offset {
+		index++
+	}
+
+	if end := lineEnd(content, starts, index); offset > end {
+		offset = end
+	}
+
+	return textPosition{Line: index + 1, Column: offset - starts[index] + 1, Offset: offset}, nil
+}
+
+// positionToOffset converts a line/column position into a byte offset.
+// Columns past the end of the line clamp to the line terminator.
+func positionToOffset(content string, line, column int) (textPosition, error) {
+	if line < 1 || column < 1 {
+		return textPosition{}, errors.New("line and column are 1-based and must be positive")
+	}
+
+	starts := lineStarts(content)
+	if line > len(starts) {
+		return textPosition{}, fmt.Errorf("line %d is outside the document (%d lines)", line, len(starts))
+	}
+
+	index := line - 1
+	offset := starts[index] + column - 1
+	if end := lineEnd(content, starts, index); offset > end {
+		offset = end
+	}
+	for offset > starts[index] && offset < len(content) && !utf8.RuneStart(content[offset]) {
+		offset--
+	}
+
+	return textPosition{Line: line, Column: offset - starts[index] + 1, Offset: offset}, nil
+}
+
+// executePositionConversion answers position-to-offset and offset-to-position
+// requests against the template's current content.
+func executePositionConversion(templatePath string, toPosition bool, opts renderOptions) response {
+	if templatePath == "" {
+		return response{Error: "template path is required"}
+	}
+
+	content, err := readTemplate(templatePath, opts)
+	if err != nil {
+		return response{Error: err.Error()}
+	}
+
+	var position textPosition
+	if toPosition {
+		position, err = offsetToPosition(content, decodeOffset(content, opts.Offset, opts.PositionEncoding))
+	} else {
+		column := decodeColumn(lineText(content, opts.Line), opts.Column, opts.PositionEncoding)
+		position, err = positionToOffset(content, opts.Line, column)
+	}
+	if err != nil {
+		return response{Error: err.Error()}
+	}
+
+	return response{Position: &position}
+}
+
+const (
+	positionEncodingUTF8  = "utf-8"
+	positionEncodingUTF16 = "utf-16"
+	positionEncodingUTF32 = "utf-32"
+)
+
+func validatePositionEncoding(encoding string) error {
+	switch encoding {
+	case "", positionEncodingUTF8, positionEncodingUTF16, positionEncodingUTF32:
+		return nil
+	default:
+		return fmt.Errorf("unknown position encoding %q: expected utf-8, utf-16, or utf-32", encoding)
+	}
+}
+
+// lineText returns the text of a 1-based line without its terminator.
+func lineText(content string, line int) string {
+	starts := lineStarts(content)
+	if line < 1 || line > len(starts) {
+		return ""
+	}
+	return content[starts[line-1]:lineEnd(content, starts, line-1)]
+}
+
+// encodeColumn converts a 1-based byte column into a 1-based column counted
+// in the code units of encoding.
+func encodeColumn(text string, byteColumn int, encoding string) int {
+	if byteColumn < 1 || encoding == "" || encoding == positionEncodingUTF8 {
+		return byteColumn
+	}
+
+	limit := byteColumn - 1
+	units := 0
+	if limit > len(text) {
+		units = limit - len(text)
+		limit = len(text)
+	}
+
+	for _, r := range text[:limit] {
+		units += runeUnits(r, encoding)
+	}
+	return units + 1
+}
+
+// decodeColumn converts a 1-based column in encoding code units back into a
+// 1-based byte column. Columns that split a surrogate pair round down.
+func decodeColumn(text string, column int, encoding string) int {
+	if column < 1 || encoding == "" || encoding == positionEncodingUTF8 {
+		return column
+	}
+
+	units := 0
+	for index, r := range text {
+		next := units + runeUnits(r, encoding)
+		if next > column-1 {
+			return index + 1
+		}
+		units = next
+	}
+	return len(text) + column - units
+}
+
+// encodeOffset converts a 0-based byte offset into the code units of
+// encoding before it.
+func encodeOffset(content string, offset int, encoding string) int {
+	if encoding == "" || encoding == positionEncodingUTF8 || offset < 0 || offset > len(content) {
+		return offset
+	}
+	units := 0
+	for _, r := range content[:offset] {
+		units += runeUnits(r, encoding)
+	}
+	return units
+}
+
+// decodeOffset converts a 0-based offset in encoding code units back into
+// a byte offset. Offsets past the end stay past it, so they are still
+// reported as outside the document.
+func decodeOffset(content string, offset int, encoding string) int {
+	if encoding == "" || encoding == positionEncodingUTF8 || offset < 0 {
+		return offset
+	}
+	units := 0
+	for index, r := range content {
+		if units >= offset {
+			return index
+		}
+		units += runeUnits(r, encoding)
+	}
+	return len(content) + offset - units
+}
+
+func runeUnits(r rune, encoding string) int {
+	if encoding == positionEncodingUTF16 && r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
+
+// templateReads records the text of each template a request read, keyed
+// by its location. Columns are converted against that text rather than
+// the file on disk, which differs under --at-ref, for remote and object
+// storage templates, and for unsaved source text.
+type templateReads struct {
+	mu       sync.Mutex
+	contents map[string]string
+}
+
+func (r *templateReads) record(location, content string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.contents == nil {
+		r.contents = map[string]string{}
+	}
+	r.contents[location] = content
+}
+
+func (r *templateReads) lookup(location string) (string, bool) {
+	if r == nil {
+		return "", false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	content, ok := r.contents[location]
+	return content, ok
+}
+
+// applyPositionEncoding rewrites every column in resp from bytes into the
+// negotiated encoding so all ranges the worker emits agree. Columns are
+// converted against the text the request read, carried in resp.reads;
+// files it did not read are read once each, and positions in unreadable
+// files are left untouched.
+func applyPositionEncoding(resp *response, templatePath, encoding string) {
+	if encoding == "" || encoding == positionEncodingUTF8 {
+		return
+	}
+	for i := range resp.Results {
+		resp.Results[i].response.reads = resp.reads
+		applyPositionEncoding(&resp.Results[i].response, templatePath, encoding)
+	}
+
+	contents := map[string]*string{}
+	source := func(file string) *string {
+		if file == "" {
+			file = templatePath
+		}
+		content, ok := contents[file]
+		if !ok {
+			if text, read := resp.reads.lookup(file); read {
+				content = &text
+			} else if fileBytes, err := os.ReadFile(file); err == nil {
+				text := string(fileBytes)
+				content = &text
+			}
+			contents[file] = content
+		}
+		return content
+	}
+	convert := func(file string, line, column int) int {
+		content := source(file)
+		if content == nil || line < 1 {
+			return column
+		}
+		return encodeColumn(lineText(*content, line), column, encoding)
+	}
+
+	for i := range resp.Diagnostics {
+		diag := &resp.Diagnostics[i]
+		if diag.File != "" && diag.Line > 0 {
+			diag.EndColumn = convert(diag.File, diag.Line, diag.EndColumn)
+			diag.Column = convert(diag.File, diag.Line, diag.Column)
+		}
+		for j := range diag.Related {
+			related := &diag.Related[j]
+			related.Column = convert(related.File, related.Line, related.Column)
+		}
+	}
+	for i := range resp.Catalog {
+		for j := range resp.Catalog[i].Occurrences {
+			occurrence := &resp.Catalog[i].Occurrences[j]
+			occurrence.Column = convert(occurrence.File, occurrence.Line, occurrence.Column)
+		}
+	}
+	var convertSteps func(steps []explainStep)
+	convertSteps = func(steps []explainStep) {
+		for i := range steps {
+			steps[i].Column = convert(templatePath, steps[i].Line, steps[i].Column)
+			convertSteps(steps[i].Children)
+		}
+	}
+	for _, outline := range resp.Explanation {
+		convertSteps(outline.Steps)
+	}
+	for _, graph := range resp.ControlFlow {
+		for i := range graph.Nodes {
+			graph.Nodes[i].Column = convert(templatePath, graph.Nodes[i].Line, graph.Nodes[i].Column)
+		}
+	}
+	var convertAST func(node *astNode)
+	convertAST = func(node *astNode) {
+		node.Column = convert(templatePath, node.Line, node.Column)
+		if node.EndLine > 0 {
+			node.EndColumn = convert(templatePath, node.EndLine, node.EndColumn)
+		}
+		if node.Pipe != nil {
+			convertAST(node.Pipe)
+		}
+		for _, children := range [][]astNode{node.Args, node.Body, node.Else} {
+			for i := range children {
+				convertAST(&children[i])
+			}
+		}
+	}
+	for _, tmpl := range resp.AST {
+		for i := range tmpl.Nodes {
+			convertAST(&tmpl.Nodes[i])
+		}
+	}
+	if resp.Analysis != nil {
+		for i := range resp.Analysis.Fields {
+			for j := range resp.Analysis.Fields[i].Occurrences {
+				occurrence := &resp.Analysis.Fields[i].Occurrences[j]
+				occurrence.Column = convert(occurrence.File, occurrence.Line, occurrence.Column)
+			}
+		}
+		for i := range resp.Analysis.Scopes {
+			scope := &resp.Analysis.Scopes[i]
+			scope.Column = convert(templatePath, scope.Line, scope.Column)
+		}
+	}
+	if resp.Position != nil {
+		resp.Position.Column = convert(templatePath, resp.Position.Line, resp.Position.Column)
+		if content := source(templatePath); content != nil {
+			resp.Position.Offset = encodeOffset(*content, resp.Position.Offset, encoding)
+		}
+	}
+	if resp.Hover != nil {
+		resp.Hover.EndColumn = convert(templatePath, resp.Hover.Line, resp.Hover.EndColumn)
+		resp.Hover.Column = convert(templatePath, resp.Hover.Line, resp.Hover.Column)
+	}
+	if resp.Definition != nil {
+		resp.Definition.Column = convert(resp.Definition.File, resp.Definition.Line, resp.Definition.Column)
+	}
+	for i := range resp.Profile {
+		resp.Profile[i].Column = convert(resp.Profile[i].File, resp.Profile[i].Line, resp.Profile[i].Column)
+	}
+	for i := range resp.SourceMap {
+		mapping := &resp.SourceMap[i]
+		mapping.EndColumn = convert(mapping.File, mapping.EndLine, mapping.EndColumn)
+		mapping.Column = convert(mapping.File, mapping.Line, mapping.Column)
+	}
+	for i := range resp.ValueOrigins {
+		origin := &resp.ValueOrigins[i]
+		origin.EndColumn = convert(origin.File, origin.EndLine, origin.EndColumn)
+		origin.Column = convert(origin.File, origin.Line, origin.Column)
+	}
+	if resp.References != nil {
+		for i := range resp.References.Locations {
+			location := &resp.References.Locations[i]
+			location.EndColumn = convert(location.File, location.EndLine, location.EndColumn)
+			location.Column = convert(location.File, location.Line, location.Column)
+		}
+	}
+	if resp.Rename != nil {
+		for i := range resp.Rename.Edits {
+			edit := &resp.Rename.Edits[i]
+			edit.EndColumn = convert(edit.File, edit.EndLine, edit.EndColumn)
+			edit.Column = convert(edit.File, edit.Line, edit.Column)
+		}
+	}
+	if resp.Format != nil {
+		for i := range resp.Format.Edits {
+			edit := &resp.Format.Edits[i]
+			edit.EndColumn = convert(edit.File, edit.EndLine, edit.EndColumn)
+			edit.Column = convert(edit.File, edit.Line, edit.Column)
+		}
+	}
+	if resp.Deps != nil {
+		for i := range resp.Deps.Nodes {
+			node := &resp.Deps.Nodes[i]
+			node.Column = convert(node.File, node.Line, node.Column)
+		}
+		for _, edges := range [][]dependencyEdge{resp.Deps.Edges, resp.Deps.Unresolved} {
+			for i := range edges {
+				edges[i].Column = convert(edges[i].File, edges[i].Line, edges[i].Column)
+			}
+		}
+	}
+	var convertSymbols func(symbols []templateSymbol)
+	convertSymbols = func(symbols []templateSymbol) {
+		for i := range symbols {
+			symbol := &symbols[i]
+			symbol.EndColumn = convert(templatePath, symbol.EndLine, symbol.EndColumn)
+			symbol.Column = convert(templatePath, symbol.Line, symbol.Column)
+			symbol.NameEndColumn = convert(templatePath, symbol.NameLine, symbol.NameEndColumn)
+			symbol.NameColumn = convert(templatePath, symbol.NameLine, symbol.NameColumn)
+			convertSymbols(symbol.Children)
+		}
+	}
+	convertSymbols(resp.Symbols)
+	for i := range resp.EscapeReport {
+		entry := &resp.EscapeReport[i]
+		entry.EndColumn = convert(templatePath, entry.EndLine, entry.EndColumn)
+		entry.Column = convert(templatePath, entry.Line, entry.Column)
+	}
+	for i := range resp.Overrides {
+		override := &resp.Overrides[i]
+		override.Winner.Column = convert(override.Winner.File, override.Winner.Line, override.Winner.Column)
+		for j := range override.Overridden {
+			definition := &override.Overridden[j]
+			definition.Column = convert(definition.File, definition.Line, definition.Column)
+		}
+	}
+	if resp.ExecFailure != nil {
+		for i := range resp.ExecFailure.Loops {
+			loop := &resp.ExecFailure.Loops[i]
+			loop.Column = convert(loop.File, loop.Line, loop.Column)
+		}
+	}
+	if resp.Partial != nil {
+		location := &resp.Partial.Location
+		location.Column = convert(location.File, location.Line, location.Column)
+	}
+	if resp.ContextDiff != nil {
+		for _, region := range resp.ContextDiff.Regions {
+			for i := range region.Nodes {
+				region.Nodes[i].Column = convert(region.Nodes[i].File, region.Nodes[i].Line, region.Nodes[i].Column)
+			}
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOffsetToPosition(t *testing.T) {
+	content := "héllo\r\nwörld"
+
+	cases := []struct {
+		offset int
+		want   textPosition
+	}{
+		{0, textPosition{Line: 1, Column: 1, Offset: 0}},
+		{2, textPosition{Line: 1, Column: 2, Offset: 1}},
+		{3, textPosition{Line: 1, Column: 4, Offset: 3}},
+		{7, textPosition{Line: 1, Column: 7, Offset: 6}},
+		{8, textPosition{Line: 2, Column: 1, Offset: 8}},
+		{14, textPosition{Line: 2, Column: 7, Offset: 14}},
+	}
+
+	for _, tc := range cases {
+		got, err := offsetToPosition(content, tc.offset)
+		if err != nil {
+			t.Fatalf("unexpected error for offset %d: %v", tc.offset, err)
+		}
+		if got != tc.want {
+			t.Fatalf("offset %d: expected %+v, got %+v", tc.offset, tc.want, got)
+		}
+	}
+
+	if _, err := offsetToPosition(content, 99); err == nil {
+		t.Fatal("expected error for offset past the end")
+	}
+}
+
+func TestPositionToOffset(t *testing.T) {
+	content := "héllo\r\nwörld"
+
+	got, err := positionToOffset(content, 2, 3)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Offset != 9 {
+		t.Fatalf("expected offset 9, got %+v", got)
+	}
+
+	got, err = positionToOffset(content, 1, 50)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Offset != 6 || got.Column != 7 {
+		t.Fatalf("expected column to clamp before CRLF, got %+v", got)
+	}
+
+	if _, err := positionToOffset(content, 3, 1); err == nil {
+		t.Fatal("expected error for line past the end")
+	}
+	if _, err := positionToOffset(content, 0, 1); err == nil {
+		t.Fatal("expected error for zero line")
+	}
+}
+
+func TestPositionConversionRoundTrip(t *testing.T) {
+	content := "a\n{{ .ñame }}\r\n\n😀 end"
+	for offset := 0; offset <= len(content); offset++ {
+		position, err := offsetToPosition(content, offset)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		back, err := positionToOffset(content, position.Line, position.Column)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if back.Offset != position.Offset {
+			t.Fatalf("round trip mismatch at offset %d: %+v vs %+v", offset, position, back)
+		}
+	}
+}
+
+func TestExecutePositionConversionModes(t *testing.T) {
+	templatePath := filepath.Join(t.TempDir(), "page.tmpl")
+	if err := os.WriteFile(templatePath, []byte("one\ntwo"), 0o600); err != nil {
+		t.Fatalf("failed to write template file: %v", err)
+	}
+
+	resp := run(templatePath, "", renderOptions{Mode: "offset-to-position", Offset: 5})
+	if resp.Position == nil || resp.Position.Line != 2 || resp.Position.Column != 2 {
+		t.Fatalf("unexpected position: %+v", resp)
+	}
+
+	resp = run(templatePath, "", renderOptions{Mode: "position-to-offset", Line: 2, Column: 2})
+	if resp.Position == nil || resp.Position.Offset != 5 {
+		t.Fatalf("unexpected offset: %+v", resp)
+	}
+}
+
+func TestEncodeAndDecodeColumn(t *testing.T) {
+	text := "a😀é{{ .x }}"
+	byteColumn := len("a😀é") + 1
+
+	cases := map[string]int{
+		positionEncodingUTF8:  byteColumn,
+		positionEncodingUTF16: 5,
+		positionEncodingUTF32: 4,
+	}
+
+	for encoding, expected := range cases {
+		column := encodeColumn(text, byteColumn, encoding)
+		if column != expected {
+			t.Fatalf("%s: expected column %d, got %d", encoding, expected, column)
+		}
+		if back := decodeColumn(text, column, encoding); back != byteColumn {
+			t.Fatalf("%s: expected decode to return %d, got %d", encoding, byteColumn, back)
+		}
+	}
+}
+
+func TestRunAppliesPositionEncodingToDiagnostics(t *testing.T) {
+	templatePath := filepath.Join(t.TempDir(), "page.tmpl")
+	if err := os.WriteFile(templatePath, []byte("😀 {{ lower \"X\" }}"), 0o600); err != nil {
+		t.Fatalf("failed to write template file: %v", err)
+	}
+
+	// The stub keeps lower parsing, so the only diagnostic is the warning
+	// that production does not register it.
+	sourcePath, _ := writeFuncProfileFixtures(t)
+	opts := renderOptions{FuncsFrom: sourcePath, StubFunctions: "lower", PositionEncoding: positionEncodingUTF16}
+	resp := run(templatePath, "", opts)
+	if len(resp.Diagnostics) != 1 || resp.Diagnostics[0].Column != 7 {
+		t.Fatalf("expected UTF-16 column 7, got %+v", resp.Diagnostics)
+	}
+
+	opts.PositionEncoding = positionEncodingUTF8
+	resp = run(templatePath, "", opts)
+	if len(resp.Diagnostics) != 1 || resp.Diagnostics[0].Column != 9 {
+		t.Fatalf("expected byte column 9, got %+v", resp.Diagnostics)
+	}
+
+	if resp := run(templatePath, "", renderOptions{PositionEncoding: "utf-7"}); resp.Error == "" {
+		t.Fatal("expected unknown encoding to be rejected")
+	}
+}
+
+func TestPositionEncodingUsesTheTextTheRequestRead(t *testing.T) {
+	dir := newGitRepo(t, map[string]string{"page.tmpl": "😀 {{ lower \"X\" }}"})
+	templatePath := filepath.Join(dir, "page.tmpl")
+	writeFile(t, templatePath, "{{ lower \"X\" }}")
+
+	sourcePath, _ := writeFuncProfileFixtures(t)
+	resp := run(templatePath, "", renderOptions{FuncsFrom: sourcePath, StubFunctions: "lower", PositionEncoding: positionEncodingUTF16, AtRef: "HEAD"})
+	if len(resp.Diagnostics) != 1 || resp.Diagnostics[0].Column != 7 {
+		t.Fatalf("expected the UTF-16 column in the committed template, got %+v", resp.Diagnostics)
+	}
+}
+
+func TestPositionConversionEncodesOffsets(t *testing.T) {
+	templatePath := filepath.Join(t.TempDir(), "page.tmpl")
+	writeFile(t, templatePath, "😀é\nx")
+
+	resp := run(templatePath, "", renderOptions{Mode: "offset-to-position", Offset: 4, PositionEncoding: positionEncodingUTF16})
+	if resp.Position == nil || resp.Position.Line != 2 || resp.Position.Column != 1 || resp.Position.Offset != 4 {
+		t.Fatalf("expected UTF-16 offset 4 to be line 2, got %+v", resp)
+	}
+	resp = run(templatePath, "", renderOptions{Mode: "position-to-offset", Line: 2, Column: 1, PositionEncoding: positionEncodingUTF32})
+	if resp.Position == nil || resp.Position.Offset != 3 {
+		t.Fatalf("expected UTF-32 offset 3, got %+v", resp)
+	}
+	resp = run(templatePath, "", renderOptions{Mode: "position-to-offset", Line: 2, Column: 1})
+	if resp.Position == nil || resp.Position.Offset != len("😀é\n") {
+		t.Fatalf("expected a byte offset by default, got %+v", resp)
+	}
+	if resp := run(templatePath, "", renderOptions{Mode: "offset-to-position", Offset: 6, PositionEncoding: positionEncodingUTF16}); resp.Error == "" {
+		t.Fatalf("expected an offset past the end to be rejected, got %+v", resp)
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Post-processing steps applied to rendered output with --post.
+const (
+	postCSVValidate   = "csv-validate"
+	postXLSX          = "xlsx"
+	postICSValidate   = "ics-validate"
+	postVCardValidate = "vcard-validate"
+
+	// maxCSVReports bounds how many inconsistent rows csv-validate lists.
+	maxCSVReports = 20
+	xlsxSheet     = "Sheet1"
+)
+
+// csvNumberPattern matches cells xlsx stores as numbers. Values with
+// leading zeros or a plus sign, such as ZIP codes and phone numbers, stay
+// text so the spreadsheet shows them as rendered.
+var csvNumberPattern = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?$`)
+
+func validatePost(opts renderOptions) error {
+	for _, step := range opts.Post {
+		switch step {
+		case postCSVValidate, postICSValidate, postVCardValidate:
+		case postXLSX:
+			if strings.TrimSpace(opts.XLSXFile) == "" {
+				return errors.New("--post=xlsx requires --xlsx-file")
+			}
+		default:
+			return fmt.Errorf("unknown post-processing step %q (expected csv-validate, xlsx, ics-validate, or vcard-validate)", step)
+		}
+	}
+	return nil
+}
+
+// applyPostSteps runs the requested post-processing steps over a successful
+// render. Problems with the rendered output refer to lines of the output,
+// not the template, so they carry no position.
+func applyPostSteps(resp response, opts renderOptions) response {
+	if resp.Error != "" || len(opts.Post) == 0 {
+		return resp
+	}
+
+	var (
+		records  [][]string
+		problems []diagnostic
+		err      error
+	)
+	for _, step := range opts.Post {
+		if step == postCSVValidate || step == postXLSX {
+			records, problems, err = parseRenderedCSV(resp.Rendered)
+			break
+		}
+	}
+	for _, step := range opts.Post {
+		switch step {
+		case postICSValidate, postVCardValidate:
+			validate := validateICS
+			if step == postVCardValidate {
+				validate = validateVCard
+			}
+			found := validate(resp.Rendered)
+			resp.Diagnostics = append(resp.Diagnostics, found...)
+			for _, diag := range found {
+				if diag.Severity == "error" {
+					resp.Error = diag.Message
+					return resp
+				}
+			}
+		case postCSVValidate:
+			resp.Diagnostics = append(resp.Diagnostics, problems...)
+			if err != nil {
+				resp.Diagnostics = append(resp.Diagnostics, diagnostic{Message: err.Error(), Severity: "error"})
+				resp.Error = err.Error()
+				return resp
+			}
+		case postXLSX:
+			if err == nil {
+				err = writeXLSX(opts.XLSXFile, records)
+			}
+			if err != nil {
+				message := "xlsx: " + err.Error()
+				resp.Diagnostics = append(resp.Diagnostics, diagnostic{Message: message, Severity: "error"})
+				resp.Error = message
+				return resp
+			}
+			resp.XLSXFile = opts.XLSXFile
+		}
+	}
+	return resp
+}
+
+// parseRenderedCSV reads the rendered output as RFC 4180 CSV. Rows whose
+// field count differs from the first row's are reported as warnings;
+// quoting errors stop parsing and are returned as err.
+func parseRenderedCSV(rendered string) ([][]string, []diagnostic, error) {
+	reader := csv.NewReader(strings.NewReader(rendered))
+	reader.FieldsPerRecord = -1
+
+	var (
+		records  [][]string
+		problems []diagnostic
+		skipped  int
+	)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				return nil, problems, fmt.Errorf("rendered CSV line %d, column %d: %v", parseErr.Line, parseErr.Column, parseErr.Err)
+			}
+			return nil, problems, err
+		}
+
+		if len(records) > 0 && len(record) != len(records[0]) {
+			line, _ := reader.FieldPos(0)
+			if len(problems) < maxCSVReports {
+				problems = append(problems, diagnostic{
+					Message:  fmt.Sprintf("rendered CSV line %d has %d %s, expected %d like the first row", line, len(record), plural(len(record), "field"), len(records[0])),
+					Severity: "warning",
+				})
+			} else {
+				skipped++
+			}
+		}
+		records = append(records, record)
+	}
+
+	if skipped > 0 {
+		problems = append(problems, diagnostic{
+			Message:  fmt.Sprintf("%d more rendered CSV %s have the wrong number of fields", skipped, plural(skipped, "line")),
+			Severity: "warning",
+		})
+	}
+	return records, problems, nil
+}
+
+// writeXLSX writes records to a single-sheet workbook, storing numeric
+// cells as numbers.
+func writeXLSX(path string, records [][]string) error {
+	workbook := excelize.NewFile()
+	defer workbook.Close()
+
+	for i, record := range records {
+		row := make([]interface{}, len(record))
+		for j, field := range record {
+			row[j] = field
+			if csvNumberPattern.MatchString(field) {
+				if number, err := strconv.ParseFloat(field, 64); err == nil {
+					row[j] = number
+				}
+			}
+		}
+		cell, err := excelize.CoordinatesToCellName(1, i+1)
+		if err != nil {
+			return err
+		}
+		if err := workbook.SetSheetRow(xlsxSheet, cell, &row); err != nil {
+			return err
+		}
+	}
+	return workbook.SaveAs(path)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestCSVValidateReportsInconsistentRows(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "report.csv.tmpl")
+	writeFile(t, templatePath, "name,team,score\n{{ range .rows }}{{ . }}\n{{ end }}")
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, contextPath, `{"rows":["ann,core,3","bob,\"web, ui\",5","cy,ops"]}`)
+
+	resp := run(templatePath, contextPath, renderOptions{Post: []string{postCSVValidate}})
+	if resp.Error != "" || len(resp.Diagnostics) != 1 || resp.Diagnostics[0].Message != "rendered CSV line 4 has 2 fields, expected 3 like the first row" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	writeFile(t, contextPath, `{"rows":["ann,co\"re,3"]}`)
+	resp = run(templatePath, contextPath, renderOptions{Post: []string{postCSVValidate}})
+	if !strings.HasPrefix(resp.Error, "rendered CSV line 2, column 7:") || !strings.Contains(resp.Error, `bare " in non-quoted-field`) {
+		t.Fatalf("expected a quoting error, got %+v", resp)
+	}
+}
+
+func TestPostXLSXWritesWorkbook(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "report.csv.tmpl")
+	workbookPath := filepath.Join(dir, "report.xlsx")
+	writeFile(t, templatePath, "zip,score,name\n02134,4.5,\"Doe, J\"\n")
+
+	resp := run(templatePath, "", renderOptions{Post: []string{postXLSX}, XLSXFile: workbookPath})
+	if resp.Error != "" || resp.XLSXFile != workbookPath {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	workbook, err := excelize.OpenFile(workbookPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer workbook.Close()
+	rows, err := workbook.GetRows(xlsxSheet)
+	if err != nil || len(rows) != 2 || rows[1][0] != "02134" || rows[1][2] != "Doe, J" {
+		t.Fatalf("unexpected rows %q, %v", rows, err)
+	}
+	if cellType, err := workbook.GetCellType(xlsxSheet, "B2"); err != nil || cellType != excelize.CellTypeNumber && cellType != excelize.CellTypeUnset {
+		t.Fatalf("expected a numeric score cell, got %v, %v", cellType, err)
+	}
+
+	if err := validatePost(renderOptions{Post: []string{postXLSX}}); err == nil {
+		t.Fatal("expected xlsx without --xlsx-file to be rejected")
+	}
+	if err := validatePost(renderOptions{Post: []string{"pdf"}}); err == nil {
+		t.Fatal("expected an unknown step to be rejected")
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// lowerPriority renices every thread of the process. Linux keeps a
+// niceness per thread, and a thread starts with its creator's, so the
+// threads the runtime starts later inherit it.
+func lowerPriority() error {
+	tasks, err := os.ReadDir("/proc/self/task")
+	if err != nil {
+		return syscall.Setpriority(syscall.PRIO_PROCESS, 0, backgroundNice)
+	}
+	var first error
+	for _, task := range tasks {
+		tid, err := strconv.Atoi(task.Name())
+		if err != nil {
+			continue
+		}
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, tid, backgroundNice); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
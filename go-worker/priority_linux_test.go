@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// TestLowPriorityProcess is not a real test: TestLowPriorityRenicesEveryThread
+// runs the test binary to lower its own priority, which cannot be undone.
+func TestLowPriorityProcess(t *testing.T) {
+	if os.Getenv("GO_TEMPLATE_STUDIO_LOW_PRIORITY") == "" {
+		return
+	}
+	if err := lowerPriority(); err != nil {
+		os.Stdout.WriteString("error: " + err.Error())
+		os.Exit(1)
+	}
+	// A thread started afterwards inherits the priority.
+	done := make(chan struct{})
+	go func() {
+		runtime.LockOSThread()
+		close(done)
+		select {}
+	}()
+	<-done
+	tasks, _ := os.ReadDir("/proc/self/task")
+	for _, task := range tasks {
+		tid, _ := strconv.Atoi(task.Name())
+		// The raw system call returns 20 minus the niceness.
+		priority, err := syscall.Getpriority(syscall.PRIO_PROCESS, tid)
+		if err != nil {
+			continue
+		}
+		os.Stdout.WriteString(strconv.Itoa(20-priority) + "\n")
+	}
+	os.Exit(0)
+}
+
+func TestLowPriorityRenicesEveryThread(t *testing.T) {
+	cmd := exec.Command(os.Args[0], "-test.run=^TestLowPriorityProcess$")
+	cmd.Env = append(os.Environ(), "GO_TEMPLATE_STUDIO_LOW_PRIORITY=1")
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	nices := strings.Fields(string(out))
+	if len(nices) < 2 {
+		t.Fatalf("expected several threads, got %q", out)
+	}
+	for _, nice := range nices {
+		if nice != strconv.Itoa(backgroundNice) {
+			t.Fatalf("expected every thread at niceness %d, got %q", backgroundNice, nices)
+		}
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !unix && !windows
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// lowerPriority reports that the OS has no process priorities to lower.
+func lowerPriority() error {
+	return fmt.Errorf("process priorities are not supported on %s", runtime.GOOS)
+}
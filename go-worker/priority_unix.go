@@ -0,0 +1,10 @@
+//go:build unix && !linux
+
+package main
+
+import "syscall"
+
+// lowerPriority renices the process.
+func lowerPriority() error {
+	return syscall.Setpriority(syscall.PRIO_PROCESS, 0, backgroundNice)
+}
@@ -0,0 +1,20 @@
+package main
+
+import "syscall"
+
+// belowNormalPriorityClass is BELOW_NORMAL_PRIORITY_CLASS.
+const belowNormalPriorityClass = 0x4000
+
+var setPriorityClass = syscall.NewLazyDLL("kernel32.dll").NewProc("SetPriorityClass")
+
+// lowerPriority moves the process to the below normal priority class.
+func lowerPriority() error {
+	process, err := syscall.GetCurrentProcess()
+	if err != nil {
+		return err
+	}
+	if ok, _, err := setPriorityClass.Call(uintptr(process), belowNormalPriorityClass); ok == 0 {
+		return err
+	}
+	return nil
+}
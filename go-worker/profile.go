@@ -0,0 +1,290 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template/parse"
+	"time"
+)
+
+const (
+	// profileEnterFunc and profileExitFunc are the hidden helpers a profiled
+	// template calls around every action and control structure.
+	profileEnterFunc = "__goTemplateStudioProfileEnter"
+	profileExitFunc  = "__goTemplateStudioProfileExit"
+	// profileIterateFunc is called at the start of every range body to
+	// count the iterations.
+	profileIterateFunc = "__goTemplateStudioProfileIterate"
+	// defaultProfileTop is how many nodes --profile lists by default.
+	defaultProfileTop = 20
+)
+
+// profileSorts are the orders --profile-sort accepts; the first is the
+// default.
+var profileSorts = []string{"total", "self", "calls", "iterations"}
+
+// nodeProfile is the execution cost of one template node. TotalMs includes
+// the nodes inside it, such as a range's body; SelfMs leaves them out.
+// A node executed recursively counts its time once per active call.
+// Iterations counts the runs of a range's body over all its calls.
+type nodeProfile struct {
+	File       string  `json:"file"`
+	Line       int     `json:"line"`
+	Column     int     `json:"column"`
+	Kind       string  `json:"kind"`
+	Source     string  `json:"source"`
+	Calls      int     `json:"calls"`
+	Iterations int     `json:"iterations,omitempty"`
+	TotalMs    float64 `json:"totalMs"`
+	SelfMs     float64 `json:"selfMs"`
+}
+
+// instrumentProfile wraps every action, if, with, range, and template call
+// of tree in calls to profileEnterFunc and profileExitFunc, each carrying
+// the node's "kind|start|end|template" span, and starts every range body
+// with a call to profileIterateFunc. The hidden calls other
+// instrumentation added are left alone.
+func instrumentProfile(tree *parse.Tree, sources map[string]string, leftDelim, rightDelim string) {
+	if tree == nil {
+		return
+	}
+	content, ok := sources[tree.ParseName]
+	if !ok {
+		return
+	}
+	profileList(tree, tree.Root, scanActions(content, leftDelim, rightDelim))
+}
+
+func profileList(tree *parse.Tree, list *parse.ListNode, actions []actionSpan) {
+	if list == nil {
+		return
+	}
+	nodes := make([]parse.Node, 0, 3*len(list.Nodes))
+	for _, node := range list.Nodes {
+		var kind string
+		switch typed := node.(type) {
+		case *parse.ActionNode:
+			if !isHiddenAction(typed) {
+				kind = "action"
+			}
+		case *parse.IfNode:
+			kind = "if"
+			profileList(tree, typed.List, actions)
+			profileList(tree, typed.ElseList, actions)
+		case *parse.WithNode:
+			kind = "with"
+			profileList(tree, typed.List, actions)
+			profileList(tree, typed.ElseList, actions)
+		case *parse.RangeNode:
+			kind = "range"
+			profileList(tree, typed.List, actions)
+			profileList(tree, typed.ElseList, actions)
+		case *parse.TemplateNode:
+			kind = "template"
+		}
+		if kind == "" {
+			nodes = append(nodes, node)
+			continue
+		}
+		start, end := int(node.Position()), int(node.Position())
+		if span, ok := enclosingAction(actions, node.Position()); ok {
+			start, end = span.Start, span.End
+		}
+		span := fmt.Sprintf("%s|%d|%d|%s", kind, start, end, tree.ParseName)
+		if loop, ok := node.(*parse.RangeNode); ok && loop.List != nil {
+			loop.List.Nodes = append([]parse.Node{hiddenCall(tree, node.Position(), profileIterateFunc, span)}, loop.List.Nodes...)
+		}
+		nodes = append(nodes,
+			hiddenCall(tree, node.Position(), profileEnterFunc, span),
+			node,
+			hiddenCall(tree, node.Position(), profileExitFunc, span))
+	}
+	list.Nodes = nodes
+}
+
+// profileRecorder times the nodes of one render.
+type profileRecorder struct {
+	mu     sync.Mutex
+	stack  []profileFrame
+	totals map[string]*profileTotal
+	order  []string
+	done   bool
+}
+
+type profileFrame struct {
+	span     string
+	start    time.Time
+	children time.Duration
+}
+
+type profileTotal struct {
+	calls, iterations int
+	total, self       time.Duration
+}
+
+func newProfileRecorder() *profileRecorder {
+	return &profileRecorder{totals: map[string]*profileTotal{}}
+}
+
+// enter is registered as profileEnterFunc.
+func (r *profileRecorder) enter(span string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.done {
+		return ""
+	}
+	total, ok := r.totals[span]
+	if !ok {
+		total = &profileTotal{}
+		r.totals[span] = total
+		r.order = append(r.order, span)
+	}
+	total.calls++
+	r.stack = append(r.stack, profileFrame{span: span, start: time.Now()})
+	return ""
+}
+
+// iterate is registered as profileIterateFunc.
+func (r *profileRecorder) iterate(span string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if total, ok := r.totals[span]; ok && !r.done {
+		total.iterations++
+	}
+	return ""
+}
+
+// exit is registered as profileExitFunc. Frames above the node's own were
+// abandoned by break or continue and are dropped without a time.
+func (r *profileRecorder) exit(span string) string {
+	now := time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.done {
+		return ""
+	}
+	for i := len(r.stack) - 1; i >= 0; i-- {
+		if r.stack[i].span != span {
+			continue
+		}
+		frame := r.stack[i]
+		r.stack = r.stack[:i]
+		elapsed := now.Sub(frame.start)
+		r.totals[span].total += elapsed
+		r.totals[span].self += elapsed - frame.children
+		if i > 0 {
+			r.stack[i-1].children += elapsed
+		}
+		break
+	}
+	return ""
+}
+
+// finish returns the top nodes by total time, or by the order sortBy
+// names, ties broken by total time, calls, and then first execution.
+func (r *profileRecorder) finish(sources map[string]templateSource, top int, sortBy string) []nodeProfile {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.done = true
+	if top <= 0 {
+		top = defaultProfileTop
+	}
+
+	profiles := make([]nodeProfile, 0, len(r.order))
+	for _, span := range r.order {
+		profile, ok := decodeProfileSpan(span, sources)
+		if !ok {
+			continue
+		}
+		total := r.totals[span]
+		profile.Calls = total.calls
+		profile.Iterations = total.iterations
+		profile.TotalMs = durationMs(total.total)
+		profile.SelfMs = durationMs(total.self)
+		profiles = append(profiles, profile)
+	}
+	sort.SliceStable(profiles, func(i, j int) bool {
+		a, b := profiles[i], profiles[j]
+		switch {
+		case sortBy == "self" && a.SelfMs != b.SelfMs:
+			return a.SelfMs > b.SelfMs
+		case sortBy == "calls" && a.Calls != b.Calls:
+			return a.Calls > b.Calls
+		case sortBy == "iterations" && a.Iterations != b.Iterations:
+			return a.Iterations > b.Iterations
+		}
+		if profiles[i].TotalMs != profiles[j].TotalMs {
+			return profiles[i].TotalMs > profiles[j].TotalMs
+		}
+		return profiles[i].Calls > profiles[j].Calls
+	})
+	if len(profiles) > top {
+		profiles = profiles[:top]
+	}
+	return profiles
+}
+
+// validateProfileSort rejects an unknown --profile-sort.
+func validateProfileSort(sortBy string) error {
+	if sortBy == "" {
+		return nil
+	}
+	for _, known := range profileSorts {
+		if sortBy == known {
+			return nil
+		}
+	}
+	return fmt.Errorf("--profile-sort must be one of %s", strings.Join(profileSorts, ", "))
+}
+
+func decodeProfileSpan(span string, sources map[string]templateSource) (nodeProfile, bool) {
+	parts := strings.SplitN(span, "|", 4)
+	if len(parts) != 4 {
+		return nodeProfile{}, false
+	}
+	start, startErr := strconv.Atoi(parts[1])
+	end, endErr := strconv.Atoi(parts[2])
+	source, ok := sources[parts[3]]
+	if startErr != nil || endErr != nil || !ok || end > len(source.Content) {
+		return nodeProfile{}, false
+	}
+	line, column := lineColumn(source.Content, parse.Pos(start))
+	return nodeProfile{
+		File:   source.Path,
+		Line:   line,
+		Column: column,
+		Kind:   parts[0],
+		Source: source.Content[start:end],
+	}, true
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// isHiddenAction reports whether action is a call the worker inserted,
+// which declares one of its __goTemplateStudio variables.
+func isHiddenAction(action *parse.ActionNode) bool {
+	decl := action.Pipe.Decl
+	return len(decl) == 1 && strings.HasPrefix(decl[0].Ident[0], "$__goTemplateStudio")
+}
+
+// hiddenCall builds {{ $name := name "span" args... }}. The call declares a
+// variable, so it writes nothing and html/template leaves it unescaped.
+func hiddenCall(tree *parse.Tree, pos parse.Pos, name, span string, args ...parse.Node) *parse.ActionNode {
+	ident := parse.NewIdentifier(name).SetTree(tree).SetPos(pos)
+	arg := &parse.StringNode{NodeType: parse.NodeString, Pos: pos, Quoted: strconv.Quote(span), Text: span}
+	return &parse.ActionNode{
+		NodeType: parse.NodeAction,
+		Pos:      pos,
+		Pipe: &parse.PipeNode{
+			NodeType: parse.NodePipe,
+			Pos:      pos,
+			Decl:     []*parse.VariableNode{{NodeType: parse.NodeVariable, Pos: pos, Ident: []string{"$" + name}}},
+			Cmds:     []*parse.CommandNode{{NodeType: parse.NodeCommand, Pos: pos, Args: append([]parse.Node{ident, arg}, args...)}},
+		},
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProfileCountsCallsAndSortsByTotalTime(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "config.tmpl")
+	writeFile(t, templatePath, "{{ range . }}{{ printf \"%v\" . }}{{ if eq . 3.0 }}{{ break }}{{ end }}{{ end }}\n{{ len . }}")
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, contextPath, `[1, 2, 3, 4]`)
+
+	resp := run(templatePath, contextPath, renderOptions{Profile: true, Trace: true})
+	if resp.Error != "" || resp.Rendered != "123\n4" {
+		t.Fatalf("unexpected render: %+v", resp)
+	}
+
+	calls := map[string]int{}
+	for i, profile := range resp.Profile {
+		if profile.File != templatePath || profile.SelfMs > profile.TotalMs {
+			t.Fatalf("unexpected profile entry: %+v", profile)
+		}
+		if i > 0 && profile.TotalMs > resp.Profile[i-1].TotalMs {
+			t.Fatalf("expected entries sorted by total time, got %+v", resp.Profile)
+		}
+		calls[profile.Source] = profile.Calls
+	}
+	want := map[string]int{
+		"{{ range . }}":       1,
+		`{{ printf "%v" . }}`: 3,
+		"{{ if eq . 3.0 }}":   3,
+		"{{ len . }}":         1,
+	}
+	if len(calls) != len(want) {
+		t.Fatalf("expected %d profiled nodes, got %+v", len(want), resp.Profile)
+	}
+	for source, count := range want {
+		if calls[source] != count {
+			t.Errorf("expected %s to be called %d times, got %d", source, count, calls[source])
+		}
+	}
+	if resp.Profile[0].Kind != "range" {
+		t.Fatalf("expected the range to cost the most, got %+v", resp.Profile[0])
+	}
+}
+
+func TestProfileListsOnlyTopNodes(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "page.tmpl")
+	writeFile(t, templatePath, strings.Repeat("{{ . }}\n", 30))
+
+	resp := run(templatePath, "", renderOptions{Profile: true})
+	if resp.Error != "" || len(resp.Profile) != defaultProfileTop {
+		t.Fatalf("expected the default top %d nodes, got %d", defaultProfileTop, len(resp.Profile))
+	}
+	resp = run(templatePath, "", renderOptions{Profile: true, ProfileTop: 3})
+	if len(resp.Profile) != 3 {
+		t.Fatalf("expected the top 3 nodes, got %+v", resp.Profile)
+	}
+}
+
+func TestProfileCountsRangeIterationsAndSortsByThem(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "report.tmpl")
+	writeFile(t, templatePath, "{{ range $row := . }}{{ range $col := $ }}{{ $col }}{{ end }}{{ end }}")
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, contextPath, `[1, 2, 3]`)
+
+	resp := run(templatePath, contextPath, renderOptions{Profile: true, ProfileSort: "iterations"})
+	if resp.Error != "" || resp.Rendered != "123123123" || len(resp.Profile) != 3 {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	inner, outer, action := resp.Profile[0], resp.Profile[1], resp.Profile[2]
+	if inner.Source != "{{ range $col := $ }}" || inner.Calls != 3 || inner.Iterations != 9 {
+		t.Fatalf("expected the inner range first, got %+v", inner)
+	}
+	if outer.Calls != 1 || outer.Iterations != 3 || action.Calls != 9 || action.Iterations != 0 {
+		t.Fatalf("unexpected profile: %+v", resp.Profile)
+	}
+
+	resp = run(templatePath, contextPath, renderOptions{Profile: true, ProfileSort: "slowest"})
+	if !strings.Contains(resp.Error, "--profile-sort must be one of total, self, calls, iterations") {
+		t.Fatalf("expected an unknown sort to fail, got %+v", resp)
+	}
+}
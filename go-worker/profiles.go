@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// contextProfile is one named context a template is rendered against, such
+// as dev, staging, or prod.
+type contextProfile struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+// profileResult is the render of one profile. It carries the same fields
+// as a single-context response.
+type profileResult struct {
+	Profile string `json:"profile"`
+	response
+}
+
+// parseContextArgs splits repeated --context values into a single context
+// path, the layers merged over it when several unnamed files are given, or,
+// when any is named (name=path), profiles. Unnamed profiles are named after
+// their file.
+func parseContextArgs(values []string) (string, []string, []contextProfile) {
+	named := false
+	for _, value := range values {
+		if _, _, ok := cutProfileName(value); ok {
+			named = true
+		}
+	}
+	if len(values) > 0 && !named {
+		return values[0], values[1:], nil
+	}
+
+	var profiles []contextProfile
+	for _, value := range values {
+		name, path, named := cutProfileName(value)
+		if !named {
+			name, path = profileNameFromPath(value), value
+		}
+		profiles = append(profiles, contextProfile{Name: name, Path: path})
+	}
+	return "", nil, profiles
+}
+
+// cutProfileName splits name=path. A "name" containing a path separator
+// means the = belongs to the path, as in ./out/a=b.json.
+func cutProfileName(value string) (string, string, bool) {
+	name, path, ok := strings.Cut(value, "=")
+	if !ok || name == "" || strings.ContainsAny(name, `/\:`) {
+		return "", "", false
+	}
+	return name, path, true
+}
+
+func profileNameFromPath(path string) string {
+	base := filepath.Base(path)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// loadContextManifest reads a JSON object mapping profile names to context
+// paths, which are resolved against the manifest's directory.
+func loadContextManifest(path string) ([]contextProfile, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("context manifest: %w", err)
+	}
+	var entries map[string]string
+	if err := json.Unmarshal(content, &entries); err != nil {
+		return nil, fmt.Errorf("context manifest %s: %w", path, err)
+	}
+
+	profiles := make([]contextProfile, 0, len(entries))
+	for name, location := range entries {
+		if !filepath.IsAbs(location) && !isObjectStoreURL(location) {
+			location = filepath.Join(filepath.Dir(path), location)
+		}
+		profiles = append(profiles, contextProfile{Name: name, Path: location})
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+	return profiles, nil
+}
+
+// executeProfiles renders the template once per profile. Each successful
+// result after the first includes a diff of its output against the first
+// successful profile's.
+func executeProfiles(templatePath string, opts renderOptions) response {
+	profiles := opts.ContextProfiles
+	if strings.TrimSpace(opts.ContextManifest) != "" {
+		manifest, err := loadContextManifest(opts.ContextManifest)
+		if err != nil {
+			return contextFailure(opts.ContextManifest, err)
+		}
+		profiles = append(profiles, manifest...)
+	}
+
+	seen := map[string]bool{}
+	for _, profile := range profiles {
+		if seen[profile.Name] {
+			return response{Error: fmt.Sprintf("context profile %q is given more than once", profile.Name)}
+		}
+		seen[profile.Name] = true
+	}
+
+	name := templateName(templatePath)
+	results := make([]profileResult, 0, len(profiles))
+	var base *profileResult
+	for _, profile := range profiles {
+		start := time.Now()
+		result := profileResult{Profile: profile.Name, response: executeWithOptions(templatePath, profile.Path, opts)}
+		result.DurationMs = time.Since(start).Milliseconds()
+
+		if result.Error == "" {
+			if base == nil {
+				base = &result
+			} else {
+				result.Diff = unifiedDiff(name+"@"+base.Profile, name+"@"+profile.Name, base.Rendered, result.Rendered)
+			}
+		}
+		results = append(results, result)
+	}
+	return response{Results: results}
+}
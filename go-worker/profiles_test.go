@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseContextArgs(t *testing.T) {
+	if path, layers, profiles := parseContextArgs([]string{"ctx/a=b.json"}); path != "ctx/a=b.json" || len(layers) != 0 || profiles != nil {
+		t.Fatalf("expected a single context, got %q %v %+v", path, layers, profiles)
+	}
+
+	if path, layers, profiles := parseContextArgs([]string{"base.json", "ctx/a=b.json"}); path != "base.json" || !reflect.DeepEqual(layers, []string{"ctx/a=b.json"}) || profiles != nil {
+		t.Fatalf("expected unnamed contexts to layer, got %q %v %+v", path, layers, profiles)
+	}
+
+	path, layers, profiles := parseContextArgs([]string{"dev=ctx/dev.json", "ctx/prod.json"})
+	want := []contextProfile{{Name: "dev", Path: "ctx/dev.json"}, {Name: "prod", Path: "ctx/prod.json"}}
+	if path != "" || layers != nil || !reflect.DeepEqual(profiles, want) {
+		t.Fatalf("unexpected profiles: %q %+v", path, profiles)
+	}
+}
+
+func TestExecuteProfilesRendersEachContext(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "app.tmpl")
+	writeFile(t, templatePath, "host: {{ .host }}\nreplicas: {{ .replicas }}\n")
+	writeFile(t, filepath.Join(dir, "dev.json"), `{"host":"dev.local","replicas":1}`)
+	writeFile(t, filepath.Join(dir, "prod.json"), `{"host":"example.com","replicas":1}`)
+	writeFile(t, filepath.Join(dir, "broken.json"), `{`)
+	manifest := filepath.Join(dir, "profiles.json")
+	writeFile(t, manifest, `{"prod":"prod.json","dev":"dev.json"}`)
+
+	resp := run(templatePath, "", renderOptions{
+		ContextProfiles: []contextProfile{{Name: "broken", Path: filepath.Join(dir, "broken.json")}},
+		ContextManifest: manifest,
+	})
+	if resp.Error != "" || len(resp.Results) != 3 {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	broken, dev, prod := resp.Results[0], resp.Results[1], resp.Results[2]
+	if broken.Profile != "broken" || broken.Error == "" || broken.errorCode != errorCodeContext {
+		t.Fatalf("expected the broken profile to fail on its own, got %+v", broken)
+	}
+	if dev.Profile != "dev" || dev.Rendered != "host: dev.local\nreplicas: 1\n" || dev.Diff != "" {
+		t.Fatalf("unexpected dev result: %+v", dev)
+	}
+	if prod.Profile != "prod" || prod.Rendered != "host: example.com\nreplicas: 1\n" {
+		t.Fatalf("unexpected prod result: %+v", prod)
+	}
+	if !strings.Contains(prod.Diff, "--- app.tmpl@dev\n+++ app.tmpl@prod\n") || !strings.Contains(prod.Diff, "-host: dev.local\n+host: example.com\n") {
+		t.Fatalf("expected prod to be diffed against dev, got %q", prod.Diff)
+	}
+
+	resp = run(templatePath, "", renderOptions{ContextManifest: manifest})
+
+	encoded, err := json.Marshal(versionedResponse(resp, responseVersion2))
+	if err != nil {
+		t.Fatalf("failed to marshal v2 response: %v", err)
+	}
+	if !strings.Contains(string(encoded), `"results":[{"profile":"dev","protocolVersion":2,"rendered":"host: dev.local`) {
+		t.Fatalf("unexpected v2 results: %s", encoded)
+	}
+
+	resp = run(templatePath, "", renderOptions{ContextProfiles: []contextProfile{{Name: "dev", Path: "a.json"}}, ContextManifest: manifest})
+	if !strings.Contains(resp.Error, `"dev" is given more than once`) {
+		t.Fatalf("expected duplicate profile error, got %+v", resp)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Response schema versions. Clients opt into newer shapes with
+// --response-version (or responseVersion per server request); version 1
+// stays the default so older extension builds keep working.
+const (
+	responseVersion1      = 1
+	responseVersion2      = 2
+	latestResponseVersion = responseVersion2
+)
+
+func validateResponseVersion(version int) error {
+	if version < 0 || version > latestResponseVersion {
+		return fmt.Errorf("unsupported response version %d (supported: 1-%d)", version, latestResponseVersion)
+	}
+	return nil
+}
+
+// responseV1 is the original flat payload tagged with its schema version.
+type responseV1 struct {
+	ProtocolVersion int `json:"protocolVersion"`
+	response
+}
+
+// responseV2 keeps every v1 payload field but replaces the error string,
+// flat diagnostic positions, and durationMs with structured equivalents.
+type responseV2 struct {
+	ProtocolVersion int `json:"protocolVersion"`
+	response
+	Diagnostics []diagnosticV2  `json:"diagnostics,omitempty"`
+	Timings     responseTimings `json:"timings"`
+	Error       *responseError  `json:"error,omitempty"`
+	// DurationMs shadows the v1 field so it is left out of v2 payloads.
+	DurationMs *int64            `json:"durationMs,omitempty"`
+	Results    []profileResultV2 `json:"results,omitempty"`
+}
+
+type profileResultV2 struct {
+	Profile string `json:"profile"`
+	responseV2
+}
+
+type diagnosticV2 struct {
+	Message  string            `json:"message"`
+	Severity string            `json:"severity"`
+	Rule     string            `json:"rule,omitempty"`
+	File     string            `json:"file,omitempty"`
+	Range    *textRange        `json:"range,omitempty"`
+	Related  []relatedLocation `json:"related,omitempty"`
+}
+
+// textRange spans from Start up to, but not including, End. Lines and
+// columns are 1-based, in the negotiated position encoding.
+type textRange struct {
+	Start rangePoint `json:"start"`
+	End   rangePoint `json:"end"`
+}
+
+type rangePoint struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+type responseTimings struct {
+	TotalMs int64 `json:"totalMs"`
+	*renderTimings
+}
+
+// responseError classifies a failure so clients can react without parsing
+// the message.
+type responseError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+const (
+	errorCodeParse   = "parse"
+	errorCodeExecute = "execute"
+	errorCodeContext = "context"
+	errorCodeLimit   = "limit"
+	errorCodeFailed  = "failed"
+	// errorCodeCancelled is a server request a cancel request aborted.
+	errorCodeCancelled = "cancelled"
+	// errorCodeUnsupportedInput is a template refused as too large or
+	// binary; see input.go.
+	errorCodeUnsupportedInput = "unsupported-input"
+)
+
+// versionedResponse shapes resp according to the negotiated schema version.
+func versionedResponse(resp response, version int) interface{} {
+	if version != responseVersion2 {
+		return responseV1{ProtocolVersion: responseVersion1, response: resp}
+	}
+	return responseV2Of(resp)
+}
+
+// responseV2Of converts resp, and any per-profile results, to the v2 schema.
+func responseV2Of(resp response) responseV2 {
+	v2 := responseV2{
+		ProtocolVersion: responseVersion2,
+		response:        resp,
+		Timings:         responseTimings{TotalMs: resp.DurationMs, renderTimings: resp.Timings},
+	}
+	for _, result := range resp.Results {
+		v2.Results = append(v2.Results, profileResultV2{Profile: result.Profile, responseV2: responseV2Of(result.response)})
+	}
+	for _, diag := range resp.Diagnostics {
+		v2.Diagnostics = append(v2.Diagnostics, diagnosticV2{
+			Message:  diag.Message,
+			Severity: diag.Severity,
+			Rule:     diag.Rule,
+			File:     diag.File,
+			Range:    diagnosticRange(diag),
+			Related:  diag.Related,
+		})
+	}
+	if resp.Error != "" {
+		v2.Error = &responseError{Code: errorCode(resp), Message: resp.Error}
+	}
+	return v2
+}
+
+// diagnosticRange widens line-only diagnostics to the whole line and
+// column-only ones to an empty range at the column.
+func diagnosticRange(diag diagnostic) *textRange {
+	if diag.Line < 1 {
+		return nil
+	}
+	if diag.Column < 1 {
+		return &textRange{Start: rangePoint{Line: diag.Line, Column: 1}, End: rangePoint{Line: diag.Line + 1, Column: 1}}
+	}
+
+	end := diag.EndColumn
+	if end < diag.Column {
+		end = diag.Column
+	}
+	return &textRange{Start: rangePoint{Line: diag.Line, Column: diag.Column}, End: rangePoint{Line: diag.Line, Column: end}}
+}
+
+func errorCode(resp response) string {
+	switch {
+	case resp.errorCode != "":
+		return resp.errorCode
+	case strings.Contains(resp.Error, `executing "`):
+		return errorCodeExecute
+	case strings.Contains(resp.Error, unsupportedInputMarker):
+		return errorCodeUnsupportedInput
+	case templateErrorPattern.MatchString(resp.Error):
+		return errorCodeParse
+	default:
+		return errorCodeFailed
+	}
+}
+
+// MarshalJSON writes the id ahead of the versioned payload fields.
+func (r serverResponse) MarshalJSON() ([]byte, error) {
+	payload, err := json.Marshal(versionedResponse(r.response, r.version))
+	if err != nil || len(r.ID) == 0 {
+		return payload, err
+	}
+
+	out := make([]byte, 0, len(payload)+len(r.ID)+7)
+	out = append(out, `{"id":`...)
+	out = append(out, r.ID...)
+	out = append(out, ',')
+	return append(out, payload[1:]...), nil
+}
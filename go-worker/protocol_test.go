@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func marshalVersioned(t *testing.T, resp response, version int) map[string]interface{} {
+	t.Helper()
+	payload, err := json.Marshal(versionedResponse(resp, version))
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(payload, &decoded); err != nil {
+		t.Fatalf("failed to decode %s: %v", payload, err)
+	}
+	return decoded
+}
+
+func TestVersionedResponseKeepsV1Shape(t *testing.T) {
+	decoded := marshalVersioned(t, response{Rendered: "ok", DurationMs: 3, Error: "boom"}, responseVersion1)
+	if decoded["protocolVersion"] != 1.0 || decoded["durationMs"] != 3.0 || decoded["error"] != "boom" || decoded["rendered"] != "ok" {
+		t.Fatalf("unexpected v1 payload: %v", decoded)
+	}
+}
+
+func TestVersionedResponseV2StructuresErrorsAndRanges(t *testing.T) {
+	templatePath := filepath.Join(t.TempDir(), "page.tmpl")
+	writeFile(t, templatePath, "{{ index .items 5 }}")
+	contextPath := filepath.Join(filepath.Dir(templatePath), "context.json")
+	writeFile(t, contextPath, `{"items":[]}`)
+
+	resp := run(templatePath, contextPath, renderOptions{})
+	resp.DurationMs = 7
+	decoded := marshalVersioned(t, resp, responseVersion2)
+
+	if decoded["protocolVersion"] != 2.0 {
+		t.Fatalf("expected protocol version 2, got %v", decoded)
+	}
+	if _, ok := decoded["durationMs"]; ok {
+		t.Fatalf("expected durationMs to move into timings, got %v", decoded)
+	}
+	if timings, _ := decoded["timings"].(map[string]interface{}); timings["totalMs"] != 7.0 {
+		t.Fatalf("unexpected timings: %v", decoded["timings"])
+	}
+	if failure, _ := decoded["error"].(map[string]interface{}); failure["code"] != errorCodeExecute || !strings.Contains(failure["message"].(string), "index") {
+		t.Fatalf("unexpected structured error: %v", decoded["error"])
+	}
+
+	diagnostics, _ := decoded["diagnostics"].([]interface{})
+	if len(diagnostics) != 1 {
+		t.Fatalf("expected one diagnostic, got %v", decoded["diagnostics"])
+	}
+	want := map[string]interface{}{
+		"start": map[string]interface{}{"line": 1.0, "column": 4.0},
+		"end":   map[string]interface{}{"line": 1.0, "column": 18.0},
+	}
+	if got := diagnostics[0].(map[string]interface{})["range"]; !jsonEqual(got, want) {
+		t.Fatalf("unexpected range %v", got)
+	}
+}
+
+func TestVersionedResponseV2ClassifiesContextFailures(t *testing.T) {
+	contextPath := filepath.Join(t.TempDir(), "context.json")
+	writeFile(t, contextPath, "{")
+	templatePath := filepath.Join(filepath.Dir(contextPath), "page.tmpl")
+	writeFile(t, templatePath, "static")
+
+	decoded := marshalVersioned(t, run(templatePath, contextPath, renderOptions{}), responseVersion2)
+	if failure, _ := decoded["error"].(map[string]interface{}); failure["code"] != errorCodeContext {
+		t.Fatalf("expected context error code, got %v", decoded["error"])
+	}
+}
+
+func TestServeNegotiatesResponseVersionPerRequest(t *testing.T) {
+	templatePath := filepath.Join(t.TempDir(), "page.tmpl")
+	writeFile(t, templatePath, "static")
+
+	requests := `{"id":1,"template":` + quoteJSON(templatePath) + `,"responseVersion":2}` + "\n" +
+		`{"id":2,"template":` + quoteJSON(templatePath) + `,"responseVersion":9}`
+
+	var output bytes.Buffer
+	if err := serve(strings.NewReader(requests), &output, renderOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	byID := map[float64]map[string]interface{}{}
+	for _, line := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+		var decoded map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &decoded); err != nil {
+			t.Fatalf("invalid response line %q: %v", line, err)
+		}
+		byID[decoded["id"].(float64)] = decoded
+	}
+
+	if byID[1]["protocolVersion"] != 2.0 || byID[1]["rendered"] != "static" {
+		t.Fatalf("unexpected v2 response: %v", byID[1])
+	}
+	if byID[2]["protocolVersion"] != 1.0 || !strings.Contains(byID[2]["error"].(string), "unsupported response version 9") {
+		t.Fatalf("expected v1 error for unsupported version, got %v", byID[2])
+	}
+}
+
+func jsonEqual(a, b interface{}) bool {
+	left, _ := json.Marshal(a)
+	right, _ := json.Marshal(b)
+	return bytes.Equal(left, right)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestSeedMakesRandomHelpersDeterministic(t *testing.T) {
+	templatePath := filepath.Join(t.TempDir(), "scaffold.tmpl")
+	writeFile(t, templatePath, `{{ uuidv4 }} {{ randAlphaNum 12 }} {{ randInt 10 20 }}`)
+
+	pattern := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12} [0-9a-zA-Z]{12} 1[0-9]$`)
+	render := func(opts renderOptions) string {
+		t.Helper()
+		resp := run(templatePath, "", opts)
+		if resp.Error != "" || !pattern.MatchString(resp.Rendered) {
+			t.Fatalf("unexpected render %q (error %q)", resp.Rendered, resp.Error)
+		}
+		return resp.Rendered
+	}
+
+	seeded := render(renderOptions{Seed: "42"})
+	if again := render(renderOptions{Seed: "42"}); again != seeded {
+		t.Fatalf("expected the same output for the same seed, got %q and %q", seeded, again)
+	}
+	if other := render(renderOptions{Seed: "7"}); other == seeded {
+		t.Fatalf("expected another seed to draw other values, got %q", other)
+	}
+	if render(renderOptions{}) == render(renderOptions{}) {
+		t.Fatalf("expected unseeded renders to differ")
+	}
+
+	// The seed wins over Sprig's helpers, and holds in the server.
+	cache := newTemplateCache()
+	sprig := render(renderOptions{Seed: "42", Funcs: funcLibrarySprig, cache: cache})
+	if again := render(renderOptions{Seed: "42", Funcs: funcLibrarySprig, cache: cache}); again != sprig || sprig != seeded {
+		t.Fatalf("expected Sprig renders to be seeded too, got %q and %q", sprig, again)
+	}
+}
+
+func TestRandomHelpersRejectBadArguments(t *testing.T) {
+	templatePath := filepath.Join(t.TempDir(), "bad.tmpl")
+	if resp := run(templatePath, "", renderOptions{Seed: "soon"}); !strings.Contains(resp.Error, `invalid --seed "soon"`) {
+		t.Fatalf("expected a seed error, got %+v", resp)
+	}
+	for source, want := range map[string]string{
+		`{{ randInt 5 5 }}`: "randInt: expected whole numbers with min below max",
+		`{{ randInt -9223372036854775807 9223372036854775807 }}`: "randInt: expected whole numbers with min below max",
+		`{{ randAlphaNum -1 }}`:                                  "randAlphaNum: count must be a whole number",
+		`{{ randAlphaNum "3" }}`:                                 "randAlphaNum: expected a number, got string",
+	} {
+		writeFile(t, templatePath, source)
+		if resp := run(templatePath, "", renderOptions{Seed: "1"}); !strings.Contains(resp.Error, want) {
+			t.Errorf("%s: expected an error containing %q, got %+v", source, want, resp)
+		}
+	}
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template/parse"
+)
+
+// variableNamePattern is what a renamed variable may be called.
+var variableNamePattern = regexp.MustCompile(`^\$[A-Za-z_][A-Za-z0-9_]*$`)
+
+// referenceReport lists every occurrence of the template name or variable
+// under the cursor. Kind is template or variable.
+type referenceReport struct {
+	Name      string            `json:"name"`
+	Kind      string            `json:"kind"`
+	Locations []symbolReference `json:"locations"`
+}
+
+// symbolReference is one occurrence: the quoted name of a template call,
+// define, or block, or a variable. Declaration marks the define or block,
+// or the action declaring the variable.
+type symbolReference struct {
+	File        string `json:"file"`
+	Line        int    `json:"line"`
+	Column      int    `json:"column"`
+	EndLine     int    `json:"endLine"`
+	EndColumn   int    `json:"endColumn"`
+	Declaration bool   `json:"declaration,omitempty"`
+}
+
+// renameReport holds the edits that rename the symbol under the cursor to
+// NewName, one per occurrence.
+type renameReport struct {
+	Name    string     `json:"name"`
+	Kind    string     `json:"kind"`
+	NewName string     `json:"newName"`
+	Edits   []textEdit `json:"edits"`
+}
+
+// textEdit replaces the text from Line:Column up to EndLine:EndColumn of
+// File with NewText.
+type textEdit struct {
+	File      string `json:"file"`
+	Line      int    `json:"line"`
+	Column    int    `json:"column"`
+	EndLine   int    `json:"endLine"`
+	EndColumn int    `json:"endColumn"`
+	NewText   string `json:"newText"`
+}
+
+// symbolTarget is the symbol under the cursor and everywhere it occurs.
+// sources are the files searched for a template name; tree is the
+// template declaring a variable.
+type symbolTarget struct {
+	name        string
+	kind        string
+	occurrences []occurrence
+	sources     []templateSource
+	tree        *parse.Tree
+}
+
+// occurrence is a symbolReference before it is turned into lines and
+// columns: the byte range of the name in source.
+type occurrence struct {
+	source      templateSource
+	start, end  int
+	declaration bool
+}
+
+func (o occurrence) reference() symbolReference {
+	line, column := lineColumn(o.source.Content, parse.Pos(o.start))
+	endLine, endColumn := lineColumn(o.source.Content, parse.Pos(o.end))
+	return symbolReference{File: o.source.Path, Line: line, Column: column, EndLine: endLine, EndColumn: endColumn, Declaration: o.declaration}
+}
+
+// executeReferences finds every usage of the template name or variable at
+// --line/--column: template names across the template and its includes,
+// variables within the template that declares them.
+func executeReferences(templatePath string, opts renderOptions) response {
+	target, resp := findSymbolTarget(templatePath, opts)
+	if resp.Error != "" || target.name == "" {
+		return resp
+	}
+	report := &referenceReport{Name: target.name, Kind: target.kind, Locations: []symbolReference{}}
+	for _, occurrence := range target.occurrences {
+		report.Locations = append(report.Locations, occurrence.reference())
+	}
+	resp.References = report
+	return resp
+}
+
+// executeRename returns the edits renaming the template name or variable at
+// --line/--column to --new-name everywhere executeReferences finds it. It
+// refuses names that would collide with an existing define or variable,
+// and template names that are aliases from the project config.
+func executeRename(templatePath string, opts renderOptions) response {
+	target, resp := findSymbolTarget(templatePath, opts)
+	if resp.Error != "" {
+		return resp
+	}
+	name := target.name
+	if name == "" {
+		return response{Error: fmt.Sprintf("nothing to rename at %d:%d", opts.Line, opts.Column)}
+	}
+	newName := strings.TrimSpace(opts.NewName)
+	if target.kind == "variable" && newName != "" && !strings.HasPrefix(newName, "$") {
+		newName = "$" + newName
+	}
+	if err := validateRename(templatePath, target, newName, opts); err != nil {
+		return response{Error: err.Error()}
+	}
+
+	report := &renameReport{Name: name, Kind: target.kind, NewName: newName, Edits: []textEdit{}}
+	for _, occurrence := range target.occurrences {
+		text := newName
+		if target.kind == "template" {
+			quoted, ok := requote(occurrence.source.Content[occurrence.start:occurrence.end], newName)
+			if !ok {
+				return response{Error: fmt.Sprintf("cannot rename %q to %q: the new name does not fit the raw string at %s", name, newName, occurrence.source.Path)}
+			}
+			text = quoted
+		}
+		reference := occurrence.reference()
+		report.Edits = append(report.Edits, textEdit{
+			File:      reference.File,
+			Line:      reference.Line,
+			Column:    reference.Column,
+			EndLine:   reference.EndLine,
+			EndColumn: reference.EndColumn,
+			NewText:   text,
+		})
+	}
+	resp.Rename = report
+	return resp
+}
+
+// requote quotes name the way original, a quoted template name, is quoted.
+func requote(original, name string) (string, bool) {
+	if strings.HasPrefix(original, "`") {
+		return "`" + name + "`", !strings.Contains(name, "`")
+	}
+	return strconv.Quote(name), true
+}
+
+func validateRename(templatePath string, target symbolTarget, newName string, opts renderOptions) error {
+	name := target.name
+	switch {
+	case newName == "":
+		return errors.New("rename needs --new-name")
+	case newName == name:
+		return fmt.Errorf("%q already has that name", name)
+	}
+	if target.kind == "variable" {
+		if !variableNamePattern.MatchString(newName) {
+			return fmt.Errorf("%q is not a valid variable name", newName)
+		}
+		for _, group := range variableGroups(target.tree) {
+			if group[0].Name == newName {
+				return fmt.Errorf("variable %s is already declared in template %q", newName, target.tree.Name)
+			}
+		}
+		return nil
+	}
+	if opts.project != nil {
+		aliases := opts.project.TemplateAliases
+		ext := path.Ext(templateName(templatePath))
+		if _, ok := resolveAlias(name, aliases, ext); ok {
+			return fmt.Errorf("template %q is an alias from the project config; rename it there", name)
+		}
+		if _, ok := resolveAlias(newName, aliases, ext); ok {
+			return fmt.Errorf("template %q is already an alias in the project config", newName)
+		}
+	}
+	for _, source := range target.sources {
+		for _, action := range scanActions(source.Content, opts.LeftDelim, opts.RightDelim) {
+			if keyword := action.Keyword(); keyword != "define" && keyword != "block" {
+				continue
+			}
+			if declared, ok := quotedActionArgument(action); ok && declared == newName {
+				line, column := lineColumn(source.Content, parse.Pos(action.Start))
+				return fmt.Errorf("template %q is already defined at %s:%d:%d", newName, source.Path, line, column)
+			}
+		}
+	}
+	return nil
+}
+
+// findSymbolTarget finds the symbol at the cursor and all of its
+// occurrences, in file and then source order. An empty name with no error
+// means the cursor is not on a template name or variable.
+func findSymbolTarget(templatePath string, opts renderOptions) (symbolTarget, response) {
+	if templatePath == "" {
+		return symbolTarget{}, response{Error: "template path is required"}
+	}
+	content, err := readTemplate(templatePath, opts)
+	if err != nil {
+		return symbolTarget{}, response{Error: err.Error()}
+	}
+	offset, err := cursorOffset(content, opts)
+	if err != nil {
+		return symbolTarget{}, response{Error: err.Error()}
+	}
+	main := templateSource{Name: templateName(templatePath), Path: templatePath, Content: content}
+	trees, err := parseTreesWithDelims(main.Name, content, opts.LeftDelim, opts.RightDelim)
+	if err != nil {
+		return symbolTarget{}, response{
+			Diagnostics: []diagnostic{templateDiagnosticWithDelims(err, templatePath, content, opts.LeftDelim, opts.RightDelim)},
+			Error:       err.Error(),
+		}
+	}
+
+	if name, ok := templateNameAt(main, offset, opts); ok {
+		includes, warnings := resolveAliasIncludes(templatePath, content, opts)
+		globbed, globWarnings := resolveIncludePatterns(templatePath, opts)
+		target := symbolTarget{name: name, kind: "template", sources: append(append([]templateSource{main}, includes...), globbed...)}
+		for _, source := range target.sources {
+			target.occurrences = append(target.occurrences, templateNameOccurrences(source, name, opts)...)
+		}
+		return target, response{Diagnostics: append(warnings, globWarnings...)}
+	}
+
+	for _, treeName := range sortedTreeNames(trees, main.Name) {
+		for _, group := range variableGroups(trees[treeName]) {
+			for _, use := range group {
+				if offset < int(use.Pos) || offset >= int(use.Pos)+len(use.Name) {
+					continue
+				}
+				target := symbolTarget{name: use.Name, kind: "variable", tree: trees[treeName]}
+				for _, use := range group {
+					target.occurrences = append(target.occurrences, occurrence{source: main, start: int(use.Pos), end: int(use.Pos) + len(use.Name), declaration: use.Declaration})
+				}
+				return target, response{}
+			}
+		}
+	}
+	return symbolTarget{}, response{}
+}
+
+// templateNameAt returns the template name quoted by the template, define,
+// or block action under offset, when offset is on the name.
+func templateNameAt(source templateSource, offset int, opts renderOptions) (string, bool) {
+	for _, action := range scanActions(source.Content, opts.LeftDelim, opts.RightDelim) {
+		if offset < action.Start || offset >= action.End {
+			continue
+		}
+		switch action.Keyword() {
+		case "template", "define", "block":
+		default:
+			return "", false
+		}
+		start, end, ok := quotedArgumentSpan(source.Content, action)
+		if !ok || offset < start || offset >= end {
+			return "", false
+		}
+		return quotedActionArgument(action)
+	}
+	return "", false
+}
+
+// templateNameOccurrences lists the quoted names of the template calls,
+// defines, and blocks of source that name the template called name.
+func templateNameOccurrences(source templateSource, name string, opts renderOptions) []occurrence {
+	var occurrences []occurrence
+	for _, action := range scanActions(source.Content, opts.LeftDelim, opts.RightDelim) {
+		keyword := action.Keyword()
+		if keyword != "template" && keyword != "define" && keyword != "block" {
+			continue
+		}
+		if declared, ok := quotedActionArgument(action); !ok || declared != name {
+			continue
+		}
+		if start, end, ok := quotedArgumentSpan(source.Content, action); ok {
+			occurrences = append(occurrences, occurrence{source: source, start: start, end: end, declaration: keyword != "template"})
+		}
+	}
+	return occurrences
+}
+
+// variableUse is a declaration of a variable, or a use or assignment of it.
+type variableUse struct {
+	Name        string
+	Pos         parse.Pos
+	Declaration bool
+}
+
+// variableGroups resolves the variables of tree the way text/template
+// scopes them, and returns one group per declaration: the declaration
+// followed by every use and assignment that refers to it. $ is left out.
+func variableGroups(tree *parse.Tree) [][]variableUse {
+	if tree == nil || tree.Root == nil {
+		return nil
+	}
+	var groups [][]variableUse
+	type binding struct {
+		name  string
+		group int
+	}
+	use := func(scope []binding, variable *parse.VariableNode) {
+		name := variable.Ident[0]
+		for i := len(scope) - 1; i >= 0; i-- {
+			if scope[i].name == name {
+				groups[scope[i].group] = append(groups[scope[i].group], variableUse{Name: name, Pos: variable.Pos})
+				return
+			}
+		}
+	}
+	uses := func(scope []binding, node parse.Node) {
+		walkNodes(node, func(node parse.Node) bool {
+			if variable, ok := node.(*parse.VariableNode); ok {
+				use(scope, variable)
+			}
+			return true
+		})
+	}
+	// pipe records the uses in pipe and returns scope with the variables
+	// it declares.
+	pipe := func(scope []binding, pipe *parse.PipeNode) []binding {
+		if pipe == nil {
+			return scope
+		}
+		for _, command := range pipe.Cmds {
+			uses(scope, command)
+		}
+		for _, variable := range pipe.Decl {
+			if pipe.IsAssign {
+				use(scope, variable)
+				continue
+			}
+			groups = append(groups, []variableUse{{Name: variable.Ident[0], Pos: variable.Pos, Declaration: true}})
+			scope = append(scope, binding{name: variable.Ident[0], group: len(groups) - 1})
+		}
+		return scope
+	}
+	var list func(scope []binding, list *parse.ListNode)
+	list = func(scope []binding, node *parse.ListNode) {
+		if node == nil {
+			return
+		}
+		scope = scope[:len(scope):len(scope)]
+		for _, child := range node.Nodes {
+			var branch *parse.BranchNode
+			switch typed := child.(type) {
+			case *parse.ActionNode:
+				scope = pipe(scope, typed.Pipe)
+			case *parse.TemplateNode:
+				pipe(scope, typed.Pipe)
+			case *parse.IfNode:
+				branch = &typed.BranchNode
+			case *parse.WithNode:
+				branch = &typed.BranchNode
+			case *parse.RangeNode:
+				branch = &typed.BranchNode
+			}
+			if branch != nil {
+				inner := pipe(scope[:len(scope):len(scope)], branch.Pipe)
+				list(inner, branch.List)
+				list(inner, branch.ElseList)
+			}
+		}
+	}
+	list(nil, tree.Root)
+
+	for _, group := range groups {
+		sort.SliceStable(group, func(i, j int) bool { return group[i].Pos < group[j].Pos })
+	}
+	return groups
+}
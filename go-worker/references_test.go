@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestReferencesFindTemplateNamesAcrossIncludes(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "page.tmpl")
+	writeFile(t, templatePath, "{{ template \"card\" . }}\n{{ block \"footer\" . }}{{ template \"card\" .x }}{{ end }}")
+	writeFile(t, filepath.Join(dir, "partials", "card.tmpl"), "{{ define `card` }}<b>{{ .name }}</b>{{ end }}{{ define \"cards\" }}{{ end }}")
+	includes := []string{filepath.Join(dir, "partials", "*.tmpl")}
+
+	resp := run(templatePath, "", renderOptions{Mode: "references", Includes: includes, Line: 1, Column: 15})
+	if resp.Error != "" || resp.References == nil || resp.References.Name != "card" || resp.References.Kind != "template" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	var got []string
+	for _, location := range resp.References.Locations {
+		got = append(got, fmt.Sprintf("%s:%d:%d-%d:%v", filepath.Base(location.File), location.Line, location.Column, location.EndColumn, location.Declaration))
+	}
+	if strings.Join(got, " ") != "page.tmpl:1:13-19:false page.tmpl:2:35-41:false card.tmpl:1:11-17:true" {
+		t.Fatalf("unexpected locations: %v", got)
+	}
+
+	if resp := run(templatePath, "", renderOptions{Mode: "references", Line: 1, Column: 3}); resp.Error != "" || resp.References != nil {
+		t.Fatalf("expected nothing off the name, got %+v", resp)
+	}
+}
+
+func TestRenameTemplateNameKeepsQuotingAndRefusesCollisions(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "page.tmpl")
+	writeFile(t, templatePath, "{{ template \"card\" . }}")
+	writeFile(t, filepath.Join(dir, "card.tmpl"), "{{ define `card` }}x{{ end }}{{ define \"badge\" }}y{{ end }}")
+	includes := []string{filepath.Join(dir, "card.tmpl")}
+
+	resp := run(templatePath, "", renderOptions{Mode: "rename", Includes: includes, Line: 1, Column: 14, NewName: "tile"})
+	if resp.Error != "" || resp.Rename == nil || len(resp.Rename.Edits) != 2 {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	if edit := resp.Rename.Edits[0]; edit.NewText != `"tile"` || edit.Column != 13 || edit.EndColumn != 19 {
+		t.Fatalf("unexpected edit: %+v", edit)
+	}
+	if edit := resp.Rename.Edits[1]; edit.NewText != "`tile`" || edit.File != includes[0] {
+		t.Fatalf("unexpected edit: %+v", edit)
+	}
+
+	resp = run(templatePath, "", renderOptions{Mode: "rename", Includes: includes, Line: 1, Column: 14, NewName: "badge"})
+	if !strings.Contains(resp.Error, `template "badge" is already defined`) {
+		t.Fatalf("expected a collision, got %+v", resp)
+	}
+}
+
+func TestRenameVariableFollowsScopes(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "page.tmpl")
+	writeFile(t, templatePath, "{{ $x := .a }}{{ range $i, $x := .items }}{{ $x }}{{ end }}{{ $x }}{{ $x = 2 }}{{ $y := 1 }}")
+
+	resp := run(templatePath, "", renderOptions{Mode: "references", Line: 1, Column: 5})
+	if resp.Error != "" || resp.References == nil || resp.References.Name != "$x" || len(resp.References.Locations) != 3 {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	var columns []string
+	for _, location := range resp.References.Locations {
+		columns = append(columns, strconv.Itoa(location.Column))
+	}
+	if strings.Join(columns, ",") != "4,63,71" || !resp.References.Locations[0].Declaration {
+		t.Fatalf("unexpected locations: %v %+v", columns, resp.References.Locations)
+	}
+
+	resp = run(templatePath, "", renderOptions{Mode: "rename", Line: 1, Column: 46, NewName: "item"})
+	if resp.Error != "" || len(resp.Rename.Edits) != 2 || resp.Rename.Edits[0].NewText != "$item" || resp.Rename.Edits[0].Column != 28 {
+		t.Fatalf("unexpected rename: %+v", resp)
+	}
+	if resp := run(templatePath, "", renderOptions{Mode: "rename", Line: 1, Column: 5, NewName: "$y"}); !strings.Contains(resp.Error, "already declared") {
+		t.Fatalf("expected a collision, got %+v", resp)
+	}
+	if resp := run(templatePath, "", renderOptions{Mode: "rename", Line: 1, Column: 5, NewName: "$1"}); !strings.Contains(resp.Error, "not a valid variable name") {
+		t.Fatalf("expected an invalid name, got %+v", resp)
+	}
+}
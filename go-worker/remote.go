@@ -0,0 +1,304 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	maxRemoteBytes = 5 << 20
+	remoteTimeout  = 10 * time.Second
+)
+
+var remoteClient = &http.Client{Timeout: remoteTimeout}
+
+// remoteCacheMeta is stored next to each cached body so later fetches can
+// revalidate with conditional requests.
+type remoteCacheMeta struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"lastModified,omitempty"`
+	FetchedAt    time.Time `json:"fetchedAt,omitempty"`
+}
+
+// remoteFetch describes one cached download: what it is, for messages,
+// the headers to send, how large a body may be, and how long a cached copy
+// is used without asking the server.
+type remoteFetch struct {
+	kind     string
+	headers  http.Header
+	maxBytes int
+	ttl      time.Duration
+}
+
+func isRemoteURL(location string) bool {
+	lower := strings.ToLower(location)
+	return strings.HasPrefix(lower, "https://") || strings.HasPrefix(lower, "http://")
+}
+
+// readTemplate loads a template from disk, from the git revision named by
+// AtRef, from s3:// or gs:// object storage, or, for http(s) URLs, from the
+// allowlisted remote store. Templates over --max-template-bytes, or that
+// look binary, are refused with an unsupportedInputError; see input.go.
+func readTemplate(location string, opts renderOptions) (string, error) {
+	content, err := fetchTemplate(location, opts)
+	if err != nil {
+		return "", err
+	}
+	if err := checkTemplateSize(location, int64(len(content)), opts); err != nil {
+		return "", err
+	}
+	if err := checkTemplateContent(location, content, false); err != nil {
+		return "", err
+	}
+	opts.reads.record(location, string(content))
+	return string(content), nil
+}
+
+func fetchTemplate(location string, opts renderOptions) ([]byte, error) {
+	if isObjectStoreURL(location) {
+		return fetchObject(location, opts)
+	}
+	if isRemoteURL(location) {
+		return fetchRemote(location, opts)
+	}
+	if opts.AtRef != "" {
+		return readAtRef(location, opts.AtRef)
+	}
+
+	// Check the size first so the wrong file is not read whole.
+	if info, err := os.Stat(location); err == nil && info.Mode().IsRegular() {
+		if err := checkTemplateSize(location, info.Size(), opts); err != nil {
+			return nil, err
+		}
+	}
+	return os.ReadFile(location)
+}
+
+// templateName returns the name a template is parsed under: its base file
+// name, ignoring any URL query or fragment.
+func templateName(location string) string {
+	if isRemoteURL(location) || isObjectStoreURL(location) {
+		if parsed, err := url.Parse(location); err == nil {
+			return path.Base(parsed.Path)
+		}
+	}
+	return filepath.Base(location)
+}
+
+// remoteAllowed reports whether rawURL matches an allowlist entry. Entries
+// are either host names ("templates.example.com") or URL prefixes
+// ("https://gist.githubusercontent.com/team/", "s3://fixtures/emails").
+// Both sides are parsed, so a prefix entry matches only its own scheme and
+// host or bucket, port included, and only whole path segments:
+// "https://example.com/team" allows "/team/a.tmpl" but not "/team-b/a.tmpl".
+// Host names only allow http(s), so object storage needs a prefix entry.
+func remoteAllowed(rawURL string, allowlist []string) bool {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Host == "" || !(isRemoteURL(rawURL) || isObjectStoreURL(rawURL)) {
+		return false
+	}
+
+	for _, entry := range allowlist {
+		if !isRemoteURL(entry) && !isObjectStoreURL(entry) {
+			if isRemoteURL(rawURL) && strings.EqualFold(parsed.Hostname(), entry) {
+				return true
+			}
+			continue
+		}
+		prefix, err := url.Parse(entry)
+		if err != nil || !strings.EqualFold(parsed.Scheme, prefix.Scheme) || !strings.EqualFold(parsed.Host, prefix.Host) {
+			continue
+		}
+		dir := strings.TrimSuffix(prefix.Path, "/")
+		if dir == "" || parsed.Path == dir || strings.HasPrefix(parsed.Path, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+var errRedirectNotAllowed = errors.New("redirect target is not in the allowlist (see --remote-allow)")
+
+// remoteClientFor returns a client that follows a redirect only when its
+// target is itself in the allowlist, so an allowed server cannot hand the
+// fetch on to one that is not.
+func remoteClientFor(allowlist []string) *http.Client {
+	client := *remoteClient
+	client.CheckRedirect = func(request *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		if !remoteAllowed(request.URL.String(), allowlist) {
+			return fmt.Errorf("%w: %s", errRedirectNotAllowed, request.URL)
+		}
+		return nil
+	}
+	return &client
+}
+
+// staleRemotes records the remote templates and contexts a render used a
+// cached copy of because the server could not be reached, so the preview
+// says it may be out of date.
+type staleRemotes struct {
+	mu      sync.Mutex
+	fetches []staleRemote
+}
+
+type staleRemote struct {
+	kind      string
+	url       string
+	fetchedAt time.Time
+	err       error
+}
+
+func (s *staleRemotes) record(fetch staleRemote) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fetches = append(s.fetches, fetch)
+}
+
+// diagnostics returns one warning per stale copy used.
+func (s *staleRemotes) diagnostics() []diagnostic {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	diagnostics := make([]diagnostic, 0, len(s.fetches))
+	for _, fetch := range s.fetches {
+		message := fmt.Sprintf("%s %s could not be fetched (%v); using the copy cached", fetch.kind, fetch.url, fetch.err)
+		if !fetch.fetchedAt.IsZero() {
+			message += " at " + fetch.fetchedAt.UTC().Format(time.RFC3339)
+		}
+		diagnostics = append(diagnostics, diagnostic{Message: message, Severity: "warning", Rule: "stale-remote"})
+	}
+	return diagnostics
+}
+
+// fetchRemote downloads the template at rawURL; see fetchRemoteCached.
+func fetchRemote(rawURL string, opts renderOptions) ([]byte, error) {
+	return fetchRemoteCached(rawURL, opts, remoteFetch{kind: "remote template", maxBytes: maxRemoteBytes})
+}
+
+// fetchRemoteCached downloads rawURL, reusing the cached copy while it is
+// younger than fetch.ttl, when the server answers 304 Not Modified, or
+// when it cannot be reached, which is recorded in opts.staleRemotes.
+// Redirects are followed only within the allowlist. Copies are cached per
+// URL and headers, so two credentials never share a body.
+func fetchRemoteCached(rawURL string, opts renderOptions, fetch remoteFetch) ([]byte, error) {
+	if !remoteAllowed(rawURL, opts.RemoteAllow) {
+		return nil, fmt.Errorf("%s %s is not in the allowlist (see --remote-allow)", fetch.kind, rawURL)
+	}
+
+	cacheDir := opts.RemoteCacheDir
+	if cacheDir == "" {
+		if userCache, err := os.UserCacheDir(); err == nil {
+			cacheDir = filepath.Join(userCache, "go-template-studio", "remote")
+		}
+	}
+
+	hash := sha256.New()
+	hash.Write([]byte(rawURL))
+	for _, name := range sortedHeaderNames(fetch.headers) {
+		for _, value := range fetch.headers.Values(name) {
+			fmt.Fprintf(hash, "\x00%s: %s", name, value)
+		}
+	}
+	key := hex.EncodeToString(hash.Sum(nil))
+	bodyPath := filepath.Join(cacheDir, key+".body")
+	metaPath := filepath.Join(cacheDir, key+".json")
+
+	cached, cachedErr := os.ReadFile(bodyPath)
+	var meta remoteCacheMeta
+	if cachedErr == nil {
+		if metaBytes, err := os.ReadFile(metaPath); err == nil {
+			_ = json.Unmarshal(metaBytes, &meta)
+		}
+	}
+
+	if cachedErr == nil && fetch.ttl > 0 && time.Since(meta.FetchedAt) < fetch.ttl {
+		return cached, nil
+	}
+
+	request, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range fetch.headers {
+		request.Header[name] = values
+	}
+	if cachedErr == nil {
+		if meta.ETag != "" {
+			request.Header.Set("If-None-Match", meta.ETag)
+		}
+		if meta.LastModified != "" {
+			request.Header.Set("If-Modified-Since", meta.LastModified)
+		}
+	}
+
+	resp, err := remoteClientFor(opts.RemoteAllow).Do(request)
+	if err != nil {
+		if cachedErr == nil && !errors.Is(err, errRedirectNotAllowed) {
+			opts.staleRemotes.record(staleRemote{kind: fetch.kind, url: rawURL, fetchedAt: meta.FetchedAt, err: err})
+			return cached, nil
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cachedErr == nil:
+		// The server confirmed the copy, so the TTL starts again.
+		meta.FetchedAt = time.Now()
+		if metaBytes, err := json.Marshal(meta); err == nil {
+			_ = os.WriteFile(metaPath, metaBytes, 0o600)
+		}
+		return cached, nil
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("fetching %s: %s", rawURL, resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, int64(fetch.maxBytes)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > fetch.maxBytes {
+		return nil, fmt.Errorf("%s exceeds the %d MiB limit", fetch.kind, fetch.maxBytes>>20)
+	}
+
+	if cacheDir != "" && os.MkdirAll(cacheDir, 0o755) == nil {
+		meta = remoteCacheMeta{URL: rawURL, ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified"), FetchedAt: time.Now()}
+		if metaBytes, err := json.Marshal(meta); err == nil {
+			_ = os.WriteFile(bodyPath, body, 0o600)
+			_ = os.WriteFile(metaPath, metaBytes, 0o600)
+		}
+	}
+
+	return body, nil
+}
+
+func sortedHeaderNames(headers http.Header) []string {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func newTemplateServer(t *testing.T, files map[string]string) (*httptest.Server, *int32, *int32) {
+	t.Helper()
+	var requests, notModified int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		body, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		etag := `"` + r.URL.Path + `-v1"`
+		if r.Header.Get("If-None-Match") == etag {
+			atomic.AddInt32(&notModified, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &requests, &notModified
+}
+
+func TestRunFetchesRemoteTemplatesWithETagRevalidation(t *testing.T) {
+	server, requests, notModified := newTemplateServer(t, map[string]string{
+		"/welcome.tmpl": "Hello {{ template \"@remote/footer\" }}",
+		"/footer.tmpl":  "footer",
+	})
+
+	configPath := t.TempDir() + "/config.json"
+	writeFile(t, configPath, `{"templateAliases":{"@remote":"`+server.URL+`"}}`)
+
+	opts := renderOptions{Config: configPath, RemoteAllow: []string{server.URL + "/"}, RemoteCacheDir: t.TempDir()}
+	resp := run(server.URL+"/welcome.tmpl", "", opts)
+	if resp.Error != "" || resp.Rendered != "Hello footer" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	resp = run(server.URL+"/welcome.tmpl", "", opts)
+	if resp.Rendered != "Hello footer" {
+		t.Fatalf("unexpected cached response: %+v", resp)
+	}
+
+	if atomic.LoadInt32(requests) != 4 || atomic.LoadInt32(notModified) != 2 {
+		t.Fatalf("expected second render to revalidate both templates, got %d requests and %d 304s", *requests, *notModified)
+	}
+}
+
+func TestFetchRemoteRequiresAllowlist(t *testing.T) {
+	server, requests, _ := newTemplateServer(t, map[string]string{"/a.tmpl": "a"})
+
+	_, err := fetchRemote(server.URL+"/a.tmpl", renderOptions{RemoteCacheDir: t.TempDir()})
+	if err == nil || !strings.Contains(err.Error(), "allowlist") {
+		t.Fatalf("expected allowlist error, got %v", err)
+	}
+	if atomic.LoadInt32(requests) != 0 {
+		t.Fatal("expected no request for a disallowed URL")
+	}
+}
+
+func TestFetchRemoteReportsHTTPErrors(t *testing.T) {
+	server, _, _ := newTemplateServer(t, nil)
+
+	_, err := fetchRemote(server.URL+"/missing.tmpl", renderOptions{RemoteAllow: []string{"127.0.0.1"}, RemoteCacheDir: t.TempDir()})
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Fatalf("expected 404 error, got %v", err)
+	}
+}
+
+func TestRemoteAllowedAndTemplateName(t *testing.T) {
+	if !remoteAllowed("https://templates.example.com/a.tmpl", []string{"templates.example.com"}) {
+		t.Fatal("expected host entry to match")
+	}
+	for rawURL, want := range map[string]bool{
+		"https://templates.example.com/team/a.tmpl":          true,
+		"https://templates.example.com/team":                 true,
+		"https://TEMPLATES.example.com/team/a.tmpl":          true,
+		"https://evil.example.com/team/a.tmpl":               false,
+		"https://templates.example.com.evil.com/team/a.tmpl": false,
+		"https://templates.example.com@evil.com/team/a.tmpl": false,
+		"https://templates.example.com:8443/team/a.tmpl":     false,
+		"http://templates.example.com/team/a.tmpl":           false,
+		"https://templates.example.com/team-b/a.tmpl":        false,
+		"https://templates.example.com/other/a.tmpl":         false,
+		"file:///templates.example.com/team/a.tmpl":          false,
+	} {
+		if got := remoteAllowed(rawURL, []string{"https://templates.example.com/team"}); got != want {
+			t.Errorf("remoteAllowed(%s) = %v, want %v", rawURL, got, want)
+		}
+	}
+	if name := templateName("https://example.com/dir/page.html?raw=1"); name != "page.html" {
+		t.Fatalf("unexpected template name %q", name)
+	}
+}
+
+func TestFetchRemoteFollowsRedirectsOnlyWithinTheAllowlist(t *testing.T) {
+	outside, requests, _ := newTemplateServer(t, map[string]string{"/a.tmpl": "outside"})
+	allowed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/moved.tmpl" {
+			http.Redirect(w, r, "/a.tmpl", http.StatusFound)
+			return
+		}
+		http.Redirect(w, r, outside.URL+"/a.tmpl", http.StatusFound)
+	}))
+	t.Cleanup(allowed.Close)
+	opts := renderOptions{RemoteAllow: []string{allowed.URL + "/"}, RemoteCacheDir: t.TempDir()}
+
+	_, err := fetchRemote(allowed.URL+"/a.tmpl", opts)
+	if err == nil || !strings.Contains(err.Error(), "not in the allowlist") {
+		t.Fatalf("expected the redirect to be refused, got %v", err)
+	}
+	if atomic.LoadInt32(requests) != 0 {
+		t.Fatal("expected no request to the host outside the allowlist")
+	}
+
+	// A redirect within the allowlist is followed, and the hop after it is
+	// checked in turn.
+	if _, err := fetchRemote(allowed.URL+"/moved.tmpl", opts); err == nil || !strings.Contains(err.Error(), "not in the allowlist") {
+		t.Fatalf("expected the second hop to be checked too, got %v", err)
+	}
+}
+
+func TestRunWarnsWhenUsingAStaleRemoteCopy(t *testing.T) {
+	server, _, _ := newTemplateServer(t, map[string]string{"/page.tmpl": "cached {{ .name }}"})
+	opts := renderOptions{RemoteAllow: []string{server.URL + "/"}, RemoteCacheDir: t.TempDir()}
+	if resp := run(server.URL+"/page.tmpl", "", opts); resp.Error != "" || len(resp.Diagnostics) != 0 {
+		t.Fatalf("unexpected first response: %+v", resp)
+	}
+
+	server.Close()
+	resp := run(server.URL+"/page.tmpl", "", opts)
+	if resp.Error != "" || resp.Rendered != "cached <no value>" {
+		t.Fatalf("expected the cached copy to render, got %+v", resp)
+	}
+	if len(resp.Diagnostics) != 1 || resp.Diagnostics[0].Severity != "warning" || resp.Diagnostics[0].Rule != "stale-remote" ||
+		!strings.Contains(resp.Diagnostics[0].Message, "using the copy cached at") {
+		t.Fatalf("expected a stale copy warning, got %+v", resp.Diagnostics)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// templateSuffixes mark files rendered by render-dir; the suffix is dropped
+// from the output name, so config.yaml.tmpl becomes config.yaml.
+var templateSuffixes = []string{".tmpl", ".gotmpl", ".tpl"}
+
+// renderedFile is one file render-dir rendered or copied, or would have
+// under --dry-run. Paths are relative to the input and output directories.
+type renderedFile struct {
+	Source string `json:"source"`
+	Output string `json:"output"`
+	// Action is render for templates and copy for every other file;
+	// gen-go reports the files it generates.
+	Action string `json:"action"`
+	Bytes  int    `json:"bytes"`
+	Error  string `json:"error,omitempty"`
+}
+
+// executeRenderDir renders every template under opts.RenderDir against the
+// context and writes the results beneath opts.OutputDir at the same
+// relative paths. Other files are copied unchanged. With DryRun nothing is
+// written and the response only lists what would be.
+func executeRenderDir(contextPath string, opts renderOptions) response {
+	inputDir := strings.TrimSpace(opts.RenderDir)
+	outputDir := strings.TrimSpace(opts.OutputDir)
+	if inputDir == "" {
+		return response{Error: "render-dir requires an input directory"}
+	}
+	if outputDir == "" && !opts.DryRun {
+		return response{Error: "render-dir requires --output-dir unless --dry-run is set"}
+	}
+	if info, err := os.Stat(inputDir); err != nil {
+		return response{Error: err.Error()}
+	} else if !info.IsDir() {
+		return response{Error: fmt.Sprintf("%s is not a directory", inputDir)}
+	}
+	if outputDir != "" && isWithinDir(outputDir, inputDir) {
+		return response{Error: fmt.Sprintf("output directory %s must not be inside the input directory %s", outputDir, inputDir)}
+	}
+
+	sources, err := collectDirFiles(inputDir)
+	if err != nil {
+		return response{Error: err.Error()}
+	}
+
+	// Files render --parallelism at a time; the response lists them, and
+	// their diagnostics, in path order all the same.
+	files := make([]renderedFile, len(sources))
+	found := make([][]diagnostic, len(sources))
+	var wg sync.WaitGroup
+	next := make(chan int)
+	for worker := 0; worker < min(renderParallelism(opts.Parallelism), len(sources)); worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				files[i], found[i] = renderDirFile(inputDir, outputDir, sources[i], contextPath, opts)
+			}
+		}()
+	}
+	for i := range sources {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	var (
+		diagnostics []diagnostic
+		failed      int
+	)
+	for i, file := range files {
+		diagnostics = append(diagnostics, found[i]...)
+		if file.Error != "" {
+			failed++
+		}
+	}
+
+	resp := response{Files: files, Diagnostics: diagnostics}
+	if failed > 0 {
+		resp.Error = fmt.Sprintf("%d of %d files failed", failed, len(files))
+	}
+	return resp
+}
+
+// renderDirFile renders or copies one file of render-dir.
+func renderDirFile(inputDir, outputDir, source, contextPath string, opts renderOptions) (renderedFile, []diagnostic) {
+	file := renderedFile{Source: source, Output: source, Action: "copy"}
+	sourcePath := filepath.Join(inputDir, filepath.FromSlash(source))
+
+	var (
+		output      []byte
+		diagnostics []diagnostic
+		err         error
+	)
+	if name, ok := trimTemplateSuffix(source); ok {
+		file.Output, file.Action = name, "render"
+		resp := executeWithOptions(sourcePath, contextPath, opts)
+		diagnostics = resp.Diagnostics
+		file.Error = resp.Error
+		output = []byte(resp.Rendered)
+	} else if output, err = os.ReadFile(sourcePath); err != nil {
+		file.Error = err.Error()
+	}
+	file.Bytes = len(output)
+
+	if file.Error == "" && !opts.DryRun {
+		if err := writeOutputFile(filepath.Join(outputDir, filepath.FromSlash(file.Output)), output, sourcePath); err != nil {
+			file.Error = err.Error()
+		}
+	}
+	return file, diagnostics
+}
+
+// collectDirFiles lists the regular files under dir as sorted slash paths,
+// skipping hidden files and directories such as .git.
+func collectDirFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != dir && strings.HasPrefix(entry.Name(), ".") {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
+
+func trimTemplateSuffix(name string) (string, bool) {
+	for _, suffix := range templateSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return strings.TrimSuffix(name, suffix), true
+		}
+	}
+	return "", false
+}
+
+// isWithinDir reports whether path is dir or lies beneath it.
+func isWithinDir(path, dir string) bool {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(absDir, absPath)
+	return err == nil && (rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))))
+}
+
+// writeOutputFile writes content with the permissions of the source file,
+// creating parent directories as needed.
+func writeOutputFile(path string, content []byte, sourcePath string) error {
+	mode := fs.FileMode(0o644)
+	if info, err := os.Stat(sourcePath); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, mode)
+}
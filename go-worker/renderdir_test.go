@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRenderDirWritesTreeAndCopiesOtherFiles(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "scaffold")
+	output := filepath.Join(dir, "out")
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, contextPath, `{"name":"api"}`)
+	for _, name := range []string{"cmd", "config", ".git"} {
+		if err := os.MkdirAll(filepath.Join(input, name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(t, filepath.Join(input, "README.md.tmpl"), "# {{ .name }}")
+	writeFile(t, filepath.Join(input, "cmd", "main.go.gotmpl"), "package {{ .name }}")
+	writeFile(t, filepath.Join(input, "config", "logo.svg"), "<svg/>")
+	writeFile(t, filepath.Join(input, ".git", "HEAD"), "ref")
+
+	dryRun := run("", contextPath, renderOptions{Mode: "render-dir", RenderDir: input, DryRun: true})
+	want := []renderedFile{
+		{Source: "README.md.tmpl", Output: "README.md", Action: "render", Bytes: 5},
+		{Source: "cmd/main.go.gotmpl", Output: "cmd/main.go", Action: "render", Bytes: 11},
+		{Source: "config/logo.svg", Output: "config/logo.svg", Action: "copy", Bytes: 6},
+	}
+	if dryRun.Error != "" || !reflect.DeepEqual(dryRun.Files, want) {
+		t.Fatalf("unexpected dry run: %+v", dryRun)
+	}
+	if _, err := os.Stat(output); !os.IsNotExist(err) {
+		t.Fatalf("dry run wrote output: %v", err)
+	}
+
+	resp := run("", contextPath, renderOptions{Mode: "render-dir", RenderDir: input, OutputDir: output})
+	if resp.Error != "" || !reflect.DeepEqual(resp.Files, want) {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	for name, content := range map[string]string{"README.md": "# api", "cmd/main.go": "package api", "config/logo.svg": "<svg/>"} {
+		got, err := os.ReadFile(filepath.Join(output, filepath.FromSlash(name)))
+		if err != nil || string(got) != content {
+			t.Fatalf("%s: got %q, %v", name, got, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(output, ".git")); !os.IsNotExist(err) {
+		t.Fatalf("expected hidden directories to be skipped: %v", err)
+	}
+}
+
+func TestRenderDirReportsFailuresPerFile(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "in")
+	writeFile(t, filepath.Join(input, "good.txt.tmpl"), "ok")
+	writeFile(t, filepath.Join(input, "bad.txt.tmpl"), "{{ .a.b.c }}")
+	writeFile(t, filepath.Join(dir, "context.json"), `{"a":1}`)
+
+	resp := run("", filepath.Join(dir, "context.json"), renderOptions{Mode: "render-dir", RenderDir: input, OutputDir: filepath.Join(dir, "out")})
+	if resp.Error != "1 of 2 files failed" || len(resp.Files) != 2 || resp.Files[0].Error == "" || resp.Files[1].Error != "" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	if len(resp.Diagnostics) != 1 || resp.Diagnostics[0].File != filepath.Join(input, "bad.txt.tmpl") {
+		t.Fatalf("expected a diagnostic for the failing template, got %+v", resp.Diagnostics)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "out", "bad.txt")); !os.IsNotExist(err) {
+		t.Fatalf("expected failed output to be skipped: %v", err)
+	}
+
+	nested := run("", "", renderOptions{Mode: "render-dir", RenderDir: input, OutputDir: filepath.Join(input, "out")})
+	if nested.Error == "" {
+		t.Fatal("expected an output directory inside the input to be rejected")
+	}
+}
+
+func TestRenderDirInParallelKeepsOrderAndSeededValues(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "charts")
+	for i := 0; i < 20; i++ {
+		writeFile(t, filepath.Join(input, fmt.Sprintf("chart%02d.yaml.tmpl", i)), fmt.Sprintf("chart: %d\nid: {{ randAlphaNum 8 }}\n", i))
+	}
+
+	render := func(parallelism int) response {
+		t.Helper()
+		resp := run("", "", renderOptions{Mode: "render-dir", RenderDir: input, DryRun: true, Seed: "7", Parallelism: parallelism})
+		if resp.Error != "" || len(resp.Files) != 20 {
+			t.Fatalf("unexpected response: %+v", resp)
+		}
+		return resp
+	}
+	serial, parallel := render(1), render(8)
+	if !reflect.DeepEqual(serial.Files, parallel.Files) {
+		t.Fatalf("expected the same files in the same order, got %+v and %+v", serial.Files, parallel.Files)
+	}
+	for i, file := range parallel.Files {
+		if file.Source != fmt.Sprintf("chart%02d.yaml.tmpl", i) {
+			t.Fatalf("file %d out of order: %+v", i, file)
+		}
+	}
+
+	// Every render starts from the seed, so each file draws the same values
+	// whichever order the files render in.
+	output := filepath.Join(dir, "out")
+	run("", "", renderOptions{Mode: "render-dir", RenderDir: input, OutputDir: output, Seed: "7", Parallelism: 8})
+	first, _ := os.ReadFile(filepath.Join(output, "chart00.yaml"))
+	last, _ := os.ReadFile(filepath.Join(output, "chart19.yaml"))
+	if firstID, lastID := strings.TrimPrefix(string(first), "chart: 0\n"), strings.TrimPrefix(string(last), "chart: 19\n"); firstID != lastID {
+		t.Fatalf("expected every file to start from the seed, got %q and %q", firstID, lastID)
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template/parse"
+)
+
+// maxSandboxFileBytes bounds what the file helper reads, so a template
+// pointed at a log or an image does not fill the preview.
+const maxSandboxFileBytes = 4 << 20
+
+// templateSandbox decides what the env and file helpers may read. Nothing
+// is allowed by default: environment variables must match an --allow-env
+// pattern and files must resolve, symbolic links followed, under an
+// --allow-file-root. A denied read yields the empty string and is recorded,
+// so the preview renders and reports it as a warning instead of failing
+// the way the template would in production.
+type templateSandbox struct {
+	envPatterns []string
+	fileRoots   []string
+	// base is the directory relative file paths are resolved against: the
+	// template's own.
+	base string
+
+	mu      sync.Mutex
+	denials []sandboxDenial
+}
+
+// sandboxDenial is one read the sandbox refused. Arg is the variable name
+// or the path as the template passed it.
+type sandboxDenial struct {
+	Func   string
+	Arg    string
+	Reason string
+}
+
+// deniedSandbox serves the env and file helpers outside of renders, and
+// wherever a render did not set up its own, refusing everything.
+var deniedSandbox = &templateSandbox{}
+
+// newTemplateSandbox allows what opts allows, for the template at
+// templatePath. Roots that do not exist allow nothing.
+func newTemplateSandbox(templatePath string, opts renderOptions) *templateSandbox {
+	sandbox := &templateSandbox{}
+	for _, pattern := range opts.AllowEnv {
+		for _, pattern := range strings.Split(pattern, ",") {
+			if pattern = strings.TrimSpace(pattern); pattern != "" {
+				sandbox.envPatterns = append(sandbox.envPatterns, pattern)
+			}
+		}
+	}
+	for _, root := range opts.AllowFileRoots {
+		if resolved, err := resolveExistingPath(root); err == nil {
+			sandbox.fileRoots = append(sandbox.fileRoots, resolved)
+		}
+	}
+	if templatePath != "" && !isRemoteURL(templatePath) && !isObjectStoreURL(templatePath) {
+		sandbox.base = filepath.Dir(templatePath)
+	}
+	return sandbox
+}
+
+// resolveExistingPath makes path absolute and follows its symbolic links.
+func resolveExistingPath(name string) (string, error) {
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(abs)
+}
+
+// env is the env helper: the value of an allowed environment variable, or
+// the empty string.
+func (s *templateSandbox) env(name string) string {
+	for _, pattern := range s.envPatterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return os.Getenv(name)
+		}
+	}
+	reason := "no --allow-env pattern matches it"
+	if len(s.envPatterns) == 0 {
+		reason = "environment access is off; pass --allow-env"
+	}
+	s.deny("env", name, reason)
+	return ""
+}
+
+// file is the file helper: the content of a file under an allowed root.
+// A file the sandbox allows but cannot read fails the render, as it
+// would in production.
+func (s *templateSandbox) file(name string) (string, error) {
+	if len(s.fileRoots) == 0 {
+		s.deny("file", name, "file access is off; pass --allow-file-root")
+		return "", nil
+	}
+	target := name
+	if !filepath.IsAbs(target) && s.base != "" {
+		target = filepath.Join(s.base, target)
+	}
+	resolved, err := resolveExistingPath(target)
+	if err != nil {
+		if os.IsNotExist(err) && !s.allows(filepath.Clean(target)) {
+			s.deny("file", name, "it is outside every --allow-file-root")
+			return "", nil
+		}
+		return "", fmt.Errorf("file %q: %v", name, err)
+	}
+	if !s.allows(resolved) {
+		s.deny("file", name, "it is outside every --allow-file-root")
+		return "", nil
+	}
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return "", fmt.Errorf("file %q: %v", name, err)
+	}
+	if info.Size() > maxSandboxFileBytes {
+		return "", fmt.Errorf("file %q is %d bytes, more than the %d the file helper reads", name, info.Size(), maxSandboxFileBytes)
+	}
+	content, err := os.ReadFile(resolved)
+	if err != nil {
+		return "", fmt.Errorf("file %q: %v", name, err)
+	}
+	return string(content), nil
+}
+
+// allows reports whether resolved is one of the roots or inside one.
+func (s *templateSandbox) allows(resolved string) bool {
+	if abs, err := filepath.Abs(resolved); err == nil {
+		resolved = abs
+	}
+	for _, root := range s.fileRoots {
+		if rel, err := filepath.Rel(root, resolved); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// deny records a refused read once, however often the template repeats it.
+func (s *templateSandbox) deny(fn, arg, reason string) {
+	if s == deniedSandbox {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, denial := range s.denials {
+		if denial.Func == fn && denial.Arg == arg {
+			return
+		}
+	}
+	s.denials = append(s.denials, sandboxDenial{Func: fn, Arg: arg, Reason: reason})
+}
+
+// diagnostics reports the denials as warnings, at the call whose literal
+// argument matches, or else at the first call of the helper.
+func (s *templateSandbox) diagnostics(templatePath, content string, opts renderOptions) []diagnostic {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	denials := append([]sandboxDenial(nil), s.denials...)
+	s.mu.Unlock()
+	if len(denials) == 0 {
+		return nil
+	}
+
+	calls := map[string]parse.Pos{}
+	if trees, err := parseTreesWithDelims(templateName(templatePath), content, opts.LeftDelim, opts.RightDelim); err == nil {
+		for _, name := range sortedTreeNames(trees, templateName(templatePath)) {
+			if trees[name].ParseName != templateName(templatePath) {
+				continue
+			}
+			walkNodes(trees[name].Root, func(node parse.Node) bool {
+				command, ok := node.(*parse.CommandNode)
+				if !ok || len(command.Args) == 0 {
+					return true
+				}
+				ident, ok := command.Args[0].(*parse.IdentifierNode)
+				if !ok || (ident.Ident != "env" && ident.Ident != "file") {
+					return true
+				}
+				key := ident.Ident
+				if len(command.Args) > 1 {
+					if literal, ok := command.Args[1].(*parse.StringNode); ok {
+						key += "\x00" + literal.Text
+					}
+				}
+				for _, key := range []string{key, ident.Ident} {
+					if _, seen := calls[key]; !seen {
+						calls[key] = ident.Pos
+					}
+				}
+				return true
+			})
+		}
+	}
+
+	diagnostics := make([]diagnostic, 0, len(denials))
+	for _, denial := range denials {
+		diag := diagnostic{
+			Message:  fmt.Sprintf("%s %q was denied: %s", denial.Func, denial.Arg, denial.Reason),
+			Severity: "warning",
+			Rule:     "sandbox",
+			File:     templatePath,
+		}
+		pos, ok := calls[denial.Func+"\x00"+denial.Arg]
+		if !ok {
+			pos, ok = calls[denial.Func]
+		}
+		if ok {
+			diag.Line, diag.Column = lineColumn(content, pos)
+			diag.EndColumn = diag.Column + len(denial.Func)
+		}
+		diagnostics = append(diagnostics, diag)
+	}
+	sort.SliceStable(diagnostics, func(i, j int) bool { return diagnostics[i].Line < diagnostics[j].Line })
+	return diagnostics
+}
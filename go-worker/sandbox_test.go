@@ -0,0 +1,87 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEnvHelperReadsOnlyAllowedVariables(t *testing.T) {
+	t.Setenv("APP_REGION", "eu-west-1")
+	t.Setenv("APP_SECRET_KEY", "hunter2")
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "config.tmpl")
+	writeFile(t, templatePath, `region={{ env "APP_REGION" }}
+secret={{ env "APP_SECRET_KEY" }}
+home={{ env "HOME" }}{{ env "HOME" }}`)
+
+	resp := run(templatePath, "", renderOptions{AllowEnv: []string{"APP_REGION,APP_R*"}})
+	if resp.Error != "" || resp.Rendered != "region=eu-west-1\nsecret=\nhome=" {
+		t.Fatalf("expected only APP_REGION to be read, got %+v", resp)
+	}
+	var denied []string
+	for _, diag := range resp.Diagnostics {
+		if diag.Rule == "sandbox" {
+			denied = append(denied, diag.Message)
+			if diag.Severity != "warning" || diag.Line < 2 || diag.Column == 0 {
+				t.Fatalf("expected a located warning, got %+v", diag)
+			}
+		}
+	}
+	if len(denied) != 2 || !strings.Contains(denied[0], `env "APP_SECRET_KEY" was denied`) || !strings.Contains(denied[1], `env "HOME"`) {
+		t.Fatalf("expected each denied variable reported once, got %q", denied)
+	}
+
+	// Without --allow-env nothing is read.
+	resp = run(templatePath, "", renderOptions{})
+	if resp.Rendered != "region=\nsecret=\nhome=" || !strings.Contains(resp.Diagnostics[0].Message, "environment access is off") {
+		t.Fatalf("expected every variable to be denied, got %+v", resp)
+	}
+}
+
+func TestFileHelperStaysUnderAllowedRoots(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "config")
+	writeFile(t, filepath.Join(root, "motd.txt"), "welcome")
+	writeFile(t, filepath.Join(dir, "secret.txt"), "hunter2")
+	if err := os.Symlink(filepath.Join(dir, "secret.txt"), filepath.Join(root, "escape.txt")); err != nil {
+		t.Skip("symbolic links are unavailable:", err)
+	}
+	templatePath := filepath.Join(dir, "page.tmpl")
+	writeFile(t, templatePath, `{{ file "config/motd.txt" }}|{{ file "secret.txt" }}|{{ file "config/escape.txt" }}|{{ file "config/../secret.txt" }}`)
+
+	resp := run(templatePath, "", renderOptions{AllowFileRoots: []string{root}})
+	if resp.Error != "" || resp.Rendered != "welcome|||" {
+		t.Fatalf("expected only the file under the root to be read, got %+v", resp)
+	}
+	denials := 0
+	for _, diag := range resp.Diagnostics {
+		if diag.Rule == "sandbox" {
+			denials++
+		}
+	}
+	if denials != 3 {
+		t.Fatalf("expected three denials, got %+v", resp.Diagnostics)
+	}
+
+	missing := filepath.Join(dir, "missing.tmpl")
+	writeFile(t, missing, `{{ file "config/nope.txt" }}`)
+	if resp := run(missing, "", renderOptions{AllowFileRoots: []string{root}}); !strings.Contains(resp.Error, `file "config/nope.txt"`) {
+		t.Fatalf("expected a missing allowed file to fail the render, got %+v", resp)
+	}
+}
+
+func TestSandboxHelpersAreKnownToCheckAndServer(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "t.tmpl")
+	writeFile(t, templatePath, `{{ env "X" }}{{ file "y" }}`)
+	if resp := run(templatePath, "", renderOptions{Mode: "check"}); resp.Error != "" || len(resp.Diagnostics) != 0 {
+		t.Fatalf("expected env and file to be defined, got %+v", resp)
+	}
+	// The server renders through its cache, which must not skip the sandbox.
+	resp := run(templatePath, "", renderOptions{cache: newTemplateCache(), AllowEnv: []string{"X"}})
+	if len(resp.Diagnostics) != 1 || !strings.Contains(resp.Diagnostics[0].Message, `file "y"`) {
+		t.Fatalf("expected the file denial from a server render, got %+v", resp)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// selftestFiles is the suite selftest mode runs: suite.json and the
+// templates, contexts, and expected output its cases name.
+//
+//go:embed all:selftest
+var selftestFiles embed.FS
+
+// selftestSuite is selftest/suite.json.
+type selftestSuite struct {
+	Cases []selftestCase `json:"cases"`
+}
+
+// selftestCase is one case of the suite. A render must write what Expected
+// holds; any other mode's response, as JSON, must contain every string of
+// Contains. ExpectError is an error the case must fail with instead.
+type selftestCase struct {
+	Name        string          `json:"name"`
+	Mode        string          `json:"mode,omitempty"`
+	Template    string          `json:"template"`
+	Context     string          `json:"context,omitempty"`
+	Options     json.RawMessage `json:"options,omitempty"`
+	Expected    string          `json:"expected,omitempty"`
+	Contains    []string        `json:"contains,omitempty"`
+	ExpectError string          `json:"expectError,omitempty"`
+}
+
+// selftestReport is the outcome of selftest mode, with what the worker was
+// built as so a bug report can quote it.
+type selftestReport struct {
+	Version   string           `json:"version"`
+	Platform  string           `json:"platform"`
+	GoVersion string           `json:"goVersion"`
+	Cases     int              `json:"cases"`
+	Passed    int              `json:"passed"`
+	Failed    int              `json:"failed"`
+	Results   []selftestResult `json:"results"`
+}
+
+type selftestResult struct {
+	Name   string `json:"name"`
+	Mode   string `json:"mode"`
+	Passed bool   `json:"passed"`
+	Error  string `json:"error,omitempty"`
+	Diff   string `json:"diff,omitempty"`
+}
+
+// executeSelftest runs the embedded suite through the same code paths as
+// the editor's requests: the text and HTML engines, the Sprig library,
+// includes, delimiters, datasets, limits, and the analysis modes. The
+// files are written to a temporary directory first, since every mode
+// reads templates from disk. The response fails when a case does.
+func executeSelftest() response {
+	dir, err := os.MkdirTemp("", "go-worker-selftest-")
+	if err != nil {
+		return response{Error: "selftest: " + err.Error()}
+	}
+	defer os.RemoveAll(dir)
+	if err := extractSelftest(dir); err != nil {
+		return response{Error: "selftest: " + err.Error()}
+	}
+	suiteBytes, err := os.ReadFile(filepath.Join(dir, "suite.json"))
+	if err != nil {
+		return response{Error: "selftest: " + err.Error()}
+	}
+	var suite selftestSuite
+	if err := json.Unmarshal(suiteBytes, &suite); err != nil {
+		return response{Error: "selftest: suite.json: " + err.Error()}
+	}
+
+	report := &selftestReport{
+		Version:   workerVersion,
+		Platform:  workerPlatform(),
+		GoVersion: runtime.Version(),
+		Cases:     len(suite.Cases),
+		Results:   make([]selftestResult, 0, len(suite.Cases)),
+	}
+	for _, c := range suite.Cases {
+		result := runSelftestCase(dir, c)
+		if result.Passed {
+			report.Passed++
+		} else {
+			report.Failed++
+		}
+		report.Results = append(report.Results, result)
+	}
+	resp := response{Selftest: report}
+	if report.Failed > 0 {
+		resp.Error = fmt.Sprintf("selftest: %d of %d cases failed", report.Failed, report.Cases)
+	}
+	return resp
+}
+
+// extractSelftest writes the embedded suite under dir.
+func extractSelftest(dir string) error {
+	root, err := fs.Sub(selftestFiles, "selftest")
+	if err != nil {
+		return err
+	}
+	return fs.WalkDir(root, ".", func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dir, filepath.FromSlash(path))
+		if entry.IsDir() {
+			return os.MkdirAll(target, 0o755)
+		}
+		content, err := fs.ReadFile(root, path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(target, content, 0o644)
+	})
+}
+
+func runSelftestCase(dir string, c selftestCase) selftestResult {
+	result := selftestResult{Name: c.Name, Mode: c.Mode}
+	if result.Mode == "" {
+		result.Mode = "render"
+	}
+	resolve := func(path string) string {
+		if path == "" {
+			return ""
+		}
+		return filepath.Join(dir, filepath.FromSlash(path))
+	}
+
+	var opts renderOptions
+	if len(c.Options) > 0 {
+		if err := json.Unmarshal(c.Options, &opts); err != nil {
+			result.Error = "options: " + err.Error()
+			return result
+		}
+	}
+	opts.Mode = result.Mode
+	for i := range opts.Includes {
+		opts.Includes[i] = resolve(opts.Includes[i])
+	}
+
+	resp := run(resolve(c.Template), resolve(c.Context), opts)
+	switch {
+	case c.ExpectError != "":
+		if !strings.Contains(resp.Error, c.ExpectError) {
+			result.Error = fmt.Sprintf("expected an error containing %q, got %q", c.ExpectError, resp.Error)
+			return result
+		}
+	case resp.Error != "":
+		result.Error = resp.Error
+		return result
+	case c.Expected != "":
+		expected, err := os.ReadFile(resolve(c.Expected))
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		if result.Diff = unifiedDiff(c.Expected, c.Template, string(expected), resp.Rendered); result.Diff != "" {
+			result.Error = fmt.Sprintf("output differs from %s", c.Expected)
+			return result
+		}
+	default:
+		encoded, err := json.Marshal(resp)
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		for _, want := range c.Contains {
+			if !strings.Contains(string(encoded), want) {
+				result.Error = fmt.Sprintf("expected the response to contain %s", want)
+				return result
+			}
+		}
+	}
+	result.Passed = true
+	return result
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSelftestSuitePasses(t *testing.T) {
+	resp := run("", "", renderOptions{Mode: "selftest"})
+	if resp.Selftest == nil {
+		t.Fatalf("expected a selftest report, got %+v", resp)
+	}
+	for _, result := range resp.Selftest.Results {
+		if !result.Passed {
+			t.Errorf("%s (%s): %s\n%s", result.Name, result.Mode, result.Error, result.Diff)
+		}
+	}
+	if resp.Error != "" || resp.Selftest.Passed != resp.Selftest.Cases || resp.Selftest.Cases == 0 {
+		t.Fatalf("expected every case to pass, got %+v", resp.Selftest)
+	}
+}
+
+func TestSelftestCaseFailures(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "greet.tmpl"), "Hello {{ .name }}")
+	writeFile(t, filepath.Join(dir, "context.json"), `{"name": "Ada"}`)
+	writeFile(t, filepath.Join(dir, "greet.txt"), "Hello Bob")
+
+	cases := []struct {
+		c    selftestCase
+		want string
+	}{
+		{selftestCase{Name: "diff", Template: "greet.tmpl", Context: "context.json", Expected: "greet.txt"}, "output differs"},
+		{selftestCase{Name: "no error", Template: "greet.tmpl", Context: "context.json", ExpectError: "boom"}, `expected an error containing "boom"`},
+		{selftestCase{Name: "contains", Mode: "ast", Template: "greet.tmpl", Contains: []string{`"kind":"range"`}}, "to contain"},
+		{selftestCase{Name: "options", Template: "greet.tmpl", Options: json.RawMessage(`{"includes": 1}`)}, "options:"},
+	}
+	for _, tc := range cases {
+		result := runSelftestCase(dir, tc.c)
+		if result.Passed || !strings.Contains(result.Error, tc.want) {
+			t.Errorf("%s: expected a failure containing %q, got %+v", tc.c.Name, tc.want, result)
+		}
+	}
+}
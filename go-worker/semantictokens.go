@@ -0,0 +1,277 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"text/template/parse"
+)
+
+// semanticTokenTypes and semanticTokenModifiers are the legend of
+// semantic-tokens mode, in the order the encoded tokens index them.
+// delimiter is not one of the LSP's predefined types, so clients register
+// it, typically as a subtype of operator.
+var (
+	semanticTokenTypes     = []string{"keyword", "function", "variable", "property", "string", "number", "comment", "operator", "delimiter"}
+	semanticTokenModifiers = []string{"declaration", "defaultLibrary"}
+)
+
+const (
+	tokenKeyword = iota
+	tokenFunction
+	tokenVariable
+	tokenProperty
+	tokenString
+	tokenNumber
+	tokenComment
+	tokenOperator
+	tokenDelimiter
+)
+
+const (
+	modifierDeclaration = 1 << iota
+	modifierDefaultLibrary
+)
+
+// semanticTokens are the tokens of a template in the LSP's encoding: five
+// integers per token, holding the line and start relative to the previous
+// token, the length, the index of the type in Legend.TokenTypes, and a
+// bit set of Legend.TokenModifiers. Lines count from 0, and starts and
+// lengths count code units of the negotiated position encoding.
+type semanticTokens struct {
+	Legend semanticTokensLegend `json:"legend"`
+	Data   []int                `json:"data"`
+}
+
+type semanticTokensLegend struct {
+	TokenTypes     []string `json:"tokenTypes"`
+	TokenModifiers []string `json:"tokenModifiers"`
+}
+
+// semanticToken is one token at a byte range of the template.
+type semanticToken struct {
+	start, end int
+	kind       int
+	modifiers  int
+}
+
+// executeSemanticTokens classifies the contents of every action: keywords,
+// functions, variables, fields, literals, comments, operators, and the
+// delimiters themselves, which are found with the template's own
+// delimiters. The parse tree marks the variables an action declares; a
+// template that does not parse, as one being typed often does not, still
+// gets its tokens, without those marks.
+func executeSemanticTokens(templatePath string, opts renderOptions) response {
+	if templatePath == "" {
+		return response{Error: "template path is required"}
+	}
+	content, err := readTemplate(templatePath, opts)
+	if err != nil {
+		return response{Error: err.Error()}
+	}
+
+	declared := map[int]bool{}
+	if trees, err := parseTreesWithDelims(templateName(templatePath), content, opts.LeftDelim, opts.RightDelim); err == nil {
+		for _, tree := range trees {
+			walkNodes(tree.Root, func(node parse.Node) bool {
+				var pipe *parse.PipeNode
+				switch typed := node.(type) {
+				case *parse.ActionNode:
+					pipe = typed.Pipe
+				case *parse.IfNode:
+					pipe = typed.Pipe
+				case *parse.RangeNode:
+					pipe = typed.Pipe
+				case *parse.WithNode:
+					pipe = typed.Pipe
+				}
+				if pipe != nil && !pipe.IsAssign {
+					for _, variable := range pipe.Decl {
+						declared[int(variable.Position())] = true
+					}
+				}
+				return true
+			})
+		}
+	}
+
+	leftDelim, rightDelim := opts.LeftDelim, opts.RightDelim
+	if leftDelim == "" {
+		leftDelim = defaultLeftDelim
+	}
+	if rightDelim == "" {
+		rightDelim = defaultRightDelim
+	}
+	var tokens []semanticToken
+	for _, action := range scanActions(content, opts.LeftDelim, opts.RightDelim) {
+		open := len(leftDelim)
+		if action.TrimLeft {
+			open++
+		}
+		closing := len(rightDelim)
+		if action.TrimRight {
+			closing++
+		}
+		innerStart := action.Start + len(leftDelim)
+		if action.TrimLeft {
+			innerStart += 2
+		}
+		tokens = append(tokens, semanticToken{start: action.Start, end: action.Start + open, kind: tokenDelimiter})
+		tokens = append(tokens, lexActionTokens(action.Inner, innerStart, declared)...)
+		tokens = append(tokens, semanticToken{start: action.End - closing, end: action.End, kind: tokenDelimiter})
+	}
+	return response{SemanticTokens: encodeSemanticTokens(content, tokens, opts.PositionEncoding)}
+}
+
+// lexActionTokens splits the inside of an action, which starts at offset
+// in the template, into tokens. Whitespace and the dots between fields are
+// left out.
+func lexActionTokens(inner string, offset int, declared map[int]bool) []semanticToken {
+	var tokens []semanticToken
+	add := func(start, end, kind, modifiers int) {
+		tokens = append(tokens, semanticToken{start: offset + start, end: offset + end, kind: kind, modifiers: modifiers})
+	}
+	for i := 0; i < len(inner); {
+		c := inner[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case strings.HasPrefix(inner[i:], "/*"):
+			end := strings.Index(inner[i+2:], "*/")
+			if end < 0 {
+				end = len(inner)
+			} else {
+				end += i + 4
+			}
+			add(i, end, tokenComment, 0)
+			i = end
+		case c == '"' || c == '\'':
+			end := i + 1
+			for end < len(inner) && inner[end] != c {
+				if inner[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			end = min(end+1, len(inner))
+			if c == '"' {
+				add(i, end, tokenString, 0)
+			} else {
+				// Character constants are numbers to text/template.
+				add(i, end, tokenNumber, 0)
+			}
+			i = end
+		case c == '`':
+			end := strings.IndexByte(inner[i+1:], '`')
+			if end < 0 {
+				end = len(inner)
+			} else {
+				end += i + 2
+			}
+			add(i, end, tokenString, 0)
+			i = end
+		case c == '$':
+			end := identifierEnd(inner, i+1)
+			modifiers := 0
+			if declared[offset+i] {
+				modifiers = modifierDeclaration
+			}
+			add(i, end, tokenVariable, modifiers)
+			i = end
+		case c == '.':
+			end := identifierEnd(inner, i+1)
+			if end == i+1 {
+				// Dot itself.
+				add(i, end, tokenVariable, 0)
+			} else {
+				add(i+1, end, tokenProperty, 0)
+			}
+			i = end
+		case isDigit(c) || (c == '-' || c == '+') && i+1 < len(inner) && isDigit(inner[i+1]):
+			end := i + 1
+			for end < len(inner) && (isIdentifierByte(inner[end]) || inner[end] == '.' ||
+				(inner[end] == '-' || inner[end] == '+') && (inner[end-1] == 'e' || inner[end-1] == 'E' || inner[end-1] == 'p' || inner[end-1] == 'P')) {
+				end++
+			}
+			add(i, end, tokenNumber, 0)
+			i = end
+		case isIdentifierByte(c):
+			end := identifierEnd(inner, i)
+			word := inner[i:end]
+			switch {
+			case containsString(templateKeywords, word) || word == "nil" || word == "true" || word == "false":
+				add(i, end, tokenKeyword, 0)
+			case builtinFuncNames[word]:
+				add(i, end, tokenFunction, modifierDefaultLibrary)
+			default:
+				add(i, end, tokenFunction, 0)
+			}
+			i = end
+		case strings.HasPrefix(inner[i:], ":="):
+			add(i, i+2, tokenOperator, 0)
+			i += 2
+		case strings.IndexByte("|=(),", c) >= 0:
+			add(i, i+1, tokenOperator, 0)
+			i++
+		default:
+			i++
+		}
+	}
+	return tokens
+}
+
+func identifierEnd(text string, from int) int {
+	end := from
+	for end < len(text) && isIdentifierByte(text[end]) {
+		end++
+	}
+	return end
+}
+
+// isIdentifierByte reports whether c can continue a name. Bytes of
+// multi-byte runes count, since Go names may hold letters of any script.
+func isIdentifierByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || isDigit(c) || c >= 0x80
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// encodeSemanticTokens sorts tokens and encodes them relative to each
+// other. A token that spans lines, such as a comment or a raw string, is
+// split at each line break, since clients need not support tokens that
+// span lines.
+func encodeSemanticTokens(content string, tokens []semanticToken, encoding string) *semanticTokens {
+	sort.SliceStable(tokens, func(i, j int) bool { return tokens[i].start < tokens[j].start })
+	starts := lineStarts(content)
+	encoded := &semanticTokens{
+		Legend: semanticTokensLegend{TokenTypes: semanticTokenTypes, TokenModifiers: semanticTokenModifiers},
+		Data:   []int{},
+	}
+	line := 0
+	previousLine, previousStart := 0, 0
+	for _, token := range tokens {
+		for line+1 < len(starts) && starts[line+1] <= token.start {
+			line++
+		}
+		for start := token.start; start < token.end; {
+			end := min(token.end, lineEnd(content, starts, line))
+			if end > start {
+				text := content[starts[line]:lineEnd(content, starts, line)]
+				column := encodeColumn(text, start-starts[line]+1, encoding) - 1
+				length := encodeColumn(text, end-starts[line]+1, encoding) - 1 - column
+				if line != previousLine {
+					previousStart = 0
+				}
+				encoded.Data = append(encoded.Data, line-previousLine, column-previousStart, length, token.kind, token.modifiers)
+				previousLine, previousStart = line, column
+			}
+			if line+1 >= len(starts) || starts[line+1] >= token.end {
+				break
+			}
+			line++
+			start = starts[line]
+		}
+	}
+	return encoded
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// decodeSemanticTokens lists tokens as "line:start+length type modifiers
+// text" with absolute 0-based positions.
+func decodeSemanticTokens(t *testing.T, content string, tokens *semanticTokens) []string {
+	t.Helper()
+	if tokens == nil || len(tokens.Data)%5 != 0 {
+		t.Fatalf("unexpected tokens: %+v", tokens)
+	}
+	var decoded []string
+	line, start := 0, 0
+	for i := 0; i < len(tokens.Data); i += 5 {
+		if tokens.Data[i] > 0 {
+			start = 0
+		}
+		line += tokens.Data[i]
+		start += tokens.Data[i+1]
+		length := tokens.Data[i+2]
+		entry := fmt.Sprintf("%d:%d %s", line, start, tokens.Legend.TokenTypes[tokens.Data[i+3]])
+		for bit, modifier := range tokens.Legend.TokenModifiers {
+			if tokens.Data[i+4]&(1<<bit) != 0 {
+				entry += " " + modifier
+			}
+		}
+		text := lineText(content, line+1)
+		if start+length <= len(text) {
+			entry += " " + text[start:start+length]
+		}
+		decoded = append(decoded, entry)
+	}
+	return decoded
+}
+
+func TestSemanticTokensClassifyActions(t *testing.T) {
+	templatePath := filepath.Join(t.TempDir(), "page.tmpl")
+	content := "Hi {{- $name := .User.Name | printf \"%s!\" -}}\n{{ range $i, $v := (index .Items 1).Tags }}{{ upper $v }}{{ end }}{{/* a\nb */}}{{ if eq .N -1.5 }}{{ . }}{{ end }}"
+	writeFile(t, templatePath, content)
+
+	resp := run(templatePath, "", renderOptions{Mode: "semantic-tokens"})
+	if resp.Error != "" {
+		t.Fatal(resp.Error)
+	}
+	want := []string{
+		"0:3 delimiter {{-",
+		"0:7 variable declaration $name",
+		"0:13 operator :=",
+		"0:17 property User",
+		"0:22 property Name",
+		"0:27 operator |",
+		"0:29 function defaultLibrary printf",
+		"0:36 string \"%s!\"",
+		"0:42 delimiter -}}",
+		"1:0 delimiter {{",
+		"1:3 keyword range",
+		"1:9 variable declaration $i",
+		"1:11 operator ,",
+		"1:13 variable declaration $v",
+		"1:16 operator :=",
+		"1:19 operator (",
+		"1:20 function defaultLibrary index",
+		"1:27 property Items",
+		"1:33 number 1",
+		"1:34 operator )",
+		"1:36 property Tags",
+		"1:41 delimiter }}",
+		"1:43 delimiter {{",
+		"1:46 function upper",
+		"1:52 variable $v",
+		"1:55 delimiter }}",
+		"1:57 delimiter {{",
+		"1:60 keyword end",
+		"1:64 delimiter }}",
+		"1:66 delimiter {{",
+		"1:68 comment /* a",
+		"2:0 comment b */",
+		"2:4 delimiter }}",
+		"2:6 delimiter {{",
+		"2:9 keyword if",
+		"2:12 function defaultLibrary eq",
+		"2:16 property N",
+		"2:18 number -1.5",
+		"2:23 delimiter }}",
+		"2:25 delimiter {{",
+		"2:28 variable .",
+		"2:30 delimiter }}",
+		"2:32 delimiter {{",
+		"2:35 keyword end",
+		"2:39 delimiter }}",
+	}
+	if got := decodeSemanticTokens(t, content, resp.SemanticTokens); !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected tokens:\n got %q\nwant %q", got, want)
+	}
+}
+
+func TestSemanticTokensUseDelimsAndEncoding(t *testing.T) {
+	templatePath := filepath.Join(t.TempDir(), "page.tmpl")
+	content := "😀 [[ .Name ]] [[ $x = \"é\" ]] [[ if"
+	writeFile(t, templatePath, content)
+
+	resp := run(templatePath, "", renderOptions{Mode: "semantic-tokens", LeftDelim: "[[", RightDelim: "]]", PositionEncoding: positionEncodingUTF16})
+	if resp.Error != "" {
+		t.Fatal(resp.Error)
+	}
+	// The template does not parse, so $x is not marked as declared, and
+	// the unfinished action has no tokens. Columns count UTF-16 units.
+	want := []int{
+		0, 3, 2, tokenDelimiter, 0,
+		0, 4, 4, tokenProperty, 0,
+		0, 5, 2, tokenDelimiter, 0,
+		0, 3, 2, tokenDelimiter, 0,
+		0, 3, 2, tokenVariable, 0,
+		0, 3, 1, tokenOperator, 0,
+		0, 2, 3, tokenString, 0,
+		0, 4, 2, tokenDelimiter, 0,
+	}
+	if !reflect.DeepEqual(resp.SemanticTokens.Data, want) {
+		t.Fatalf("unexpected data:\n got %v\nwant %v", resp.SemanticTokens.Data, want)
+	}
+}
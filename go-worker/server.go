@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const maxServerRequestBytes = 16 << 20
+
+// serverRequest is one newline-delimited JSON request in --serve mode. Any
+// renderOptions field not tagged json:"-" may be set per request; omitted
+// fields inherit the flags the server was started with.
+type serverRequest struct {
+	ID       json.RawMessage `json:"id,omitempty"`
+	Template string          `json:"template"`
+	Context  string          `json:"context,omitempty"`
+	// Cancel makes the request a cancel request for the in-flight request
+	// with this id. It gets no response of its own; the cancelled request
+	// answers promptly with cancelled: true.
+	Cancel json.RawMessage `json:"cancel,omitempty"`
+	renderOptions
+}
+
+// serverResponse echoes the request id alongside the usual response fields,
+// shaped by the request's response version (see MarshalJSON).
+type serverResponse struct {
+	ID json.RawMessage `json:"id,omitempty"`
+	response
+
+	version int
+}
+
+// traceMessage streams one step of a traced request ahead of its
+// response.
+type traceMessage struct {
+	ID         json.RawMessage `json:"id,omitempty"`
+	TraceEvent traceEvent      `json:"traceEvent"`
+}
+
+// serve keeps the worker resident, reading requests from r and writing one
+// response line per request to w. Requests run concurrently, up to
+// --parallelism at a time, so responses may arrive out of order; clients
+// match them up by id. Parsed templates
+// are cached across requests until their source changes. A request with
+// "trace": true streams its trace events as they happen, each on its own
+// line, before its response. A {"cancel": id} request aborts the request
+// with that id. With
+// --notify-url, a summary of each render is posted to the webhook. With
+// --state-dir, the render requests are saved there and replayed at the
+// next start to warm the cache; see serverstate.go.
+func serve(r io.Reader, w io.Writer, base renderOptions) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxServerRequestBytes)
+	base.cache = newTemplateCache()
+
+	var state *warmState
+	if base.StateDir != "" {
+		var err error
+		if state, err = loadWarmState(base.StateDir); err != nil {
+			fmt.Fprintf(os.Stderr, "state: %v; starting cold\n", err)
+		}
+		stop := make(chan struct{})
+		warmed := make(chan struct{})
+		go func() {
+			defer close(warmed)
+			warmCache(state.replayable(), base, stop, os.Stderr)
+		}()
+		defer func() {
+			close(stop)
+			<-warmed
+			if err := state.save(); err != nil {
+				fmt.Fprintf(os.Stderr, "state: %v\n", err)
+			}
+		}()
+	}
+
+	var hook *notifier
+	if base.NotifyURL != "" {
+		var err error
+		if hook, err = newNotifier(base.NotifyURL, os.Stderr); err != nil {
+			return err
+		}
+		defer hook.close()
+	}
+
+	var (
+		writeMu  sync.Mutex
+		inFlight sync.WaitGroup
+		cancels  = newCancelRegistry()
+		// slots bounds the requests rendering at once. Requests beyond it
+		// wait in their goroutines, so the loop keeps reading, and cancels
+		// reach waiting requests too.
+		slots = make(chan struct{}, renderParallelism(base.Parallelism))
+		// Only the first request is answered with the capabilities, so
+		// clients that never look for them pay for them once.
+		advertised bool
+	)
+	encoder := json.NewEncoder(w)
+	reply := func(resp serverResponse) {
+		// Encode outside the lock, so one large response does not hold up
+		// the others.
+		buf := responseBuffers.Get().(*responseBuffer)
+		defer buf.release()
+		line, err := buf.encode(&resp)
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		if err != nil {
+			_ = encoder.Encode(serverResponse{ID: resp.ID, response: response{Error: "encoding response: " + err.Error()}, version: resp.version})
+			return
+		}
+		_, _ = w.Write(line)
+	}
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		if state != nil {
+			// The scanner reuses its buffer for the next line.
+			line = append([]byte(nil), line...)
+		}
+
+		req := serverRequest{renderOptions: base}
+		// Decoding into a shared map would leak overrides between requests.
+		req.RenamedFuncs = cloneStringMap(base.RenamedFuncs)
+		if err := json.Unmarshal(line, &req); err != nil {
+			reply(serverResponse{response: response{Error: "invalid request: " + err.Error()}, version: base.ResponseVersion})
+			continue
+		}
+		if len(req.Cancel) > 0 {
+			cancels.cancel(req.Cancel)
+			continue
+		}
+		if err := validateResponseVersion(req.ResponseVersion); err != nil {
+			reply(serverResponse{ID: req.ID, response: response{Error: err.Error()}})
+			continue
+		}
+
+		if req.Trace {
+			id := req.ID
+			req.traceSink = func(event traceEvent) {
+				writeMu.Lock()
+				defer writeMu.Unlock()
+				_ = encoder.Encode(traceMessage{ID: id, TraceEvent: event})
+			}
+		}
+
+		advertise := !advertised
+		advertised = true
+
+		inFlight.Add(1)
+		ctx, done := cancels.register(req.ID)
+		req.ctx = ctx
+		go func(req serverRequest, line []byte) {
+			defer inFlight.Done()
+			defer done()
+			resp := serverResponse{ID: req.ID, version: req.ResponseVersion}
+			select {
+			case slots <- struct{}{}:
+				resp = handleServerRequest(req)
+				<-slots
+			case <-ctx.Done():
+			}
+			if ctx.Err() != nil {
+				resp.response = response{Cancelled: true, Error: "request cancelled", DurationMs: resp.DurationMs, errorCode: errorCodeCancelled}
+			}
+			if advertise {
+				resp.Capabilities = describeCapabilities(req.renderOptions)
+			}
+			reply(resp)
+			if state != nil && (req.Mode == "" || req.Mode == "render") && resp.Error == "" {
+				if err := state.record(req.Template, line); err != nil {
+					fmt.Fprintf(os.Stderr, "state: %v\n", err)
+				}
+			}
+			if hook != nil {
+				hook.notify(newRenderSummary(req.ID, req.Template, req.Context, req.renderOptions, resp.response))
+			}
+		}(req, line)
+	}
+
+	inFlight.Wait()
+	return scanner.Err()
+}
+
+func handleServerRequest(req serverRequest) serverResponse {
+	start := time.Now()
+	resp := run(req.Template, req.Context, req.renderOptions)
+	resp.DurationMs = time.Since(start).Milliseconds()
+	return serverResponse{ID: req.ID, response: resp, version: req.ResponseVersion}
+}
+
+func cloneStringMap(values map[string]string) map[string]string {
+	if values == nil {
+		return nil
+	}
+	clone := make(map[string]string, len(values))
+	for key, value := range values {
+		clone[key] = value
+	}
+	return clone
+}
+
+// cancelRegistry maps the ids of in-flight requests to the functions that
+// cancel them.
+type cancelRegistry struct {
+	mu      sync.Mutex
+	cancels map[string]*context.CancelFunc
+}
+
+func newCancelRegistry() *cancelRegistry {
+	return &cancelRegistry{cancels: map[string]*context.CancelFunc{}}
+}
+
+// register returns the context of a request and the function to call when
+// it is answered. Requests without an id cannot be cancelled, and a later
+// request reusing an id replaces the earlier one.
+func (r *cancelRegistry) register(id json.RawMessage) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	if len(id) == 0 {
+		return ctx, cancel
+	}
+	key, entry := string(bytes.TrimSpace(id)), &cancel
+	r.mu.Lock()
+	r.cancels[key] = entry
+	r.mu.Unlock()
+	return ctx, func() {
+		cancel()
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.cancels[key] == entry {
+			delete(r.cancels, key)
+		}
+	}
+}
+
+// cancel aborts the in-flight request with id. Ids of requests already
+// answered, or never seen, are ignored.
+func (r *cancelRegistry) cancel(id json.RawMessage) {
+	r.mu.Lock()
+	entry, ok := r.cancels[string(bytes.TrimSpace(id))]
+	r.mu.Unlock()
+	if ok {
+		(*entry)()
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServeAnswersEachRequestWithItsID(t *testing.T) {
+	dir := t.TempDir()
+
+	templatePath := filepath.Join(dir, "greet.tmpl")
+	if err := os.WriteFile(templatePath, []byte("Hello {{ .name }}"), 0o600); err != nil {
+		t.Fatalf("failed to write template file: %v", err)
+	}
+
+	contextPath := filepath.Join(dir, "context.json")
+	if err := os.WriteFile(contextPath, []byte(`{"name":"Gopher"}`), 0o600); err != nil {
+		t.Fatalf("failed to write context file: %v", err)
+	}
+
+	requests := strings.Join([]string{
+		`{"id":1,"template":` + quoteJSON(templatePath) + `,"context":` + quoteJSON(contextPath) + `}`,
+		``,
+		`{"id":"two","template":` + quoteJSON(templatePath) + `,"mode":"offset-to-position","offset":6}`,
+		`not json`,
+	}, "\n")
+
+	var output bytes.Buffer
+	if err := serve(strings.NewReader(requests), &output, renderOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	responses := map[string]serverResponse{}
+	for _, line := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+		var resp serverResponse
+		if err := json.Unmarshal([]byte(line), &resp); err != nil {
+			t.Fatalf("invalid response line %q: %v", line, err)
+		}
+		responses[string(resp.ID)] = resp
+	}
+
+	if len(responses) != 3 {
+		t.Fatalf("expected three responses, got %d: %s", len(responses), output.String())
+	}
+
+	if responses["1"].Rendered != "Hello Gopher" {
+		t.Fatalf("unexpected render response: %+v", responses["1"])
+	}
+
+	if position := responses[`"two"`].Position; position == nil || position.Column != 7 {
+		t.Fatalf("unexpected position response: %+v", responses[`"two"`])
+	}
+
+	if !strings.Contains(responses[""].Error, "invalid request") {
+		t.Fatalf("expected invalid request error, got %+v", responses[""])
+	}
+}
+
+func TestServeInheritsBaseOptions(t *testing.T) {
+	templatePath := filepath.Join(t.TempDir(), "page.tmpl")
+	if err := os.WriteFile(templatePath, []byte(`{{ newmap "a" 1 }}`), 0o600); err != nil {
+		t.Fatalf("failed to write template file: %v", err)
+	}
+
+	base := renderOptions{RenamedFuncs: map[string]string{"map": "newmap"}}
+	request := `{"id":1,"template":` + quoteJSON(templatePath) + `,"renamedFuncs":{"dict":"newdict"}}`
+
+	var output bytes.Buffer
+	if err := serve(strings.NewReader(request), &output, base); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var resp serverResponse
+	if err := json.Unmarshal(output.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if resp.Error != "" || resp.Rendered != "map[a:1]" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	if len(base.RenamedFuncs) != 1 {
+		t.Fatalf("expected request overrides not to leak into base options, got %v", base.RenamedFuncs)
+	}
+}
+
+func TestServeTakesTrustedOptionsOnlyFromTheCommandLine(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "page.tmpl")
+	writeFile(t, templatePath, "Hello")
+	outPath := filepath.Join(dir, "out.txt")
+
+	request := `{"id":1,"template":` + quoteJSON(templatePath) + `,"out":` + quoteJSON(outPath) +
+		`,"remoteAllow":["evil.example.com"],"remoteCacheDir":"/tmp","outputDir":"/tmp","xlsxFile":"x.xlsx","emlFile":"m.eml","sendTest":true,"smtp":"smtp://evil.example.com:25","to":["a@example.com"]` +
+		`,"lintBaseline":"baseline.json","updateBaseline":true}`
+	var req serverRequest
+	if err := json.Unmarshal([]byte(request), &req); err != nil {
+		t.Fatal(err)
+	}
+	if req.Out != "" || req.RemoteAllow != nil || req.RemoteCacheDir != "" || req.OutputDir != "" || req.XLSXFile != "" ||
+		req.EMLFile != "" || req.SendTest || req.SMTP != "" || req.SendTo != nil || req.LintBaseline != "" || req.UpdateBaseline {
+		t.Fatalf("expected a request not to set command-line options, got %+v", req.renderOptions)
+	}
+
+	var output bytes.Buffer
+	if err := serve(strings.NewReader(request), &output, renderOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var resp serverResponse
+	if err := json.Unmarshal(output.Bytes(), &resp); err != nil || resp.Rendered != "Hello" {
+		t.Fatalf("unexpected response %s: %v", output.Bytes(), err)
+	}
+	if _, err := os.Stat(outPath); !os.IsNotExist(err) {
+		t.Fatalf("expected the request not to write %s, got %v", outPath, err)
+	}
+}
+
+func quoteJSON(value string) string {
+	encoded, _ := json.Marshal(value)
+	return string(encoded)
+}
+
+func TestServeCancelsAnInFlightRender(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "slow.tmpl")
+	writeFile(t, templatePath, `{{ range .items }}{{ range $.items }}{{ range $.items }}{{ end }}{{ end }}{{ end }}done`)
+	items := make([]int, 5000)
+	itemsJSON, _ := json.Marshal(map[string]interface{}{"items": items})
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, contextPath, string(itemsJSON))
+
+	requests := `{"id": 7, "template": ` + quoteJSON(templatePath) + `, "context": ` + quoteJSON(contextPath) + `}` + "\n" +
+		`{"cancel": 7}` + "\n" +
+		`{"cancel": 99}` + "\n"
+	var output bytes.Buffer
+	start := time.Now()
+	if err := serve(strings.NewReader(requests), &output, renderOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("expected the cancelled render to stop promptly, took %s", elapsed)
+	}
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected one response, for the cancelled request, got %s", output.String())
+	}
+	var resp serverResponse
+	if err := json.Unmarshal([]byte(lines[0]), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if string(resp.ID) != "7" || !resp.Cancelled || resp.Rendered != "" || resp.Error != "request cancelled" {
+		t.Fatalf("expected a cancelled response, got %s", lines[0])
+	}
+}
+
+func TestServeCancelsRequestsWaitingForASlot(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "slow.tmpl")
+	writeFile(t, templatePath, `{{ range .items }}{{ range $.items }}{{ range $.items }}{{ end }}{{ end }}{{ end }}done`)
+	itemsJSON, _ := json.Marshal(map[string]interface{}{"items": make([]int, 5000)})
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, contextPath, string(itemsJSON))
+
+	// With one slot, one of the two renders waits for the other.
+	request := func(id string) string {
+		return `{"id": ` + id + `, "template": ` + quoteJSON(templatePath) + `, "context": ` + quoteJSON(contextPath) + `}` + "\n"
+	}
+	requests := request("1") + request("2") + `{"cancel": 2}` + "\n" + `{"cancel": 1}` + "\n"
+	var output bytes.Buffer
+	start := time.Now()
+	if err := serve(strings.NewReader(requests), &output, renderOptions{Parallelism: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("expected both renders to stop promptly, took %s", elapsed)
+	}
+
+	cancelled := map[string]bool{}
+	for _, line := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+		var resp serverResponse
+		if err := json.Unmarshal([]byte(line), &resp); err != nil {
+			t.Fatal(err)
+		}
+		cancelled[string(resp.ID)] = resp.Cancelled
+	}
+	if len(cancelled) != 2 || !cancelled["1"] || !cancelled["2"] {
+		t.Fatalf("expected both requests to be cancelled, got %s", output.String())
+	}
+}
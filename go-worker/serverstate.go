@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	// serverStateFile is the file --state-dir keeps the server's state in.
+	serverStateFile = "server-state.json"
+	// serverStateVersion changes when the file's layout does; files of
+	// other versions are ignored.
+	serverStateVersion = 1
+)
+
+// serverState is what --state-dir persists: the latest render request for
+// each template the server parsed, least recently used first. Parsed
+// templates hold functions and cannot be written out, so a restarted
+// server replays the requests to parse them again.
+type serverState struct {
+	Version  int               `json:"version"`
+	Requests []json.RawMessage `json:"requests"`
+}
+
+// warmState records render requests as the server answers them and writes
+// them to the state file whenever the set of templates changes, and on
+// shutdown.
+type warmState struct {
+	mu       sync.Mutex
+	path     string
+	order    []string
+	requests map[string]json.RawMessage
+}
+
+// loadWarmState reads the state file in dir, creating dir if needed. A
+// missing, unreadable, or outdated file starts an empty state; the
+// problem, if any, is returned alongside it so the server can log it.
+func loadWarmState(dir string) (*warmState, error) {
+	state := &warmState{path: filepath.Join(dir, serverStateFile), requests: map[string]json.RawMessage{}}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return state, err
+	}
+	stateBytes, err := os.ReadFile(state.path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	var saved serverState
+	if err := json.Unmarshal(stateBytes, &saved); err != nil {
+		return state, fmt.Errorf("%s is not valid JSON: %v", state.path, err)
+	}
+	if saved.Version != serverStateVersion {
+		return state, nil
+	}
+	for _, request := range saved.Requests {
+		var req serverRequest
+		if err := json.Unmarshal(request, &req); err != nil || req.Template == "" {
+			continue
+		}
+		state.remember(req.Template, request)
+	}
+	return state, nil
+}
+
+// remember makes request the latest for template, dropping the least
+// recently used template past maxCachedTemplates, and reports whether the
+// set of requests changed.
+func (s *warmState) remember(template string, request json.RawMessage) bool {
+	previous, known := s.requests[template]
+	for i, path := range s.order {
+		if path == template {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+	s.order = append(s.order, template)
+	s.requests[template] = request
+	if len(s.order) > maxCachedTemplates {
+		delete(s.requests, s.order[0])
+		s.order = s.order[1:]
+	}
+	return !known || string(previous) != string(request)
+}
+
+// record notes a successful render request, given as the JSON line the
+// client sent. The id and any unsaved editor text are left out.
+func (s *warmState) record(template string, line []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(line, &fields); err != nil {
+		return err
+	}
+	delete(fields, "id")
+	delete(fields, "source")
+	request, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.remember(template, request) {
+		return nil
+	}
+	return s.saveLocked()
+}
+
+// replayable lists the remembered requests, least recently used first.
+func (s *warmState) replayable() []json.RawMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	requests := make([]json.RawMessage, 0, len(s.order))
+	for _, template := range s.order {
+		requests = append(requests, s.requests[template])
+	}
+	return requests
+}
+
+func (s *warmState) save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.saveLocked()
+}
+
+// saveLocked writes the state file through a temporary file, so a server
+// killed mid-write leaves the previous state intact.
+func (s *warmState) saveLocked() error {
+	saved := serverState{Version: serverStateVersion, Requests: make([]json.RawMessage, 0, len(s.order))}
+	for _, template := range s.order {
+		saved.Requests = append(saved.Requests, s.requests[template])
+	}
+	stateBytes, err := json.Marshal(saved)
+	if err != nil {
+		return err
+	}
+	temp := s.path + ".tmp"
+	if err := os.WriteFile(temp, stateBytes, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(temp, s.path)
+}
+
+// warmCache replays the saved requests against base, which holds the
+// server's cache, until stop closes. Only renders of templates and
+// contexts that are local files still on disk are replayed, and their
+// responses are dropped.
+func warmCache(requests []json.RawMessage, base renderOptions, stop <-chan struct{}, log io.Writer) {
+	// Replays are cancellable like the server's own requests, so they parse
+	// into the same cache entries, and stop aborts the one in flight.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	base.ctx = ctx
+	for _, request := range requests {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		req := serverRequest{renderOptions: base}
+		req.RenamedFuncs = cloneStringMap(base.RenamedFuncs)
+		if err := json.Unmarshal(request, &req); err != nil {
+			continue
+		}
+		if !replayableRequest(req) {
+			continue
+		}
+		if resp := run(req.Template, req.Context, req.renderOptions); resp.Error != "" {
+			fmt.Fprintf(log, "state: replaying %s: %s\n", req.Template, resp.Error)
+		}
+	}
+}
+
+func replayableRequest(req serverRequest) bool {
+	if req.Mode != "" && req.Mode != "render" {
+		return false
+	}
+	for _, path := range append([]string{req.Template, req.Context}, req.ContextLayers...) {
+		if path == "" {
+			continue
+		}
+		if path == "-" || isRemoteURL(path) || isObjectStoreURL(path) {
+			return false
+		}
+		if _, err := os.Stat(path); err != nil {
+			return false
+		}
+	}
+	// A replay must not write the --out or --xlsx-file files the server
+	// was started with behind the user's back.
+	return req.AtRef == "" && req.Bench == 0 && req.Out == "" && req.XLSXFile == ""
+}
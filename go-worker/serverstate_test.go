@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStateDirSavesRenderRequestsAndWarmsTheNextServer(t *testing.T) {
+	dir := t.TempDir()
+	stateDir := filepath.Join(dir, "state")
+	templatePath := filepath.Join(dir, "page.tmpl")
+	writeFile(t, templatePath, "Hello {{ .name }}")
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, contextPath, `{"name": "Ada"}`)
+
+	requests := `{"id": 1, "template": ` + quoteJSON(templatePath) + `, "context": ` + quoteJSON(contextPath) + `, "source": "unsaved {{ .name }}"}` + "\n" +
+		`{"id": 2, "template": ` + quoteJSON(templatePath) + `, "mode": "symbols"}` + "\n"
+	var output bytes.Buffer
+	if err := serve(strings.NewReader(requests), &output, renderOptions{StateDir: stateDir}); err != nil {
+		t.Fatal(err)
+	}
+	stateBytes, err := os.ReadFile(filepath.Join(stateDir, serverStateFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved serverState
+	if err := json.Unmarshal(stateBytes, &saved); err != nil || saved.Version != serverStateVersion || len(saved.Requests) != 1 {
+		t.Fatalf("unexpected state file: %s", stateBytes)
+	}
+	if saved := string(saved.Requests[0]); strings.Contains(saved, `"id"`) || strings.Contains(saved, "unsaved") || !strings.Contains(saved, "page.tmpl") {
+		t.Fatalf("expected the request without its id or unsaved text, got %s", saved)
+	}
+
+	state, err := loadWarmState(stateDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := renderOptions{cache: newTemplateCache()}
+	warmCache(state.replayable(), base, make(chan struct{}), io.Discard)
+	// Server requests are cancellable, which the parse cache keys on.
+	if resp := run(templatePath, contextPath, renderOptions{cache: base.cache, ctx: context.Background()}); resp.Error != "" || resp.Rendered != "Hello Ada" || !resp.CacheHit {
+		t.Fatalf("expected the replay to warm the cache, got %+v", resp)
+	}
+}
+
+func TestStateDirStartsColdFromABrokenFileAndSkipsUnusableRequests(t *testing.T) {
+	stateDir := t.TempDir()
+	writeFile(t, filepath.Join(stateDir, serverStateFile), "{not json")
+	state, err := loadWarmState(stateDir)
+	if err == nil || len(state.replayable()) != 0 {
+		t.Fatalf("expected a broken state file to start cold, got %v", err)
+	}
+
+	missing := json.RawMessage(`{"template": ` + quoteJSON(filepath.Join(stateDir, "gone.tmpl")) + `}`)
+	remote := json.RawMessage(`{"template": ` + quoteJSON(filepath.Join(stateDir, "gone.tmpl")) + `, "context": "https://example.com/ctx.json"}`)
+	present := filepath.Join(stateDir, "present.tmpl")
+	writeFile(t, present, "x")
+	for _, request := range []json.RawMessage{missing, remote} {
+		var req serverRequest
+		if err := json.Unmarshal(request, &req); err != nil || replayableRequest(req) {
+			t.Fatalf("expected %s not to be replayed", request)
+		}
+	}
+
+	// Output files only come from the command line, but a server started
+	// with them must not write them on replay.
+	for _, base := range []renderOptions{{Out: filepath.Join(stateDir, "out.txt")}, {XLSXFile: filepath.Join(stateDir, "out.xlsx")}} {
+		req := serverRequest{renderOptions: base}
+		if err := json.Unmarshal([]byte(`{"template": `+quoteJSON(present)+`, "out": "ignored.txt"}`), &req); err != nil || replayableRequest(req) {
+			t.Fatalf("expected a request under %+v not to be replayed", base)
+		}
+	}
+}
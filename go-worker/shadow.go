@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"text/template/parse"
+)
+
+// relatedLocation points at another place in the source a diagnostic
+// refers to, such as the declaration a variable shadows.
+type relatedLocation struct {
+	Message string `json:"message"`
+	sourceLocation
+}
+
+type variableScope map[string]parse.Pos
+
+// shadowDiagnostics warns when a variable declared in a nested block, or by
+// range, reuses the name of a variable from an enclosing block. The inner
+// variable silently hides the outer one until the block ends, which is a
+// common source of wrong output.
+func shadowDiagnostics(templatePath, content string, opts renderOptions) []diagnostic {
+	trees, err := parseTreesWithDelims(templateName(templatePath), content, opts.LeftDelim, opts.RightDelim)
+	if err != nil {
+		return nil
+	}
+
+	checker := shadowChecker{templatePath: templatePath, content: content}
+	for _, name := range sortedTreeNames(trees, templateName(templatePath)) {
+		checker.scopes = []variableScope{{}}
+		checker.list(trees[name].Root)
+	}
+	return checker.diagnostics
+}
+
+type shadowChecker struct {
+	templatePath string
+	content      string
+	scopes       []variableScope
+	diagnostics  []diagnostic
+}
+
+func (c *shadowChecker) list(list *parse.ListNode) {
+	if list == nil {
+		return
+	}
+	for _, node := range list.Nodes {
+		switch typed := node.(type) {
+		case *parse.ActionNode:
+			c.declare(typed.Pipe)
+		case *parse.IfNode:
+			c.branch(&typed.BranchNode)
+		case *parse.RangeNode:
+			c.branch(&typed.BranchNode)
+		case *parse.WithNode:
+			c.branch(&typed.BranchNode)
+		}
+	}
+}
+
+// branch opens a scope for the block: variables its pipeline declares live
+// until {{ end }}, and the else branch gets a scope of its own.
+func (c *shadowChecker) branch(branch *parse.BranchNode) {
+	c.scopes = append(c.scopes, variableScope{})
+	c.declare(branch.Pipe)
+	c.list(branch.List)
+	c.scopes = c.scopes[:len(c.scopes)-1]
+
+	if branch.ElseList != nil {
+		c.scopes = append(c.scopes, variableScope{})
+		c.list(branch.ElseList)
+		c.scopes = c.scopes[:len(c.scopes)-1]
+	}
+}
+
+func (c *shadowChecker) declare(pipe *parse.PipeNode) {
+	if pipe == nil || pipe.IsAssign {
+		return
+	}
+	current := c.scopes[len(c.scopes)-1]
+	for _, decl := range pipe.Decl {
+		name := decl.Ident[0]
+		if outer, ok := c.lookupOuter(name); ok {
+			line, column := lineColumn(c.content, decl.Position())
+			outerLine, outerColumn := lineColumn(c.content, outer)
+			c.diagnostics = append(c.diagnostics, diagnostic{
+				Message:   fmt.Sprintf("%s shadows the variable declared at line %d, column %d", name, outerLine, outerColumn),
+				Severity:  "warning",
+				Rule:      "shadow",
+				File:      c.templatePath,
+				Line:      line,
+				Column:    column,
+				EndColumn: column + len(name),
+				Related: []relatedLocation{{
+					Message:        fmt.Sprintf("outer %s is declared here", name),
+					sourceLocation: sourceLocation{File: c.templatePath, Line: outerLine, Column: outerColumn},
+				}},
+			})
+		}
+		current[name] = decl.Position()
+	}
+}
+
+// lookupOuter finds name in the scopes enclosing the current one.
+func (c *shadowChecker) lookupOuter(name string) (parse.Pos, bool) {
+	for i := len(c.scopes) - 2; i >= 0; i-- {
+		if pos, ok := c.scopes[i][name]; ok {
+			return pos, true
+		}
+	}
+	return 0, false
+}
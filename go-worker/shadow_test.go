@@ -0,0 +1,58 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestShadowDiagnosticsReportBothDeclarations(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "page.tmpl")
+	writeFile(t, templatePath, `{{ $name := .name }}{{ $i := 0 }}
+{{ if .ok }}{{ $name := "inner" }}{{ $name }}{{ end }}
+{{ range $i, $v := .items }}{{ $v }}{{ end }}
+{{ with .x }}{{ $fresh := 1 }}{{ end }}{{ $fresh := 2 }}{{ $name = "reassigned" }}`)
+
+	resp := run(templatePath, "", renderOptions{})
+	if resp.Error != "" || len(resp.Diagnostics) != 2 {
+		t.Fatalf("expected two shadowing warnings, got %+v", resp)
+	}
+
+	inner := resp.Diagnostics[0]
+	if inner.Severity != "warning" || inner.Message != "$name shadows the variable declared at line 1, column 4" || inner.Line != 2 || inner.Column != 16 || inner.EndColumn != 21 {
+		t.Fatalf("unexpected block warning: %+v", inner)
+	}
+	if len(inner.Related) != 1 || inner.Related[0].Line != 1 || inner.Related[0].Column != 4 || inner.Related[0].File != templatePath {
+		t.Fatalf("unexpected related location: %+v", inner.Related)
+	}
+
+	if rangeVar := resp.Diagnostics[1]; rangeVar.Line != 3 || rangeVar.Column != 10 || rangeVar.Related[0].Column != 24 {
+		t.Fatalf("unexpected range warning: %+v", rangeVar)
+	}
+
+	// Check mode also reports the unused variables; see lint.go.
+	resp = run(templatePath, "", renderOptions{Mode: "check"})
+	shadows := 0
+	for _, diag := range resp.Diagnostics {
+		if diag.Rule == "shadow" {
+			shadows++
+		}
+	}
+	if shadows != 2 {
+		t.Fatalf("expected check mode to report shadowing, got %+v", resp.Diagnostics)
+	}
+}
+
+func TestShadowAndHTMLRiskDiagnosticsHonorDelimiters(t *testing.T) {
+	templatePath := filepath.Join(t.TempDir(), "page.html")
+	writeFile(t, templatePath, `[[ $name := .name ]][[ if .ok ]][[ $name := "inner" ]][[ end ]]<a onclick="go([[ .id ]])">x</a>`)
+
+	resp := run(templatePath, "", renderOptions{LeftDelim: "[[", RightDelim: "]]"})
+	var rules []string
+	for _, diag := range resp.Diagnostics {
+		rules = append(rules, diag.Rule)
+	}
+	if resp.Error != "" || len(rules) != 2 || rules[0] != "shadow" || rules[1] != eventHandlerOutputRule {
+		t.Fatalf("expected shadow and event handler warnings, got %+v", resp)
+	}
+}
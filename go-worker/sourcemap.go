@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/template/parse"
+)
+
+// sourceMarkFunc is the hidden helper an instrumented template calls
+// before every node that writes output, so the worker can tell which node
+// wrote each byte.
+const sourceMarkFunc = "__goTemplateStudioSourceMark"
+
+// sourceMapping links a range of the rendered output, from OutputStart up
+// to OutputEnd, to the template text or action that wrote it. Kind is text
+// or action.
+type sourceMapping struct {
+	OutputStart int    `json:"outputStart"`
+	OutputEnd   int    `json:"outputEnd"`
+	File        string `json:"file"`
+	Kind        string `json:"kind"`
+	Line        int    `json:"line"`
+	Column      int    `json:"column"`
+	EndLine     int    `json:"endLine"`
+	EndColumn   int    `json:"endColumn"`
+}
+
+// instrumentSourceMarks inserts a call to sourceMarkFunc before every text
+// and output action of tree. Each call carries the node's kind and source
+// span, encoded as "kind|start|end|template", where template is the name of
+// the source the tree was parsed from.
+func instrumentSourceMarks(tree *parse.Tree, sources map[string]string, leftDelim, rightDelim string) {
+	if tree == nil {
+		return
+	}
+	content, ok := sources[tree.ParseName]
+	if !ok {
+		return
+	}
+	actions := scanActions(content, leftDelim, rightDelim)
+	markList(tree, tree.Root, content, actions)
+}
+
+func markList(tree *parse.Tree, list *parse.ListNode, content string, actions []actionSpan) {
+	if list == nil {
+		return
+	}
+	nodes := make([]parse.Node, 0, 2*len(list.Nodes))
+	for _, node := range list.Nodes {
+		switch typed := node.(type) {
+		case *parse.TextNode:
+			end := min(int(typed.Pos)+len(typed.Text), len(content))
+			nodes = append(nodes, sourceMark(tree, typed.Pos, "text", int(typed.Pos), end))
+		case *parse.ActionNode:
+			if len(typed.Pipe.Decl) == 0 {
+				start, end := int(typed.Pos), int(typed.Pos)
+				if span, ok := enclosingAction(actions, typed.Pos); ok {
+					start, end = span.Start, span.End
+				}
+				nodes = append(nodes, sourceMark(tree, typed.Pos, "action", start, end))
+			}
+		case *parse.IfNode:
+			markList(tree, typed.List, content, actions)
+			markList(tree, typed.ElseList, content, actions)
+		case *parse.WithNode:
+			markList(tree, typed.List, content, actions)
+			markList(tree, typed.ElseList, content, actions)
+		case *parse.RangeNode:
+			markList(tree, typed.List, content, actions)
+			markList(tree, typed.ElseList, content, actions)
+		}
+		nodes = append(nodes, node)
+	}
+	list.Nodes = nodes
+}
+
+func enclosingAction(actions []actionSpan, pos parse.Pos) (actionSpan, bool) {
+	for _, action := range actions {
+		if action.Start <= int(pos) && int(pos) < action.End {
+			return action, true
+		}
+	}
+	return actionSpan{}, false
+}
+
+func sourceMark(tree *parse.Tree, pos parse.Pos, kind string, start, end int) *parse.ActionNode {
+	return hiddenCall(tree, pos, sourceMarkFunc, fmt.Sprintf("%s|%d|%d|%s", kind, start, end, tree.ParseName))
+}
+
+// sourceRecorder counts the bytes a render writes and notes the offset at
+// which each marked node starts.
+type sourceRecorder struct {
+	out     io.Writer
+	written int
+	marks   []outputMark
+}
+
+type outputMark struct {
+	offset int
+	span   string
+}
+
+func (r *sourceRecorder) Write(p []byte) (int, error) {
+	n, err := r.out.Write(p)
+	r.written += n
+	return n, err
+}
+
+// mark is registered as sourceMarkFunc.
+func (r *sourceRecorder) mark(span string) string {
+	r.marks = append(r.marks, outputMark{offset: r.written, span: span})
+	return ""
+}
+
+// mappings turns the marks into output ranges, merging consecutive ranges
+// written by the same node and dropping nodes that wrote nothing. sources
+// maps template names to the file and content they were parsed from.
+func (r *sourceRecorder) mappings(sources map[string]templateSource) []sourceMapping {
+	var result []sourceMapping
+	var previous string
+	for i, mark := range r.marks {
+		end := r.written
+		if i+1 < len(r.marks) {
+			end = r.marks[i+1].offset
+		}
+		if end <= mark.offset {
+			continue
+		}
+		if mark.span == previous && len(result) > 0 && result[len(result)-1].OutputEnd == mark.offset {
+			result[len(result)-1].OutputEnd = end
+			continue
+		}
+		mapping, ok := decodeSourceSpan(mark.span, sources)
+		if !ok {
+			continue
+		}
+		mapping.OutputStart, mapping.OutputEnd = mark.offset, end
+		result = append(result, mapping)
+		previous = mark.span
+	}
+	return result
+}
+
+func decodeSourceSpan(span string, sources map[string]templateSource) (sourceMapping, bool) {
+	parts := strings.SplitN(span, "|", 4)
+	if len(parts) != 4 {
+		return sourceMapping{}, false
+	}
+	start, startErr := strconv.Atoi(parts[1])
+	end, endErr := strconv.Atoi(parts[2])
+	source, ok := sources[parts[3]]
+	if startErr != nil || endErr != nil || !ok {
+		return sourceMapping{}, false
+	}
+	line, column := lineColumn(source.Content, parse.Pos(start))
+	endLine, endColumn := lineColumn(source.Content, parse.Pos(end))
+	return sourceMapping{
+		File:      source.Path,
+		Kind:      parts[0],
+		Line:      line,
+		Column:    column,
+		EndLine:   endLine,
+		EndColumn: endColumn,
+	}, true
+}
+
+// templateSources maps the name of the main template and of each include
+// to the file it came from.
+func templateSources(path, content string, opts renderOptions) map[string]templateSource {
+	sources := map[string]templateSource{templateName(path): {Name: templateName(path), Path: path, Content: content}}
+	for _, include := range opts.includes {
+		sources[include.Name] = include
+	}
+	return sources
+}
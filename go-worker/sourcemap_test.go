@@ -0,0 +1,78 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSourceMapLinksOutputToTemplateNodes(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "page.html")
+	writeFile(t, templatePath, "<h1>{{ .title }}</h1>\n{{ range .items }}<li>{{ . }}</li>{{ end }}")
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, contextPath, `{"title": "A & B", "items": ["x", "y"]}`)
+
+	resp := run(templatePath, contextPath, renderOptions{SourceMap: true})
+	if resp.Error != "" || resp.Rendered != "<h1>A &amp; B</h1>\n<li>x</li><li>y</li>" {
+		t.Fatalf("unexpected render: %+v", resp)
+	}
+
+	type span struct {
+		output, kind         string
+		line, column, endCol int
+	}
+	var got []span
+	for _, mapping := range resp.SourceMap {
+		if mapping.File != templatePath {
+			t.Fatalf("unexpected file in %+v", mapping)
+		}
+		got = append(got, span{resp.Rendered[mapping.OutputStart:mapping.OutputEnd], mapping.Kind, mapping.Line, mapping.Column, mapping.EndColumn})
+	}
+	want := []span{
+		{"<h1>", "text", 1, 1, 5},
+		{"A &amp; B", "action", 1, 5, 17},
+		{"</h1>\n", "text", 1, 17, 1},
+		{"<li>", "text", 2, 19, 23},
+		{"x", "action", 2, 23, 30},
+		{"</li>", "text", 2, 30, 35},
+		{"<li>", "text", 2, 19, 23},
+		{"y", "action", 2, 23, 30},
+		{"</li>", "text", 2, 30, 35},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d mappings, got %+v", len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("mapping %d: expected %+v, got %+v", i, want[i], got[i])
+		}
+	}
+}
+
+func TestSourceMapFollowsIncludesAndPositionEncoding(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "page.tmpl")
+	writeFile(t, templatePath, `é{{ template "footer.tmpl" . }}`)
+	footerPath := filepath.Join(dir, "partials", "footer.tmpl")
+	writeFile(t, footerPath, "— {{ .name }}")
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, contextPath, `{"name": "Ada"}`)
+
+	resp := run(templatePath, contextPath, renderOptions{
+		SourceMap:        true,
+		Includes:         []string{filepath.Join(dir, "partials", "*.tmpl")},
+		PositionEncoding: positionEncodingUTF16,
+		MaxIterations:    100,
+	})
+	if resp.Error != "" || len(resp.SourceMap) != 3 {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	footer := resp.SourceMap[1]
+	if footer.File != footerPath || footer.Kind != "text" || footer.OutputStart != 2 || footer.OutputEnd != 6 {
+		t.Fatalf("expected the include's text at byte offsets, got %+v", footer)
+	}
+	name := resp.SourceMap[2]
+	if name.File != footerPath || name.Column != 3 || name.EndColumn != 14 || name.OutputStart != 6 || name.OutputEnd != 9 {
+		t.Fatalf("unexpected action mapping: %+v", name)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// templateToJSON encodes value as compact JSON. HTML characters are left
+// as they are; html/template escapes them for the context they land in.
+func templateToJSON(value interface{}) (string, error) {
+	return encodeJSON("toJson", value, "")
+}
+
+// templateToPrettyJSON encodes value as JSON indented by two spaces.
+func templateToPrettyJSON(value interface{}) (string, error) {
+	return encodeJSON("toPrettyJson", value, "  ")
+}
+
+func encodeJSON(name string, value interface{}, indent string) (string, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", indent)
+	if err := encoder.Encode(value); err != nil {
+		return "", fmt.Errorf("%s: %v", name, err)
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// templateFromJSON decodes a JSON document into the maps, lists, and
+// float64 numbers a JSON context produces.
+func templateFromJSON(text string) (interface{}, error) {
+	var value interface{}
+	if err := json.Unmarshal([]byte(text), &value); err != nil {
+		return nil, fmt.Errorf("fromJson: %v", err)
+	}
+	return value, nil
+}
+
+// templateToYAML encodes value as block-style YAML indented by two spaces,
+// without the trailing newline, so it can be piped through indent.
+func templateToYAML(value interface{}) (string, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(value); err != nil {
+		return "", fmt.Errorf("toYaml: %v", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return "", fmt.Errorf("toYaml: %v", err)
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// templateFromYAML decodes a single YAML document. Mappings become
+// map[string]interface{} so fields can be read with dot notation.
+func templateFromYAML(text string) (interface{}, error) {
+	var value interface{}
+	if err := yaml.Unmarshal([]byte(text), &value); err != nil {
+		return nil, fmt.Errorf("fromYaml: %v", err)
+	}
+	return stringKeyedMaps(value), nil
+}
+
+// stringKeyedMaps converts the map[interface{}]interface{} values YAML
+// produces for mappings with non-string keys.
+func stringKeyedMaps(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(typed))
+		for key, item := range typed {
+			converted[fmt.Sprint(key)] = stringKeyedMaps(item)
+		}
+		return converted
+	case map[string]interface{}:
+		for key, item := range typed {
+			typed[key] = stringKeyedMaps(item)
+		}
+		return typed
+	case []interface{}:
+		for i, item := range typed {
+			typed[i] = stringKeyedMaps(item)
+		}
+		return typed
+	default:
+		return value
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStructuredDataHelpersRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "manifest.tmpl")
+	writeFile(t, templatePath, `env: {{ toJson .env }}
+{{ toYaml .spec }}
+{{ toPrettyJson .ports }}
+{{ with fromJson .raw }}{{ .cpu }}{{ end }} {{ with fromYaml .yaml }}{{ index .items 1 }} {{ index .codes "1" }}{{ end }}`)
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, contextPath, `{
+		"env": {"A": "<x>", "B": 2},
+		"spec": {"replicas": 3, "labels": {"app": "web"}, "args": ["--a", "--b"]},
+		"ports": [80],
+		"raw": "{\"cpu\": \"500m\"}",
+		"yaml": "items: [a, b]\ncodes: {1: one}"
+	}`)
+
+	resp := run(templatePath, contextPath, renderOptions{})
+	want := `env: {"A":"<x>","B":2}
+args:
+  - --a
+  - --b
+labels:
+  app: web
+replicas: 3
+[
+  80
+]
+500m b one`
+	if resp.Error != "" || resp.Rendered != want {
+		t.Fatalf("unexpected render %q (error %q)", resp.Rendered, resp.Error)
+	}
+}
+
+func TestStructuredDataHelpersReportInvalidInput(t *testing.T) {
+	templatePath := filepath.Join(t.TempDir(), "bad.tmpl")
+	for source, want := range map[string]string{
+		`{{ fromJson "{bad}" }}`: "fromJson: invalid character",
+		`{{ fromYaml "a: [" }}`:  "fromYaml: yaml:",
+	} {
+		writeFile(t, templatePath, source)
+		if resp := run(templatePath, "", renderOptions{}); !strings.Contains(resp.Error, want) {
+			t.Errorf("%s: expected an error containing %q, got %+v", source, want, resp)
+		}
+	}
+	if _, err := templateToJSON(func() {}); err == nil || !strings.HasPrefix(err.Error(), "toJson: json: unsupported type") {
+		t.Fatalf("expected an encoding error, got %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// stubFunction stands in for a function the application registers and the
+// worker does not know. A nil Arity accepts any number of arguments, and
+// without Returns a call renders a placeholder naming the function.
+type stubFunction struct {
+	Arity   *int        `json:"arity,omitempty"`
+	Returns interface{} `json:"returns,omitempty"`
+}
+
+// loadStubFunctions reads --stub-functions, either a comma-separated list
+// of names or the path of a JSON manifest mapping names to stubFunction:
+//
+//	{"currentUser": {"arity": 0, "returns": {"name": "Ada"}}, "asset": {"arity": 1}}
+func loadStubFunctions(spec string) (map[string]stubFunction, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, nil
+	}
+	if !strings.HasSuffix(strings.ToLower(spec), ".json") {
+		stubs := map[string]stubFunction{}
+		for _, name := range splitList(spec) {
+			stubs[name] = stubFunction{}
+		}
+		return stubs, nil
+	}
+
+	content, err := os.ReadFile(spec)
+	if err != nil {
+		return nil, err
+	}
+	var stubs map[string]stubFunction
+	if err := json.Unmarshal(content, &stubs); err != nil {
+		return nil, fmt.Errorf("stub functions %s are not valid JSON: %v", spec, err)
+	}
+	names := make([]string, 0, len(stubs))
+	for name := range stubs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if arity := stubs[name].Arity; arity != nil && *arity < 0 {
+			return nil, fmt.Errorf("stub function %q has negative arity %d", name, *arity)
+		}
+	}
+	return stubs, nil
+}
+
+// applyStubFunctions registers the stubs of opts.StubFunctions. Stubs are
+// declared on purpose, so they replace helpers of the same name; builtins
+// such as len cannot be replaced. Production would fail on the functions
+// they stand in for, so they are refused under production parity.
+func applyStubFunctions[M ~map[string]interface{}](funcs M, opts renderOptions) error {
+	if opts.ProductionParity && strings.TrimSpace(opts.StubFunctions) != "" {
+		return errors.New("--stub-functions cannot be used with --production-parity, which only registers the functions production does")
+	}
+	stubs, err := loadStubFunctions(opts.StubFunctions)
+	if err != nil {
+		return err
+	}
+	for name, stub := range stubs {
+		if builtinFuncNames[name] {
+			return fmt.Errorf("cannot stub builtin function %q", name)
+		}
+		funcs[name] = stub.call(name)
+	}
+	return nil
+}
+
+func (s stubFunction) call(name string) func(...interface{}) (interface{}, error) {
+	return func(args ...interface{}) (interface{}, error) {
+		if s.Arity != nil && len(args) != *s.Arity {
+			return nil, fmt.Errorf("wrong number of args for stub %s: want %d got %d", name, *s.Arity, len(args))
+		}
+		if s.Returns == nil {
+			return "[" + name + "]", nil
+		}
+		return s.Returns, nil
+	}
+}
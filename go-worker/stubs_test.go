@@ -0,0 +1,69 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStubFunctionsRenderPlaceholdersForNamedFunctions(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "page.tmpl")
+	writeFile(t, templatePath, `{{ asset "app.css" }} {{ .name | tenantName | upper }}`)
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, contextPath, `{"name": "ada"}`)
+
+	resp := run(templatePath, contextPath, renderOptions{})
+	if resp.Error == "" {
+		t.Fatal("expected unknown functions to fail without stubs")
+	}
+
+	resp = run(templatePath, contextPath, renderOptions{StubFunctions: "asset, tenantName"})
+	if resp.Error != "" || resp.Rendered != "[asset] [TENANTNAME]" {
+		t.Fatalf("unexpected render: %+v", resp)
+	}
+
+	check := run(templatePath, "", renderOptions{Mode: "check", StubFunctions: "asset,tenantName"})
+	if len(check.Diagnostics) != 0 {
+		t.Fatalf("expected stubbed functions to pass check mode, got %+v", check.Diagnostics)
+	}
+}
+
+func TestStubFunctionManifestSetsReturnsAndArity(t *testing.T) {
+	dir := t.TempDir()
+	manifestPath := filepath.Join(dir, "stubs.json")
+	writeFile(t, manifestPath, `{"currentUser": {"arity": 0, "returns": {"name": "Ada"}}, "asset": {"arity": 1}}`)
+	templatePath := filepath.Join(dir, "page.tmpl")
+	writeFile(t, templatePath, `{{ currentUser.name }} {{ asset "a.css" }}`)
+
+	resp := run(templatePath, "", renderOptions{StubFunctions: manifestPath})
+	if resp.Error != "" || resp.Rendered != "Ada [asset]" {
+		t.Fatalf("unexpected render: %+v", resp)
+	}
+
+	writeFile(t, templatePath, `{{ asset "a.css" "b.css" }}`)
+	resp = run(templatePath, "", renderOptions{StubFunctions: manifestPath})
+	if !strings.Contains(resp.Error, "wrong number of args for stub asset: want 1 got 2") {
+		t.Fatalf("expected an arity error, got %+v", resp)
+	}
+
+	resp = run(templatePath, "", renderOptions{StubFunctions: "len"})
+	if !strings.Contains(resp.Error, `cannot stub builtin function "len"`) {
+		t.Fatalf("expected builtins to be protected, got %+v", resp)
+	}
+}
+
+func TestStubFunctionsAreRefusedUnderProductionParity(t *testing.T) {
+	templatePath := filepath.Join(t.TempDir(), "page.tmpl")
+	writeFile(t, templatePath, `{{ asset "app.css" }}`)
+
+	want := "--stub-functions cannot be used with --production-parity"
+	resp := run(templatePath, "", renderOptions{StubFunctions: "asset", ProductionParity: true})
+	if !strings.Contains(resp.Error, want) || resp.Rendered != "" {
+		t.Fatalf("expected stubs to be refused, got %+v", resp)
+	}
+	check := run(templatePath, "", renderOptions{Mode: "check", StubFunctions: "asset", ProductionParity: true})
+	if !strings.Contains(check.Error, want) {
+		t.Fatalf("expected check mode to refuse stubs too, got %+v", check)
+	}
+}
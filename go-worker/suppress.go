@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/template/parse"
+)
+
+// unusedSuppressionRule identifies the check finding for a suppression
+// comment that silenced nothing.
+const unusedSuppressionRule = "unused-suppression"
+
+// lintSuppression silences findings of one rule, or of every rule when
+// rule is empty, on lines from through to. A to of 0 runs to the end of
+// the file.
+type lintSuppression struct {
+	rule      string
+	directive string
+	from, to  int
+	// line, column, and endColumn locate the comment, for reporting it
+	// when unused.
+	line, column, endColumn int
+	used                    bool
+}
+
+// parseSuppressions reads the lint comments of content:
+//
+//	{{/* lint:disable rule-a rule-b */}}    from here to the end of the file
+//	{{/* lint:enable rule-a */}}            ends rule-a's disable
+//	{{/* lint:disable-next-line rule-a */}} the following line only
+//
+// Without rule ids a comment covers every rule. Rule ids may be separated
+// by commas, and text after "--" explains the suppression.
+func parseSuppressions(content, leftDelim, rightDelim string) []*lintSuppression {
+	var suppressions []*lintSuppression
+	var open []*lintSuppression
+	for _, action := range scanActions(content, leftDelim, rightDelim) {
+		if !action.IsComment() {
+			continue
+		}
+		text := strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(action.Body(), "/*"), "*/"))
+		directive, rest, _ := strings.Cut(text, " ")
+		if !strings.HasPrefix(directive, "lint:") {
+			continue
+		}
+		rest, _, _ = strings.Cut(rest, "--")
+		rules := strings.FieldsFunc(rest, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' || r == '\n' })
+
+		line, column := lineColumn(content, parse.Pos(action.Start))
+		endLine, endColumn := lineColumn(content, parse.Pos(action.End))
+		if endLine != line {
+			endColumn = 0
+		}
+		newSuppression := func(rule string) *lintSuppression {
+			return &lintSuppression{rule: rule, directive: directive, line: line, column: column, endColumn: endColumn}
+		}
+		if len(rules) == 0 {
+			rules = []string{""}
+		}
+
+		switch directive {
+		case "lint:disable":
+			for _, rule := range rules {
+				suppression := newSuppression(rule)
+				suppression.from = line
+				suppressions = append(suppressions, suppression)
+				open = append(open, suppression)
+			}
+		case "lint:disable-next-line":
+			for _, rule := range rules {
+				suppression := newSuppression(rule)
+				suppression.from, suppression.to = endLine+1, endLine+1
+				suppressions = append(suppressions, suppression)
+			}
+		case "lint:enable":
+			var still []*lintSuppression
+			for _, suppression := range open {
+				if rules[0] == "" || containsString(rules, suppression.rule) {
+					suppression.to = line
+					continue
+				}
+				still = append(still, suppression)
+			}
+			open = still
+		}
+	}
+	return suppressions
+}
+
+// suppressDiagnostics drops the diagnostics of templatePath that a lint
+// comment silences and returns the rest, along with a warning for each
+// suppression that silenced nothing. Only findings with a rule id can be
+// suppressed; syntax and execution errors always surface.
+func suppressDiagnostics(templatePath, content, leftDelim, rightDelim string, diagnostics []diagnostic) (kept, unused []diagnostic) {
+	suppressions := parseSuppressions(content, leftDelim, rightDelim)
+	if len(suppressions) == 0 {
+		return diagnostics, nil
+	}
+	for _, diag := range diagnostics {
+		if !suppressedBy(suppressions, templatePath, diag) {
+			kept = append(kept, diag)
+		}
+	}
+	for _, suppression := range suppressions {
+		if suppression.used {
+			continue
+		}
+		message := fmt.Sprintf("unused %s directive", suppression.directive)
+		if suppression.rule != "" {
+			message = fmt.Sprintf("unused %s directive for rule %q", suppression.directive, suppression.rule)
+		}
+		unused = append(unused, diagnostic{
+			Message:   message,
+			Severity:  "warning",
+			Rule:      unusedSuppressionRule,
+			File:      templatePath,
+			Line:      suppression.line,
+			Column:    suppression.column,
+			EndColumn: suppression.endColumn,
+		})
+	}
+	return kept, unused
+}
+
+func suppressedBy(suppressions []*lintSuppression, templatePath string, diag diagnostic) bool {
+	if diag.Rule == "" || (diag.File != "" && diag.File != templatePath) {
+		return false
+	}
+	suppressed := false
+	for _, suppression := range suppressions {
+		if suppression.rule != "" && suppression.rule != diag.Rule {
+			continue
+		}
+		if diag.Line < suppression.from || (suppression.to != 0 && diag.Line > suppression.to) {
+			continue
+		}
+		// Every matching comment counts as used, so overlapping ones are
+		// not reported.
+		suppression.used = true
+		suppressed = true
+	}
+	return suppressed
+}
+
+func containsString(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCheckHonorsLintCommentsAndReportsUnusedOnes(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "page.tmpl")
+	writeFile(t, templatePath, `{{/* lint:disable-next-line unknown-function -- provided by the app */}}
+{{ shout .a }}
+{{ whisper .b }}
+{{/* lint:disable unknown-function, shadow */}}
+{{ mumble .c }}
+{{/* lint:enable unknown-function */}}
+{{ yell .d }}
+{{/* lint:disable-next-line */}}
+plain text
+`)
+
+	resp := run(templatePath, "", renderOptions{Mode: "check"})
+	if resp.Error != "" {
+		t.Fatalf("unexpected error: %+v", resp)
+	}
+	type finding struct {
+		rule string
+		line int
+	}
+	var got []finding
+	for _, diag := range resp.Diagnostics {
+		got = append(got, finding{diag.Rule, diag.Line})
+	}
+	want := []finding{
+		{"unknown-function", 3},
+		{"unknown-function", 7},
+		{unusedSuppressionRule, 4},
+		{unusedSuppressionRule, 8},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %+v, got %+v", want, resp.Diagnostics)
+	}
+	if message := resp.Diagnostics[2].Message; message != `unused lint:disable directive for rule "shadow"` {
+		t.Fatalf("unexpected unused message: %q", message)
+	}
+}
+
+func TestSuppressionsNeverHideErrorsWithoutRule(t *testing.T) {
+	diagnostics := []diagnostic{
+		{Message: "unexpected EOF", Severity: "error", File: "a.tmpl", Line: 2},
+		{Message: "$x shadows", Severity: "warning", Rule: "shadow", File: "a.tmpl", Line: 2},
+		{Message: "$y shadows", Severity: "warning", Rule: "shadow", File: "b.tmpl", Line: 2},
+	}
+	kept, unused := suppressDiagnostics("a.tmpl", "{{/* lint:disable */}}\n{{ $x := 1 }}", "", "", diagnostics)
+	if len(unused) != 0 || !reflect.DeepEqual(kept, []diagnostic{diagnostics[0], diagnostics[2]}) {
+		t.Fatalf("expected only a.tmpl's finding to be suppressed, got %+v (unused %+v)", kept, unused)
+	}
+}
+
+func TestRenderWarningsHonorLintComments(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "page.tmpl")
+	writeFile(t, templatePath, "{{ $x := 1 }}{{ with .a }}{{/* lint:disable-next-line shadow */}}\n{{ $x := 2 }}{{ end }}")
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, contextPath, `{"a": true}`)
+
+	resp := run(templatePath, contextPath, renderOptions{})
+	if resp.Error != "" || len(resp.Diagnostics) != 0 {
+		t.Fatalf("expected the shadow warning to be suppressed, got %+v", resp)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"sort"
+	"text/template/parse"
+)
+
+// templateSymbol is one entry of the document outline: a define, a block,
+// or a variable declared at the top level of the template or of a define.
+// Line through EndColumn span the whole symbol, from its opening action
+// through its {{end}}, or the declaring action of a variable; NameLine
+// through NameEndColumn span just its name, for breadcrumbs and
+// selection. A define's variables, and blocks inside it, are its
+// Children.
+type templateSymbol struct {
+	Name          string           `json:"name"`
+	Kind          string           `json:"kind"`
+	Line          int              `json:"line"`
+	Column        int              `json:"column"`
+	EndLine       int              `json:"endLine"`
+	EndColumn     int              `json:"endColumn"`
+	NameLine      int              `json:"nameLine"`
+	NameColumn    int              `json:"nameColumn"`
+	NameEndColumn int              `json:"nameEndColumn"`
+	Children      []templateSymbol `json:"children,omitempty"`
+
+	start, end int
+}
+
+// executeSymbols lists the defines, blocks, and top-level variables of the
+// template, as parsed by text/template/parse, for the outline view.
+func executeSymbols(templatePath string, opts renderOptions) response {
+	if templatePath == "" {
+		return response{Error: "template path is required"}
+	}
+	content, err := readTemplate(templatePath, opts)
+	if err != nil {
+		return response{Error: err.Error()}
+	}
+	name := templateName(templatePath)
+	trees, err := parseTreesWithDelims(name, content, opts.LeftDelim, opts.RightDelim)
+	if err != nil {
+		return response{
+			Diagnostics: []diagnostic{templateDiagnosticWithDelims(err, templatePath, content, opts.LeftDelim, opts.RightDelim)},
+			Error:       err.Error(),
+		}
+	}
+	return response{Symbols: templateSymbols(name, content, trees, opts)}
+}
+
+// templateSymbols builds the outline: the symbols of each define and
+// block, nested by where they sit in the source, alongside the main
+// template's top-level variables.
+func templateSymbols(name, content string, trees map[string]*parse.Tree, opts renderOptions) []templateSymbol {
+	actions := scanActions(content, opts.LeftDelim, opts.RightDelim)
+	var definitions []templateSymbol
+	var roots []templateSymbol
+	for _, treeName := range sortedTreeNames(trees, name) {
+		tree := trees[treeName]
+		variables := variableSymbols(tree, content, actions)
+		if treeName == name {
+			roots = append(roots, variables...)
+			continue
+		}
+		for i, action := range actions {
+			keyword := action.Keyword()
+			if keyword != "define" && keyword != "block" {
+				continue
+			}
+			declared, ok := quotedActionArgument(action)
+			if !ok || declared != treeName {
+				continue
+			}
+			symbol := templateSymbol{Name: treeName, Kind: keyword, Children: variables}
+			symbol.setRange(content, action.Start, matchingEnd(actions, i))
+			if start, end, ok := quotedArgumentSpan(content, action); ok {
+				symbol.setName(content, start, end)
+			}
+			definitions = append(definitions, symbol)
+			break
+		}
+	}
+
+	// A block inside a define belongs to it; everything else is top level.
+	sort.Slice(definitions, func(i, j int) bool { return definitions[i].start < definitions[j].start })
+	var nest func(symbols []templateSymbol, symbol templateSymbol) []templateSymbol
+	nest = func(symbols []templateSymbol, symbol templateSymbol) []templateSymbol {
+		for i := range symbols {
+			if symbols[i].Kind != "variable" && symbols[i].start < symbol.start && symbol.end <= symbols[i].end {
+				symbols[i].Children = nest(symbols[i].Children, symbol)
+				return symbols
+			}
+		}
+		return append(symbols, symbol)
+	}
+	for _, symbol := range definitions {
+		roots = nest(roots, symbol)
+	}
+	sortSymbols(roots)
+	return roots
+}
+
+// variableSymbols lists the variables declared by actions at the top level
+// of tree, outside any if, with, or range.
+func variableSymbols(tree *parse.Tree, content string, actions []actionSpan) []templateSymbol {
+	var symbols []templateSymbol
+	if tree == nil || tree.Root == nil {
+		return nil
+	}
+	for _, node := range tree.Root.Nodes {
+		action, ok := node.(*parse.ActionNode)
+		if !ok || action.Pipe.IsAssign {
+			continue
+		}
+		for _, variable := range action.Pipe.Decl {
+			symbol := templateSymbol{Name: variable.Ident[0], Kind: "variable"}
+			start, end := int(action.Pos), int(action.Pos)
+			if span, ok := enclosingAction(actions, action.Pos); ok {
+				start, end = span.Start, span.End
+			}
+			symbol.setRange(content, start, end)
+			symbol.setName(content, int(variable.Pos), int(variable.Pos)+len(variable.Ident[0]))
+			symbols = append(symbols, symbol)
+		}
+	}
+	return symbols
+}
+
+func (s *templateSymbol) setRange(content string, start, end int) {
+	s.start, s.end = start, end
+	s.Line, s.Column = lineColumn(content, parse.Pos(start))
+	s.EndLine, s.EndColumn = lineColumn(content, parse.Pos(end))
+}
+
+func (s *templateSymbol) setName(content string, start, end int) {
+	s.NameLine, s.NameColumn = lineColumn(content, parse.Pos(start))
+	_, s.NameEndColumn = lineColumn(content, parse.Pos(end))
+}
+
+func sortSymbols(symbols []templateSymbol) {
+	sort.SliceStable(symbols, func(i, j int) bool { return symbols[i].start < symbols[j].start })
+	for i := range symbols {
+		sortSymbols(symbols[i].Children)
+	}
+}
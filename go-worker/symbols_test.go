@@ -0,0 +1,45 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSymbolsOutlinesDefinesBlocksAndTopLevelVariables(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "page.tmpl")
+	writeFile(t, templatePath, "{{ $title := .title }}{{ if .x }}{{ $hidden := 1 }}{{ end }}\n"+
+		"{{ define \"card\" }}{{ $name := .name }}\n"+
+		"{{ block \"footer\" . }}bye{{ end }}\n"+
+		"{{ end }}\n"+
+		"{{ block \"main\" . }}{{ .title }}{{ end }}")
+
+	resp := run(templatePath, "", renderOptions{Mode: "symbols"})
+	if resp.Error != "" || len(resp.Symbols) != 3 {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	title, card, main := resp.Symbols[0], resp.Symbols[1], resp.Symbols[2]
+	if title.Name != "$title" || title.Kind != "variable" || title.Line != 1 || title.Column != 1 || title.EndColumn != 23 || title.NameColumn != 4 || title.NameEndColumn != 10 {
+		t.Fatalf("unexpected variable symbol: %+v", title)
+	}
+	if card.Name != "card" || card.Kind != "define" || card.Line != 2 || card.EndLine != 4 || card.EndColumn != 10 || card.NameLine != 2 || card.NameColumn != 11 || card.NameEndColumn != 17 {
+		t.Fatalf("unexpected define symbol: %+v", card)
+	}
+	if len(card.Children) != 2 || card.Children[0].Name != "$name" || card.Children[1].Name != "footer" || card.Children[1].Kind != "block" || card.Children[1].Line != 3 {
+		t.Fatalf("unexpected define children: %+v", card.Children)
+	}
+	if main.Name != "main" || main.Kind != "block" || main.Line != 5 || len(main.Children) != 0 {
+		t.Fatalf("unexpected block symbol: %+v", main)
+	}
+}
+
+func TestSymbolsReportsParseErrors(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "page.tmpl")
+	writeFile(t, templatePath, "{{ define \"card\" }}\n{{ if }}{{ end }}")
+
+	resp := run(templatePath, "", renderOptions{Mode: "symbols"})
+	if resp.Error == "" || len(resp.Diagnostics) != 1 || resp.Diagnostics[0].Line != 2 || resp.Symbols != nil {
+		t.Fatalf("expected a parse diagnostic, got %+v", resp)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// hiddenTemplatePrefix starts the names of the templates the worker adds
+// itself, which are never offered as targets.
+const hiddenTemplatePrefix = "__goTemplateStudio"
+
+// validateTargetDefine rejects --target-define outside render mode, where
+// no template is executed.
+func validateTargetDefine(opts renderOptions) error {
+	if opts.TargetDefine == "" || opts.Mode == "" || opts.Mode == "render" {
+		return nil
+	}
+	return errors.New("--target-define only applies to render mode")
+}
+
+// undefinedTargetError names the defines and blocks a template and its
+// includes do have, so a misspelled target is quick to fix.
+func undefinedTargetError(name, root string, defined []string) error {
+	var targets []string
+	for _, candidate := range defined {
+		if candidate != root && !strings.HasPrefix(candidate, hiddenTemplatePrefix) {
+			targets = append(targets, candidate)
+		}
+	}
+	if len(targets) == 0 {
+		return fmt.Errorf("no define or block named %q: %s defines none", name, root)
+	}
+	sort.Strings(targets)
+	return fmt.Errorf("no define or block named %q (defined: %s)", name, strings.Join(targets, ", "))
+}
+
+// templateNames returns the names of templates, such as those of a
+// template set.
+func templateNames[T interface{ Name() string }](templates []T) []string {
+	names := make([]string, len(templates))
+	for i, tmpl := range templates {
+		names[i] = tmpl.Name()
+	}
+	return names
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestRunWithTargetDefineRendersOnlyThatBlock(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "page.tmpl")
+	includePath := filepath.Join(dir, "partials", "footer.tmpl")
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, templatePath, `<h1>{{ block "title" . }}{{ .title }}{{ end }}</h1>{{ range .rows }}{{ template "row" . }}{{ end }}
+{{- define "row" }}<li>{{ .name }}</li>{{ end }}`)
+	writeFile(t, includePath, `{{ define "footer" }}© {{ .owner }}{{ end }}`)
+	writeFile(t, contextPath, `{"title":"Mock","name":"Ada","owner":"ACME"}`)
+	opts := renderOptions{Includes: []string{filepath.Join(dir, "partials", "*.tmpl")}}
+
+	for target, want := range map[string]string{
+		"row":    "<li>Ada</li>",
+		"title":  "Mock",
+		"footer": "© ACME",
+	} {
+		opts.TargetDefine = target
+		if resp := run(templatePath, contextPath, opts); resp.Error != "" || resp.Rendered != want {
+			t.Fatalf("target %s: unexpected response %+v", target, resp)
+		}
+	}
+
+	opts.TargetDefine = "rows"
+	if resp := run(templatePath, contextPath, opts); resp.Error != `no define or block named "rows" (defined: footer, footer.tmpl, row, title)` {
+		t.Fatalf("expected the defined names to be listed, got %+v", resp)
+	}
+
+	opts.Mode = "check"
+	if resp := run(templatePath, contextPath, opts); resp.Error != "--target-define only applies to render mode" {
+		t.Fatalf("expected mode error, got %+v", resp)
+	}
+}
+
+func TestRunWithTargetDefineEscapesHTML(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "page.html")
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, templatePath, `{{ define "card" }}<p>{{ .name }}</p>{{ end }}`)
+	writeFile(t, contextPath, `{"name":"<b>"}`)
+
+	resp := run(templatePath, contextPath, renderOptions{TargetDefine: "card"})
+	if resp.Error != "" || resp.Rendered != "<p>&lt;b&gt;</p>" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	if resp := run(templatePath, contextPath, renderOptions{TargetDefine: "list"}); resp.Error != `no define or block named "list" (defined: card)` {
+		t.Fatalf("unexpected error: %+v", resp)
+	}
+}
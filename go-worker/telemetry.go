@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	telemetryOff   = "off"
+	telemetryLocal = "local"
+
+	topHelperCount = 10
+)
+
+// statsMu serializes read-modify-write cycles on the stats file when the
+// server renders concurrently.
+var statsMu sync.Mutex
+
+// usageStats is the local, opt-in usage record. It only ever holds counts;
+// no template names, paths, or content are stored.
+type usageStats struct {
+	Since     time.Time        `json:"since"`
+	UpdatedAt time.Time        `json:"updatedAt"`
+	Renders   map[string]int64 `json:"renders"`
+	Helpers   map[string]int64 `json:"helpers"`
+	Errors    map[string]int64 `json:"errors"`
+	// TopHelpers is derived when the stats are dumped and never stored.
+	TopHelpers []helperCount `json:"topHelpers,omitempty"`
+}
+
+type helperCount struct {
+	Name  string `json:"name"`
+	Count int64  `json:"count"`
+}
+
+func validateTelemetry(setting string) error {
+	switch setting {
+	case "", telemetryOff, telemetryLocal:
+		return nil
+	default:
+		return fmt.Errorf("unknown telemetry setting %q (expected off or local)", setting)
+	}
+}
+
+func statsPath(opts renderOptions) (string, error) {
+	if opts.StatsFile != "" {
+		return opts.StatsFile, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "go-template-studio", "stats.json"), nil
+}
+
+func readUsageStats(path string) (*usageStats, error) {
+	stats := &usageStats{Renders: map[string]int64{}, Helpers: map[string]int64{}, Errors: map[string]int64{}}
+
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return stats, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, stats); err != nil {
+		return nil, fmt.Errorf("stats file %s is corrupt: %w", path, err)
+	}
+	for _, counts := range []*map[string]int64{&stats.Renders, &stats.Helpers, &stats.Errors} {
+		if *counts == nil {
+			*counts = map[string]int64{}
+		}
+	}
+	return stats, nil
+}
+
+// recordUsage adds one render to the stats file. Telemetry must never break
+// a preview, so failures are silently dropped.
+func recordUsage(templatePath, content string, resp response, opts renderOptions) {
+	if opts.Telemetry != telemetryLocal {
+		return
+	}
+	path, err := statsPath(opts)
+	if err != nil {
+		return
+	}
+
+	statsMu.Lock()
+	defer statsMu.Unlock()
+
+	stats, err := readUsageStats(path)
+	if err != nil {
+		return
+	}
+
+	now := time.Now().UTC()
+	if stats.Since.IsZero() {
+		stats.Since = now
+	}
+	stats.UpdatedAt = now
+
+	engine := templateEngine(templatePath, opts)
+	stats.Renders[engine]++
+
+	if trees, err := parseTreesWithDelims(templateName(templatePath), content, opts.LeftDelim, opts.RightDelim); err == nil {
+		for name, calls := range calledFunctions(trees) {
+			stats.Helpers[name] += int64(len(calls))
+		}
+	}
+	if resp.Error != "" {
+		stats.Errors[errorCode(resp)]++
+	}
+
+	encoded, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil || os.MkdirAll(filepath.Dir(path), 0o755) != nil {
+		return
+	}
+	temp := path + ".tmp"
+	if os.WriteFile(temp, encoded, 0o600) == nil {
+		_ = os.Rename(temp, path)
+	}
+}
+
+// executeStats dumps the local stats file with the most-used helpers first.
+func executeStats(opts renderOptions) response {
+	path, err := statsPath(opts)
+	if err != nil {
+		return response{Error: err.Error()}
+	}
+
+	statsMu.Lock()
+	stats, err := readUsageStats(path)
+	statsMu.Unlock()
+	if err != nil {
+		return response{Error: err.Error()}
+	}
+
+	for name, count := range stats.Helpers {
+		stats.TopHelpers = append(stats.TopHelpers, helperCount{Name: name, Count: count})
+	}
+	sort.Slice(stats.TopHelpers, func(i, j int) bool {
+		if stats.TopHelpers[i].Count != stats.TopHelpers[j].Count {
+			return stats.TopHelpers[i].Count > stats.TopHelpers[j].Count
+		}
+		return stats.TopHelpers[i].Name < stats.TopHelpers[j].Name
+	})
+	if len(stats.TopHelpers) > topHelperCount {
+		stats.TopHelpers = stats.TopHelpers[:topHelperCount]
+	}
+
+	return response{Stats: stats}
+}
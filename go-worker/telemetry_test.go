@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTelemetryCountsRendersHelpersAndErrors(t *testing.T) {
+	dir := t.TempDir()
+	statsFile := filepath.Join(dir, "stats", "stats.json")
+	opts := renderOptions{Telemetry: telemetryLocal, StatsFile: statsFile}
+
+	textPath := filepath.Join(dir, "page.tmpl")
+	writeFile(t, textPath, `{{ upper "a" }}{{ upper "b" }}{{ lower "c" }}`)
+	htmlPath := filepath.Join(dir, "page.html")
+	writeFile(t, htmlPath, `{{ index .missing 3 }}`)
+	brokenContext := filepath.Join(dir, "broken.json")
+	writeFile(t, brokenContext, "{")
+
+	run(textPath, "", opts)
+	run(textPath, "", opts)
+	run(htmlPath, "", opts)
+	run(textPath, brokenContext, opts)
+
+	resp := run("", "", renderOptions{Mode: "stats", StatsFile: statsFile})
+	if resp.Error != "" || resp.Stats == nil {
+		t.Fatalf("unexpected stats response: %+v", resp)
+	}
+	stats := resp.Stats
+	if !reflect.DeepEqual(stats.Renders, map[string]int64{"text": 3, "html": 1}) {
+		t.Fatalf("unexpected render counts: %v", stats.Renders)
+	}
+	if !reflect.DeepEqual(stats.Errors, map[string]int64{errorCodeExecute: 1, errorCodeContext: 1}) {
+		t.Fatalf("unexpected error counts: %v", stats.Errors)
+	}
+	want := []helperCount{{"upper", 6}, {"lower", 3}, {"index", 1}}
+	if !reflect.DeepEqual(stats.TopHelpers, want) {
+		t.Fatalf("unexpected top helpers: %v", stats.TopHelpers)
+	}
+	if stats.Since.IsZero() || stats.UpdatedAt.Before(stats.Since) {
+		t.Fatalf("unexpected timestamps: %v %v", stats.Since, stats.UpdatedAt)
+	}
+}
+
+func TestTelemetryIsOffByDefault(t *testing.T) {
+	dir := t.TempDir()
+	statsFile := filepath.Join(dir, "stats.json")
+	templatePath := filepath.Join(dir, "page.tmpl")
+	writeFile(t, templatePath, "static")
+
+	run(templatePath, "", renderOptions{StatsFile: statsFile})
+	if _, err := os.Stat(statsFile); !os.IsNotExist(err) {
+		t.Fatalf("expected no stats file without --telemetry=local, got %v", err)
+	}
+
+	resp := run(templatePath, "", renderOptions{Telemetry: "remote"})
+	if resp.Error != `unknown telemetry setting "remote" (expected off or local)` {
+		t.Fatalf("expected invalid telemetry error, got %+v", resp)
+	}
+}
+
+func TestServeIgnoresARequestStatsFile(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "page.tmpl")
+	writeFile(t, templatePath, "static")
+	statsFile := filepath.Join(dir, "stats.json")
+	requested := filepath.Join(dir, "requested.json")
+
+	request := `{"id":1,"template":` + quoteJSON(templatePath) + `,"statsFile":` + quoteJSON(requested) + `}`
+	var output bytes.Buffer
+	if err := serve(strings.NewReader(request), &output, renderOptions{Telemetry: telemetryLocal, StatsFile: statsFile}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := os.Stat(requested); !os.IsNotExist(err) {
+		t.Fatalf("expected the request's stats file not to be written, got %v", err)
+	}
+	if _, err := os.Stat(statsFile); err != nil {
+		t.Fatalf("expected the command-line stats file to be written: %v", err)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxCachedTemplates bounds the server's parse cache; the least recently
+// used template is dropped first.
+const maxCachedTemplates = 128
+
+// renderTimings splits a render's time between parsing the template, which
+// a cache hit skips, and executing it.
+type renderTimings struct {
+	ParseMs   float64 `json:"parseMs"`
+	ExecuteMs float64 `json:"executeMs"`
+}
+
+// templateCache keeps the latest parse of each template path so a server
+// re-rendering the same source on every keystroke parses it once.
+type templateCache struct {
+	mu      sync.Mutex
+	entries map[string]*cachedTemplate
+	clock   uint64
+	// captures keeps the latest partial-mode capture of each template
+	// path.
+	captures map[string]*partialCapture
+}
+
+type cachedTemplate struct {
+	key  string
+	tmpl parsedTemplate
+	used uint64
+	// outputSize is the length of the template's last render, the size
+	// the next render's buffer starts at.
+	outputSize int
+}
+
+func newTemplateCache() *templateCache {
+	return &templateCache{entries: map[string]*cachedTemplate{}, captures: map[string]*partialCapture{}}
+}
+
+// load returns the template cached for path when it was parsed under key,
+// and otherwise parses it and caches the result. Failed parses are not
+// cached.
+func (c *templateCache) load(path, key string, parse func() (parsedTemplate, error)) (parsedTemplate, bool, error) {
+	c.mu.Lock()
+	c.clock++
+	if entry, ok := c.entries[path]; ok && entry.key == key {
+		entry.used = c.clock
+		c.mu.Unlock()
+		return entry.tmpl, true, nil
+	}
+	c.mu.Unlock()
+
+	tmpl, err := parse()
+	if err != nil {
+		return nil, false, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.clock++
+	if _, ok := c.entries[path]; !ok && len(c.entries) >= maxCachedTemplates {
+		c.evictOldest()
+	}
+	c.entries[path] = &cachedTemplate{key: key, tmpl: tmpl, used: c.clock}
+	return tmpl, false, nil
+}
+
+// outputHint is the length of the last render of path, or 0.
+func (c *templateCache) outputHint(path string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry, ok := c.entries[path]; ok {
+		return entry.outputSize
+	}
+	return 0
+}
+
+func (c *templateCache) rememberOutput(path string, size int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry, ok := c.entries[path]; ok {
+		entry.outputSize = size
+	}
+}
+
+func (c *templateCache) evictOldest() {
+	var oldest string
+	for path, entry := range c.entries {
+		if oldest == "" || entry.used < c.entries[oldest].used {
+			oldest = path
+		}
+	}
+	delete(c.entries, oldest)
+}
+
+// templateCacheKey hashes everything that changes how a template parses:
+// its source and includes, the delimiters, the missingkey option, the
+// engine, whether loops are instrumented, and the names of the functions it
+// may call.
+func templateCacheKey(content string, funcs map[string]interface{}, instrumented bool, opts renderOptions) string {
+	names := make([]string, 0, len(funcs))
+	for name := range funcs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	hash := sha256.New()
+	write := func(value string) {
+		hash.Write([]byte(strconv.Itoa(len(value))))
+		hash.Write([]byte{':'})
+		hash.Write([]byte(value))
+	}
+	write(content)
+	write(strconv.Itoa(len(opts.includes)))
+	for _, include := range opts.includes {
+		write(include.Name)
+		write(include.Content)
+	}
+	write(opts.LeftDelim)
+	write(opts.RightDelim)
+	write(opts.MissingKey)
+	write(opts.Engine)
+	write(strconv.FormatBool(instrumented))
+	for _, name := range names {
+		write(name)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// elapsedMs returns the time since start in milliseconds, to the
+// microsecond.
+func elapsedMs(start time.Time) float64 {
+	return float64(time.Since(start).Microseconds()) / 1000
+}
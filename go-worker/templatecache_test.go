@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestTemplateCacheReusesParseUntilSourceChanges(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "page.html")
+	writeFile(t, templatePath, `<p>{{ range .items }}{{ . }} {{ end }}</p>`)
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, contextPath, `{"items": ["a", "<b>"]}`)
+
+	opts := renderOptions{cache: newTemplateCache(), MaxIterations: 10}
+	first := executeWithOptions(templatePath, contextPath, opts)
+	second := executeWithOptions(templatePath, contextPath, opts)
+	if first.Error != "" || first.CacheHit || first.Timings == nil {
+		t.Fatalf("unexpected first render: %+v", first)
+	}
+	if second.Rendered != first.Rendered || !second.CacheHit || second.Rendered != "<p>a &lt;b&gt; </p>" {
+		t.Fatalf("expected a cached render identical to the first, got %+v", second)
+	}
+
+	writeFile(t, templatePath, `<p>{{ len .items }}</p>`)
+	third := executeWithOptions(templatePath, contextPath, opts)
+	if third.CacheHit || third.Rendered != "<p>2</p>" {
+		t.Fatalf("expected an edited template to be parsed again, got %+v", third)
+	}
+
+	opts.MaxIterations = 1
+	writeFile(t, templatePath, `{{ range .items }}{{ . }}{{ end }}`)
+	executeWithOptions(templatePath, contextPath, renderOptions{cache: opts.cache})
+	limited := executeWithOptions(templatePath, contextPath, opts)
+	if limited.CacheHit || !strings.Contains(limited.Error, "iteration limit") {
+		t.Fatalf("expected options that change parsing to miss the cache, got %+v", limited)
+	}
+}
+
+func TestTemplateCacheIsSafeForConcurrentRenders(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "page.html")
+	writeFile(t, templatePath, `{{ define "item" }}<li>{{ . }}</li>{{ end }}<ul>{{ range .items }}{{ template "item" . }}{{ end }}</ul>`)
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, contextPath, `{"items": ["x", "y"]}`)
+
+	opts := renderOptions{cache: newTemplateCache(), Timeout: "5s"}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if resp := executeWithOptions(templatePath, contextPath, opts); resp.Rendered != "<ul><li>x</li><li>y</li></ul>" {
+				t.Errorf("unexpected render: %+v", resp)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestTemplateCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := newTemplateCache()
+	parse := func() (parsedTemplate, error) { return textTemplate{}, nil }
+	for i := 0; i < maxCachedTemplates; i++ {
+		cache.load(strconv.Itoa(i), "key", parse)
+	}
+	cache.load("0", "key", parse)
+	cache.load("new", "key", parse)
+
+	if _, hit, _ := cache.load("0", "key", parse); !hit {
+		t.Fatal("expected the recently used template to stay cached")
+	}
+	if _, hit, _ := cache.load("1", "key", parse); hit {
+		t.Fatal("expected the least recently used template to be evicted")
+	}
+}
+
+func TestServeReportsCacheHitsAndTimings(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "greet.tmpl")
+	writeFile(t, templatePath, "Hello {{ .name }}")
+
+	var output bytes.Buffer
+	request := `{"template":` + quoteJSON(templatePath) + `,"responseVersion":2}` + "\n"
+	if err := serve(strings.NewReader(request), &output, renderOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var payload struct {
+		CacheHit bool `json:"cacheHit"`
+		Timings  struct {
+			TotalMs   *int64   `json:"totalMs"`
+			ParseMs   *float64 `json:"parseMs"`
+			ExecuteMs *float64 `json:"executeMs"`
+		} `json:"timings"`
+	}
+	if err := json.Unmarshal(output.Bytes(), &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.CacheHit || payload.Timings.TotalMs == nil || payload.Timings.ParseMs == nil || payload.Timings.ExecuteMs == nil {
+		t.Fatalf("expected split timings, got %s", output.String())
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// templateProfileKey is the context key a template reads the selected
+// template profile from, as {{ .Profile }}.
+const templateProfileKey = "Profile"
+
+// templateProfile is a named variant of the workspace's templates: its
+// includes are parsed after the --include globs, so their defines
+// override the shared ones.
+type templateProfile struct {
+	// Includes are globs, or directories standing for every file in them,
+	// relative to the workspace root.
+	Includes []string `json:"includes,omitempty"`
+}
+
+// resolveIncludeGlob resolves a profile include against the workspace root
+// and turns a directory into a glob of its files.
+func (c *projectConfig) resolveIncludeGlob(include string) string {
+	resolved := c.resolvePath(include)
+	if strings.HasSuffix(include, "/") {
+		return filepath.Join(resolved, "*")
+	}
+	if info, err := os.Stat(resolved); err == nil && info.IsDir() {
+		return filepath.Join(resolved, "*")
+	}
+	return resolved
+}
+
+// applyTemplateProfile adds the includes of opts.TemplateProfile to
+// opts.Includes. The profile must be defined in the project config.
+func applyTemplateProfile(opts *renderOptions) error {
+	name := strings.TrimSpace(opts.TemplateProfile)
+	if name == "" {
+		return nil
+	}
+	var profiles map[string]templateProfile
+	if opts.project != nil {
+		profiles = opts.project.TemplateProfiles
+	}
+	profile, ok := profiles[name]
+	if !ok {
+		known := make([]string, 0, len(profiles))
+		for defined := range profiles {
+			known = append(known, defined)
+		}
+		sort.Strings(known)
+		if len(known) == 0 {
+			return fmt.Errorf("template profile %q is not defined: the project config has no templateProfiles", name)
+		}
+		return fmt.Errorf("template profile %q is not defined; the project config defines %s", name, strings.Join(known, ", "))
+	}
+	opts.Includes = append(append([]string{}, opts.Includes...), profile.Includes...)
+	return nil
+}
+
+// withTemplateProfile sets .Profile on a map context to the selected
+// profile, unless the context already has one.
+func withTemplateProfile(data interface{}, opts renderOptions) interface{} {
+	name := strings.TrimSpace(opts.TemplateProfile)
+	root, ok := data.(map[string]interface{})
+	if name == "" || !ok {
+		return data
+	}
+	if _, exists := root[templateProfileKey]; exists {
+		return data
+	}
+	copied := make(map[string]interface{}, len(root)+1)
+	for key, value := range root {
+		copied[key] = value
+	}
+	copied[templateProfileKey] = name
+	return copied
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTemplateProfileAddsIncludesAndExposesItsName(t *testing.T) {
+	root := t.TempDir()
+	configPath := filepath.Join(root, ".vscode", "goTemplateStudio.json")
+	writeFile(t, configPath, `{"templateProfiles": {"prod": {"includes": ["prod-overrides/"]}, "dev": {}}}`)
+	writeFile(t, filepath.Join(root, "prod-overrides", "banner.tmpl"), `{{ define "banner" }}LIVE{{ end }}`)
+	writeFile(t, filepath.Join(root, "shared", "banner.tmpl"), `{{ define "banner" }}test{{ end }}`)
+	templatePath := filepath.Join(root, "page.tmpl")
+	writeFile(t, templatePath, `{{ template "banner" }} {{ .Profile }}`)
+	shared := []string{filepath.Join(root, "shared", "*.tmpl")}
+
+	resp := run(templatePath, "", renderOptions{Config: configPath, Includes: shared, TemplateProfile: "prod"})
+	if resp.Error != "" || resp.Rendered != "LIVE prod" {
+		t.Fatalf("expected the prod overrides, got %+v", resp)
+	}
+	resp = run(templatePath, "", renderOptions{Config: configPath, Includes: shared, TemplateProfile: "dev"})
+	if resp.Error != "" || resp.Rendered != "test dev" {
+		t.Fatalf("expected the shared banner, got %+v", resp)
+	}
+
+	contextPath := filepath.Join(root, "context.json")
+	writeFile(t, contextPath, `{"Profile": "from context"}`)
+	if resp := run(templatePath, contextPath, renderOptions{Config: configPath, Includes: shared, TemplateProfile: "dev"}); resp.Rendered != "test from context" {
+		t.Fatalf("expected the context to keep its own Profile, got %+v", resp)
+	}
+
+	resp = run(templatePath, "", renderOptions{Config: configPath, TemplateProfile: "staging"})
+	if !strings.Contains(resp.Error, `template profile "staging" is not defined; the project config defines dev, prod`) {
+		t.Fatalf("expected an unknown profile to fail, got %+v", resp)
+	}
+	if resp := run(templatePath, "", renderOptions{TemplateProfile: "prod"}); !strings.Contains(resp.Error, "has no templateProfiles") {
+		t.Fatalf("expected a profile without a config to fail, got %+v", resp)
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// defaultTestManifest is the manifest `go-worker test` reads when
+// --manifest is not given.
+const defaultTestManifest = "template-tests.json"
+
+// testManifest pairs templates with contexts and expected output. Paths are
+// relative to the manifest's directory. Options holds renderOptions fields
+// applied to every test, which a test's own options override.
+type testManifest struct {
+	Options json.RawMessage `json:"options,omitempty"`
+	Tests   []templateTest  `json:"tests"`
+}
+
+// templateTest is one case: the template rendered against Context must
+// write what Expected holds, or fail with an error containing ExpectError.
+type templateTest struct {
+	Name        string          `json:"name,omitempty"`
+	Template    string          `json:"template"`
+	Context     string          `json:"context,omitempty"`
+	Expected    string          `json:"expected,omitempty"`
+	ExpectError string          `json:"expectError,omitempty"`
+	Options     json.RawMessage `json:"options,omitempty"`
+}
+
+// testReport is the outcome of `go-worker test`.
+type testReport struct {
+	Manifest string       `json:"manifest"`
+	Tests    int          `json:"tests"`
+	Passed   int          `json:"passed"`
+	Failed   int          `json:"failed"`
+	Results  []testResult `json:"results"`
+}
+
+// testResult covers one case. Diff is a unified diff from the expected
+// file to the render; Updated reports that --update rewrote the file.
+type testResult struct {
+	Name        string       `json:"name"`
+	Template    string       `json:"template"`
+	Context     string       `json:"context,omitempty"`
+	Expected    string       `json:"expected,omitempty"`
+	Passed      bool         `json:"passed"`
+	Updated     bool         `json:"updated,omitempty"`
+	Diagnostics []diagnostic `json:"diagnostics,omitempty"`
+	Error       string       `json:"error,omitempty"`
+	Diff        string       `json:"diff,omitempty"`
+}
+
+// runTests implements `go-worker test`: it renders every case of the
+// manifest in parallel, through the same path as the preview, and compares
+// each render with its expected file. Like check-all, the process exits
+// non-zero when a case failed; see testExitCode.
+func runTests(args []string) response {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	manifestPath := flags.String("manifest", defaultTestManifest, "JSON manifest pairing templates, contexts, and expected-output files")
+	jobs := flags.Int("jobs", runtime.NumCPU(), "How many cases to render at once (defaults to --max-cpus)")
+	filter := flags.String("run", "", "Only run cases whose name matches this regular expression")
+	update := flags.Bool("update", false, "Rewrite each expected file with the current output instead of comparing")
+	cpu := addCPUFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return response{Error: "test: " + err.Error()}
+	}
+	if err := cpu.apply(); err != nil {
+		return response{Error: "test: " + err.Error()}
+	}
+	defaultJobs(flags, jobs)
+	if *jobs < 1 {
+		return response{Error: "test: --jobs must be at least 1"}
+	}
+	var match *regexp.Regexp
+	if *filter != "" {
+		var err error
+		if match, err = regexp.Compile(*filter); err != nil {
+			return response{Error: "test: --run: " + err.Error()}
+		}
+	}
+
+	report, err := runTestManifest(*manifestPath, *jobs, match, *update)
+	if err != nil {
+		return response{Error: "test: " + err.Error()}
+	}
+	return response{TestRun: report}
+}
+
+// testExitCode is 0 when every case passed, 1 when any failed, and 2 when
+// the manifest could not be run.
+func testExitCode(resp response) int {
+	switch {
+	case resp.TestRun == nil:
+		return 2
+	case resp.TestRun.Failed > 0:
+		return 1
+	}
+	return 0
+}
+
+func runTestManifest(manifestPath string, jobs int, match *regexp.Regexp, update bool) (*testReport, error) {
+	manifestBytes, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	var manifest testManifest
+	if err := json.Unmarshal(manifestBytes, &manifest); err != nil {
+		return nil, fmt.Errorf("manifest %s is not valid JSON: %v", manifestPath, err)
+	}
+	var defaults renderOptions
+	if len(manifest.Options) > 0 {
+		if err := json.Unmarshal(manifest.Options, &defaults); err != nil {
+			return nil, fmt.Errorf("manifest options: %v", err)
+		}
+	}
+
+	dir := filepath.Dir(manifestPath)
+	var tests []templateTest
+	for i, test := range manifest.Tests {
+		if strings.TrimSpace(test.Template) == "" {
+			return nil, fmt.Errorf("test %d has no template", i+1)
+		}
+		if test.Expected == "" && test.ExpectError == "" {
+			return nil, fmt.Errorf("test %d needs expected or expectError", i+1)
+		}
+		if test.Name == "" {
+			test.Name = test.Template
+			if test.Context != "" {
+				test.Name += " with " + test.Context
+			}
+		}
+		if match == nil || match.MatchString(test.Name) {
+			tests = append(tests, test)
+		}
+	}
+
+	report := &testReport{Manifest: manifestPath, Tests: len(tests), Results: make([]testResult, len(tests))}
+	var wg sync.WaitGroup
+	next := make(chan int)
+	for worker := 0; worker < min(jobs, len(tests)); worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				report.Results[i] = runTemplateTest(dir, tests[i], defaults, update)
+			}
+		}()
+	}
+	for i := range tests {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	for _, result := range report.Results {
+		if result.Passed {
+			report.Passed++
+		} else {
+			report.Failed++
+		}
+	}
+	return report, nil
+}
+
+func runTemplateTest(dir string, test templateTest, defaults renderOptions, update bool) testResult {
+	result := testResult{Name: test.Name, Template: test.Template, Context: test.Context, Expected: test.Expected}
+	resolve := func(path string) string {
+		if path == "" || filepath.IsAbs(path) || isRemoteURL(path) || isObjectStoreURL(path) {
+			return path
+		}
+		return filepath.Join(dir, filepath.FromSlash(path))
+	}
+
+	// Decoding over a copy of the defaults lets a test override them.
+	opts := defaults
+	opts.Includes = append([]string{}, defaults.Includes...)
+	opts.ContextLayers = append([]string{}, defaults.ContextLayers...)
+	opts.RenamedFuncs = cloneStringMap(defaults.RenamedFuncs)
+	if len(test.Options) > 0 {
+		if err := json.Unmarshal(test.Options, &opts); err != nil {
+			result.Error = "options: " + err.Error()
+			return result
+		}
+	}
+	opts.Mode = "render"
+	opts.Config = resolve(opts.Config)
+	for i := range opts.Includes {
+		opts.Includes[i] = resolve(opts.Includes[i])
+	}
+	for i := range opts.ContextLayers {
+		opts.ContextLayers[i] = resolve(opts.ContextLayers[i])
+	}
+
+	rendered := run(resolve(test.Template), resolve(test.Context), opts)
+	result.Diagnostics = rendered.Diagnostics
+	if test.ExpectError != "" {
+		switch {
+		case rendered.Error == "":
+			result.Error = fmt.Sprintf("expected an error containing %q, but the render succeeded", test.ExpectError)
+		case !strings.Contains(rendered.Error, test.ExpectError):
+			result.Error = fmt.Sprintf("expected an error containing %q, got: %s", test.ExpectError, rendered.Error)
+		default:
+			result.Passed = true
+		}
+		return result
+	}
+	if rendered.Error != "" {
+		result.Error = rendered.Error
+		return result
+	}
+
+	expectedPath := resolve(test.Expected)
+	if update {
+		expected, err := os.ReadFile(expectedPath)
+		if err != nil || !bytes.Equal(expected, []byte(rendered.Rendered)) {
+			if err := os.MkdirAll(filepath.Dir(expectedPath), 0o755); err != nil {
+				result.Error = err.Error()
+				return result
+			}
+			if err := os.WriteFile(expectedPath, []byte(rendered.Rendered), 0o644); err != nil {
+				result.Error = err.Error()
+				return result
+			}
+			result.Updated = true
+		}
+		result.Passed = true
+		return result
+	}
+	expected, err := os.ReadFile(expectedPath)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Diff = unifiedDiff(test.Expected, test.Template, string(expected), rendered.Rendered)
+	if result.Diff != "" {
+		result.Error = fmt.Sprintf("output differs from %s", test.Expected)
+		return result
+	}
+	result.Passed = true
+	return result
+}
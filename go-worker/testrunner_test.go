@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunTestsComparesRendersWithExpectedFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "templates", "greet.tmpl"), "Hello {{ .name }}{{ if .vip }}!{{ end }}\n")
+	writeFile(t, filepath.Join(dir, "templates", "shout.tmpl"), "{{ upper .name }}")
+	writeFile(t, filepath.Join(dir, "ctx", "ada.json"), `{"name": "Ada"}`)
+	writeFile(t, filepath.Join(dir, "ctx", "vip.json"), `{"vip": true}`)
+	writeFile(t, filepath.Join(dir, "golden", "ada.txt"), "Hello Ada\n")
+	writeFile(t, filepath.Join(dir, "golden", "vip.txt"), "Hello Ada\n")
+	writeFile(t, filepath.Join(dir, "golden", "shout.txt"), "ADA")
+	manifestPath := filepath.Join(dir, "template-tests.json")
+	writeFile(t, manifestPath, `{
+		"options": {"funcs": "sprig"},
+		"tests": [
+			{"template": "templates/greet.tmpl", "context": "ctx/ada.json", "expected": "golden/ada.txt"},
+			{"name": "vip", "template": "templates/greet.tmpl", "context": "ctx/ada.json", "expected": "golden/vip.txt", "options": {"contextLayers": ["ctx/vip.json"]}},
+			{"name": "shout", "template": "templates/shout.tmpl", "context": "ctx/ada.json", "expected": "golden/shout.txt"},
+			{"name": "strict", "template": "templates/greet.tmpl", "expectError": "map has no entry for key \"name\"", "options": {"missingKey": "error"}}
+		]
+	}`)
+
+	resp := runTests([]string{"--manifest", manifestPath, "--jobs", "2"})
+	report := resp.TestRun
+	if resp.Error != "" || report == nil {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	if report.Tests != 4 || report.Passed != 3 || report.Failed != 1 || testExitCode(resp) != 1 {
+		t.Fatalf("unexpected totals: %+v", report)
+	}
+	ada, vip := report.Results[0], report.Results[1]
+	if ada.Name != "templates/greet.tmpl with ctx/ada.json" || !ada.Passed {
+		t.Fatalf("expected the default case to pass, got %+v", ada)
+	}
+	if vip.Passed || vip.Error != "output differs from golden/vip.txt" || !strings.Contains(vip.Diff, "+Hello Ada!") {
+		t.Fatalf("expected the vip case to fail with a diff, got %+v", vip)
+	}
+
+	resp = runTests([]string{"--manifest", manifestPath, "--run", "^vip$", "--update"})
+	if resp.TestRun.Tests != 1 || !resp.TestRun.Results[0].Updated || testExitCode(resp) != 0 {
+		t.Fatalf("expected --update to rewrite the vip case, got %+v", resp.TestRun)
+	}
+	if updated, _ := os.ReadFile(filepath.Join(dir, "golden", "vip.txt")); string(updated) != "Hello Ada!\n" {
+		t.Fatalf("unexpected updated file %q", updated)
+	}
+	if resp := runTests([]string{"--manifest", manifestPath}); testExitCode(resp) != 0 {
+		t.Fatalf("expected every case to pass after the update, got %+v", resp.TestRun)
+	}
+}
+
+func TestRunTestsRejectsBadManifests(t *testing.T) {
+	dir := t.TempDir()
+	manifestPath := filepath.Join(dir, "tests.json")
+	for _, manifest := range []string{`{`, `{"tests": [{"expected": "a.txt"}]}`, `{"tests": [{"template": "a.tmpl"}]}`} {
+		writeFile(t, manifestPath, manifest)
+		if resp := runTests([]string{"--manifest", manifestPath}); testExitCode(resp) != 2 || resp.Error == "" {
+			t.Errorf("expected %s to be rejected, got %+v", manifest, resp)
+		}
+	}
+	if resp := runTests([]string{"--manifest", filepath.Join(dir, "missing.json")}); testExitCode(resp) != 2 {
+		t.Fatalf("expected a missing manifest to be rejected, got %+v", resp)
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template/parse"
+)
+
+const (
+	// traceFunc is the hidden helper a traced template calls at every step.
+	traceFunc = "__goTemplateStudioTrace"
+	// maxTraceEvents bounds a trace; a final truncated event marks the cut.
+	maxTraceEvents = 10000
+	// maxTraceValueBytes bounds the JSON of one traced value.
+	maxTraceValueBytes = 2048
+)
+
+// traceEvent is one step of a traced execution:
+//
+//   - action: an output action is about to run; Output is what it wrote.
+//   - assign: a variable was declared or assigned; Vars holds its value.
+//   - if, with, range: a control structure is about to evaluate its
+//     pipeline, followed by then, iteration, or else for the branch taken.
+//   - template: a {{template}} call is about to run.
+//   - truncated: the trace reached its event limit.
+//
+// Dot is the value of dot at that step.
+type traceEvent struct {
+	Seq     int                        `json:"seq"`
+	Event   string                     `json:"event"`
+	File    string                     `json:"file,omitempty"`
+	Line    int                        `json:"line,omitempty"`
+	Column  int                        `json:"column,omitempty"`
+	Source  string                     `json:"source,omitempty"`
+	Dot     json.RawMessage            `json:"dot,omitempty"`
+	DotType string                     `json:"dotType,omitempty"`
+	Vars    map[string]json.RawMessage `json:"vars,omitempty"`
+	Output  *string                    `json:"output,omitempty"`
+}
+
+// instrumentTrace inserts traceFunc calls around every action and control
+// structure of tree. Each call carries "event|start|end|template|vars",
+// the event, the source span of the action, the name of the source the tree
+// was parsed from, and the variables to report; dot and those variables are
+// passed as arguments. If, with, and range get an else branch when they
+// have none, so the trace shows which branch ran even when nothing was
+// written.
+func instrumentTrace(tree *parse.Tree, sources map[string]string, leftDelim, rightDelim string) {
+	if tree == nil {
+		return
+	}
+	content, ok := sources[tree.ParseName]
+	if !ok {
+		return
+	}
+	tracer := treeTracer{tree: tree, actions: scanActions(content, leftDelim, rightDelim)}
+	tracer.list(tree.Root)
+}
+
+type treeTracer struct {
+	tree    *parse.Tree
+	actions []actionSpan
+}
+
+func (t treeTracer) list(list *parse.ListNode) {
+	if list == nil {
+		return
+	}
+	nodes := make([]parse.Node, 0, 2*len(list.Nodes))
+	for _, node := range list.Nodes {
+		switch typed := node.(type) {
+		case *parse.ActionNode:
+			if len(typed.Pipe.Decl) == 0 {
+				nodes = append(nodes, t.call("action", typed.Pos, nil), node)
+				continue
+			}
+			nodes = append(nodes, node, t.call("assign", typed.Pos, typed.Pipe.Decl))
+			continue
+		case *parse.IfNode:
+			t.branches(&typed.BranchNode, "then")
+			nodes = append(nodes, t.call("if", typed.Pos, nil))
+		case *parse.WithNode:
+			t.branches(&typed.BranchNode, "then")
+			nodes = append(nodes, t.call("with", typed.Pos, nil))
+		case *parse.RangeNode:
+			t.branches(&typed.BranchNode, "iteration")
+			nodes = append(nodes, t.call("range", typed.Pos, nil))
+		case *parse.TemplateNode:
+			nodes = append(nodes, t.call("template", typed.Pos, nil))
+		}
+		nodes = append(nodes, node)
+	}
+	list.Nodes = nodes
+}
+
+// branches traces the start of both branches of a control structure. The
+// body reports the variables its pipeline declares.
+func (t treeTracer) branches(branch *parse.BranchNode, taken string) {
+	t.list(branch.List)
+	t.list(branch.ElseList)
+	if branch.List != nil {
+		branch.List.Nodes = append([]parse.Node{t.call(taken, branch.Pos, branch.Pipe.Decl)}, branch.List.Nodes...)
+	}
+	if branch.ElseList == nil {
+		branch.ElseList = &parse.ListNode{NodeType: parse.NodeList, Pos: branch.Pos}
+	}
+	branch.ElseList.Nodes = append([]parse.Node{t.call("else", branch.Pos, nil)}, branch.ElseList.Nodes...)
+}
+
+// call builds {{ $traceFunc := traceFunc "span" . $vars... }}.
+func (t treeTracer) call(event string, pos parse.Pos, vars []*parse.VariableNode) *parse.ActionNode {
+	start, end := int(pos), int(pos)
+	if span, ok := enclosingAction(t.actions, pos); ok {
+		start, end = span.Start, span.End
+	}
+	names := make([]string, len(vars))
+	args := []parse.Node{
+		parse.NewIdentifier(traceFunc).SetTree(t.tree).SetPos(pos),
+		nil,
+		&parse.DotNode{NodeType: parse.NodeDot, Pos: pos},
+	}
+	for i, variable := range vars {
+		names[i] = variable.Ident[0]
+		args = append(args, &parse.VariableNode{NodeType: parse.NodeVariable, Pos: pos, Ident: []string{variable.Ident[0]}})
+	}
+	span := fmt.Sprintf("%s|%d|%d|%s|%s", event, start, end, t.tree.ParseName, strings.Join(names, ","))
+	args[1] = &parse.StringNode{NodeType: parse.NodeString, Pos: pos, Quoted: strconv.Quote(span), Text: span}
+	return &parse.ActionNode{
+		NodeType: parse.NodeAction,
+		Pos:      pos,
+		Pipe: &parse.PipeNode{
+			NodeType: parse.NodePipe,
+			Pos:      pos,
+			Decl:     []*parse.VariableNode{{NodeType: parse.NodeVariable, Pos: pos, Ident: []string{"$" + traceFunc}}},
+			Cmds:     []*parse.CommandNode{{NodeType: parse.NodeCommand, Pos: pos, Args: args}},
+		},
+	}
+}
+
+// traceRecorder collects the events of one render. With a sink, each event
+// is handed over as soon as the output it wrote is known instead of being
+// kept.
+type traceRecorder struct {
+	mu      sync.Mutex
+	out     io.Writer
+	sources map[string]templateSource
+	// encoding is the --position-encoding columns are reported in.
+	encoding string
+	sink     func(traceEvent)
+	events   []traceEvent
+	pending  *traceEvent
+	count    int
+	// done stops a render that outlived its timeout from adding events
+	// after the response went out.
+	done bool
+}
+
+func newTraceRecorder(sources map[string]templateSource, encoding string, sink func(traceEvent)) *traceRecorder {
+	return &traceRecorder{sources: sources, encoding: encoding, sink: sink}
+}
+
+func (r *traceRecorder) Write(p []byte) (int, error) {
+	n, err := r.out.Write(p)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// An action prints its value with a single write, even when empty, so
+	// the first write after an action event is that action's output.
+	if r.pending != nil && !r.done {
+		output := string(p[:n])
+		r.pending.Output = &output
+		r.flush()
+	}
+	return n, err
+}
+
+// trace is registered as traceFunc.
+func (r *traceRecorder) trace(span string, dot interface{}, vars ...interface{}) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.done {
+		return ""
+	}
+	r.flush()
+	if r.count > maxTraceEvents {
+		return ""
+	}
+	r.count++
+	if r.count > maxTraceEvents {
+		r.emit(traceEvent{Seq: r.count, Event: "truncated"})
+		return ""
+	}
+
+	event := r.decode(span, vars)
+	event.Seq = r.count
+	event.Dot, event.DotType = traceValue(dot), fmt.Sprintf("%T", dot)
+	if event.Event == "action" {
+		r.pending = &event
+		return ""
+	}
+	r.emit(event)
+	return ""
+}
+
+// finish flushes the last action and returns the events kept. An action
+// that failed is reported without output.
+func (r *traceRecorder) finish() []traceEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.flush()
+	r.done = true
+	return r.events
+}
+
+func (r *traceRecorder) flush() {
+	if r.pending == nil {
+		return
+	}
+	r.emit(*r.pending)
+	r.pending = nil
+}
+
+func (r *traceRecorder) emit(event traceEvent) {
+	if r.sink != nil {
+		r.sink(event)
+		return
+	}
+	r.events = append(r.events, event)
+}
+
+func (r *traceRecorder) decode(span string, values []interface{}) traceEvent {
+	parts := strings.SplitN(span, "|", 5)
+	if len(parts) != 5 {
+		return traceEvent{Event: span}
+	}
+	event := traceEvent{Event: parts[0]}
+	start, _ := strconv.Atoi(parts[1])
+	end, _ := strconv.Atoi(parts[2])
+	if source, ok := r.sources[parts[3]]; ok && end <= len(source.Content) {
+		event.File = source.Path
+		event.Line, event.Column = lineColumn(source.Content, parse.Pos(start))
+		// Streamed events never pass through applyPositionEncoding, so
+		// columns are converted here for both kinds of trace.
+		if r.encoding != "" && r.encoding != positionEncodingUTF8 {
+			event.Column = encodeColumn(lineText(source.Content, event.Line), event.Column, r.encoding)
+		}
+		event.Source = source.Content[start:end]
+	}
+	if parts[4] != "" {
+		event.Vars = map[string]json.RawMessage{}
+		for i, name := range strings.Split(parts[4], ",") {
+			if i < len(values) {
+				event.Vars[name] = traceValue(values[i])
+			}
+		}
+	}
+	return event
+}
+
+// traceValue encodes value as JSON. Values JSON cannot encode, such as
+// functions, fall back to their fmt form, and large values are cut short
+// into a string preview.
+func traceValue(value interface{}) json.RawMessage {
+	encoded, err := encodeJSON("trace", value, "")
+	if err != nil {
+		encoded, _ = encodeJSON("trace", fmt.Sprintf("%v", value), "")
+	}
+	if len(encoded) > maxTraceValueBytes {
+		encoded, _ = encodeJSON("trace", strings.ToValidUTF8(encoded[:maxTraceValueBytes], "")+"…", "")
+	}
+	return json.RawMessage(encoded)
+}
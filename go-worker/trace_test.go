@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTraceRecordsActionsBranchesAndAssignments(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "page.html")
+	writeFile(t, templatePath, "{{ $n := .name }}Hi {{ $n }}!\n{{ with .missing }}x{{ end }}{{ range $i, $v := .items }}[{{ $v }}]{{ end }}")
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, contextPath, `{"name": "A & B", "items": ["x"]}`)
+
+	resp := run(templatePath, contextPath, renderOptions{Trace: true})
+	if resp.Error != "" || resp.Rendered != "Hi A &amp; B!\n[x]" {
+		t.Fatalf("unexpected render: %+v", resp)
+	}
+
+	var steps []string
+	for _, event := range resp.Trace {
+		steps = append(steps, event.Event+" "+event.Source)
+	}
+	want := []string{
+		"assign {{ $n := .name }}",
+		"action {{ $n }}",
+		"with {{ with .missing }}",
+		"else {{ with .missing }}",
+		"range {{ range $i, $v := .items }}",
+		"iteration {{ range $i, $v := .items }}",
+		"action {{ $v }}",
+	}
+	if !reflect.DeepEqual(steps, want) {
+		t.Fatalf("expected steps %q, got %q", want, steps)
+	}
+
+	assign := resp.Trace[0]
+	if assign.File != templatePath || assign.Line != 1 || assign.Column != 1 || string(assign.Vars["$n"]) != `"A & B"` {
+		t.Fatalf("unexpected assign event: %+v", assign)
+	}
+	if output := resp.Trace[1].Output; output == nil || *output != "A &amp; B" {
+		t.Fatalf("expected the action's escaped output, got %+v", resp.Trace[1])
+	}
+	iteration := resp.Trace[5]
+	if string(iteration.Dot) != `"x"` || iteration.DotType != "string" || string(iteration.Vars["$i"]) != "0" {
+		t.Fatalf("unexpected iteration event: %+v", iteration)
+	}
+}
+
+func TestTraceKeepsStepsOfFailedRender(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "page.tmpl")
+	writeFile(t, templatePath, "{{ .a }}{{ index .list 5 }}")
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, contextPath, `{"a": 1, "list": []}`)
+
+	resp := run(templatePath, contextPath, renderOptions{Trace: true})
+	if resp.Error == "" || len(resp.Trace) != 2 {
+		t.Fatalf("expected an error with two steps, got %+v", resp)
+	}
+	if failed := resp.Trace[1]; failed.Source != "{{ index .list 5 }}" || failed.Output != nil {
+		t.Fatalf("expected the failing action without output, got %+v", failed)
+	}
+}
+
+func TestServeStreamsTraceEventsBeforeResponse(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "greet.tmpl")
+	writeFile(t, templatePath, "Hello {{ .name }}")
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, contextPath, `{"name": "Ada"}`)
+
+	request := `{"id": 7, "trace": true, "template": ` + quoteJSON(templatePath) + `, "context": ` + quoteJSON(contextPath) + `}`
+	var output bytes.Buffer
+	if err := serve(strings.NewReader(request), &output, renderOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected a trace event and a response, got %s", output.String())
+	}
+	var message traceMessage
+	if err := json.Unmarshal([]byte(lines[0]), &message); err != nil || string(message.ID) != "7" || message.TraceEvent.Event != "action" {
+		t.Fatalf("unexpected trace line %s (%v)", lines[0], err)
+	}
+	var resp serverResponse
+	if err := json.Unmarshal([]byte(lines[1]), &resp); err != nil || resp.Rendered != "Hello Ada" || len(resp.Trace) != 0 {
+		t.Fatalf("expected the response without the streamed trace, got %s", lines[1])
+	}
+}
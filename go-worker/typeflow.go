@@ -0,0 +1,403 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"text/template/parse"
+)
+
+// valueType is the shape of a context value as far as static checks can
+// tell. A nil *valueType is unknown and never produces a warning.
+type valueType struct {
+	Kind   string
+	Elem   *valueType
+	Fields map[string]*valueType
+}
+
+const (
+	kindString = "string"
+	kindNumber = "number"
+	kindBool   = "bool"
+	kindMap    = "map"
+	kindList   = "list"
+)
+
+// builtinArity bounds the argument counts of the builtins that take a fixed
+// number; max < 0 means variadic.
+var builtinArity = map[string][2]int{
+	"not":   {1, 1},
+	"len":   {1, 1},
+	"eq":    {2, -1},
+	"ne":    {2, 2},
+	"lt":    {2, 2},
+	"le":    {2, 2},
+	"gt":    {2, 2},
+	"ge":    {2, 2},
+	"and":   {1, -1},
+	"or":    {1, -1},
+	"index": {1, -1},
+	"slice": {1, -1},
+	"call":  {1, -1},
+}
+
+// listParams names helpers that take a list, by argument index.
+var listParams = map[string]int{"join": 1}
+
+// arithmeticFuncs take numbers. They coerce strings when they can, which
+// hides data that is the wrong type.
+var arithmeticFuncs = map[string]bool{
+	"add": true, "add1": true, "sub": true, "mul": true, "div": true, "mod": true,
+	"max": true, "min": true, "floor": true, "ceil": true, "round": true,
+	"addf": true, "add1f": true, "subf": true, "mulf": true, "divf": true, "maxf": true, "minf": true,
+}
+
+// typeFlowDiagnostics checks every pipeline against the shape of data and
+// the signatures of the functions the render would register. Without data,
+// only argument counts are checked.
+func typeFlowDiagnostics(templatePath, content string, data interface{}, opts renderOptions) []diagnostic {
+	trees, err := parseTreesWithDelims(templateName(templatePath), content, opts.LeftDelim, opts.RightDelim)
+	if err != nil {
+		return nil
+	}
+
+	funcs, err := templateFuncs(templatePath, opts)
+	if err != nil {
+		return nil
+	}
+
+	checker := &typeChecker{templatePath: templatePath, content: content, funcs: funcs}
+	root := typeOfValue(data)
+	for _, name := range sortedTreeNames(trees, templateName(templatePath)) {
+		dot := root
+		if name != templateName(templatePath) {
+			// Dot in a define depends on the caller.
+			dot = nil
+		}
+		checker.list(trees[name].Root, typeEnv{dot: dot, vars: map[string]*valueType{"$": dot}})
+	}
+	return checker.diagnostics
+}
+
+func typeOfValue(value interface{}) *valueType {
+	switch typed := value.(type) {
+	case string:
+		return &valueType{Kind: kindString}
+	case float64, json.Number, int, int64:
+		return &valueType{Kind: kindNumber}
+	case bool:
+		return &valueType{Kind: kindBool}
+	case map[string]interface{}:
+		fields := make(map[string]*valueType, len(typed))
+		for key, item := range typed {
+			fields[key] = typeOfValue(item)
+		}
+		return &valueType{Kind: kindMap, Fields: fields}
+	case []interface{}:
+		list := &valueType{Kind: kindList}
+		for _, item := range typed {
+			if list.Elem = typeOfValue(item); list.Elem != nil {
+				break
+			}
+		}
+		return list
+	default:
+		return nil
+	}
+}
+
+func (t *valueType) describe() string {
+	switch t.Kind {
+	case kindMap:
+		return "a map"
+	case kindList:
+		return "a list"
+	case kindBool:
+		return "a boolean"
+	default:
+		return "a " + t.Kind
+	}
+}
+
+type typeEnv struct {
+	dot  *valueType
+	vars map[string]*valueType
+}
+
+func (env typeEnv) nested(dot *valueType) typeEnv {
+	vars := make(map[string]*valueType, len(env.vars))
+	for name, value := range env.vars {
+		vars[name] = value
+	}
+	return typeEnv{dot: dot, vars: vars}
+}
+
+// typedArg is an argument and the node to blame for it; piped values blame
+// the command that produced them.
+type typedArg struct {
+	node parse.Node
+	typ  *valueType
+}
+
+type typeChecker struct {
+	templatePath string
+	content      string
+	funcs        map[string]interface{}
+	diagnostics  []diagnostic
+
+	// onAction, when set, sees every action with the scope it runs in.
+	onAction func(action *parse.ActionNode, env typeEnv)
+}
+
+// warn reports message at node, spanning it when the source spells the
+// node the way the parser prints it.
+func (c *typeChecker) warn(node parse.Node, message string) {
+	line, column := lineColumn(c.content, node.Position())
+	diag := diagnostic{Message: message, Severity: "warning", Rule: "type-flow", File: c.templatePath, Line: line, Column: column}
+	if source := node.String(); strings.HasPrefix(c.content[node.Position():], source) && !strings.Contains(source, "\n") {
+		diag.EndColumn = column + len(source)
+	}
+	c.diagnostics = append(c.diagnostics, diag)
+}
+
+func (c *typeChecker) list(list *parse.ListNode, env typeEnv) {
+	if list == nil {
+		return
+	}
+	for _, node := range list.Nodes {
+		switch typed := node.(type) {
+		case *parse.ActionNode:
+			if c.onAction != nil {
+				c.onAction(typed, env)
+			}
+			c.pipe(typed.Pipe, env)
+		case *parse.IfNode:
+			body := env.nested(env.dot)
+			condition := c.pipe(typed.Pipe, body)
+			if condition != nil && len(typed.Pipe.Decl) == 0 && !isLiteralPipe(typed.Pipe) && (condition.Kind == kindString || condition.Kind == kindNumber) {
+				truthy := "non-empty"
+				if condition.Kind == kindNumber {
+					truthy = "non-zero"
+				}
+				c.warn(typed.Pipe, fmt.Sprintf("if condition %s is %s, not a boolean; it is true whenever it is %s", typed.Pipe, condition.describe(), truthy))
+			}
+			c.list(typed.List, body)
+			c.list(typed.ElseList, env.nested(env.dot))
+		case *parse.WithNode:
+			body := env.nested(env.dot)
+			body.dot = c.pipe(typed.Pipe, body)
+			c.list(typed.List, body)
+			c.list(typed.ElseList, env.nested(env.dot))
+		case *parse.RangeNode:
+			body := env.nested(env.dot)
+			collection := c.pipe(typed.Pipe, body)
+			var item *valueType
+			if collection != nil && collection.Kind == kindList {
+				item = collection.Elem
+			}
+			body.dot = item
+			switch len(typed.Pipe.Decl) {
+			case 1:
+				body.vars[typed.Pipe.Decl[0].Ident[0]] = item
+			case 2:
+				body.vars[typed.Pipe.Decl[0].Ident[0]] = nil
+				body.vars[typed.Pipe.Decl[1].Ident[0]] = item
+			}
+			c.list(typed.List, body)
+			c.list(typed.ElseList, env.nested(env.dot))
+		case *parse.TemplateNode:
+			c.pipe(typed.Pipe, env)
+		}
+	}
+}
+
+func (c *typeChecker) pipe(pipe *parse.PipeNode, env typeEnv) *valueType {
+	if pipe == nil {
+		return nil
+	}
+
+	var value *typedArg
+	for _, cmd := range pipe.Cmds {
+		result := c.command(cmd, value, env)
+		value = &typedArg{node: cmd, typ: result}
+	}
+	var result *valueType
+	if value != nil {
+		result = value.typ
+	}
+	for _, decl := range pipe.Decl {
+		env.vars[decl.Ident[0]] = result
+	}
+	return result
+}
+
+func (c *typeChecker) command(cmd *parse.CommandNode, piped *typedArg, env typeEnv) *valueType {
+	if len(cmd.Args) == 0 {
+		return nil
+	}
+
+	ident, ok := cmd.Args[0].(*parse.IdentifierNode)
+	if !ok {
+		for _, arg := range cmd.Args[1:] {
+			c.arg(arg, env)
+		}
+		return c.arg(cmd.Args[0], env)
+	}
+
+	args := make([]typedArg, 0, len(cmd.Args))
+	for _, arg := range cmd.Args[1:] {
+		args = append(args, typedArg{node: arg, typ: c.arg(arg, env)})
+	}
+	if piped != nil {
+		args = append(args, *piped)
+	}
+
+	name := ident.Ident
+	fn, registered := c.funcs[name]
+	if !registered {
+		return c.builtin(ident, args)
+	}
+
+	fnType := reflect.TypeOf(fn)
+	if fnType == nil || fnType.Kind() != reflect.Func {
+		return nil
+	}
+	want := fnType.NumIn()
+	if fnType.IsVariadic() && len(args) < want-1 {
+		c.warn(ident, fmt.Sprintf("%s takes at least %d arguments, got %d", name, want-1, len(args)))
+	} else if !fnType.IsVariadic() && len(args) != want {
+		c.warn(ident, fmt.Sprintf("%s takes %d %s, got %d", name, want, plural(want, "argument"), len(args)))
+	}
+
+	if index, ok := listParams[name]; ok && index < len(args) {
+		if arg := args[index]; arg.typ != nil && arg.typ.Kind == kindMap {
+			c.warn(arg.node, fmt.Sprintf("%s expects a list, but %s is a map", name, arg.node))
+		}
+	}
+	if arithmeticFuncs[name] {
+		for _, arg := range args {
+			if arg.typ != nil && arg.typ.Kind == kindString {
+				c.warn(arg.node, fmt.Sprintf("%s expects numbers, but %s is a string", name, arg.node))
+			}
+		}
+	}
+
+	if fnType.NumOut() == 0 {
+		return nil
+	}
+	switch fnType.Out(0).Kind() {
+	case reflect.String:
+		return &valueType{Kind: kindString}
+	case reflect.Bool:
+		return &valueType{Kind: kindBool}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return &valueType{Kind: kindNumber}
+	}
+	return nil
+}
+
+func (c *typeChecker) builtin(ident *parse.IdentifierNode, args []typedArg) *valueType {
+	name := ident.Ident
+	if bounds, ok := builtinArity[name]; ok {
+		switch {
+		case len(args) < bounds[0] && bounds[0] == bounds[1]:
+			c.warn(ident, fmt.Sprintf("%s takes %d %s, got %d", name, bounds[0], plural(bounds[0], "argument"), len(args)))
+		case len(args) < bounds[0]:
+			c.warn(ident, fmt.Sprintf("%s takes at least %d %s, got %d", name, bounds[0], plural(bounds[0], "argument"), len(args)))
+		case bounds[1] >= 0 && len(args) > bounds[1]:
+			c.warn(ident, fmt.Sprintf("%s takes %d %s, got %d", name, bounds[1], plural(bounds[1], "argument"), len(args)))
+		}
+	}
+
+	switch name {
+	case "not", "eq", "ne", "lt", "le", "gt", "ge":
+		return &valueType{Kind: kindBool}
+	case "len":
+		return &valueType{Kind: kindNumber}
+	case "print", "printf", "println", "html", "js", "urlquery":
+		return &valueType{Kind: kindString}
+	case "index":
+		if len(args) == 0 {
+			return nil
+		}
+		value := args[0].typ
+		for _, key := range args[1:] {
+			if value == nil {
+				return nil
+			}
+			switch {
+			case value.Kind == kindList:
+				value = value.Elem
+			case value.Kind == kindMap:
+				literal, ok := key.node.(*parse.StringNode)
+				if !ok {
+					return nil
+				}
+				value = value.Fields[literal.Text]
+			default:
+				return nil
+			}
+		}
+		return value
+	}
+	return nil
+}
+
+func (c *typeChecker) arg(node parse.Node, env typeEnv) *valueType {
+	switch typed := node.(type) {
+	case *parse.DotNode:
+		return env.dot
+	case *parse.FieldNode:
+		return fieldType(env.dot, typed.Ident)
+	case *parse.VariableNode:
+		return fieldType(env.vars[typed.Ident[0]], typed.Ident[1:])
+	case *parse.ChainNode:
+		if pipe, ok := typed.Node.(*parse.PipeNode); ok {
+			return fieldType(c.pipe(pipe, env.nested(env.dot)), typed.Field)
+		}
+		return fieldType(c.arg(typed.Node, env), typed.Field)
+	case *parse.PipeNode:
+		return c.pipe(typed, env.nested(env.dot))
+	case *parse.StringNode:
+		return &valueType{Kind: kindString}
+	case *parse.NumberNode:
+		return &valueType{Kind: kindNumber}
+	case *parse.BoolNode:
+		return &valueType{Kind: kindBool}
+	default:
+		return nil
+	}
+}
+
+// isLiteralPipe reports whether pipe is a lone constant, such as the
+// placeholders check mode substitutes for broken conditions.
+func isLiteralPipe(pipe *parse.PipeNode) bool {
+	if len(pipe.Cmds) != 1 || len(pipe.Cmds[0].Args) != 1 {
+		return false
+	}
+	switch pipe.Cmds[0].Args[0].(type) {
+	case *parse.NumberNode, *parse.StringNode, *parse.BoolNode:
+		return true
+	}
+	return false
+}
+
+func fieldType(value *valueType, fields []string) *valueType {
+	for _, field := range fields {
+		if value == nil || value.Kind != kindMap {
+			return nil
+		}
+		value = value.Fields[field]
+	}
+	return value
+}
+
+func plural(count int, noun string) string {
+	if count == 1 {
+		return noun
+	}
+	return noun + "s"
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestTypeFlowDiagnostics(t *testing.T) {
+	templatePath := filepath.Join(t.TempDir(), "page.tmpl")
+	content := `{{ join ", " .tags }}
+{{ if .count }}{{ upper .name "x" }}{{ end }}
+{{ range .items }}{{ if .enabled }}{{ .label | lower }}{{ end }}{{ end }}
+{{ if gt .count }}{{ end }}{{ if .list }}{{ end }}`
+	data, err := parseContext([]byte(`{"tags":{"a":1},"count":3,"name":"n","items":[{"enabled":true,"label":"L"}],"list":[1]}`))
+	if err != nil {
+		t.Fatalf("failed to parse context: %v", err)
+	}
+	got := typeFlowDiagnostics(templatePath, content, data, renderOptions{})
+	want := []diagnostic{
+		{Message: "join expects a list, but .tags is a map", Line: 1, Column: 14, EndColumn: 19},
+		{Message: "if condition .count is a number, not a boolean; it is true whenever it is non-zero", Line: 2, Column: 7, EndColumn: 13},
+		{Message: "upper takes 1 argument, got 2", Line: 2, Column: 19, EndColumn: 24},
+		{Message: "gt takes 2 arguments, got 1", Line: 4, Column: 7, EndColumn: 9},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d diagnostics, got %+v", len(want), got)
+	}
+	for i := range want {
+		if got[i].Message != want[i].Message || got[i].Line != want[i].Line || got[i].Column != want[i].Column || got[i].EndColumn != want[i].EndColumn || got[i].Severity != "warning" {
+			t.Fatalf("diagnostic %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	if unknown := typeFlowDiagnostics(templatePath, content, nil, renderOptions{}); len(unknown) != 2 {
+		t.Fatalf("expected only arity problems without a context, got %+v", unknown)
+	}
+}
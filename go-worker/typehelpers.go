@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// templateTypeOf returns the Go type of value, e.g. "[]interface {}" for a
+// JSON list. It matches Sprig's typeOf.
+func templateTypeOf(value interface{}) string {
+	return fmt.Sprintf("%T", value)
+}
+
+// templateKindOf returns the reflect kind of value, e.g. "slice" or "map".
+// It matches Sprig's kindOf.
+func templateKindOf(value interface{}) string {
+	if value == nil {
+		return "invalid"
+	}
+	return reflect.ValueOf(value).Kind().String()
+}
+
+// templateTypeIs reports whether value's Go type is target. It matches
+// Sprig's typeIs.
+func templateTypeIs(target string, value interface{}) bool {
+	return target == templateTypeOf(value)
+}
+
+// shapeAssertion builds a mustBe* helper that passes value through when
+// accept allows its kind and otherwise fails the render with a message
+// naming what was expected and what arrived.
+func shapeAssertion(name, expected string, accept func(reflect.Kind) bool) func(interface{}) (interface{}, error) {
+	return func(value interface{}) (interface{}, error) {
+		if value != nil && accept(reflect.ValueOf(value).Kind()) {
+			return value, nil
+		}
+		if value == nil {
+			return nil, fmt.Errorf("%s: expected %s, got nil", name, expected)
+		}
+		return nil, fmt.Errorf("%s: expected %s, got %T (%s)", name, expected, value, templateKindOf(value))
+	}
+}
+
+var (
+	templateMustBeList = shapeAssertion("mustBeList", "a list", func(kind reflect.Kind) bool {
+		return kind == reflect.Slice || kind == reflect.Array
+	})
+	templateMustBeMap = shapeAssertion("mustBeMap", "a map", func(kind reflect.Kind) bool {
+		return kind == reflect.Map
+	})
+	templateMustBeString = shapeAssertion("mustBeString", "a string", func(kind reflect.Kind) bool {
+		return kind == reflect.String
+	})
+	templateMustBeNumber = shapeAssertion("mustBeNumber", "a number", func(kind reflect.Kind) bool {
+		return kind >= reflect.Int && kind <= reflect.Float64
+	})
+	templateMustBeBool = shapeAssertion("mustBeBool", "a boolean", func(kind reflect.Kind) bool {
+		return kind == reflect.Bool
+	})
+)
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTypeHelpersDescribeContextValues(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "types.tmpl")
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, templatePath, `{{ typeOf .items }}|{{ kindOf .items }}|{{ kindOf .count }}|{{ kindOf .missing }}|{{ typeIs "string" .name }}`)
+	writeFile(t, contextPath, `{"items":[1],"count":2,"name":"go"}`)
+
+	resp := run(templatePath, contextPath, renderOptions{})
+	if resp.Error != "" || resp.Rendered != "[]interface {}|slice|float64|invalid|true" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+}
+
+func TestMustBeHelpersPassThroughOrFail(t *testing.T) {
+	dir := t.TempDir()
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, contextPath, `{"items":["a","b"],"meta":{"k":"v"},"count":3,"ok":true,"name":"go"}`)
+
+	passing := filepath.Join(dir, "pass.tmpl")
+	writeFile(t, passing, `{{ range .items | mustBeList }}{{ . }}{{ end }} {{ (mustBeMap .meta).k }} {{ mustBeNumber .count }} {{ mustBeBool .ok }} {{ mustBeString .name }}`)
+	resp := run(passing, contextPath, renderOptions{})
+	if resp.Error != "" || resp.Rendered != "ab v 3 true go" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	failing := filepath.Join(dir, "fail.tmpl")
+	writeFile(t, failing, `{{ range .meta | mustBeList }}{{ . }}{{ end }}`)
+	resp = run(failing, contextPath, renderOptions{})
+	if !strings.Contains(resp.Error, "mustBeList: expected a list, got map[string]interface {} (map)") {
+		t.Fatalf("expected assertion error, got %+v", resp)
+	}
+
+	missing := filepath.Join(dir, "missing.tmpl")
+	writeFile(t, missing, `{{ mustBeString .absent }}`)
+	resp = run(missing, contextPath, renderOptions{})
+	if !strings.Contains(resp.Error, "mustBeString: expected a string, got nil") {
+		t.Fatalf("expected nil assertion error, got %+v", resp)
+	}
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// workerVersion and updatePublicKey are stamped into release builds with
+// -ldflags "-X main.workerVersion=... -X main.updatePublicKey=...".
+var (
+	workerVersion   = "dev"
+	updatePublicKey = ""
+)
+
+// devWorkerVersion is the version of builds that were not stamped, which
+// alone accept another signing key with --public-key.
+const devWorkerVersion = "dev"
+
+const (
+	defaultUpdateManifestURL = "https://github.com/johnmschoonover/vscode_go_templates/releases/latest/download/go-worker-manifest.json"
+	maxManifestBytes         = 1 << 20
+	maxWorkerBinaryBytes     = 200 << 20
+	updateTimeout            = 5 * time.Minute
+)
+
+var updateClient = &http.Client{Timeout: updateTimeout}
+
+// updateManifest lists the current worker release for each channel. It is
+// published next to a detached ed25519 signature (<manifest>.sig, base64).
+// Expires bounds how long the signature is trusted, so an old manifest
+// served again cannot hold workers on a release it names.
+type updateManifest struct {
+	Expires  time.Time                `json:"expires"`
+	Channels map[string]updateRelease `json:"channels"`
+}
+
+type updateRelease struct {
+	Version string `json:"version"`
+	// Assets is keyed by platform-arch, as in assets/bin (e.g. linux-x64).
+	Assets map[string]updateAsset `json:"assets"`
+}
+
+type updateAsset struct {
+	URL    string `json:"url"`
+	SHA256 string `json:"sha256"`
+}
+
+type updateResult struct {
+	Channel        string `json:"channel"`
+	Platform       string `json:"platform"`
+	CurrentVersion string `json:"currentVersion"`
+	LatestVersion  string `json:"latestVersion"`
+	Updated        bool   `json:"updated"`
+	Path           string `json:"path,omitempty"`
+}
+
+// runUpdate implements `go-worker update`: it fetches and verifies the
+// release manifest, downloads the binary for this platform, checks its
+// digest, and atomically replaces the running executable.
+func runUpdate(args []string) response {
+	flags := flag.NewFlagSet("update", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	channel := flags.String("channel", "stable", "Release channel to follow")
+	manifestURL := flags.String("manifest-url", defaultUpdateManifestURL, "URL of the signed release manifest")
+	publicKey := flags.String("public-key", "", "Base64 ed25519 key the manifest must be signed with; development builds only")
+	binaryPath := flags.String("binary", "", "Worker binary to replace (defaults to the running executable)")
+	checkOnly := flags.Bool("check-only", false, "Report the available version without installing it")
+	if err := flags.Parse(args); err != nil {
+		return response{Error: "update: " + err.Error()}
+	}
+
+	result, err := updateWorker(*channel, *manifestURL, *publicKey, *binaryPath, *checkOnly)
+	if err != nil {
+		return response{Update: result, Error: "update: " + err.Error()}
+	}
+	return response{Update: result}
+}
+
+func updateWorker(channel, manifestURL, publicKey, binaryPath string, checkOnly bool) (*updateResult, error) {
+	result := &updateResult{Channel: channel, Platform: workerPlatform(), CurrentVersion: workerVersion}
+
+	// A release trusts only the key it was built with, so a flag passed by
+	// whatever launches the worker cannot swap in a key of its own.
+	if publicKey != "" && workerVersion != devWorkerVersion {
+		return result, errors.New("--public-key is only accepted by development builds")
+	}
+	if publicKey == "" {
+		publicKey = updatePublicKey
+	}
+	if publicKey == "" {
+		return result, errors.New("no signing key is configured; pass --public-key")
+	}
+	key, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return result, errors.New("the signing key must be a base64 ed25519 public key")
+	}
+
+	manifestBytes, err := download(manifestURL, maxManifestBytes)
+	if err != nil {
+		return result, err
+	}
+	signature, err := download(manifestURL+".sig", maxManifestBytes)
+	if err != nil {
+		return result, err
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil || !ed25519.Verify(ed25519.PublicKey(key), manifestBytes, decoded) {
+		return result, errors.New("manifest signature verification failed")
+	}
+
+	var manifest updateManifest
+	if err := json.Unmarshal(manifestBytes, &manifest); err != nil {
+		return result, fmt.Errorf("invalid manifest: %w", err)
+	}
+	if manifest.Expires.IsZero() {
+		return result, errors.New("the manifest has no expiry")
+	}
+	if time.Now().After(manifest.Expires) {
+		return result, fmt.Errorf("the manifest expired at %s", manifest.Expires.UTC().Format(time.RFC3339))
+	}
+	release, ok := manifest.Channels[channel]
+	if !ok {
+		return result, fmt.Errorf("channel %q is not in the manifest", channel)
+	}
+	result.LatestVersion = release.Version
+
+	latest, ok := parseSemver(release.Version)
+	if !ok {
+		return result, fmt.Errorf("release version %q is not a semantic version", release.Version)
+	}
+	asset, ok := release.Assets[result.Platform]
+	if !ok {
+		return result, fmt.Errorf("release %s has no binary for %s", release.Version, result.Platform)
+	}
+	// Development builds have no version and take any release.
+	if current, ok := parseSemver(workerVersion); ok {
+		switch order := latest.compare(current); {
+		case order < 0:
+			return result, fmt.Errorf("release %s is older than the running worker %s; refusing to downgrade", release.Version, workerVersion)
+		case order == 0:
+			return result, nil
+		}
+	}
+	if checkOnly {
+		return result, nil
+	}
+
+	if binaryPath == "" {
+		if binaryPath, err = os.Executable(); err != nil {
+			return result, err
+		}
+		if resolved, err := filepath.EvalSymlinks(binaryPath); err == nil {
+			binaryPath = resolved
+		}
+	}
+
+	assetURL, err := resolveAssetURL(manifestURL, asset.URL)
+	if err != nil {
+		return result, err
+	}
+	binary, err := download(assetURL, maxWorkerBinaryBytes)
+	if err != nil {
+		return result, err
+	}
+	digest := sha256.Sum256(binary)
+	if !strings.EqualFold(hex.EncodeToString(digest[:]), asset.SHA256) {
+		return result, fmt.Errorf("checksum mismatch for %s", assetURL)
+	}
+
+	if err := replaceBinary(binaryPath, binary); err != nil {
+		return result, err
+	}
+	result.Updated = true
+	result.Path = binaryPath
+	return result, nil
+}
+
+// semver is a semantic version: MAJOR.MINOR.PATCH with an optional
+// pre-release, written with or without a leading v. Build metadata is
+// ignored, as it does not order versions.
+type semver struct {
+	core       [3]int
+	prerelease []string
+}
+
+func parseSemver(value string) (semver, bool) {
+	value = strings.TrimPrefix(strings.TrimSpace(value), "v")
+	value, _, _ = strings.Cut(value, "+")
+	core, prerelease, hasPrerelease := strings.Cut(value, "-")
+	parts := strings.Split(core, ".")
+	if len(parts) != 3 {
+		return semver{}, false
+	}
+	var version semver
+	for i, part := range parts {
+		number, err := strconv.Atoi(part)
+		if err != nil || number < 0 || (len(part) > 1 && part[0] == '0') {
+			return semver{}, false
+		}
+		version.core[i] = number
+	}
+	if hasPrerelease {
+		version.prerelease = strings.Split(prerelease, ".")
+		for _, identifier := range version.prerelease {
+			if identifier == "" {
+				return semver{}, false
+			}
+		}
+	}
+	return version, true
+}
+
+// compare orders versions by semver precedence: negative when v is older
+// than other, zero when they are equal, positive when v is newer. A
+// pre-release is older than its release.
+func (v semver) compare(other semver) int {
+	for i := range v.core {
+		if v.core[i] != other.core[i] {
+			return v.core[i] - other.core[i]
+		}
+	}
+	switch {
+	case len(v.prerelease) == 0 && len(other.prerelease) == 0:
+		return 0
+	case len(v.prerelease) == 0:
+		return 1
+	case len(other.prerelease) == 0:
+		return -1
+	}
+	for i := 0; i < len(v.prerelease) && i < len(other.prerelease); i++ {
+		a, b := v.prerelease[i], other.prerelease[i]
+		if a == b {
+			continue
+		}
+		x, errA := strconv.Atoi(a)
+		y, errB := strconv.Atoi(b)
+		switch {
+		case errA == nil && errB == nil:
+			return x - y
+		case errA == nil:
+			return -1
+		case errB == nil:
+			return 1
+		}
+		return strings.Compare(a, b)
+	}
+	return len(v.prerelease) - len(other.prerelease)
+}
+
+// workerPlatform names this build the way assets/bin does (linux-x64,
+// win32-arm64, ...).
+func workerPlatform() string {
+	platform := runtime.GOOS
+	if platform == "windows" {
+		platform = "win32"
+	}
+	arch := runtime.GOARCH
+	if arch == "amd64" {
+		arch = "x64"
+	}
+	return platform + "-" + arch
+}
+
+func resolveAssetURL(manifestURL, assetURL string) (string, error) {
+	base, err := url.Parse(manifestURL)
+	if err != nil {
+		return "", err
+	}
+	ref, err := url.Parse(assetURL)
+	if err != nil {
+		return "", err
+	}
+	return base.ResolveReference(ref).String(), nil
+}
+
+func download(rawURL string, limit int64) ([]byte, error) {
+	resp, err := updateClient.Get(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: %s", rawURL, resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > limit {
+		return nil, fmt.Errorf("%s is larger than %d bytes", rawURL, limit)
+	}
+	return body, nil
+}
+
+// replaceBinary writes the new binary beside the old one and renames it into
+// place, so the worker is never observed half-written. Windows cannot
+// replace a running executable, so the old one is moved aside first.
+func replaceBinary(path string, binary []byte) error {
+	temp, err := os.CreateTemp(filepath.Dir(path), ".go-worker-update-*")
+	if err != nil {
+		return err
+	}
+	tempPath := temp.Name()
+	defer os.Remove(tempPath)
+
+	if _, err := io.Copy(temp, bytes.NewReader(binary)); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tempPath, 0o755); err != nil {
+		return err
+	}
+
+	if runtime.GOOS == "windows" {
+		previous := path + ".old"
+		_ = os.Remove(previous)
+		if err := os.Rename(path, previous); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return os.Rename(tempPath, path)
+}
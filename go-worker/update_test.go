@@ -0,0 +1,177 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newReleaseServer publishes a signed manifest offering binary as v9.9.9
+// on the stable channel for this platform, after applying edits.
+func newReleaseServer(t *testing.T, binary []byte, checksum string, edits ...func(*updateManifest)) (*httptest.Server, string) {
+	t.Helper()
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	if checksum == "" {
+		digest := sha256.Sum256(binary)
+		checksum = hex.EncodeToString(digest[:])
+	}
+	release := updateManifest{Expires: time.Now().Add(time.Hour), Channels: map[string]updateRelease{
+		"stable": {Version: "v9.9.9", Assets: map[string]updateAsset{
+			workerPlatform(): {URL: "bin/go-worker", SHA256: checksum},
+		}},
+	}}
+	for _, edit := range edits {
+		edit(&release)
+	}
+	manifest, err := json.Marshal(release)
+	if err != nil {
+		t.Fatalf("failed to marshal manifest: %v", err)
+	}
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, manifest))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/releases/manifest.json":
+			_, _ = w.Write(manifest)
+		case "/releases/manifest.json.sig":
+			_, _ = w.Write([]byte(signature))
+		case "/releases/bin/go-worker":
+			_, _ = w.Write(binary)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return server, base64.StdEncoding.EncodeToString(publicKey)
+}
+
+func TestRunUpdateReplacesBinaryAfterVerification(t *testing.T) {
+	server, publicKey := newReleaseServer(t, []byte("new worker"), "")
+	binaryPath := filepath.Join(t.TempDir(), "go-worker")
+	writeFile(t, binaryPath, "old worker")
+
+	args := []string{"--manifest-url", server.URL + "/releases/manifest.json", "--public-key", publicKey, "--binary", binaryPath}
+
+	resp := runUpdate(append(args, "--check-only"))
+	if resp.Error != "" || resp.Update == nil || resp.Update.LatestVersion != "v9.9.9" || resp.Update.Updated {
+		t.Fatalf("unexpected check-only response: %+v", resp)
+	}
+
+	resp = runUpdate(args)
+	if resp.Error != "" || !resp.Update.Updated || resp.Update.Path != binaryPath {
+		t.Fatalf("unexpected update response: %+v (%+v)", resp, resp.Update)
+	}
+	if content, _ := os.ReadFile(binaryPath); string(content) != "new worker" {
+		t.Fatalf("expected binary to be replaced, got %q", content)
+	}
+	if info, err := os.Stat(binaryPath); err != nil || info.Mode().Perm()&0o100 == 0 {
+		t.Fatalf("expected replaced binary to be executable: %v", err)
+	}
+}
+
+func TestRunUpdateRejectsUntrustedReleases(t *testing.T) {
+	binaryPath := filepath.Join(t.TempDir(), "go-worker")
+	writeFile(t, binaryPath, "old worker")
+
+	server, _ := newReleaseServer(t, []byte("new worker"), "")
+	_, otherKey := newReleaseServer(t, nil, "")
+	resp := runUpdate([]string{"--manifest-url", server.URL + "/releases/manifest.json", "--public-key", otherKey, "--binary", binaryPath})
+	if resp.Error != "update: manifest signature verification failed" {
+		t.Fatalf("expected signature failure, got %+v", resp)
+	}
+
+	server, publicKey := newReleaseServer(t, []byte("tampered"), strings.Repeat("0", 64))
+	resp = runUpdate([]string{"--manifest-url", server.URL + "/releases/manifest.json", "--public-key", publicKey, "--binary", binaryPath})
+	if !strings.Contains(resp.Error, "checksum mismatch") {
+		t.Fatalf("expected checksum failure, got %+v", resp)
+	}
+
+	if content, _ := os.ReadFile(binaryPath); string(content) != "old worker" {
+		t.Fatalf("expected binary to be untouched, got %q", content)
+	}
+
+	resp = runUpdate([]string{"--manifest-url", server.URL + "/releases/manifest.json"})
+	if !strings.Contains(resp.Error, "no signing key") {
+		t.Fatalf("expected missing key error, got %+v", resp)
+	}
+}
+
+func TestRunUpdateRefusesStaleManifestsAndDowngrades(t *testing.T) {
+	binaryPath := filepath.Join(t.TempDir(), "go-worker")
+	writeFile(t, binaryPath, "old worker")
+	update := func(server *httptest.Server, publicKey string) response {
+		return runUpdate([]string{"--manifest-url", server.URL + "/releases/manifest.json", "--public-key", publicKey, "--binary", binaryPath})
+	}
+
+	server, publicKey := newReleaseServer(t, []byte("new worker"), "", func(m *updateManifest) { m.Expires = time.Now().Add(-time.Minute) })
+	if resp := update(server, publicKey); !strings.Contains(resp.Error, "the manifest expired at") {
+		t.Fatalf("expected an expired manifest to be refused, got %+v", resp)
+	}
+	server, publicKey = newReleaseServer(t, []byte("new worker"), "", func(m *updateManifest) { m.Expires = time.Time{} })
+	if resp := update(server, publicKey); resp.Error != "update: the manifest has no expiry" {
+		t.Fatalf("expected a manifest without expiry to be refused, got %+v", resp)
+	}
+
+	server, publicKey = newReleaseServer(t, []byte("new worker"), "")
+	defer func(version string) { workerVersion = version }(workerVersion)
+	workerVersion = "v1.0.0"
+	if resp := update(server, publicKey); resp.Error != "update: --public-key is only accepted by development builds" {
+		t.Fatalf("expected --public-key to be refused by a release build, got %+v", resp)
+	}
+
+	// The remaining cases pretend to be a release build signed with the
+	// test key.
+	defer func(key string) { updatePublicKey = key }(updatePublicKey)
+	updatePublicKey = publicKey
+	for current, want := range map[string]string{
+		"v10.0.0": "update: release v9.9.9 is older than the running worker v10.0.0; refusing to downgrade",
+		"v9.9.9":  "",
+		"v9.10.0": "update: release v9.9.9 is older than the running worker v9.10.0; refusing to downgrade",
+	} {
+		workerVersion = current
+		resp := runUpdate([]string{"--manifest-url", server.URL + "/releases/manifest.json", "--binary", binaryPath})
+		if resp.Error != want || resp.Update.Updated {
+			t.Fatalf("running %s: unexpected response %+v", current, resp)
+		}
+	}
+	if content, _ := os.ReadFile(binaryPath); string(content) != "old worker" {
+		t.Fatalf("expected binary to be untouched, got %q", content)
+	}
+
+	workerVersion = "v9.9.9-rc.1"
+	resp := runUpdate([]string{"--manifest-url", server.URL + "/releases/manifest.json", "--binary", binaryPath})
+	if resp.Error != "" || !resp.Update.Updated {
+		t.Fatalf("expected a release candidate to update to its release, got %+v", resp)
+	}
+}
+
+func TestSemverCompare(t *testing.T) {
+	ordered := []string{"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta", "1.0.0-beta.2", "1.0.0-beta.11", "1.0.0-rc.1", "v1.0.0", "1.0.1", "1.2.0", "1.10.0+build.5", "2.0.0"}
+	for i := 1; i < len(ordered); i++ {
+		older, _ := parseSemver(ordered[i-1])
+		newer, ok := parseSemver(ordered[i])
+		if !ok || older.compare(newer) >= 0 || newer.compare(older) <= 0 {
+			t.Fatalf("expected %s < %s", ordered[i-1], ordered[i])
+		}
+	}
+	for _, invalid := range []string{"dev", "1.2", "1.02.3", "1.2.3-", "1.2.x"} {
+		if _, ok := parseSemver(invalid); ok {
+			t.Errorf("expected %q to be rejected", invalid)
+		}
+	}
+}
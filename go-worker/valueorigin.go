@@ -0,0 +1,447 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template/parse"
+)
+
+const (
+	// originMarkFunc is the hidden helper an instrumented template calls
+	// before and after every output action whose value comes from the
+	// context, so the worker can tell which bytes the value became.
+	originMarkFunc = "__goTemplateStudioOrigin"
+	// originEnterFunc and originExitFunc bracket {{template}} calls so the
+	// called template knows the context path of its dot.
+	originEnterFunc = "__goTemplateStudioOriginEnter"
+	originExitFunc  = "__goTemplateStudioOriginExit"
+	// originIndexVar and originElemVar name the variables added to a range
+	// that declares none, so the worker learns each iteration's index.
+	originIndexVar = "$__goTemplateStudioIndex"
+	originElemVar  = "$__goTemplateStudioElem"
+	// originIndexSlot stands, in an instrumented path, for the index of an
+	// enclosing range, which is only known at run time.
+	originIndexSlot = "\x00"
+)
+
+// valueOrigin links a range of the rendered output, from OutputStart up to
+// OutputEnd, to the context value it printed: Path, such as
+// .user.billing.plan, and the action that printed it.
+type valueOrigin struct {
+	OutputStart int    `json:"outputStart"`
+	OutputEnd   int    `json:"outputEnd"`
+	Path        string `json:"path"`
+	File        string `json:"file"`
+	Line        int    `json:"line"`
+	Column      int    `json:"column"`
+	EndLine     int    `json:"endLine"`
+	EndColumn   int    `json:"endColumn"`
+}
+
+// originPath is a context path relative to the data the template was
+// executed or called with, such as .items\x00.name. Each originIndexSlot
+// stands for the index of an enclosing range, held at run time by the
+// variable at the same position in indexes.
+type originPath struct {
+	spec    string
+	indexes []string
+}
+
+func (p *originPath) field(names ...string) *originPath {
+	if p == nil {
+		return nil
+	}
+	return &originPath{spec: p.spec + "." + strings.Join(names, "."), indexes: p.indexes}
+}
+
+func (p *originPath) element(indexVar string) *originPath {
+	if p == nil {
+		return nil
+	}
+	return &originPath{spec: p.spec + originIndexSlot, indexes: append(append([]string{}, p.indexes...), indexVar)}
+}
+
+// instrumentValueOrigins wraps every output action of tree whose value can
+// be traced to a context path in calls to originMarkFunc, and every
+// {{template}} call in originEnterFunc and originExitFunc. Paths are worked
+// out from the source: fields of dot or of variables, through with and
+// range, index with constant keys, and a helper's only context argument,
+// as in {{ upper .name }}. Variables reassigned with = are not followed.
+func instrumentValueOrigins(tree *parse.Tree, sources map[string]string, leftDelim, rightDelim string) {
+	if tree == nil || tree.Root == nil {
+		return
+	}
+	content, ok := sources[tree.ParseName]
+	if !ok {
+		return
+	}
+	instrumenter := &originInstrumenter{
+		tree:       tree,
+		actions:    scanActions(content, leftDelim, rightDelim),
+		reassigned: map[string]bool{},
+	}
+	collectReassigned(tree.Root, instrumenter.reassigned)
+	root := &originPath{}
+	instrumenter.list(tree.Root, root, map[string]*originPath{"$": root})
+}
+
+type originInstrumenter struct {
+	tree       *parse.Tree
+	actions    []actionSpan
+	reassigned map[string]bool
+	ranges     int
+}
+
+func collectReassigned(node parse.Node, names map[string]bool) {
+	var pipe *parse.PipeNode
+	var lists []*parse.ListNode
+	switch typed := node.(type) {
+	case *parse.ListNode:
+		if typed != nil {
+			lists = append(lists, typed)
+		}
+	case *parse.ActionNode:
+		pipe = typed.Pipe
+	case *parse.IfNode:
+		pipe, lists = typed.Pipe, []*parse.ListNode{typed.List, typed.ElseList}
+	case *parse.WithNode:
+		pipe, lists = typed.Pipe, []*parse.ListNode{typed.List, typed.ElseList}
+	case *parse.RangeNode:
+		pipe, lists = typed.Pipe, []*parse.ListNode{typed.List, typed.ElseList}
+	}
+	if pipe != nil && pipe.IsAssign {
+		for _, variable := range pipe.Decl {
+			names[variable.Ident[0]] = true
+		}
+	}
+	for _, list := range lists {
+		if list == nil {
+			continue
+		}
+		for _, child := range list.Nodes {
+			collectReassigned(child, names)
+		}
+	}
+}
+
+func (o *originInstrumenter) list(list *parse.ListNode, dot *originPath, vars map[string]*originPath) {
+	if list == nil {
+		return
+	}
+	nodes := make([]parse.Node, 0, len(list.Nodes))
+	for _, node := range list.Nodes {
+		switch typed := node.(type) {
+		case *parse.ActionNode:
+			if isHiddenAction(typed) {
+				break
+			}
+			path := o.pipe(typed.Pipe, dot, vars)
+			if len(typed.Pipe.Decl) > 0 {
+				o.declare(typed.Pipe, path, vars)
+				break
+			}
+			if path != nil {
+				start, end := int(typed.Pos), int(typed.Pos)
+				if span, ok := enclosingAction(o.actions, typed.Pos); ok {
+					start, end = span.Start, span.End
+				}
+				span := fmt.Sprintf("action|%d|%d|%s", start, end, o.tree.ParseName)
+				nodes = append(nodes, o.call(typed.Pos, originMarkFunc, path.spec, span, path.indexes), node, o.call(typed.Pos, originMarkFunc, "", "", nil))
+				continue
+			}
+		case *parse.IfNode:
+			inner := cloneOriginVars(vars)
+			o.declare(typed.Pipe, o.pipe(typed.Pipe, dot, vars), inner)
+			o.list(typed.List, dot, inner)
+			o.list(typed.ElseList, dot, cloneOriginVars(inner))
+		case *parse.WithNode:
+			path := o.pipe(typed.Pipe, dot, vars)
+			inner := cloneOriginVars(vars)
+			o.declare(typed.Pipe, path, inner)
+			o.list(typed.List, path, inner)
+			o.list(typed.ElseList, dot, cloneOriginVars(vars))
+		case *parse.RangeNode:
+			o.rangeNode(typed, dot, vars)
+		case *parse.TemplateNode:
+			var path *originPath
+			if typed.Pipe != nil {
+				path = o.pipe(typed.Pipe, dot, vars)
+			}
+			enter := o.call(typed.Pos, originEnterFunc, "", "", nil)
+			if path != nil {
+				enter = o.call(typed.Pos, originEnterFunc, path.spec, "known", path.indexes)
+			}
+			nodes = append(nodes, enter, node, o.call(typed.Pos, originExitFunc, "", "", nil))
+			continue
+		}
+		nodes = append(nodes, node)
+	}
+	list.Nodes = nodes
+}
+
+// rangeNode gives the range an index variable, if it declares none, so
+// each iteration's element has a path such as .items[2].
+func (o *originInstrumenter) rangeNode(node *parse.RangeNode, dot *originPath, vars map[string]*originPath) {
+	path := o.pipe(node.Pipe, dot, vars)
+	inner := cloneOriginVars(vars)
+	var elem *originPath
+	if path != nil && !node.Pipe.IsAssign {
+		o.ranges++
+		hidden := func(name string) *parse.VariableNode {
+			return &parse.VariableNode{NodeType: parse.NodeVariable, Pos: node.Pos, Ident: []string{name + strconv.Itoa(o.ranges)}}
+		}
+		switch len(node.Pipe.Decl) {
+		case 0:
+			node.Pipe.Decl = []*parse.VariableNode{hidden(originIndexVar), hidden(originElemVar)}
+		case 1:
+			node.Pipe.Decl = []*parse.VariableNode{hidden(originIndexVar), node.Pipe.Decl[0]}
+		}
+		index, value := node.Pipe.Decl[0].Ident[0], node.Pipe.Decl[1].Ident[0]
+		elem = path.element(index)
+		inner[index] = nil
+		if !o.reassigned[value] {
+			inner[value] = elem
+		}
+	} else {
+		o.declare(node.Pipe, nil, inner)
+	}
+	o.list(node.List, elem, inner)
+	o.list(node.ElseList, dot, cloneOriginVars(vars))
+}
+
+// declare records the path of the variables pipe declares.
+func (o *originInstrumenter) declare(pipe *parse.PipeNode, path *originPath, vars map[string]*originPath) {
+	if pipe == nil || pipe.IsAssign {
+		return
+	}
+	for i, variable := range pipe.Decl {
+		name := variable.Ident[0]
+		vars[name] = nil
+		if i == 0 && !o.reassigned[name] {
+			vars[name] = path
+		}
+	}
+}
+
+// pipe is the context path of the value a pipeline starts from; later
+// commands, such as | upper, keep it.
+func (o *originInstrumenter) pipe(pipe *parse.PipeNode, dot *originPath, vars map[string]*originPath) *originPath {
+	if pipe == nil || len(pipe.Cmds) == 0 {
+		return nil
+	}
+	args := pipe.Cmds[0].Args
+	if len(args) == 1 {
+		return o.operand(args[0], dot, vars)
+	}
+	ident, ok := args[0].(*parse.IdentifierNode)
+	if !ok {
+		return nil
+	}
+	if ident.Ident == "index" {
+		return o.index(args[1:], dot, vars)
+	}
+	var found *originPath
+	for _, arg := range args[1:] {
+		if path := o.operand(arg, dot, vars); path != nil {
+			if found != nil {
+				return nil
+			}
+			found = path
+		}
+	}
+	return found
+}
+
+func (o *originInstrumenter) operand(node parse.Node, dot *originPath, vars map[string]*originPath) *originPath {
+	switch typed := node.(type) {
+	case *parse.DotNode:
+		return dot
+	case *parse.FieldNode:
+		return dot.field(typed.Ident...)
+	case *parse.VariableNode:
+		path := vars[typed.Ident[0]]
+		if len(typed.Ident) > 1 {
+			path = path.field(typed.Ident[1:]...)
+		}
+		return path
+	case *parse.ChainNode:
+		return o.operand(typed.Node, dot, vars).field(typed.Field...)
+	case *parse.PipeNode:
+		return o.pipe(typed, dot, vars)
+	}
+	return nil
+}
+
+// index follows {{ index .items 0 "name" }} when every key is a constant.
+func (o *originInstrumenter) index(args []parse.Node, dot *originPath, vars map[string]*originPath) *originPath {
+	if len(args) == 0 {
+		return nil
+	}
+	path := o.operand(args[0], dot, vars)
+	for _, key := range args[1:] {
+		if path == nil {
+			return nil
+		}
+		switch typed := key.(type) {
+		case *parse.NumberNode:
+			if !typed.IsInt {
+				return nil
+			}
+			path = &originPath{spec: path.spec + "[" + strconv.FormatInt(typed.Int64, 10) + "]", indexes: path.indexes}
+		case *parse.StringNode:
+			path = path.field(typed.Text)
+		default:
+			return nil
+		}
+	}
+	return path
+}
+
+// call builds {{ $name := name "path" "span" $indexes... }}.
+func (o *originInstrumenter) call(pos parse.Pos, name, path, span string, indexes []string) *parse.ActionNode {
+	action := hiddenCall(o.tree, pos, name, path)
+	command := action.Pipe.Cmds[0]
+	command.Args = append(command.Args, &parse.StringNode{NodeType: parse.NodeString, Pos: pos, Quoted: strconv.Quote(span), Text: span})
+	for _, index := range indexes {
+		command.Args = append(command.Args, &parse.VariableNode{NodeType: parse.NodeVariable, Pos: pos, Ident: []string{index}})
+	}
+	return action
+}
+
+func cloneOriginVars(vars map[string]*originPath) map[string]*originPath {
+	clone := make(map[string]*originPath, len(vars))
+	for name, path := range vars {
+		clone[name] = path
+	}
+	return clone
+}
+
+// originRecorder counts the bytes a render writes and notes the range each
+// marked action wrote, resolving its path against the dot of the
+// {{template}} call it runs in.
+type originRecorder struct {
+	out     io.Writer
+	written int
+	calls   []*string
+	open    *originMark
+	marks   []originMark
+}
+
+type originMark struct {
+	start, end int
+	path, span string
+}
+
+func (r *originRecorder) Write(p []byte) (int, error) {
+	n, err := r.out.Write(p)
+	r.written += n
+	return n, err
+}
+
+// mark is registered as originMarkFunc. The call after an action has an
+// empty span and closes the range the call before it opened.
+func (r *originRecorder) mark(spec, span string, indexes ...interface{}) string {
+	if r.open != nil {
+		r.open.end = r.written
+		if r.open.end > r.open.start {
+			r.marks = append(r.marks, *r.open)
+		}
+		r.open = nil
+	}
+	if span == "" {
+		return ""
+	}
+	if path, ok := r.resolve(spec, indexes); ok {
+		r.open = &originMark{start: r.written, path: path, span: span}
+	}
+	return ""
+}
+
+// enter is registered as originEnterFunc; known is empty when the path of
+// the data passed to the template could not be worked out.
+func (r *originRecorder) enter(spec, known string, indexes ...interface{}) string {
+	var call *string
+	if known != "" {
+		if path, ok := r.resolve(spec, indexes); ok {
+			call = &path
+		}
+	}
+	r.calls = append(r.calls, call)
+	return ""
+}
+
+// exit is registered as originExitFunc.
+func (r *originRecorder) exit(string, string) string {
+	if len(r.calls) > 0 {
+		r.calls = r.calls[:len(r.calls)-1]
+	}
+	return ""
+}
+
+func (r *originRecorder) resolve(spec string, indexes []interface{}) (string, bool) {
+	base := ""
+	if len(r.calls) > 0 {
+		top := r.calls[len(r.calls)-1]
+		if top == nil {
+			return "", false
+		}
+		base = *top
+	}
+	var path strings.Builder
+	path.WriteString(base)
+	for i, part := range strings.Split(spec, originIndexSlot) {
+		if i > 0 {
+			if i > len(indexes) {
+				return "", false
+			}
+			path.WriteString(originIndex(indexes[i-1]))
+		}
+		path.WriteString(part)
+	}
+	return path.String(), true
+}
+
+// originIndex formats a range index or map key as a path segment, the way
+// context diffs write paths: [2] for an index, .key for a key.
+func originIndex(index interface{}) string {
+	value := reflect.ValueOf(index)
+	switch value.Kind() {
+	case reflect.String:
+		return "." + value.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "[" + strconv.FormatInt(value.Int(), 10) + "]"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return "[" + strconv.FormatUint(value.Uint(), 10) + "]"
+	}
+	return fmt.Sprintf("[%v]", index)
+}
+
+// origins turns the marks into output ranges, in output order. sources
+// maps template names to the file and content they were parsed from.
+func (r *originRecorder) origins(sources map[string]templateSource) []valueOrigin {
+	var result []valueOrigin
+	for _, mark := range r.marks {
+		mapping, ok := decodeSourceSpan(mark.span, sources)
+		if !ok {
+			continue
+		}
+		path := mark.path
+		if !strings.HasPrefix(path, ".") {
+			path = "." + path
+		}
+		result = append(result, valueOrigin{
+			OutputStart: mark.start,
+			OutputEnd:   mark.end,
+			Path:        path,
+			File:        mapping.File,
+			Line:        mapping.Line,
+			Column:      mapping.Column,
+			EndLine:     mapping.EndLine,
+			EndColumn:   mapping.EndColumn,
+		})
+	}
+	return result
+}
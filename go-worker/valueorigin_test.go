@@ -0,0 +1,64 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestValueOriginsNamesTheContextPathOfEachValue(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "page.html")
+	writeFile(t, templatePath, "<h1>{{ .user.name | upper }}</h1>"+
+		"{{ with .user.billing }}{{ .plan }}{{ end }}"+
+		"{{ range .items }}<li>{{ .sku }}</li>{{ end }}"+
+		"{{ range $key, $value := .tags }}{{ $value }}{{ end }}"+
+		"{{ $first := index .items 0 }}{{ $first.sku }}"+
+		"{{ printf \"%d items\" (len .items) }}{{ \"literal\" }}")
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, contextPath, `{"user": {"name": "ada", "billing": {"plan": "pro"}}, "items": [{"sku": "a1"}, {"sku": "b2"}], "tags": {"x": "<1>"}}`)
+
+	resp := run(templatePath, contextPath, renderOptions{ValueOrigins: true})
+	if resp.Error != "" || resp.Rendered != "<h1>ADA</h1>pro<li>a1</li><li>b2</li>&lt;1&gt;a12 itemsliteral" {
+		t.Fatalf("unexpected render: %+v", resp)
+	}
+	type origin struct{ output, path string }
+	var got []origin
+	for _, value := range resp.ValueOrigins {
+		got = append(got, origin{resp.Rendered[value.OutputStart:value.OutputEnd], value.Path})
+	}
+	want := []origin{
+		{"ADA", ".user.name"},
+		{"pro", ".user.billing.plan"},
+		{"a1", ".items[0].sku"},
+		{"b2", ".items[1].sku"},
+		{"&lt;1&gt;", ".tags.x"},
+		{"a1", ".items[0].sku"},
+		{"2 items", ".items"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected origins:\n got %+v\nwant %+v", got, want)
+	}
+	if first := resp.ValueOrigins[0]; first.File != templatePath || first.Line != 1 || first.Column != 5 || first.EndColumn != 29 {
+		t.Fatalf("unexpected action position: %+v", first)
+	}
+}
+
+func TestValueOriginsFollowTemplateCallsAndSkipReassignedVariables(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "page.tmpl")
+	writeFile(t, templatePath, "{{ range .orders }}{{ template \"order\" .customer }}{{ end }}"+
+		"{{ template \"order\" (dict \"name\" \"x\") }}"+
+		"{{ $name := .owner }}{{ if .orders }}{{ $name = \"y\" }}{{ end }}{{ $name }}"+
+		"{{ define \"order\" }}[{{ .name }}]{{ end }}")
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, contextPath, `{"owner": "z", "orders": [{"customer": {"name": "Ada"}}]}`)
+
+	resp := run(templatePath, contextPath, renderOptions{ValueOrigins: true})
+	if resp.Error != "" || resp.Rendered != "[Ada][x]y" {
+		t.Fatalf("unexpected render: %+v", resp)
+	}
+	if len(resp.ValueOrigins) != 1 || resp.ValueOrigins[0].Path != ".orders[0].customer.name" || resp.ValueOrigins[0].OutputStart != 1 || resp.ValueOrigins[0].Line != 1 {
+		t.Fatalf("unexpected origins: %+v", resp.ValueOrigins)
+	}
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// maxContentLineOctets is the longest a line may be before it must be
+// folded, in both iCalendar (RFC 5545) and vCard (RFC 6350).
+const maxContentLineOctets = 75
+
+var (
+	contentLineName   = regexp.MustCompile(`^[A-Za-z0-9-]+$`)
+	icsDatePattern    = regexp.MustCompile(`^[0-9]{8}$`)
+	icsDateTime       = regexp.MustCompile(`^[0-9]{8}T[0-9]{6}Z?$`)
+	vcardDatePattern  = regexp.MustCompile(`^([0-9]{8}|[0-9]{4}-[0-9]{2}-[0-9]{2}|[0-9]{4}-[0-9]{2}|[0-9]{4}|--[0-9]{4}|--[0-9]{2}-[0-9]{2}|---[0-9]{2})$`)
+	vcardTimePattern  = regexp.MustCompile(`^[0-9]{2}(:?[0-9]{2}(:?[0-9]{2})?)?(Z|[+-][0-9]{2}(:?[0-9]{2})?)?$`)
+	vcardVersionValue = map[string]bool{"2.1": true, "3.0": true, "4.0": true}
+)
+
+// iCalendar date properties, and those of them that must be in UTC.
+var (
+	icsDateProperties = map[string]bool{
+		"DTSTART": true, "DTEND": true, "DUE": true, "RECURRENCE-ID": true, "EXDATE": true,
+		"DTSTAMP": true, "CREATED": true, "LAST-MODIFIED": true, "COMPLETED": true,
+	}
+	icsUTCProperties = map[string]bool{"DTSTAMP": true, "CREATED": true, "LAST-MODIFIED": true, "COMPLETED": true}
+)
+
+// icsRequired lists the properties each iCalendar component must have.
+// DTSTART is checked separately because METHOD relaxes it.
+var icsRequired = map[string][]string{
+	"VCALENDAR": {"PRODID", "VERSION"},
+	"VEVENT":    {"UID", "DTSTAMP"},
+	"VTODO":     {"UID", "DTSTAMP"},
+	"VJOURNAL":  {"UID", "DTSTAMP"},
+	"VTIMEZONE": {"TZID"},
+	"VALARM":    {"ACTION", "TRIGGER"},
+}
+
+// contentLine is one unfolded line of iCalendar or vCard output. Line is the
+// output line it starts on.
+type contentLine struct {
+	Line   int
+	Name   string
+	Params map[string]string
+	Value  string
+}
+
+// vComponent is a BEGIN/END block and the properties seen directly in it.
+type vComponent struct {
+	name  string
+	line  int
+	props map[string]contentLine
+}
+
+// contentLineProblem reports a problem on a line of rendered output.
+func contentLineProblem(format string, line int, severity, message string) diagnostic {
+	return diagnostic{Message: fmt.Sprintf("rendered %s line %d: %s", format, line, message), Severity: severity}
+}
+
+// parseContentLines unfolds rendered output into content lines. Missing CRLF
+// line endings, over-long lines, and blank lines are warnings, since most
+// clients accept them; lines that are not name:value pairs are errors.
+func parseContentLines(rendered, format string) ([]contentLine, []diagnostic) {
+	var (
+		lines    []contentLine
+		problems []diagnostic
+		bareLF   int
+		long     []int
+	)
+	physical := strings.Split(rendered, "\n")
+	if physical[len(physical)-1] == "" {
+		physical = physical[:len(physical)-1]
+	}
+	for i, text := range physical {
+		number := i + 1
+		if trimmed := strings.TrimSuffix(text, "\r"); trimmed != text {
+			text = trimmed
+		} else if i < len(physical)-1 || strings.HasSuffix(rendered, "\n") {
+			bareLF++
+		}
+		if len(text) > maxContentLineOctets {
+			long = append(long, number)
+		}
+
+		switch {
+		case text == "":
+			problems = append(problems, contentLineProblem(format, number, "warning", "blank lines are not allowed"))
+		case text[0] == ' ' || text[0] == '\t':
+			if len(lines) == 0 {
+				problems = append(problems, contentLineProblem(format, number, "error", "continuation line has nothing to continue"))
+				continue
+			}
+			lines[len(lines)-1].Value += text[1:]
+		default:
+			lines = append(lines, contentLine{Line: number, Value: text})
+		}
+	}
+
+	if bareLF > 0 {
+		problems = append(problems, diagnostic{
+			Message:  fmt.Sprintf("rendered %s ends %d %s with LF instead of CRLF", format, bareLF, plural(bareLF, "line")),
+			Severity: "warning",
+		})
+	}
+	if len(long) > 0 {
+		problems = append(problems, diagnostic{
+			Message:  fmt.Sprintf("rendered %s has %d %s longer than %d octets, starting at line %d; fold them with CRLF and a space", format, len(long), plural(len(long), "line"), maxContentLineOctets, long[0]),
+			Severity: "warning",
+		})
+	}
+
+	parsed := lines[:0]
+	for _, line := range lines {
+		if err := splitContentLine(&line); err != "" {
+			problems = append(problems, contentLineProblem(format, line.Line, "error", err))
+			continue
+		}
+		parsed = append(parsed, line)
+	}
+	return parsed, problems
+}
+
+// splitContentLine splits line.Value, which holds the whole unfolded line,
+// into name, parameters, and value. Parameter values may be quoted.
+func splitContentLine(line *contentLine) string {
+	text := line.Value
+	end := strings.IndexAny(text, ";:")
+	if end < 0 {
+		return fmt.Sprintf("%q is not a NAME:value line", text)
+	}
+	line.Name = strings.ToUpper(text[:end])
+	if !contentLineName.MatchString(line.Name) {
+		return fmt.Sprintf("invalid property name %q", text[:end])
+	}
+
+	line.Params = map[string]string{}
+	rest := text[end:]
+	for strings.HasPrefix(rest, ";") {
+		rest = rest[1:]
+		equals := strings.IndexByte(rest, '=')
+		if equals < 0 {
+			return fmt.Sprintf("parameter of %s has no value", line.Name)
+		}
+		name := strings.ToUpper(rest[:equals])
+		rest = rest[equals+1:]
+
+		var value strings.Builder
+		for len(rest) > 0 && rest[0] != ';' && rest[0] != ':' {
+			if rest[0] == '"' {
+				closing := strings.IndexByte(rest[1:], '"')
+				if closing < 0 {
+					return fmt.Sprintf("unterminated quoted parameter value of %s", line.Name)
+				}
+				value.WriteString(rest[1 : closing+1])
+				rest = rest[closing+2:]
+				continue
+			}
+			value.WriteByte(rest[0])
+			rest = rest[1:]
+		}
+		line.Params[name] = value.String()
+	}
+	if !strings.HasPrefix(rest, ":") {
+		return fmt.Sprintf("%s has no value", line.Name)
+	}
+	line.Value = rest[1:]
+	return ""
+}
+
+// walkComponents matches BEGIN and END lines, checking that every top-level
+// component is named root, and calls closed for each complete component
+// with the components enclosing it.
+func walkComponents(lines []contentLine, format, root string, closed func(c vComponent, parents []vComponent) []diagnostic) []diagnostic {
+	var (
+		problems []diagnostic
+		stack    []vComponent
+		roots    int
+	)
+	for _, line := range lines {
+		switch line.Name {
+		case "BEGIN":
+			name := strings.ToUpper(line.Value)
+			if len(stack) == 0 {
+				roots++
+				if name != root {
+					problems = append(problems, contentLineProblem(format, line.Line, "error", fmt.Sprintf("expected BEGIN:%s, got BEGIN:%s", root, name)))
+				}
+			}
+			stack = append(stack, vComponent{name: name, line: line.Line, props: map[string]contentLine{}})
+		case "END":
+			name := strings.ToUpper(line.Value)
+			if len(stack) == 0 {
+				problems = append(problems, contentLineProblem(format, line.Line, "error", fmt.Sprintf("END:%s has no matching BEGIN", name)))
+				continue
+			}
+			top := stack[len(stack)-1]
+			if top.name != name {
+				problems = append(problems, contentLineProblem(format, line.Line, "error", fmt.Sprintf("END:%s closes BEGIN:%s from line %d", name, top.name, top.line)))
+			}
+			stack = stack[:len(stack)-1]
+			problems = append(problems, closed(top, stack)...)
+		default:
+			if len(stack) == 0 {
+				problems = append(problems, contentLineProblem(format, line.Line, "error", fmt.Sprintf("%s is outside BEGIN:%s", line.Name, root)))
+				continue
+			}
+			top := stack[len(stack)-1]
+			if _, seen := top.props[line.Name]; !seen {
+				top.props[line.Name] = line
+			}
+		}
+	}
+
+	for i := len(stack) - 1; i >= 0; i-- {
+		problems = append(problems, contentLineProblem(format, stack[i].line, "error", fmt.Sprintf("BEGIN:%s is never closed", stack[i].name)))
+	}
+	if roots == 0 {
+		problems = append(problems, diagnostic{Message: fmt.Sprintf("rendered %s has no BEGIN:%s", format, root), Severity: "error"})
+	}
+	return problems
+}
+
+// validateICS checks rendered output against RFC 5545: line structure,
+// the properties each component requires, and date and date-time values.
+func validateICS(rendered string) []diagnostic {
+	const format = "iCalendar"
+	lines, problems := parseContentLines(rendered, format)
+	for _, line := range lines {
+		if icsDateProperties[line.Name] {
+			problems = append(problems, checkICSDates(format, line)...)
+		}
+	}
+	return append(problems, walkComponents(lines, format, "VCALENDAR", func(c vComponent, parents []vComponent) []diagnostic {
+		var problems []diagnostic
+		missing := missingProperties(c, icsRequired[c.name])
+		if c.name == "VEVENT" && len(parents) > 0 {
+			if _, method := parents[0].props["METHOD"]; !method {
+				missing = append(missing, missingProperties(c, []string{"DTSTART"})...)
+			}
+		}
+		if len(missing) > 0 {
+			problems = append(problems, contentLineProblem(format, c.line, "error", fmt.Sprintf("%s is missing %s", c.name, strings.Join(missing, ", "))))
+		}
+		if version, ok := c.props["VERSION"]; ok && c.name == "VCALENDAR" && version.Value != "2.0" {
+			problems = append(problems, contentLineProblem(format, version.Line, "error", fmt.Sprintf("VERSION must be 2.0, got %q", version.Value)))
+		}
+		_, hasEnd := c.props["DTEND"]
+		if duration, ok := c.props["DURATION"]; ok && hasEnd && c.name == "VEVENT" {
+			problems = append(problems, contentLineProblem(format, duration.Line, "error", "VEVENT has both DTEND and DURATION"))
+		}
+		return problems
+	})...)
+}
+
+// checkICSDates checks each value of a date property: a DATE (20240131)
+// when VALUE=DATE, and otherwise a DATE-TIME (20240131T090000, with a
+// trailing Z for UTC).
+func checkICSDates(format string, line contentLine) []diagnostic {
+	var problems []diagnostic
+	isDate := strings.EqualFold(line.Params["VALUE"], "DATE")
+	for _, value := range strings.Split(line.Value, ",") {
+		var message string
+		switch {
+		case isDate && !icsDatePattern.MatchString(value):
+			message = fmt.Sprintf("%s value %q is not a DATE such as 20240131", line.Name, value)
+		case !isDate && icsDatePattern.MatchString(value):
+			message = fmt.Sprintf("%s value %q is a DATE; add ;VALUE=DATE or give a time such as %sT090000Z", line.Name, value, value)
+		case !isDate && !icsDateTime.MatchString(value):
+			message = fmt.Sprintf("%s value %q is not a DATE-TIME such as 20240131T090000Z", line.Name, value)
+		case !isDate && icsUTCProperties[line.Name] && !strings.HasSuffix(value, "Z"):
+			message = fmt.Sprintf("%s value %q must be in UTC, ending in Z", line.Name, value)
+		case !isDate && line.Params["TZID"] != "" && strings.HasSuffix(value, "Z"):
+			message = fmt.Sprintf("%s value %q is UTC but also has a TZID", line.Name, value)
+		default:
+			if _, err := time.Parse("20060102", value[:8]); err != nil {
+				message = fmt.Sprintf("%s value %q is not a real date", line.Name, value)
+			} else if !isDate {
+				if _, err := time.Parse("150405", value[9:15]); err != nil {
+					message = fmt.Sprintf("%s value %q is not a real time", line.Name, value)
+				}
+			}
+		}
+		if message != "" {
+			problems = append(problems, contentLineProblem(format, line.Line, "error", message))
+		}
+	}
+	return problems
+}
+
+// validateVCard checks rendered output against RFC 6350 (and 2426 for
+// version 3.0): line structure, VERSION and FN on every card, N on 3.0
+// cards, and the format of BDAY, ANNIVERSARY, and REV.
+func validateVCard(rendered string) []diagnostic {
+	const format = "vCard"
+	lines, problems := parseContentLines(rendered, format)
+	return append(problems, walkComponents(lines, format, "VCARD", func(c vComponent, parents []vComponent) []diagnostic {
+		if c.name != "VCARD" {
+			return nil
+		}
+		var problems []diagnostic
+		required := []string{"VERSION", "FN"}
+		version, ok := c.props["VERSION"]
+		if ok && version.Value == "3.0" {
+			required = append(required, "N")
+		}
+		if missing := missingProperties(c, required); len(missing) > 0 {
+			problems = append(problems, contentLineProblem(format, c.line, "error", fmt.Sprintf("VCARD is missing %s", strings.Join(missing, ", "))))
+		}
+		if ok && !vcardVersionValue[version.Value] {
+			problems = append(problems, contentLineProblem(format, version.Line, "error", fmt.Sprintf("VERSION must be 2.1, 3.0, or 4.0, got %q", version.Value)))
+		}
+		for _, name := range []string{"BDAY", "ANNIVERSARY", "REV"} {
+			line, ok := c.props[name]
+			if !ok || strings.EqualFold(line.Params["VALUE"], "text") || validVCardDate(line.Value) {
+				continue
+			}
+			problems = append(problems, contentLineProblem(format, line.Line, "error", fmt.Sprintf("%s value %q is not a date such as 1990-01-31 or 19900131", name, line.Value)))
+		}
+		return problems
+	})...)
+}
+
+// validVCardDate accepts a date, a reduced-precision date such as --0131,
+// or either followed by T and a time.
+func validVCardDate(value string) bool {
+	date, clock, hasTime := strings.Cut(value, "T")
+	if !vcardDatePattern.MatchString(date) {
+		return false
+	}
+	return !hasTime || vcardTimePattern.MatchString(clock)
+}
+
+func missingProperties(c vComponent, required []string) []string {
+	var missing []string
+	for _, name := range required {
+		if _, ok := c.props[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func diagnosticMessages(diags []diagnostic) []string {
+	messages := make([]string, len(diags))
+	for i, diag := range diags {
+		messages[i] = diag.Severity + ": " + diag.Message
+	}
+	return messages
+}
+
+func TestValidateICSAcceptsWellFormedCalendar(t *testing.T) {
+	calendar := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//Example//Invites//EN",
+		"BEGIN:VEVENT",
+		"UID:42@example.com",
+		"DTSTAMP:20240131T080000Z",
+		"DTSTART;TZID=Europe/Berlin:20240201T090000",
+		"DTEND;VALUE=DATE:20240202",
+		"SUMMARY;LANGUAGE=en:A meeting title long enough that the template folds it",
+		"  onto a second line",
+		"ATTENDEE;CN=\"Doe; Jane\":mailto:jane@example.com",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n") + "\r\n"
+
+	if problems := validateICS(calendar); len(problems) != 0 {
+		t.Fatalf("unexpected problems: %q", diagnosticMessages(problems))
+	}
+}
+
+func TestValidateICSReportsProblems(t *testing.T) {
+	calendar := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:1.0",
+		"BEGIN:VEVENT",
+		"DTSTAMP:20240131T080000",
+		"DTSTART:20240231",
+		"DTEND:20240201T250000Z",
+		"SUMMARY " + strings.Repeat("x", 80),
+		"END:VEVENT",
+		"",
+		"END:VCALENDAR",
+	}, "\n")
+
+	want := []string{
+		"warning: rendered iCalendar line 9: blank lines are not allowed",
+		"warning: rendered iCalendar ends 9 lines with LF instead of CRLF",
+		"warning: rendered iCalendar has 1 line longer than 75 octets, starting at line 7; fold them with CRLF and a space",
+		`error: rendered iCalendar line 7: "SUMMARY ` + strings.Repeat("x", 80) + `" is not a NAME:value line`,
+		`error: rendered iCalendar line 4: DTSTAMP value "20240131T080000" must be in UTC, ending in Z`,
+		`error: rendered iCalendar line 5: DTSTART value "20240231" is a DATE; add ;VALUE=DATE or give a time such as 20240231T090000Z`,
+		`error: rendered iCalendar line 6: DTEND value "20240201T250000Z" is not a real time`,
+		"error: rendered iCalendar line 3: VEVENT is missing UID",
+		"error: rendered iCalendar line 1: VCALENDAR is missing PRODID",
+		`error: rendered iCalendar line 2: VERSION must be 2.0, got "1.0"`,
+	}
+	got := diagnosticMessages(validateICS(calendar))
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestValidateICSReportsStructure(t *testing.T) {
+	got := diagnosticMessages(validateICS("BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nEND:VCALENDAR\r\n"))
+	want := []string{
+		"error: rendered iCalendar line 3: END:VCALENDAR closes BEGIN:VEVENT from line 2",
+		"error: rendered iCalendar line 2: VEVENT is missing UID, DTSTAMP, DTSTART",
+		"error: rendered iCalendar line 1: BEGIN:VCALENDAR is never closed",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	got = diagnosticMessages(validateICS("X-ORPHAN:1\r\n"))
+	want = []string{
+		"error: rendered iCalendar line 1: X-ORPHAN is outside BEGIN:VCALENDAR",
+		"error: rendered iCalendar has no BEGIN:VCALENDAR",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestValidateVCard(t *testing.T) {
+	cards := strings.Join([]string{
+		"BEGIN:VCARD",
+		"VERSION:4.0",
+		"FN:Jane Doe",
+		"BDAY:--0131",
+		"REV:20240131T080000Z",
+		"END:VCARD",
+		"BEGIN:VCARD",
+		"VERSION:3.0",
+		"FN:John Doe",
+		"BDAY:31/01/1990",
+		"END:VCARD",
+		"BEGIN:VCARD",
+		"VERSION:5.0",
+		"END:VCARD",
+	}, "\r\n") + "\r\n"
+
+	want := []string{
+		"error: rendered vCard line 7: VCARD is missing N",
+		`error: rendered vCard line 10: BDAY value "31/01/1990" is not a date such as 1990-01-31 or 19900131`,
+		"error: rendered vCard line 12: VCARD is missing FN",
+		`error: rendered vCard line 13: VERSION must be 2.1, 3.0, or 4.0, got "5.0"`,
+	}
+	got := diagnosticMessages(validateVCard(cards))
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestPostICSValidateFailsRender(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "invite.ics.tmpl")
+	writeFile(t, templatePath, "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//Example//EN\r\nBEGIN:VEVENT\r\nUID:{{ .id }}\r\nDTSTAMP:20240131T080000Z\r\nDTSTART:{{ .start }}\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n")
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, contextPath, `{"id": "1@example.com", "start": "2024-02-01 09:00"}`)
+
+	resp := run(templatePath, contextPath, renderOptions{Post: []string{postICSValidate}})
+	if resp.Error != `rendered iCalendar line 7: DTSTART value "2024-02-01 09:00" is not a DATE-TIME such as 20240131T090000Z` || resp.Rendered == "" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	writeFile(t, contextPath, `{"id": "1@example.com", "start": "20240201T090000Z"}`)
+	resp = run(templatePath, contextPath, renderOptions{Post: []string{postICSValidate}})
+	if resp.Error != "" || len(resp.Diagnostics) != 0 {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+}
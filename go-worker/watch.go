@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// watchPollInterval is how often --watch checks the files a render read.
+// Polling keeps the worker free of platform file-event APIs, and a quarter
+// second is below what a person saving a file notices.
+const watchPollInterval = 250 * time.Millisecond
+
+// watchEvent is one line --watch writes: a render, the files whose change
+// caused it, and the response as a one-shot render would have written it.
+// The first event, rendered at startup, has no changed files.
+type watchEvent struct {
+	Event    string      `json:"event"`
+	Changed  []string    `json:"changed,omitempty"`
+	Response interface{} `json:"response"`
+}
+
+// fileStamp is what a file is compared by between polls. A file that does
+// not exist has the zero stamp, so creating or deleting one is a change.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// watch renders the template, then renders it again whenever the template,
+// an include it resolves, or a context file changes, writing one
+// watchEvent per render to w. The set of files is worked out again after
+// every poll, so a newly matched include or alias is watched from then on.
+// Parsed templates are cached across renders as in --serve. It returns when
+// stop is closed.
+func watch(templatePath, contextPath string, opts renderOptions, w io.Writer, hook *notifier, stop <-chan struct{}, interval time.Duration) error {
+	opts.cache = newTemplateCache()
+	encoder := json.NewEncoder(w)
+	render := func(changed []string) error {
+		start := time.Now()
+		resp := run(templatePath, contextPath, opts)
+		resp.DurationMs = time.Since(start).Milliseconds()
+		if hook != nil {
+			hook.notify(newRenderSummary(nil, templatePath, contextPath, opts, resp))
+		}
+		return encoder.Encode(watchEvent{Event: "render", Changed: changed, Response: versionedResponse(resp, opts.ResponseVersion)})
+	}
+
+	stamps := stampFiles(watchedFiles(templatePath, contextPath, opts))
+	if err := render(nil); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		}
+		current := stampFiles(watchedFiles(templatePath, contextPath, opts))
+		changed := changedFiles(stamps, current)
+		stamps = current
+		if len(changed) == 0 {
+			continue
+		}
+		if err := render(changed); err != nil {
+			return err
+		}
+	}
+}
+
+// watchedFiles lists the local files a render of templatePath reads: the
+// template, its --include matches and template aliases, the project
+// config, and every context file. Remote templates and contexts, stdin,
+// and object storage have no file to watch and are left out.
+func watchedFiles(templatePath, contextPath string, opts renderOptions) []string {
+	var files []string
+	add := func(path string) {
+		if strings.TrimSpace(path) == "" || path == stdinContextPath || strings.Contains(path, "://") {
+			return
+		}
+		files = append(files, path)
+	}
+
+	add(templatePath)
+	add(contextPath)
+	for _, layer := range opts.ContextLayers {
+		add(layer)
+	}
+	for _, profile := range opts.ContextProfiles {
+		add(profile.Path)
+	}
+	add(opts.ContextManifest)
+	add(opts.ContextSchema)
+
+	if strings.TrimSpace(opts.Config) != "" {
+		add(opts.Config)
+		if project, err := loadProjectConfig(opts.Config); err == nil {
+			opts.project = project
+			opts.Includes = append(append([]string{}, opts.Includes...), project.Includes...)
+		}
+	}
+	includes, _ := resolveIncludePatterns(templatePath, opts)
+	for _, include := range includes {
+		add(include.Path)
+	}
+	if content, err := readTemplate(templatePath, opts); err == nil {
+		aliases, _ := resolveAliasIncludes(templatePath, content, opts)
+		for _, alias := range aliases {
+			add(alias.Path)
+		}
+	}
+	return files
+}
+
+func stampFiles(files []string) map[string]fileStamp {
+	stamps := make(map[string]fileStamp, len(files))
+	for _, file := range files {
+		var stamp fileStamp
+		if info, err := os.Stat(file); err == nil {
+			stamp = fileStamp{modTime: info.ModTime(), size: info.Size()}
+		}
+		stamps[file] = stamp
+	}
+	return stamps
+}
+
+// changedFiles returns, sorted, the files whose stamp differs between two
+// polls, including files that joined or left the watched set.
+func changedFiles(previous, current map[string]fileStamp) []string {
+	var changed []string
+	for file, stamp := range current {
+		if old, ok := previous[file]; !ok || !old.modTime.Equal(stamp.modTime) || old.size != stamp.size {
+			changed = append(changed, file)
+		}
+	}
+	for file := range previous {
+		if _, ok := current[file]; !ok {
+			changed = append(changed, file)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testWatchEvent struct {
+	Event    string   `json:"event"`
+	Changed  []string `json:"changed"`
+	Response response `json:"response"`
+}
+
+func TestWatchRendersAgainOnChange(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "page.tmpl")
+	includePath := filepath.Join(dir, "partials", "footer.tmpl")
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, templatePath, `{{ .name }} {{ template "footer.tmpl" }}`)
+	writeFile(t, includePath, `{{ define "footer.tmpl" }}v1{{ end }}`)
+	writeFile(t, contextPath, `{"name":"web"}`)
+
+	reader, writer := io.Pipe()
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	opts := renderOptions{Includes: []string{filepath.Join(dir, "partials", "*.tmpl")}}
+	go func() {
+		done <- watch(templatePath, contextPath, opts, writer, nil, stop, 10*time.Millisecond)
+		writer.Close()
+	}()
+
+	events := json.NewDecoder(reader)
+	next := func() testWatchEvent {
+		t.Helper()
+		var event testWatchEvent
+		if err := events.Decode(&event); err != nil {
+			t.Fatalf("failed to read event: %v", err)
+		}
+		return event
+	}
+
+	if event := next(); event.Event != "render" || event.Changed != nil || event.Response.Rendered != "web v1" {
+		t.Fatalf("unexpected first event: %+v", event)
+	}
+
+	replaceFile(t, contextPath, `{"name":"mail"}`)
+	if event := next(); !reflect.DeepEqual(event.Changed, []string{contextPath}) || event.Response.Rendered != "mail v1" {
+		t.Fatalf("unexpected context event: %+v", event)
+	}
+
+	replaceFile(t, includePath, `{{ define "footer.tmpl" }}v2!{{ end }}`)
+	if event := next(); !reflect.DeepEqual(event.Changed, []string{includePath}) || event.Response.Rendered != "mail v2!" {
+		t.Fatalf("unexpected include event: %+v", event)
+	}
+
+	// An include matched for the first time is a change too.
+	extraPath := filepath.Join(dir, "partials", "header.tmpl")
+	replaceFile(t, extraPath, `{{ define "header.tmpl" }}h{{ end }}`)
+	if event := next(); !reflect.DeepEqual(event.Changed, []string{extraPath}) || event.Response.Error != "" {
+		t.Fatalf("unexpected new include event: %+v", event)
+	}
+
+	close(stop)
+	go func() { _, _ = io.Copy(io.Discard, reader) }()
+	if err := <-done; err != nil {
+		t.Fatalf("watch failed: %v", err)
+	}
+}
+
+func TestChangedFiles(t *testing.T) {
+	now := time.Now()
+	previous := map[string]fileStamp{"a": {modTime: now, size: 1}, "b": {modTime: now, size: 1}, "c": {}}
+	current := map[string]fileStamp{"a": {modTime: now, size: 1}, "b": {modTime: now, size: 2}, "d": {}}
+	if got := changedFiles(previous, current); !reflect.DeepEqual(got, []string{"b", "c", "d"}) {
+		t.Fatalf("unexpected changed files: %v", got)
+	}
+}
+
+// replaceFile writes path by renaming a finished file over it, so a poll
+// never sees it half written.
+func replaceFile(t *testing.T, path, content string) {
+	t.Helper()
+	writeFile(t, path+".new", content)
+	if err := os.Rename(path+".new", path); err != nil {
+		t.Fatalf("failed to replace %s: %v", path, err)
+	}
+}
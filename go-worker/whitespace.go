@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// templateIndent puts spaces spaces before every line of value, blank lines
+// included, as Sprig's indent does. A YAML block goes under a key with
+// nindent, which starts with the newline the key's line needs:
+//
+//	metadata:
+//	  labels: {{- .labels | toYaml | nindent 4 }}
+func templateIndent(spaces interface{}, value interface{}) (string, error) {
+	pad, err := indentPad("indent", spaces)
+	if err != nil {
+		return "", err
+	}
+	return pad + strings.ReplaceAll(toString(value), "\n", "\n"+pad), nil
+}
+
+func templateNindent(spaces interface{}, value interface{}) (string, error) {
+	pad, err := indentPad("nindent", spaces)
+	if err != nil {
+		return "", err
+	}
+	return "\n" + pad + strings.ReplaceAll(toString(value), "\n", "\n"+pad), nil
+}
+
+func indentPad(name string, spaces interface{}) (string, error) {
+	n, err := toNumber(name, spaces)
+	if err != nil {
+		return "", err
+	}
+	if !n.isInt || n.i < 0 || n.i > maxIndent {
+		return "", fmt.Errorf("%s: spaces must be a whole number from 0 to %d, got %v", name, maxIndent, spaces)
+	}
+	return strings.Repeat(" ", int(n.i)), nil
+}
+
+// maxIndent bounds indent and nindent, so a typo cannot make a line of a
+// million spaces.
+const maxIndent = 1024
+
+func templateTrimPrefix(prefix interface{}, value interface{}) string {
+	return strings.TrimPrefix(toString(value), toString(prefix))
+}
+
+func templateTrimSuffix(suffix interface{}, value interface{}) string {
+	return strings.TrimSuffix(toString(value), toString(suffix))
+}
+
+// templateQuote wraps each value in double quotes, escaped as a Go string
+// literal, which is also a valid YAML and JSON string for printable text.
+// Like Sprig, nil values are left out and the rest are joined with spaces.
+func templateQuote(values ...interface{}) string {
+	return quoteEach(values, strconv.Quote)
+}
+
+// templateSquote wraps each value in single quotes without escaping.
+func templateSquote(values ...interface{}) string {
+	return quoteEach(values, func(s string) string { return "'" + s + "'" })
+}
+
+// templateShellQuote quotes each value as a single POSIX shell word: inside
+// single quotes nothing is special, so only the single quotes themselves
+// need ending the quote, escaping, and starting it again.
+func templateShellQuote(values ...interface{}) string {
+	return quoteEach(values, func(s string) string { return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'" })
+}
+
+func quoteEach(values []interface{}, quote func(string) string) string {
+	quoted := make([]string, 0, len(values))
+	for _, value := range values {
+		if value != nil {
+			quoted = append(quoted, quote(toString(value)))
+		}
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIndentHelpersBuildYAMLBlocks(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "deployment.yaml.tmpl")
+	writeFile(t, templatePath, "metadata:\n  labels: {{- .labels | toYaml | nindent 4 }}\n  script: |\n{{ .script | indent 4 }}\n")
+	contextPath := filepath.Join(dir, "context.json")
+	writeFile(t, contextPath, `{"labels": {"app": "web", "tier": "front"}, "script": "echo hi\n\necho bye"}`)
+
+	resp := run(templatePath, contextPath, renderOptions{})
+	want := "metadata:\n  labels:\n    app: web\n    tier: front\n  script: |\n    echo hi\n    \n    echo bye\n"
+	if resp.Error != "" || resp.Rendered != want {
+		t.Fatalf("unexpected render %q (error %q)", resp.Rendered, resp.Error)
+	}
+}
+
+func TestQuoteAndTrimHelpers(t *testing.T) {
+	templatePath := filepath.Join(t.TempDir(), "page.tmpl")
+	writeFile(t, templatePath, `{{ quote "a\"b" 1 .missing }}|{{ squote "it" }}|{{ shellQuote "it's" "a b" }}|{{ "v1.2" | trimPrefix "v" }}|{{ "app.yaml" | trimSuffix ".yaml" }}`)
+
+	resp := run(templatePath, "", renderOptions{})
+	want := `"a\"b" "1"|'it'|'it'\''s' 'a b'|1.2|app`
+	if resp.Error != "" || resp.Rendered != want {
+		t.Fatalf("unexpected render %q (error %q)", resp.Rendered, resp.Error)
+	}
+
+	for source, message := range map[string]string{
+		`{{ indent -1 "x" }}`:   "indent: spaces must be a whole number from 0 to 1024",
+		`{{ nindent 1.5 "x" }}`: "nindent: spaces must be a whole number from 0 to 1024",
+		`{{ indent "4" "x" }}`:  "indent: expected a number, got string",
+		`{{ indent 5000 "x" }}`: "indent: spaces must be a whole number from 0 to 1024",
+	} {
+		writeFile(t, templatePath, source)
+		if resp := run(templatePath, "", renderOptions{}); !strings.Contains(resp.Error, message) {
+			t.Errorf("%s: expected an error containing %q, got %+v", source, message, resp)
+		}
+	}
+}
@@ -37,6 +37,18 @@ export class DiagnosticService implements vscode.Disposable {
           : vscode.DiagnosticSeverity.Error
       );
       vscodeDiag.source = 'go-template-studio';
+      if (diagnostic.related?.length) {
+        vscodeDiag.relatedInformation = diagnostic.related.map(
+          (related) =>
+            new vscode.DiagnosticRelatedInformation(
+              new vscode.Location(
+                this.resolveTargetUri(templateUri, contextUri, related.file),
+                new vscode.Position(Math.max(related.line - 1, 0), Math.max(related.column - 1, 0))
+              ),
+              related.message
+            )
+        );
+      }
 
       const collection = entries.get(key) ?? [];
       collection.push(vscodeDiag);
@@ -134,10 +146,17 @@ export class DiagnosticService implements vscode.Disposable {
     const zeroBasedLine = line && line > 0 ? line - 1 : 0;
     const zeroBasedColumn = column && column > 0 ? column - 1 : 0;
 
-    const range = new vscode.Range(
-      new vscode.Position(zeroBasedLine, 0),
-      new vscode.Position(zeroBasedLine, Number.MAX_SAFE_INTEGER)
-    );
+    const endColumn = diagnostic.endColumn;
+    const range =
+      column && column > 0 && endColumn && endColumn > column
+        ? new vscode.Range(
+            new vscode.Position(zeroBasedLine, zeroBasedColumn),
+            new vscode.Position(zeroBasedLine, endColumn - 1)
+          )
+        : new vscode.Range(
+            new vscode.Position(zeroBasedLine, 0),
+            new vscode.Position(zeroBasedLine, Number.MAX_SAFE_INTEGER)
+          );
 
     return {
       message,
@@ -10,6 +10,15 @@ export interface RenderDiagnostic {
   file?: string;
   line?: number;
   column?: number;
+  endColumn?: number;
+  related?: RelatedLocation[];
+}
+
+export interface RelatedLocation {
+  message: string;
+  file?: string;
+  line: number;
+  column: number;
 }
 
 export interface RenderResult {
@@ -39,13 +48,15 @@ export class RendererService {
     const contextSnapshot = contextFile ? await this.createSnapshot(contextFile) : undefined;
 
     try {
-      const { command, args, mode } = await this.resolveRendererCommand(
+      const { command, args, mode, cwd } = await this.resolveRendererCommand(
         templateSnapshot.fsPath,
-        contextSnapshot?.fsPath
+        contextSnapshot?.fsPath,
+        await this.getProjectConfigPath(template),
+        this.getIncludePatterns(template)
       );
       this.output.appendLine(`[renderer] Executing (${mode}): ${command} ${args.join(' ')}`);
 
-      const response = await this.spawnProcess(command, args);
+      const response = await this.spawnProcess(command, args, cwd);
 
       return {
         rendered: response.rendered ?? '',
@@ -61,8 +72,10 @@ export class RendererService {
 
   private async resolveRendererCommand(
     templatePath: string,
-    contextPath?: string
-  ): Promise<{ command: string; args: string[]; mode: 'bundled' | 'system' }> {
+    contextPath?: string,
+    configPath?: string,
+    includePatterns: string[] = []
+  ): Promise<{ command: string; args: string[]; mode: 'bundled' | 'system'; cwd?: string }> {
     const config = vscode.workspace.getConfiguration('goTemplateStudio');
     const goBinary = config.get<string>('goBinary', 'go');
     const rendererMode = config.get<'auto' | 'bundled' | 'system'>('rendererMode', 'auto');
@@ -77,23 +90,84 @@ export class RendererService {
       );
     }
 
-    const args = ['--template', templatePath];
+    // VS Code positions count UTF-16 code units, so ask the worker to report columns the same way.
+    const args = ['--template', templatePath, '--position-encoding', 'utf-16'];
     if (contextPath) {
       args.push('--context', contextPath);
     }
+    if (configPath) {
+      args.push('--config', configPath);
+    }
+    const functionLibrary = config.get<string>('functionLibrary', 'builtin');
+    if (functionLibrary !== 'builtin') {
+      args.push('--funcs', functionLibrary);
+    }
+    const leftDelimiter = config.get<string>('leftDelimiter', '');
+    if (leftDelimiter) {
+      args.push('--left-delim', leftDelimiter);
+    }
+    const rightDelimiter = config.get<string>('rightDelimiter', '');
+    if (rightDelimiter) {
+      args.push('--right-delim', rightDelimiter);
+    }
+    const missingKey = config.get<string>('missingKey', 'off');
+    if (missingKey !== 'off') {
+      args.push('--missing-key', missingKey);
+    }
+    const renderTimeout = config.get<string>('renderTimeout', '10s');
+    if (renderTimeout) {
+      args.push('--timeout', renderTimeout);
+    }
+    const maxOutputBytes = config.get<number>('maxOutputBytes', 10485760);
+    if (maxOutputBytes > 0) {
+      args.push('--max-output-bytes', String(maxOutputBytes));
+    }
+    const maxIterations = config.get<number>('maxIterations', 1000000);
+    if (maxIterations > 0) {
+      args.push('--max-iterations', String(maxIterations));
+    }
+    for (const pattern of includePatterns) {
+      args.push('--include', pattern);
+    }
 
     if (preferBundled && bundledBinary) {
       return { command: bundledBinary, args, mode: 'bundled' };
     }
 
-    const workerUri = vscode.Uri.joinPath(this.context.extensionUri, 'go-worker', 'main.go');
+    // The worker spans several files in its own module, so run the package from its directory.
+    const workerUri = vscode.Uri.joinPath(this.context.extensionUri, 'go-worker');
     return {
       command: goBinary,
-      args: ['run', workerUri.fsPath, ...args],
+      args: ['run', '.', ...args],
       mode: 'system',
+      cwd: workerUri.fsPath,
     };
   }
 
+  // Include globs are relative to the workspace folder; the worker runs elsewhere, so pass absolute patterns.
+  private getIncludePatterns(template: vscode.Uri): string[] {
+    const patterns = vscode.workspace.getConfiguration('goTemplateStudio', template).get<string[]>('includePatterns', []);
+    const folder = vscode.workspace.getWorkspaceFolder(template);
+    return patterns.map((pattern) =>
+      path.isAbsolute(pattern) || !folder ? pattern : path.join(folder.uri.fsPath, pattern)
+    );
+  }
+
+  private async getProjectConfigPath(template: vscode.Uri): Promise<string | undefined> {
+    const folder = vscode.workspace.getWorkspaceFolder(template);
+    if (!folder) {
+      return undefined;
+    }
+
+    const configUri = vscode.Uri.joinPath(folder.uri, '.vscode', 'goTemplateStudio.json');
+    try {
+      await fs.access(configUri.fsPath);
+      return configUri.fsPath;
+    } catch {
+      return undefined;
+    }
+  }
+
   private async createSnapshot(uri: vscode.Uri): Promise<FileSnapshot> {
     const document = vscode.workspace.textDocuments.find((doc) => doc.uri.toString() === uri.toString());
     if (!document || !document.isDirty) {
@@ -175,9 +249,9 @@ export class RendererService {
     }
   }
 
-  private spawnProcess(command: string, args: string[]): Promise<GoWorkerResponse> {
+  private spawnProcess(command: string, args: string[], cwd?: string): Promise<GoWorkerResponse> {
     return new Promise((resolve, reject) => {
-      const child = spawn(command, args, { stdio: ['ignore', 'pipe', 'pipe'] });
+      const child = spawn(command, args, { cwd, stdio: ['ignore', 'pipe', 'pipe'] });
       let stdout = '';
       let stderr = '';
 